@@ -0,0 +1,77 @@
+// Command jaj-catalog serves the catalog gRPC API on CATALOG_GRPC_ADDRESS
+// (default :9090) and, while callers migrate, the MCP service's legacy
+// JSON "/query" endpoint on CATALOG_HTTP_ADDRESS (default :9000; set it to
+// "off" to disable).
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"server/internal/catalog"
+	"server/internal/catalogpb"
+	"server/internal/db"
+	"server/internal/monitoring"
+)
+
+func main() {
+	_ = godotenv.Load()
+
+	logger := monitoring.NewLogger(os.Getenv("LOG_VERBOSE") == "true")
+	defer zap.RedirectStdLog(logger)()
+
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+	sqlDB, err := db.Connect(databaseURL)
+	if err != nil {
+		logger.Fatal("db connect failed", zap.Error(err))
+	}
+	defer sqlDB.Close()
+
+	srv := catalog.NewServer(sqlDB)
+
+	httpAddr := envOr("CATALOG_HTTP_ADDRESS", ":9000")
+	if httpAddr != "off" {
+		legacy := &http.Server{
+			Addr:         httpAddr,
+			Handler:      catalog.MakeLegacyHandler(srv, logger),
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			logger.Info("starting legacy catalog HTTP server", zap.String("addr", httpAddr))
+			if err := legacy.ListenAndServe(); err != nil {
+				logger.Fatal("legacy catalog HTTP server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	grpcAddr := envOr("CATALOG_GRPC_ADDRESS", ":9090")
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		logger.Fatal("catalog listen failed", zap.Error(err))
+	}
+	gs := grpc.NewServer()
+	catalogpb.RegisterCatalogServer(gs, srv)
+
+	logger.Info("starting catalog gRPC server", zap.String("addr", grpcAddr))
+	if err := gs.Serve(lis); err != nil {
+		logger.Fatal("catalog gRPC server failed", zap.Error(err))
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// config is the JSON file passed with -config; see loadgen.example.json.
+type config struct {
+	Users     int              `json:"users"`     // simulated students, each with its own account
+	Duration  duration         `json:"duration"`  // how long to run once every user has started
+	RampUp    duration         `json:"rampUp"`    // users start evenly spread over this
+	ThinkTime duration         `json:"thinkTime"` // mean pause between a user's requests
+	Mix       map[string]int   `json:"mix"`       // action name -> relative weight
+	Messages  []string         `json:"messages"`  // chat orders, sent at random by chat_order
+	Budgets   map[string]limit `json:"budgets"`   // action name -> what it must stay within
+}
+
+// limit is one action's performance budget. Zero fields are not checked.
+type limit struct {
+	P50          duration `json:"p50"`
+	P95          duration `json:"p95"`
+	P99          duration `json:"p99"`
+	MaxErrorRate float64  `json:"maxErrorRate"` // share of requests that failed, 0 to 1
+}
+
+// duration is a time.Duration written in JSON as a string such as "250ms".
+type duration struct{ time.Duration }
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// defaultConfig is used for whatever the config file leaves out.
+var defaultConfig = config{
+	Users:     10,
+	Duration:  duration{time.Minute},
+	RampUp:    duration{10 * time.Second},
+	ThinkTime: duration{time.Second},
+	Mix: map[string]int{
+		"browse":     40,
+		"chat_order": 25,
+		"confirm":    10,
+		"history":    20,
+		"login":      5,
+	},
+	Messages: []string{
+		"2 bread and 1 sugar",
+		"I need a toothpaste and 3 milk",
+		"1 rice 5kg please",
+	},
+}
+
+// loadConfig reads path over defaultConfig. An empty path runs the defaults
+// with no budgets.
+func loadConfig(path string) (config, error) {
+	cfg := defaultConfig
+	if path == "" {
+		return cfg, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	for name := range cfg.Mix {
+		if _, ok := actions[name]; !ok {
+			return cfg, fmt.Errorf("%s: unknown action %q in mix", path, name)
+		}
+	}
+	for name := range cfg.Budgets {
+		if _, ok := actions[name]; !ok {
+			return cfg, fmt.Errorf("%s: unknown action %q in budgets", path, name)
+		}
+	}
+	if cfg.Users < 1 {
+		return cfg, fmt.Errorf("%s: users must be at least 1", path)
+	}
+	if len(cfg.Messages) == 0 && cfg.Mix["chat_order"] > 0 {
+		return cfg, fmt.Errorf("%s: chat_order needs messages", path)
+	}
+	return cfg, nil
+}
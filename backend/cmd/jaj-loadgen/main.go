@@ -0,0 +1,122 @@
+// Command jaj-loadgen drives a running jaj-server with simulated students,
+// each signing up, then browsing the menu, ordering and confirming through
+// the chat, and checking their order history in the proportions of a mix:
+//
+//	go run ./cmd/jaj-loadgen -target http://localhost:8080 -config cmd/jaj-loadgen/loadgen.example.json
+//
+// It prints p50, p95, and p99 latencies per action and exits 1 when any
+// breaks a budget from the config, so a run can gate a change to the
+// database pool or rate limits. Point it at a disposable instance: every
+// user is a real account, and chat orders call the LLM.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+func main() {
+	target := flag.String("target", getenv("LOADGEN_BASE_URL", "http://localhost:8080"), "base URL of the jaj-server under test")
+	configPath := flag.String("config", "", "JSON file with users, duration, mix, and budgets")
+	users := flag.Int("users", 0, "simulated students, overriding the config")
+	runFor := flag.Duration("duration", 0, "how long to run, overriding the config")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	if *users > 0 {
+		cfg.Users = *users
+	}
+	if *runFor > 0 {
+		cfg.Duration.Duration = *runFor
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("%d users against %s for %s (ramp-up %s)\n", cfg.Users, *target, cfg.Duration, cfg.RampUp)
+	rec := newRecorder()
+	start := time.Now()
+	if err := runUsers(ctx, *target, cfg, rec); err != nil {
+		log.Fatalf("load run: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	breaches := report(os.Stdout, rec.summaries(), cfg.Budgets, elapsed)
+	if len(breaches) > 0 {
+		fmt.Printf("%d budget(s) exceeded:\n", len(breaches))
+		for _, b := range breaches {
+			fmt.Println("  " + b)
+		}
+		os.Exit(1)
+	}
+	if len(cfg.Budgets) > 0 {
+		fmt.Println("all budgets met")
+	}
+}
+
+// runUsers starts cfg.Users users spread over the ramp-up and runs them for
+// cfg.Duration after the last has started. It fails only if no user could
+// sign up, since nothing would be measured.
+func runUsers(ctx context.Context, baseURL string, cfg config, rec *recorder) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.RampUp.Duration+cfg.Duration.Duration)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		started int
+		lastErr error
+	)
+	step := cfg.RampUp.Duration / time.Duration(cfg.Users)
+	for i := 0; i < cfg.Users; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(step):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			u := newUser(baseURL, cfg, rec, seed)
+			if err := u.signup(ctx); err != nil {
+				mu.Lock()
+				lastErr = err
+				mu.Unlock()
+				return
+			}
+			mu.Lock()
+			started++
+			mu.Unlock()
+			u.run(ctx)
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+
+	if started == 0 && lastErr != nil {
+		return fmt.Errorf("no user could sign up: %w", lastErr)
+	}
+	if started < cfg.Users {
+		fmt.Printf("%d of %d users signed up; last error: %v\n", started, cfg.Users, lastErr)
+	}
+	return nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
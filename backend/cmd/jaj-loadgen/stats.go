@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recorder collects every request's latency and outcome by action. It is
+// safe for concurrent use by all users.
+type recorder struct {
+	mu      sync.Mutex
+	samples map[string]*samples
+}
+
+type samples struct {
+	latencies []time.Duration
+	errors    int // transport failures and error statuses other than 429
+	throttled int // 429s, kept apart so rate limits can be sized
+}
+
+func newRecorder() *recorder {
+	return &recorder{samples: make(map[string]*samples)}
+}
+
+// record adds one request; status is 0 when it failed before a response.
+func (r *recorder) record(action string, status int, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.samples[action]
+	if s == nil {
+		s = &samples{}
+		r.samples[action] = s
+	}
+	s.latencies = append(s.latencies, elapsed)
+	switch {
+	case status == 429:
+		s.throttled++
+	case status == 0 || status >= 400:
+		s.errors++
+	}
+}
+
+// summary is one action's results.
+type summary struct {
+	Action        string
+	Requests      int
+	Errors        int
+	Throttled     int
+	P50, P95, P99 time.Duration
+}
+
+func (s summary) errorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+// summaries returns the results so far, by action name.
+func (r *recorder) summaries() []summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]summary, 0, len(r.samples))
+	for action, s := range r.samples {
+		sorted := append([]time.Duration(nil), s.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		out = append(out, summary{
+			Action:    action,
+			Requests:  len(sorted),
+			Errors:    s.errors,
+			Throttled: s.throttled,
+			P50:       percentile(sorted, 50),
+			P95:       percentile(sorted, 95),
+			P99:       percentile(sorted, 99),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Action < out[j].Action })
+	return out
+}
+
+// percentile returns the nearest-rank pth percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// check lists how s breaks its budget, if it does.
+func (s summary) check(b limit) []string {
+	var breaches []string
+	for _, c := range []struct {
+		name        string
+		got, budget time.Duration
+	}{{"p50", s.P50, b.P50.Duration}, {"p95", s.P95, b.P95.Duration}, {"p99", s.P99, b.P99.Duration}} {
+		if c.budget > 0 && c.got > c.budget {
+			breaches = append(breaches, fmt.Sprintf("%s %s: %s over budget %s", s.Action, c.name, ms(c.got), ms(c.budget)))
+		}
+	}
+	if b.MaxErrorRate > 0 && s.errorRate() > b.MaxErrorRate {
+		breaches = append(breaches, fmt.Sprintf("%s errors: %.2f%% over budget %.2f%%",
+			s.Action, 100*s.errorRate(), 100*b.MaxErrorRate))
+	}
+	return breaches
+}
+
+// report prints one line per action and returns every budget breach.
+func report(w io.Writer, results []summary, budgets map[string]limit, elapsed time.Duration) []string {
+	fmt.Fprintf(w, "%-11s %-24s %8s %7s %7s %9s %9s %9s\n",
+		"action", "endpoint", "requests", "rps", "errors", "p50", "p95", "p99")
+	var breaches []string
+	for _, s := range results {
+		a := actions[s.Action]
+		fmt.Fprintf(w, "%-11s %-24s %8d %7.1f %6.2f%% %9s %9s %9s",
+			s.Action, a.method+" "+a.path, s.Requests, float64(s.Requests)/elapsed.Seconds(),
+			100*s.errorRate(), ms(s.P50), ms(s.P95), ms(s.P99))
+		if s.Throttled > 0 {
+			fmt.Fprintf(w, "  (%d throttled)", s.Throttled)
+		}
+		fmt.Fprintln(w)
+		breaches = append(breaches, s.check(budgets[s.Action])...)
+	}
+	return breaches
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d.Microseconds())/1000)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+)
+
+// action is one kind of request a simulated student makes.
+type action struct {
+	method, path string
+	body         func(u *user) interface{} // nil sends no body
+}
+
+// actions are the requests a mix can weight, named as in the config.
+var actions = map[string]action{
+	"login": {http.MethodPost, "/v1/login", func(u *user) interface{} {
+		return map[string]string{"email": u.email, "password": u.password}
+	}},
+	"browse": {http.MethodGet, "/v1/chat/menu", nil},
+	"chat_order": {http.MethodPost, "/v1/chat/prompt", func(u *user) interface{} {
+		return map[string]string{"message": u.cfg.Messages[u.rng.Intn(len(u.cfg.Messages))]}
+	}},
+	"confirm": {http.MethodPost, "/v1/chat/prompt", func(u *user) interface{} {
+		return map[string]string{"message": "confirm"}
+	}},
+	"history": {http.MethodGet, "/v1/orders", nil},
+}
+
+// user is one simulated student with its own account and cookie jar.
+type user struct {
+	baseURL  string
+	cfg      config
+	rec      *recorder
+	client   *http.Client
+	rng      *mathrand.Rand
+	email    string
+	password string
+	picks    []string // action names, repeated by weight
+}
+
+func newUser(baseURL string, cfg config, rec *recorder, seed int64) *user {
+	jar, _ := cookiejar.New(nil)
+	u := &user{
+		baseURL: baseURL,
+		cfg:     cfg,
+		rec:     rec,
+		client:  &http.Client{Jar: jar, Timeout: 30 * time.Second},
+		rng:     mathrand.New(mathrand.NewSource(seed)),
+	}
+	for name, weight := range cfg.Mix {
+		for i := 0; i < weight; i++ {
+			u.picks = append(u.picks, name)
+		}
+	}
+	return u
+}
+
+// signup registers a fresh account, which the server verifies immediately,
+// and logs in. Signup is not measured: it is setup, not traffic.
+func (u *user) signup(ctx context.Context) error {
+	suffix := randomSuffix()
+	u.email = "loadgen_" + suffix + "@example.test"
+	u.password = "correct horse battery staple"
+	status, err := u.send(ctx, http.MethodPost, "/v1/signup", map[string]string{
+		"username": "loadgen_" + suffix, "email": u.email, "password": u.password,
+	})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("signup: got %d", status)
+	}
+	return u.do(ctx, "login")
+}
+
+// run makes requests picked from the mix, pausing around ThinkTime between
+// them, until ctx is done.
+func (u *user) run(ctx context.Context) {
+	if len(u.picks) == 0 {
+		return
+	}
+	for {
+		pause := time.Duration(u.rng.ExpFloat64() * float64(u.cfg.ThinkTime.Duration))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pause):
+		}
+		u.do(ctx, u.picks[u.rng.Intn(len(u.picks))])
+	}
+}
+
+// do makes one request for the named action and records it. Requests cut
+// short by the end of the run are not recorded.
+func (u *user) do(ctx context.Context, name string) error {
+	a := actions[name]
+	var body interface{}
+	if a.body != nil {
+		body = a.body(u)
+	}
+	start := time.Now()
+	status, err := u.send(ctx, a.method, a.path, body)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	u.rec.record(name, status, time.Since(start))
+	if err == nil && status >= 400 {
+		err = fmt.Errorf("%s %s: got %d", a.method, a.path, status)
+	}
+	return err
+}
+
+// send issues a JSON request and returns its status after reading the body.
+func (u *user) send(ctx context.Context, method, path string, body interface{}) (int, error) {
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.baseURL+path, reqBody)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
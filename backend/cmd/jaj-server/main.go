@@ -1,29 +1,60 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 	"go.uber.org/zap"
 
 	"server/internal/admin"
+	"server/internal/alerts"
+	"server/internal/announcements"
 	"server/internal/auth"
+	"server/internal/background"
+	"server/internal/campaigns"
 	"server/internal/chat"
 	"server/internal/config"
 	"server/internal/db"
+	"server/internal/delivery"
 	"server/internal/email"
+	"server/internal/errors/reporter"
+	"server/internal/events"
+	"server/internal/export"
+	"server/internal/fieldcrypt"
+	"server/internal/httpx"
+	"server/internal/integrity"
+	"server/internal/inventory"
+	"server/internal/jobs"
 	"server/internal/monitoring"
 	"server/internal/orders"
+	"server/internal/payments"
+	"server/internal/realtime"
+	"server/internal/retention"
+	"server/internal/secrets"
+	"server/internal/segments"
+	"server/internal/statements"
+	"server/internal/support"
+	"server/internal/waitlist"
+	"server/internal/webpush"
 )
 
+// shutdownTimeout is how long shutdown waits for requests in flight, then
+// again for background tasks, before exiting anyway.
+const shutdownTimeout = 20 * time.Second
+
 func buildAllowedOrigins() []string {
 	defaults := []string{
 		"http://localhost:5173",
@@ -51,100 +82,455 @@ func buildAllowedOrigins() []string {
 	return origins
 }
 
+// adminOnly lets only signed-in admins through to h; students get a 403.
+func adminOnly(sqlDB *sql.DB, h http.Handler) http.Handler {
+	return auth.RequireSession(sqlDB)(auth.RequireAdmin(sqlDB)(h))
+}
+
 func main() {
 	_ = godotenv.Load()
 
-	cfg, err := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "vapid-keys" {
+		pub, priv, err := webpush.GenerateKeys()
+		if err != nil {
+			log.Fatalf("vapid-keys: %v", err)
+		}
+		fmt.Printf("VAPID_PUBLIC_KEY=%s\nVAPID_PRIVATE_KEY=%s\n", pub, priv)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "field-key" {
+		key, err := fieldcrypt.GenerateKey()
+		if err != nil {
+			log.Fatalf("field-key: %v", err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "reseal" {
+		if err := runResealCommand(); err != nil {
+			log.Fatalf("reseal: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	secretsProvider, err := secrets.FromEnv()
+	if err != nil {
+		log.Fatalf("secrets provider: %v", err)
+	}
+	cfg, err := config.Load(context.Background(), secretsProvider)
 	if err != nil {
 		log.Fatalf("config load: %v", err)
 	}
+	groqAPIKey := cfg.GroqAPIKey
 
-	groqAPIKey := os.Getenv("GROQ_API_KEY")
-	if groqAPIKey == "" {
-		log.Fatal("GROQ_API_KEY must be set")
-	}
+	logger := monitoring.NewLogger(cfg.LogVerbose)
+	defer zap.RedirectStdLog(logger)()
+	metrics := monitoring.NewMetrics()
 
-	logger := monitoring.NewLogger()
-	registry := monitoring.NewRegistry()
+	if cfg.FieldKeys != "" {
+		keyring, err := fieldcrypt.NewKeyring(cfg.FieldKeys, cfg.FieldIndexKey)
+		if err != nil {
+			logger.Fatal("field encryption keys", zap.Error(err))
+		}
+		fieldcrypt.Use(keyring)
+	} else if cfg.Env == "production" {
+		logger.Warn("FIELD_ENCRYPTION_KEYS is not set; phone numbers are stored in plain text")
+	}
 
-	sqlDB, err := db.Connect(cfg.DatabaseURL)
+	cluster, err := db.ConnectCluster(cfg.DatabaseURL, cfg.DatabaseReplicaURL)
 	if err != nil {
 		logger.Fatal("db connect failed", zap.Error(err))
 	}
-	defer sqlDB.Close()
+	defer cluster.Close()
+	sqlDB := cluster.Primary
+	metrics.RegisterDatabase(cluster.Primary, cluster.Replica, logger)
+
+	if cluster.HasReplica() {
+		lagCtx, stopLag := context.WithCancel(context.Background())
+		defer stopLag()
+		go cluster.MonitorLag(lagCtx, metrics.NewReplicaLagGauge(), logger, 15*time.Second)
+		logger.Info("read replica enabled")
+	}
+
+	// Migrations (disable with AUTO_MIGRATE=false and run `jaj-server migrate up` instead)
+	if cfg.AutoMigrate {
+		m, err := newMigrator(sqlDB)
+		if err != nil {
+			logger.Fatal("migrate init failed", zap.Error(err))
+		}
+		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+			logger.Fatal("migrations apply failed", zap.Error(err))
+		}
+		logger.Info("migrations applied")
+	} else {
+		logger.Info("auto-migrate disabled")
+	}
 
-	// Migrations
-	driver, err := postgres.WithInstance(sqlDB, &postgres.Config{})
+	// Report orphaned rows and missing foreign keys without delaying startup
+	go integrity.LogReport(context.Background(), sqlDB, logger)
+
+	mailer := email.NewClient(cfg.SMTPHost, cfg.SMTPUser, cfg.SMTPPass)
+	mailer.BaseURL = cfg.BaseURL
+	mailer.FrontendURL = cfg.FrontendURL
+	mailer.Plaintext = cfg.SMTPPlaintext
+	mailer.PoolSize = cfg.SMTPPoolSize
+	mailer.Metrics = metrics.Emails
+	mailer.Latency = metrics.EmailLatency
+	mailer.Retries = metrics.EmailRetries
+	mailer.Log = email.SQLDeliveryLog{DB: sqlDB}
+	mailer.Logger = logger
+	// Statements and announcements carry signed one-click unsubscribe links
+	mailer.Unsubscribe = &email.Unsubscriber{Key: []byte(cfg.JWTSecret), BaseURL: cfg.BaseURL}
+	if cfg.DKIMPrivateKey != "" {
+		signer, err := email.NewDKIMSigner(cfg.DKIMDomain, cfg.DKIMSelector, []byte(cfg.DKIMPrivateKey))
+		if err != nil {
+			logger.Fatal("DKIM key invalid", zap.Error(err))
+		}
+		mailer.DKIM = signer
+	}
+	defer mailer.Close()
+
+	// Pick up rotated SMTP credentials without a restart
+	refreshInterval := 5 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("SECRETS_REFRESH_INTERVAL")); err == nil && d > 0 {
+		refreshInterval = d
+	}
+	secretsCtx, stopSecrets := context.WithCancel(context.Background())
+	defer stopSecrets()
+	go secrets.Watch(secretsCtx, secretsProvider, []string{"SMTP_USER", "SMTP_PASS"}, refreshInterval,
+		func(v map[string]string) {
+			mailer.SetCredentials(v["SMTP_USER"], v["SMTP_PASS"])
+			logger.Info("SMTP credentials reloaded")
+		},
+		func(err error) { logger.Warn("secret refresh failed", zap.Error(err)) },
+	)
+
+	bus, err := events.New(cfg.EventBus, cfg.EventBusURL)
 	if err != nil {
-		logger.Fatal("migrate driver init failed", zap.Error(err))
+		logger.Fatal("event bus init failed", zap.Error(err))
+	}
+	defer bus.Close()
+	if mb, ok := bus.(*events.MemoryBus); ok {
+		mb.Dropped = metrics.EventsDropped
+	}
+
+	if _, err := orders.SubscribeEmailNotifications(bus, sqlDB, logger, mailer); err != nil {
+		logger.Fatal("order email subscription failed", zap.Error(err))
+	}
+	// Queue positions and ready times, pushed to students over the WebSocket
+	if _, err := orders.SubscribeETAUpdates(bus, sqlDB, logger); err != nil {
+		logger.Fatal("order ETA subscription failed", zap.Error(err))
 	}
-	m, err := migrate.NewWithDatabaseInstance("file://migrations", "postgres", driver)
+
+	// Browser push to admins on new and cancelled orders, when VAPID keys are set
+	pusher, err := webpush.NewSenderFromEnv()
 	if err != nil {
-		logger.Fatal("migrate init failed", zap.Error(err))
+		logger.Fatal("web push config invalid", zap.Error(err))
 	}
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		logger.Fatal("migrations apply failed", zap.Error(err))
+	if pusher != nil {
+		if _, err := orders.SubscribeAdminPush(bus, sqlDB, logger, pusher); err != nil {
+			logger.Fatal("admin push subscription failed", zap.Error(err))
+		}
 	}
-	logger.Info("migrations applied")
 
-	mailer := email.NewClient(cfg.SMTPHost, cfg.SMTPUser, cfg.SMTPPass)
+	reconcileCtx, stopReconcile := context.WithCancel(context.Background())
+	defer stopReconcile()
+	go orders.RunFeeReconciler(reconcileCtx, sqlDB, logger, time.Hour)
+	go orders.RunConsistencyChecker(reconcileCtx, sqlDB, bus, logger, metrics.ReconciliationFixes, 15*time.Minute)
+	go inventory.RunStockMonitor(reconcileCtx, sqlDB, mailer, logger, cfg.LowStockThreshold, 5*time.Minute)
+	go statements.RunMonthly(reconcileCtx, sqlDB, mailer, logger, time.Hour)
+	// Student segments for admin filters and campaign audiences, rebuilt nightly
+	go segments.RunNightly(reconcileCtx, sqlDB, logger, 15*time.Minute)
+	// Old transcripts, logs, and sessions, past their retention settings
+	go retention.Run(reconcileCtx, sqlDB, logger, metrics.RetentionPurged, time.Hour)
+	// Error rates and pool use over the alert window, emailed and pushed to admins
+	go alerts.NewEvaluator(sqlDB, logger, mailer, pusher, metrics).Run(reconcileCtx, time.Minute)
 
+	// Move finished orders older than ORDER_ARCHIVE_MONTHS (default 12; 0
+	// turns archival off) out of the live tables
+	archiveMonths := 12
+	if v := os.Getenv("ORDER_ARCHIVE_MONTHS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			logger.Fatal("ORDER_ARCHIVE_MONTHS must be a non-negative integer")
+		}
+		archiveMonths = n
+	}
+	if archiveMonths > 0 {
+		go orders.RunArchiver(reconcileCtx, sqlDB, logger, archiveMonths, 6*time.Hour)
+	}
+
+	// Announcement campaigns go out at CAMPAIGN_RATE emails a minute
+	campaignRate := 60
+	if v := os.Getenv("CAMPAIGN_RATE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			logger.Fatal("CAMPAIGN_RATE must be a positive integer")
+		}
+		campaignRate = n
+	}
+	campaignSender := campaigns.NewSender(sqlDB, mailer, logger, cfg.BaseURL, campaignRate)
+
+	// Background jobs queued by handlers, run by every instance
+	jobQueue := jobs.NewQueue(sqlDB, logger)
+	jobQueue.Duration = metrics.JobDuration
+	jobQueue.Retries = metrics.JobRetries
+	jobQueue.DeadLetters = metrics.JobDeadLetters
+	admin.RegisterJobs(jobQueue, sqlDB, campaignSender)
+	orders.RegisterJobs(jobQueue, sqlDB, mailer)
+	go jobQueue.Run(reconcileCtx)
+
+	// Incremental warehouse export to S3, when a bucket is configured
+	s3Export, err := export.NewS3FromEnv()
+	if err != nil {
+		logger.Fatal("export config invalid", zap.Error(err))
+	}
+	if s3Export != nil {
+		exportInterval := time.Hour
+		if d, err := time.ParseDuration(os.Getenv("EXPORT_INTERVAL")); err == nil && d > 0 {
+			exportInterval = d
+		}
+		go export.RunIncremental(reconcileCtx, sqlDB, s3Export, logger, exportInterval)
+		logger.Info("warehouse export enabled", zap.String("bucket", s3Export.Bucket), zap.Duration("interval", exportInterval))
+	}
+
+	hub := realtime.NewHub()
+	if err := hub.Forward(bus, orders.TopicOrderStatus, orders.TopicOrderRepriced, orders.TopicOrderETA); err != nil {
+		logger.Fatal("websocket event forwarding failed", zap.Error(err))
+	}
+	allowedOrigins := buildAllowedOrigins()
+
+	errReporter, err := reporter.FromEnv(cfg.Env)
+	if err != nil {
+		logger.Fatal("error reporter init failed", zap.Error(err))
+	}
+
+	// mux holds the v1 API routes; it is mounted under /v1 and, for older
+	// clients, at the root by the version router below.
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", monitoring.MakeMetricsHandler(registry))
 
-	// Auth endpoints (public)
-	mux.Handle("/signup", auth.MakeSignupHandler(sqlDB, mailer, cfg.JWTSecret))
-	mux.Handle("/verify", auth.MakeVerifyHandler(sqlDB))
+	// Auth endpoints (public). Emailed links open /verify and /password-reset
+	// in a browser, which gets HTML pages linking back to the web app.
+	landingPages := auth.NewPages(cfg.FrontendURL)
+	mux.Handle("/signup", auth.MakeSignupHandler(sqlDB, mailer, cfg.JWTSecret, cfg.InviteOnly))
+	mux.Handle("/verify", auth.MakeVerifyHandler(sqlDB, metrics.Verifications, landingPages))
 	mux.Handle("/login", auth.MakeLoginHandler(sqlDB)) // no jwtSecret now
-	mux.Handle("/password-reset", auth.MakePasswordResetHandler(sqlDB, mailer, cfg.JWTSecret))
+	mux.Handle("/password-reset", auth.MakePasswordResetHandler(sqlDB, mailer, cfg.JWTSecret, landingPages))
+
+	// Delivery, bounce, and complaint notifications from the mail relay
+	if cfg.EmailWebhookSecret != "" {
+		mux.Handle("/webhooks/email", email.MakeWebhookHandler(sqlDB, cfg.EmailWebhookSecret, logger))
+	}
+	// Tracking pixel in campaign emails, counting opens
+	mux.Handle("GET /email/open/{token}", campaigns.MakeOpenHandler(sqlDB, logger))
+	// Unsubscribe links and List-Unsubscribe one-click posts
+	mux.Handle("/email/unsubscribe", email.MakeUnsubscribeHandler(sqlDB, mailer.Unsubscribe, logger))
+	// Banners for the frontend and the chat greeting; public, so the login
+	// page can show them
+	mux.Handle("GET /announcements", announcements.MakeHandler(sqlDB, logger))
 
-	// Profile endpoint (requires valid session cookie)
+	// Profile and account endpoints (require valid session cookie)
 	mux.Handle(
 		"/me",
 		auth.RequireSession(sqlDB)(
 			auth.MakeProfileHandler(sqlDB),
 		),
 	)
+	mux.Handle("/me/password", auth.RequireSession(sqlDB)(auth.MakeChangePasswordHandler(sqlDB)))
+	mux.Handle("/me/email", auth.RequireSession(sqlDB)(auth.MakeChangeEmailHandler(sqlDB, mailer, cfg.BaseURL)))
+	// Opened from the confirmation email, possibly on another device
+	mux.Handle("/me/email/confirm", auth.MakeConfirmEmailChangeHandler(sqlDB))
+
+	// Waitlist for a full campus or sold-out items; claims go out every minute
+	waitlistHandler := auth.RequireSession(sqlDB)(waitlist.MakeHandler(sqlDB, logger))
+	mux.Handle("/waitlist", waitlistHandler)
+	mux.Handle("/waitlist/", waitlistHandler)
+	go waitlist.RunNotifier(reconcileCtx, sqlDB, mailer, logger, cfg.BaseURL, time.Minute)
+	// Nudge students with unconfirmed chat drafts before the order cutoff
+	go orders.RunCutoffReminders(reconcileCtx, sqlDB, mailer, pusher, logger, cfg.BaseURL, time.Minute)
+
+	// Support tickets about orders, answered from the admin queue
+	supportHandler := auth.RequireSession(sqlDB)(support.MakeHandler(sqlDB, logger))
+	mux.Handle("/support/tickets", supportHandler)
+	mux.Handle("/support/tickets/", supportHandler)
+
+	extractor := chat.NewGroqExtractor(groqAPIKey, os.Getenv("GROQ_MODEL"))
+	extractor.Logger = logger
+	extractor.Latency = metrics.LLMLatency
+	// A sample of prompts and replies, per chat.llm_log_percent, for
+	// debugging extraction
+	llmLog := chat.NewLLMLog(sqlDB, logger)
+	extractor.Log = llmLog
+	go llmLog.Run(reconcileCtx, time.Hour)
 
-	baseURL := os.Getenv("BASE_URL")
-	if baseURL == "" {
-		baseURL = "http://localhost:8080"
+	// Catalog lookups over gRPC when CATALOG_GRPC_ADDR is set, otherwise the
+	// legacy MCP JSON endpoint
+	var catalog chat.CatalogSearcher
+	if addr := os.Getenv("CATALOG_GRPC_ADDR"); addr != "" {
+		grpcCatalog, conn, err := chat.NewGRPCCatalog(addr)
+		if err != nil {
+			logger.Fatal("catalog client init failed", zap.Error(err))
+		}
+		defer conn.Close()
+		grpcCatalog.Latency = metrics.CatalogLatency
+		catalog = grpcCatalog
+	} else {
+		mcpCatalog := chat.NewMCPCatalog(os.Getenv("MCP_URL"))
+		mcpCatalog.Latency = metrics.CatalogLatency
+		catalog = mcpCatalog
+	}
+	// CATALOG_SHADOW=postgres also runs every search through the catalog
+	// service's matcher in-process, counting and logging disagreements,
+	// before the service replaces MCP
+	if os.Getenv("CATALOG_SHADOW") == "postgres" {
+		pgCatalog := chat.NewPostgresCatalog(sqlDB)
+		pgCatalog.Latency = metrics.ShadowLatency
+		shadow := chat.NewShadowCatalog(catalog, pgCatalog, logger)
+		shadow.Compared = metrics.ShadowComparisons
+		catalog = shadow
+	}
+
+	// Chat moderation: blocklist always, plus Llama Guard on Groq when enabled
+	var moderators []chat.Moderator
+	moderators = append(moderators, chat.NewBlocklistModerator(config.SplitList(os.Getenv("CHAT_BLOCKLIST"))...))
+	if os.Getenv("CHAT_MODERATION_PROVIDER") == "groq-guard" {
+		guard := chat.NewGroqGuardModerator(groqAPIKey, os.Getenv("CHAT_MODERATION_MODEL"))
+		guard.Latency = metrics.LLMLatency
+		moderators = append(moderators, guard)
 	}
 
+	// Add-on suggestions in order summaries unless CHAT_RECOMMENDATIONS=off
+	var recommender *chat.Recommender
+	if os.Getenv("CHAT_RECOMMENDATIONS") != "off" {
+		recommender = chat.NewRecommender(sqlDB, logger, metrics.Suggestions)
+	}
+
+	// Catalog questions answered from a cached menu unless CHAT_MENU=off
+	var menu *chat.Menu
+	if os.Getenv("CHAT_MENU") != "off" {
+		menu = chat.NewMenu(sqlDB, logger, extractor)
+		go menu.Run(reconcileCtx, bus, 0)
+		mux.Handle(
+			"/chat/menu",
+			auth.RequireSession(sqlDB)(
+				chat.MakeMenuHandler(menu),
+			),
+		)
+	}
+
+	// Probes Groq and the catalog backend every 30s, starting at boot so
+	// their connections are warm before the first message; chat falls back
+	// to basic mode or fails fast while either is down
+	health := chat.NewHealth(logger)
+	health.Up = metrics.DependencyUp
+	health.Add(chat.DependencyLLM, extractor)
+	health.Add(chat.DependencyCatalog, chat.CatalogProber(catalog))
+	go health.Run(reconcileCtx, 30*time.Second)
+
 	// Chat endpoint
+	chatService := chat.NewService(
+		sqlDB, logger, metrics.Requests,
+		extractor,
+		catalog,
+		chat.ChainModerator{Moderators: moderators, Logger: logger},
+		bus,
+		recommender,
+		menu,
+		health,
+	)
 	mux.Handle(
 		"/chat/prompt",
 		auth.RequireSession(sqlDB)(
-			chat.MakePromptHandler(sqlDB, logger, registry, groqAPIKey, mailer, baseURL),
+			chat.MakePromptHandler(chatService),
 		),
 	)
+	// The assistant's name, tone, and greeting; public, for the chat's
+	// opening screen
+	mux.Handle("/chat/persona", chat.MakePersonaHandler(sqlDB, logger))
 
-	// Orders endpoint
+	// Orders endpoints: /orders and /orders/{id}
+	ordersHandler := auth.RequireSession(sqlDB)(
+		orders.MakeOrdersHandler(cluster, logger, metrics.Requests, bus, jobQueue),
+	)
+	mux.Handle("/orders", ordersHandler)
+	mux.Handle("/orders/", ordersHandler)
+
+	// Fulfillment staff packing checklists
 	mux.Handle(
-		"/orders",
+		"/staff/",
 		auth.RequireSession(sqlDB)(
-			orders.MakeOrdersHandler(sqlDB, logger, registry, mailer),
+			auth.RequireStaff(sqlDB)(
+				orders.MakePackingRouter(cluster, logger, bus, jobQueue),
+			),
 		),
 	)
 
-	// Admin router
+	// Runner manifest for deliveries to halls, stops ordered from DELIVERY_DEPOT
+	depot, err := delivery.DepotFromEnv()
+	if err != nil {
+		logger.Fatal("delivery config invalid", zap.Error(err))
+	}
 	mux.Handle(
-		"/admin/",
+		"/staff/delivery/",
 		auth.RequireSession(sqlDB)(
-			admin.MakeAdminRouter(sqlDB, logger),
+			auth.RequireStaff(sqlDB)(
+				delivery.MakeManifestHandler(sqlDB, logger, depot),
+			),
 		),
 	)
 
-	// CORS (allows cookie credentials)
-	allowedOrigins := buildAllowedOrigins()
+	// WebSocket push of order status events
+	mux.Handle(
+		"/ws",
+		auth.RequireSession(sqlDB)(
+			realtime.MakeWSHandler(hub, logger, allowedOrigins),
+		),
+	)
+
+	// Admin router, for admins only
+	mux.Handle(
+		"/admin/",
+		adminOnly(sqlDB, admin.MakeAdminRouter(cluster, logger, bus, payments.ManualProvider{}, mailer, pusher, jobQueue)),
+	)
+
+	// Runtime diagnostics, for admins only and only when switched on
+	var debugHandler http.Handler
+	if cfg.DebugEndpoints {
+		debugHandler = adminOnly(sqlDB, admin.MakeDebugRouter(cluster, bus, hub))
+		mux.Handle("/admin/debug/", debugHandler)
+	}
+
+	apiRouter := httpx.NewVersionRouter(1)
+	apiRouter.Handle(1, mux)
+
+	root := http.NewServeMux()
+	root.Handle("/metrics", monitoring.MakeMetricsHandler(metrics))
+	if debugHandler != nil {
+		root.Handle("/debug/pprof/", debugHandler)
+	}
+	root.Handle("/", apiRouter)
+
+	// CORS (allows cookie credentials). Inside it, RealIP finds each client's
+	// address behind the proxies in TRUSTED_PROXIES for httpx.ClientIP
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   allowedOrigins,
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization", "Accept", "Origin", "X-Requested-With"},
-		ExposedHeaders:   []string{"Content-Length", "Content-Type"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Accept", "Accept-Version", "Origin", "X-Requested-With", "X-Request-ID"},
+		ExposedHeaders:   []string{"Content-Length", "Content-Type", "X-Total-Count", "API-Version", "Deprecation", "X-Request-ID"},
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
-	}).Handler(mux)
+	}).Handler(httpx.RequestID(httpx.RealIP(cfg.TrustedProxies)(metrics.CountResponses(reporter.Recover(errReporter, logger)(
+		httpx.Compress(httpx.LimitBody(httpx.MaxBodyBytes)(cluster.Sticky(root))),
+	)))))
 
 	server := &http.Server{
 		Addr:         cfg.ServerAddress,
@@ -153,9 +539,55 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+	redirectServer := setupTLS(server, cfg)
+
+	// On SIGINT or SIGTERM, stop taking requests and finish those in
+	// flight, then give the work they left running in the background
+	// (emails, error reports) time to finish before exiting
+	stopCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-stopCtx.Done()
+		logger.Info("shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if redirectServer != nil {
+			if err := redirectServer.Shutdown(ctx); err != nil {
+				logger.Warn("HTTP redirect listener did not shut down cleanly", zap.Error(err))
+			}
+		}
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warn("requests still running at shutdown", zap.Error(err))
+		}
+	}()
+
+	if redirectServer != nil {
+		go func() {
+			logger.Info("redirecting HTTP to HTTPS", zap.String("addr", redirectServer.Addr))
+			if err := redirectServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				logger.Fatal("HTTP redirect listener failed", zap.Error(err))
+			}
+		}()
+	}
 
-	logger.Info("starting server", zap.String("addr", cfg.ServerAddress))
-	if err := server.ListenAndServe(); err != nil {
+	logger.Info("starting server", zap.String("addr", cfg.ServerAddress), zap.Bool("tls", cfg.TLS()))
+	if cfg.TLS() {
+		// Certificates come from the files, or from TLSConfig with autocert
+		err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
 		logger.Fatal("server failed", zap.Error(err))
 	}
+	<-drained
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if n := background.Wait(ctx); n > 0 {
+		logger.Warn("background tasks still running at shutdown", zap.Int("tasks", n))
+	}
+	logger.Info("server stopped")
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"server/internal/admin"
+	"server/internal/db"
+	"server/internal/events"
+	"server/internal/payments"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.uber.org/zap"
+)
+
+func TestAdminRoutesNeedAdmin(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie bool
+		expect func(mock sqlmock.Sqlmock)
+		want   int
+	}{
+		{name: "no session", want: http.StatusUnauthorized, expect: func(sqlmock.Sqlmock) {}},
+		{
+			name:   "student session",
+			cookie: true,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM sessions")).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "expires_at", "rotate"}).
+						AddRow(7, time.Now().Add(time.Hour), false))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT is_admin FROM users")).WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"is_admin"}).AddRow(false))
+			},
+			want: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sqlDB.Close()
+			tt.expect(mock)
+
+			router := admin.MakeAdminRouter(&db.Cluster{Primary: sqlDB}, zap.NewNop(), events.NewMemoryBus(),
+				payments.ManualProvider{}, nil, nil, nil)
+			r := httptest.NewRequest(http.MethodGet, "/admin/orders", nil)
+			if tt.cookie {
+				r.AddCookie(&http.Cookie{Name: "session_token", Value: "student"})
+			}
+			w := httptest.NewRecorder()
+			adminOnly(sqlDB, router).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("GET /admin/orders = %d, want %d", w.Code, tt.want)
+			}
+			// No order query may run for a non-admin
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
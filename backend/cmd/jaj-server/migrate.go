@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+
+	"server/internal/db"
+	"server/internal/secrets"
+	"server/migrations"
+)
+
+// migrationsDir is where `migrate create` writes new files; they are embedded
+// into the binary through the migrations package at build time.
+const migrationsDir = "migrations"
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// migrationFile is one direction of one embedded migration.
+type migrationFile struct {
+	Version uint
+	Name    string
+	Path    string
+}
+
+// newMigrator builds a migrate instance over an open database.
+func newMigrator(sqlDB *sql.DB) (*migrate.Migrate, error) {
+	driver, err := postgres.WithInstance(sqlDB, &postgres.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("migrate driver init: %w", err)
+	}
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate source init: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		return nil, fmt.Errorf("migrate init: %w", err)
+	}
+	return m, nil
+}
+
+// runMigrateCommand implements `jaj-server migrate <up|down|force|status|create>`.
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: jaj-server migrate <up|down|force|status|create> [args]")
+	}
+	sub, rest := args[0], args[1:]
+
+	if sub == "create" {
+		return migrateCreate(rest)
+	}
+
+	sp, err := secrets.FromEnv()
+	if err != nil {
+		return err
+	}
+	dbURL, err := sp.Get(context.Background(), "DATABASE_URL")
+	if err != nil {
+		return errors.New("DATABASE_URL is required")
+	}
+	sqlDB, err := db.Connect(dbURL)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	m, err := newMigrator(sqlDB)
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "up":
+		return migrateUp(m, rest)
+	case "down":
+		return migrateDown(m, rest)
+	case "force":
+		return migrateForce(m, rest)
+	case "status":
+		return migrateStatus(m)
+	default:
+		return fmt.Errorf("unknown migrate subcommand %q", sub)
+	}
+}
+
+func migrateUp(m *migrate.Migrate, args []string) error {
+	fset := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+	dryRun := fset.Bool("dry-run", false, "print the SQL that would run without applying it")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	steps, err := optionalSteps(fset.Args(), 0)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		current, _, err := currentVersion(m)
+		if err != nil {
+			return err
+		}
+		files, err := listMigrations("up")
+		if err != nil {
+			return err
+		}
+		var pending []migrationFile
+		for _, f := range files {
+			if f.Version > current {
+				pending = append(pending, f)
+			}
+		}
+		if steps > 0 && steps < len(pending) {
+			pending = pending[:steps]
+		}
+		return printMigrations(pending)
+	}
+
+	if steps > 0 {
+		err = m.Steps(steps)
+	} else {
+		err = m.Up()
+	}
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("no change")
+		return nil
+	}
+	return err
+}
+
+func migrateDown(m *migrate.Migrate, args []string) error {
+	fset := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+	dryRun := fset.Bool("dry-run", false, "print the SQL that would run without applying it")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	steps, err := optionalSteps(fset.Args(), 1)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		current, _, err := currentVersion(m)
+		if err != nil {
+			return err
+		}
+		files, err := listMigrations("down")
+		if err != nil {
+			return err
+		}
+		var rollback []migrationFile
+		for i := len(files) - 1; i >= 0 && len(rollback) < steps; i-- {
+			if files[i].Version <= current {
+				rollback = append(rollback, files[i])
+			}
+		}
+		return printMigrations(rollback)
+	}
+
+	err = m.Steps(-steps)
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("no change")
+		return nil
+	}
+	return err
+}
+
+func migrateForce(m *migrate.Migrate, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: jaj-server migrate force VERSION")
+	}
+	v, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid version %q", args[0])
+	}
+	return m.Force(v)
+}
+
+func migrateStatus(m *migrate.Migrate) error {
+	current, dirty, err := currentVersion(m)
+	if err != nil {
+		return err
+	}
+	files, err := listMigrations("up")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("current version: %d", current)
+	if dirty {
+		fmt.Print(" (dirty: fix the schema, then run `migrate force`)")
+	}
+	fmt.Println()
+	for _, f := range files {
+		state := "pending"
+		if f.Version <= current {
+			state = "applied"
+		}
+		fmt.Printf("  %04d  %-8s %s\n", f.Version, state, f.Name)
+	}
+	return nil
+}
+
+func migrateCreate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: jaj-server migrate create NAME")
+	}
+	name := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(args[0]), " ", "_"))
+	if name == "" {
+		return errors.New("migration name is required")
+	}
+
+	files, err := listMigrations("up")
+	if err != nil {
+		return err
+	}
+	next := uint(1)
+	if len(files) > 0 {
+		next = files[len(files)-1].Version + 1
+	}
+
+	for _, dir := range []string{"up", "down"} {
+		path := filepath.Join(migrationsDir, fmt.Sprintf("%04d_%s.%s.sql", next, name, dir))
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			return err
+		}
+		fmt.Println("created", path)
+	}
+	return nil
+}
+
+// currentVersion returns the applied version, treating "no migrations yet" as 0.
+func currentVersion(m *migrate.Migrate) (uint, bool, error) {
+	v, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return v, dirty, err
+}
+
+// listMigrations returns the migration files for one direction, ordered by version.
+func listMigrations(direction string) ([]migrationFile, error) {
+	entries, err := fs.ReadDir(migrations.FS, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []migrationFile
+	for _, e := range entries {
+		match := migrationFileRe.FindStringSubmatch(e.Name())
+		if match == nil || match[3] != direction {
+			continue
+		}
+		v, _ := strconv.ParseUint(match[1], 10, 64)
+		files = append(files, migrationFile{Version: uint(v), Name: match[2], Path: e.Name()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Version < files[j].Version })
+	return files, nil
+}
+
+// printMigrations writes each file's SQL to stdout for --dry-run.
+func printMigrations(files []migrationFile) error {
+	if len(files) == 0 {
+		fmt.Println("-- nothing to apply")
+		return nil
+	}
+	for _, f := range files {
+		body, err := fs.ReadFile(migrations.FS, f.Path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("-- %s\n%s\n\n", f.Path, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func optionalSteps(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid step count %q", args[0])
+	}
+	return n, nil
+}
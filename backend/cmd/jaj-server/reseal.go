@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"server/internal/db"
+	"server/internal/fieldcrypt"
+	"server/internal/secrets"
+)
+
+// runResealCommand implements `jaj-server reseal`: it encrypts every
+// designated column under the current field key, converting values written
+// in plain text or under an older key. Run it after enabling encryption and
+// after each key rotation, before dropping the old key.
+func runResealCommand() error {
+	ctx := context.Background()
+	sp, err := secrets.FromEnv()
+	if err != nil {
+		return err
+	}
+	dbURL, err := sp.Get(ctx, "DATABASE_URL")
+	if err != nil {
+		return errors.New("DATABASE_URL is required")
+	}
+	keys, err := sp.Get(ctx, "FIELD_ENCRYPTION_KEYS")
+	if err != nil {
+		return errors.New("FIELD_ENCRYPTION_KEYS is required")
+	}
+	indexKey, err := sp.Get(ctx, "FIELD_INDEX_KEY")
+	if err != nil {
+		return errors.New("FIELD_INDEX_KEY is required")
+	}
+	keyring, err := fieldcrypt.NewKeyring(keys, indexKey)
+	if err != nil {
+		return err
+	}
+	fieldcrypt.Use(keyring)
+
+	sqlDB, err := db.Connect(dbURL)
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	for _, col := range fieldcrypt.Designated {
+		n, err := fieldcrypt.Reseal(ctx, sqlDB, col)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s.%s: %d resealed\n", col.Table, col.Column, n)
+	}
+	return nil
+}
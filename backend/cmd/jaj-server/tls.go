@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"server/internal/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// setupTLS has server terminate TLS itself when cfg asks for it, with
+// certificates from files or from Let's Encrypt, and returns the plain HTTP
+// server that sends clients over to HTTPS, or nil if there is none. HTTP/2
+// is negotiated on the TLS listener. Let's Encrypt is only asked about the
+// allowlisted domains, and its HTTP challenges are answered on the redirect
+// listener.
+func setupTLS(server *http.Server, cfg *config.Config) *http.Server {
+	if !cfg.TLS() {
+		return nil
+	}
+	redirect := redirectToHTTPS(cfg.ServerAddress)
+	server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(cfg.AutocertDomains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		server.TLSConfig = m.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		redirect = m.HTTPHandler(redirect)
+	}
+	if cfg.HTTPRedirectAddr == "" {
+		return nil
+	}
+	return &http.Server{
+		Addr:         cfg.HTTPRedirectAddr,
+		Handler:      redirect,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+}
+
+// redirectToHTTPS sends each request to the same URL over HTTPS, on the
+// port of tlsAddr unless that is 443.
+func redirectToHTTPS(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,9 @@
+// Package e2e holds end-to-end tests that run jaj-server against real
+// Postgres and MailHog containers started with testcontainers-go. They need
+// Docker and are behind the integration build tag:
+//
+//	make e2e
+//
+// Each scenario drives the public HTTP API the way the client app does and
+// checks the resulting emails through the MailHog API.
+package e2e
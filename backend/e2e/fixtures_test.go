@@ -0,0 +1,37 @@
+//go:build integration
+
+package e2e
+
+import "database/sql"
+
+// fixtureItems is the catalog every scenario can order from.
+var fixtureItems = []struct {
+	Name     string
+	Category string
+	PriceUGX int
+}{
+	{"E2E Jesa Milk (2L)", "Dairy", 5000},
+	{"E2E Bread Loaf", "Bakery", 4000},
+	{"E2E Toothpaste", "Toiletries", 3500},
+}
+
+// seedCatalog inserts the fixture items if they are missing and returns their
+// ids by name.
+func seedCatalog(db *sql.DB) (map[string]int, error) {
+	ids := make(map[string]int, len(fixtureItems))
+	for _, it := range fixtureItems {
+		var id int
+		err := db.QueryRow(`SELECT id FROM items WHERE name=$1`, it.Name).Scan(&id)
+		if err == sql.ErrNoRows {
+			err = db.QueryRow(
+				`INSERT INTO items (name, category, price_ugx, available) VALUES ($1, $2, $3, TRUE) RETURNING id`,
+				it.Name, it.Category, it.PriceUGX,
+			).Scan(&id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids[it.Name] = id
+	}
+	return ids, nil
+}
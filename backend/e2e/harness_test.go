@@ -0,0 +1,166 @@
+//go:build integration
+
+package e2e
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// harness is one simulated client: its own cookie jar plus access to the
+// database for fixtures and to MailHog for sent mail.
+type harness struct {
+	baseURL    string
+	mailhogURL string
+	db         *sql.DB
+	catalog    map[string]int // fixture item name -> id
+	client     *http.Client
+}
+
+func newHarness(baseURL, mailhogURL string, db *sql.DB, catalog map[string]int) *harness {
+	jar, _ := cookiejar.New(nil)
+	return &harness{
+		baseURL:    baseURL,
+		mailhogURL: mailhogURL,
+		db:         db,
+		catalog:    catalog,
+		client:     &http.Client{Jar: jar, Timeout: 15 * time.Second},
+	}
+}
+
+// do sends a JSON request and fails unless the response has wantStatus. When
+// out is non-nil the response body is decoded into it.
+func (h *harness) do(method, path string, body interface{}, wantStatus int, out interface{}) error {
+	res, err := h.send(method, path, body)
+	if err != nil {
+		return err
+	}
+	if res.status != wantStatus {
+		return fmt.Errorf("%s %s: got %d, want %d: %s", method, path, res.status, wantStatus, res.body)
+	}
+	if out != nil {
+		if err := json.Unmarshal([]byte(res.body), out); err != nil {
+			return fmt.Errorf("%s %s: decode response: %w", method, path, err)
+		}
+	}
+	return nil
+}
+
+// response is a raw reply and how long it took, for comparing two requests.
+type response struct {
+	status  int
+	body    string
+	elapsed time.Duration
+}
+
+// send issues a JSON request and returns the reply whatever its status.
+func (h *harness) send(method, path string, body interface{}) (response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return response{}, err
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, h.baseURL+path, reqBody)
+	if err != nil {
+		return response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return response{}, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	return response{
+		status:  resp.StatusCode,
+		body:    strings.TrimSpace(string(raw)),
+		elapsed: time.Since(start),
+	}, nil
+}
+
+// signupAndLogin registers a fresh user and logs in, returning the email used.
+func (h *harness) signupAndLogin() (string, string, error) {
+	suffix := randomSuffix()
+	username := "e2e_" + suffix
+	emailAddr := username + "@example.test"
+	password := "correct horse battery staple"
+
+	if err := h.do(http.MethodPost, "/v1/signup", map[string]string{
+		"username": username, "email": emailAddr, "password": password,
+	}, http.StatusCreated, nil); err != nil {
+		return "", "", err
+	}
+	if err := h.do(http.MethodPost, "/v1/login", map[string]string{
+		"email": emailAddr, "password": password,
+	}, http.StatusOK, nil); err != nil {
+		return "", "", err
+	}
+	return emailAddr, password, nil
+}
+
+// waitForMail polls MailHog until a message to addr with the given subject
+// arrives.
+func (h *harness) waitForMail(addr, subject string) error {
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(h.mailhogURL + "/api/v2/search?kind=to&query=" + url.QueryEscape(addr))
+		if err == nil {
+			var result struct {
+				Items []struct {
+					Content struct {
+						Headers map[string][]string `json:"Headers"`
+					} `json:"Content"`
+				} `json:"items"`
+			}
+			json.NewDecoder(resp.Body).Decode(&result)
+			resp.Body.Close()
+			for _, msg := range result.Items {
+				for _, s := range msg.Content.Headers["Subject"] {
+					if s == subject {
+						return nil
+					}
+				}
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return fmt.Errorf("no email %q to %s", subject, addr)
+}
+
+func waitForServer(baseURL string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := http.Get(baseURL + "/metrics")
+		if err == nil {
+			resp.Body.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func randomSuffix() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
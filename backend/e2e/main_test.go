@@ -0,0 +1,178 @@
+//go:build integration
+
+package e2e
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"server/internal/db"
+)
+
+// stack is the server under test and what it talks to, shared by every
+// scenario. Each scenario signs up its own users, so they do not interfere.
+var stack struct {
+	baseURL    string
+	mailhogURL string
+	db         *sql.DB
+	catalog    map[string]int // fixture item name -> id
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(run(m))
+}
+
+// run starts Postgres, MailHog, and a freshly built jaj-server, runs the
+// tests, and tears everything down again. The server's log is printed if
+// anything fails.
+func run(m *testing.M) int {
+	ctx := context.Background()
+
+	pg, err := postgres.Run(ctx, "postgres:16-alpine",
+		postgres.WithDatabase("jaj"),
+		postgres.WithUsername("jaj"),
+		postgres.WithPassword("jaj"),
+		postgres.BasicWaitStrategies(),
+	)
+	defer terminate(pg)
+	if err != nil {
+		log.Printf("start postgres: %v", err)
+		return 1
+	}
+	dbURL, err := pg.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		log.Printf("postgres address: %v", err)
+		return 1
+	}
+
+	mailhog, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "mailhog/mailhog:v1.0.1",
+			ExposedPorts: []string{"1025/tcp", "8025/tcp"},
+			WaitingFor:   wait.ForHTTP("/api/v2/messages").WithPort("8025/tcp"),
+		},
+		Started: true,
+	})
+	defer terminate(mailhog)
+	if err != nil {
+		log.Printf("start mailhog: %v", err)
+		return 1
+	}
+	smtpAddr, err := mailhog.PortEndpoint(ctx, "1025/tcp", "")
+	if err != nil {
+		log.Printf("mailhog smtp address: %v", err)
+		return 1
+	}
+	if stack.mailhogURL, err = mailhog.PortEndpoint(ctx, "8025/tcp", "http"); err != nil {
+		log.Printf("mailhog api address: %v", err)
+		return 1
+	}
+
+	dir, err := os.MkdirTemp("", "jaj-e2e")
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+	serverLog := filepath.Join(dir, "server.log")
+
+	stop, err := startServer(dir, serverLog, map[string]string{
+		"DATABASE_URL":   dbURL,
+		"SMTP_HOST":      smtpAddr,
+		"SMTP_USER":      "jaj@example.test",
+		"SMTP_PASS":      "unused",
+		"SMTP_PLAINTEXT": "true",
+		"GROQ_API_KEY":   "unused",
+	})
+	if err != nil {
+		log.Printf("start server: %v", err)
+		return 1
+	}
+	code := 1
+	defer func() {
+		stop()
+		if code != 0 {
+			if out, err := os.ReadFile(serverLog); err == nil {
+				fmt.Fprintf(os.Stderr, "--- jaj-server log\n%s", out)
+			}
+		}
+	}()
+
+	if err := waitForServer(stack.baseURL, 60*time.Second); err != nil {
+		log.Printf("server not ready: %v", err)
+		return code
+	}
+	if stack.db, err = db.Connect(dbURL); err != nil {
+		log.Printf("database: %v", err)
+		return code
+	}
+	defer stack.db.Close()
+	if stack.catalog, err = seedCatalog(stack.db); err != nil {
+		log.Printf("seed catalog: %v", err)
+		return code
+	}
+
+	code = m.Run()
+	return code
+}
+
+// startServer builds jaj-server into dir and runs it there, so no .env file
+// is picked up, on a free local port with env added to the environment. It
+// sets stack.baseURL and returns a func that stops the server.
+func startServer(dir, logPath string, env map[string]string) (func(), error) {
+	bin := filepath.Join(dir, "jaj-server")
+	build := exec.Command("go", "build", "-o", bin, "server/cmd/jaj-server")
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		return nil, fmt.Errorf("build: %w", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := l.Addr().String()
+	l.Close()
+	stack.baseURL = "http://" + addr
+
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(bin)
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	cmd.Env = append(os.Environ(), "SERVER_ADDRESS="+addr, "BASE_URL="+stack.baseURL)
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	return func() {
+		cmd.Process.Signal(os.Interrupt)
+		cmd.Wait()
+		logFile.Close()
+	}, nil
+}
+
+func terminate(c testcontainers.Container) {
+	if err := testcontainers.TerminateContainer(c); err != nil {
+		log.Printf("terminate container: %v", err)
+	}
+}
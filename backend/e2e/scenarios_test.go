@@ -0,0 +1,254 @@
+//go:build integration
+
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestScenarios(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(h *harness) error
+	}{
+		{"signup, verify, login, order, confirm", signupToConfirmedOrder},
+		{"duplicate signup looks like a new one", duplicateSignup},
+		{"password reset does not reveal accounts", passwordResetUniform},
+		{"wrong password is rejected", wrongPassword},
+		{"orders require a session", ordersRequireSession},
+		{"order can be cancelled before cutoff", cancelOrder},
+		{"transport fee rises at the 4th and 7th order", transportFeeTiers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(stack.baseURL, stack.mailhogURL, stack.db, stack.catalog)
+			if err := tt.run(h); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+type orderItem struct {
+	ItemID   int `json:"itemId"`
+	Quantity int `json:"quantity"`
+}
+
+type orderResponse struct {
+	OrderID       int    `json:"orderId"`
+	Status        string `json:"status"`
+	TransportFee  int    `json:"transportFee"`
+	TotalCost     int    `json:"totalCost"`
+	StatusHistory []struct {
+		Status string `json:"status"`
+	} `json:"statusHistory"`
+}
+
+// placeOrder orders the same basket every time, so it confirms it is not an
+// accidental duplicate.
+func (h *harness) placeOrder() (orderResponse, error) {
+	var created orderResponse
+	err := h.do(http.MethodPost, "/v1/orders", map[string]interface{}{
+		"items": []orderItem{
+			{ItemID: h.catalog["E2E Jesa Milk (2L)"], Quantity: 2},
+			{ItemID: h.catalog["E2E Bread Loaf"], Quantity: 1},
+		},
+		"confirmDuplicate": true,
+	}, http.StatusCreated, &created)
+	return created, err
+}
+
+func signupToConfirmedOrder(h *harness) error {
+	emailAddr, _, err := h.signupAndLogin()
+	if err != nil {
+		return err
+	}
+
+	// Signup verifies immediately; a bogus token must still be refused.
+	if err := h.do(http.MethodGet, "/v1/verify?token=not-a-real-token", nil, http.StatusBadRequest, nil); err != nil {
+		return err
+	}
+
+	created, err := h.placeOrder()
+	if err != nil {
+		return err
+	}
+	if created.Status != "CONFIRMED" {
+		return fmt.Errorf("new order status = %s, want CONFIRMED", created.Status)
+	}
+	if want := 2*5000 + 4000 + 1000; created.TotalCost != want {
+		return fmt.Errorf("total cost = %d, want %d", created.TotalCost, want)
+	}
+
+	var detail orderResponse
+	if err := h.do(http.MethodGet, fmt.Sprintf("/v1/orders/%d", created.OrderID), nil, http.StatusOK, &detail); err != nil {
+		return err
+	}
+	if len(detail.StatusHistory) == 0 || detail.StatusHistory[len(detail.StatusHistory)-1].Status != "CONFIRMED" {
+		return fmt.Errorf("status history %+v does not end in CONFIRMED", detail.StatusHistory)
+	}
+
+	return h.waitForMail(emailAddr, fmt.Sprintf("JAJ Order Confirmation #%d", created.OrderID))
+}
+
+// timingSlack is how far apart the median latencies of an existing and an
+// unknown account may be before the difference is treated as a leak.
+const timingSlack = 150 * time.Millisecond
+
+// sameResponse fails unless a and b have identical status and body and
+// similar latency.
+func sameResponse(what string, a, b []response) error {
+	if a[0].status != b[0].status || a[0].body != b[0].body {
+		return fmt.Errorf("%s: %d %q vs %d %q", what, a[0].status, a[0].body, b[0].status, b[0].body)
+	}
+	if d := median(a) - median(b); d > timingSlack || d < -timingSlack {
+		return fmt.Errorf("%s: median latency differs by %s", what, d)
+	}
+	return nil
+}
+
+func median(rs []response) time.Duration {
+	ds := make([]time.Duration, len(rs))
+	for i, r := range rs {
+		ds[i] = r.elapsed
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	return ds[len(ds)/2]
+}
+
+// repeat sends the request built by body n times.
+func (h *harness) repeat(n int, method string, path func() string, body func() interface{}) ([]response, error) {
+	var rs []response
+	for i := 0; i < n; i++ {
+		r, err := h.send(method, path(), body())
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+func duplicateSignup(h *harness) error {
+	emailAddr, password, err := h.signupAndLogin()
+	if err != nil {
+		return err
+	}
+
+	signup := func(addr string) func() interface{} {
+		return func() interface{} {
+			return map[string]string{"username": "e2e_dup_" + randomSuffix(), "email": addr, "password": password}
+		}
+	}
+	path := func() string { return "/v1/signup" }
+	existing, err := h.repeat(3, http.MethodPost, path, signup(emailAddr))
+	if err != nil {
+		return err
+	}
+	fresh, err := h.repeat(3, http.MethodPost, path, func() interface{} {
+		return signup("e2e_new_" + randomSuffix() + "@example.test")()
+	})
+	if err != nil {
+		return err
+	}
+	if existing[0].status != http.StatusCreated {
+		return fmt.Errorf("duplicate signup: got %d, want %d", existing[0].status, http.StatusCreated)
+	}
+	if err := sameResponse("signup", existing, fresh); err != nil {
+		return err
+	}
+	return h.waitForMail(emailAddr, "You Already Have a JAJ Account")
+}
+
+func passwordResetUniform(h *harness) error {
+	emailAddr, _, err := h.signupAndLogin()
+	if err != nil {
+		return err
+	}
+
+	reset := func(addr func() string) func() string {
+		return func() string { return "/v1/password-reset?email=" + url.QueryEscape(addr()) }
+	}
+	noBody := func() interface{} { return nil }
+	existing, err := h.repeat(5, http.MethodPost, reset(func() string { return emailAddr }), noBody)
+	if err != nil {
+		return err
+	}
+	unknown, err := h.repeat(5, http.MethodPost, reset(func() string {
+		return "e2e_nobody_" + randomSuffix() + "@example.test"
+	}), noBody)
+	if err != nil {
+		return err
+	}
+	if existing[0].status != http.StatusOK {
+		return fmt.Errorf("password reset: got %d, want %d", existing[0].status, http.StatusOK)
+	}
+	if err := sameResponse("password reset", existing, unknown); err != nil {
+		return err
+	}
+	return h.waitForMail(emailAddr, "Reset Your JAJ Password")
+}
+
+func wrongPassword(h *harness) error {
+	emailAddr, _, err := h.signupAndLogin()
+	if err != nil {
+		return err
+	}
+	return h.do(http.MethodPost, "/v1/login", map[string]string{
+		"email": emailAddr, "password": "wrong",
+	}, http.StatusUnauthorized, nil)
+}
+
+func ordersRequireSession(h *harness) error {
+	return h.do(http.MethodGet, "/v1/orders", nil, http.StatusUnauthorized, nil)
+}
+
+func cancelOrder(h *harness) error {
+	emailAddr, _, err := h.signupAndLogin()
+	if err != nil {
+		return err
+	}
+	created, err := h.placeOrder()
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/v1/orders/%d", created.OrderID)
+	now := time.Now()
+	if now.Hour() >= 17 {
+		// Past the daily cutoff the API must refuse instead.
+		return h.do(http.MethodDelete, path, nil, http.StatusForbidden, nil)
+	}
+	if err := h.do(http.MethodDelete, path, nil, http.StatusNoContent, nil); err != nil {
+		return err
+	}
+	return h.waitForMail(emailAddr, fmt.Sprintf("JAJ Order #%d Cancelled", created.OrderID))
+}
+
+// placeOrderSubtotal is what placeOrder's basket costs: 2 x 5000 + 4000.
+const placeOrderSubtotal = 14000
+
+// transportFeeTiers places seven orders in one day, crossing both tier edges
+// (3rd to 4th and 6th to 7th order), and checks each against the golden fee.
+func transportFeeTiers(h *harness) error {
+	if _, _, err := h.signupAndLogin(); err != nil {
+		return err
+	}
+	golden := []int{1000, 1000, 1000, 2000, 2000, 2000, 3000}
+	for i, fee := range golden {
+		created, err := h.placeOrder()
+		if err != nil {
+			return err
+		}
+		if created.TransportFee != fee || created.TotalCost != placeOrderSubtotal+fee {
+			return fmt.Errorf("order %d of the day: fee %d, total %d; want fee %d, total %d",
+				i+1, created.TransportFee, created.TotalCost, fee, placeOrderSubtotal+fee)
+		}
+	}
+	return nil
+}
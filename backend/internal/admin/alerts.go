@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/alerts"
+
+	"go.uber.org/zap"
+)
+
+// Resolved alerts shown: how many hours back by default, and at most.
+const (
+	defaultAlertHours = 24
+	maxAlertHours     = 24 * 7
+)
+
+// RuleStatus is an alert rule with its threshold now in force.
+type RuleStatus struct {
+	Name      string  `json:"name"`
+	Summary   string  `json:"summary"`
+	Setting   string  `json:"setting"`
+	Threshold float64 `json:"threshold"` // percent; 0 when disabled
+}
+
+// handleAlerts returns the open alerts, those resolved in the last ?hours
+// (default 24, at most 168), and every rule's threshold, for the dashboard.
+func handleAlerts(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	hours := defaultAlertHours
+	if s := r.URL.Query().Get("hours"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxAlertHours {
+			http.Error(w, "hours must be 1 to 168", http.StatusBadRequest)
+			return
+		}
+		hours = n
+	}
+
+	cfg, err := alerts.LoadConfig(r.Context(), db)
+	if err != nil {
+		logger.Error("alert settings query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	list, err := alerts.List(r.Context(), db, time.Now().Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		logger.Error("alerts query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+
+	active, resolved := []alerts.Alert{}, []alerts.Alert{}
+	for _, a := range list {
+		if a.ResolvedAt == nil {
+			active = append(active, a)
+		} else {
+			resolved = append(resolved, a)
+		}
+	}
+	rules := make([]RuleStatus, len(alerts.Rules))
+	for i, rule := range alerts.Rules {
+		rules[i] = RuleStatus{Name: rule.Name, Summary: rule.Summary, Setting: rule.Setting, Threshold: cfg.Thresholds[rule.Name]}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Active        []alerts.Alert `json:"active"`   // newest first
+		Resolved      []alerts.Alert `json:"resolved"` // most recently resolved first
+		WindowMinutes int            `json:"windowMinutes"`
+		Rules         []RuleStatus   `json:"rules"`
+	}{active, resolved, int(cfg.Window / time.Minute), rules})
+}
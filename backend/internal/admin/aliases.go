@@ -0,0 +1,171 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/catalog"
+	"server/internal/events"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// handleListAliases returns item aliases, optionally for one ?itemId.
+func handleListAliases(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	itemID, _ := strconv.Atoi(r.URL.Query().Get("itemId"))
+	aliases, err := catalog.ListAliases(r.Context(), db, itemID)
+	if err != nil {
+		logger.Error("aliases query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(aliases)
+}
+
+// handleCreateAlias adds another name for an item, e.g. "mkate" for bread,
+// which catalog search and the chat then match on.
+func handleCreateAlias(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	var a catalog.Alias
+	if !httpx.DecodeJSON(w, r, &a) {
+		return
+	}
+	if err := catalog.CreateAlias(ctx, db, adminID, &a); err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to create alias", zap.Error(err))
+		}
+		return
+	}
+	publishCatalogChanged(ctx, bus, logger, a.ItemID)
+	if err := recordAudit(ctx, db, adminID, "alias.create", strconv.Itoa(a.ItemID), a); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// handleDeleteAlias removes an alias.
+func handleDeleteAlias(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid alias id", http.StatusBadRequest)
+		return
+	}
+	itemID, err := catalog.DeleteAlias(ctx, db, id)
+	if err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to delete alias", zap.Int("id", id), zap.Error(err))
+		}
+		return
+	}
+	publishCatalogChanged(ctx, bus, logger, itemID)
+	if err := recordAudit(ctx, db, adminID, "alias.delete", strconv.Itoa(itemID),
+		map[string]int{"aliasId": id}); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Window for GET /admin/catalog/misses, in days.
+const (
+	defaultMissDays = 30
+	maxMissDays     = 365
+)
+
+// MissMapping is the body of POST /admin/catalog/misses/map.
+type MissMapping struct {
+	Phrase   string `json:"phrase" validate:"required,max=100"`
+	ItemID   int    `json:"itemId" validate:"required,min=1"`
+	Language string `json:"language" validate:"omitempty,oneof=en lg sw"`
+}
+
+// MissDismissal is the body of POST /admin/catalog/misses/dismiss.
+type MissDismissal struct {
+	Phrase string `json:"phrase" validate:"required,max=100"`
+}
+
+// handleListMisses returns the product phrases chat could not match in the
+// last ?days days, most asked for first, with sample messages for context.
+func handleListMisses(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	days := defaultMissDays
+	if s := r.URL.Query().Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxMissDays {
+			http.Error(w, "days must be 1 to "+strconv.Itoa(maxMissDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	page := httpx.ParsePage(r)
+	misses, total, err := catalog.ListMisses(r.Context(), db, time.Now().AddDate(0, 0, -days), page.Limit, page.Offset())
+	if err != nil {
+		logger.Error("catalog misses query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+	httpx.WritePage(w, page, total, misses)
+}
+
+// handleMapMiss makes a missed phrase an alias of an item, so chat finds
+// the item by it from now on, and closes the phrase's misses.
+func handleMapMiss(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	var m MissMapping
+	if !httpx.DecodeJSON(w, r, &m) {
+		return
+	}
+	a := catalog.Alias{ItemID: m.ItemID, Language: m.Language}
+	if err := catalog.MapMiss(ctx, db, adminID, m.Phrase, &a); err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to map catalog miss", zap.Error(err))
+		}
+		return
+	}
+	publishCatalogChanged(ctx, bus, logger, a.ItemID)
+	if err := recordAudit(ctx, db, adminID, "miss.map", strconv.Itoa(a.ItemID), a); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// handleDismissMiss closes a missed phrase without mapping it, e.g. for
+// something the shop does not sell.
+func handleDismissMiss(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	var m MissDismissal
+	if !httpx.DecodeJSON(w, r, &m) {
+		return
+	}
+	n, err := catalog.DismissMiss(ctx, db, m.Phrase)
+	if err != nil {
+		logger.Error("failed to dismiss catalog miss", zap.Error(err))
+		http.Error(w, "failed to dismiss phrase", http.StatusInternalServerError)
+		return
+	}
+	if n == 0 {
+		httpx.WriteError(w, catalog.ErrNoOpenMisses)
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "miss.dismiss", m.Phrase, map[string]int{"misses": n}); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"server/internal/announcements"
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// handleListAnnouncements lists every announcement, past and scheduled too,
+// latest start first.
+func handleListAnnouncements(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	page := httpx.ParsePage(r)
+	list, total, err := announcements.List(r.Context(), db, page.Limit, page.Offset())
+	if err != nil {
+		logger.Error("announcements query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+	httpx.WritePage(w, page, total, list)
+}
+
+// decodeAnnouncement reads an announcement body, answering 400 or 422 and
+// returning false if it is unusable.
+func decodeAnnouncement(w http.ResponseWriter, r *http.Request) (announcements.Input, bool) {
+	var in announcements.Input
+	if !httpx.DecodeJSON(w, r, &in) {
+		return in, false
+	}
+	if _, _, ok := in.Window(); !ok {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "endsAt", Message: "must be after startsAt"}})
+		return in, false
+	}
+	return in, true
+}
+
+// handleCreateAnnouncement schedules an announcement; without a startsAt it
+// shows at once.
+func handleCreateAnnouncement(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	in, ok := decodeAnnouncement(w, r)
+	if !ok {
+		return
+	}
+	a, err := announcements.Create(ctx, db, adminID, in)
+	if err != nil {
+		logger.Error("failed to create announcement", zap.Error(err))
+		http.Error(w, "failed to create announcement", http.StatusInternalServerError)
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "announcement.create", strconv.Itoa(a.ID), in); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// handleUpdateAnnouncement replaces an announcement's text, severity, and
+// window. Setting endsAt to now takes it down early while keeping it listed.
+func handleUpdateAnnouncement(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid announcement id", http.StatusBadRequest)
+		return
+	}
+	in, ok := decodeAnnouncement(w, r)
+	if !ok {
+		return
+	}
+	a, err := announcements.Update(ctx, db, id, in)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("announcement not found"))
+		return
+	}
+	if err != nil {
+		logger.Error("failed to update announcement", zap.Int("announcement_id", id), zap.Error(err))
+		http.Error(w, "failed to update announcement", http.StatusInternalServerError)
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "announcement.update", strconv.Itoa(id), in); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+// handleDeleteAnnouncement removes an announcement outright.
+func handleDeleteAnnouncement(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid announcement id", http.StatusBadRequest)
+		return
+	}
+	err = announcements.Delete(ctx, db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("announcement not found"))
+		return
+	}
+	if err != nil {
+		logger.Error("failed to delete announcement", zap.Int("announcement_id", id), zap.Error(err))
+		http.Error(w, "failed to delete announcement", http.StatusInternalServerError)
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "announcement.delete", strconv.Itoa(id), nil); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
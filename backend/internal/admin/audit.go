@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// AuditEntry is one support action an admin took.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	AdminID   *int            `json:"adminId"` // nil once the admin's account is gone
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Detail    json.RawMessage `json:"detail"`
+	IP        string          `json:"ip"` // where the admin was, "" if unknown
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// recordAudit appends an entry to the admin audit log, with the address of
+// the request in ctx. detail is stored as JSON.
+func recordAudit(ctx context.Context, db *sql.DB, adminID int, action, target string, detail interface{}) error {
+	payload, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT INTO admin_audit_log (admin_id, action, target, detail, ip) VALUES (NULLIF($1, 0), $2, $3, $4, $5)`,
+		adminID, action, target, payload, httpx.ClientIP(ctx))
+	return err
+}
+
+// handleListAudit returns the audit log, newest first, optionally narrowed to
+// one ?action.
+func handleListAudit(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	action := r.URL.Query().Get("action")
+
+	var total int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM admin_audit_log WHERE $1 = '' OR action = $1`, action,
+	).Scan(&total); err != nil {
+		logger.Error("audit log count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, admin_id, action, target, detail, ip, created_at FROM admin_audit_log
+		  WHERE $1 = '' OR action = $1
+		  ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`,
+		action, page.Limit, page.Offset(),
+	)
+	if err != nil {
+		logger.Error("audit log query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var adminID sql.NullInt64
+		var detail []byte
+		if err := rows.Scan(&e.ID, &adminID, &e.Action, &e.Target, &detail, &e.IP, &e.CreatedAt); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		if adminID.Valid {
+			id := int(adminID.Int64)
+			e.AdminID = &id
+		}
+		e.Detail = detail
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	httpx.WritePage(w, page, total, entries)
+}
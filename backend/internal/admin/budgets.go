@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"server/internal/auth"
+	"server/internal/budget"
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// BudgetSetting is the body of PUT /admin/users/{id}/budget, used when a
+// parent or sponsor asks support to cap a student's spending.
+type BudgetSetting struct {
+	WeeklyBudget *int   `json:"weeklyBudget" validate:"min=1"` // null removes the cap
+	Mode         string `json:"mode" validate:"required,oneof=warn block"`
+	Locked       bool   `json:"locked"` // stops the student changing it from their profile
+}
+
+// handleSetUserBudget sets a student's weekly budget and returns their usage.
+func handleSetUserBudget(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+	var req BudgetSetting
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	res, err := db.ExecContext(ctx,
+		`UPDATE users SET weekly_budget = $1, budget_mode = $2, budget_locked = $3 WHERE id = $4`,
+		req.WeeklyBudget, req.Mode, req.Locked, userID)
+	if err != nil {
+		logger.Error("failed to set budget", zap.Int("user_id", userID), zap.Error(err))
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("user not found"))
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "user.budget", strconv.Itoa(userID), req); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+
+	usage, err := budget.Load(ctx, db, userID, 0)
+	if err != nil {
+		logger.Error("budget usage query failed", zap.Int("user_id", userID), zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
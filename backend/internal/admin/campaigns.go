@@ -0,0 +1,158 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"server/internal/auth"
+	"server/internal/campaigns"
+	"server/internal/httpx"
+	"server/internal/jobs"
+
+	"go.uber.org/zap"
+)
+
+// campaignJob is the payload of a "campaign" job.
+type campaignJob struct {
+	CampaignID int `json:"campaignId"`
+}
+
+// handleListCampaigns lists announcement campaigns, newest first, with their
+// send, open, and bounce counts.
+func handleListCampaigns(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	page := httpx.ParsePage(r)
+	list, total, err := campaigns.List(r.Context(), db, page.Limit, page.Offset())
+	if err != nil {
+		logger.Error("campaigns query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+	httpx.WritePage(w, page, total, list)
+}
+
+// writeCampaignError answers err like httpx.WriteError, with a template
+// error pointing at the field it is in, and returns the status.
+func writeCampaignError(w http.ResponseWriter, err error) int {
+	var tmplErr *campaigns.TemplateError
+	if errors.As(err, &tmplErr) {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: tmplErr.Field, Message: tmplErr.Error()}})
+		return http.StatusUnprocessableEntity
+	}
+	return httpx.WriteError(w, err)
+}
+
+// writeCampaign answers with campaign id as it is now.
+func writeCampaign(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, id, status int) {
+	c, err := campaigns.Get(r.Context(), db, id)
+	if err != nil {
+		if writeCampaignError(w, err) == http.StatusInternalServerError {
+			logger.Error("campaign query failed", zap.Int("campaign_id", id), zap.Error(err))
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(c)
+}
+
+// handleGetCampaign returns one campaign; drafts include how many students
+// it would go to.
+func handleGetCampaign(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid campaign id", http.StatusBadRequest)
+		return
+	}
+	writeCampaign(w, r, db, logger, id, http.StatusOK)
+}
+
+// handleCreateCampaign saves a draft. The subject and body are Go templates
+// over campaigns.Recipient and are checked before saving.
+func handleCreateCampaign(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	var d campaigns.Draft
+	if !httpx.DecodeJSON(w, r, &d) {
+		return
+	}
+	id, err := campaigns.Create(ctx, db, adminID, d)
+	if err != nil {
+		if writeCampaignError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to create campaign", zap.Error(err))
+		}
+		return
+	}
+	writeCampaign(w, r, db, logger, id, http.StatusCreated)
+}
+
+// handleUpdateCampaign edits a draft; sent campaigns are 409.
+func handleUpdateCampaign(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid campaign id", http.StatusBadRequest)
+		return
+	}
+	var d campaigns.Draft
+	if !httpx.DecodeJSON(w, r, &d) {
+		return
+	}
+	if err := campaigns.Update(r.Context(), db, id, d); err != nil {
+		if writeCampaignError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to update campaign", zap.Int("campaign_id", id), zap.Error(err))
+		}
+		return
+	}
+	writeCampaign(w, r, db, logger, id, http.StatusOK)
+}
+
+// handleSendCampaign fixes a draft's recipients and queues the job that
+// emails them, answering 202 with the job to poll. Sending a campaign that
+// is already sending queues its job again, resuming where it stopped.
+func handleSendCampaign(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, queue *jobs.Queue) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid campaign id", http.StatusBadRequest)
+		return
+	}
+	n, err := campaigns.Start(ctx, db, id)
+	if err != nil {
+		if writeCampaignError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to start campaign", zap.Int("campaign_id", id), zap.Error(err))
+		}
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "campaign.send", strconv.Itoa(id), map[string]int{"recipients": n}); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	enqueueJob(w, r, queue, logger, "campaign", campaignJob{CampaignID: id}, adminID)
+}
+
+// handleCancelCampaign stops a draft or a campaign part way through sending.
+func handleCancelCampaign(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid campaign id", http.StatusBadRequest)
+		return
+	}
+	if err := campaigns.Cancel(ctx, db, id); err != nil {
+		if writeCampaignError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to cancel campaign", zap.Int("campaign_id", id), zap.Error(err))
+		}
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "campaign.cancel", strconv.Itoa(id), nil); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	writeCampaign(w, r, db, logger, id, http.StatusOK)
+}
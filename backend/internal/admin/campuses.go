@@ -0,0 +1,232 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/httpx"
+	"server/internal/locale"
+	"server/internal/orders"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Campus is a pickup campus, how many orders it can fulfil a day, its
+// minimum basket, the networks its orders are expected from, and how it
+// shows amounts and times.
+type Campus struct {
+	Name             string   `json:"name"`
+	DailyCapacity    *int     `json:"dailyCapacity"`    // nil means no limit
+	MinOrderUGX      *int     `json:"minOrderUGX"`      // nil means no minimum
+	SmallOrderFeeUGX *int     `json:"smallOrderFeeUGX"` // nil refuses orders under the minimum
+	Networks         []string `json:"networks"`         // CIDR ranges; empty takes orders from anywhere
+	OffNetworkPolicy string   `json:"offNetworkPolicy"` // tag or block
+	Currency         string   `json:"currency"`         // e.g. UGX
+	TimeZone         string   `json:"timeZone"`         // e.g. Africa/Kampala
+	OrdersToday      int      `json:"ordersToday"`      // confirmed since ordering opened today
+}
+
+// CampusCapacity is the body of PUT /admin/campuses/{name}. Orders whose
+// items come to less than MinOrderUGX are refused, or charged
+// SmallOrderFeeUGX when it is set. Orders placed from outside Networks are
+// flagged, or refused when OffNetworkPolicy is block, unless the student's
+// delivery address is verified. Amounts and times shown to its students
+// are in Currency and TimeZone.
+type CampusCapacity struct {
+	DailyCapacity    *int     `json:"dailyCapacity" validate:"min=0"`              // null or omitted removes the limit
+	MinOrderUGX      *int     `json:"minOrderUGX" validate:"min=1"`                // null or omitted removes the minimum
+	SmallOrderFeeUGX *int     `json:"smallOrderFeeUGX" validate:"min=0"`           // null or omitted refuses small orders
+	Networks         []string `json:"networks" validate:"max=64"`                  // e.g. "10.20.0.0/16"; omitted checks no network
+	OffNetworkPolicy string   `json:"offNetworkPolicy" validate:"oneof=tag block"` // omitted is tag
+	Currency         string   `json:"currency" validate:"max=3"`                   // ISO 4217 code; omitted is UGX
+	TimeZone         string   `json:"timeZone" validate:"max=64"`                  // IANA name; omitted is Africa/Kampala
+}
+
+// handleListCampuses returns every campus with its capacity and how much of
+// today's is used.
+func handleListCampuses(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	start, _ := orders.CapacityDay(time.Now())
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT c.name, c.daily_capacity, c.min_order_ugx, c.small_order_fee_ugx,
+		        c.networks::text[], lower(c.off_network_policy), c.currency, c.time_zone,
+		        (SELECT COUNT(DISTINCT o.id)
+		           FROM orders o
+		           JOIN order_status_history h ON h.order_id = o.id AND h.status = 'CONFIRMED'
+		          WHERE o.campus = c.name
+		            AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		            AND h.changed_at >= $1)
+		   FROM campuses c
+		  ORDER BY c.name`,
+		start,
+	)
+	if err != nil {
+		logger.Error("campuses query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	campuses := []Campus{}
+	for rows.Next() {
+		c := Campus{Networks: []string{}}
+		var capacity, minimum, fee sql.NullInt64
+		if err := rows.Scan(&c.Name, &capacity, &minimum, &fee,
+			(*pq.StringArray)(&c.Networks), &c.OffNetworkPolicy, &c.Currency, &c.TimeZone, &c.OrdersToday); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		if capacity.Valid {
+			n := int(capacity.Int64)
+			c.DailyCapacity = &n
+		}
+		if minimum.Valid {
+			n := int(minimum.Int64)
+			c.MinOrderUGX = &n
+		}
+		if fee.Valid {
+			n := int(fee.Int64)
+			c.SmallOrderFeeUGX = &n
+		}
+		campuses = append(campuses, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campuses)
+}
+
+// handleUpsertCampus creates a campus or changes its daily capacity,
+// minimum basket, networks, and locale. A lower capacity never cancels orders
+// already confirmed today, and a new minimum or network applies only to
+// orders confirmed after it.
+func handleUpsertCampus(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	name := strings.TrimSpace(r.PathValue("name"))
+	if name == "" || len(name) > 64 {
+		http.Error(w, "campus name must be 1 to 64 characters", http.StatusBadRequest)
+		return
+	}
+	var c CampusCapacity
+	if !httpx.DecodeJSON(w, r, &c) {
+		return
+	}
+	networks := make([]string, len(c.Networks))
+	for i, n := range c.Networks {
+		p, err := httpx.ParsePrefixes([]string{strings.TrimSpace(n)})
+		if err != nil {
+			httpx.WriteValidationErrors(w, httpx.ValidationErrors{{
+				Field: "networks[" + strconv.Itoa(i) + "]", Message: "must be a CIDR range such as 10.20.0.0/16"}})
+			return
+		}
+		networks[i] = p[0].String()
+	}
+	policy := orders.OffNetworkTag
+	if c.OffNetworkPolicy == "block" {
+		policy = orders.OffNetworkBlock
+	}
+	if c.Currency == "" {
+		c.Currency = locale.DefaultCurrency
+	}
+	if c.TimeZone == "" {
+		c.TimeZone = locale.DefaultTimeZone
+	}
+	if !locale.ValidCurrency(c.Currency) {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "currency", Message: "must be a three-letter currency code such as UGX"}})
+		return
+	}
+	if _, err := locale.Load(c.Currency, c.TimeZone); err != nil {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "timeZone", Message: "must be a time zone name such as Africa/Kampala"}})
+		return
+	}
+
+	const q = `INSERT INTO campuses (name, daily_capacity, min_order_ugx, small_order_fee_ugx, networks, off_network_policy, currency, time_zone)
+	           VALUES ($1, $2, $3, $4, $5::cidr[], $6, $7, $8)
+	           ON CONFLICT (name) DO UPDATE SET daily_capacity = EXCLUDED.daily_capacity,
+	                                            min_order_ugx = EXCLUDED.min_order_ugx,
+	                                            small_order_fee_ugx = EXCLUDED.small_order_fee_ugx,
+	                                            networks = EXCLUDED.networks,
+	                                            off_network_policy = EXCLUDED.off_network_policy,
+	                                            currency = EXCLUDED.currency,
+	                                            time_zone = EXCLUDED.time_zone`
+	if _, err := db.ExecContext(r.Context(), q, name, c.DailyCapacity, c.MinOrderUGX, c.SmallOrderFeeUGX,
+		pq.Array(networks), policy, c.Currency, c.TimeZone); err != nil {
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteCampus removes a campus that no user or order refers to.
+func handleDeleteCampus(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	name := r.PathValue("name")
+	if name == orders.DefaultCampus {
+		http.Error(w, "the default campus cannot be deleted", http.StatusConflict)
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), `DELETE FROM campuses WHERE name=$1`, name)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		http.Error(w, "campus still has users or orders", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "database delete error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("campus not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddressVerification is the body of PUT /admin/users/{id}/address-verified.
+type AddressVerification struct {
+	Verified bool `json:"verified"`
+}
+
+// handleSetAddressVerified marks a student's delivery address as checked by
+// support, exempting their orders from campus network checks, or clears it.
+func handleSetAddressVerified(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+	var req AddressVerification
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	res, err := db.ExecContext(ctx,
+		`UPDATE users SET address_verified_at = CASE WHEN $1 THEN COALESCE(address_verified_at, NOW()) END
+		  WHERE id = $2`,
+		req.Verified, userID)
+	if err != nil {
+		logger.Error("failed to set address verification", zap.Int("user_id", userID), zap.Error(err))
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("user not found"))
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "user.address_verified", strconv.Itoa(userID), req); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"server/internal/retention"
+
+	"go.uber.org/zap"
+)
+
+// handleRetentionPreview is a dry run of the retention purge: for each table
+// it purges, the period kept and how many rows, back to which date, would be
+// deleted if the purge ran now. It deletes nothing.
+func handleRetentionPreview(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	plans, err := retention.Preview(r.Context(), db)
+	if err != nil {
+		logger.Error("retention preview failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Tables []retention.Plan `json:"tables"`
+	}{plans})
+}
@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+
+	"server/internal/db"
+	"server/internal/events"
+	"server/internal/realtime"
+)
+
+// DebugStats is a snapshot of the process and its dependencies.
+type DebugStats struct {
+	Goroutines int                    `json:"goroutines"`
+	Heap       HeapStats              `json:"heap"`
+	DB         map[string]interface{} `json:"db"`
+	Queues     map[string]int         `json:"queues,omitempty"` // in-process event buffers
+	WebSocket  struct {
+		Users       int `json:"users"`
+		Connections int `json:"connections"`
+	} `json:"websocket"`
+	Uptime string `json:"uptime"`
+}
+
+// HeapStats is the subset of runtime.MemStats useful when chasing leaks.
+type HeapStats struct {
+	AllocBytes    uint64 `json:"allocBytes"`
+	SysBytes      uint64 `json:"sysBytes"`
+	Objects       uint64 `json:"objects"`
+	NumGC         uint32 `json:"numGC"`
+	PauseTotalNs  uint64 `json:"pauseTotalNs"`
+	LastGCUnixSec int64  `json:"lastGCUnixSec"`
+}
+
+var startedAt = time.Now()
+
+// MakeDebugRouter serves GET /admin/debug/stats and the net/http/pprof
+// profiles under /debug/pprof/. Callers must gate it behind admin auth. CPU
+// profiles and traces push their write deadline past the server's write
+// timeout to cover ?seconds=, so the defaults (30s and 1s) work.
+func MakeDebugRouter(cluster *db.Cluster, bus events.Bus, hub *realtime.Hub) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /admin/debug/stats", func(w http.ResponseWriter, r *http.Request) {
+		handleDebugStats(w, cluster, bus, hub)
+	})
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", extendWriteDeadline(30, pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", extendWriteDeadline(1, pprof.Trace))
+
+	return mux
+}
+
+// profileSlack is the time allowed to write a profile out once it is taken.
+const profileSlack = 10 * time.Second
+
+// extendWriteDeadline lets h run for the ?seconds= it is asked to record,
+// defaultSeconds if none, plus profileSlack, whatever the server's write
+// timeout.
+func extendWriteDeadline(defaultSeconds float64, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sec, err := strconv.ParseFloat(r.FormValue("seconds"), 64)
+		if err != nil || sec <= 0 {
+			sec = defaultSeconds
+		}
+		deadline := time.Now().Add(time.Duration(sec*float64(time.Second)) + profileSlack)
+		// Unsupported only if a middleware hides the connection; the profile
+		// is then cut off at the write timeout as before.
+		_ = http.NewResponseController(w).SetWriteDeadline(deadline)
+		h(w, r)
+	}
+}
+
+func handleDebugStats(w http.ResponseWriter, cluster *db.Cluster, bus events.Bus, hub *realtime.Hub) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	stats := DebugStats{
+		Goroutines: runtime.NumGoroutine(),
+		Heap: HeapStats{
+			AllocBytes:    ms.HeapAlloc,
+			SysBytes:      ms.HeapSys,
+			Objects:       ms.HeapObjects,
+			NumGC:         ms.NumGC,
+			PauseTotalNs:  ms.PauseTotalNs,
+			LastGCUnixSec: int64(ms.LastGC / uint64(time.Second)),
+		},
+		DB:     map[string]interface{}{"primary": poolStats(cluster.Primary)},
+		Uptime: time.Since(startedAt).Round(time.Second).String(),
+	}
+	if cluster.HasReplica() {
+		stats.DB["replica"] = poolStats(cluster.Replica)
+	}
+	if q, ok := bus.(events.QueueDepther); ok {
+		stats.Queues = q.QueueDepths()
+	}
+	stats.WebSocket.Users, stats.WebSocket.Connections = hub.Stats()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func poolStats(pool *sql.DB) map[string]interface{} {
+	s := pool.Stats()
+	return map[string]interface{}{
+		"open":         s.OpenConnections,
+		"inUse":        s.InUse,
+		"idle":         s.Idle,
+		"maxOpen":      s.MaxOpenConnections,
+		"waitCount":    s.WaitCount,
+		"waitDuration": s.WaitDuration.String(),
+	}
+}
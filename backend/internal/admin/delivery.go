@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// DeliveryHall is a hall of residence and where it is.
+type DeliveryHall struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// handleListDeliveryHalls returns the halls with a known location.
+func handleListDeliveryHalls(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	rows, err := db.QueryContext(r.Context(), `SELECT name, latitude, longitude FROM delivery_halls ORDER BY name`)
+	if err != nil {
+		logger.Error("delivery halls query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	halls := []DeliveryHall{}
+	for rows.Next() {
+		var h DeliveryHall
+		if err := rows.Scan(&h.Name, &h.Latitude, &h.Longitude); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		halls = append(halls, h)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(halls)
+}
+
+// handleUpsertDeliveryHall sets where a hall is, for ordering delivery stops.
+func handleUpsertDeliveryHall(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	name := strings.TrimSpace(r.PathValue("name"))
+	if name == "" || len(name) > 64 {
+		http.Error(w, "hall name must be 1 to 64 characters", http.StatusBadRequest)
+		return
+	}
+	var h DeliveryHall
+	if !httpx.DecodeJSON(w, r, &h) {
+		return
+	}
+	var errs httpx.ValidationErrors
+	if h.Latitude < -90 || h.Latitude > 90 {
+		errs = append(errs, httpx.FieldError{Field: "latitude", Message: "must be between -90 and 90"})
+	}
+	if h.Longitude < -180 || h.Longitude > 180 {
+		errs = append(errs, httpx.FieldError{Field: "longitude", Message: "must be between -180 and 180"})
+	}
+	if len(errs) > 0 {
+		httpx.WriteValidationErrors(w, errs)
+		return
+	}
+
+	const q = `INSERT INTO delivery_halls (name, latitude, longitude) VALUES ($1, $2, $3)
+	           ON CONFLICT (name) DO UPDATE SET latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude`
+	if _, err := db.ExecContext(r.Context(), q, name, h.Latitude, h.Longitude); err != nil {
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteDeliveryHall forgets a hall's location; its stops then go last.
+func handleDeleteDeliveryHall(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	res, err := db.ExecContext(r.Context(), `DELETE FROM delivery_halls WHERE name = $1`, r.PathValue("name"))
+	if err != nil {
+		http.Error(w, "database delete error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("hall not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// EmailKindHealth is the delivery outcome of one kind of email over a period.
+type EmailKindHealth struct {
+	Kind       string         `json:"kind"`
+	Attempts   int            `json:"attempts"`
+	ByStatus   map[string]int `json:"byStatus"`
+	BounceRate float64        `json:"bounceRate"` // (bounced + complained) / sent
+}
+
+// EmailSuppression is an address mail is no longer sent to.
+type EmailSuppression struct {
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// handleEmailAnalytics reports delivery health per email kind between ?from
+// and ?to (inclusive dates).
+func handleEmailAnalytics(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	from, err := time.Parse("2006-01-02", r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "from must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse("2006-01-02", r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "to must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT kind, status, COUNT(*)
+		   FROM email_log
+		  WHERE created_at >= $1 AND created_at < $2
+		  GROUP BY kind, status
+		  ORDER BY kind, status`,
+		from, to.Add(24*time.Hour),
+	)
+	if err != nil {
+		logger.Error("email analytics query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	kinds := []EmailKindHealth{}
+	for rows.Next() {
+		var kind, status string
+		var n int
+		if err := rows.Scan(&kind, &status, &n); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		if len(kinds) == 0 || kinds[len(kinds)-1].Kind != kind {
+			kinds = append(kinds, EmailKindHealth{Kind: kind, ByStatus: map[string]int{}})
+		}
+		k := &kinds[len(kinds)-1]
+		k.Attempts += n
+		k.ByStatus[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+	for i := range kinds {
+		k := &kinds[i]
+		// Everything that left the server: sent, then possibly updated by a webhook
+		sent := k.ByStatus["SENT"] + k.ByStatus["DELIVERED"] + k.ByStatus["BOUNCED"] + k.ByStatus["COMPLAINED"]
+		if sent > 0 {
+			k.BounceRate = float64(k.ByStatus["BOUNCED"]+k.ByStatus["COMPLAINED"]) / float64(sent)
+		}
+	}
+
+	var suppressed int
+	if err := db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM email_suppressions`).Scan(&suppressed); err != nil {
+		logger.Error("email suppressions count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		From                string            `json:"from"`
+		To                  string            `json:"to"`
+		Kinds               []EmailKindHealth `json:"kinds"`
+		SuppressedAddresses int               `json:"suppressedAddresses"`
+	}{from.Format("2006-01-02"), to.Format("2006-01-02"), kinds, suppressed})
+}
+
+// handleListEmailSuppressions returns suppressed addresses, newest first.
+func handleListEmailSuppressions(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM email_suppressions`).Scan(&total); err != nil {
+		logger.Error("email suppressions count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	rows, err := db.QueryContext(ctx,
+		`SELECT email, reason, detail, created_at FROM email_suppressions
+		  ORDER BY created_at DESC LIMIT $1 OFFSET $2`,
+		page.Limit, page.Offset(),
+	)
+	if err != nil {
+		logger.Error("email suppressions query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var suppressions []EmailSuppression
+	for rows.Next() {
+		var s EmailSuppression
+		if err := rows.Scan(&s.Email, &s.Reason, &s.Detail, &s.CreatedAt); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		suppressions = append(suppressions, s)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	httpx.WritePage(w, page, total, suppressions)
+}
+
+// handleDeleteEmailSuppression lets mail flow to an address again, e.g. after
+// the student fixed a full mailbox.
+func handleDeleteEmailSuppression(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	addr := strings.ToLower(strings.TrimSpace(r.PathValue("email")))
+	res, err := db.ExecContext(r.Context(), `DELETE FROM email_suppressions WHERE email=$1`, addr)
+	if err != nil {
+		http.Error(w, "database delete error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("suppression not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
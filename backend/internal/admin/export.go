@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/domain"
+	"server/internal/export"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultExportLimit = 10000
+	maxExportLimit     = 100000
+)
+
+// handleExport streams one page of a table, oldest change first, as NDJSON
+// (default) or ?format=csv. Start with ?since=<RFC 3339 time> or nothing for
+// everything; continue with ?cursor= from the X-Next-Cursor trailer, which
+// is absent once the table is exhausted. The cursor is also "<updatedAt>,<id>"
+// of the last row, for clients that cannot read trailers. An X-Export-Error
+// trailer means the page broke off and should be fetched again.
+func handleExport(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	q := r.URL.Query()
+	t, ok := export.Tables[r.PathValue("table")]
+	if !ok {
+		httpx.WriteError(w, domain.NotFound("unknown table; use orders, order_items, items, or users"))
+		return
+	}
+
+	var c export.Cursor
+	if v := q.Get("cursor"); v != "" {
+		var err error
+		if c, err = export.ParseCursor(v); err != nil {
+			http.Error(w, "invalid cursor: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		c.UpdatedAt = since
+	}
+
+	limit := defaultExportLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxExportLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxExportLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var rw export.RowWriter
+	switch q.Get("format") {
+	case "", "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		rw = export.NewNDJSON(w)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		rw = export.NewCSV(w)
+	default:
+		http.Error(w, "format must be ndjson or csv", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Trailer", "X-Next-Cursor, X-Export-Error")
+
+	next, n, err := export.Stream(r.Context(), db, t, c, limit, rw)
+	if err != nil {
+		// Rows may already be on the wire, so the status cannot change; the
+		// error trailer tells the client to retry this page
+		logger.Error("export failed", zap.String("table", t.Name), zap.Int("rows", n), zap.Error(err))
+		if n == 0 {
+			http.Error(w, "database query error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Export-Error", "export interrupted")
+		return
+	}
+	if n == limit {
+		w.Header().Set("X-Next-Cursor", next.String())
+	}
+}
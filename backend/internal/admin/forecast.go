@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/forecast"
+	"server/internal/jobs"
+	"server/internal/locale"
+
+	"go.uber.org/zap"
+)
+
+// maxForecastDays caps ?days: beyond a few weeks the weekday model says
+// little the shopper can act on.
+const maxForecastDays = 28
+
+// ForecastReport is per-item demand for the days from From on.
+type ForecastReport struct {
+	From           string          `json:"from"`
+	Days           int             `json:"days"`
+	WeekdayProfile [7]float64      `json:"weekdayProfile"` // Sunday first
+	Items          []forecast.Item `json:"items"`
+}
+
+// forecastJob is the payload of a "forecast" job.
+type forecastJob struct {
+	Days int `json:"days"`
+}
+
+// buildForecast predicts per-item demand for the next days days from
+// confirmed and fulfilled orders.
+func buildForecast(ctx context.Context, db *sql.DB, days int) (ForecastReport, error) {
+	now := time.Now().In(locale.EAT)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT i.id, i.name, (o.created_at AT TIME ZONE 'Africa/Kampala')::date AS day, SUM(oi.quantity)
+		   FROM order_items oi
+		   JOIN orders o ON o.id = oi.order_id
+		   JOIN items i ON i.id = oi.item_id
+		  WHERE o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		    AND o.created_at >= $1
+		  GROUP BY i.id, i.name, day`,
+		time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, locale.EAT).AddDate(0, 0, -forecast.ProfileDays),
+	)
+	if err != nil {
+		return ForecastReport{}, err
+	}
+	defer rows.Close()
+
+	var sales []forecast.Sale
+	for rows.Next() {
+		var s forecast.Sale
+		if err := rows.Scan(&s.ItemID, &s.Name, &s.Date, &s.Quantity); err != nil {
+			return ForecastReport{}, err
+		}
+		s.Date = time.Date(s.Date.Year(), s.Date.Month(), s.Date.Day(), 0, 0, 0, 0, time.UTC)
+		sales = append(sales, s)
+	}
+	if err := rows.Err(); err != nil {
+		return ForecastReport{}, err
+	}
+
+	return ForecastReport{
+		From:           today.Format("2006-01-02"),
+		Days:           days,
+		WeekdayProfile: forecast.WeekdayProfile(sales, today),
+		Items:          forecast.Forecast(sales, today, days),
+	}, nil
+}
+
+// handleForecast predicts per-item demand for the next ?days days (default
+// 7), so the shopper can buy ahead. With async=true it queues a "forecast"
+// job instead and answers 202 with the job to poll.
+func handleForecast(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, queue *jobs.Queue) {
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxForecastDays {
+			http.Error(w, "days must be between 1 and "+strconv.Itoa(maxForecastDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		adminID, _ := r.Context().Value(auth.ContextUserIDKey).(int)
+		enqueueJob(w, r, queue, logger, "forecast", forecastJob{Days: days}, adminID)
+		return
+	}
+
+	report, err := buildForecast(r.Context(), db, days)
+	if err != nil {
+		logger.Error("forecast query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// UserGroup is a group of users priced differently, e.g. campus staff.
+// It is also the body of POST /admin/groups and PUT /admin/groups/{id}.
+type UserGroup struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name" validate:"required,max=64"`
+	Description string `json:"description" validate:"max=200"`
+	// PriceAdjustBps is added to every item price, in basis points: -1000
+	// is 10% off, 500 a 5% markup.
+	PriceAdjustBps     int  `json:"priceAdjustBps" validate:"min=-10000,max=10000"`
+	WaiveTransportFee  bool `json:"waiveTransportFee"`
+	WaiveSmallOrderFee bool `json:"waiveSmallOrderFee"`
+	Members            int  `json:"members"`
+}
+
+// GroupAssignment is the body of PUT /admin/users/{id}/group.
+type GroupAssignment struct {
+	GroupID *int `json:"groupId" validate:"min=1"` // null takes the user out of their group
+}
+
+// handleListGroups returns every user group with how many users are in it.
+func handleListGroups(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT g.id, g.name, g.description, g.price_adjust_bps, g.waive_transport_fee, g.waive_small_order_fee,
+		        (SELECT COUNT(*) FROM users u WHERE u.group_id = g.id)
+		   FROM user_groups g
+		  ORDER BY g.name`)
+	if err != nil {
+		logger.Error("user groups query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	groups := []UserGroup{}
+	for rows.Next() {
+		var g UserGroup
+		if err := rows.Scan(&g.ID, &g.Name, &g.Description, &g.PriceAdjustBps,
+			&g.WaiveTransportFee, &g.WaiveSmallOrderFee, &g.Members); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// handleSaveGroup creates a user group, or with an id in the path changes
+// one. New prices apply to orders confirmed after the change; drafts are
+// repriced when confirmed.
+func handleSaveGroup(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	var g UserGroup
+	if !httpx.DecodeJSON(w, r, &g) {
+		return
+	}
+	g.Name = strings.TrimSpace(g.Name)
+
+	var err error
+	status := http.StatusCreated
+	if id := r.PathValue("id"); id == "" {
+		err = db.QueryRowContext(ctx,
+			`INSERT INTO user_groups (name, description, price_adjust_bps, waive_transport_fee, waive_small_order_fee)
+			 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			g.Name, g.Description, g.PriceAdjustBps, g.WaiveTransportFee, g.WaiveSmallOrderFee,
+		).Scan(&g.ID)
+	} else {
+		status = http.StatusOK
+		if g.ID, err = strconv.Atoi(id); err != nil {
+			http.Error(w, "invalid group id", http.StatusBadRequest)
+			return
+		}
+		err = db.QueryRowContext(ctx,
+			`UPDATE user_groups
+			    SET name = $1, description = $2, price_adjust_bps = $3, waive_transport_fee = $4,
+			        waive_small_order_fee = $5, updated_at = NOW()
+			  WHERE id = $6
+			 RETURNING (SELECT COUNT(*) FROM users u WHERE u.group_id = $6)`,
+			g.Name, g.Description, g.PriceAdjustBps, g.WaiveTransportFee, g.WaiveSmallOrderFee, g.ID,
+		).Scan(&g.Members)
+	}
+	var pqErr *pq.Error
+	switch {
+	case errors.As(err, &pqErr) && pqErr.Code == "23505":
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "name", Message: "is already taken"}})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		httpx.WriteError(w, domain.NotFound("group not found"))
+		return
+	case err != nil:
+		logger.Error("failed to save user group", zap.Error(err))
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "group.save", strconv.Itoa(g.ID), g); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(g)
+}
+
+// handleDeleteGroup removes a user group; its members go back to regular
+// prices.
+func handleDeleteGroup(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid group id", http.StatusBadRequest)
+		return
+	}
+
+	res, err := db.ExecContext(ctx, `DELETE FROM user_groups WHERE id = $1`, id)
+	if err != nil {
+		logger.Error("failed to delete user group", zap.Int("id", id), zap.Error(err))
+		http.Error(w, "database delete error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("group not found"))
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "group.delete", strconv.Itoa(id), struct{}{}); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSetUserGroup puts a user in a group, or takes them out of theirs.
+func handleSetUserGroup(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+	var req GroupAssignment
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	res, err := db.ExecContext(ctx, `UPDATE users SET group_id = $1 WHERE id = $2`, req.GroupID, userID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "groupId", Message: "is not a known group"}})
+		return
+	} else if err != nil {
+		logger.Error("failed to set user group", zap.Int("user_id", userID), zap.Error(err))
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("user not found"))
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "user.group", strconv.Itoa(userID), req); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,93 +1,545 @@
 package admin
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"server/internal/catalog"
+	"server/internal/db"
+	"server/internal/domain"
+	"server/internal/email"
+	"server/internal/events"
+	"server/internal/httpx"
+	"server/internal/inventory"
+	"server/internal/jobs"
+	"server/internal/payments"
+	"server/internal/webpush"
+
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
 // Item represents a catalog item.
 type Item struct {
 	ID        int    `json:"id"`
-	Name      string `json:"name"`
-	Category  string `json:"category"`
-	PriceUGX  int    `json:"priceUGX"`
+	Name      string `json:"name" validate:"required,max=100"`
+	Category  string `json:"category" validate:"required,max=50"`
+	PriceUGX  int    `json:"priceUGX" validate:"min=1"`
 	Available bool   `json:"available"`
+	// Stock is nil for items that are not tracked and never run out
+	Stock             *int `json:"stock" validate:"min=0"`
+	LowStockThreshold *int `json:"lowStockThreshold" validate:"min=0"` // nil uses LOW_STOCK_THRESHOLD
+	// Attributes are the product details; omitting them on update keeps
+	// the current ones.
+	Attributes *catalog.Attributes `json:"attributes"`
+	// CurrentPriceUGX is the scheduled price in force, if any; only set on
+	// listings.
+	CurrentPriceUGX *int `json:"currentPriceUGX,omitempty"`
+	// DaysOfStock estimates how long stock lasts at recent sales velocity;
+	// only set on listings, for tracked items that sold recently.
+	DaysOfStock *float64 `json:"daysOfStock,omitempty"`
+}
+
+// OrderSummary is an order row as seen by admins.
+type OrderSummary struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"userId"`
+	Username     string    `json:"username"`
+	Status       string    `json:"status"`
+	TransportFee int       `json:"transportFee"`
+	TotalCost    int       `json:"totalCost"`
+	OffNetwork   bool      `json:"offNetwork"` // placed from outside its campus's networks
+	Note         string    `json:"note,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// User is a user account as seen by admins.
+type User struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Verified  bool      `json:"verified"`
+	CreatedAt time.Time `json:"createdAt"`
+	Segments  []string  `json:"segments"` // as of the last nightly refresh
+	Group     *string   `json:"group"`    // pricing group name; null for none
 }
 
 // ConfigEntry represents a configuration key/value.
 type ConfigEntry struct {
-	Key   string          `json:"key"`
-	Value json.RawMessage `json:"value"`
+	Key   string          `json:"key" validate:"required,max=100"`
+	Value json.RawMessage `json:"value" validate:"required"`
 }
 
 // MakeAdminRouter returns an http.Handler for all admin routes under /admin/.
-func MakeAdminRouter(db *sql.DB, logger *zap.Logger) http.Handler {
+// Listings read from the replica; changes go to the primary. It does no role
+// checks of its own: mount it behind auth.RequireSession and
+// auth.RequireAdmin.
+func MakeAdminRouter(cluster *db.Cluster, logger *zap.Logger, bus events.Bus, payer payments.Provider, mailer *email.Client, pusher *webpush.Sender, queue *jobs.Queue) http.Handler {
 	mux := http.NewServeMux()
 
 	// Catalog (items) CRUD
 	mux.HandleFunc("/admin/items", func(w http.ResponseWriter, r *http.Request) {
-		// Only allow admin users (RequireJWT applied upstream ensures authenticated user).
-		// Further role checks can be added here by examining context.
 		switch r.Method {
-		case http.MethodGet:
-			handleListItems(w, r, db)
+		case http.MethodGet, http.MethodHead:
+			handleListItems(w, r, cluster.Reader(r.Context()))
 		case http.MethodPost:
-			handleCreateItem(w, r, db)
+			handleCreateItem(w, r, cluster.Primary, logger, bus)
 		case http.MethodPut:
-			handleUpdateItem(w, r, db)
+			handleUpdateItem(w, r, cluster.Primary, logger, bus)
 		case http.MethodDelete:
-			handleDeleteItem(w, r, db)
+			handleDeleteItem(w, r, cluster.Primary, logger, bus)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Orders (read-only listing across all users)
+	mux.HandleFunc("/admin/orders", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListOrders(w, r, cluster.Reader(r.Context()), logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Ranked search by order number, customer, or item
+	mux.HandleFunc("/admin/orders/search", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleSearchOrders(w, r, cluster.Reader(r.Context()), logger)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
+	// Admin cancellation (creates a refund for paid orders)
+	mux.HandleFunc("POST /admin/orders/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		handleCancelOrder(w, r, cluster.Primary, logger, bus)
+	})
+
+	// Evening pickup handout: who to hand what to, and marking it collected
+	mux.HandleFunc("GET /admin/pickup-manifest", func(w http.ResponseWriter, r *http.Request) {
+		handlePickupManifest(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("POST /admin/orders/{id}/collected", func(w http.ResponseWriter, r *http.Request) {
+		handleMarkCollected(w, r, cluster.Primary, logger, bus)
+	})
+
+	// Chat transcript behind an order, for disputes
+	mux.HandleFunc("GET /admin/orders/{id}/transcript", func(w http.ResponseWriter, r *http.Request) {
+		handleOrderTranscript(w, r, cluster.Reader(r.Context()), logger)
+	})
+
+	// Chat moderation
+	mux.HandleFunc("/admin/chat/violations", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListChatViolations(w, r, cluster.Reader(r.Context()), logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("GET /admin/chat/suspensions", func(w http.ResponseWriter, r *http.Request) {
+		handleListChatSuspensions(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("DELETE /admin/chat/suspensions/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		handleLiftChatSuspension(w, r, cluster.Primary)
+	})
+
+	// Sampled LLM prompts and replies, for debugging extraction
+	mux.HandleFunc("/admin/chat/llm-log", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListLLMLog(w, r, cluster.Reader(r.Context()), logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Invitations (invite-only beta)
+	mux.HandleFunc("/admin/invitations", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListInvitations(w, r, cluster.Reader(r.Context()), logger)
+		case http.MethodPost:
+			handleCreateInvitations(w, r, cluster.Primary, logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("DELETE /admin/invitations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleRevokeInvitation(w, r, cluster.Primary)
+	})
+	mux.HandleFunc("GET /admin/analytics/invitations", func(w http.ResponseWriter, r *http.Request) {
+		handleInvitationAnalytics(w, r, cluster.Reader(r.Context()), logger)
+	})
+
+	// Email delivery health and bounce suppressions
+	mux.HandleFunc("GET /admin/analytics/email", func(w http.ResponseWriter, r *http.Request) {
+		handleEmailAnalytics(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("/admin/email/suppressions", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListEmailSuppressions(w, r, cluster.Reader(r.Context()), logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("DELETE /admin/email/suppressions/{email}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteEmailSuppression(w, r, cluster.Primary)
+	})
+	mux.HandleFunc("POST /admin/emails/resend", func(w http.ResponseWriter, r *http.Request) {
+		handleResendEmail(w, r, cluster.Primary, logger, mailer)
+	})
+
+	// Audit log of support actions
+	mux.HandleFunc("/admin/audit", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListAudit(w, r, cluster.Reader(r.Context()), logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Refunds
+	mux.HandleFunc("/admin/refunds", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListRefunds(w, r, cluster.Reader(r.Context()), logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("POST /admin/refunds/{id}/approve", func(w http.ResponseWriter, r *http.Request) {
+		handleApproveRefund(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("POST /admin/refunds/{id}/issue", func(w http.ResponseWriter, r *http.Request) {
+		handleIssueRefund(w, r, cluster.Primary, logger, payer)
+	})
+
+	// Financial ledger
+	mux.HandleFunc("GET /admin/ledger", func(w http.ResponseWriter, r *http.Request) {
+		handleExportLedger(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("GET /admin/ledger/verify", func(w http.ResponseWriter, r *http.Request) {
+		handleVerifyLedger(w, r, cluster.Reader(r.Context()), logger)
+	})
+
+	// Tax classes and VAT analytics
+	mux.HandleFunc("GET /admin/tax-classes", func(w http.ResponseWriter, r *http.Request) {
+		handleListTaxClasses(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("PUT /admin/tax-classes", func(w http.ResponseWriter, r *http.Request) {
+		handleUpsertTaxClass(w, r, cluster.Primary)
+	})
+	mux.HandleFunc("PUT /admin/tax-classes/categories", func(w http.ResponseWriter, r *http.Request) {
+		handleSetCategoryTaxClass(w, r, cluster.Primary)
+	})
+	mux.HandleFunc("GET /admin/analytics/tax", func(w http.ResponseWriter, r *http.Request) {
+		handleTaxAnalytics(w, r, cluster.Reader(r.Context()), logger)
+	})
+
+	// Orders by weekday and hour, for deciding the ordering window
+	mux.HandleFunc("GET /admin/analytics/orders/heatmap", func(w http.ResponseWriter, r *http.Request) {
+		handleOrderHeatmap(w, r, cluster.Reader(r.Context()), logger)
+	})
+	// Weekly first-order cohorts and how many come back
+	mux.HandleFunc("GET /admin/analytics/retention", func(w http.ResponseWriter, r *http.Request) {
+		handleRetention(w, r, cluster.Reader(r.Context()), logger)
+	})
+
+	// Supplier cost prices and gross margin
+	mux.HandleFunc("GET /admin/items/{id}/costs", func(w http.ResponseWriter, r *http.Request) {
+		handleListItemCosts(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("POST /admin/items/{id}/costs", func(w http.ResponseWriter, r *http.Request) {
+		handleCreateItemCost(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("GET /admin/analytics/margin", func(w http.ResponseWriter, r *http.Request) {
+		handleMarginReport(w, r, cluster.Reader(r.Context()), logger)
+	})
+
+	// Campuses and their daily order capacity
+	mux.HandleFunc("GET /admin/campuses", func(w http.ResponseWriter, r *http.Request) {
+		handleListCampuses(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("PUT /admin/campuses/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handleUpsertCampus(w, r, cluster.Primary)
+	})
+	mux.HandleFunc("DELETE /admin/campuses/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteCampus(w, r, cluster.Primary)
+	})
+
+	// Weekly budgets set by support, e.g. at a parent's request
+	mux.HandleFunc("PUT /admin/users/{id}/budget", func(w http.ResponseWriter, r *http.Request) {
+		handleSetUserBudget(w, r, cluster.Primary, logger)
+	})
+	// Exempts a student from campus network checks once support has
+	// confirmed where they live
+	mux.HandleFunc("PUT /admin/users/{id}/address-verified", func(w http.ResponseWriter, r *http.Request) {
+		handleSetAddressVerified(w, r, cluster.Primary, logger)
+	})
+
+	// User groups priced differently, e.g. campus staff
+	mux.HandleFunc("GET /admin/groups", func(w http.ResponseWriter, r *http.Request) {
+		handleListGroups(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("POST /admin/groups", func(w http.ResponseWriter, r *http.Request) {
+		handleSaveGroup(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("PUT /admin/groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleSaveGroup(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("DELETE /admin/groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteGroup(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("PUT /admin/users/{id}/group", func(w http.ResponseWriter, r *http.Request) {
+		handleSetUserGroup(w, r, cluster.Primary, logger)
+	})
+
+	// Scheduled prices and flash sales
+	mux.HandleFunc("GET /admin/price-schedules", func(w http.ResponseWriter, r *http.Request) {
+		handleListPriceSchedules(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("POST /admin/price-schedules", func(w http.ResponseWriter, r *http.Request) {
+		handleCreatePriceSchedule(w, r, cluster.Primary, logger, bus)
+	})
+	mux.HandleFunc("DELETE /admin/price-schedules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeletePriceSchedule(w, r, cluster.Primary, logger, bus)
+	})
+	mux.HandleFunc("GET /admin/price-schedules/calendar", func(w http.ResponseWriter, r *http.Request) {
+		handlePriceCalendar(w, r, cluster.Reader(r.Context()), logger)
+	})
+
+	// Other names for items, in English, Luganda, or Swahili, that search matches
+	mux.HandleFunc("GET /admin/aliases", func(w http.ResponseWriter, r *http.Request) {
+		handleListAliases(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("POST /admin/aliases", func(w http.ResponseWriter, r *http.Request) {
+		handleCreateAlias(w, r, cluster.Primary, logger, bus)
+	})
+	mux.HandleFunc("DELETE /admin/aliases/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteAlias(w, r, cluster.Primary, logger, bus)
+	})
+
+	// Product phrases chat could not match, to map to aliases or dismiss
+	mux.HandleFunc("GET /admin/catalog/misses", func(w http.ResponseWriter, r *http.Request) {
+		handleListMisses(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("POST /admin/catalog/misses/map", func(w http.ResponseWriter, r *http.Request) {
+		handleMapMiss(w, r, cluster.Primary, logger, bus)
+	})
+	mux.HandleFunc("POST /admin/catalog/misses/dismiss", func(w http.ResponseWriter, r *http.Request) {
+		handleDismissMiss(w, r, cluster.Primary, logger)
+	})
+
+	// Hall locations, for ordering delivery stops
+	mux.HandleFunc("GET /admin/delivery/halls", func(w http.ResponseWriter, r *http.Request) {
+		handleListDeliveryHalls(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("PUT /admin/delivery/halls/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handleUpsertDeliveryHall(w, r, cluster.Primary)
+	})
+	mux.HandleFunc("DELETE /admin/delivery/halls/{name}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteDeliveryHall(w, r, cluster.Primary)
+	})
+
+	// Demand forecast for buying ahead
+	mux.HandleFunc("GET /admin/forecast", func(w http.ResponseWriter, r *http.Request) {
+		handleForecast(w, r, cluster.Reader(r.Context()), logger, queue)
+	})
+
+	// Referential integrity audit and orphan cleanup
+	mux.HandleFunc("GET /admin/integrity", func(w http.ResponseWriter, r *http.Request) {
+		handleIntegrity(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("POST /admin/integrity/cleanup", func(w http.ResponseWriter, r *http.Request) {
+		handleIntegrityCleanup(w, r, cluster.Primary, logger)
+	})
+
+	// Operational alerts, read from the primary so they are current even
+	// when the replica is what is failing
+	mux.HandleFunc("GET /admin/alerts", func(w http.ResponseWriter, r *http.Request) {
+		handleAlerts(w, r, cluster.Primary, logger)
+	})
+
+	// What the retention purge would delete now
+	mux.HandleFunc("GET /admin/data-retention", func(w http.ResponseWriter, r *http.Request) {
+		handleRetentionPreview(w, r, cluster.Reader(r.Context()), logger)
+	})
+
+	// Warehouse export, one page of one table per request
+	mux.HandleFunc("GET /admin/export/{table}", func(w http.ResponseWriter, r *http.Request) {
+		handleExport(w, r, cluster.Reader(r.Context()), logger)
+	})
+
+	// Support ticket queue; replies are emailed to the customer
+	mux.HandleFunc("/admin/support/tickets", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleSupportQueue(w, r, cluster.Reader(r.Context()), logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("GET /admin/support/tickets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleSupportTicket(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("POST /admin/support/tickets/{id}/messages", func(w http.ResponseWriter, r *http.Request) {
+		handleSupportReply(w, r, cluster.Primary, logger, mailer)
+	})
+	mux.HandleFunc("PUT /admin/support/tickets/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+		handleSetTicketStatus(w, r, cluster.Primary, logger)
+	})
+
+	// Announcement email campaigns, sent by a background job
+	mux.HandleFunc("/admin/campaigns", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListCampaigns(w, r, cluster.Reader(r.Context()), logger)
+		case http.MethodPost:
+			handleCreateCampaign(w, r, cluster.Primary, logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("GET /admin/campaigns/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleGetCampaign(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("PUT /admin/campaigns/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleUpdateCampaign(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("POST /admin/campaigns/{id}/send", func(w http.ResponseWriter, r *http.Request) {
+		handleSendCampaign(w, r, cluster.Primary, logger, queue)
+	})
+	mux.HandleFunc("POST /admin/campaigns/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		handleCancelCampaign(w, r, cluster.Primary, logger)
+	})
+
+	// Banners shown by the frontend and the chat greeting
+	mux.HandleFunc("/admin/announcements", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListAnnouncements(w, r, cluster.Reader(r.Context()), logger)
+		case http.MethodPost:
+			handleCreateAnnouncement(w, r, cluster.Primary, logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("PUT /admin/announcements/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleUpdateAnnouncement(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("DELETE /admin/announcements/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeleteAnnouncement(w, r, cluster.Primary, logger)
+	})
+
+	// Background jobs, polled after queueing e.g. GET /admin/forecast?async=true
+	mux.HandleFunc("/admin/jobs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListJobs(w, r, cluster.Primary, logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("GET /admin/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleGetJob(w, r, cluster.Primary, logger)
+	})
+
+	// Browser push notifications for new and cancelled orders
+	mux.HandleFunc("GET /admin/push/key", func(w http.ResponseWriter, r *http.Request) {
+		handlePushKey(w, r, pusher)
+	})
+	mux.HandleFunc("GET /admin/push/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		handleListPushSubscriptions(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("POST /admin/push/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		handleCreatePushSubscription(w, r, cluster.Primary, logger, pusher)
+	})
+	mux.HandleFunc("DELETE /admin/push/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleDeletePushSubscription(w, r, cluster.Primary)
+	})
+
+	// Users (read-only listing)
+	mux.HandleFunc("/admin/users", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handleListUsers(w, r, cluster.Reader(r.Context()), logger)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	// Student segments, computed nightly; also campaign audiences
+	mux.HandleFunc("GET /admin/segments", func(w http.ResponseWriter, r *http.Request) {
+		handleListSegments(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("POST /admin/segments/refresh", func(w http.ResponseWriter, r *http.Request) {
+		handleRefreshSegments(w, r, cluster.Primary, logger)
+	})
+
 	// Configuration CRUD
 	mux.HandleFunc("/admin/config", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			handleListConfig(w, r, db)
+			handleListConfig(w, r, cluster.Reader(r.Context()))
 		case http.MethodPut:
-			handleUpdateConfig(w, r, db)
+			handleUpdateConfig(w, r, cluster.Primary)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("GET /admin/config/schema", func(w http.ResponseWriter, r *http.Request) {
+		handleConfigSchema(w, r)
+	})
 
 	// Return the mux directly since JWT check is already applied upstream in main.go
 	return mux
 }
 
-// handleListItems returns all items (with optional query by category or availability).
+// handleListItems returns all items (with optional query by category,
+// availability, or tags).
 func handleListItems(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	ctx := r.Context()
 
-	// Optional filters: category, available
+	// Optional filters: category, available, tag (repeatable; items must have all)
 	q := r.URL.Query().Get("category")
 	availStr := r.URL.Query().Get("available")
+	tags := catalog.NormalizeTags(r.URL.Query()["tag"])
 
 	var filters []string
 	var args []interface{}
 	argIdx := 1
 
 	if q != "" {
-		filters = append(filters, fmt.Sprintf("category = $%d", argIdx))
+		filters = append(filters, fmt.Sprintf("i.category = $%d", argIdx))
 		args = append(args, q)
 		argIdx++
 	}
 	if availStr != "" {
 		avail, err := strconv.ParseBool(availStr)
 		if err == nil {
-			filters = append(filters, fmt.Sprintf("available = $%d", argIdx))
+			filters = append(filters, fmt.Sprintf("i.available = $%d", argIdx))
 			args = append(args, avail)
 			argIdx++
 		}
 	}
+	if len(tags) > 0 {
+		filters = append(filters, fmt.Sprintf("i.attributes->'tags' ?& $%d", argIdx))
+		args = append(args, pq.Array(tags))
+		argIdx++
+	}
 	whereClause := ""
 	if len(filters) > 0 {
 		whereClause = "WHERE " + filters[0]
@@ -96,7 +548,30 @@ func handleListItems(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		}
 	}
 
-	query := fmt.Sprintf("SELECT id, name, category, price_ugx, available FROM items %s ORDER BY name", whereClause)
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM items i "+whereClause, args...).Scan(&total); err != nil {
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	query := fmt.Sprintf(`
+		SELECT i.id, i.name, i.category, i.price_ugx, item_price(i.id, NOW()), i.available, i.stock, i.low_stock_threshold, i.attributes, COALESCE(v.sold, 0)
+		  FROM items i
+		  LEFT JOIN (SELECT oi.item_id, SUM(oi.quantity) AS sold
+		               FROM order_items oi
+		               JOIN orders o ON o.id = oi.order_id
+		              WHERE o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		                AND o.created_at >= NOW() - make_interval(days => %d)
+		              GROUP BY oi.item_id) v ON v.item_id = i.id
+		  %s
+		 ORDER BY i.name
+		 LIMIT $%d OFFSET $%d`, inventory.VelocityWindow, whereClause, argIdx, argIdx+1)
+	args = append(args, page.Limit, page.Offset())
 	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		http.Error(w, "database query error", http.StatusInternalServerError)
@@ -107,10 +582,33 @@ func handleListItems(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	var items []Item
 	for rows.Next() {
 		var it Item
-		if err := rows.Scan(&it.ID, &it.Name, &it.Category, &it.PriceUGX, &it.Available); err != nil {
+		var stock, threshold sql.NullInt64
+		var attributes []byte
+		var current, sold int
+		if err := rows.Scan(&it.ID, &it.Name, &it.Category, &it.PriceUGX, &current, &it.Available, &stock, &threshold, &attributes, &sold); err != nil {
 			http.Error(w, "row scan error", http.StatusInternalServerError)
 			return
 		}
+		if current != it.PriceUGX {
+			it.CurrentPriceUGX = &current
+		}
+		it.Attributes = &catalog.Attributes{}
+		if err := json.Unmarshal(attributes, it.Attributes); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		if stock.Valid {
+			n := int(stock.Int64)
+			it.Stock = &n
+			if days, ok := inventory.DaysOfStock(n, sold); ok {
+				days = math.Round(days*10) / 10
+				it.DaysOfStock = &days
+			}
+		}
+		if threshold.Valid {
+			n := int(threshold.Int64)
+			it.LowStockThreshold = &n
+		}
 		items = append(items, it)
 	}
 	if err := rows.Err(); err != nil {
@@ -118,36 +616,200 @@ func handleListItems(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(items)
+	httpx.WritePage(w, page, total, items)
+}
+
+// handleListOrders returns all orders, optionally filtered by status, user,
+// day, or whether they were placed off their campus network.
+func handleListOrders(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+
+	// Optional filters: status, userId, date (YYYY-MM-DD), offNetwork
+	var filters []string
+	var args []interface{}
+	argIdx := 1
+
+	if status := r.URL.Query().Get("status"); status != "" {
+		filters = append(filters, fmt.Sprintf("o.status = $%d", argIdx))
+		args = append(args, status)
+		argIdx++
+	}
+	if uid, err := strconv.Atoi(r.URL.Query().Get("userId")); err == nil {
+		filters = append(filters, fmt.Sprintf("o.user_id = $%d", argIdx))
+		args = append(args, uid)
+		argIdx++
+	}
+	if date, err := time.Parse("2006-01-02", r.URL.Query().Get("date")); err == nil {
+		filters = append(filters, fmt.Sprintf("o.created_at >= $%d AND o.created_at < $%d", argIdx, argIdx+1))
+		args = append(args, date, date.Add(24*time.Hour))
+		argIdx += 2
+	}
+	if off, err := strconv.ParseBool(r.URL.Query().Get("offNetwork")); err == nil {
+		filters = append(filters, fmt.Sprintf("o.off_network = $%d", argIdx))
+		args = append(args, off)
+		argIdx++
+	}
+	whereClause := ""
+	if len(filters) > 0 {
+		whereClause = "WHERE " + strings.Join(filters, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders o "+whereClause, args...).Scan(&total); err != nil {
+		logger.Error("admin orders count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	query := fmt.Sprintf(`
+		SELECT o.id, o.user_id, u.username, o.status, o.transport_fee, o.total_cost, o.off_network, o.note, o.created_at
+		  FROM orders o
+		  JOIN users u ON u.id = o.user_id
+		  %s
+		 ORDER BY o.created_at DESC
+		 LIMIT $%d OFFSET $%d`, whereClause, argIdx, argIdx+1)
+	args = append(args, page.Limit, page.Offset())
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Error("admin orders query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var orders []OrderSummary
+	for rows.Next() {
+		var o OrderSummary
+		if err := rows.Scan(&o.ID, &o.UserID, &o.Username, &o.Status, &o.TransportFee, &o.TotalCost, &o.OffNetwork, &o.Note, &o.CreatedAt); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	httpx.WritePage(w, page, total, orders)
+}
+
+// handleListUsers returns all registered users, newest first, with their
+// segments and group, optionally only those in ?segment and ?groupId.
+func handleListUsers(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+
+	where := ""
+	args := []interface{}{}
+	var filters []string
+	if segment := r.URL.Query().Get("segment"); segment != "" {
+		args = append(args, segment)
+		filters = append(filters, `EXISTS (SELECT 1 FROM user_segments s WHERE s.user_id = users.id AND s.segment = $`+strconv.Itoa(len(args))+`)`)
+	}
+	if group := r.URL.Query().Get("groupId"); group != "" {
+		id, err := strconv.Atoi(group)
+		if err != nil {
+			http.Error(w, "invalid groupId", http.StatusBadRequest)
+			return
+		}
+		args = append(args, id)
+		filters = append(filters, `users.group_id = $`+strconv.Itoa(len(args)))
+	}
+	if len(filters) > 0 {
+		where = "WHERE " + strings.Join(filters, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users `+where, args...).Scan(&total); err != nil {
+		logger.Error("admin users count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	n := len(args)
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, username, email, verified, created_at,
+		        ARRAY(SELECT segment FROM user_segments s WHERE s.user_id = users.id ORDER BY segment),
+		        (SELECT g.name FROM user_groups g WHERE g.id = users.group_id)
+		   FROM users `+where+`
+		  ORDER BY created_at DESC
+		  LIMIT $`+strconv.Itoa(n+1)+` OFFSET $`+strconv.Itoa(n+2),
+		append(args, page.Limit, page.Offset())...,
+	)
+	if err != nil {
+		logger.Error("admin users query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.Verified, &u.CreatedAt, (*pq.StringArray)(&u.Segments), &u.Group); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	httpx.WritePage(w, page, total, users)
+}
+
+// publishCatalogChanged tells cached copies of the catalog that item itemID
+// changed. Failures are only logged; the caches also refresh on a timer.
+func publishCatalogChanged(ctx context.Context, bus events.Bus, logger *zap.Logger, itemID int) {
+	if err := bus.Publish(ctx, catalog.TopicChanged, map[string]int{"itemId": itemID}); err != nil {
+		logger.Error("failed to publish catalog change", zap.Int("item_id", itemID), zap.Error(err))
+	}
 }
 
 // handleCreateItem adds a new catalog item.
-func handleCreateItem(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func handleCreateItem(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
 	ctx := r.Context()
 	var it Item
-	if err := json.NewDecoder(r.Body).Decode(&it); err != nil {
-		http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+	if !httpx.DecodeJSON(w, r, &it) {
 		return
 	}
-	defer r.Body.Close()
-	if it.Name == "" || it.Category == "" || it.PriceUGX <= 0 {
-		http.Error(w, "name, category, and positive priceUGX are required", http.StatusBadRequest)
+	if it.Attributes == nil {
+		it.Attributes = &catalog.Attributes{}
+	}
+	it.Attributes.Normalize()
+	attributes, err := json.Marshal(it.Attributes)
+	if err != nil {
+		http.Error(w, "invalid attributes", http.StatusBadRequest)
 		return
 	}
-	const q = `INSERT INTO items (name, category, price_ugx, available) VALUES ($1, $2, $3, $4) RETURNING id`
-	err := db.QueryRowContext(ctx, q, it.Name, it.Category, it.PriceUGX, it.Available).Scan(&it.ID)
+	const q = `INSERT INTO items (name, category, price_ugx, available, stock, low_stock_threshold, attributes)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err = db.QueryRowContext(ctx, q, it.Name, it.Category, it.PriceUGX, it.Available, it.Stock, it.LowStockThreshold, attributes).Scan(&it.ID)
 	if err != nil {
 		http.Error(w, "database insert error", http.StatusInternalServerError)
 		return
 	}
+	publishCatalogChanged(ctx, bus, logger, it.ID)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(it)
 }
 
 // handleUpdateItem updates an existing catalog item by id.
-func handleUpdateItem(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func handleUpdateItem(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
 	ctx := r.Context()
 	idStr := r.URL.Query().Get("id")
 	if idStr == "" {
@@ -160,27 +822,41 @@ func handleUpdateItem(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 	var it Item
-	if err := json.NewDecoder(r.Body).Decode(&it); err != nil {
-		http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+	if !httpx.DecodeJSON(w, r, &it) {
 		return
 	}
-	defer r.Body.Close()
-	const q = `UPDATE items SET name=$1, category=$2, price_ugx=$3, available=$4 WHERE id=$5`
-	res, err := db.ExecContext(ctx, q, it.Name, it.Category, it.PriceUGX, it.Available, id)
+	var attributes sql.NullString // NULL keeps the current attributes
+	if it.Attributes != nil {
+		it.Attributes.Normalize()
+		b, err := json.Marshal(it.Attributes)
+		if err != nil {
+			http.Error(w, "invalid attributes", http.StatusBadRequest)
+			return
+		}
+		attributes = sql.NullString{String: string(b), Valid: true}
+	}
+	// Switching an item on takes it back from the stock monitor; leaving a
+	// sold-out item off lets the monitor bring it back once restocked
+	const q = `UPDATE items SET name=$1, category=$2, price_ugx=$3, available=$4, stock=$5, low_stock_threshold=$6,
+	           attributes = COALESCE($8::jsonb, attributes),
+	           auto_unavailable = auto_unavailable AND NOT $4 WHERE id=$7`
+	res, err := db.ExecContext(ctx, q, it.Name, it.Category, it.PriceUGX, it.Available, it.Stock, it.LowStockThreshold, id, attributes)
 	if err != nil {
 		http.Error(w, "database update error", http.StatusInternalServerError)
 		return
 	}
 	rowsAffected, _ := res.RowsAffected()
 	if rowsAffected == 0 {
-		http.Error(w, "item not found", http.StatusNotFound)
+		httpx.WriteError(w, domain.NotFound("item not found"))
 		return
 	}
+	publishCatalogChanged(ctx, bus, logger, id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// handleDeleteItem removes a catalog item by id.
-func handleDeleteItem(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+// handleDeleteItem removes a catalog item by id. Items on any order are
+// refused by the order_items foreign key.
+func handleDeleteItem(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
 	ctx := r.Context()
 	idStr := r.URL.Query().Get("id")
 	if idStr == "" {
@@ -194,15 +870,21 @@ func handleDeleteItem(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	}
 	const q = `DELETE FROM items WHERE id=$1`
 	res, err := db.ExecContext(ctx, q, id)
-	if err != nil {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		// Orders keep their lines; mark the item unavailable instead
+		http.Error(w, "item is on existing orders; mark it unavailable instead", http.StatusConflict)
+		return
+	} else if err != nil {
 		http.Error(w, "database delete error", http.StatusInternalServerError)
 		return
 	}
 	rowsAffected, _ := res.RowsAffected()
 	if rowsAffected == 0 {
-		http.Error(w, "item not found", http.StatusNotFound)
+		httpx.WriteError(w, domain.NotFound("item not found"))
 		return
 	}
+	publishCatalogChanged(ctx, bus, logger, id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -234,19 +916,25 @@ func handleListConfig(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	json.NewEncoder(w).Encode(entries)
 }
 
-// handleUpdateConfig updates a configuration entry by key.
+// handleUpdateConfig updates a configuration entry by key. Only keys in the
+// settings schema are accepted, with values of their type and range.
 func handleUpdateConfig(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	ctx := r.Context()
 	var ce ConfigEntry
-	if err := json.NewDecoder(r.Body).Decode(&ce); err != nil {
-		http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+	if !httpx.DecodeJSON(w, r, &ce) {
+		return
+	}
+	setting, ok := lookupSetting(ce.Key)
+	if !ok {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "key", Message: unknownSettingMessage(ce.Key)}})
 		return
 	}
-	defer r.Body.Close()
-	if ce.Key == "" {
-		http.Error(w, "key is required", http.StatusBadRequest)
+	value, msg := setting.validate(ce.Value)
+	if msg != "" {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "value", Message: msg}})
 		return
 	}
+	ce.Value = value
 	const q = `UPDATE config SET value_json=$1 WHERE key=$2`
 	res, err := db.ExecContext(ctx, q, ce.Value, ce.Key)
 	if err != nil {
@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"server/internal/locale"
+	"server/internal/orders"
+
+	"go.uber.org/zap"
+)
+
+// Heatmap ranges: the default when from and to are omitted, and the longest
+// allowed.
+const (
+	defaultHeatmapDays = 28
+	maxHeatmapDays     = 366
+)
+
+// weekdays are ISO weekdays 1 to 7, Monday first.
+var weekdays = [...]string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// HeatmapCell is one hour of one weekday, in Kampala time.
+type HeatmapCell struct {
+	Weekday    string `json:"weekday"` // Mon to Sun
+	Hour       int    `json:"hour"`    // 0 to 23
+	Orders     int    `json:"orders"`
+	RevenueUGX int    `json:"revenueUGX"`
+	InWindow   bool   `json:"inWindow"` // within ordering hours
+}
+
+// Heatmap is GET /admin/analytics/orders/heatmap: every weekday and hour,
+// with and without orders, plus how much fell outside ordering hours.
+type Heatmap struct {
+	From             string        `json:"from"`
+	To               string        `json:"to"`
+	Window           string        `json:"window"` // e.g. "08:00-17:00"
+	Cells            []HeatmapCell `json:"cells"`  // Monday 00:00 first
+	Orders           int           `json:"orders"`
+	RevenueUGX       int           `json:"revenueUGX"`
+	OutsideWindow    int           `json:"outsideWindow"`    // orders placed outside ordering hours
+	OutsideWindowUGX int           `json:"outsideWindowUGX"` // and their revenue
+}
+
+// parseDayRange reads ?from and ?to, Kampala dates (YYYY-MM-DD) both
+// included, defaulting to the defaultDays ending today. It writes a 400 and
+// returns false if either is malformed, they are reversed, or they span more
+// than maxDays.
+func parseDayRange(w http.ResponseWriter, q url.Values, defaultDays, maxDays int) (from, to time.Time, ok bool) {
+	local := time.Now().In(locale.EAT)
+	to = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, locale.EAT)
+	from = to.AddDate(0, 0, 1-defaultDays)
+	var err error
+	if s := q.Get("from"); s != "" {
+		if from, err = time.ParseInLocation("2006-01-02", s, locale.EAT); err != nil {
+			http.Error(w, "from must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+			return from, to, false
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		if to, err = time.ParseInLocation("2006-01-02", s, locale.EAT); err != nil {
+			http.Error(w, "to must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+			return from, to, false
+		}
+	}
+	if to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return from, to, false
+	}
+	if to.Sub(from) >= time.Duration(maxDays)*24*time.Hour {
+		http.Error(w, fmt.Sprintf("range must be at most %d days", maxDays), http.StatusBadRequest)
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// handleOrderHeatmap counts confirmed and fulfilled orders, archived ones
+// included, and their revenue by Kampala weekday and hour of placing, over
+// [from, to] (YYYY-MM-DD, inclusive; default the last 28 days), as JSON or,
+// with format=csv, a CSV download.
+func handleOrderHeatmap(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	q := r.URL.Query()
+	from, to, ok := parseDayRange(w, q, defaultHeatmapDays, maxHeatmapDays)
+	if !ok {
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT EXTRACT(ISODOW FROM created_at AT TIME ZONE 'Africa/Kampala')::int,
+		        EXTRACT(HOUR FROM created_at AT TIME ZONE 'Africa/Kampala')::int,
+		        COUNT(*), COALESCE(SUM(total_cost), 0)
+		   FROM all_orders
+		  WHERE status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		    AND created_at >= $1 AND created_at < $2
+		  GROUP BY 1, 2`,
+		from, to.AddDate(0, 0, 1),
+	)
+	if err != nil {
+		logger.Error("order heatmap query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	opens, _ := time.Parse("15:04", orders.OrdersOpenAt)
+	closes, _ := time.Parse("15:04", orders.CutoffTime)
+	h := Heatmap{
+		From:   from.Format("2006-01-02"),
+		To:     to.Format("2006-01-02"),
+		Window: orders.OrdersOpenAt + "-" + orders.CutoffTime,
+		Cells:  make([]HeatmapCell, len(weekdays)*24),
+	}
+	for i := range h.Cells {
+		hour := i % 24
+		h.Cells[i] = HeatmapCell{
+			Weekday:  weekdays[i/24],
+			Hour:     hour,
+			InWindow: hour >= opens.Hour() && hour < closes.Hour(),
+		}
+	}
+	for rows.Next() {
+		var day, hour, n, revenue int
+		if err := rows.Scan(&day, &hour, &n, &revenue); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		c := &h.Cells[(day-1)*24+hour]
+		c.Orders, c.RevenueUGX = n, revenue
+		h.Orders += n
+		h.RevenueUGX += revenue
+		if !c.InWindow {
+			h.OutsideWindow += n
+			h.OutsideWindowUGX += revenue
+		}
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	if q.Get("format") != "csv" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(h)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="order-heatmap-%s-%s.csv"`, from.Format("20060102"), to.Format("20060102")))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"weekday", "hour", "orders", "revenue_ugx", "in_window"})
+	for _, c := range h.Cells {
+		cw.Write([]string{c.Weekday, strconv.Itoa(c.Hour), strconv.Itoa(c.Orders), strconv.Itoa(c.RevenueUGX),
+			strconv.FormatBool(c.InWindow)})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"server/internal/auth"
+	"server/internal/integrity"
+
+	"go.uber.org/zap"
+)
+
+// handleIntegrity reports missing foreign keys and orphaned rows.
+func handleIntegrity(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	rep, err := integrity.Check(r.Context(), db)
+	if err != nil {
+		logger.Error("integrity check failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
+
+// handleIntegrityCleanup deletes the orphans that are safe to remove. It is a
+// dry run listing what would go unless ?dryRun=false.
+func handleIntegrityCleanup(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	dryRun := r.URL.Query().Get("dryRun") != "false"
+
+	removals, err := integrity.Cleanup(ctx, db, dryRun)
+	if err != nil {
+		logger.Error("integrity cleanup failed", zap.Bool("dry_run", dryRun), zap.Error(err))
+		http.Error(w, "database delete error", http.StatusInternalServerError)
+		return
+	}
+	if !dryRun {
+		if err := recordAudit(ctx, db, adminID, "integrity.cleanup", "orphans", removals); err != nil {
+			logger.Error("failed to record audit entry", zap.Error(err))
+		}
+		logger.Info("admin removed orphaned rows", zap.Int("admin_id", adminID), zap.Any("removals", removals))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		DryRun   bool                `json:"dryRun"`
+		Removals []integrity.Removal `json:"removals"`
+	}{dryRun, removals})
+}
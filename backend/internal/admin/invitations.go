@@ -0,0 +1,223 @@
+package admin
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// Invitation is a signup code as seen by admins, with its conversion counts.
+type Invitation struct {
+	ID           int        `json:"id"`
+	Code         string     `json:"code"`
+	MaxUses      int        `json:"maxUses"`
+	Uses         int        `json:"uses"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	Note         string     `json:"note"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	Signups      int        `json:"signups"`
+	OrderedUsers int        `json:"orderedUsers"` // signups with at least one confirmed order
+}
+
+type createInvitationsRequest struct {
+	Count     int        `json:"count" validate:"min=1,max=500"` // defaults to 1
+	MaxUses   int        `json:"maxUses" validate:"min=1,max=10000"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Note      string     `json:"note" validate:"max=200"`
+}
+
+// invitationCodeEncoding drops padding; codes are grouped as XXXX-XXXX.
+var invitationCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newInvitationCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := invitationCodeEncoding.EncodeToString(b)
+	return s[:4] + "-" + s[4:], nil
+}
+
+// invitationStats counts signups and ordering users per invitation.
+const invitationStats = `
+	LEFT JOIN LATERAL (
+		SELECT COUNT(*) AS signups,
+		       COUNT(*) FILTER (WHERE EXISTS (
+		           SELECT 1 FROM orders o
+		            WHERE o.user_id = u.id AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		       )) AS ordered_users
+		  FROM users u WHERE u.invitation_id = i.id
+	) s ON TRUE`
+
+// handleListInvitations returns invitation codes, newest first.
+func handleListInvitations(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM invitations`).Scan(&total); err != nil {
+		logger.Error("invitations count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	rows, err := db.QueryContext(ctx,
+		`SELECT i.id, i.code, i.max_uses, i.uses, i.expires_at, i.note, i.revoked_at, i.created_at,
+		        s.signups, s.ordered_users
+		   FROM invitations i`+invitationStats+`
+		  ORDER BY i.created_at DESC, i.id DESC
+		  LIMIT $1 OFFSET $2`,
+		page.Limit, page.Offset(),
+	)
+	if err != nil {
+		logger.Error("invitations query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var invitations []Invitation
+	for rows.Next() {
+		var inv Invitation
+		if err := rows.Scan(&inv.ID, &inv.Code, &inv.MaxUses, &inv.Uses, &inv.ExpiresAt, &inv.Note,
+			&inv.RevokedAt, &inv.CreatedAt, &inv.Signups, &inv.OrderedUsers); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	httpx.WritePage(w, page, total, invitations)
+}
+
+// handleCreateInvitations generates one or more invitation codes sharing the
+// same usage limit and expiry.
+func handleCreateInvitations(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	req := createInvitationsRequest{Count: 1, MaxUses: 1}
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "expiresAt", Message: "must be in the future"}})
+		return
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("failed to begin transaction", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	created := make([]Invitation, 0, req.Count)
+	for len(created) < req.Count {
+		code, err := newInvitationCode()
+		if err != nil {
+			http.Error(w, "failed to generate code", http.StatusInternalServerError)
+			return
+		}
+		inv := Invitation{Code: code, MaxUses: req.MaxUses, ExpiresAt: req.ExpiresAt, Note: req.Note}
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO invitations (code, max_uses, expires_at, note) VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (code) DO NOTHING
+			 RETURNING id, created_at`,
+			inv.Code, inv.MaxUses, inv.ExpiresAt, inv.Note,
+		).Scan(&inv.ID, &inv.CreatedAt)
+		if err == sql.ErrNoRows {
+			continue // code collision, draw again
+		}
+		if err != nil {
+			logger.Error("failed to insert invitation", zap.Error(err))
+			http.Error(w, "database insert error", http.StatusInternalServerError)
+			return
+		}
+		created = append(created, inv)
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("failed to commit invitations", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// handleRevokeInvitation stops a code from being redeemed. Users who already
+// signed up with it are unaffected.
+func handleRevokeInvitation(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid invitation id", http.StatusBadRequest)
+		return
+	}
+	res, err := db.ExecContext(r.Context(),
+		`UPDATE invitations SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id=$1`, id)
+	if err != nil {
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("invitation not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleInvitationAnalytics summarises how invitations convert into signups
+// and then into customers, optionally for codes whose note starts with ?note=.
+func handleInvitationAnalytics(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	note := strings.TrimSpace(r.URL.Query().Get("note"))
+
+	var out struct {
+		Invitations    int     `json:"invitations"`
+		Capacity       int     `json:"capacity"` // total max_uses
+		Signups        int     `json:"signups"`
+		OrderedUsers   int     `json:"orderedUsers"`
+		SignupRate     float64 `json:"signupRate"`     // signups / capacity
+		ConversionRate float64 `json:"conversionRate"` // orderedUsers / signups
+	}
+	err := db.QueryRowContext(r.Context(),
+		`SELECT COUNT(*), COALESCE(SUM(i.max_uses), 0),
+		        COALESCE(SUM(s.signups), 0), COALESCE(SUM(s.ordered_users), 0)
+		   FROM invitations i`+invitationStats+`
+		  WHERE $1 = '' OR i.note LIKE $1 || '%'`,
+		note,
+	).Scan(&out.Invitations, &out.Capacity, &out.Signups, &out.OrderedUsers)
+	if err != nil {
+		logger.Error("invitation analytics query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if out.Capacity > 0 {
+		out.SignupRate = float64(out.Signups) / float64(out.Capacity)
+	}
+	if out.Signups > 0 {
+		out.ConversionRate = float64(out.OrderedUsers) / float64(out.Signups)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,122 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/campaigns"
+	"server/internal/domain"
+	"server/internal/httpx"
+	"server/internal/jobs"
+
+	"go.uber.org/zap"
+)
+
+// campaignSlice is how long one "campaign" job sends before handing over to
+// a fresh job, keeping leases short however large the audience.
+const campaignSlice = 10 * time.Minute
+
+// RegisterJobs adds the admin panel's background job types to queue.
+func RegisterJobs(queue *jobs.Queue, db *sql.DB, sender *campaigns.Sender) {
+	queue.Register("forecast", jobs.Kind{
+		Concurrency: 2,
+		Timeout:     2 * time.Minute,
+		Run: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			var p forecastJob
+			if err := json.Unmarshal(payload, &p); err != nil {
+				return nil, err
+			}
+			if p.Days < 1 || p.Days > maxForecastDays {
+				p.Days = 7
+			}
+			return buildForecast(ctx, db, p.Days)
+		},
+	})
+	// One campaign at a time across the cluster, so the sender's rate is
+	// the rate the relay sees
+	queue.Register("campaign", jobs.Kind{
+		Concurrency: 1,
+		Timeout:     campaignSlice + time.Minute,
+		Run: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			var p campaignJob
+			if err := json.Unmarshal(payload, &p); err != nil {
+				return nil, err
+			}
+			done, err := sender.Send(ctx, p.CampaignID, time.Now().Add(campaignSlice))
+			if err != nil {
+				return nil, err
+			}
+			if !done {
+				next, err := queue.Enqueue(ctx, "campaign", p, 0)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]int64{"continuedBy": next}, nil
+			}
+			return campaigns.Get(ctx, db, p.CampaignID)
+		},
+	})
+}
+
+// enqueueJob queues a job and answers 202 with its id, pointing Location at
+// the job to poll.
+func enqueueJob(w http.ResponseWriter, r *http.Request, queue *jobs.Queue, logger *zap.Logger, jobType string, payload interface{}, adminID int) {
+	id, err := queue.Enqueue(r.Context(), jobType, payload, adminID)
+	if err != nil {
+		logger.Error("failed to enqueue job", zap.String("type", jobType), zap.Error(err))
+		http.Error(w, "failed to queue job", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/admin/jobs/"+strconv.FormatInt(id, 10))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(struct {
+		ID     int64  `json:"id"`
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	}{id, jobType, jobs.StatusQueued})
+}
+
+// handleListJobs lists background jobs, newest first, optionally by ?type
+// and ?status.
+func handleListJobs(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	q := r.URL.Query()
+	page := httpx.ParsePage(r)
+	list, total, err := jobs.List(r.Context(), db, q.Get("type"), q.Get("status"), page.Limit, page.Offset())
+	if err != nil {
+		logger.Error("jobs query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+	httpx.WritePage(w, page, total, list)
+}
+
+// handleGetJob returns one job, with its result once it has succeeded; poll
+// it after queueing work.
+func handleGetJob(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	job, err := jobs.Get(r.Context(), db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("job not found"))
+		return
+	} else if err != nil {
+		logger.Error("job query failed", zap.Int64("job_id", id), zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// LLMCall is one sampled LLM call from the llm_log table.
+type LLMCall struct {
+	ID           int64     `json:"id"`
+	Operation    string    `json:"operation"`
+	Model        string    `json:"model"`
+	SystemPrompt string    `json:"systemPrompt"`
+	UserPrompt   string    `json:"userPrompt"`
+	Response     string    `json:"response"`
+	Error        string    `json:"error,omitempty"`
+	LatencyMs    int       `json:"latencyMs"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// handleListLLMLog returns sampled LLM calls, newest first, optionally for
+// one ?operation and matching ?q in the user prompt, reply, or error.
+func handleListLLMLog(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+
+	var conds []string
+	args := []interface{}{}
+	if op := r.URL.Query().Get("operation"); op != "" {
+		args = append(args, op)
+		conds = append(conds, "operation = $"+strconv.Itoa(len(args)))
+	}
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		args = append(args, "%"+escapeLike(q)+"%")
+		n := "$" + strconv.Itoa(len(args))
+		conds = append(conds, "(user_prompt ILIKE "+n+" OR response ILIKE "+n+" OR error ILIKE "+n+")")
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM llm_log "+where, args...).Scan(&total); err != nil {
+		logger.Error("LLM log count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	n := len(args)
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, operation, model, system_prompt, user_prompt, response, error, latency_ms, created_at
+		   FROM llm_log `+where+`
+		  ORDER BY created_at DESC, id DESC
+		  LIMIT $`+strconv.Itoa(n+1)+` OFFSET $`+strconv.Itoa(n+2),
+		append(args, page.Limit, page.Offset())...,
+	)
+	if err != nil {
+		logger.Error("LLM log query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	calls := []LLMCall{}
+	for rows.Next() {
+		var c LLMCall
+		if err := rows.Scan(&c.ID, &c.Operation, &c.Model, &c.SystemPrompt, &c.UserPrompt,
+			&c.Response, &c.Error, &c.LatencyMs, &c.CreatedAt); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		calls = append(calls, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	httpx.WritePage(w, page, total, calls)
+}
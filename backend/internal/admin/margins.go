@@ -0,0 +1,319 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// Margin report ranges: the default when from and to are omitted, and the
+// longest allowed.
+const (
+	defaultMarginDays = 28
+	maxMarginDays     = 366
+)
+
+// ItemCost is a supplier cost price for an item from EffectiveFrom until the
+// item's next one.
+type ItemCost struct {
+	ID            int       `json:"id"`
+	ItemID        int       `json:"itemId"`
+	CostUGX       int       `json:"costUGX" validate:"min=0"` // per unit, net of VAT
+	EffectiveFrom time.Time `json:"effectiveFrom"`            // zero for now
+	Supplier      string    `json:"supplier" validate:"max=100"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Margin is sales, cost and gross margin over some lines. Revenue is net of
+// VAT; cost and margin cover only lines whose item had a cost price when
+// sold, the rest being counted as uncosted.
+type Margin struct {
+	Quantity           int     `json:"quantity"`
+	RevenueUGX         int     `json:"revenueUGX"`
+	CostUGX            int     `json:"costUGX"`
+	MarginUGX          int     `json:"marginUGX"`
+	MarginRate         float64 `json:"marginRate"` // MarginUGX over costed revenue, to 3 places
+	UncostedQuantity   int     `json:"uncostedQuantity"`
+	UncostedRevenueUGX int     `json:"uncostedRevenueUGX"`
+	BelowCostQuantity  int     `json:"belowCostQuantity"` // sold for less than it cost
+}
+
+func (m *Margin) add(o Margin) {
+	m.Quantity += o.Quantity
+	m.RevenueUGX += o.RevenueUGX
+	m.CostUGX += o.CostUGX
+	m.UncostedQuantity += o.UncostedQuantity
+	m.UncostedRevenueUGX += o.UncostedRevenueUGX
+	m.BelowCostQuantity += o.BelowCostQuantity
+	m.settle()
+}
+
+// settle works out MarginUGX and MarginRate from the sums.
+func (m *Margin) settle() {
+	costed := m.RevenueUGX - m.UncostedRevenueUGX
+	m.MarginUGX = costed - m.CostUGX
+	m.MarginRate = 0
+	if costed > 0 {
+		m.MarginRate = math.Round(1000*float64(m.MarginUGX)/float64(costed)) / 1000
+	}
+}
+
+// ItemMargin is one item's margin over the report's range.
+type ItemMargin struct {
+	ItemID int    `json:"itemId"`
+	Name   string `json:"name"`
+	Margin
+	BelowCost bool `json:"belowCost"` // some were sold for less than they cost
+}
+
+// DayMargin is one Kampala day's margin across all items.
+type DayMargin struct {
+	Date string `json:"date"`
+	Margin
+}
+
+// Inventory values stock on hand at current cost prices.
+type Inventory struct {
+	Units         int `json:"units"`
+	ValueUGX      int `json:"valueUGX"`
+	UncostedItems int `json:"uncostedItems"` // in stock but with no cost price, so not valued
+}
+
+// MarginReport is GET /admin/analytics/margin.
+type MarginReport struct {
+	From      string       `json:"from"`
+	To        string       `json:"to"`
+	Items     []ItemMargin `json:"items"` // below cost first, then lowest margin rate
+	Days      []DayMargin  `json:"days"`  // every day in the range
+	Total     Margin       `json:"total"`
+	Inventory Inventory    `json:"inventory"`
+}
+
+// handleListItemCosts returns an item's cost prices, latest first.
+func handleListItemCosts(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	itemID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT id, item_id, cost_ugx, effective_from, supplier, created_at
+		   FROM item_costs WHERE item_id = $1
+		  ORDER BY effective_from DESC, id DESC`,
+		itemID,
+	)
+	if err != nil {
+		logger.Error("item costs query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	costs := []ItemCost{}
+	for rows.Next() {
+		var c ItemCost
+		if err := rows.Scan(&c.ID, &c.ItemID, &c.CostUGX, &c.EffectiveFrom, &c.Supplier, &c.CreatedAt); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		costs = append(costs, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(costs)
+}
+
+// handleCreateItemCost records a supplier cost price for an item, from
+// effectiveFrom or, if omitted, now. A backdated cost changes the margins of
+// sales already made from that time.
+func handleCreateItemCost(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	itemID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	var c ItemCost
+	if !httpx.DecodeJSON(w, r, &c) {
+		return
+	}
+	c.ItemID = itemID
+	if c.EffectiveFrom.IsZero() {
+		c.EffectiveFrom = time.Now()
+	}
+
+	err = db.QueryRowContext(ctx,
+		`INSERT INTO item_costs (item_id, cost_ugx, effective_from, supplier, created_by)
+		 SELECT id, $2, $3, $4, NULLIF($5, 0) FROM items WHERE id = $1
+		 RETURNING id, created_at`,
+		c.ItemID, c.CostUGX, c.EffectiveFrom, c.Supplier, adminID,
+	).Scan(&c.ID, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("item not found"))
+		return
+	} else if err != nil {
+		logger.Error("failed to insert item cost", zap.Error(err))
+		http.Error(w, "database insert error", http.StatusInternalServerError)
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "item.cost", strconv.Itoa(c.ItemID), c); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// handleMarginReport works out gross margin, selling price net of VAT less
+// the cost price in force when sold, per item and per day on confirmed and
+// fulfilled orders, archived ones included, over [from, to] (YYYY-MM-DD,
+// inclusive; default the last 28 days), and values stock on hand. Items sold
+// below cost, typically after a price cut or a supplier price rise, are
+// flagged. With format=csv it is a CSV download of each item's sales by day.
+func handleMarginReport(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	from, to, ok := parseDayRange(w, q, defaultMarginDays, maxMarginDays)
+	if !ok {
+		return
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT (o.created_at AT TIME ZONE 'Africa/Kampala')::date, oi.item_id, i.name,
+		        SUM(oi.quantity),
+		        SUM(oi.quantity * oi.unit_price - oi.tax_amount),
+		        COALESCE(SUM(oi.quantity * c.cost), 0),
+		        COALESCE(SUM(oi.quantity) FILTER (WHERE c.cost IS NULL), 0),
+		        COALESCE(SUM(oi.quantity * oi.unit_price - oi.tax_amount) FILTER (WHERE c.cost IS NULL), 0),
+		        COALESCE(SUM(oi.quantity) FILTER (WHERE oi.quantity * oi.unit_price - oi.tax_amount < oi.quantity * c.cost), 0)
+		   FROM all_order_items oi
+		   JOIN all_orders o ON o.id = oi.order_id
+		   JOIN items i ON i.id = oi.item_id
+		  CROSS JOIN LATERAL (SELECT item_cost(oi.item_id, o.created_at) AS cost) c
+		  WHERE o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		    AND o.created_at >= $1 AND o.created_at < $2
+		  GROUP BY 1, 2, 3
+		  ORDER BY 1, 3`,
+		from, to.AddDate(0, 0, 1),
+	)
+	if err != nil {
+		logger.Error("margin query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type dayItem struct {
+		date string
+		item ItemMargin
+	}
+	var lines []dayItem
+	report := MarginReport{From: from.Format("2006-01-02"), To: to.Format("2006-01-02")}
+	dayIndex := make(map[string]int)
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		dayIndex[date] = len(report.Days)
+		report.Days = append(report.Days, DayMargin{Date: date})
+	}
+	itemIndex := make(map[int]int)
+	for rows.Next() {
+		var day time.Time
+		var it ItemMargin
+		m := &it.Margin
+		if err := rows.Scan(&day, &it.ItemID, &it.Name, &m.Quantity, &m.RevenueUGX, &m.CostUGX,
+			&m.UncostedQuantity, &m.UncostedRevenueUGX, &m.BelowCostQuantity); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		m.settle()
+		date := day.Format("2006-01-02")
+		lines = append(lines, dayItem{date, it})
+
+		if i, ok := dayIndex[date]; ok {
+			report.Days[i].add(*m)
+		}
+		i, ok := itemIndex[it.ItemID]
+		if !ok {
+			i = len(report.Items)
+			itemIndex[it.ItemID] = i
+			report.Items = append(report.Items, ItemMargin{ItemID: it.ItemID, Name: it.Name})
+		}
+		report.Items[i].add(*m)
+		report.Total.add(*m)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	if q.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="margin-%s-%s.csv"`, from.Format("20060102"), to.Format("20060102")))
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"date", "item_id", "name", "quantity", "revenue_ugx", "cost_ugx", "margin_ugx",
+			"uncosted_quantity", "below_cost_quantity"})
+		for _, l := range lines {
+			m := l.item.Margin
+			cw.Write([]string{l.date, strconv.Itoa(l.item.ItemID), l.item.Name, strconv.Itoa(m.Quantity),
+				strconv.Itoa(m.RevenueUGX), strconv.Itoa(m.CostUGX), strconv.Itoa(m.MarginUGX),
+				strconv.Itoa(m.UncostedQuantity), strconv.Itoa(m.BelowCostQuantity)})
+		}
+		cw.Flush()
+		return
+	}
+
+	if report.Items == nil {
+		report.Items = []ItemMargin{}
+	}
+	for i := range report.Items {
+		report.Items[i].BelowCost = report.Items[i].BelowCostQuantity > 0
+	}
+	sortItemMargins(report.Items)
+
+	inv := &report.Inventory
+	if err := db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(stock), 0), COALESCE(SUM(stock::bigint * cost), 0), COUNT(*) FILTER (WHERE cost IS NULL)
+		   FROM (SELECT stock, item_cost(id, NOW()) AS cost FROM items WHERE stock > 0) s`,
+	).Scan(&inv.Units, &inv.ValueUGX, &inv.UncostedItems); err != nil {
+		logger.Error("inventory valuation query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// sortItemMargins puts the items needing attention first: those sold below
+// cost, then by margin rate, lowest first, with uncosted items last.
+func sortItemMargins(items []ItemMargin) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		aCosted, bCosted := a.RevenueUGX > a.UncostedRevenueUGX, b.RevenueUGX > b.UncostedRevenueUGX
+		switch {
+		case a.BelowCost != b.BelowCost:
+			return a.BelowCost
+		case aCosted != bCosted:
+			return aCosted
+		}
+		return a.MarginRate < b.MarginRate
+	})
+}
@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// ChatViolation is a chat message blocked by moderation.
+type ChatViolation struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"userId"`
+	Username  string    `json:"username"`
+	Message   string    `json:"message"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ChatSuspension is an active suspension of a user's chat access.
+type ChatSuspension struct {
+	UserID    int       `json:"userId"`
+	Username  string    `json:"username"`
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// handleListChatViolations returns blocked messages, newest first, optionally
+// for one user.
+func handleListChatViolations(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+
+	where, args := "", []interface{}{}
+	if uid, err := strconv.Atoi(r.URL.Query().Get("userId")); err == nil {
+		where = "WHERE v.user_id = $1"
+		args = append(args, uid)
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM chat_violations v "+where, args...).Scan(&total); err != nil {
+		logger.Error("chat violations count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	n := len(args)
+	rows, err := db.QueryContext(ctx,
+		`SELECT v.id, v.user_id, u.username, v.message, v.reason, v.created_at
+		   FROM chat_violations v JOIN users u ON u.id = v.user_id `+where+`
+		  ORDER BY v.created_at DESC
+		  LIMIT $`+strconv.Itoa(n+1)+` OFFSET $`+strconv.Itoa(n+2),
+		append(args, page.Limit, page.Offset())...,
+	)
+	if err != nil {
+		logger.Error("chat violations query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var violations []ChatViolation
+	for rows.Next() {
+		var v ChatViolation
+		if err := rows.Scan(&v.ID, &v.UserID, &v.Username, &v.Message, &v.Reason, &v.CreatedAt); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		violations = append(violations, v)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	httpx.WritePage(w, page, total, violations)
+}
+
+// handleListChatSuspensions returns the suspensions still in effect.
+func handleListChatSuspensions(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT s.user_id, u.username, s.until, s.reason, s.created_at
+		   FROM chat_suspensions s JOIN users u ON u.id = s.user_id
+		  WHERE s.until > NOW()
+		  ORDER BY s.until DESC`)
+	if err != nil {
+		logger.Error("chat suspensions query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	suspensions := []ChatSuspension{}
+	for rows.Next() {
+		var s ChatSuspension
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Until, &s.Reason, &s.CreatedAt); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		suspensions = append(suspensions, s)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suspensions)
+}
+
+// handleLiftChatSuspension ends a user's chat suspension early.
+func handleLiftChatSuspension(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	userID, err := strconv.Atoi(r.PathValue("userId"))
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+	res, err := db.ExecContext(r.Context(), `DELETE FROM chat_suspensions WHERE user_id=$1`, userID)
+	if err != nil {
+		http.Error(w, "database delete error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("no suspension for user"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
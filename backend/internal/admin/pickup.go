@@ -0,0 +1,194 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/events"
+	"server/internal/fieldcrypt"
+	"server/internal/httpx"
+	"server/internal/locale"
+	"server/internal/orders"
+
+	"go.uber.org/zap"
+)
+
+// PickupOrder is one order waiting to be handed over at a pickup station.
+type PickupOrder struct {
+	OrderID       int        `json:"orderId"`
+	Username      string     `json:"username"`
+	Phone         string     `json:"phone"`
+	Items         int        `json:"items"`
+	TotalCost     int        `json:"totalCost"`
+	PaymentStatus string     `json:"paymentStatus"`
+	Collect       int        `json:"collect"` // cash due at handover; 0 once paid
+	Status        string     `json:"status"`  // CONFIRMED, PACKED, or FULFILLED once collected
+	CollectedAt   *time.Time `json:"collectedAt,omitempty"`
+	Note          string     `json:"note,omitempty"` // the student's, e.g. "call when you arrive"
+}
+
+// PickupStationManifest is one station's orders for the evening handout, by
+// customer name.
+type PickupStationManifest struct {
+	Station   string        `json:"station"`
+	Orders    []PickupOrder `json:"orders"`
+	Collected int           `json:"collected"`
+	Total     int           `json:"totalCost"`
+	Collect   int           `json:"collect"` // cash still to take
+}
+
+// PickupManifest is every station's handout list for one pickup day.
+type PickupManifest struct {
+	Date       string                  `json:"date"`
+	PickupTime string                  `json:"pickupTime"`
+	Stations   []PickupStationManifest `json:"stations"`
+}
+
+// handlePickupManifest lists the orders to hand over at pickup on ?date
+// (YYYY-MM-DD, default today in Kampala), grouped by station and sorted by
+// customer name so staff can find them quickly. ?station limits it to one
+// station. Delivered orders are on the runners' manifest instead.
+func handlePickupManifest(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	q := r.URL.Query()
+	local := time.Now().In(locale.EAT)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, locale.EAT)
+	if s := q.Get("date"); s != "" {
+		d, err := time.ParseInLocation("2006-01-02", s, locale.EAT)
+		if err != nil {
+			http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		day = d
+	}
+	from, to := orders.PickupConfirmations(day)
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT station, id, username, phone, items, total_cost, payment_status, status, collected_at, note
+		   FROM (SELECT COALESCE(NULLIF(u.pickup_station, ''), $3) AS station,
+		                o.id, u.username, COALESCE(u.phone, '') AS phone,
+		                (SELECT COALESCE(SUM(oi.quantity), 0) FROM order_items oi WHERE oi.order_id = o.id) AS items,
+		                o.total_cost, o.payment_status, o.status, o.note,
+		                (SELECT MAX(h.changed_at) FROM order_status_history h
+		                  WHERE h.order_id = o.id AND h.status = 'FULFILLED') AS collected_at
+		           FROM orders o
+		           JOIN users u ON u.id = o.user_id
+		           JOIN LATERAL (SELECT MAX(h.changed_at) AS at FROM order_status_history h
+		                          WHERE h.order_id = o.id AND h.status = 'CONFIRMED') c ON TRUE
+		          WHERE o.delivery_hall IS NULL
+		            AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		            AND c.at >= $1 AND c.at < $2) m
+		  WHERE $4 = '' OR station = $4
+		  ORDER BY station, LOWER(username), id`,
+		from, to, orders.PickupStation, strings.TrimSpace(q.Get("station")),
+	)
+	if err != nil {
+		logger.Error("pickup manifest query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	m := PickupManifest{Date: day.Format("2006-01-02"), PickupTime: orders.PickupTime, Stations: []PickupStationManifest{}}
+	for rows.Next() {
+		var station string
+		var o PickupOrder
+		if err := rows.Scan(&station, &o.OrderID, &o.Username, fieldcrypt.Opened(&o.Phone), &o.Items, &o.TotalCost,
+			&o.PaymentStatus, &o.Status, &o.CollectedAt, &o.Note); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		if o.PaymentStatus != "PAID" {
+			o.Collect = o.TotalCost
+		}
+
+		if n := len(m.Stations); n == 0 || m.Stations[n-1].Station != station {
+			m.Stations = append(m.Stations, PickupStationManifest{Station: station})
+		}
+		st := &m.Stations[len(m.Stations)-1]
+		st.Orders = append(st.Orders, o)
+		st.Total += o.TotalCost
+		if o.Status == "FULFILLED" {
+			st.Collected++
+		} else {
+			st.Collect += o.Collect
+		}
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// handleMarkCollected completes an order the customer has picked up, moving
+// it to FULFILLED.
+func handleMarkCollected(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("failed to begin transaction", zap.Error(err))
+		http.Error(w, "failed to mark order collected", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var userID, version int
+	var status string
+	err = tx.QueryRowContext(ctx,
+		`SELECT user_id, status, version FROM orders WHERE id = $1 FOR UPDATE`, orderID,
+	).Scan(&userID, &status, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("order not found"))
+		return
+	} else if err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "failed to mark order collected", http.StatusInternalServerError)
+		return
+	}
+	if !orders.CanTransition(status, "FULFILLED") {
+		http.Error(w, "order is "+strings.ToLower(status)+" and cannot be collected", http.StatusConflict)
+		return
+	}
+
+	if err := orders.UpdateStatus(ctx, tx, orderID, version, "FULFILLED"); err != nil {
+		logger.Error("failed to mark order collected", zap.Int("order_id", orderID), zap.Error(err))
+		http.Error(w, "failed to mark order collected", http.StatusInternalServerError)
+		return
+	}
+	if err := orders.RecordStatusChange(ctx, tx, orderID, "FULFILLED"); err != nil {
+		logger.Error("failed to record order status", zap.Error(err))
+		http.Error(w, "failed to mark order collected", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("transaction commit failed", zap.Error(err))
+		http.Error(w, "failed to mark order collected", http.StatusInternalServerError)
+		return
+	}
+	orders.PublishStatus(ctx, bus, logger, orders.StatusEvent{UserID: userID, OrderID: orderID, Status: "FULFILLED"})
+	if err := recordAudit(ctx, db, adminID, "order.collected", strconv.Itoa(orderID), nil); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		OrderID int    `json:"orderId"`
+		Status  string `json:"status"`
+	}{orderID, "FULFILLED"})
+}
@@ -0,0 +1,263 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/events"
+	"server/internal/httpx"
+	"server/internal/locale"
+
+	"go.uber.org/zap"
+)
+
+// Calendar limits for GET /admin/price-schedules/calendar.
+const (
+	defaultCalendarDays = 14
+	maxCalendarDays     = 92
+)
+
+// PriceSchedule is a scheduled price for an item, such as a flash sale.
+type PriceSchedule struct {
+	ID              int       `json:"id"`
+	ItemID          int       `json:"itemId" validate:"required,min=1"`
+	ItemName        string    `json:"itemName"`
+	PriceUGX        int       `json:"priceUGX" validate:"min=1"`
+	RegularPriceUGX int       `json:"regularPriceUGX"`
+	StartsAt        time.Time `json:"startsAt" validate:"required"`
+	EndsAt          time.Time `json:"endsAt" validate:"required"`
+	Note            string    `json:"note" validate:"max=200"`
+	Status          string    `json:"status"` // scheduled, active, or ended
+}
+
+// CalendarDay is one Kampala day of the price calendar and the scheduled
+// prices in force at any time during it.
+type CalendarDay struct {
+	Date      string          `json:"date"`
+	Schedules []PriceSchedule `json:"schedules"`
+}
+
+// scheduleStatus says where now falls relative to a schedule.
+func scheduleStatus(p PriceSchedule, now time.Time) string {
+	switch {
+	case now.Before(p.StartsAt):
+		return "scheduled"
+	case now.Before(p.EndsAt):
+		return "active"
+	}
+	return "ended"
+}
+
+// priceSchedules returns the schedules overlapping [from, to), optionally
+// for one item (itemID 0 for all), by start time.
+func priceSchedules(ctx context.Context, db *sql.DB, from, to time.Time, itemID int) ([]PriceSchedule, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT s.id, s.item_id, i.name, s.price_ugx, i.price_ugx, s.starts_at, s.ends_at, s.note
+		   FROM item_price_schedules s
+		   JOIN items i ON i.id = s.item_id
+		  WHERE s.ends_at > $1 AND s.starts_at < $2
+		    AND ($3 = 0 OR s.item_id = $3)
+		  ORDER BY s.starts_at, s.id`,
+		from, to, itemID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	schedules := []PriceSchedule{}
+	for rows.Next() {
+		var p PriceSchedule
+		if err := rows.Scan(&p.ID, &p.ItemID, &p.ItemName, &p.PriceUGX, &p.RegularPriceUGX,
+			&p.StartsAt, &p.EndsAt, &p.Note); err != nil {
+			return nil, err
+		}
+		p.Status = scheduleStatus(p, now)
+		schedules = append(schedules, p)
+	}
+	return schedules, rows.Err()
+}
+
+// handleListPriceSchedules returns active and upcoming scheduled prices, or
+// with all=true past ones too, optionally for one ?itemId.
+func handleListPriceSchedules(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	q := r.URL.Query()
+	itemID, _ := strconv.Atoi(q.Get("itemId"))
+	from := time.Now()
+	if all, _ := strconv.ParseBool(q.Get("all")); all {
+		from = time.Time{}
+	}
+	schedules, err := priceSchedules(r.Context(), db, from, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), itemID)
+	if err != nil {
+		logger.Error("price schedules query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+// handlePriceCalendar lays out scheduled prices day by day from ?from
+// (YYYY-MM-DD, default today in Kampala) for ?days days.
+func handlePriceCalendar(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	q := r.URL.Query()
+	local := time.Now().In(locale.EAT)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, locale.EAT)
+	if s := q.Get("from"); s != "" {
+		d, err := time.ParseInLocation("2006-01-02", s, locale.EAT)
+		if err != nil {
+			http.Error(w, "from must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		start = d
+	}
+	days := defaultCalendarDays
+	if s := q.Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxCalendarDays {
+			http.Error(w, "days must be 1 to "+strconv.Itoa(maxCalendarDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	schedules, err := priceSchedules(r.Context(), db, start, start.AddDate(0, 0, days), 0)
+	if err != nil {
+		logger.Error("price calendar query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+
+	calendar := make([]CalendarDay, days)
+	for i := range calendar {
+		dayStart := start.AddDate(0, 0, i)
+		dayEnd := dayStart.AddDate(0, 0, 1)
+		calendar[i] = CalendarDay{Date: dayStart.Format("2006-01-02"), Schedules: []PriceSchedule{}}
+		for _, p := range schedules {
+			if p.StartsAt.Before(dayEnd) && p.EndsAt.After(dayStart) {
+				calendar[i].Schedules = append(calendar[i].Schedules, p)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendar)
+}
+
+// handleCreatePriceSchedule schedules a price for an item. Schedules for the
+// same item may not overlap, so the price in force is never ambiguous.
+func handleCreatePriceSchedule(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	var p PriceSchedule
+	if !httpx.DecodeJSON(w, r, &p) {
+		return
+	}
+	if !p.EndsAt.After(p.StartsAt) {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "endsAt", Message: "must be after startsAt"}})
+		return
+	}
+	if !p.EndsAt.After(time.Now()) {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "endsAt", Message: "must be in the future"}})
+		return
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("failed to begin transaction", zap.Error(err))
+		http.Error(w, "failed to schedule price", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the item so concurrent schedules for it are checked in turn
+	err = tx.QueryRowContext(ctx,
+		`SELECT name, price_ugx FROM items WHERE id = $1 FOR UPDATE`, p.ItemID,
+	).Scan(&p.ItemName, &p.RegularPriceUGX)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "itemId", Message: "is not a known item"}})
+		return
+	} else if err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "failed to schedule price", http.StatusInternalServerError)
+		return
+	}
+
+	var clash int
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM item_price_schedules
+		  WHERE item_id = $1 AND ends_at > $2 AND starts_at < $3
+		  ORDER BY starts_at LIMIT 1`,
+		p.ItemID, p.StartsAt, p.EndsAt,
+	).Scan(&clash)
+	if err == nil {
+		http.Error(w, "overlaps price schedule "+strconv.Itoa(clash)+" for this item", http.StatusConflict)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "failed to schedule price", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO item_price_schedules (item_id, price_ugx, starts_at, ends_at, note, created_by)
+		 VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0)) RETURNING id`,
+		p.ItemID, p.PriceUGX, p.StartsAt, p.EndsAt, p.Note, adminID,
+	).Scan(&p.ID); err != nil {
+		logger.Error("failed to insert price schedule", zap.Error(err))
+		http.Error(w, "failed to schedule price", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("transaction commit failed", zap.Error(err))
+		http.Error(w, "failed to schedule price", http.StatusInternalServerError)
+		return
+	}
+	publishCatalogChanged(ctx, bus, logger, p.ItemID)
+	if err := recordAudit(ctx, db, adminID, "price.schedule", strconv.Itoa(p.ItemID), p); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+
+	p.Status = scheduleStatus(p, time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// handleDeletePriceSchedule removes a scheduled price; one in force ends at
+// once and the item goes back to its regular price.
+func handleDeletePriceSchedule(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid schedule id", http.StatusBadRequest)
+		return
+	}
+
+	var itemID int
+	err = db.QueryRowContext(ctx,
+		`DELETE FROM item_price_schedules WHERE id = $1 RETURNING item_id`, id,
+	).Scan(&itemID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("price schedule not found"))
+		return
+	} else if err != nil {
+		logger.Error("failed to delete price schedule", zap.Int("id", id), zap.Error(err))
+		http.Error(w, "database delete error", http.StatusInternalServerError)
+		return
+	}
+	publishCatalogChanged(ctx, bus, logger, itemID)
+	if err := recordAudit(ctx, db, adminID, "price.unschedule", strconv.Itoa(itemID),
+		map[string]int{"scheduleId": id}); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
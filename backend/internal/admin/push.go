@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/httpx"
+	"server/internal/webpush"
+
+	"go.uber.org/zap"
+)
+
+// pushSubscriptionRequest is a browser PushSubscription as serialized by its
+// toJSON method.
+type pushSubscriptionRequest struct {
+	Endpoint       string `json:"endpoint" validate:"required,max=2000"`
+	ExpirationTime *int64 `json:"expirationTime"` // Unix milliseconds
+	Keys           struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// handlePushKey returns the VAPID public key browsers subscribe with.
+func handlePushKey(w http.ResponseWriter, r *http.Request, pusher *webpush.Sender) {
+	if pusher == nil {
+		httpx.WriteError(w, domain.NotFound("web push is not configured"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"publicKey": pusher.PublicKey})
+}
+
+// handleListPushSubscriptions returns the calling admin's subscribed
+// browsers.
+func handleListPushSubscriptions(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	adminID, _ := r.Context().Value(auth.ContextUserIDKey).(int)
+	subs, err := webpush.List(r.Context(), db, adminID)
+	if err != nil {
+		logger.Error("push subscriptions query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+// handleCreatePushSubscription subscribes the calling admin's browser to
+// order notifications.
+func handleCreatePushSubscription(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, pusher *webpush.Sender) {
+	if pusher == nil {
+		httpx.WriteError(w, domain.NotFound("web push is not configured"))
+		return
+	}
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+
+	var req pushSubscriptionRequest
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+	var errs httpx.ValidationErrors
+	if u, err := url.Parse(req.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+		errs = append(errs, httpx.FieldError{Field: "endpoint", Message: "must be an https URL"})
+	}
+	if req.Keys.P256dh == "" {
+		errs = append(errs, httpx.FieldError{Field: "keys.p256dh", Message: "is required"})
+	}
+	if req.Keys.Auth == "" {
+		errs = append(errs, httpx.FieldError{Field: "keys.auth", Message: "is required"})
+	}
+	if len(errs) > 0 {
+		httpx.WriteValidationErrors(w, errs)
+		return
+	}
+
+	sub := webpush.Subscription{
+		UserID:    adminID,
+		Endpoint:  req.Endpoint,
+		P256dh:    req.Keys.P256dh,
+		Auth:      req.Keys.Auth,
+		UserAgent: r.UserAgent(),
+	}
+	if req.ExpirationTime != nil {
+		t := time.UnixMilli(*req.ExpirationTime)
+		sub.ExpiresAt = &t
+	}
+	if err := webpush.Save(ctx, db, &sub); err != nil {
+		logger.Error("push subscription save failed", zap.Error(err))
+		http.Error(w, "database insert error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// handleDeletePushSubscription unsubscribes one of the calling admin's
+// browsers.
+func handleDeletePushSubscription(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	adminID, _ := r.Context().Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid subscription id", http.StatusBadRequest)
+		return
+	}
+	found, err := webpush.Delete(r.Context(), db, adminID, id)
+	if err != nil {
+		http.Error(w, "database delete error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		httpx.WriteError(w, domain.NotFound("subscription not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,345 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/domain"
+	"server/internal/events"
+	"server/internal/httpx"
+	"server/internal/inventory"
+	"server/internal/ledger"
+	"server/internal/orders"
+	"server/internal/payments"
+
+	"go.uber.org/zap"
+)
+
+// Refund is a refund record as seen by admins.
+type Refund struct {
+	ID          int        `json:"id"`
+	OrderID     int        `json:"orderId"`
+	Amount      int        `json:"amount"`
+	Method      string     `json:"method"`
+	Status      string     `json:"status"` // REQUESTED, APPROVED, ISSUING, ISSUED
+	Reason      string     `json:"reason"`
+	ProviderRef *string    `json:"providerRef,omitempty"`
+	Partial     bool       `json:"partial"` // for lines the shop could not supply; the order stays PAID
+	CreatedAt   time.Time  `json:"createdAt"`
+	ApprovedAt  *time.Time `json:"approvedAt,omitempty"`
+	IssuedAt    *time.Time `json:"issuedAt,omitempty"`
+}
+
+type cancelOrderRequest struct {
+	Reason       string `json:"reason" validate:"max=500"`
+	RefundMethod string `json:"refundMethod" validate:"required,oneof=WALLET MOBILE_MONEY"` // defaults to MOBILE_MONEY
+}
+
+const refundColumns = `id, order_id, amount, method, status, reason, provider_ref, partial, created_at, approved_at, issued_at`
+
+func scanRefund(row interface{ Scan(...interface{}) error }, rf *Refund) error {
+	return row.Scan(&rf.ID, &rf.OrderID, &rf.Amount, &rf.Method, &rf.Status, &rf.Reason,
+		&rf.ProviderRef, &rf.Partial, &rf.CreatedAt, &rf.ApprovedAt, &rf.IssuedAt)
+}
+
+// handleCancelOrder cancels any order on behalf of the customer. Paid orders
+// get a REQUESTED refund for their full total, to be approved and issued.
+func handleCancelOrder(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
+	ctx := r.Context()
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	req := cancelOrderRequest{RefundMethod: payments.MethodMobileMoney}
+	if r.ContentLength != 0 {
+		if !httpx.DecodeJSON(w, r, &req) {
+			return
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("failed to begin transaction", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		userID, version, totalCost int
+		status, paymentStatus      string
+	)
+	if err := tx.QueryRowContext(ctx,
+		`SELECT user_id, status, version, total_cost, payment_status FROM orders WHERE id=$1`, orderID,
+	).Scan(&userID, &status, &version, &totalCost, &paymentStatus); err == sql.ErrNoRows {
+		httpx.WriteError(w, domain.NotFound("order not found"))
+		return
+	} else if err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if !orders.CanTransition(status, "CANCELLED") {
+		http.Error(w, "order cannot be cancelled", http.StatusBadRequest)
+		return
+	}
+
+	if err := orders.UpdateStatus(ctx, tx, orderID, version, "CANCELLED"); err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to cancel order", zap.Error(err))
+		}
+		return
+	}
+	if err := orders.RecordStatusChange(ctx, tx, orderID, "CANCELLED"); err != nil {
+		logger.Error("failed to record order status", zap.Error(err))
+		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
+		return
+	}
+	if err := ledger.RecordCancellation(ctx, tx, orderID); err != nil {
+		logger.Error("failed to record ledger entries", zap.Error(err))
+		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
+		return
+	}
+	if err := inventory.Release(ctx, tx, orderID); err != nil {
+		logger.Error("failed to release stock", zap.Error(err))
+		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
+		return
+	}
+
+	repriced, err := orders.RetierAfterCancel(ctx, tx, userID, orderID)
+	if err != nil {
+		logger.Error("failed to re-tier transport fees", zap.Int("order_id", orderID), zap.Error(err))
+		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
+		return
+	}
+
+	var refund *Refund
+	if paymentStatus == "PAID" && totalCost > 0 {
+		refund = &Refund{}
+		if err := scanRefund(tx.QueryRowContext(ctx,
+			`INSERT INTO refunds (order_id, amount, method, reason) VALUES ($1, $2, $3, $4)
+			 RETURNING `+refundColumns,
+			orderID, totalCost, req.RefundMethod, req.Reason,
+		), refund); err != nil {
+			logger.Error("failed to create refund", zap.Int("order_id", orderID), zap.Error(err))
+			http.Error(w, "failed to create refund", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error("transaction commit failed", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	orders.PublishStatus(ctx, bus, logger, orders.StatusEvent{UserID: userID, OrderID: orderID, Status: "CANCELLED"})
+	orders.PublishRepriced(ctx, bus, logger, repriced)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		OrderID int     `json:"orderId"`
+		Status  string  `json:"status"`
+		Refund  *Refund `json:"refund,omitempty"`
+	}{orderID, "CANCELLED", refund})
+}
+
+// handleListRefunds returns refunds, newest first, optionally filtered by status.
+func handleListRefunds(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+
+	where, args := "", []interface{}{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		where = "WHERE status = $1"
+		args = append(args, status)
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM refunds "+where, args...).Scan(&total); err != nil {
+		logger.Error("admin refunds count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	query := fmt.Sprintf("SELECT %s FROM refunds %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d",
+		refundColumns, where, len(args)+1, len(args)+2)
+	rows, err := db.QueryContext(ctx, query, append(args, page.Limit, page.Offset())...)
+	if err != nil {
+		logger.Error("admin refunds query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var refunds []Refund
+	for rows.Next() {
+		var rf Refund
+		if err := scanRefund(rows, &rf); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		refunds = append(refunds, rf)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	httpx.WritePage(w, page, total, refunds)
+}
+
+// handleApproveRefund moves a REQUESTED refund to APPROVED.
+func handleApproveRefund(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid refund id", http.StatusBadRequest)
+		return
+	}
+
+	var rf Refund
+	err = scanRefund(db.QueryRowContext(ctx,
+		`UPDATE refunds SET status='APPROVED', approved_at=NOW()
+		  WHERE id=$1 AND status='REQUESTED'
+		 RETURNING `+refundColumns, id,
+	), &rf)
+	if err == sql.ErrNoRows {
+		http.Error(w, "refund not found or not awaiting approval", http.StatusConflict)
+		return
+	} else if err != nil {
+		logger.Error("failed to approve refund", zap.Int("refund_id", id), zap.Error(err))
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rf)
+}
+
+// handleIssueRefund pays out an APPROVED refund through the payments provider
+// and, unless the refund is partial, marks the order REFUNDED.
+//
+// The refund is committed as ISSUING before the provider is called and only
+// marked ISSUED in a second transaction, so the payout never waits on a
+// database transaction. If anything fails after the claim the refund stays
+// ISSUING and the admin retries; the provider is idempotent on the refund ID,
+// so a retry returns the first transfer's reference instead of paying twice.
+func handleIssueRefund(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, payer payments.Provider) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid refund id", http.StatusBadRequest)
+		return
+	}
+
+	rf, userID, err := claimRefund(ctx, db, id)
+	if errors.Is(err, domain.ErrNotFound) || errors.Is(err, domain.ErrConflict) {
+		httpx.WriteError(w, err)
+		return
+	} else if err != nil {
+		logger.Error("failed to claim refund", zap.Int("refund_id", id), zap.Error(err))
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	ref, err := payer.Refund(ctx, payments.RefundRequest{
+		RefundID: rf.ID, OrderID: rf.OrderID, UserID: userID, Amount: rf.Amount, Method: rf.Method,
+	})
+	if err != nil {
+		logger.Error("refund payout failed", zap.Int("refund_id", id), zap.Error(err))
+		http.Error(w, "payments provider error", http.StatusBadGateway)
+		return
+	}
+
+	if err := finishRefund(ctx, db, &rf, ref); errors.Is(err, domain.ErrConflict) {
+		httpx.WriteError(w, err)
+		return
+	} else if err != nil {
+		logger.Error("refund paid out but not recorded; retry to finish it",
+			zap.Int("refund_id", id), zap.String("provider_ref", ref), zap.Error(err))
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rf)
+}
+
+// claimRefund commits an APPROVED refund as ISSUING and returns it with the
+// ordering student's ID. A refund already ISSUING is returned as is, so a
+// payout that failed part way can be retried.
+func claimRefund(ctx context.Context, db *sql.DB, id int) (rf Refund, userID int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return rf, 0, err
+	}
+	defer tx.Rollback()
+
+	if err := scanRefund(tx.QueryRowContext(ctx,
+		`SELECT `+refundColumns+` FROM refunds WHERE id=$1 FOR UPDATE`, id,
+	), &rf); err == sql.ErrNoRows {
+		return rf, 0, domain.NotFound("refund not found")
+	} else if err != nil {
+		return rf, 0, fmt.Errorf("lock refund: %w", err)
+	}
+	if rf.Status != "APPROVED" && rf.Status != "ISSUING" {
+		return rf, 0, domain.Conflict("refund must be APPROVED before it is issued")
+	}
+	if err := tx.QueryRowContext(ctx, `SELECT user_id FROM orders WHERE id=$1`, rf.OrderID).Scan(&userID); err != nil {
+		return rf, 0, fmt.Errorf("look up order: %w", err)
+	}
+	if err := scanRefund(tx.QueryRowContext(ctx,
+		`UPDATE refunds SET status='ISSUING' WHERE id=$1 RETURNING `+refundColumns, id,
+	), &rf); err != nil {
+		return rf, 0, fmt.Errorf("mark refund issuing: %w", err)
+	}
+	return rf, userID, tx.Commit()
+}
+
+// finishRefund records a paid-out ISSUING refund as ISSUED under the
+// provider's reference ref, marks a full refund's order REFUNDED and books
+// the refund in the ledger. It updates rf in place.
+func finishRefund(ctx context.Context, db *sql.DB, rf *Refund, ref string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := scanRefund(tx.QueryRowContext(ctx,
+		`UPDATE refunds SET status='ISSUED', provider_ref=$2, issued_at=NOW()
+		  WHERE id=$1 AND status='ISSUING'
+		 RETURNING `+refundColumns, rf.ID, ref,
+	), rf); err == sql.ErrNoRows {
+		return domain.Conflict("refund was already issued")
+	} else if err != nil {
+		return fmt.Errorf("mark refund issued: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE orders SET payment_status='REFUNDED' WHERE id=$1 AND NOT $2`, rf.OrderID, rf.Partial,
+	); err != nil {
+		return fmt.Errorf("mark order refunded: %w", err)
+	}
+	receipt, err := ledger.ReceiptNumber(ctx, tx, rf.OrderID)
+	if err == nil {
+		err = ledger.Append(ctx, tx, ledger.Entry{
+			OrderID: rf.OrderID, ReceiptNumber: receipt, Type: ledger.TypeRefund, Amount: -rf.Amount,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("record ledger entries: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,193 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/email"
+	"server/internal/httpx"
+	"server/internal/orders"
+
+	"go.uber.org/zap"
+)
+
+// ResendRequest is the body of POST /admin/emails/resend.
+type ResendRequest struct {
+	Type string `json:"type" validate:"required,oneof=verification order_confirmation password_reset"`
+	// Target is the account's email address, or the order id for an order
+	// confirmation.
+	Target string `json:"target" validate:"required,max=254"`
+}
+
+// notApplicableError marks a target the email no longer makes sense for,
+// e.g. verifying an already verified account.
+type notApplicableError struct{ reason string }
+
+func (e notApplicableError) Error() string { return e.reason }
+
+// handleResendEmail re-renders a transactional email from current data and
+// sends it again, recording who asked for it in the audit log.
+func handleResendEmail(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, mailer *email.Client) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+
+	var req ResendRequest
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+	target := strings.TrimSpace(req.Target)
+
+	var recipient string
+	var err error
+	switch req.Type {
+	case "verification":
+		recipient, err = resendVerification(ctx, db, mailer, target)
+	case "password_reset":
+		recipient, err = resendPasswordReset(ctx, db, mailer, target)
+	case "order_confirmation":
+		recipient, err = resendOrderConfirmation(ctx, db, mailer, target)
+	}
+
+	outcome := "sent"
+	var notApplicable notApplicableError
+	switch {
+	case err == sql.ErrNoRows:
+		httpx.WriteError(w, domain.NotFound("no such "+targetNoun(req.Type)))
+		return
+	case errors.As(err, &notApplicable):
+		http.Error(w, notApplicable.reason, http.StatusConflict)
+		return
+	case errors.Is(err, email.ErrSuppressed):
+		outcome = "suppressed"
+	case err != nil:
+		outcome = "failed"
+		logger.Error("failed to resend email", zap.String("type", req.Type), zap.String("target", target), zap.Error(err))
+	}
+
+	if err := recordAudit(ctx, db, adminID, "email.resend", target, map[string]string{
+		"type": req.Type, "recipient": recipient, "outcome": outcome,
+	}); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	logger.Info("admin resent email", zap.Int("admin_id", adminID), zap.String("type", req.Type),
+		zap.String("target", target), zap.String("outcome", outcome))
+
+	switch outcome {
+	case "suppressed":
+		http.Error(w, "recipient is suppressed after a bounce or complaint; lift the suppression first", http.StatusConflict)
+		return
+	case "failed":
+		http.Error(w, "failed to send email", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Type      string `json:"type"`
+		Recipient string `json:"recipient"`
+	}{req.Type, recipient})
+}
+
+func targetNoun(kind string) string {
+	if kind == "order_confirmation" {
+		return "order"
+	}
+	return "account"
+}
+
+// resendVerification sends an unverified account its verification link
+// again, reusing a token that is still valid so an earlier email keeps
+// working, or issuing a new one valid for auth.VerificationTTL.
+func resendVerification(ctx context.Context, db *sql.DB, mailer *email.Client, addr string) (string, error) {
+	var id int
+	var username string
+	var verified bool
+	if err := db.QueryRowContext(ctx,
+		`SELECT id, username, verified FROM users WHERE LOWER(email) = LOWER($1)`, addr,
+	).Scan(&id, &username, &verified); err != nil {
+		return "", err
+	}
+	if verified {
+		return "", notApplicableError{"account is already verified"}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	var to, current string
+	if err := db.QueryRowContext(ctx,
+		`UPDATE users
+		    SET verification_token = CASE WHEN verification_expires > NOW() THEN verification_token ELSE $1 END,
+		        verification_expires = CASE WHEN verification_expires > NOW() THEN verification_expires ELSE $2 END
+		  WHERE id = $3
+		 RETURNING email, verification_token`,
+		token, time.Now().Add(auth.VerificationTTL), id,
+	).Scan(&to, &current); err != nil {
+		return "", err
+	}
+	return to, mailer.SendVerificationEmail(to, username, current)
+}
+
+// resendPasswordReset sends the account's reset link again, reusing a token
+// that is still valid so an earlier email keeps working, or issuing a new one
+// valid for an hour like the public endpoint does.
+func resendPasswordReset(ctx context.Context, db *sql.DB, mailer *email.Client, addr string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	var to, username, current string
+	if err := db.QueryRowContext(ctx,
+		`UPDATE users
+		    SET reset_token = CASE WHEN reset_expires > NOW() THEN reset_token ELSE $1 END,
+		        reset_expires = CASE WHEN reset_expires > NOW() THEN reset_expires ELSE $2 END
+		  WHERE LOWER(email) = LOWER($3)
+		 RETURNING email, username, reset_token`,
+		token, time.Now().Add(time.Hour), addr,
+	).Scan(&to, &username, &current); err != nil {
+		return "", err
+	}
+	return to, mailer.SendResetPasswordEmail(to, username, current)
+}
+
+// resendOrderConfirmation sends the confirmation of a confirmed or fulfilled
+// order as it stands now.
+func resendOrderConfirmation(ctx context.Context, db *sql.DB, mailer *email.Client, target string) (string, error) {
+	orderID, err := strconv.Atoi(strings.TrimPrefix(target, "#"))
+	if err != nil {
+		return "", notApplicableError{"target must be an order id for order confirmations"}
+	}
+	var userID int
+	var status string
+	if err := db.QueryRowContext(ctx,
+		`SELECT user_id, status FROM orders WHERE id = $1`, orderID,
+	).Scan(&userID, &status); err != nil {
+		return "", err
+	}
+	if status != "CONFIRMED" && status != "PACKED" && status != "FULFILLED" {
+		return "", notApplicableError{"order is " + strings.ToLower(status) + ", not confirmed"}
+	}
+	user, err := auth.LoadUser(ctx, db, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Email, orders.SendConfirmationEmail(ctx, db, mailer, userID, orderID, "")
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
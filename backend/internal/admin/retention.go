@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/locale"
+
+	"go.uber.org/zap"
+)
+
+// Retention cohorts: how many weeks of them by default, and at most.
+const (
+	defaultCohortWeeks = 12
+	maxCohortWeeks     = 52
+)
+
+// Cohort is the students whose first order fell in one week, and how many
+// of them ordered again in each week since.
+type Cohort struct {
+	Week   string    `json:"week"`   // Monday, YYYY-MM-DD, Kampala time
+	Size   int       `json:"size"`   // students whose first order was that week
+	Active []int     `json:"active"` // [k]: of them, how many ordered k weeks later
+	Rates  []float64 `json:"rates"`  // [k]: Active[k] / Size, to 3 places; [0] is 1
+}
+
+// handleRetention returns weekly first-order cohorts from the last ?weeks
+// (default 12, at most 52) weeks, archived orders included, each with its
+// repeat-order rate in every week since, as a triangular matrix: the
+// newest cohort has one column, the oldest one per week.
+func handleRetention(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	weeks := defaultCohortWeeks
+	if s := r.URL.Query().Get("weeks"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxCohortWeeks {
+			http.Error(w, "weeks must be 1 to 52", http.StatusBadRequest)
+			return
+		}
+		weeks = n
+	}
+	local := time.Now().In(locale.EAT)
+	thisWeek := time.Date(local.Year(), local.Month(), local.Day()-(int(local.Weekday())+6)%7, 0, 0, 0, 0, locale.EAT)
+	first := thisWeek.AddDate(0, 0, -7*(weeks-1))
+
+	// Each student's ordering weeks, the first of which is their cohort
+	rows, err := db.QueryContext(r.Context(),
+		`WITH weekly AS (
+		   SELECT DISTINCT user_id, date_trunc('week', created_at AT TIME ZONE 'Africa/Kampala')::date AS week
+		     FROM all_orders
+		    WHERE status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		 ), cohorts AS (
+		   SELECT user_id, week, MIN(week) OVER (PARTITION BY user_id) AS cohort FROM weekly
+		 )
+		 SELECT cohort, (week - cohort) / 7, COUNT(*)
+		   FROM cohorts
+		  WHERE cohort >= $1::date
+		  GROUP BY 1, 2
+		  ORDER BY 1, 2`,
+		first.Format("2006-01-02"),
+	)
+	if err != nil {
+		logger.Error("retention query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	cohorts := make([]Cohort, weeks)
+	index := make(map[string]int, weeks)
+	for i := range cohorts {
+		week := first.AddDate(0, 0, 7*i).Format("2006-01-02")
+		cohorts[i] = Cohort{Week: week, Active: make([]int, weeks-i)}
+		index[week] = i
+	}
+	for rows.Next() {
+		var week time.Time
+		var offset, n int
+		if err := rows.Scan(&week, &offset, &n); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		i, ok := index[week.Format("2006-01-02")]
+		if !ok || offset >= len(cohorts[i].Active) {
+			continue // a week that began since thisWeek was worked out
+		}
+		cohorts[i].Active[offset] = n
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+	for i := range cohorts {
+		c := &cohorts[i]
+		c.Size = c.Active[0]
+		c.Rates = make([]float64, len(c.Active))
+		for k, n := range c.Active {
+			if c.Size > 0 {
+				c.Rates[k] = math.Round(1000*float64(n)/float64(c.Size)) / 1000
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Cohorts []Cohort `json:"cohorts"` // oldest first
+	}{cohorts})
+}
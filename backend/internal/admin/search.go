@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// maxSearchTerms bounds the query size; support searches are a few words.
+const maxSearchTerms = 8
+
+// OrderSearchResult is an order matching a search, best matches first.
+type OrderSearchResult struct {
+	OrderSummary
+	ReceiptNumber string   `json:"receiptNumber,omitempty"`
+	Items         []string `json:"items"`
+	Score         int      `json:"score"`
+}
+
+// Points per term, so an order-number hit outranks a user hit, which
+// outranks an item-name hit.
+const (
+	scoreOrderID   = 100
+	scoreUserExact = 50
+	scoreUserFuzzy = 20
+	scoreItemFuzzy = 10
+)
+
+// searchTerms splits q into lowercase words, dropping a leading "#" from
+// order numbers.
+func searchTerms(q string) []string {
+	var terms []string
+	for _, f := range strings.Fields(strings.ToLower(q)) {
+		f = strings.TrimPrefix(f, "#")
+		if f == "" {
+			continue
+		}
+		terms = append(terms, f)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\%_`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// handleSearchOrders finds orders by order id or receipt number, customer
+// email or username, and item names. Each word of ?q= scores on its own and
+// results are ranked by total score, then recency, so "nido milk alice"
+// surfaces Alice's Nido order first. Optional ?status= and ?date=YYYY-MM-DD
+// narrow the results.
+func handleSearchOrders(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+
+	terms := searchTerms(r.URL.Query().Get("q"))
+	if len(terms) == 0 {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var scores []string
+	for _, t := range terms {
+		exact, pattern := arg(t), arg("%"+escapeLike(t)+"%")
+		scores = append(scores, fmt.Sprintf(`
+			CASE WHEN o.id::text = %[1]s OR LOWER(COALESCE(o.receipt_number, '')) = %[1]s THEN %[3]d ELSE 0 END
+			+ CASE WHEN LOWER(u.email) = %[1]s OR LOWER(u.username) = %[1]s THEN %[4]d
+			       WHEN u.email ILIKE %[2]s OR u.username ILIKE %[2]s THEN %[5]d ELSE 0 END
+			+ CASE WHEN EXISTS (
+			         SELECT 1 FROM order_items oi JOIN items i ON i.id = oi.item_id
+			          WHERE oi.order_id = o.id AND i.name ILIKE %[2]s
+			       ) THEN %[6]d ELSE 0 END`,
+			exact, pattern, scoreOrderID, scoreUserExact, scoreUserFuzzy, scoreItemFuzzy))
+	}
+
+	filters := []string{"TRUE"}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filters = append(filters, "o.status = "+arg(status))
+	}
+	if date, err := time.Parse("2006-01-02", r.URL.Query().Get("date")); err == nil {
+		filters = append(filters, fmt.Sprintf("o.created_at >= %s AND o.created_at < %s", arg(date), arg(date.Add(24*time.Hour))))
+	}
+
+	scored := fmt.Sprintf(`
+		SELECT o.id, o.user_id, u.username, o.status, o.transport_fee, o.total_cost, o.off_network, o.note, o.created_at,
+		       COALESCE(o.receipt_number, '') AS receipt_number,
+		       (%s) AS score
+		  FROM orders o
+		  JOIN users u ON u.id = o.user_id
+		 WHERE %s`,
+		strings.Join(scores, " + "), strings.Join(filters, " AND "))
+
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+scored+`) s WHERE s.score > 0`, args...).Scan(&total); err != nil {
+		logger.Error("admin order search count failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
+	page := httpx.ParsePage(r)
+	query := `SELECT * FROM (` + scored + `) s WHERE s.score > 0
+		ORDER BY s.score DESC, s.created_at DESC
+		LIMIT ` + arg(page.Limit) + ` OFFSET ` + arg(page.Offset())
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Error("admin order search failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	results := []OrderSearchResult{}
+	for rows.Next() {
+		var o OrderSearchResult
+		if err := rows.Scan(&o.ID, &o.UserID, &o.Username, &o.Status, &o.TransportFee, &o.TotalCost, &o.OffNetwork, &o.Note, &o.CreatedAt,
+			&o.ReceiptNumber, &o.Score); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		results = append(results, o)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+	rows.Close()
+
+	// Item names let support recognise the order without opening it
+	for i := range results {
+		names, err := orderItemNames(r, db, results[i].ID)
+		if err != nil {
+			logger.Error("admin order search items failed", zap.Error(err))
+			http.Error(w, "database query error", http.StatusInternalServerError)
+			return
+		}
+		results[i].Items = names
+	}
+
+	httpx.WritePage(w, page, total, results)
+}
+
+func orderItemNames(r *http.Request, db *sql.DB, orderID int) ([]string, error) {
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT i.name FROM order_items oi JOIN items i ON i.id = oi.item_id WHERE oi.order_id = $1 ORDER BY oi.id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
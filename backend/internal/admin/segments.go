@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"server/internal/auth"
+	"server/internal/segments"
+
+	"go.uber.org/zap"
+)
+
+// handleListSegments returns each segment's size and when it was computed.
+func handleListSegments(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	counts, err := segments.Counts(r.Context(), db)
+	if err != nil {
+		logger.Error("segment counts query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// handleRefreshSegments recomputes the segments now instead of waiting for
+// the nightly refresh, e.g. just before starting a campaign to one.
+func handleRefreshSegments(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+
+	counts, err := segments.Refresh(ctx, db)
+	if err != nil {
+		logger.Error("user segment refresh failed", zap.Error(err))
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "segments.refresh", "", counts); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
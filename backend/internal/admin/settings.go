@@ -0,0 +1,210 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+
+	"server/internal/catalog"
+)
+
+// Setting types.
+const (
+	settingInteger = "integer"
+	settingBoolean = "boolean"
+	settingString  = "string"
+	settingEnum    = "enum"
+)
+
+// Setting describes one /admin/config key: its type, its allowed values, and
+// what it does. GET /admin/config/schema serves these so the admin panel can
+// render a form for them rather than a free-form JSON editor.
+type Setting struct {
+	Key         string          `json:"key"`
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Default     json.RawMessage `json:"default"`
+	Minimum     *int            `json:"minimum,omitempty"`
+	Maximum     *int            `json:"maximum,omitempty"`
+	MaxLength   int             `json:"maxLength,omitempty"`
+	Format      string          `json:"format,omitempty"` // "email" or "time" (HH:MM)
+	Options     []string        `json:"options,omitempty"`
+}
+
+func bound(n int) *int { return &n }
+
+// settings is every key /admin/config accepts, in the order the panel shows
+// them.
+var settings = []Setting{
+	{Key: "pricing.transport_fee_tier1", Type: settingInteger, Default: json.RawMessage(`1000`),
+		Description: "Transport fee in UGX for a student's first orders of the day",
+		Minimum:     bound(0), Maximum: bound(50000)},
+	{Key: "pricing.transport_fee_tier2", Type: settingInteger, Default: json.RawMessage(`2000`),
+		Description: "Transport fee in UGX once a student passes the first tier",
+		Minimum:     bound(0), Maximum: bound(50000)},
+	{Key: "pricing.transport_fee_tier3", Type: settingInteger, Default: json.RawMessage(`3000`),
+		Description: "Transport fee in UGX once a student passes the second tier",
+		Minimum:     bound(0), Maximum: bound(50000)},
+	{Key: "pricing.tier1_orders", Type: settingInteger, Default: json.RawMessage(`3`),
+		Description: "Orders a day charged the first tier's fee",
+		Minimum:     bound(1), Maximum: bound(20)},
+	{Key: "pricing.tier2_orders", Type: settingInteger, Default: json.RawMessage(`6`),
+		Description: "Orders a day, counting the first tier's, charged at most the second tier's fee",
+		Minimum:     bound(1), Maximum: bound(50)},
+	{Key: "inventory.low_stock_threshold", Type: settingInteger, Default: json.RawMessage(`5`),
+		Description: "Stock level below which admins are emailed, for items without their own threshold",
+		Minimum:     bound(0), Maximum: bound(1000)},
+	{Key: "orders.pickup_time", Type: settingString, Default: json.RawMessage(`"18:00"`),
+		Description: "Daily pickup time shown to students",
+		Format:      "time"},
+	{Key: "orders.prep_start", Type: settingString, Default: json.RawMessage(`"17:00"`),
+		Description: "Time packing starts for the day's pickup, for the ready times shown to students",
+		Format:      "time"},
+	{Key: "orders.prep_minutes", Type: settingInteger, Default: json.RawMessage(`5`),
+		Description: "Minutes it takes to pack one order, for the ready times shown to students",
+		Minimum:     bound(1), Maximum: bound(60)},
+	{Key: "orders.eta_window_minutes", Type: settingInteger, Default: json.RawMessage(`20`),
+		Description: "Width of the ready-time range shown to students, in minutes",
+		Minimum:     bound(5), Maximum: bound(120)},
+	{Key: "orders.cutoff_reminders", Type: settingBoolean, Default: json.RawMessage(`true`),
+		Description: "Remind students with an unconfirmed chat draft before the 17:00 cutoff, by email and push"},
+	{Key: "orders.cutoff_reminder_minutes", Type: settingInteger, Default: json.RawMessage(`30`),
+		Description: "How many minutes before the cutoff the reminder goes out",
+		Minimum:     bound(5), Maximum: bound(240)},
+	{Key: "chat.enabled", Type: settingBoolean, Default: json.RawMessage(`true`),
+		Description: "Whether students can order through the chat"},
+	{Key: "chat.language", Type: settingEnum, Default: json.RawMessage(`"en"`),
+		Description: "Language the chat greets new students in",
+		Options:     []string{"en", "lg", "sw"}},
+	{Key: "chat.assistant_name", Type: settingString, Default: json.RawMessage(`"JAJ"`),
+		Description: "Name the chat assistant introduces itself by",
+		MaxLength:   40},
+	{Key: "chat.greeting", Type: settingString, Default: json.RawMessage(`""`),
+		Description: "Greeting the chat opens with; {{.Name}} is the assistant's name. Empty uses the tone's own greeting",
+		MaxLength:   300},
+	{Key: "chat.tone", Type: settingEnum, Default: json.RawMessage(`"casual"`),
+		Description: "Tone of the assistant's replies: formal, casual, or Luglish (English mixed with Luganda)",
+		Options:     []string{"formal", "casual", "luglish"}},
+	{Key: "chat.llm_log_percent", Type: settingInteger, Default: json.RawMessage(`0`),
+		Description: "Percent of LLM calls whose prompt and reply are kept for debugging; 0 keeps none",
+		Minimum:     bound(0), Maximum: bound(100)},
+	{Key: "chat.llm_log_days", Type: settingInteger, Default: json.RawMessage(`7`),
+		Description: "Days logged LLM calls are kept",
+		Minimum:     bound(1), Maximum: bound(90)},
+	{Key: "retention.chat_turns_days", Type: settingInteger, Default: json.RawMessage(`180`),
+		Description: "Days chat transcripts are kept; 0 keeps them forever",
+		Minimum:     bound(0), Maximum: bound(3650)},
+	{Key: "retention.sessions_days", Type: settingInteger, Default: json.RawMessage(`30`),
+		Description: "Days expired sessions are kept; 0 keeps them forever",
+		Minimum:     bound(0), Maximum: bound(3650)},
+	{Key: "retention.audit_log_days", Type: settingInteger, Default: json.RawMessage(`730`),
+		Description: "Days admin audit log entries are kept; 0 keeps them forever",
+		Minimum:     bound(0), Maximum: bound(3650)},
+	{Key: "retention.email_log_days", Type: settingInteger, Default: json.RawMessage(`365`),
+		Description: "Days the record of each email sent is kept; 0 keeps them forever",
+		Minimum:     bound(0), Maximum: bound(3650)},
+	{Key: "alerts.window_minutes", Type: settingInteger, Default: json.RawMessage(`5`),
+		Description: "Minutes of metrics each alert rule is measured over",
+		Minimum:     bound(1), Maximum: bound(60)},
+	{Key: "alerts.error_rate_percent", Type: settingInteger, Default: json.RawMessage(`5`),
+		Description: "Percent of HTTP responses that are 5xx errors at which admins are alerted; 0 disables",
+		Minimum:     bound(0), Maximum: bound(100)},
+	{Key: "alerts.email_failure_percent", Type: settingInteger, Default: json.RawMessage(`20`),
+		Description: "Percent of emails failing to send at which admins are alerted; 0 disables",
+		Minimum:     bound(0), Maximum: bound(100)},
+	{Key: "alerts.db_pool_percent", Type: settingInteger, Default: json.RawMessage(`90`),
+		Description: "Average percent of database connections in use at which admins are alerted; 0 disables",
+		Minimum:     bound(0), Maximum: bound(100)},
+	{Key: "alerts.llm_failure_percent", Type: settingInteger, Default: json.RawMessage(`25`),
+		Description: "Percent of LLM calls failing at which admins are alerted; 0 disables",
+		Minimum:     bound(0), Maximum: bound(100)},
+	{Key: "app.maintenance_mode", Type: settingBoolean, Default: json.RawMessage(`false`),
+		Description: "Show a maintenance page instead of the shop"},
+	{Key: "support.contact_email", Type: settingString, Default: json.RawMessage(`""`),
+		Description: "Address shown to students for help",
+		Format:      "email", MaxLength: 254},
+}
+
+// timePattern is a 24-hour HH:MM time.
+var timePattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// lookupSetting returns the schema for key.
+func lookupSetting(key string) (Setting, bool) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// unknownSettingMessage explains an unknown key, suggesting the closest
+// known one when the key looks like a typo of it.
+func unknownSettingMessage(key string) string {
+	best, bestDist := "", 4
+	for _, s := range settings {
+		if d := catalog.EditDistance(strings.ToLower(key), s.Key); d < bestDist {
+			best, bestDist = s.Key, d
+		}
+	}
+	if best != "" {
+		return fmt.Sprintf("is not a known setting; did you mean %q?", best)
+	}
+	return "is not a known setting; see GET /admin/config/schema"
+}
+
+// validate checks value against s and returns it re-encoded compactly, or
+// a message for the "value" field.
+func (s Setting) validate(value json.RawMessage) (json.RawMessage, string) {
+	switch s.Type {
+	case settingInteger:
+		var f float64
+		if err := json.Unmarshal(value, &f); err != nil || f != float64(int(f)) {
+			return nil, "must be a whole number"
+		}
+		n := int(f)
+		if (s.Minimum != nil && n < *s.Minimum) || (s.Maximum != nil && n > *s.Maximum) {
+			return nil, fmt.Sprintf("must be between %d and %d", *s.Minimum, *s.Maximum)
+		}
+		return json.RawMessage(fmt.Sprint(n)), ""
+
+	case settingBoolean:
+		var b bool
+		if err := json.Unmarshal(value, &b); err != nil {
+			return nil, "must be true or false"
+		}
+		return json.RawMessage(fmt.Sprint(b)), ""
+
+	case settingString, settingEnum:
+		var str string
+		if err := json.Unmarshal(value, &str); err != nil {
+			return nil, "must be a string"
+		}
+		str = strings.TrimSpace(str)
+		switch {
+		case s.Type == settingEnum && !slices.Contains(s.Options, str):
+			return nil, "must be one of " + strings.Join(s.Options, ", ")
+		case s.MaxLength > 0 && len(str) > s.MaxLength:
+			return nil, fmt.Sprintf("must be at most %d characters", s.MaxLength)
+		case s.Format == "time" && !timePattern.MatchString(str):
+			return nil, "must be a 24-hour time such as 18:00"
+		case s.Format == "email" && str != "":
+			if addr, err := mail.ParseAddress(str); err != nil || addr.Address != str {
+				return nil, "must be an email address"
+			}
+		}
+		out, _ := json.Marshal(str)
+		return out, ""
+	}
+	return nil, "has an unknown type"
+}
+
+// handleConfigSchema serves the settings schema.
+func handleConfigSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
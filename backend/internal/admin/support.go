@@ -0,0 +1,126 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/email"
+	"server/internal/httpx"
+	"server/internal/support"
+
+	"go.uber.org/zap"
+)
+
+// TicketStatus is the body of PUT /admin/support/tickets/{id}/status.
+type TicketStatus struct {
+	Status string `json:"status" validate:"required,oneof=OPEN ANSWERED RESOLVED"`
+}
+
+// handleSupportQueue lists support tickets, open ones first and the longest
+// waiting at the top, optionally only those in ?status.
+func handleSupportQueue(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	page := httpx.ParsePage(r)
+	tickets, total, err := support.Queue(r.Context(), db, r.URL.Query().Get("status"), page.Limit, page.Offset())
+	if err != nil {
+		logger.Error("support queue query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+	httpx.WritePage(w, page, total, tickets)
+}
+
+// handleSupportTicket returns a ticket with its whole conversation.
+func handleSupportTicket(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid ticket id", http.StatusBadRequest)
+		return
+	}
+	t, err := support.Get(r.Context(), db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("ticket not found"))
+		return
+	} else if err != nil {
+		logger.Error("support ticket query failed", zap.Int("ticket_id", id), zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// handleSupportReply answers a ticket as staff and emails the reply to the
+// customer. A failed email is logged; the reply is on the ticket either way.
+func handleSupportReply(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, mailer *email.Client) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid ticket id", http.StatusBadRequest)
+		return
+	}
+	var req support.Reply
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := support.AddMessage(ctx, db, id, adminID, true, req.Body); errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("ticket not found"))
+		return
+	} else if err != nil {
+		logger.Error("failed to add support reply", zap.Int("ticket_id", id), zap.Error(err))
+		http.Error(w, "failed to reply", http.StatusInternalServerError)
+		return
+	}
+
+	t, err := support.Get(ctx, db, id)
+	if err != nil {
+		logger.Error("support ticket query failed", zap.Int("ticket_id", id), zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if err := support.NotifyReply(ctx, db, mailer, t, req.Body); err != nil {
+		logger.Error("failed to email support reply", zap.Int("ticket_id", id), zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// handleSetTicketStatus resolves or reopens a ticket without a reply.
+func handleSetTicketStatus(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	adminID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid ticket id", http.StatusBadRequest)
+		return
+	}
+	var req TicketStatus
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := support.SetStatus(ctx, db, id, req.Status); errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("ticket not found"))
+		return
+	} else if err != nil {
+		logger.Error("failed to update support ticket", zap.Int("ticket_id", id), zap.Error(err))
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	if err := recordAudit(ctx, db, adminID, "support.status", strconv.Itoa(id), req); err != nil {
+		logger.Error("failed to record audit entry", zap.Error(err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
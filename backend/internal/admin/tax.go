@@ -0,0 +1,176 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"server/internal/httpx"
+	"server/internal/tax"
+
+	"go.uber.org/zap"
+)
+
+// CategoryTaxClass assigns a tax class to every item in a category.
+type CategoryTaxClass struct {
+	Category string `json:"category" validate:"required,max=50"`
+	TaxClass string `json:"taxClass" validate:"max=20"` // empty removes the assignment
+}
+
+// TaxSummary is the VAT collected at one rate over a period.
+type TaxSummary struct {
+	RateBps      int `json:"rateBps"`
+	TaxableSales int `json:"taxableSales"` // VAT-inclusive
+	TaxCollected int `json:"taxCollected"`
+}
+
+// handleListTaxClasses returns the tax classes and category assignments.
+func handleListTaxClasses(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+
+	classes := []tax.Class{}
+	rows, err := db.QueryContext(ctx, `SELECT code, name, rate_bps FROM tax_classes ORDER BY code`)
+	if err != nil {
+		logger.Error("tax classes query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c tax.Class
+		if err := rows.Scan(&c.Code, &c.Name, &c.RateBps); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		classes = append(classes, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	categories := []CategoryTaxClass{}
+	catRows, err := db.QueryContext(ctx, `SELECT category, tax_class FROM category_tax_classes ORDER BY category`)
+	if err != nil {
+		logger.Error("category tax classes query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer catRows.Close()
+	for catRows.Next() {
+		var c CategoryTaxClass
+		if err := catRows.Scan(&c.Category, &c.TaxClass); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		categories = append(categories, c)
+	}
+	if err := catRows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Classes    []tax.Class        `json:"classes"`
+		Categories []CategoryTaxClass `json:"categories"`
+	}{classes, categories})
+}
+
+// handleUpsertTaxClass creates or updates a tax class. Rate changes apply to
+// new orders only; existing order lines keep the rate they were taxed at.
+func handleUpsertTaxClass(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var c tax.Class
+	if !httpx.DecodeJSON(w, r, &c) {
+		return
+	}
+
+	const q = `INSERT INTO tax_classes (code, name, rate_bps) VALUES ($1, $2, $3)
+	           ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name, rate_bps = EXCLUDED.rate_bps`
+	if _, err := db.ExecContext(r.Context(), q, c.Code, c.Name, c.RateBps); err != nil {
+		http.Error(w, "database update error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSetCategoryTaxClass assigns (or, with an empty taxClass, clears) the
+// tax class of an item category.
+func handleSetCategoryTaxClass(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var c CategoryTaxClass
+	if !httpx.DecodeJSON(w, r, &c) {
+		return
+	}
+
+	var err error
+	if c.TaxClass == "" {
+		_, err = db.ExecContext(r.Context(), `DELETE FROM category_tax_classes WHERE category=$1`, c.Category)
+	} else {
+		_, err = db.ExecContext(r.Context(),
+			`INSERT INTO category_tax_classes (category, tax_class) VALUES ($1, $2)
+			 ON CONFLICT (category) DO UPDATE SET tax_class = EXCLUDED.tax_class`,
+			c.Category, c.TaxClass)
+	}
+	if err != nil {
+		http.Error(w, "database update error (unknown tax class?)", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTaxAnalytics aggregates VAT on confirmed and fulfilled orders created
+// in [from, to] (YYYY-MM-DD, inclusive), per rate, archived orders included.
+func handleTaxAnalytics(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	from, err := time.Parse("2006-01-02", r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "from must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse("2006-01-02", r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "to must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(),
+		`SELECT oi.tax_rate_bps, SUM(oi.quantity * oi.unit_price), SUM(oi.tax_amount)
+		   FROM all_order_items oi
+		   JOIN all_orders o ON o.id = oi.order_id
+		  WHERE o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		    AND o.created_at >= $1 AND o.created_at < $2
+		  GROUP BY oi.tax_rate_bps
+		  ORDER BY oi.tax_rate_bps DESC`,
+		from, to.Add(24*time.Hour),
+	)
+	if err != nil {
+		logger.Error("tax analytics query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	rates := []TaxSummary{}
+	totalTax := 0
+	for rows.Next() {
+		var t TaxSummary
+		if err := rows.Scan(&t.RateBps, &t.TaxableSales, &t.TaxCollected); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		totalTax += t.TaxCollected
+		rates = append(rates, t)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		From         string       `json:"from"`
+		To           string       `json:"to"`
+		Rates        []TaxSummary `json:"rates"`
+		TaxCollected int          `json:"taxCollected"`
+	}{from.Format("2006-01-02"), to.Format("2006-01-02"), rates, totalTax})
+}
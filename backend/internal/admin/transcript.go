@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// ChatTurn is one student message and the assistant's reply.
+type ChatTurn struct {
+	ID        int64     `json:"id"`
+	Intent    string    `json:"intent"`
+	Message   string    `json:"message"`
+	Reply     string    `json:"reply"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// handleOrderTranscript returns the chat turns linked to an order: the
+// message that created it and any that confirmed, cancelled, or raced it.
+func handleOrderTranscript(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	var resp struct {
+		OrderID  int        `json:"orderId"`
+		UserID   int        `json:"userId"`
+		Username string     `json:"username"`
+		Status   string     `json:"status"`
+		Turns    []ChatTurn `json:"turns"`
+	}
+	if err := db.QueryRowContext(ctx,
+		`SELECT o.id, o.user_id, u.username, o.status FROM orders o JOIN users u ON u.id = o.user_id WHERE o.id=$1`,
+		orderID,
+	).Scan(&resp.OrderID, &resp.UserID, &resp.Username, &resp.Status); err == sql.ErrNoRows {
+		httpx.WriteError(w, domain.NotFound("order not found"))
+		return
+	} else if err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, intent, message, reply, created_at FROM chat_turns WHERE order_id=$1 ORDER BY created_at, id`,
+		orderID,
+	)
+	if err != nil {
+		logger.Error("transcript query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	resp.Turns = []ChatTurn{}
+	for rows.Next() {
+		var t ChatTurn
+		if err := rows.Scan(&t.ID, &t.Intent, &t.Message, &t.Reply, &t.CreatedAt); err != nil {
+			http.Error(w, "row scan error", http.StatusInternalServerError)
+			return
+		}
+		resp.Turns = append(resp.Turns, t)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "row iteration error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,460 @@
+// Package alerts watches the server's own metrics for trouble: the HTTP 5xx
+// rate, the email failure rate, database pool saturation, and the LLM
+// failure rate, each over a sliding window. A rule over its threshold opens
+// an alert in the alerts table and emails and pushes to every admin; they
+// hear again when it clears. Thresholds and the window are admin settings,
+// so they can change without a deploy.
+//
+// Each server evaluates its own counters, which restart with it, so alerts
+// are per instance. SMS is not sent: there is no SMS gateway to send it
+// through, and admins who subscribe to web push get alerts on their phones.
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"server/internal/email"
+	"server/internal/locale"
+	"server/internal/monitoring"
+	"server/internal/webpush"
+
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// windowSetting is the config key holding the window in minutes.
+const windowSetting = "alerts.window_minutes"
+
+const (
+	defaultWindow = 5 * time.Minute
+	// staleAfter is how long an open alert may go without its instance
+	// evaluating it before any instance resolves it, e.g. after a redeploy
+	// retired the server.
+	staleAfter = 15 * time.Minute
+)
+
+// Rates need this many events in the window to mean anything; a single
+// failed request at 3am is not a 100% error rate.
+const (
+	minRequests = 20
+	minEmails   = 5
+	minLLMCalls = 5
+)
+
+// Rule is one condition alerted on. Its value is a percentage.
+type Rule struct {
+	Name    string  `json:"name"`
+	Summary string  `json:"summary"`
+	Setting string  `json:"setting"` // config key holding the threshold; 0 disables the rule
+	Default float64 `json:"default"`
+	measure func(window []sample) (float64, bool)
+}
+
+// Rules lists every rule evaluated.
+var Rules = []Rule{
+	{Name: "http_error_rate", Summary: "HTTP 5xx error rate",
+		Setting: "alerts.error_rate_percent", Default: 5, measure: errorRate},
+	{Name: "email_failure_rate", Summary: "Email failure rate",
+		Setting: "alerts.email_failure_percent", Default: 20, measure: emailFailureRate},
+	{Name: "db_pool_saturation", Summary: "Database connection pool use",
+		Setting: "alerts.db_pool_percent", Default: 90, measure: poolSaturation},
+	{Name: "llm_failure_rate", Summary: "LLM call failure rate",
+		Setting: "alerts.llm_failure_percent", Default: 25, measure: llmFailureRate},
+}
+
+// Summary describes the rule named name, or returns the name if there is
+// no such rule any more.
+func Summary(name string) string {
+	for _, r := range Rules {
+		if r.Name == name {
+			return r.Summary
+		}
+	}
+	return name
+}
+
+// Config is the window rules are measured over and each rule's threshold.
+type Config struct {
+	Window     time.Duration
+	Thresholds map[string]float64 // by rule name; 0 when disabled
+}
+
+// LoadConfig reads the window and thresholds, falling back to the defaults
+// for any unset or invalid.
+func LoadConfig(ctx context.Context, db *sql.DB) (Config, error) {
+	cfg := Config{Window: defaultWindow, Thresholds: make(map[string]float64, len(Rules))}
+	keys := []string{windowSetting}
+	rules := make(map[string]string, len(Rules)) // setting to rule name
+	for _, r := range Rules {
+		keys = append(keys, r.Setting)
+		rules[r.Setting] = r.Name
+		cfg.Thresholds[r.Name] = r.Default
+	}
+	rows, err := db.QueryContext(ctx, `SELECT key, value_json FROM config WHERE key = ANY($1)`, pq.Array(keys))
+	if err != nil {
+		return cfg, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var value json.RawMessage
+		var n float64
+		if err := rows.Scan(&key, &value); err != nil {
+			return cfg, err
+		}
+		if json.Unmarshal(value, &n) != nil || n < 0 {
+			continue
+		}
+		if key == windowSetting {
+			if n >= 1 {
+				cfg.Window = time.Duration(n) * time.Minute
+			}
+		} else {
+			cfg.Thresholds[rules[key]] = n
+		}
+	}
+	return cfg, rows.Err()
+}
+
+// Alert is one firing, open until ResolvedAt is set.
+type Alert struct {
+	ID         int64      `json:"id"`
+	Rule       string     `json:"rule"`
+	Summary    string     `json:"summary"`
+	Instance   string     `json:"instance"`
+	Value      float64    `json:"value"`     // latest, while open; percent
+	Threshold  float64    `json:"threshold"` // percent
+	StartedAt  time.Time  `json:"startedAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+}
+
+// List returns the open alerts, newest first, followed by those resolved
+// since resolvedSince.
+func List(ctx context.Context, db *sql.DB, resolvedSince time.Time) ([]Alert, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, rule, instance, value, threshold, started_at, updated_at, resolved_at
+		   FROM alerts
+		  WHERE resolved_at IS NULL OR resolved_at >= $1
+		  ORDER BY resolved_at DESC NULLS FIRST, started_at DESC`, resolvedSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Alert{}
+	for rows.Next() {
+		var a Alert
+		var resolved sql.NullTime
+		if err := rows.Scan(&a.ID, &a.Rule, &a.Instance, &a.Value, &a.Threshold, &a.StartedAt, &a.UpdatedAt, &resolved); err != nil {
+			return nil, err
+		}
+		a.Summary = Summary(a.Rule)
+		if resolved.Valid {
+			a.ResolvedAt = &resolved.Time
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// Evaluator measures the rules against this server's metrics.
+type Evaluator struct {
+	db        *sql.DB // the primary: alerts are written to it and its pool watched
+	logger    *zap.Logger
+	mailer    *email.Client
+	pusher    *webpush.Sender // optional
+	instance  string
+	responses *prometheus.CounterVec
+	emails    *prometheus.CounterVec
+	llm       *prometheus.HistogramVec
+	history   []sample // oldest first; the first is the window's baseline
+}
+
+// NewEvaluator returns an evaluator of m's counters and db's pool, which
+// notifies admins through mailer and, if not nil, pusher.
+func NewEvaluator(db *sql.DB, logger *zap.Logger, mailer *email.Client, pusher *webpush.Sender, m *monitoring.Metrics) *Evaluator {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "unknown"
+	}
+	return &Evaluator{
+		db: db, logger: logger, mailer: mailer, pusher: pusher, instance: host,
+		responses: m.Responses, emails: m.Emails, llm: m.LLMLatency,
+	}
+}
+
+// sample is the counters at one moment, by the label rules compare.
+type sample struct {
+	at        time.Time
+	responses map[string]float64 // by status class
+	emails    map[string]float64 // by result
+	llm       map[string]float64 // by result
+	inUse     int
+	maxOpen   int // 0 when unlimited
+}
+
+func (e *Evaluator) snapshot(now time.Time) sample {
+	stats := e.db.Stats()
+	return sample{
+		at:        now,
+		responses: totals(e.responses, "class"),
+		emails:    totals(e.emails, "result"),
+		llm:       totals(e.llm, "result"),
+		inUse:     stats.InUse,
+		maxOpen:   stats.MaxOpenConnections,
+	}
+}
+
+// totals sums c's counters, or its histograms' observation counts, by the
+// value of label.
+func totals(c prometheus.Collector, label string) map[string]float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	out := map[string]float64{}
+	for m := range ch {
+		var d dto.Metric
+		if m.Write(&d) != nil {
+			continue
+		}
+		var v float64
+		switch {
+		case d.Counter != nil:
+			v = d.Counter.GetValue()
+		case d.Histogram != nil:
+			v = float64(d.Histogram.GetSampleCount())
+		}
+		for _, l := range d.Label {
+			if l.GetName() == label {
+				out[l.GetValue()] += v
+			}
+		}
+	}
+	return out
+}
+
+// delta is how much each of by's counters grew across window.
+func delta(window []sample, by func(sample) map[string]float64) map[string]float64 {
+	first, last := by(window[0]), by(window[len(window)-1])
+	out := make(map[string]float64, len(last))
+	for k, v := range last {
+		out[k] = v - first[k]
+	}
+	return out
+}
+
+// percent is part of whole as a percentage, or false when whole is under min.
+func percent(part, whole, min float64) (float64, bool) {
+	if whole < min || whole <= 0 {
+		return 0, false
+	}
+	return 100 * part / whole, true
+}
+
+func errorRate(window []sample) (float64, bool) {
+	d := delta(window, func(s sample) map[string]float64 { return s.responses })
+	var all float64
+	for _, n := range d {
+		all += n
+	}
+	return percent(d["5xx"], all, minRequests)
+}
+
+func emailFailureRate(window []sample) (float64, bool) {
+	// Suppressed sends were never attempted, so they count for neither
+	d := delta(window, func(s sample) map[string]float64 { return s.emails })
+	return percent(d["failed"], d["sent"]+d["failed"], minEmails)
+}
+
+func llmFailureRate(window []sample) (float64, bool) {
+	d := delta(window, func(s sample) map[string]float64 { return s.llm })
+	return percent(d["error"], d["ok"]+d["error"], minLLMCalls)
+}
+
+// poolSaturation is the average share of the pool in use across the window.
+func poolSaturation(window []sample) (float64, bool) {
+	var sum float64
+	for _, s := range window {
+		if s.maxOpen <= 0 {
+			return 0, false
+		}
+		sum += 100 * float64(s.inUse) / float64(s.maxOpen)
+	}
+	return sum / float64(len(window)), true
+}
+
+// Evaluate takes a sample, measures every rule over the window, and opens
+// or resolves alerts to match.
+func (e *Evaluator) Evaluate(ctx context.Context) error {
+	cfg, err := LoadConfig(ctx, e.db)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	e.history = append(e.history, e.snapshot(now))
+	start := now.Add(-cfg.Window)
+	for len(e.history) > 2 && !e.history[1].at.After(start) {
+		e.history = e.history[1:]
+	}
+	if len(e.history) < 2 {
+		return nil // the first sample since starting
+	}
+
+	for _, r := range Rules {
+		threshold := cfg.Thresholds[r.Name]
+		value, ok := r.measure(e.history)
+		if threshold > 0 && ok && value >= threshold {
+			err = e.fire(ctx, r, value, threshold)
+		} else {
+			err = e.resolve(ctx, r)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+	}
+	_, err = e.db.ExecContext(ctx,
+		`UPDATE alerts SET resolved_at = NOW()
+		  WHERE resolved_at IS NULL AND updated_at < NOW() - $1 * INTERVAL '1 second'`, staleAfter.Seconds())
+	return err
+}
+
+// fire updates r's open alert, or opens one and notifies admins.
+func (e *Evaluator) fire(ctx context.Context, r Rule, value, threshold float64) error {
+	res, err := e.db.ExecContext(ctx,
+		`UPDATE alerts SET value = $3, threshold = $4, updated_at = NOW()
+		  WHERE rule = $1 AND instance = $2 AND resolved_at IS NULL`, r.Name, e.instance, value, threshold)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	a := Alert{Rule: r.Name, Summary: r.Summary, Instance: e.instance, Value: value, Threshold: threshold}
+	err = e.db.QueryRowContext(ctx,
+		`INSERT INTO alerts (rule, instance, value, threshold) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (rule, instance) WHERE resolved_at IS NULL DO NOTHING
+		 RETURNING id, started_at, updated_at`, r.Name, e.instance, value, threshold,
+	).Scan(&a.ID, &a.StartedAt, &a.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e.logger.Warn("alert firing", zap.String("rule", r.Name), zap.Float64("value", value), zap.Float64("threshold", threshold))
+	e.notify(ctx, a)
+	return nil
+}
+
+// resolve closes r's open alert, if any, and notifies admins.
+func (e *Evaluator) resolve(ctx context.Context, r Rule) error {
+	a := Alert{Rule: r.Name, Summary: r.Summary, Instance: e.instance}
+	var resolved time.Time
+	err := e.db.QueryRowContext(ctx,
+		`UPDATE alerts SET resolved_at = NOW()
+		  WHERE rule = $1 AND instance = $2 AND resolved_at IS NULL
+		 RETURNING id, value, threshold, started_at, updated_at, resolved_at`, r.Name, e.instance,
+	).Scan(&a.ID, &a.Value, &a.Threshold, &a.StartedAt, &a.UpdatedAt, &resolved)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	a.ResolvedAt = &resolved
+	e.logger.Info("alert resolved", zap.String("rule", r.Name))
+	e.notify(ctx, a)
+	return nil
+}
+
+// pushPayload is what the service worker shows.
+type pushPayload struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url"`
+}
+
+// notify emails every admin about a, and pushes to their browsers. Failures
+// are logged rather than returned, so one bad address does not hold up the
+// rest or the next evaluation.
+func (e *Evaluator) notify(ctx context.Context, a Alert) {
+	data := email.AlertData{
+		Summary:   a.Summary,
+		Instance:  a.Instance,
+		Value:     fmt.Sprintf("%.1f%%", a.Value),
+		Threshold: fmt.Sprintf("%.0f%%", a.Threshold),
+		Since:     a.StartedAt.In(locale.EAT).Format("2 Jan 15:04"),
+		Resolved:  a.ResolvedAt != nil,
+	}
+
+	rows, err := e.db.QueryContext(ctx, `SELECT email, username FROM users WHERE is_admin`)
+	if err != nil {
+		e.logger.Error("failed to list admins for alert", zap.Error(err))
+	} else {
+		type admin struct{ email, username string }
+		var admins []admin
+		for rows.Next() {
+			var ad admin
+			if err := rows.Scan(&ad.email, &ad.username); err != nil {
+				e.logger.Error("failed to list admins for alert", zap.Error(err))
+				break
+			}
+			admins = append(admins, ad)
+		}
+		rows.Close()
+		for _, ad := range admins {
+			data.Username = ad.username
+			if err := e.mailer.SendAlertEmail(ad.email, data); err != nil {
+				e.logger.Error("failed to send alert email", zap.String("rule", a.Rule), zap.Error(err))
+			}
+		}
+	}
+
+	if e.pusher == nil {
+		return
+	}
+	p := pushPayload{
+		Title: "Alert: " + a.Summary,
+		Body:  fmt.Sprintf("%s on %s, over %s", data.Value, a.Instance, data.Threshold),
+		URL:   "/admin/alerts",
+	}
+	if data.Resolved {
+		p.Title = "Resolved: " + a.Summary
+		p.Body = "Cleared on " + a.Instance
+	}
+	payload, _ := json.Marshal(p)
+	if _, err := webpush.NotifyAdmins(ctx, e.db, e.pusher, e.logger, webpush.Message{
+		Payload: payload,
+		TTL:     time.Hour,
+		Topic:   "alert-" + a.Rule,
+		Urgent:  !data.Resolved,
+	}); err != nil {
+		e.logger.Error("failed to push alert", zap.String("rule", a.Rule), zap.Error(err))
+	}
+}
+
+// Run evaluates every interval until ctx is done.
+func (e *Evaluator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := e.Evaluate(ctx); err != nil && ctx.Err() == nil {
+			e.logger.Error("alert evaluation failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Package announcements holds operational notices, such as "pickup moves to
+// the library on Friday", that the frontend shows as banners and the chat
+// shows in its greeting. Admins schedule them with a start and optional end,
+// so nothing needs a frontend redeploy.
+package announcements
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Severities, least to most urgent.
+const (
+	SeverityInfo     = "INFO"
+	SeverityWarning  = "WARNING"
+	SeverityCritical = "CRITICAL"
+)
+
+// Announcement is one notice and when it shows.
+type Announcement struct {
+	ID        int        `json:"id"`
+	Message   string     `json:"message"`
+	Severity  string     `json:"severity"`
+	StartsAt  time.Time  `json:"startsAt"`
+	EndsAt    *time.Time `json:"endsAt"` // null shows it until ended
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// Input is the body of POST and PUT /admin/announcements. StartsAt defaults
+// to now.
+type Input struct {
+	Message  string     `json:"message" validate:"required,max=500"`
+	Severity string     `json:"severity" validate:"required,oneof=INFO WARNING CRITICAL"`
+	StartsAt *time.Time `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt"`
+}
+
+// Window returns when in shows, defaulting the start to now. ok is false
+// when it would end before it starts.
+func (in Input) Window() (start time.Time, end *time.Time, ok bool) {
+	start = time.Now()
+	if in.StartsAt != nil {
+		start = *in.StartsAt
+	}
+	return start, in.EndsAt, in.EndsAt == nil || in.EndsAt.After(start)
+}
+
+const columns = `id, message, severity, starts_at, ends_at, created_at, updated_at`
+
+func scan(row interface{ Scan(...interface{}) error }, a *Announcement) error {
+	var endsAt sql.NullTime
+	if err := row.Scan(&a.ID, &a.Message, &a.Severity, &a.StartsAt, &endsAt, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		return err
+	}
+	if endsAt.Valid {
+		a.EndsAt = &endsAt.Time
+	}
+	return nil
+}
+
+func query(ctx context.Context, db *sql.DB, q string, args ...interface{}) ([]Announcement, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Announcement{}
+	for rows.Next() {
+		var a Announcement
+		if err := scan(rows, &a); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// Active returns the announcements showing at now, most urgent first, then
+// newest.
+func Active(ctx context.Context, db *sql.DB, now time.Time) ([]Announcement, error) {
+	return query(ctx, db,
+		`SELECT `+columns+` FROM announcements
+		  WHERE starts_at <= $1 AND (ends_at IS NULL OR ends_at > $1)
+		  ORDER BY CASE severity WHEN 'CRITICAL' THEN 0 WHEN 'WARNING' THEN 1 ELSE 2 END, starts_at DESC, id DESC`,
+		now)
+}
+
+// List returns every announcement, latest start first, with the total for
+// paging.
+func List(ctx context.Context, db *sql.DB, limit, offset int) ([]Announcement, int, error) {
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM announcements`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	list, err := query(ctx, db,
+		`SELECT `+columns+` FROM announcements ORDER BY starts_at DESC, id DESC LIMIT $1 OFFSET $2`,
+		limit, offset)
+	return list, total, err
+}
+
+// Create saves an announcement; check in.Window first.
+func Create(ctx context.Context, db *sql.DB, adminID int, in Input) (Announcement, error) {
+	start, end, _ := in.Window()
+	var a Announcement
+	err := scan(db.QueryRowContext(ctx,
+		`INSERT INTO announcements (message, severity, starts_at, ends_at, created_by)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, 0))
+		 RETURNING `+columns,
+		in.Message, in.Severity, start, end, adminID,
+	), &a)
+	return a, err
+}
+
+// Update replaces an announcement, or returns sql.ErrNoRows; check
+// in.Window first.
+func Update(ctx context.Context, db *sql.DB, id int, in Input) (Announcement, error) {
+	start, end, _ := in.Window()
+	var a Announcement
+	err := scan(db.QueryRowContext(ctx,
+		`UPDATE announcements SET message = $2, severity = $3, starts_at = $4, ends_at = $5, updated_at = NOW()
+		  WHERE id = $1
+		 RETURNING `+columns,
+		id, in.Message, in.Severity, start, end,
+	), &a)
+	return a, err
+}
+
+// Delete removes an announcement, or returns sql.ErrNoRows.
+func Delete(ctx context.Context, db *sql.DB, id int) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM announcements WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MakeHandler serves GET /announcements, the notices showing now. It needs
+// no session, so banners can show on the login page too.
+func MakeHandler(db *sql.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := Active(r.Context(), db, time.Now())
+		if err != nil {
+			logger.Error("announcements query failed", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// A minute's staleness is fine for banners and spares the database
+		// on every page load
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		json.NewEncoder(w).Encode(list)
+	}
+}
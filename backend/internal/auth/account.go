@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/internal/background"
+	"server/internal/domain"
+	"server/internal/email"
+	"server/internal/httpx"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// emailChangeTTL is how long a link to confirm a new address stays valid.
+const emailChangeTTL = 24 * time.Hour
+
+// ChangePasswordRequest is the body of POST /me/password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required,max=72"`
+	NewPassword     string `json:"newPassword" validate:"required,min=8,max=72"`
+}
+
+// ChangeEmailRequest is the body of POST /me/email.
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"newEmail" validate:"required,email,max=254"`
+	CurrentPassword string `json:"currentPassword" validate:"required,max=72"`
+}
+
+// checkPassword reports whether password is the user's current one. On
+// failure the response has been written.
+func checkPassword(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int, password string) bool {
+	var hash string
+	const q = `SELECT password_hash FROM users WHERE id = $1`
+	if err := db.QueryRowContext(r.Context(), q, userID).Scan(&hash); err != nil {
+		httpx.WriteError(w, domain.NotFound("user not found"))
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "currentPassword", Message: "is incorrect"}})
+		return false
+	}
+	return true
+}
+
+// MakeChangePasswordHandler changes the logged-in user's password and ends
+// all their sessions, signing the one that made the change back in with a
+// new token.
+func MakeChangePasswordHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, ok := r.Context().Value(ContextUserIDKey).(int)
+		if !ok {
+			http.Error(w, "failed to get user from context", http.StatusInternalServerError)
+			return
+		}
+
+		var req ChangePasswordRequest
+		if !httpx.DecodeJSON(w, r, &req) {
+			return
+		}
+		if !checkPassword(w, r, db, userID, req.CurrentPassword) {
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "failed to hash password", http.StatusInternalServerError)
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// A pending reset link would otherwise still work with the old flow
+		const qUpdate = `UPDATE users SET password_hash = $1, reset_token = NULL, reset_expires = NULL WHERE id = $2`
+		if _, err := tx.ExecContext(r.Context(), qUpdate, string(hash), userID); err != nil {
+			http.Error(w, "failed to change password", http.StatusInternalServerError)
+			return
+		}
+		const qSessions = `DELETE FROM sessions WHERE user_id = $1`
+		if _, err := tx.ExecContext(r.Context(), qSessions, userID); err != nil {
+			http.Error(w, "failed to end other sessions", http.StatusInternalServerError)
+			return
+		}
+		token, expiresAt, err := createSession(r.Context(), tx, userID)
+		if err != nil {
+			http.Error(w, "failed to create session", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		setSessionCookie(w, r, token, expiresAt)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{Message: "Password changed. Other devices have been signed out."})
+	}
+}
+
+// MakeChangeEmailHandler starts an email change: the new address gets a
+// confirmation link, and the account keeps its current address until the
+// link is followed. baseURL is where this API is publicly reachable.
+func MakeChangeEmailHandler(db *sql.DB, mailer *email.Client, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, ok := r.Context().Value(ContextUserIDKey).(int)
+		if !ok {
+			http.Error(w, "failed to get user from context", http.StatusInternalServerError)
+			return
+		}
+
+		var req ChangeEmailRequest
+		if !httpx.DecodeJSON(w, r, &req) {
+			return
+		}
+		if !checkPassword(w, r, db, userID, req.CurrentPassword) {
+			return
+		}
+		newEmail := strings.TrimSpace(req.NewEmail)
+
+		var taken bool
+		const qTaken = `SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(email) = LOWER($1))`
+		if err := db.QueryRowContext(r.Context(), qTaken, newEmail).Scan(&taken); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if taken {
+			httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "newEmail", Message: "is already in use"}})
+			return
+		}
+
+		tokenBytes := make([]byte, 16)
+		if _, err := rand.Read(tokenBytes); err != nil {
+			http.Error(w, "failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		token := hex.EncodeToString(tokenBytes)
+
+		var username string
+		const qPending = `
+            UPDATE users SET pending_email = $1, email_change_token = $2, email_change_expires = $3
+            WHERE id = $4
+            RETURNING username
+        `
+		if err := db.QueryRowContext(r.Context(), qPending, newEmail, token, time.Now().Add(emailChangeTTL), userID).Scan(&username); err != nil {
+			http.Error(w, "failed to start email change", http.StatusInternalServerError)
+			return
+		}
+
+		data := email.ChangeEmailData{
+			Username:   username,
+			ConfirmURL: strings.TrimRight(baseURL, "/") + "/me/email/confirm?token=" + token,
+		}
+		_, done := background.Task(r.Context())
+		go func() {
+			defer done()
+			if err := mailer.SendChangeEmailEmail(newEmail, data); err != nil {
+				log.Printf("ERROR sending email change confirmation for user %d: %v", userID, err)
+			}
+		}()
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(Response{Message: "Check your new inbox to confirm the change."})
+	}
+}
+
+// MakeConfirmEmailChangeHandler switches the account to its pending address
+// using the token from the confirmation email. It needs no session, since the
+// link may be opened on another device.
+func MakeConfirmEmailChangeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+
+		const q = `
+            UPDATE users
+            SET email = pending_email, pending_email = NULL,
+                email_change_token = NULL, email_change_expires = NULL
+            WHERE email_change_token = $1 AND email_change_expires > NOW() AND pending_email IS NOT NULL
+        `
+		res, err := db.ExecContext(r.Context(), q, token)
+		if err != nil {
+			// Someone registered the address after the change was requested
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+				http.Error(w, "email address is already in use", http.StatusConflict)
+				return
+			}
+			http.Error(w, "failed to change email", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{Message: "Email address changed."})
+	}
+}
@@ -1,10 +1,13 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
@@ -14,22 +17,27 @@ import (
 	"strings"
 	"time"
 
+	"server/internal/background"
+	"server/internal/domain"
 	"server/internal/email"
+	"server/internal/httpx"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // SignupRequest holds data for user sign-up.
 type SignupRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Username   string `json:"username" validate:"required,min=3,max=32"`
+	Email      string `json:"email" validate:"required,email,max=254"`
+	Password   string `json:"password" validate:"required,min=8,max=72"`
+	InviteCode string `json:"inviteCode" validate:"max=64"` // required when invite-only
 }
 
 // LoginRequest holds data for user login.
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,max=254"`
+	Password string `json:"password" validate:"required,max=72"`
 }
 
 // Response holds a generic JSON message.
@@ -75,8 +83,37 @@ func shouldUseSecureCookies(r *http.Request) bool {
 	return strings.EqualFold(originURL.Scheme, "https")
 }
 
-// MakeSignupHandler registers new users and enables immediate login.
-func MakeSignupHandler(db *sql.DB, _ *email.Client, _ string) http.HandlerFunc {
+// ErrInvalidInvitation is returned by RedeemInvitation for unknown, expired,
+// revoked, or used-up codes.
+var ErrInvalidInvitation = domain.Invalid("inviteCode", "is invalid or has expired")
+
+// RedeemInvitation uses up one slot of an invitation code and returns its id.
+func RedeemInvitation(ctx context.Context, tx *sql.Tx, code string) (int, error) {
+	var id int
+	err := tx.QueryRowContext(ctx,
+		`UPDATE invitations SET uses = uses + 1
+		  WHERE code = $1 AND uses < max_uses AND revoked_at IS NULL
+		    AND (expires_at IS NULL OR expires_at > NOW())
+		  RETURNING id`,
+		strings.ToUpper(strings.TrimSpace(code)),
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidInvitation
+	}
+	return id, err
+}
+
+// signupAccepted is the answer to every signup that passes validation,
+// whether or not the email already has an account, so the endpoint cannot
+// be used to find out who is registered.
+const signupAccepted = "Signup received. You can now log in; if this email already has an account, check your inbox."
+
+// MakeSignupHandler registers new users and enables immediate login. With
+// inviteOnly set, signup also needs a valid invitation code; otherwise a code
+// is optional and only recorded for analytics. Signing up with a registered
+// email creates nothing: the owner gets an informational email and the
+// response is the same as for a new account.
+func MakeSignupHandler(db *sql.DB, mailer *email.Client, _ string, inviteOnly bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -84,70 +121,89 @@ func MakeSignupHandler(db *sql.DB, _ *email.Client, _ string) http.HandlerFunc {
 		}
 
 		var req SignupRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid JSON payload", http.StatusBadRequest)
-			return
-		}
-		defer r.Body.Close()
-
-		// Validating username to have characters more than 3 and not more than 32/ username field should also not be empty
-		if req.Username == "" {
-			http.Error(w, "username is required", http.StatusBadRequest)
-			return
-		}
-		if len(req.Username) < 3 || len(req.Username) > 32 {
-			http.Error(w, "username must be between 3 to 32 characters", http.StatusBadRequest)
+		if !httpx.DecodeJSON(w, r, &req) {
 			return
 		}
 
-		// Hash password
+		// Hash password first so both outcomes below cost the same
 		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			http.Error(w, "failed to hash password", http.StatusInternalServerError)
 			return
 		}
 
-		// Insert user
-		const q = `INSERT INTO users (username, email, password_hash, verified) VALUES ($1, $2, $3, TRUE)`
-		if _, err := db.ExecContext(r.Context(), q, req.Username, req.Email, string(hash)); err != nil {
-			http.Error(w, "user already registered", http.StatusConflict)
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
-
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(Response{Message: "Signup successful. You can now log in."})
-	}
-}
-
-// MakeVerifyHandler confirms email using the token.
-func MakeVerifyHandler(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		defer tx.Rollback()
+
+		// Redeem the invitation, if any, in the same transaction as the insert
+		// so a failed signup does not use up a slot
+		var invitationID sql.NullInt64
+		if req.InviteCode != "" {
+			id, err := RedeemInvitation(r.Context(), tx, req.InviteCode)
+			if err != nil {
+				httpx.WriteError(w, err)
+				return
+			}
+			invitationID = sql.NullInt64{Int64: int64(id), Valid: true}
+		} else if inviteOnly {
+			httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "inviteCode", Message: "is required"}})
 			return
 		}
-		token := r.URL.Query().Get("token")
-		if token == "" {
-			http.Error(w, "token is required", http.StatusBadRequest)
+
+		// Usernames are public, so a taken one can be reported; emails cannot
+		var existing string
+		const qExisting = `SELECT username FROM users WHERE LOWER(email) = LOWER($1)`
+		switch err := tx.QueryRowContext(r.Context(), qExisting, req.Email).Scan(&existing); {
+		case err == nil:
+			_, done := background.Task(r.Context())
+			go func() {
+				defer done()
+				if err := mailer.SendAccountExistsEmail(req.Email, existing); err != nil {
+					log.Printf("ERROR sending account-exists notice: %v", err)
+				}
+			}()
+			writeSignupAccepted(w)
+			return
+		case err != sql.ErrNoRows:
+			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 
-		const q = `UPDATE users SET verified = TRUE, verification_token = NULL WHERE verification_token = $1`
-		res, err := db.ExecContext(r.Context(), q, token)
-		if err != nil {
-			http.Error(w, "verification failed", http.StatusInternalServerError)
+		// Insert user
+		const q = `INSERT INTO users (username, email, password_hash, verified, invitation_id) VALUES ($1, $2, $3, TRUE, $4)`
+		if _, err := tx.ExecContext(r.Context(), q, req.Username, req.Email, string(hash), invitationID); err != nil {
+			var pqErr *pq.Error
+			if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			if pqErr.Constraint == "users_username_key" {
+				httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "username", Message: "is already taken"}})
+				return
+			}
+			// The same email signed up concurrently
+			writeSignupAccepted(w)
 			return
 		}
-		if cnt, _ := res.RowsAffected(); cnt == 0 {
-			http.Error(w, "invalid or expired token", http.StatusBadRequest)
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(Response{Message: "Email verified successfully."})
+		writeSignupAccepted(w)
 	}
 }
 
+func writeSignupAccepted(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Response{Message: signupAccepted})
+}
+
 // Updated MakeLoginHandler: creates a session row & sets a cookie instead of returning a JWT.
 func MakeLoginHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -159,11 +215,9 @@ func MakeLoginHandler(db *sql.DB) http.HandlerFunc {
 
 		// 2) Parse credentials
 		var req LoginRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+		if !httpx.DecodeJSON(w, r, &req) {
 			return
 		}
-		defer r.Body.Close()
 
 		// 3) Lookup user
 		var (
@@ -186,93 +240,63 @@ func MakeLoginHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// 5) Generate a random session token
-		tokenBytes := make([]byte, 16)
-		if _, err := rand.Read(tokenBytes); err != nil {
-			http.Error(w, "failed to generate session token", http.StatusInternalServerError)
-			return
-		}
-		sessionToken := hex.EncodeToString(tokenBytes)
-
-		// 6) Compute expiry (6 months from now)
-		expiresAt := time.Now().AddDate(0, 6, 0)
-
-		// 7) Insert session into Postgres
-		const qSession = `
-            INSERT INTO sessions (user_id, token, expires_at)
-            VALUES ($1, $2, $3)
-        `
-		if _, err := db.ExecContext(r.Context(), qSession, userID, sessionToken, expiresAt); err != nil {
+		// 5) Create a session; only its token's hash is stored
+		sessionToken, expiresAt, err := createSession(r.Context(), db, userID)
+		if err != nil {
 			http.Error(w, "failed to create session", http.StatusInternalServerError)
 			return
 		}
 
-		// 8) Set cookie on response.
-		// Cross-site auth requires SameSite=None + Secure on HTTPS deployments.
-		secureCookie := shouldUseSecureCookies(r)
-		sameSiteMode := http.SameSiteLaxMode
-		if secureCookie {
-			sameSiteMode = http.SameSiteNoneMode
-		}
+		// 6) Set cookie on response
+		setSessionCookie(w, r, sessionToken, expiresAt)
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_token",
-			Value:    sessionToken,
-			Path:     "/",
-			Expires:  expiresAt,
-			HttpOnly: true,
-			Secure:   secureCookie,
-			SameSite: sameSiteMode,
-		})
-
-		// 9) Return 200 OK with simple JSON
+		// 7) Return 200 OK with simple JSON
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(Response{Message: "Login successful"})
 	}
 }
 
-// MakeProfileHandler returns the logged-in user's basic info.
-func MakeProfileHandler(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// 1) Extract user_id from context
-		uidVal := r.Context().Value(ContextUserIDKey)
-		userID, ok := uidVal.(int)
-		if !ok {
-			http.Error(w, "failed to get user from context", http.StatusInternalServerError)
-			return
-		}
-
-		// 2) Query user info
-		var (
-			username string
-			email    string
-		)
-		const q = `
-            SELECT username, email
-            FROM users
-            WHERE id = $1
-        `
-		if err := db.QueryRowContext(r.Context(), q, userID).Scan(&username, &email); err != nil {
-			http.Error(w, "user not found", http.StatusNotFound)
-			return
-		}
-
-		// 3) Respond with JSON
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"id":       userID,
-			"username": username,
-			"email":    email,
-		})
-	}
-}
-
-// MakePasswordResetHandler handles reset requests and email.
-func MakePasswordResetHandler(db *sql.DB, mailer *email.Client, jwtSecret string) http.HandlerFunc {
+// MakePasswordResetHandler handles reset requests and email. GET is where
+// the emailed link lands: browsers asking for text/html get a page with a
+// new-password form, which POSTs back as a form, and other clients get the
+// token checked as JSON. API clients POST ?email= to request a link and PUT
+// the new password as JSON.
+func MakePasswordResetHandler(db *sql.DB, mailer *email.Client, jwtSecret string, pages *Pages) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
+		case http.MethodGet:
+			token := r.URL.Query().Get("token")
+			var expires time.Time
+			err := db.QueryRowContext(r.Context(), `SELECT reset_expires FROM users WHERE reset_token=$1`, token).Scan(&expires)
+			if token == "" || errors.Is(err, sql.ErrNoRows) || err == nil && time.Now().After(expires) {
+				if wantsHTML(r) {
+					pages.write(w, http.StatusBadRequest, pages.resetFailed())
+					return
+				}
+				http.Error(w, "invalid or expired token", http.StatusBadRequest)
+				return
+			} else if err != nil {
+				if wantsHTML(r) {
+					pages.write(w, http.StatusInternalServerError, pages.resetError())
+					return
+				}
+				http.Error(w, "failed to check reset token", http.StatusInternalServerError)
+				return
+			}
+			if !wantsHTML(r) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(Response{Message: "PUT the token and a newPassword to /password-reset to set a new password."})
+				return
+			}
+			pages.write(w, http.StatusOK, pages.resetForm(token, ""))
+
 		case http.MethodPost:
-			// generate reset token
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+				submitResetForm(w, r, db, pages)
+				return
+			}
+			// generate reset token. The response is the same whether or not
+			// the email has an account, and unknown addresses get no mail.
 			emailAddr := r.URL.Query().Get("email")
 			if emailAddr == "" {
 				http.Error(w, "email is required", http.StatusBadRequest)
@@ -284,56 +308,50 @@ func MakePasswordResetHandler(db *sql.DB, mailer *email.Client, jwtSecret string
 			resetToken := hex.EncodeToString(tokenBytes)
 			expires := time.Now().Add(time.Hour)
 
-			// 2. Update users.reset_token & reset_expires
-			const q1 = `UPDATE users SET reset_token=$1, reset_expires=$2 WHERE email=$3`
-			if _, err := db.ExecContext(r.Context(), q1, resetToken, expires, emailAddr); err != nil {
+			// 2. Store the token; the same single query runs for unknown
+			//    addresses, so timing does not tell them apart
+			var username string
+			const q1 = `UPDATE users SET reset_token=$1, reset_expires=$2 WHERE email=$3 RETURNING username`
+			err := db.QueryRowContext(r.Context(), q1, resetToken, expires, emailAddr).Scan(&username)
+			if err != nil && err != sql.ErrNoRows {
 				http.Error(w, "failed to set reset token", http.StatusInternalServerError)
 				return
 			}
 
-			// 3. Lookup username for this email
-			var username string
-			const qUser = `SELECT username FROM users WHERE email=$1`
-			if err := db.QueryRowContext(r.Context(), qUser, emailAddr).Scan(&username); err != nil {
-				// If for some reason user row disappeared, just log and continue with email address in greeting
-				log.Printf("WARN: could not find username for %s: %v", emailAddr, err)
-				username = ""
+			// 3. Send password reset email with templates, off the request path
+			if err == nil {
+				_, done := background.Task(r.Context())
+				go func() {
+					defer done()
+					if err := mailer.SendResetPasswordEmail(emailAddr, username, resetToken); err != nil {
+						log.Printf("ERROR sending password reset: %v", err)
+					}
+				}()
 			}
 
-			// 4. Send password reset email with templates
-			go func() {
-				if err := mailer.SendResetPasswordEmail(emailAddr, username, resetToken); err != nil {
-					log.Printf("ERROR sending password reset to %s: %v", emailAddr, err)
-				}
-			}()
-
 			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(Response{Message: "Password reset email sent."})
+			json.NewEncoder(w).Encode(Response{Message: "If an account exists for this email, a password reset link is on its way."})
 
 		case http.MethodPut:
-			// (no changes here, this only handles the token→password step)
 			var req struct {
-				Token       string `json:"token"`
-				NewPassword string `json:"newPassword"`
+				Token       string `json:"token" validate:"required,max=64"`
+				NewPassword string `json:"newPassword" validate:"required,min=8,max=72"`
 			}
-			json.NewDecoder(r.Body).Decode(&req)
-			if req.Token == "" || req.NewPassword == "" {
-				http.Error(w, "token and newPassword are required", http.StatusBadRequest)
+			if !httpx.DecodeJSON(w, r, &req) {
 				return
 			}
-			var expires time.Time
-			const q2 = `SELECT reset_expires FROM users WHERE reset_token=$1`
-			if err := db.QueryRowContext(r.Context(), q2, req.Token).Scan(&expires); err != nil {
+			switch err := resetPassword(r.Context(), db, req.Token, req.NewPassword); {
+			case errors.Is(err, errResetTokenInvalid):
 				http.Error(w, "invalid token", http.StatusBadRequest)
 				return
-			}
-			if time.Now().After(expires) {
+			case errors.Is(err, errResetTokenExpired):
 				http.Error(w, "token expired", http.StatusBadRequest)
 				return
-			}
-			hash, _ := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-			const q3 = `UPDATE users SET password_hash=$1, reset_token=NULL, reset_expires=NULL WHERE reset_token=$2`
-			if _, err := db.ExecContext(r.Context(), q3, string(hash), req.Token); err != nil {
+			case errors.Is(err, domain.ErrValidation):
+				httpx.WriteError(w, err)
+				return
+			case err != nil:
+				log.Printf("ERROR resetting password: %v", err)
 				http.Error(w, "failed to reset password", http.StatusInternalServerError)
 				return
 			}
@@ -345,3 +363,123 @@ func MakePasswordResetHandler(db *sql.DB, mailer *email.Client, jwtSecret string
 		}
 	}
 }
+
+// Reasons a reset token is refused.
+var (
+	errResetTokenInvalid = errors.New("invalid token")
+	errResetTokenExpired = errors.New("token expired")
+)
+
+// maxPasswordBytes is the most bcrypt will hash. The validate tags count
+// characters, so a password of accented letters or emoji can pass them and
+// still be too long.
+const maxPasswordBytes = 72
+
+var errPasswordTooLong = domain.Invalid("newPassword", "must be at most 72 bytes; use fewer accented letters or symbols")
+
+// resetPassword sets the password of the account token was issued for and
+// signs it out everywhere, since whoever knew the old password may still be
+// signed in. The token is spent.
+func resetPassword(ctx context.Context, db *sql.DB, token, password string) error {
+	if len(password) > maxPasswordBytes {
+		return errPasswordTooLong
+	}
+	var expires time.Time
+	const q2 = `SELECT reset_expires FROM users WHERE reset_token=$1`
+	if err := db.QueryRowContext(ctx, q2, token).Scan(&expires); errors.Is(err, sql.ErrNoRows) {
+		return errResetTokenInvalid
+	} else if err != nil {
+		return fmt.Errorf("look up reset token: %w", err)
+	}
+	if time.Now().After(expires) {
+		return errResetTokenExpired
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+	var userID int
+	const q3 = `UPDATE users SET password_hash=$1, reset_token=NULL, reset_expires=NULL WHERE reset_token=$2 RETURNING id`
+	if err := tx.QueryRowContext(ctx, q3, string(hash), token).Scan(&userID); errors.Is(err, sql.ErrNoRows) {
+		// Spent by a concurrent reset
+		return errResetTokenInvalid
+	} else if err != nil {
+		return fmt.Errorf("set password: %w", err)
+	}
+	// Whoever knew the old password is signed out everywhere
+	const q4 = `DELETE FROM sessions WHERE user_id = $1`
+	if _, err := tx.ExecContext(ctx, q4, userID); err != nil {
+		return fmt.Errorf("end sessions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// submitResetForm completes a reset from the landing page's form, sending
+// the form back with the reason when the passwords will not do.
+func submitResetForm(w http.ResponseWriter, r *http.Request, db *sql.DB, pages *Pages) {
+	token := r.PostFormValue("token")
+	password := r.PostFormValue("newPassword")
+	switch n := len([]rune(password)); {
+	case n < 8 || n > 72:
+		pages.write(w, http.StatusBadRequest, pages.resetForm(token, "Your new password must have 8 to 72 characters."))
+		return
+	case len(password) > maxPasswordBytes:
+		pages.write(w, http.StatusBadRequest, pages.resetForm(token, "Your new password is too long; accented letters and symbols count for more than one character."))
+		return
+	case password != r.PostFormValue("confirmPassword"):
+		pages.write(w, http.StatusBadRequest, pages.resetForm(token, "The two passwords don't match."))
+		return
+	}
+	switch err := resetPassword(r.Context(), db, token, password); {
+	case errors.Is(err, errResetTokenInvalid), errors.Is(err, errResetTokenExpired):
+		pages.write(w, http.StatusBadRequest, pages.resetFailed())
+	case err != nil:
+		log.Printf("ERROR resetting password: %v", err)
+		pages.write(w, http.StatusInternalServerError, pages.resetError())
+	default:
+		pages.write(w, http.StatusOK, landingPage{
+			Title:    "Password changed",
+			Message:  "Your new password is set, and you've been signed out everywhere else.",
+			LinkURL:  pages.link("/login"),
+			LinkText: "Log in to JAJ",
+		})
+	}
+}
+
+func (p *Pages) resetForm(token, problem string) landingPage {
+	return landingPage{
+		Title:   "Choose a new password",
+		Message: "Pick a password of at least 8 characters that you don't use elsewhere.",
+		Form:    "reset",
+		Token:   token,
+		Error:   problem,
+	}
+}
+
+func (p *Pages) resetFailed() landingPage {
+	return landingPage{
+		Title:    "This link has expired",
+		Message:  "Password reset links work for an hour and only once. Ask for a new one and use the latest email.",
+		Failed:   true,
+		LinkURL:  p.link("/password-reset-submit-email"),
+		LinkText: "Request a new link",
+	}
+}
+
+func (p *Pages) resetError() landingPage {
+	return landingPage{
+		Title:    "Something went wrong",
+		Message:  "We couldn't check your link just now. Please open it again in a few minutes.",
+		Failed:   true,
+		LinkURL:  p.link("/"),
+		LinkText: "Go to JAJ",
+	}
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/background"
+	"server/internal/email"
+	"server/internal/testutil"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// mailLog suppresses every message, so no SMTP server is needed, and keeps
+// the suppressed deliveries for the test to inspect.
+type mailLog struct {
+	sent chan email.Delivery
+}
+
+func (l *mailLog) Record(_ context.Context, d email.Delivery) error {
+	l.sent <- d
+	return nil
+}
+
+func (l *mailLog) Suppressed(context.Context, string) (bool, error) { return true, nil }
+
+// outcome is what a client can observe of a request, plus the mail it sent.
+type outcome struct {
+	status int
+	body   string
+	mail   []string // kinds
+}
+
+// TestAccountsNotRevealed checks that signup and password reset answer an
+// existing and an unknown email identically, and only mail the account.
+func TestAccountsNotRevealed(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(db *sql.DB, mailer *email.Client) http.Handler
+		request func(addr string) *http.Request
+		expect  func(mock sqlmock.Sqlmock, addr string, exists bool)
+		mail    string // kind sent to an existing account
+	}{
+		{
+			name: "signup",
+			handler: func(db *sql.DB, mailer *email.Client) http.Handler {
+				return MakeSignupHandler(db, mailer, "", false)
+			},
+			request: func(addr string) *http.Request {
+				body := fmt.Sprintf(`{"username":"amani","email":%q,"password":"correct horse battery"}`, addr)
+				r := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body))
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			},
+			expect: func(mock sqlmock.Sqlmock, addr string, exists bool) {
+				mock.ExpectBegin()
+				rows := sqlmock.NewRows([]string{"username"})
+				if exists {
+					rows.AddRow("amani_n")
+				}
+				mock.ExpectQuery("WHERE LOWER(email) = LOWER($1)").WithArgs(addr).WillReturnRows(rows)
+				if exists {
+					mock.ExpectRollback()
+					return
+				}
+				mock.ExpectExec("INSERT INTO users").
+					WithArgs("amani", addr, sqlmock.AnyArg(), nil).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			mail: "account_exists",
+		},
+		{
+			name: "password reset",
+			handler: func(db *sql.DB, mailer *email.Client) http.Handler {
+				return MakePasswordResetHandler(db, mailer, "", NewPages(""))
+			},
+			request: func(addr string) *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/password-reset?email="+url.QueryEscape(addr), nil)
+			},
+			expect: func(mock sqlmock.Sqlmock, addr string, exists bool) {
+				rows := sqlmock.NewRows([]string{"username"})
+				if exists {
+					rows.AddRow("amani_n")
+				}
+				mock.ExpectQuery("UPDATE users SET reset_token=$1").
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), addr).
+					WillReturnRows(rows)
+			},
+			mail: "password_reset",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			send := func(addr string, exists bool) outcome {
+				db, mock := testutil.NewMock(t)
+				tt.expect(mock, addr, exists)
+				log := &mailLog{sent: make(chan email.Delivery, 4)}
+				mailer := email.NewClient("127.0.0.1:1", "jaj@example.test", "unused")
+				mailer.Log = log
+
+				w := httptest.NewRecorder()
+				tt.handler(db, mailer).ServeHTTP(w, tt.request(addr))
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if n := background.Wait(ctx); n > 0 {
+					t.Fatalf("%d emails still sending", n)
+				}
+				close(log.sent)
+				o := outcome{status: w.Code, body: w.Body.String()}
+				for d := range log.sent {
+					o.mail = append(o.mail, d.Kind)
+				}
+				return o
+			}
+
+			existing := send("amani@example.test", true)
+			unknown := send("nobody@example.test", false)
+			if existing.status != unknown.status || existing.body != unknown.body {
+				t.Errorf("existing email got %d %q, unknown got %d %q",
+					existing.status, existing.body, unknown.status, unknown.body)
+			}
+			if len(existing.mail) != 1 || existing.mail[0] != tt.mail {
+				t.Errorf("existing email was sent %v, want [%s]", existing.mail, tt.mail)
+			}
+			if len(unknown.mail) != 0 {
+				t.Errorf("unknown email was sent %v, want nothing", unknown.mail)
+			}
+		})
+	}
+}
+
+// TestResetPasswordTooLong checks that a password within the validate tag's
+// 72 characters but over bcrypt's 72 bytes is refused before anything is
+// written, rather than stored as an empty hash.
+func TestResetPasswordTooLong(t *testing.T) {
+	db, _ := testutil.NewMock(t) // no statements expected
+	body := fmt.Sprintf(`{"token":"abc","newPassword":%q}`, strings.Repeat("é", 72))
+	r := httptest.NewRequest(http.MethodPut, "/password-reset", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	MakePasswordResetHandler(db, nil, "", NewPages("")).ServeHTTP(w, r)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT with a 144-byte password = %d %q, want %d", w.Code, w.Body, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestResetPasswordDatabaseError(t *testing.T) {
+	db, mock := testutil.NewMock(t)
+	mock.ExpectQuery("SELECT reset_expires FROM users").WillReturnError(sql.ErrConnDone)
+	if err := resetPassword(context.Background(), db, "abc", "correct horse battery"); err == nil ||
+		errors.Is(err, errResetTokenInvalid) || !errors.Is(err, sql.ErrConnDone) {
+		t.Errorf("resetPassword() = %v, want the wrapped database error", err)
+	}
+}
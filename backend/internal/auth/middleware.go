@@ -3,8 +3,11 @@ package auth
 import (
 	"context"
 	"database/sql"
+	"log"
 	"net/http"
 	"time"
+
+	"server/internal/errors/reporter"
 )
 
 // ContextKey is used to store values in context.
@@ -26,23 +29,27 @@ func RequireSession(db *sql.DB) func(http.Handler) http.Handler {
 			}
 
 			// 1) Read cookie
-			cookie, err := r.Cookie("session_token")
+			cookie, err := r.Cookie(sessionCookie)
 			if err != nil {
 				http.Error(w, "missing session", http.StatusUnauthorized)
 				return
 			}
-			token := cookie.Value
+			tokenHash := hashToken(cookie.Value)
 
-			// 2) Lookup session in DB
+			// 2) Lookup session in DB, by its current token or, briefly, the
+			//    one it was rotated from
 			var userID int
 			var expiresAt time.Time
+			var rotate bool
 			const q = `
-                SELECT user_id, expires_at
+                SELECT user_id, expires_at,
+                       token_hash = $1 AND rotated_at < NOW() - $2 * INTERVAL '1 second'
                 FROM sessions
-                WHERE token = $1
+                WHERE token_hash = $1
+                   OR (previous_hash = $1 AND rotated_at > NOW() - $3 * INTERVAL '1 second')
             `
-			row := db.QueryRowContext(r.Context(), q, token)
-			if err := row.Scan(&userID, &expiresAt); err != nil {
+			row := db.QueryRowContext(r.Context(), q, tokenHash, rotateAfter.Seconds(), rotationGrace.Seconds())
+			if err := row.Scan(&userID, &expiresAt, &rotate); err != nil {
 				http.Error(w, "invalid session", http.StatusUnauthorized)
 				return
 			}
@@ -53,15 +60,60 @@ func RequireSession(db *sql.DB) func(http.Handler) http.Handler {
 				return
 			}
 
-			// 4) Optionally: extend expiry on activity (sliding window)
-			//    newExpiry := time.Now().AddDate(0, 6, 0)
-			//    db.ExecContext(r.Context(), "UPDATE sessions SET expires_at = $1 WHERE token = $2", newExpiry, token)
-			//
-			//    And reset cookie Expires header if you choose sliding sessions.
+			// 4) Replace a day-old token with a fresh cookie; if that fails
+			//    the next request tries again
+			if rotate {
+				if err := rotateSession(r.Context(), db, w, r, tokenHash, expiresAt); err != nil {
+					log.Printf("ERROR rotating session: %v", err)
+				}
+			}
 
 			// 5) Inject userID into context
+			reporter.SetUser(r.Context(), userID)
 			ctx := context.WithValue(r.Context(), ContextUserIDKey, userID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// RequireAdmin creates middleware that only lets admin users through. It must
+// run inside RequireSession.
+func RequireAdmin(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value(ContextUserIDKey).(int)
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			var isAdmin bool
+			const q = `SELECT is_admin FROM users WHERE id = $1`
+			if err := db.QueryRowContext(r.Context(), q, userID).Scan(&isAdmin); err != nil || !isAdmin {
+				http.Error(w, "admin access required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireStaff creates middleware that only lets fulfillment staff and
+// admins through. It must run inside RequireSession.
+func RequireStaff(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value(ContextUserIDKey).(int)
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			var allowed bool
+			const q = `SELECT is_staff OR is_admin FROM users WHERE id = $1`
+			if err := db.QueryRowContext(r.Context(), q, userID).Scan(&allowed); err != nil || !allowed {
+				http.Error(w, "staff access required", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// pageFS holds the landing pages emailed links open, so the server binary
+// does not depend on its working directory for them.
+//
+//go:embed pages/*.html
+var pageFS embed.FS
+
+var landingTmpl = template.Must(template.ParseFS(pageFS, "pages/landing.html"))
+
+// landingPage is what a landing page shows.
+type landingPage struct {
+	Title    string
+	Message  string
+	Failed   bool   // the link did not work; the title is shown as an error
+	Form     string // "verify" or "reset" shows that form, with Token
+	Token    string
+	Error    string // why the form was sent back
+	LinkURL  string // back to the web app
+	LinkText string
+}
+
+// Pages renders the HTML pages links in verification and password reset
+// emails open, linking back to the web app at FrontendURL.
+type Pages struct {
+	FrontendURL string // e.g. "https://jaj-delivery.web.app"
+}
+
+// NewPages returns landing pages linking back to frontendURL.
+func NewPages(frontendURL string) *Pages {
+	return &Pages{FrontendURL: strings.TrimRight(frontendURL, "/")}
+}
+
+// link returns the web app's URL for path, e.g. "/login".
+func (p *Pages) link(path string) string {
+	return p.FrontendURL + path
+}
+
+// write renders page with status.
+func (p *Pages) write(w http.ResponseWriter, status int, page landingPage) {
+	var b bytes.Buffer
+	if err := landingTmpl.Execute(&b, page); err != nil {
+		log.Printf("ERROR rendering landing page: %v", err)
+		http.Error(w, page.Title, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Keep the token out of Referer headers sent from the page
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	b.WriteTo(w)
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"server/internal/budget"
+	"server/internal/domain"
+	"server/internal/fieldcrypt"
+	"server/internal/httpx"
+
+	"github.com/lib/pq"
+)
+
+// User is a student's account and profile.
+type User struct {
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	Phone         string `json:"phone"`
+	PickupStation string `json:"pickupStation"` // preferred station; empty means the default
+	Language      string `json:"language"`
+	Campus        string `json:"campus"`                 // decides which daily order capacity applies
+	Statements    bool   `json:"monthlyStatement"`       // emailed a statement at month end
+	Announcements bool   `json:"announcements"`          // sent announcement emails
+	PendingEmail  string `json:"pendingEmail,omitempty"` // awaiting confirmation via POST /me/email
+	// Budget is the weekly spending cap and this week's spend against it;
+	// only GET and PATCH /me fill it in.
+	Budget *budget.Usage `json:"budget,omitempty"`
+}
+
+// LoadUser looks up a user by id; it returns sql.ErrNoRows for unknown ids.
+func LoadUser(ctx context.Context, db *sql.DB, id int) (User, error) {
+	u := User{ID: id}
+	err := db.QueryRowContext(ctx,
+		`SELECT username, email, COALESCE(phone, ''), COALESCE(pickup_station, ''), language, campus, monthly_statement, announcements,
+		        CASE WHEN email_change_expires > NOW() THEN COALESCE(pending_email, '') ELSE '' END
+		   FROM users WHERE id = $1`,
+		id,
+	).Scan(&u.Username, &u.Email, fieldcrypt.Opened(&u.Phone), &u.PickupStation, &u.Language, &u.Campus, &u.Statements, &u.Announcements, &u.PendingEmail)
+	return u, err
+}
+
+// ProfileUpdate is the body of PATCH /me. Omitted fields are left alone; an
+// empty phone or pickupStation clears it.
+type ProfileUpdate struct {
+	Username      *string `json:"username" validate:"min=3,max=32"`
+	Phone         *string `json:"phone" validate:"max=20"`
+	PickupStation *string `json:"pickupStation" validate:"max=32"`
+	Language      *string `json:"language" validate:"oneof=en lg sw"`
+	Campus        *string `json:"campus" validate:"min=1,max=64"`
+	Statements    *bool   `json:"monthlyStatement"`
+	Announcements *bool   `json:"announcements"`
+	WeeklyBudget  *int    `json:"weeklyBudget" validate:"min=0"` // UGX per week; 0 removes the cap
+	BudgetMode    *string `json:"budgetMode" validate:"oneof=warn block"`
+}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{9,15}$`)
+
+// normalizePhone drops the spaces and dashes people type, e.g. "+256 772-123456".
+func normalizePhone(s string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(s))
+}
+
+// MakeProfileHandler returns the logged-in user's profile on GET and applies
+// a ProfileUpdate on PATCH.
+func MakeProfileHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(ContextUserIDKey).(int)
+		if !ok {
+			http.Error(w, "failed to get user from context", http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPatch:
+			if !updateProfile(w, r, db, userID) {
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		u, err := LoadUser(r.Context(), db, userID)
+		if err != nil {
+			httpx.WriteError(w, domain.NotFound("user not found"))
+			return
+		}
+		usage, err := budget.Load(r.Context(), db, userID, 0)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		u.Budget = &usage
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(u)
+	}
+}
+
+// updateProfile applies the PATCH body and reports whether it succeeded; on
+// failure the response has been written.
+func updateProfile(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int) bool {
+	var req ProfileUpdate
+	if !httpx.DecodeJSON(w, r, &req) {
+		return false
+	}
+
+	var sets []string
+	var args []interface{}
+	set := func(column string, v interface{}) {
+		args = append(args, v)
+		sets = append(sets, column+" = $"+strconv.Itoa(len(args)))
+	}
+
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		var taken bool
+		if err := db.QueryRowContext(r.Context(),
+			`SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(username) = LOWER($1) AND id <> $2)`,
+			username, userID,
+		).Scan(&taken); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return false
+		}
+		if taken {
+			httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "username", Message: "is already taken"}})
+			return false
+		}
+		set("username", username)
+	}
+	if req.Phone != nil {
+		phone := normalizePhone(*req.Phone)
+		if phone != "" && !phonePattern.MatchString(phone) {
+			httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "phone", Message: "must be a phone number such as +256772123456"}})
+			return false
+		}
+		set("phone", fieldcrypt.Sealed(phone))
+		set("phone_hash", fieldcrypt.Index(phone))
+	}
+	if req.PickupStation != nil {
+		station := strings.TrimSpace(*req.PickupStation)
+		set("pickup_station", sql.NullString{String: station, Valid: station != ""})
+	}
+	if req.Language != nil {
+		set("language", *req.Language)
+	}
+	if req.Campus != nil {
+		set("campus", strings.TrimSpace(*req.Campus))
+	}
+	if req.Statements != nil {
+		set("monthly_statement", *req.Statements)
+	}
+	if req.Announcements != nil {
+		set("announcements", *req.Announcements)
+	}
+	if req.WeeklyBudget != nil || req.BudgetMode != nil {
+		// A budget support set, e.g. at a parent's request, stays as it is
+		var locked bool
+		if err := db.QueryRowContext(r.Context(),
+			`SELECT budget_locked FROM users WHERE id = $1`, userID,
+		).Scan(&locked); err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return false
+		}
+		if locked {
+			field := "weeklyBudget"
+			if req.WeeklyBudget == nil {
+				field = "budgetMode"
+			}
+			httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: field, Message: "is locked; contact support to change it"}})
+			return false
+		}
+	}
+	if req.WeeklyBudget != nil {
+		set("weekly_budget", sql.NullInt64{Int64: int64(*req.WeeklyBudget), Valid: *req.WeeklyBudget > 0})
+	}
+	if req.BudgetMode != nil {
+		set("budget_mode", *req.BudgetMode)
+	}
+	if len(sets) == 0 {
+		return true
+	}
+
+	args = append(args, userID)
+	q := `UPDATE users SET ` + strings.Join(sets, ", ") + ` WHERE id = $` + strconv.Itoa(len(args))
+	if _, err := db.ExecContext(r.Context(), q, args...); err != nil {
+		// A concurrent update can still claim the name or number first
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			field := "username"
+			if pqErr.Constraint == "idx_users_phone_hash" {
+				field = "phone"
+			}
+			httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: field, Message: "is already taken"}})
+			return false
+		}
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "campus", Message: "is not a known campus"}})
+			return false
+		}
+		http.Error(w, "failed to update profile", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+// Session tokens are replaced on the first request after they are
+// rotateAfter old. The token replaced still signs in for rotationGrace, so
+// requests the browser sent before it saw the new cookie do not fail.
+const (
+	sessionCookie = "session_token"
+	rotateAfter   = 24 * time.Hour
+	rotationGrace = time.Minute
+)
+
+// execer is a *sql.DB or *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// hashToken is what the sessions table keeps of a token: its SHA-256, so a
+// copy of the table cannot be used to sign in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSessionToken returns a random token to hand out in a cookie.
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// createSession signs userID in for six months, returning the token for
+// their cookie.
+func createSession(ctx context.Context, db execer, userID int) (string, time.Time, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().AddDate(0, 6, 0)
+	const q = `INSERT INTO sessions (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err := db.ExecContext(ctx, q, userID, hashToken(token), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// setSessionCookie hands token to the browser until expiresAt.
+// Cross-site auth requires SameSite=None + Secure on HTTPS deployments.
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expiresAt time.Time) {
+	secureCookie := shouldUseSecureCookies(r)
+	sameSiteMode := http.SameSiteLaxMode
+	if secureCookie {
+		sameSiteMode = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   secureCookie,
+		SameSite: sameSiteMode,
+	})
+}
+
+// rotateSession gives the session stored as tokenHash a new token and sets
+// it as the cookie. Of several requests rotating the same session at once,
+// only the first does; the rest keep the token it replaced, which still
+// works for rotationGrace.
+func rotateSession(ctx context.Context, db *sql.DB, w http.ResponseWriter, r *http.Request, tokenHash string, expiresAt time.Time) error {
+	token, err := newSessionToken()
+	if err != nil {
+		return err
+	}
+	const q = `
+        UPDATE sessions
+           SET token_hash = $1, previous_hash = token_hash, rotated_at = NOW()
+         WHERE token_hash = $2 AND rotated_at < NOW() - $3 * INTERVAL '1 second'
+    `
+	res, err := db.ExecContext(ctx, q, hashToken(token), tokenHash, rotateAfter.Seconds())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		setSessionCookie(w, r, token, expiresAt)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/internal/httpx"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// VerificationTTL is how long an emailed verification link works. Until
+// then it can be opened any number of times, so a mail scanner fetching it
+// first does not spend it.
+const VerificationTTL = 48 * time.Hour
+
+// VerifyRequest is the JSON body of POST /verify; the token may instead come
+// in the query string or a form field.
+type VerifyRequest struct {
+	Token string `json:"token" validate:"required,max=128"`
+}
+
+// MakeVerifyHandler serves /verify in two steps, since link scanners fetch
+// every URL in an email. GET only checks the token and answers JSON, or,
+// for browsers asking for text/html, a page whose button confirms it; POST
+// verifies the account. Browsers get pages for every outcome, failures
+// included.
+// Confirming again before the token expires succeeds without changing
+// anything. verifications, when set, counts each step by event (viewed,
+// completed, repeated, invalid) so the completion rate can be graphed
+// against jaj_emails_total{kind="verification"}.
+func MakeVerifyHandler(db *sql.DB, verifications *prometheus.CounterVec, pages *Pages) http.HandlerFunc {
+	count := func(event string) {
+		if verifications != nil {
+			verifications.WithLabelValues(event).Inc()
+		}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			token := r.URL.Query().Get("token")
+			var verified bool
+			err := db.QueryRowContext(r.Context(),
+				`SELECT verified FROM users WHERE verification_token = $1 AND verification_expires > NOW()`,
+				token,
+			).Scan(&verified)
+			if token == "" || errors.Is(err, sql.ErrNoRows) {
+				count("invalid")
+				if wantsHTML(r) {
+					pages.write(w, http.StatusBadRequest, pages.verifyFailed())
+					return
+				}
+				http.Error(w, "invalid or expired token", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				if wantsHTML(r) {
+					pages.write(w, http.StatusInternalServerError, pages.verifyError())
+					return
+				}
+				http.Error(w, "verification failed", http.StatusInternalServerError)
+				return
+			}
+			count("viewed")
+			if !wantsHTML(r) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(struct {
+					Verified bool   `json:"verified"`
+					Message  string `json:"message"`
+				}{verified, "POST the token to /verify to confirm your email."})
+				return
+			}
+			if verified {
+				pages.write(w, http.StatusOK, pages.verified())
+				return
+			}
+			pages.write(w, http.StatusOK, landingPage{
+				Title:   "Confirm your email",
+				Message: "Press the button to finish setting up your JAJ account.",
+				Form:    "verify",
+				Token:   token,
+			})
+
+		case http.MethodPost:
+			form := strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+			req := VerifyRequest{Token: r.URL.Query().Get("token")}
+			if form {
+				req.Token = r.PostFormValue("token")
+			} else if req.Token == "" && !httpx.DecodeJSON(w, r, &req) {
+				return
+			}
+
+			// The token stays until it expires, so a second click still works
+			var wasVerified bool
+			err := db.QueryRowContext(r.Context(),
+				`UPDATE users u SET verified = TRUE
+				   FROM (SELECT id, verified FROM users WHERE verification_token = $1 AND verification_expires > NOW() FOR UPDATE) old
+				  WHERE u.id = old.id
+				 RETURNING old.verified`,
+				req.Token,
+			).Scan(&wasVerified)
+			if req.Token == "" || errors.Is(err, sql.ErrNoRows) {
+				count("invalid")
+				if form {
+					pages.write(w, http.StatusBadRequest, pages.verifyFailed())
+					return
+				}
+				http.Error(w, "invalid or expired token", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				if form {
+					pages.write(w, http.StatusInternalServerError, pages.verifyError())
+					return
+				}
+				http.Error(w, "verification failed", http.StatusInternalServerError)
+				return
+			}
+			if wasVerified {
+				count("repeated")
+			} else {
+				count("completed")
+			}
+			if form {
+				pages.write(w, http.StatusOK, pages.verified())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(Response{Message: "Email verified successfully."})
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// wantsHTML reports whether the client is a browser asking for a page.
+// Everyone else, including clients that send no Accept header, gets JSON.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func (p *Pages) verified() landingPage {
+	return landingPage{
+		Title:    "Email verified",
+		Message:  "Thanks! Your JAJ account is ready.",
+		LinkURL:  p.link("/login"),
+		LinkText: "Log in to JAJ",
+	}
+}
+
+func (p *Pages) verifyFailed() landingPage {
+	return landingPage{
+		Title: "This link has expired",
+		Message: "Verification links work for 48 hours, and this one is no longer valid. " +
+			"Contact JAJ support and we'll send you a new one.",
+		Failed:   true,
+		LinkURL:  p.link("/login"),
+		LinkText: "Go to JAJ",
+	}
+}
+
+func (p *Pages) verifyError() landingPage {
+	return landingPage{
+		Title:    "Something went wrong",
+		Message:  "We couldn't check your link just now. Please open it again in a few minutes.",
+		Failed:   true,
+		LinkURL:  p.link("/"),
+		LinkText: "Go to JAJ",
+	}
+}
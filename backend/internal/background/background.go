@@ -0,0 +1,68 @@
+// Package background runs work that outlives the request that started it,
+// such as an email sent after the response is written. A request's context
+// is cancelled as soon as its handler returns, so such work must not use
+// it: Task detaches from it, gives the work its own deadline, and counts
+// the work in flight so shutdown can wait for it.
+package background
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout bounds a Task that does not set its own.
+const DefaultTimeout = 30 * time.Second
+
+// waitPoll is how often Wait checks whether every task has finished.
+const waitPoll = 50 * time.Millisecond
+
+var inFlight atomic.Int64
+
+// Task starts a unit of background work from ctx. It returns a context that
+// keeps ctx's values (request ID, user) but not its cancellation, and times
+// out after DefaultTimeout, and a done func the work must call when it
+// finishes:
+//
+//	ctx, done := background.Task(r.Context())
+//	go func() {
+//		defer done()
+//		...
+//	}()
+func Task(ctx context.Context) (context.Context, func()) {
+	return TaskTimeout(ctx, DefaultTimeout)
+}
+
+// TaskTimeout is Task with its own deadline.
+func TaskTimeout(ctx context.Context, timeout time.Duration) (context.Context, func()) {
+	inFlight.Add(1)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			cancel()
+			inFlight.Add(-1)
+		})
+	}
+}
+
+// InFlight is how many tasks have started and not yet finished.
+func InFlight() int {
+	return int(inFlight.Load())
+}
+
+// Wait blocks until every task has finished or ctx is done, and returns how
+// many were still running.
+func Wait(ctx context.Context) int {
+	ticker := time.NewTicker(waitPoll)
+	defer ticker.Stop()
+	for InFlight() > 0 {
+		select {
+		case <-ctx.Done():
+			return InFlight()
+		case <-ticker.C:
+		}
+	}
+	return 0
+}
@@ -0,0 +1,103 @@
+// Package budget enforces students' weekly spending caps. Spend is the total
+// of orders confirmed since Monday 00:00 Kampala time; an order that would
+// take it past the cap needs the student's explicit go-ahead in warn mode
+// and is refused in block mode.
+package budget
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"server/internal/locale"
+)
+
+// Modes.
+const (
+	Warn  = "warn"
+	Block = "block"
+)
+
+// Usage is a student's cap and what they have spent against it this week.
+type Usage struct {
+	WeeklyLimit *int      `json:"weeklyLimit"` // nil when no cap is set
+	Mode        string    `json:"mode"`
+	Locked      bool      `json:"locked"` // set by support; only an admin can change it
+	WeekStart   time.Time `json:"weekStart"`
+	Spent       int       `json:"spent"`
+	Remaining   *int      `json:"remaining,omitempty"` // never negative
+}
+
+// WeekStart returns the Monday 00:00, Kampala time, of the week now falls in.
+func WeekStart(now time.Time) time.Time {
+	local := now.In(locale.EAT)
+	days := (int(local.Weekday()) + 6) % 7 // days since Monday
+	return time.Date(local.Year(), local.Month(), local.Day()-days, 0, 0, 0, 0, locale.EAT)
+}
+
+// Queryer is satisfied by *sql.DB and *sql.Tx.
+type Queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Load returns userID's usage this week, leaving out excludeOrderID (pass 0
+// for none), so an order being confirmed is not counted against itself.
+func Load(ctx context.Context, db Queryer, userID, excludeOrderID int) (Usage, error) {
+	u := Usage{WeekStart: WeekStart(time.Now())}
+	var limit sql.NullInt64
+	err := db.QueryRowContext(ctx,
+		`SELECT weekly_budget, budget_mode, budget_locked,
+		        COALESCE((SELECT SUM(o.total_cost)
+		                    FROM orders o
+		                   WHERE o.user_id = u.id AND o.id <> $3
+		                     AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		                     AND EXISTS (SELECT 1 FROM order_status_history h
+		                                  WHERE h.order_id = o.id AND h.status = 'CONFIRMED'
+		                                    AND h.changed_at >= $2)), 0)
+		   FROM users u WHERE u.id = $1`,
+		userID, u.WeekStart, excludeOrderID,
+	).Scan(&limit, &u.Mode, &u.Locked, &u.Spent)
+	if err != nil {
+		return Usage{}, err
+	}
+	if limit.Valid {
+		n := int(limit.Int64)
+		left := max(n-u.Spent, 0)
+		u.WeeklyLimit, u.Remaining = &n, &left
+	}
+	return u, nil
+}
+
+// ExceededError is returned by Check when an order would take the student
+// past their weekly cap.
+type ExceededError struct {
+	Usage      Usage
+	OrderTotal int
+}
+
+// CanOverride reports whether the student may confirm anyway.
+func (e *ExceededError) CanOverride() bool { return e.Usage.Mode != Block }
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("This order (UGX %d) would take you over your weekly budget of UGX %d: you have UGX %d left this week.",
+		e.OrderTotal, *e.Usage.WeeklyLimit, *e.Usage.Remaining)
+}
+
+// Check returns *ExceededError if confirming orderID at total would take
+// userID past their cap, unless the cap is in warn mode and override is set.
+// Call it in the confirming transaction, after the order is priced.
+func Check(ctx context.Context, tx *sql.Tx, userID, orderID, total int, override bool) error {
+	u, err := Load(ctx, tx, userID, orderID)
+	if err != nil {
+		return err
+	}
+	if u.WeeklyLimit == nil || u.Spent+total <= *u.WeeklyLimit {
+		return nil
+	}
+	e := &ExceededError{Usage: u, OrderTotal: total}
+	if override && e.CanOverride() {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,351 @@
+// Package campaigns holds announcement emails, such as "no deliveries on
+// Friday's public holiday": an admin composes one, picks an audience, and a
+// background job sends it at a throttled rate while opens and bounces are
+// counted against it.
+package campaigns
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"server/internal/domain"
+	"server/internal/orders"
+	"server/internal/segments"
+)
+
+// Campaign statuses. A DRAFT may be edited; sending snapshots the audience
+// and moves it to SENDING until every recipient has been tried (SENT) or an
+// admin stops it (CANCELLED).
+const (
+	StatusDraft     = "DRAFT"
+	StatusSending   = "SENDING"
+	StatusSent      = "SENT"
+	StatusCancelled = "CANCELLED"
+)
+
+// Audiences a campaign can go to, besides each of segments.All. All are
+// limited to verified addresses.
+const (
+	AudienceVerified = "VERIFIED"   // every verified student
+	AudienceActive   = "ACTIVE_30D" // signed in or ordered in the last 30 days
+)
+
+// audienceWhere selects each audience's users, aliased u. Students who
+// unsubscribed from announcements are never in one.
+var audienceWhere = map[string]string{
+	AudienceVerified: `u.verified AND u.announcements`,
+	AudienceActive: `u.verified AND u.announcements
+	   AND (EXISTS (SELECT 1 FROM sessions s WHERE s.user_id = u.id AND s.created_at >= NOW() - INTERVAL '30 days')
+	     OR EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.created_at >= NOW() - INTERVAL '30 days'))`,
+}
+
+func init() {
+	// A segment audience is who was in the segment at its last refresh
+	for _, segment := range segments.All {
+		audienceWhere[segment] = `u.verified AND u.announcements
+		   AND EXISTS (SELECT 1 FROM user_segments s WHERE s.user_id = u.id AND s.segment = '` + segment + `')`
+	}
+}
+
+var (
+	// ErrNotFound means there is no campaign with that ID.
+	ErrNotFound = domain.NotFound("campaign not found")
+	// ErrNotDraft means the campaign has already been sent or cancelled.
+	ErrNotDraft = domain.Conflict("campaign is no longer a draft")
+	// ErrFinished means the campaign has already finished sending.
+	ErrFinished = domain.Conflict("campaign has already finished")
+)
+
+// TemplateError is a subject or body that does not parse or render.
+type TemplateError struct {
+	Field string // "subject" or "body"
+	Err   error
+}
+
+func (e *TemplateError) Error() string { return e.Err.Error() }
+
+// Recipient is what a campaign's subject and body can refer to, e.g.
+// "Hi {{.Username}}, pickup at {{.PickupStation}} is closed on Friday".
+type Recipient struct {
+	Username      string
+	PickupStation string
+}
+
+// Draft is the body of POST and PUT /admin/campaigns.
+type Draft struct {
+	Subject  string `json:"subject" validate:"required,max=200"`
+	Body     string `json:"body" validate:"required,max=20000"`
+	Audience string `json:"audience" validate:"required,oneof=VERIFIED ACTIVE_30D NEW WEEKLY_ACTIVE CHURN_RISK HIGH_SPENDER"`
+}
+
+// Stats counts what happened to a campaign's emails so far. Opens are a
+// lower bound: they need the client to load images.
+type Stats struct {
+	Recipients int `json:"recipients"`
+	Pending    int `json:"pending"`
+	Sent       int `json:"sent"`
+	Failed     int `json:"failed"`
+	Suppressed int `json:"suppressed"` // skipped after an earlier bounce or complaint
+	Opened     int `json:"opened"`
+	Bounced    int `json:"bounced"`
+	Complained int `json:"complained"`
+}
+
+// Campaign is an announcement and how its sending is going.
+type Campaign struct {
+	ID           int        `json:"id"`
+	Subject      string     `json:"subject"`
+	Body         string     `json:"body"`
+	Audience     string     `json:"audience"`
+	Status       string     `json:"status"`
+	CreatedBy    *int       `json:"createdBy"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+	Stats        Stats      `json:"stats"`
+	AudienceSize *int       `json:"audienceSize,omitempty"` // drafts only: who it would go to now
+}
+
+// parse compiles a subject and body, and renders them once for a sample
+// recipient so that unknown fields are caught before anything is sent.
+func parse(subject, body string) (*template.Template, *template.Template, error) {
+	sample := Recipient{Username: "student", PickupStation: orders.PickupStation}
+	var out [2]*template.Template
+	for i, f := range []struct{ field, text string }{{"subject", subject}, {"body", body}} {
+		t, err := template.New(f.field).Option("missingkey=error").Parse(f.text)
+		if err == nil {
+			err = t.Execute(&strings.Builder{}, sample)
+		}
+		if err != nil {
+			return nil, nil, &TemplateError{Field: f.field, Err: err}
+		}
+		out[i] = t
+	}
+	return out[0], out[1], nil
+}
+
+// Create saves a draft campaign and returns its id, or a *TemplateError.
+func Create(ctx context.Context, db *sql.DB, adminID int, d Draft) (int, error) {
+	if _, _, err := parse(d.Subject, d.Body); err != nil {
+		return 0, err
+	}
+	var id int
+	err := db.QueryRowContext(ctx,
+		`INSERT INTO email_campaigns (subject, body, audience, created_by) VALUES ($1, $2, $3, NULLIF($4, 0)) RETURNING id`,
+		strings.TrimSpace(d.Subject), d.Body, d.Audience, adminID,
+	).Scan(&id)
+	return id, err
+}
+
+// Update replaces a draft's content. It returns ErrNotFound, ErrNotDraft,
+// or a *TemplateError.
+func Update(ctx context.Context, db *sql.DB, id int, d Draft) error {
+	if _, _, err := parse(d.Subject, d.Body); err != nil {
+		return err
+	}
+	res, err := db.ExecContext(ctx,
+		`UPDATE email_campaigns SET subject = $2, body = $3, audience = $4, updated_at = NOW()
+		  WHERE id = $1 AND status = 'DRAFT'`,
+		id, strings.TrimSpace(d.Subject), d.Body, d.Audience,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return missingOr(ctx, db, id, ErrNotDraft)
+	}
+	return nil
+}
+
+// missingOr explains an update that matched no rows: ErrNotFound when
+// there is no campaign id, otherwise err.
+func missingOr(ctx context.Context, db *sql.DB, id int, err error) error {
+	var exists bool
+	if qerr := db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM email_campaigns WHERE id = $1)`, id,
+	).Scan(&exists); qerr != nil {
+		return qerr
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return err
+}
+
+// selectCampaigns reads campaigns, aliased c, with their stats.
+const selectCampaigns = `SELECT c.id, c.subject, c.body, c.audience, c.status, c.created_by, c.created_at, c.started_at, c.finished_at,
+	       s.recipients, s.pending, s.sent, s.failed, s.suppressed, s.opened, s.bounced, s.complained
+	  FROM email_campaigns c
+	  CROSS JOIN LATERAL (
+	    SELECT COUNT(*) AS recipients,
+	           COUNT(*) FILTER (WHERE r.status = 'PENDING') AS pending,
+	           COUNT(*) FILTER (WHERE r.status = 'SENT') AS sent,
+	           COUNT(*) FILTER (WHERE r.status = 'FAILED') AS failed,
+	           COUNT(*) FILTER (WHERE r.status = 'SUPPRESSED') AS suppressed,
+	           COUNT(*) FILTER (WHERE r.opened_at IS NOT NULL) AS opened,
+	           COUNT(*) FILTER (WHERE l.status = 'BOUNCED') AS bounced,
+	           COUNT(*) FILTER (WHERE l.status = 'COMPLAINED') AS complained
+	      FROM email_campaign_recipients r
+	      LEFT JOIN email_log l ON l.message_id = r.message_id
+	     WHERE r.campaign_id = c.id) s`
+
+func scanCampaign(row interface{ Scan(...interface{}) error }, c *Campaign) error {
+	var createdBy sql.NullInt64
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(&c.ID, &c.Subject, &c.Body, &c.Audience, &c.Status, &createdBy, &c.CreatedAt, &startedAt, &finishedAt,
+		&c.Stats.Recipients, &c.Stats.Pending, &c.Stats.Sent, &c.Stats.Failed, &c.Stats.Suppressed,
+		&c.Stats.Opened, &c.Stats.Bounced, &c.Stats.Complained); err != nil {
+		return err
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		c.CreatedBy = &id
+	}
+	if startedAt.Valid {
+		c.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		c.FinishedAt = &finishedAt.Time
+	}
+	return nil
+}
+
+// Get loads a campaign with its stats, or returns ErrNotFound. Drafts also
+// get their current audience size.
+func Get(ctx context.Context, db *sql.DB, id int) (Campaign, error) {
+	var c Campaign
+	if err := scanCampaign(db.QueryRowContext(ctx,
+		selectCampaigns+` WHERE c.id = $1`, id,
+	), &c); errors.Is(err, sql.ErrNoRows) {
+		return Campaign{}, ErrNotFound
+	} else if err != nil {
+		return Campaign{}, err
+	}
+	if c.Status == StatusDraft {
+		n, err := AudienceSize(ctx, db, c.Audience)
+		if err != nil {
+			return Campaign{}, err
+		}
+		c.AudienceSize = &n
+	}
+	return c, nil
+}
+
+// List returns campaigns newest first, with the total for paging.
+func List(ctx context.Context, db *sql.DB, limit, offset int) ([]Campaign, int, error) {
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM email_campaigns`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.QueryContext(ctx,
+		selectCampaigns+` ORDER BY c.created_at DESC, c.id DESC LIMIT $1 OFFSET $2`,
+		limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var list []Campaign
+	for rows.Next() {
+		var c Campaign
+		if err := scanCampaign(rows, &c); err != nil {
+			return nil, 0, err
+		}
+		list = append(list, c)
+	}
+	return list, total, rows.Err()
+}
+
+// AudienceSize counts who a campaign to audience would go to right now.
+func AudienceSize(ctx context.Context, db *sql.DB, audience string) (int, error) {
+	where, ok := audienceWhere[audience]
+	if !ok {
+		return 0, fmt.Errorf("unknown audience %q", audience)
+	}
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users u WHERE `+where).Scan(&n)
+	return n, err
+}
+
+// Start snapshots a draft's audience as its recipients and marks it
+// SENDING, returning how many recipients it has. Students who join the
+// audience later do not get it. Starting a campaign that is already SENDING
+// changes nothing and returns how many are still pending, so its send can
+// be queued again if the job was lost. It returns ErrNotFound or
+// ErrNotDraft.
+func Start(ctx context.Context, db *sql.DB, id int) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var status, audience string
+	if err := tx.QueryRowContext(ctx,
+		`SELECT status, audience FROM email_campaigns WHERE id = $1 FOR UPDATE`, id,
+	).Scan(&status, &audience); errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	} else if err != nil {
+		return 0, err
+	}
+	if status == StatusSending {
+		var pending int
+		err := tx.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM email_campaign_recipients WHERE campaign_id = $1 AND status = 'PENDING'`, id,
+		).Scan(&pending)
+		return pending, err
+	}
+	if status != StatusDraft {
+		return 0, ErrNotDraft
+	}
+	where, ok := audienceWhere[audience]
+	if !ok {
+		return 0, fmt.Errorf("unknown audience %q", audience)
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO email_campaign_recipients (campaign_id, user_id, email)
+		 SELECT $1, u.id, u.email FROM users u WHERE `+where,
+		id,
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE email_campaigns SET status = 'SENDING', started_at = NOW(), updated_at = NOW() WHERE id = $1`, id,
+	); err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// Cancel stops a draft or a campaign that is still sending; recipients not
+// yet reached stay PENDING. It returns ErrNotFound or ErrFinished.
+func Cancel(ctx context.Context, db *sql.DB, id int) error {
+	res, err := db.ExecContext(ctx,
+		`UPDATE email_campaigns SET status = 'CANCELLED', finished_at = NOW(), updated_at = NOW()
+		  WHERE id = $1 AND status IN ('DRAFT', 'SENDING')`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return missingOr(ctx, db, id, ErrFinished)
+	}
+	return nil
+}
+
+// RecordOpen notes the first time the email carrying token was opened.
+func RecordOpen(ctx context.Context, db *sql.DB, token string) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE email_campaign_recipients SET opened_at = NOW() WHERE open_token = $1 AND opened_at IS NULL`, token)
+	return err
+}
@@ -0,0 +1,177 @@
+package campaigns
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"server/internal/email"
+	"server/internal/orders"
+
+	"go.uber.org/zap"
+)
+
+// sendBatch is how many pending recipients Send loads at a time; it checks
+// for cancellation between batches.
+const sendBatch = 50
+
+// Sender sends campaigns' emails, at most PerMinute of them a minute so the
+// relay's rate limits and the students' inboxes are spared.
+type Sender struct {
+	DB        *sql.DB
+	Mailer    *email.Client
+	Logger    *zap.Logger
+	BaseURL   string // where tracking pixels point
+	PerMinute int
+}
+
+// NewSender returns a Sender, defaulting perMinute to 60.
+func NewSender(db *sql.DB, mailer *email.Client, logger *zap.Logger, baseURL string, perMinute int) *Sender {
+	if perMinute <= 0 {
+		perMinute = 60
+	}
+	return &Sender{DB: db, Mailer: mailer, Logger: logger, BaseURL: strings.TrimRight(baseURL, "/"), PerMinute: perMinute}
+}
+
+// pendingRecipient is one recipient Send has still to try.
+type pendingRecipient struct {
+	userID    int
+	email     string
+	openToken string
+	Recipient
+}
+
+// Send works through a SENDING campaign's pending recipients until none are
+// left, the campaign is cancelled, or until passes. It reports whether the
+// campaign is finished; if not, call it again to carry on. Each recipient is
+// marked once tried, so a send cut short by a crash resumes where it
+// stopped, at worst repeating the one email in flight.
+func (s *Sender) Send(ctx context.Context, campaignID int, until time.Time) (bool, error) {
+	throttle := time.NewTicker(time.Minute / time.Duration(s.PerMinute))
+	defer throttle.Stop()
+
+	for time.Now().Before(until) {
+		var status, subject, body string
+		if err := s.DB.QueryRowContext(ctx,
+			`SELECT status, subject, body FROM email_campaigns WHERE id = $1`, campaignID,
+		).Scan(&status, &subject, &body); err != nil {
+			return false, err
+		}
+		if status != StatusSending {
+			return true, nil
+		}
+		subjectT, bodyT, err := parse(subject, body)
+		if err != nil {
+			return false, err
+		}
+
+		batch, err := s.pending(ctx, campaignID)
+		if err != nil {
+			return false, err
+		}
+		if len(batch) == 0 {
+			_, err := s.DB.ExecContext(ctx,
+				`UPDATE email_campaigns SET status = 'SENT', finished_at = NOW(), updated_at = NOW()
+				  WHERE id = $1 AND status = 'SENDING'`, campaignID)
+			return err == nil, err
+		}
+
+		for _, rcpt := range batch {
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-throttle.C:
+			}
+			if err := s.sendOne(ctx, campaignID, subjectT, bodyT, rcpt); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// pending loads the next batch of recipients not yet tried.
+func (s *Sender) pending(ctx context.Context, campaignID int) ([]pendingRecipient, error) {
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT r.user_id, r.email, r.open_token, u.username, COALESCE(NULLIF(u.pickup_station, ''), $2)
+		   FROM email_campaign_recipients r
+		   JOIN users u ON u.id = r.user_id
+		  WHERE r.campaign_id = $1 AND r.status = 'PENDING'
+		  ORDER BY r.user_id
+		  LIMIT $3`,
+		campaignID, orders.PickupStation, sendBatch,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []pendingRecipient
+	for rows.Next() {
+		var p pendingRecipient
+		if err := rows.Scan(&p.userID, &p.email, &p.openToken, &p.Username, &p.PickupStation); err != nil {
+			return nil, err
+		}
+		batch = append(batch, p)
+	}
+	return batch, rows.Err()
+}
+
+// sendOne personalises and sends one email and records the outcome. Send
+// failures are recorded against the recipient, not returned; only database
+// errors are.
+func (s *Sender) sendOne(ctx context.Context, campaignID int, subjectT, bodyT *template.Template, p pendingRecipient) error {
+	status, msgID := "SENT", s.Mailer.NewMessageID()
+	var subject, body strings.Builder
+	err := subjectT.Execute(&subject, p.Recipient)
+	if err == nil {
+		err = bodyT.Execute(&body, p.Recipient)
+	}
+	if err == nil {
+		err = s.Mailer.SendCampaignEmail(p.email, msgID, email.CampaignData{
+			Subject:        strings.Join(strings.Fields(subject.String()), " "),
+			Body:           body.String(),
+			OpenURL:        s.BaseURL + "/email/open/" + p.openToken + ".gif",
+			UnsubscribeURL: s.Mailer.UnsubscribeURL(p.userID, email.ListAnnouncements),
+		})
+	}
+	switch {
+	case errors.Is(err, email.ErrSuppressed):
+		status = "SUPPRESSED"
+	case err != nil:
+		status = "FAILED"
+		s.Logger.Warn("campaign email failed", zap.Int("campaign_id", campaignID), zap.Int("user_id", p.userID), zap.Error(err))
+	}
+
+	_, err = s.DB.ExecContext(ctx,
+		`UPDATE email_campaign_recipients SET status = $3, message_id = $4, sent_at = NOW()
+		  WHERE campaign_id = $1 AND user_id = $2`,
+		campaignID, p.userID, status, msgID)
+	return err
+}
+
+// MakeOpenHandler serves the tracking pixel at GET /email/open/{token},
+// recording the open. It always answers with the pixel, so a bad token
+// reveals nothing.
+func MakeOpenHandler(db *sql.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSuffix(r.PathValue("token"), ".gif")
+		if err := RecordOpen(r.Context(), db, token); err != nil && !errors.Is(err, context.Canceled) {
+			logger.Warn("failed to record campaign open", zap.Error(err))
+		}
+		w.Header().Set("Content-Type", "image/gif")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(pixel)
+	}
+}
+
+// pixel is a transparent 1x1 GIF.
+var pixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
@@ -0,0 +1,95 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"server/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrAliasTaken means another item already has the alias.
+	ErrAliasTaken = domain.Conflict("alias is already used by another item")
+	// ErrAliasNotFound means there is no alias with that ID.
+	ErrAliasNotFound = domain.NotFound("alias not found")
+	// ErrUnknownItem means an alias was given for an item that does not exist.
+	ErrUnknownItem = domain.Invalid("itemId", "is not a known item")
+)
+
+// Alias is another name for an item, in the language students use it in.
+type Alias struct {
+	ID        int       `json:"id"`
+	ItemID    int       `json:"itemId" validate:"required,min=1"`
+	ItemName  string    `json:"itemName"`
+	Alias     string    `json:"alias" validate:"required,max=100"`
+	Language  string    `json:"language" validate:"omitempty,oneof=en lg sw"` // defaults to en
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ListAliases returns aliases by item name then alias, for one item or, with
+// itemID 0, all of them.
+func ListAliases(ctx context.Context, db *sql.DB, itemID int) ([]Alias, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT a.id, a.item_id, i.name, a.alias, a.language, a.created_at
+		   FROM item_aliases a
+		   JOIN items i ON i.id = a.item_id
+		  WHERE $1 = 0 OR a.item_id = $1
+		  ORDER BY i.name, LOWER(a.alias)`,
+		itemID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := []Alias{}
+	for rows.Next() {
+		var a Alias
+		if err := rows.Scan(&a.ID, &a.ItemID, &a.ItemName, &a.Alias, &a.Language, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// CreateAlias saves a.Alias for a.ItemID, trimmed, and fills in the rest of
+// a. It returns ErrUnknownItem, or ErrAliasTaken if the alias, ignoring
+// case, already names an item.
+func CreateAlias(ctx context.Context, db *sql.DB, adminID int, a *Alias) error {
+	a.Alias = strings.Join(strings.Fields(a.Alias), " ")
+	if a.Language == "" {
+		a.Language = "en"
+	}
+	err := db.QueryRowContext(ctx,
+		`INSERT INTO item_aliases (item_id, alias, language, created_by)
+		 SELECT id, $2, $3, NULLIF($4, 0) FROM items WHERE id = $1
+		 RETURNING id, created_at, (SELECT name FROM items WHERE id = $1)`,
+		a.ItemID, a.Alias, a.Language, adminID,
+	).Scan(&a.ID, &a.CreatedAt, &a.ItemName)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrAliasTaken
+	} else if errors.Is(err, sql.ErrNoRows) {
+		return ErrUnknownItem
+	}
+	return err
+}
+
+// DeleteAlias removes an alias and returns the item it named, or
+// ErrAliasNotFound.
+func DeleteAlias(ctx context.Context, db *sql.DB, id int) (int, error) {
+	var itemID int
+	err := db.QueryRowContext(ctx,
+		`DELETE FROM item_aliases WHERE id = $1 RETURNING item_id`, id,
+	).Scan(&itemID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrAliasNotFound
+	}
+	return itemID, err
+}
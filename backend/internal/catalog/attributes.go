@@ -0,0 +1,46 @@
+package catalog
+
+import (
+	"sort"
+	"strings"
+)
+
+// Attributes are an item's product details, stored as the items.attributes
+// JSONB column.
+type Attributes struct {
+	Brand string `json:"brand,omitempty" validate:"max=64"`
+	Size  string `json:"size,omitempty" validate:"max=32"` // as printed, e.g. "250g" or "1L"
+	// Nutrition is per 100 g or ml, keyed by nutrient, e.g. "energy_kcal"
+	// or "sugar_g".
+	Nutrition map[string]float64 `json:"nutrition,omitempty"`
+	Tags      []string           `json:"tags,omitempty" validate:"max=20"` // e.g. "halal", "vegan", "sugar-free"
+}
+
+// Tag length limit, after normalizing.
+const maxTagLength = 32
+
+// Normalize trims the text fields and turns tags into a sorted set of
+// lower-case, hyphenated words, so "Sugar Free" and "sugar-free" are the
+// same tag. Tags longer than maxTagLength are dropped.
+func (a *Attributes) Normalize() {
+	a.Brand = strings.TrimSpace(a.Brand)
+	a.Size = strings.TrimSpace(a.Size)
+	a.Tags = NormalizeTags(a.Tags)
+}
+
+// NormalizeTags returns tags lower-cased, hyphenated, de-duplicated, and
+// sorted.
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, t := range tags {
+		t = strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(t, "_", " "))), "-")
+		if t == "" || len(t) > maxTagLength || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,157 @@
+// Package catalog serves the catalogpb.Catalog gRPC API from Postgres, and
+// the MCP service's legacy JSON "/query" contract on top of it so callers
+// can move over one at a time.
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"server/internal/catalogpb"
+
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TopicChanged is published on the event bus after an admin changes items
+// or their scheduled prices, so copies of the catalog can be rebuilt.
+const TopicChanged = "catalog.changed"
+
+// Result limits for SearchItems.
+const (
+	defaultResults = 1
+	maxResults     = 50
+	maxTerms       = 8
+)
+
+// Server implements catalogpb.CatalogServer.
+type Server struct {
+	catalogpb.UnimplementedCatalogServer
+	DB *sql.DB
+}
+
+// NewServer returns a catalog server reading items from db.
+func NewServer(db *sql.DB) *Server {
+	return &Server{DB: db}
+}
+
+// SearchItems ranks items whose name, brand, tags, or aliases contain any
+// word of the query: an exact name or alias first, then names starting with
+// the query, then by how many words match, then shorter names. With tags, only items
+// carrying all of them are searched, and the query may be empty.
+func (s *Server) SearchItems(ctx context.Context, req *catalogpb.SearchItemsRequest) (*catalogpb.SearchItemsResponse, error) {
+	query := strings.TrimSpace(req.GetQuery())
+	var patterns []string
+	for _, f := range strings.Fields(strings.ToLower(query)) {
+		patterns = append(patterns, "%"+escapeLike(f)+"%")
+		if len(patterns) == maxTerms {
+			break
+		}
+	}
+	tags := NormalizeTags(req.GetTags())
+	if len(patterns) == 0 {
+		if len(tags) == 0 {
+			return nil, status.Error(codes.InvalidArgument, "query or tags are required")
+		}
+		patterns = []string{"%"}
+	}
+	limit := int(req.GetMaxResults())
+	if limit <= 0 {
+		limit = defaultResults
+	}
+	if limit > maxResults {
+		limit = maxResults
+	}
+
+	const matches = `(name ILIKE %[1]s OR attributes->>'brand' ILIKE %[1]s
+	                 OR EXISTS (SELECT 1 FROM jsonb_array_elements_text(attributes->'tags') t WHERE t ILIKE %[1]s)
+	                 OR EXISTS (SELECT 1 FROM item_aliases a WHERE a.item_id = items.id AND a.alias ILIKE %[1]s))`
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT id, name, category, item_price(id, NOW()), price_ugx, available, attributes
+		   FROM items
+		  WHERE `+fmt.Sprintf(matches, "ANY ($1)")+`
+		    AND (available OR NOT $4)
+		    AND COALESCE(attributes->'tags', '[]') ?& $6
+		  ORDER BY (LOWER(name) = LOWER($2)
+		            OR EXISTS (SELECT 1 FROM item_aliases a WHERE a.item_id = items.id AND LOWER(a.alias) = LOWER($2))) DESC,
+		           name ILIKE $3 DESC,
+		           (SELECT COUNT(*) FROM UNNEST($1::text[]) p WHERE `+fmt.Sprintf(matches, "p")+`) DESC,
+		           LENGTH(name), id
+		  LIMIT $5`,
+		pq.Array(patterns), query, escapeLike(query)+"%", req.GetAvailableOnly(), limit, pq.Array(tags),
+	)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "search items: %v", err)
+	}
+	defer rows.Close()
+
+	resp := &catalogpb.SearchItemsResponse{}
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "search items: %v", err)
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "search items: %v", err)
+	}
+	if len(resp.Items) == 0 && query != "" {
+		// Nothing contains the words; try names a typo or two away
+		item, err := s.closestItem(ctx, strings.ToLower(query), req.GetAvailableOnly(), tags)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "search items: %v", err)
+		}
+		if item != nil {
+			resp.Items = append(resp.Items, item)
+		}
+	}
+	return resp, nil
+}
+
+// GetItem returns one item by id.
+func (s *Server) GetItem(ctx context.Context, req *catalogpb.GetItemRequest) (*catalogpb.Item, error) {
+	item, err := scanItem(s.DB.QueryRowContext(ctx,
+		`SELECT id, name, category, item_price(id, NOW()), price_ugx, available, attributes FROM items WHERE id = $1`, req.GetId(),
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "item %d not found", req.GetId())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "get item: %v", err)
+	}
+	return item, nil
+}
+
+// scanItem reads id, name, category, the current and regular price,
+// available, and attributes.
+func scanItem(row interface{ Scan(...interface{}) error }) (*catalogpb.Item, error) {
+	item := &catalogpb.Item{}
+	var raw []byte
+	if err := row.Scan(&item.Id, &item.Name, &item.Category, &item.PriceUgx, &item.RegularPriceUgx, &item.Available, &raw); err != nil {
+		return nil, err
+	}
+	var a Attributes
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, fmt.Errorf("item %d attributes: %w", item.Id, err)
+	}
+	item.Attributes = &catalogpb.ItemAttributes{Brand: a.Brand, Size: a.Size, Nutrition: a.Nutrition, Tags: a.Tags}
+	return item, nil
+}
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\%_`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
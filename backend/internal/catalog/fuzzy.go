@@ -0,0 +1,88 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"server/internal/catalogpb"
+
+	"github.com/lib/pq"
+)
+
+// minFuzzyLength is the shortest query closestItem tries to correct; shorter
+// words are too easily a typo away from something unrelated.
+const minFuzzyLength = 4
+
+// closestItem returns the item whose name or alias, or one word of it, is
+// fewest edits from query, allowing one edit per four letters. It returns
+// nil when nothing is close enough. The catalog is small, so the names are
+// compared here rather than with a database extension.
+func (s *Server) closestItem(ctx context.Context, query string, availableOnly bool, tags []string) (*catalogpb.Item, error) {
+	if len([]rune(query)) < minFuzzyLength {
+		return nil, nil
+	}
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT id, LOWER(name) FROM items
+		  WHERE (available OR NOT $1) AND COALESCE(attributes->'tags', '[]') ?& $2
+		 UNION ALL
+		 SELECT a.item_id, LOWER(a.alias) FROM item_aliases a JOIN items i ON i.id = a.item_id
+		  WHERE (i.available OR NOT $1) AND COALESCE(i.attributes->'tags', '[]') ?& $2`,
+		availableOnly, pq.Array(tags),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limit := min(3, len([]rune(query))/4)
+	bestID, bestDist, bestLen := 0, limit+1, 0
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		d := EditDistance(query, name)
+		for _, word := range strings.Fields(name) {
+			d = min(d, EditDistance(query, word))
+		}
+		if d < bestDist || (d == bestDist && len(name) < bestLen) {
+			bestID, bestDist, bestLen = id, d, len(name)
+		}
+	}
+	if err := rows.Err(); err != nil || bestID == 0 {
+		return nil, err
+	}
+
+	item, err := scanItem(s.DB.QueryRowContext(ctx,
+		`SELECT id, name, category, item_price(id, NOW()), price_ugx, available, attributes FROM items WHERE id = $1`, bestID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // deleted in between
+	}
+	return item, err
+}
+
+// EditDistance is the Levenshtein distance between a and b, in runes.
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,118 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"server/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+// ErrNoOpenMisses means a phrase has nothing left to review.
+var ErrNoOpenMisses = domain.NotFound("no open misses for that phrase")
+
+// maxMissSamples is how many chat messages ListMisses shows per phrase.
+const maxMissSamples = 3
+
+// Miss is a product phrase chat could not match, grouped across every time
+// it was asked for and still open.
+type Miss struct {
+	Phrase   string    `json:"phrase"`
+	Count    int       `json:"count"`
+	Students int       `json:"students"`
+	LastSeen time.Time `json:"lastSeen"`
+	Samples  []string  `json:"samples"` // the latest messages it came from
+}
+
+// RecordMiss logs phrase, from message, as matching no item.
+func RecordMiss(ctx context.Context, db *sql.DB, userID int, phrase, message string) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO catalog_misses (phrase, user_id, message) VALUES ($1, NULLIF($2, 0), $3)`,
+		normalizePhrase(phrase), userID, message)
+	return err
+}
+
+// normalizePhrase lowercases phrase and collapses its spaces, so the same
+// request groups together however it was typed.
+func normalizePhrase(phrase string) string {
+	return strings.Join(strings.Fields(strings.ToLower(phrase)), " ")
+}
+
+// ListMisses returns the open phrases asked for since since, most asked for
+// first.
+func ListMisses(ctx context.Context, db *sql.DB, since time.Time, limit, offset int) ([]Miss, int, error) {
+	var total int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(DISTINCT phrase) FROM catalog_misses WHERE status = 'OPEN' AND created_at >= $1`, since,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT phrase, COUNT(*), COUNT(DISTINCT user_id), MAX(created_at),
+		        (ARRAY_AGG(message ORDER BY created_at DESC))[1:$4]
+		   FROM catalog_misses
+		  WHERE status = 'OPEN' AND created_at >= $1
+		  GROUP BY phrase
+		  ORDER BY COUNT(*) DESC, MAX(created_at) DESC, phrase
+		  LIMIT $2 OFFSET $3`,
+		since, limit, offset, maxMissSamples,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	misses := []Miss{}
+	for rows.Next() {
+		var m Miss
+		if err := rows.Scan(&m.Phrase, &m.Count, &m.Students, &m.LastSeen, pq.Array(&m.Samples)); err != nil {
+			return nil, 0, err
+		}
+		misses = append(misses, m)
+	}
+	return misses, total, rows.Err()
+}
+
+// MapMiss makes phrase an alias of a.ItemID in a.Language, so the matcher
+// finds it from now on, and closes its open misses. It returns the errors
+// CreateAlias does, and ErrNoOpenMisses.
+func MapMiss(ctx context.Context, db *sql.DB, adminID int, phrase string, a *Alias) error {
+	phrase = normalizePhrase(phrase)
+	var open bool
+	if err := db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM catalog_misses WHERE phrase = $1 AND status = 'OPEN')`, phrase,
+	).Scan(&open); err != nil {
+		return err
+	}
+	if !open {
+		return ErrNoOpenMisses
+	}
+
+	a.Alias = phrase
+	if err := CreateAlias(ctx, db, adminID, a); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx,
+		`UPDATE catalog_misses SET status = 'MAPPED', alias_id = $2, reviewed_at = NOW()
+		  WHERE phrase = $1 AND status = 'OPEN'`,
+		phrase, a.ID)
+	return err
+}
+
+// DismissMiss closes phrase's open misses without mapping it, e.g. for
+// things the shop does not sell. It returns how many it closed.
+func DismissMiss(ctx context.Context, db *sql.DB, phrase string) (int, error) {
+	res, err := db.ExecContext(ctx,
+		`UPDATE catalog_misses SET status = 'DISMISSED', reviewed_at = NOW()
+		  WHERE phrase = $1 AND status = 'OPEN'`,
+		normalizePhrase(phrase))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,87 @@
+package catalog
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"server/internal/catalogpb"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// legacyQuery is the MCP service's POST /query body. Only the "items" model
+// was ever queried, always for the same fields, so those are accepted and
+// otherwise ignored.
+type legacyQuery struct {
+	Model      string   `json:"model"`
+	Fields     []string `json:"fields"`
+	QueryText  string   `json:"queryText"`
+	MaxResults int      `json:"maxResults"`
+	Tags       []string `json:"tags"` // only items with all of these
+}
+
+// legacyItem is one element of the legacy response array.
+type legacyItem struct {
+	ID        int32  `json:"id"`
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	PriceUGX  int32  `json:"price_ugx"`
+	Available bool   `json:"available"`
+	// Product details; the MCP service never returned them, so they are
+	// omitted when empty for older clients.
+	Brand string   `json:"brand,omitempty"`
+	Size  string   `json:"size,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// MakeLegacyHandler serves the MCP service's POST /query contract from the
+// gRPC server, so clients still pointed at MCP_URL keep working during the
+// move to gRPC.
+func MakeLegacyHandler(s catalogpb.CatalogServer, logger *zap.Logger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /query", func(w http.ResponseWriter, r *http.Request) {
+		var q legacyQuery
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if q.Model != "" && q.Model != "items" {
+			http.Error(w, "unknown model", http.StatusBadRequest)
+			return
+		}
+
+		resp, err := s.SearchItems(r.Context(), &catalogpb.SearchItemsRequest{
+			Query:      q.QueryText,
+			MaxResults: int32(q.MaxResults),
+			Tags:       q.Tags,
+		})
+		if status.Code(err) == codes.InvalidArgument {
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("legacy catalog query failed", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		items := make([]legacyItem, 0, len(resp.GetItems()))
+		for _, it := range resp.GetItems() {
+			items = append(items, legacyItem{
+				ID:        it.GetId(),
+				Name:      it.GetName(),
+				Category:  it.GetCategory(),
+				PriceUGX:  it.GetPriceUgx(),
+				Available: it.GetAvailable(),
+				Brand:     it.GetAttributes().GetBrand(),
+				Size:      it.GetAttributes().GetSize(),
+				Tags:      it.GetAttributes().GetTags(),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	})
+	return mux
+}
@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"server/internal/locale"
+
+	"go.uber.org/zap"
+)
+
+// maxBrowseResults is how many items a catalog question is answered with.
+const maxBrowseResults = 5
+
+// catalogQuestions ask about the shop's products rather than order them:
+// "how much is milk?", "do you have eggs?", "what snacks do you have?". The
+// first group is what is asked about.
+var catalogQuestions = []*regexp.Regexp{
+	regexp.MustCompile(`^how much (?:is|are|does|do|for) (.+?)(?: cost)?$`),
+	regexp.MustCompile(`^(?:what(?:'s| is| are) )?(?:the )?prices? (?:of|for) (.+)$`),
+	regexp.MustCompile(`^(?:do|does) (?:you|jaj|the shop) (?:guys )?(?:have|sell|stock|carry) (.+)$`),
+	regexp.MustCompile(`^(?:have you got|got) (.+)$`),
+	regexp.MustCompile(`^(?:is|are) (?:there )?(.+?) (?:available|in stock)$`),
+	regexp.MustCompile(`^what (?:kinds? of |types? of |sorts? of )?(.+?) do you (?:have|sell|stock|carry)$`),
+}
+
+// browseFiller is trimmed from around what a catalog question asks about.
+var browseFiller = regexp.MustCompile(`^(?:(?:a|an|the|any|some|your|\d+)\s+)+|\s+(?:please|today|now|right now|in stock)$`)
+
+// notBrowsing are words that make a question about the student's order or
+// its fees rather than the catalog; those go to the order or menu answers.
+var notBrowsing = []string{"order", "delivery", "transport", "fee", "it", "that", "this", "them"}
+
+// catalogQuestion reports whether lowerText asks about the catalog, and
+// what it asks about.
+func catalogQuestion(lowerText string) (query string, ok bool) {
+	text := strings.TrimRight(strings.TrimSpace(lowerText), "?!. ")
+	for _, re := range catalogQuestions {
+		m := re.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		query = strings.TrimSpace(m[1])
+		for prev := ""; prev != query; {
+			prev, query = query, strings.TrimSpace(browseFiller.ReplaceAllString(query, ""))
+		}
+		if query == "" {
+			return "", false
+		}
+		for _, w := range strings.Fields(query) {
+			for _, n := range notBrowsing {
+				if w == n || w == n+"s" {
+					return "", false
+				}
+			}
+		}
+		return query, true
+	}
+	return "", false
+}
+
+// HandleAskCatalog answers a question about the catalog with the closest
+// items to query, their prices, and whether they are in stock. While the
+// catalog is down, or the search fails, the menu snapshot answers instead
+// if there is one.
+func (s *Service) HandleAskCatalog(ctx context.Context, userID int, message, query string) (Reply, error) {
+	if !s.health.Available(DependencyCatalog) {
+		return s.askCatalogFallback(ctx, userID, message), nil
+	}
+	items, err := s.catalog.SearchItems(ctx, query, maxBrowseResults)
+	if err == nil && len(items) == 0 && len(query) > 3 && strings.HasSuffix(query, "s") {
+		// "snacks" is tagged "snack"
+		items, err = s.catalog.SearchItems(ctx, strings.TrimSuffix(query, "s"), maxBrowseResults)
+	}
+	if err != nil {
+		s.logger.Warn("chat catalog search failed", zap.Int("user_id", userID), zap.String("query", query), zap.Error(err))
+		return s.askCatalogFallback(ctx, userID, message), nil
+	}
+	s.meter.WithLabelValues("ask_catalog").Inc()
+	if len(items) == 0 {
+		return Reply{IntentAskCatalog, 0, fmt.Sprintf(
+			"Sorry, we don't have anything matching \"%s\". Try another name, or ask \"what drinks do you have?\".", query)}, nil
+	}
+	return Reply{IntentAskCatalog, 0, summarizeItems(query, items, s.campusLocale(ctx, userID))}, nil
+}
+
+// askCatalogFallback answers a catalog question from the menu snapshot, or
+// apologises when there is none.
+func (s *Service) askCatalogFallback(ctx context.Context, userID int, message string) Reply {
+	if answer := s.answerFromMenu(ctx, userID, message); answer != "" {
+		s.meter.WithLabelValues("catalog_question").Inc()
+		return Reply{IntentCatalogQuestion, 0, answer}
+	}
+	s.meter.WithLabelValues("catalog_down").Inc()
+	return Reply{IntentCatalogDown, 0, "Sorry, I can't look up our products right now. Please try again in a few minutes."}
+}
+
+// summarizeItems lists the items found for query, best match first, with
+// prices written in l, and suggests how to order one.
+func summarizeItems(query string, items []CatalogItem, l locale.Locale) string {
+	lines := []string{fmt.Sprintf("Here's what we have for \"%s\":", query)}
+	var order string
+	for _, item := range items {
+		line := fmt.Sprintf("- %s: %s", item.Name, l.Money(item.PriceUGX))
+		if !item.Available {
+			line += " (sold out)"
+		} else if order == "" {
+			order = item.Name
+		}
+		lines = append(lines, line)
+	}
+	if order == "" {
+		lines = append(lines, "They're all sold out right now; please check back later.")
+	} else {
+		lines = append(lines, fmt.Sprintf("To order, just say e.g. \"1 %s\".", order))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,105 @@
+// Package chatfake provides deterministic stand-ins for the LLM and the MCP
+// catalog so the chat handler can be exercised without network access.
+package chatfake
+
+import (
+	"context"
+	"strings"
+
+	"server/internal/chat"
+)
+
+// Extractor is a chat.ProductExtractor that answers from a fixed table keyed
+// by the exact user message. Unknown messages yield no products.
+type Extractor struct {
+	Replies map[string][]chat.ParsedProduct
+	Err     error // returned for every call when set
+
+	Calls []string // messages seen, in order
+}
+
+// ExtractProducts implements chat.ProductExtractor.
+func (e *Extractor) ExtractProducts(_ context.Context, message string) ([]chat.ParsedProduct, error) {
+	e.Calls = append(e.Calls, message)
+	if e.Err != nil {
+		return nil, e.Err
+	}
+	return e.Replies[message], nil
+}
+
+// MenuAnswerer is a chat.MenuAnswerer that answers from a fixed table keyed
+// by the exact user message. Unknown messages are not catalog questions.
+type MenuAnswerer struct {
+	Answers map[string]string
+	Err     error // returned for every call when set
+}
+
+// AnswerFromMenu implements chat.MenuAnswerer.
+func (a *MenuAnswerer) AnswerFromMenu(_ context.Context, _ chat.Persona, _, message string) (string, error) {
+	if a.Err != nil {
+		return "", a.Err
+	}
+	return a.Answers[message], nil
+}
+
+// Catalog is a chat.CatalogSearcher over an in-memory item list. Names match
+// case-insensitively on substring, like a very forgiving search.
+type Catalog struct {
+	Items []chat.CatalogItem
+	Err   error // returned for every call when set
+}
+
+// SearchItem implements chat.CatalogSearcher.
+func (c *Catalog) SearchItem(_ context.Context, name string) (*chat.CatalogItem, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	needle := strings.ToLower(name)
+	for i := range c.Items {
+		if strings.Contains(strings.ToLower(c.Items[i].Name), needle) {
+			item := c.Items[i]
+			return &item, nil
+		}
+	}
+	return nil, nil
+}
+
+// SearchItems implements chat.CatalogSearcher, returning up to limit
+// matches in list order.
+func (c *Catalog) SearchItems(_ context.Context, query string, limit int) ([]chat.CatalogItem, error) {
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	needle := strings.ToLower(query)
+	var items []chat.CatalogItem
+	for _, item := range c.Items {
+		if len(items) == limit {
+			break
+		}
+		if strings.Contains(strings.ToLower(item.Name), needle) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// Moderator is a chat.Moderator that flags any message containing one of
+// Flag, case-insensitively.
+type Moderator struct {
+	Flag []string
+	Err  error // returned for every call when set
+}
+
+// Check implements chat.Moderator.
+func (m *Moderator) Check(_ context.Context, message string) (chat.Verdict, error) {
+	if m.Err != nil {
+		return chat.Verdict{}, m.Err
+	}
+	lower := strings.ToLower(message)
+	for _, f := range m.Flag {
+		if strings.Contains(lower, strings.ToLower(f)) {
+			return chat.Verdict{Flagged: true, Reason: "fake:" + f}, nil
+		}
+	}
+	return chat.Verdict{}, nil
+}
@@ -0,0 +1,362 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"server/internal/locale"
+	"server/internal/orders"
+	"server/internal/pricing"
+	"server/internal/tax"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Clarification limits: how many variants one question lists, and how many
+// words an unrecognised answer may have before it counts as a new request
+// rather than a muddled answer.
+const (
+	maxClarifyOptions = 6
+	maxAnswerWords    = 3
+)
+
+// Clarification is a product the student named that matches several sizes
+// of one item, e.g. "milk" with Jesa Milk (500ml) and Jesa Milk (2L) in
+// stock. The draft waits on it until the student picks one.
+type Clarification struct {
+	ID       int
+	Phrase   string // as the student wrote it
+	Quantity int
+	Options  []CatalogItem // ID, Name, PriceUGX, and Available only
+}
+
+// sizeSuffix is the parenthesised size ending an item name; the variants of
+// one item share the rest.
+var sizeSuffix = regexp.MustCompile(`\s*\([^)]*\)\s*$`)
+
+func baseName(name string) string {
+	return strings.TrimSpace(sizeSuffix.ReplaceAllString(name, ""))
+}
+
+// unitWords spell out size units the way item names abbreviate them.
+var unitWords = map[string]string{
+	"litre": "l", "litres": "l", "liter": "l", "liters": "l", "ltr": "l", "ltrs": "l",
+	"millilitres": "ml", "milliliters": "ml", "gram": "g", "grams": "g", "gms": "g",
+	"kilo": "kg", "kilos": "kg", "kgs": "kg",
+}
+
+// ordinalWords pick an option by position.
+var ordinalWords = map[string]int{
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5, "sixth": 6,
+	"1st": 1, "2nd": 2, "3rd": 3, "4th": 4, "5th": 5, "6th": 6,
+}
+
+// sizeOf is the part of an item's name after what its variants share, as
+// one keyword, e.g. "2l" for Jesa Milk (2L); "" when it has none.
+func sizeOf(name string) string {
+	return strings.Join(keywords(name)[len(keywords(baseName(name))):], "")
+}
+
+// matchSize returns the option text names by its full name or by its size
+// ("the 2L", "2 litres"), if exactly one matches.
+func matchSize(options []CatalogItem, text string) (CatalogItem, bool) {
+	words := keywords(text)
+	for i, w := range words {
+		if unit, ok := unitWords[w]; ok {
+			words[i] = unit
+		}
+	}
+	joined := strings.Join(words, "")
+	for _, o := range options {
+		if strings.Join(keywords(o.Name), "") == joined {
+			return o, true
+		}
+	}
+
+	// A size is one word ("500ml") or a number and its unit ("2 l")
+	said := make(map[string]bool, 2*len(words))
+	for i, w := range words {
+		said[w] = true
+		if i > 0 {
+			said[words[i-1]+w] = true
+		}
+	}
+	found := -1
+	for i, o := range options {
+		if size := sizeOf(o.Name); size != "" && said[size] {
+			if found >= 0 {
+				return CatalogItem{}, false
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return CatalogItem{}, false
+	}
+	return options[found], true
+}
+
+// choose reads text as an answer to c: an option's size or name, or its
+// number in the list ("2", "the second one").
+func (c Clarification) choose(text string) (CatalogItem, bool) {
+	if o, ok := matchSize(c.Options, text); ok {
+		return o, true
+	}
+	pick := 0
+	for _, w := range keywords(text) {
+		n, ok := ordinalWords[w]
+		if !ok {
+			var err error
+			if n, err = strconv.Atoi(w); err != nil {
+				continue
+			}
+		}
+		if pick != 0 && n != pick {
+			return CatalogItem{}, false // "1 or 2?"
+		}
+		pick = n
+	}
+	if pick < 1 || pick > len(c.Options) {
+		return CatalogItem{}, false
+	}
+	return c.Options[pick-1], true
+}
+
+// question asks the student which of c's options they meant, with prices
+// written in l.
+func (c Clarification) question(l locale.Locale) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Which %s would you like? We have a few sizes:\n\n", baseName(c.Options[0].Name))
+	for i, o := range c.Options {
+		fmt.Fprintf(&b, "%d. %s @ %s\n", i+1, o.Name, l.Money(o.PriceUGX))
+	}
+	b.WriteString("\nReply with its number")
+	if size := sizeOf(c.Options[0].Name); size != "" {
+		fmt.Fprintf(&b, " or size, e.g. \"%s\"", size)
+	}
+	b.WriteString(", or say \"cancel\".")
+	return b.String()
+}
+
+// variants looks for other sizes of hit. When phrase names one of them, or
+// hit has no others, it returns that item; otherwise it returns the
+// available sizes, cheapest first, to ask the student about.
+func variants(ctx context.Context, tx *sql.Tx, hit *CatalogItem, phrase string) (*CatalogItem, []CatalogItem, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, name, item_price(id, NOW()), available
+		   FROM items
+		  WHERE available AND LOWER(TRIM(regexp_replace(name, '\s*\([^)]*\)\s*$', ''))) = LOWER($1)
+		  ORDER BY item_price(id, NOW()), id
+		  LIMIT $2`, baseName(hit.Name), maxClarifyOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var options []CatalogItem
+	for rows.Next() {
+		var o CatalogItem
+		if err := rows.Scan(&o.ID, &o.Name, &o.PriceUGX, &o.Available); err != nil {
+			return nil, nil, err
+		}
+		options = append(options, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(options) < 2 {
+		return hit, nil, nil
+	}
+	if o, ok := matchSize(options, phrase); ok {
+		o.Category = hit.Category
+		return &o, nil, nil
+	}
+	return nil, options, nil
+}
+
+// saveClarifications records the questions a new draft waits on.
+func saveClarifications(ctx context.Context, tx *sql.Tx, orderID int, cs []Clarification) error {
+	for _, c := range cs {
+		ids := make([]int64, len(c.Options))
+		for i, o := range c.Options {
+			ids[i] = int64(o.ID)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO order_clarifications (order_id, phrase, quantity, item_ids) VALUES ($1, $2, $3, $4)`,
+			orderID, c.Phrase, c.Quantity, pq.Array(ids),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openClarification returns the oldest question the draft still waits on,
+// with its options as they are now. ok is false when there is none.
+func (s *Service) openClarification(ctx context.Context, orderID int) (c Clarification, ok bool, err error) {
+	var ids pq.Int64Array
+	err = s.db.QueryRowContext(ctx,
+		`SELECT id, phrase, quantity, item_ids FROM order_clarifications WHERE order_id = $1 ORDER BY id LIMIT 1`, orderID,
+	).Scan(&c.ID, &c.Phrase, &c.Quantity, &ids)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, false, nil
+	}
+	if err != nil {
+		return c, false, err
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, item_price(id, NOW()), available
+		   FROM items WHERE id = ANY($1::int[]) ORDER BY array_position($1::int[], id)`, ids)
+	if err != nil {
+		return c, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o CatalogItem
+		if err := rows.Scan(&o.ID, &o.Name, &o.PriceUGX, &o.Available); err != nil {
+			return c, false, err
+		}
+		c.Options = append(c.Options, o)
+	}
+	if err := rows.Err(); err != nil {
+		return c, false, err
+	}
+	return c, len(c.Options) > 0, nil
+}
+
+// HandleClarification takes the message as the answer to the question the
+// draft waits on. handled is false when the message is not an answer and
+// should be read as usual: a cancel, or a new request of more than a few
+// words. A short reply it cannot place, or a confirm, gets the question
+// again.
+func (s *Service) HandleClarification(ctx context.Context, userID int, d Draft, c Clarification, text string) (reply Reply, handled bool, err error) {
+	l := s.campusLocale(ctx, userID)
+	choice, ok := c.choose(text)
+	if !ok {
+		lower := strings.ToLower(text)
+		if strings.Contains(lower, "cancel") || len(keywords(text)) > maxAnswerWords && !strings.Contains(lower, "confirm") {
+			return Reply{}, false, nil
+		}
+		return Reply{IntentClarify, d.OrderID, "Sorry, I didn't catch which one. " + c.question(l)}, true, nil
+	}
+	if !choice.Available {
+		return Reply{IntentClarify, d.OrderID, fmt.Sprintf("Sorry, %s just sold out. ", choice.Name) + c.question(l)}, true, nil
+	}
+
+	settled, err := s.addClarifiedItem(ctx, d.OrderID, c, choice)
+	if err != nil {
+		return Reply{}, true, err
+	}
+	if !settled {
+		return Reply{IntentConflict, d.OrderID, conflictReply}, true, nil
+	}
+	s.meter.WithLabelValues("clarified").Inc()
+
+	if next, ok, err := s.openClarification(ctx, d.OrderID); err != nil {
+		return Reply{}, true, fmt.Errorf("load clarification: %w", err)
+	} else if ok {
+		return Reply{IntentClarify, d.OrderID, next.question(l)}, true, nil
+	}
+	full, err := s.loadDraft(ctx, d.OrderID)
+	if err != nil {
+		return Reply{}, true, fmt.Errorf("load draft: %w", err)
+	}
+	var suggestions []Suggestion
+	if s.recommender != nil {
+		if suggestions, err = s.recommender.Suggest(ctx, userID, d.OrderID); err != nil {
+			s.logger.Warn("chat suggestions failed", zap.Int("order_id", d.OrderID), zap.Error(err))
+		}
+	}
+	return Reply{IntentNewOrder, d.OrderID, SummarizeDraft(full, suggestions, l)}, true, nil
+}
+
+// addClarifiedItem adds the chosen item to the draft in place of the
+// question. It returns false if the draft is no longer pending or another
+// message already answered the question.
+func (s *Service) addClarifiedItem(ctx context.Context, orderID int, c Clarification, choice CatalogItem) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var pending bool
+	var userID int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT status = 'PENDING', user_id FROM orders WHERE id = $1 FOR UPDATE`, orderID,
+	).Scan(&pending, &userID); err != nil {
+		return false, fmt.Errorf("lock pending order: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM order_clarifications WHERE id = $1`, c.ID)
+	if err != nil {
+		return false, fmt.Errorf("delete clarification: %w", err)
+	}
+	if n, _ := res.RowsAffected(); !pending || n == 0 {
+		return false, nil
+	}
+
+	taxRate, err := tax.RateForItem(ctx, tx, choice.ID)
+	if err != nil {
+		return false, fmt.Errorf("fetch tax rate: %w", err)
+	}
+	price, err := pricing.CurrentPrice(ctx, tx, choice.ID)
+	if err != nil {
+		return false, fmt.Errorf("fetch price: %w", err)
+	}
+	group, err := pricing.GroupFor(ctx, tx, userID)
+	if err != nil {
+		return false, fmt.Errorf("fetch pricing group: %w", err)
+	}
+	quote := pricing.Quote(pricing.Order{Group: group, Lines: []pricing.Line{{
+		ItemID: choice.ID, Quantity: c.Quantity, UnitPrice: price, TaxRateBps: taxRate,
+	}}})
+	l := quote.Lines[0]
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO order_items (order_id, item_id, quantity, unit_price, tax_rate_bps, tax_amount)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		orderID, l.ItemID, l.Quantity, l.UnitPrice, l.TaxRateBps, l.Tax,
+	); err != nil {
+		return false, fmt.Errorf("insert order item: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE orders SET tax_total = tax_total + $1 WHERE id = $2`, l.Tax, orderID,
+	); err != nil {
+		return false, fmt.Errorf("update tax total: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+// loadDraft reads back a pending order's lines and totals, for its summary
+// once the last question is answered.
+func (s *Service) loadDraft(ctx context.Context, orderID int) (Draft, error) {
+	d := Draft{OrderID: orderID}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT i.name, oi.quantity, oi.unit_price, oi.tax_amount
+		   FROM order_items oi JOIN items i ON i.id = oi.item_id
+		  WHERE oi.order_id = $1
+		  ORDER BY oi.id`, orderID)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var it DraftItem
+		var lineTax int
+		if err := rows.Scan(&it.Name, &it.Quantity, &it.UnitPrice, &lineTax); err != nil {
+			return d, err
+		}
+		d.Items = append(d.Items, it)
+		d.Subtotal += it.Quantity * it.UnitPrice
+		d.TaxTotal += lineTax
+	}
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+	d.SmallOrder, err = orders.SmallOrderRuleFor(ctx, s.db, orderID)
+	return d, err
+}
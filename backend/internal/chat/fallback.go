@@ -0,0 +1,186 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+// How long chat stays in degraded mode after a quota error that gives no
+// Retry-After, and the longest it stays for one that does.
+const (
+	defaultDegradedFor = time.Minute
+	maxDegradedFor     = 15 * time.Minute
+)
+
+// numberWords are quantities students spell out, in English, Swahili, and
+// Luganda.
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10, "dozen": 12,
+	"moja": 1, "mbili": 2, "tatu": 3, "nne": 4, "tano": 5,
+	"emu": 1, "bbiri": 2, "ssatu": 3, "nnya": 4, "ttaano": 5,
+}
+
+// KeywordExtractor is the ProductExtractor chat falls back on while the LLM
+// is out of quota. It finds item names and aliases written out in the
+// message, longest first, each with the number just before it ("2 bread",
+// "two mkate"), or a spelled-out number or an "x2" just after it ("mkate
+// mbili"), as the quantity. It only knows names as the catalog spells them,
+// plus a plural "s".
+type KeywordExtractor struct {
+	DB *sql.DB
+}
+
+// ExtractProducts implements ProductExtractor.
+func (k KeywordExtractor) ExtractProducts(ctx context.Context, message string) ([]ParsedProduct, error) {
+	rows, err := k.DB.QueryContext(ctx,
+		`SELECT name FROM items UNION SELECT alias FROM item_aliases`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return matchProducts(names, message), nil
+}
+
+// matchProducts finds names in message as KeywordExtractor describes.
+func matchProducts(names []string, message string) []ParsedProduct {
+	type term struct {
+		name  string
+		words []string
+	}
+	var terms []term
+	for _, name := range names {
+		if words := keywords(name); len(words) > 0 {
+			terms = append(terms, term{name, words})
+		}
+	}
+	// "coca cola zero" before "coca cola"
+	sort.SliceStable(terms, func(i, j int) bool { return len(terms[i].words) > len(terms[j].words) })
+
+	words := keywords(message)
+	used := make([]bool, len(words))
+	type found struct {
+		at int
+		ParsedProduct
+	}
+	var hits []found
+	for _, t := range terms {
+		for i := 0; i+len(t.words) <= len(words); i++ {
+			if !matchAt(words, used, i, t.words) {
+				continue
+			}
+			end := i + len(t.words)
+			qty := 1
+			if n, ok := quantity(words, used, i-1); ok {
+				qty, used[i-1] = n, true
+			} else if end < len(words) && !used[end] {
+				// Swahili and Luganda put the number after: "mkate mbili"
+				if n, ok := numberWords[words[end]]; ok && n > 1 {
+					qty, used[end] = n, true
+				} else if n, err := strconv.Atoi(words[end][1:]); words[end][0] == 'x' && err == nil && n > 0 {
+					qty, used[end] = n, true
+				}
+			}
+			for j := i; j < end; j++ {
+				used[j] = true
+			}
+			hits = append(hits, found{i, ParsedProduct{Name: t.name, Quantity: qty}})
+		}
+	}
+
+	// In the order they were asked for, one line per product
+	sort.Slice(hits, func(i, j int) bool { return hits[i].at < hits[j].at })
+	products := []ParsedProduct{}
+	index := make(map[string]int)
+	for _, h := range hits {
+		key := strings.ToLower(h.Name)
+		if i, ok := index[key]; ok {
+			products[i].Quantity += h.Quantity
+			continue
+		}
+		index[key] = len(products)
+		products = append(products, h.ParsedProduct)
+	}
+	return products
+}
+
+// keywords lowercases s and splits it into runs of letters and digits, so
+// "Jesa Milk (2L)" and "jesa milk 2l" compare equal.
+func keywords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchAt reports whether term's words appear, unused, at words[i:], the
+// last one optionally with a plural "s".
+func matchAt(words []string, used []bool, i int, term []string) bool {
+	for j, w := range term {
+		got := words[i+j]
+		if used[i+j] || (got != w && !(j == len(term)-1 && got == w+"s")) {
+			return false
+		}
+	}
+	return true
+}
+
+// quantity reads words[i] as a quantity, in digits or spelled out.
+func quantity(words []string, used []bool, i int) (int, bool) {
+	if i < 0 || used[i] {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(words[i]); err == nil && n > 0 {
+		return n, true
+	}
+	n, ok := numberWords[words[i]]
+	return n, ok
+}
+
+// Degraded reports whether chat is running without the LLM because its
+// quota ran out or its health probes are failing, drafting orders with the
+// KeywordExtractor instead.
+func (s *Service) Degraded() bool {
+	return time.Now().UnixNano() < s.degradedUntil.Load() || !s.health.Available(DependencyLLM)
+}
+
+// extractProducts runs the LLM extractor, switching to the keyword fallback
+// for a while when it reports its quota exhausted, and using the fallback
+// straight away until then.
+func (s *Service) extractProducts(ctx context.Context, message string) ([]ParsedProduct, error) {
+	if !s.Degraded() {
+		products, err := s.extractor.ExtractProducts(ctx, message)
+		var quota *QuotaError
+		if !errors.As(err, &quota) {
+			return products, err
+		}
+		wait := quota.RetryAfter
+		if wait <= 0 {
+			wait = defaultDegradedFor
+		}
+		wait = min(wait, maxDegradedFor)
+		s.degradedUntil.Store(time.Now().Add(wait).UnixNano())
+		s.meter.WithLabelValues("llm_degraded").Inc()
+		s.logger.Warn("LLM quota exhausted; chat falls back to keyword matching",
+			zap.Duration("for", wait), zap.Error(err))
+	}
+	return s.fallback.ExtractProducts(ctx, message)
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"server/internal/catalogpb"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// GRPCCatalog is the CatalogSearcher backed by the catalog gRPC service. It
+// replaces MCPCatalog; see cmd/jaj-catalog.
+type GRPCCatalog struct {
+	Client  catalogpb.CatalogClient
+	Latency *prometheus.HistogramVec // optional; labelled by result
+}
+
+// NewGRPCCatalog connects to the catalog service at addr, e.g.
+// "catalog:9090". The connection is internal to the deployment network and
+// unencrypted; it is established lazily, so the service need not be up yet.
+func NewGRPCCatalog(addr string) (*GRPCCatalog, *grpc.ClientConn, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("catalog dial: %w", err)
+	}
+	return &GRPCCatalog{Client: catalogpb.NewCatalogClient(conn)}, conn, nil
+}
+
+// SearchItem asks the catalog service for the single closest item to name.
+func (g *GRPCCatalog) SearchItem(ctx context.Context, name string) (*CatalogItem, error) {
+	items, err := g.SearchItems(ctx, name, 1)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// SearchItems asks the catalog service for the limit closest items to query.
+func (g *GRPCCatalog) SearchItems(ctx context.Context, query string, limit int) (items []CatalogItem, err error) {
+	start := time.Now()
+	defer func() { observeLatency(g.Latency, start, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	resp, err := g.Client.SearchItems(ctx, &catalogpb.SearchItemsRequest{Query: query, MaxResults: int32(limit)})
+	if err != nil {
+		return nil, fmt.Errorf("catalog search: %w", err)
+	}
+	return catalogItems(resp), nil
+}
+
+// catalogItems converts the catalog service's hits, best first.
+func catalogItems(resp *catalogpb.SearchItemsResponse) []CatalogItem {
+	var items []CatalogItem
+	for _, h := range resp.GetItems() {
+		items = append(items, CatalogItem{
+			ID:        int(h.GetId()),
+			Name:      h.GetName(),
+			Category:  h.GetCategory(),
+			PriceUGX:  int(h.GetPriceUgx()),
+			Available: h.GetAvailable(),
+		})
+	}
+	return items
+}
@@ -0,0 +1,199 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Health probing: each probe gets probeTimeout, and a dependency is only
+// marked down after failuresToTrip probes in a row fail, so one blip does
+// not switch chat into basic mode.
+const (
+	probeTimeout   = 10 * time.Second
+	failuresToTrip = 2
+)
+
+// Dependencies chat probes, by the name Health knows them by.
+const (
+	DependencyLLM     = "llm"
+	DependencyCatalog = "catalog"
+)
+
+// ErrCatalogDown is returned by CreateDraft while Health reports the
+// catalog backend down, instead of waiting on it to time out.
+var ErrCatalogDown = errors.New("catalog backend is down")
+
+// Prober checks that a dependency answers. A first probe also sets up any
+// connection the dependency opens lazily, so the first student of the day
+// does not wait for it.
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// ProbeFunc adapts a function to Prober.
+type ProbeFunc func(ctx context.Context) error
+
+// Probe implements Prober.
+func (f ProbeFunc) Probe(ctx context.Context) error { return f(ctx) }
+
+// dependency is the last known state of something chat relies on.
+type dependency struct {
+	up       bool
+	failures int // probes failed in a row
+}
+
+// Health probes chat's dependencies in the background and remembers which
+// are up. The Service consults it as a circuit breaker: while the LLM is
+// down chat drafts orders in basic mode without trying it, and while the
+// catalog is down it says so at once instead of timing out.
+type Health struct {
+	Logger *zap.Logger
+	// Up, when set, is 1 or 0 per dependency.
+	Up *prometheus.GaugeVec
+
+	mu      sync.RWMutex
+	probers map[string]Prober
+	state   map[string]*dependency
+}
+
+// NewHealth returns a Health with nothing to probe yet.
+func NewHealth(logger *zap.Logger) *Health {
+	return &Health{Logger: logger, probers: map[string]Prober{}, state: map[string]*dependency{}}
+}
+
+// Add probes p as name from the next Check. Until then, and until it has
+// failed failuresToTrip times, name counts as up.
+func (h *Health) Add(name string, p Prober) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probers[name] = p
+	h.state[name] = &dependency{up: true}
+}
+
+// Available reports whether name is not known to be down. A nil Health
+// reports everything available.
+func (h *Health) Available(name string) bool {
+	if h == nil {
+		return true
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	d, ok := h.state[name]
+	return !ok || d.up
+}
+
+// Check probes every dependency at once and records the results.
+func (h *Health) Check(ctx context.Context) {
+	h.mu.RLock()
+	probers := make(map[string]Prober, len(h.probers))
+	for name, p := range h.probers {
+		probers[name] = p
+	}
+	h.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for name, p := range probers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			err := p.Probe(pctx)
+			cancel()
+			if ctx.Err() == nil {
+				h.record(name, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// record updates name's state after a probe that returned err, logging when
+// it goes down or comes back.
+func (h *Health) record(name string, err error) {
+	h.mu.Lock()
+	d := h.state[name]
+	wasUp := d.up
+	if err == nil {
+		d.failures, d.up = 0, true
+	} else if d.failures++; d.failures >= failuresToTrip {
+		d.up = false
+	}
+	up := d.up
+	h.mu.Unlock()
+
+	if h.Up != nil {
+		v := 0.0
+		if up {
+			v = 1
+		}
+		h.Up.WithLabelValues(name).Set(v)
+	}
+	switch {
+	case wasUp && !up:
+		h.Logger.Error("chat dependency down", zap.String("dependency", name), zap.Error(err))
+	case !wasUp && up:
+		h.Logger.Info("chat dependency back up", zap.String("dependency", name))
+	case err != nil:
+		h.Logger.Warn("chat dependency probe failed", zap.String("dependency", name), zap.Error(err))
+	}
+}
+
+// Run checks at once, which warms every client before the first student
+// needs it, then every interval until ctx is done.
+func (h *Health) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Probe checks the Groq API answers for the extractor's key and model. It
+// fetches the model's metadata, which spends no tokens.
+func (g *GroqExtractor) Probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.groq.com/openai/v1/models/"+g.Model, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.APIKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return &QuotaError{RetryAfter: time.Duration(secs) * time.Second, Body: string(body)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("groq API error %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// catalogProbeQuery is searched for to check the catalog answers; whether
+// it matches anything does not matter.
+const catalogProbeQuery = "bread"
+
+// CatalogProber checks c answers a search.
+func CatalogProber(c CatalogSearcher) Prober {
+	return ProbeFunc(func(ctx context.Context) error {
+		_, err := c.SearchItem(ctx, catalogProbeQuery)
+		return err
+	})
+}
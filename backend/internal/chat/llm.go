@@ -0,0 +1,227 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/domain"
+	"server/internal/monitoring"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// ParsedProduct is one product the user asked for, as extracted by the LLM.
+type ParsedProduct struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// ProductExtractor turns a free-text chat message into requested products.
+// An empty result means the message was not an order.
+type ProductExtractor interface {
+	ExtractProducts(ctx context.Context, message string) ([]ParsedProduct, error)
+}
+
+const extractSystemPrompt = `
+You are an assistant that parses grocery-ordering requests. The user will type something like:
+  "I want two Jesa Milk (2L) and three Nido Milk Powder (500g)."
+Return a JSON array of objects, each with exactly two fields:
+  "name": <exact product name string>,
+  "quantity": <integer>.
+
+If the user mentions a product but does not specify a number, assume quantity=1.
+Examples:
+- Input: "I want Jesa Milk (2L) and one Coca-Cola (330ml)"
+  → Output: [{"name":"Jesa Milk (2L)","quantity":1},{"name":"Coca-Cola (330ml)","quantity":1}]
+- Input: "Give me two Lipton Black Tea (50g) and Detergent Powder (2kg)"
+  → Output: [{"name":"Lipton Black Tea (50g)","quantity":2},{"name":"Detergent Powder (2kg)","quantity":1}]
+- Input: "I need 5 bread loaves"
+  → Output: [{"name":"bread loaves","quantity":5}]
+- Input: "I would like to buy toothpaste"
+  → Output: [{"name":"toothpaste","quantity":1}]
+- Input: "Do you have something sugar-free to drink?"
+  → Output: [{"name":"sugar-free drink","quantity":1}]
+- Keep dietary words such as "sugar-free", "halal", or "vegan" in the name; the catalog matches them against product tags.
+- If you cannot find any product names (e.g. "What is biology?"), return an empty JSON array: [].
+Return only the JSON array, no markdown fences or extra text.
+`
+
+const menuSystemPrompt = `
+You answer questions from university students about what the JAJ campus shop sells, using only this menu (prices in UGX):
+
+%s
+Rules:
+- Answer in two or three short sentences, naming items and prices from the menu exactly as written.
+- Say an item is sold out when the menu says so. Never invent items or prices.
+- If something is not on the menu, say we don't stock it.
+- To order, the student just tells you the items and quantities; you may say so.
+- If the message is not a question about products, prices, or availability (e.g. "What is biology?"), reply with exactly: NOT_CATALOG
+`
+
+// GroqExtractor is the ProductExtractor backed by the Groq chat completions API.
+type GroqExtractor struct {
+	APIKey string
+	Model  string
+	Logger *zap.Logger // optional; raw replies are logged at debug level
+
+	// Latency, when set, observes each API call under operation "extract"
+	// or "menu".
+	Latency *prometheus.HistogramVec
+
+	// Log, when set, keeps a sample of calls for debugging.
+	Log *LLMLog
+}
+
+// NewGroqExtractor returns a Groq-backed extractor, defaulting the model to
+// llama-3.3-70b-versatile.
+func NewGroqExtractor(apiKey, model string) *GroqExtractor {
+	if model == "" {
+		model = "llama-3.3-70b-versatile"
+	}
+	return &GroqExtractor{APIKey: apiKey, Model: model}
+}
+
+// ExtractProducts asks Groq to list the products in message. Replies that are
+// not a JSON array are treated as "no products".
+func (g *GroqExtractor) ExtractProducts(ctx context.Context, message string) ([]ParsedProduct, error) {
+	userPrompt := fmt.Sprintf(`User: "%s"`, message)
+
+	start := time.Now()
+	raw, err := callGroq(ctx, g.APIKey, g.Model, extractSystemPrompt, userPrompt)
+	observeLatency(g.Latency, start, err, "extract")
+	g.Log.Record(ctx, "extract", g.Model, extractSystemPrompt, userPrompt, raw, err, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	if g.Logger != nil {
+		g.Logger.Debug("phase 1 raw reply", zap.String("raw", raw))
+	}
+
+	var products []ParsedProduct
+	if err := json.Unmarshal([]byte(stripFences(raw)), &products); err != nil {
+		return []ParsedProduct{}, nil
+	}
+	return products, nil
+}
+
+// AnswerFromMenu asks Groq to answer a catalog question from menu, in
+// persona's voice. It returns "" when the model says the message is not one.
+func (g *GroqExtractor) AnswerFromMenu(ctx context.Context, persona Persona, menu, message string) (string, error) {
+	start := time.Now()
+	systemPrompt := persona.Prompt() + "\n" + fmt.Sprintf(menuSystemPrompt, menu)
+	userPrompt := fmt.Sprintf(`User: "%s"`, message)
+	raw, err := callGroq(ctx, g.APIKey, g.Model, systemPrompt, userPrompt)
+	observeLatency(g.Latency, start, err, "menu")
+	g.Log.Record(ctx, "menu", g.Model, systemPrompt, userPrompt, raw, err, time.Since(start))
+	if err != nil {
+		return "", err
+	}
+	answer := strings.TrimSpace(stripFences(raw))
+	if answer == "" || strings.Contains(answer, "NOT_CATALOG") {
+		return "", nil
+	}
+	return answer, nil
+}
+
+// stripFences removes a surrounding ``` markdown fence, if any.
+// observeLatency records one call on h, which may be nil.
+func observeLatency(h *prometheus.HistogramVec, start time.Time, err error, labels ...string) {
+	if h == nil {
+		return
+	}
+	h.WithLabelValues(append(labels, monitoring.Result(err))...).Observe(time.Since(start).Seconds())
+}
+
+func stripFences(s string) string {
+	stripped := strings.TrimSpace(s)
+	if strings.HasPrefix(stripped, "```") {
+		lines := strings.SplitN(stripped, "\n", 3)
+		if len(lines) == 3 {
+			stripped = strings.TrimSpace(lines[1])
+		}
+	}
+	return stripped
+}
+
+// QuotaError is returned when the LLM provider refuses a call because the
+// API key is out of quota or over its rate limit. RetryAfter is how long the
+// provider asked to wait, or zero if it did not say.
+type QuotaError struct {
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("LLM quota exhausted: %s", e.Body)
+}
+
+// Is makes an exhausted LLM quota a domain.ErrQuotaExceeded.
+func (e *QuotaError) Is(target error) bool { return target == domain.ErrQuotaExceeded }
+
+// ── GROQ CLIENT ─────────────────────────────────────────────────────────────────
+type groqMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type groqRequest struct {
+	Model    string        `json:"model"`
+	Messages []groqMessage `json:"messages"`
+}
+
+type groqChoice struct {
+	Message groqMessage `json:"message"`
+}
+
+type groqResponse struct {
+	Choices []groqChoice `json:"choices"`
+}
+
+func callGroq(ctx context.Context, apiKey, model, systemPrompt, userPrompt string) (string, error) {
+	var messages []groqMessage
+	if systemPrompt != "" {
+		messages = append(messages, groqMessage{Role: "system", Content: systemPrompt})
+	}
+	messages = append(messages, groqMessage{Role: "user", Content: userPrompt})
+	reqBody, _ := json.Marshal(groqRequest{Model: model, Messages: messages})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.groq.com/openai/v1/chat/completions", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return "", &QuotaError{RetryAfter: time.Duration(secs) * time.Second, Body: string(body)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("groq API error %d: %s", resp.StatusCode, string(body))
+	}
+
+	var groqResp groqResponse
+	if err := json.Unmarshal(body, &groqResp); err != nil {
+		return "", err
+	}
+	if len(groqResp.Choices) == 0 {
+		return "", fmt.Errorf("groq returned no choices")
+	}
+	return groqResp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,119 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxLLMLogRows caps the LLM log however busy chat is; rows older than
+// chat.llm_log_days are purged by package retention.
+const maxLLMLogRows = 50000
+
+// LLMLog records a sample of LLM calls, prompts and replies, in the llm_log
+// table, so extraction quality can be debugged from real traffic. The share
+// sampled is the chat.llm_log_percent setting, 0 (off) unless set, re-read at
+// most once a minute. A nil *LLMLog records nothing.
+type LLMLog struct {
+	db     *sql.DB
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	percent int
+	loaded  time.Time
+}
+
+// NewLLMLog returns an LLMLog writing to db.
+func NewLLMLog(db *sql.DB, logger *zap.Logger) *LLMLog {
+	return &LLMLog{db: db, logger: logger}
+}
+
+// sampled returns chat.llm_log_percent, reading it at most once a
+// personaTTL. Read failures keep the last value.
+func (l *LLMLog) sampled(ctx context.Context) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.loaded.IsZero() && time.Since(l.loaded) < personaTTL {
+		return l.percent
+	}
+	var value json.RawMessage
+	err := l.db.QueryRowContext(ctx,
+		`SELECT value_json FROM config WHERE key = 'chat.llm_log_percent'`).Scan(&value)
+	percent := 0
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		l.logger.Warn("failed to load LLM log settings", zap.Error(err))
+		return l.percent
+	default:
+		var n int
+		if json.Unmarshal(value, &n) == nil {
+			percent = min(max(n, 0), 100)
+		}
+	}
+	l.percent, l.loaded = percent, time.Now()
+	return percent
+}
+
+// Record logs one call, if it falls in the sample. Failures to write are
+// logged, never returned, so they cannot break the chat.
+func (l *LLMLog) Record(ctx context.Context, operation, model, systemPrompt, userPrompt, response string, callErr error, latency time.Duration) {
+	if l == nil {
+		return
+	}
+	percent := l.sampled(ctx)
+	if percent == 0 || rand.Intn(100) >= percent {
+		return
+	}
+	errText := ""
+	if callErr != nil {
+		errText = callErr.Error()
+	}
+	if _, err := l.db.ExecContext(ctx,
+		`INSERT INTO llm_log (operation, model, system_prompt, user_prompt, response, error, latency_ms)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		operation, model, systemPrompt, userPrompt, response, errText, latency.Milliseconds(),
+	); err != nil {
+		l.logger.Warn("failed to record LLM call", zap.String("operation", operation), zap.Error(err))
+	}
+}
+
+// Prune deletes all but the newest maxLLMLogRows, returning how many it
+// deleted.
+func (l *LLMLog) Prune(ctx context.Context) (int64, error) {
+	res, err := l.db.ExecContext(ctx,
+		`DELETE FROM llm_log
+		  WHERE id <= (SELECT id FROM llm_log ORDER BY id DESC OFFSET $1 LIMIT 1)`,
+		maxLLMLogRows)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Run prunes the log every interval until ctx is done.
+func (l *LLMLog) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := l.Prune(ctx)
+		if err != nil {
+			l.logger.Error("failed to prune LLM log", zap.Error(err))
+			continue
+		}
+		if n > 0 {
+			l.logger.Info("pruned LLM log", zap.Int64("rows", n))
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CatalogItem is a catalog entry matched for a product name.
+type CatalogItem struct {
+	ID        int
+	Name      string
+	Category  string
+	PriceUGX  int
+	Available bool
+}
+
+// CatalogSearcher finds the best catalog match for a product name. It returns
+// nil, nil when nothing matches. SearchItems returns up to limit matches,
+// best first, for a student browsing rather than ordering.
+type CatalogSearcher interface {
+	SearchItem(ctx context.Context, name string) (*CatalogItem, error)
+	SearchItems(ctx context.Context, query string, limit int) ([]CatalogItem, error)
+}
+
+// MCPCatalog is the CatalogSearcher backed by the Postgres MCP server.
+type MCPCatalog struct {
+	URL     string                   // base URL, e.g. "http://mcp:9000"
+	Latency *prometheus.HistogramVec // optional; labelled by result
+}
+
+// NewMCPCatalog returns a catalog searcher for the MCP server at baseURL.
+func NewMCPCatalog(baseURL string) *MCPCatalog {
+	return &MCPCatalog{URL: baseURL}
+}
+
+// SearchItem asks the MCP server for the single closest item to name.
+func (m *MCPCatalog) SearchItem(ctx context.Context, name string) (*CatalogItem, error) {
+	items, err := m.SearchItems(ctx, name, 1)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// SearchItems asks the MCP server for the limit closest items to query.
+func (m *MCPCatalog) SearchItems(ctx context.Context, query string, limit int) (items []CatalogItem, err error) {
+	start := time.Now()
+	defer func() { observeLatency(m.Latency, start, err) }()
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"model":      "items",
+		"fields":     []string{"id", "name", "category", "price_ugx", "available"},
+		"queryText":  query,
+		"maxResults": limit,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.URL+"/query", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mcp request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	var hits []struct {
+		ID        float64 `json:"id"`
+		Name      string  `json:"name"`
+		Category  string  `json:"category"`
+		PriceUGX  float64 `json:"price_ugx"`
+		Available bool    `json:"available"`
+	}
+	if err := json.Unmarshal(body, &hits); err != nil {
+		return nil, fmt.Errorf("decode mcp response: %w", err)
+	}
+	for _, h := range hits {
+		items = append(items, CatalogItem{
+			ID:        int(h.ID),
+			Name:      h.Name,
+			Category:  h.Category,
+			PriceUGX:  int(h.PriceUGX),
+			Available: h.Available,
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,199 @@
+package chat
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"server/internal/catalog"
+	"server/internal/events"
+	"server/internal/locale"
+
+	"go.uber.org/zap"
+)
+
+// Menu snapshot limits. The menu goes into an LLM prompt on every catalog
+// question, so it is capped at maxMenuBytes; the items that do not fit are
+// counted instead of listed.
+const (
+	maxMenuBytes        = 6000
+	defaultMenuInterval = 5 * time.Minute
+	menuMaxAge          = 60 // seconds clients may cache GET /chat/menu
+)
+
+// MenuAnswerer answers a question about what the shop sells from the menu
+// text, speaking as persona. It returns "" when the message is not such a
+// question.
+type MenuAnswerer interface {
+	AnswerFromMenu(ctx context.Context, persona Persona, menu, message string) (string, error)
+}
+
+// Menu keeps a pre-rendered snapshot of the catalog (names, current prices,
+// availability) for answering questions like "what do you sell?". It is
+// rebuilt every interval, and on the next use after an admin changes the
+// catalog.
+type Menu struct {
+	db       *sql.DB
+	logger   *zap.Logger
+	answerer MenuAnswerer
+
+	mu    sync.RWMutex
+	text  string
+	etag  string
+	stale bool
+}
+
+// NewMenu returns a Menu that builds its snapshot on first use.
+func NewMenu(db *sql.DB, logger *zap.Logger, answerer MenuAnswerer) *Menu {
+	return &Menu{db: db, logger: logger, answerer: answerer, stale: true}
+}
+
+// Invalidate marks the snapshot out of date; the next use rebuilds it.
+func (m *Menu) Invalidate() {
+	m.mu.Lock()
+	m.stale = true
+	m.mu.Unlock()
+}
+
+// Refresh rebuilds the snapshot from the database.
+func (m *Menu) Refresh(ctx context.Context) error {
+	rows, err := m.db.QueryContext(ctx,
+		`SELECT category, name, item_price(id, NOW()), available,
+		        COALESCE((SELECT string_agg(a.alias, ', ' ORDER BY a.alias) FROM item_aliases a WHERE a.item_id = items.id), '')
+		   FROM items ORDER BY category, name`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	var lastCategory string
+	omitted := 0
+	for rows.Next() {
+		var category, name, aliases string
+		var price int
+		var available bool
+		if err := rows.Scan(&category, &name, &price, &available, &aliases); err != nil {
+			return err
+		}
+		if aliases != "" {
+			name += " (also: " + aliases + ")"
+		}
+		line := fmt.Sprintf("- %s: %s", name, locale.Default.Money(price))
+		if !available {
+			line += " (sold out)"
+		}
+		if category != lastCategory {
+			line = category + ":\n" + line
+		}
+		if omitted > 0 || b.Len()+len(line)+1 > maxMenuBytes {
+			omitted++
+			continue
+		}
+		lastCategory = category
+		b.WriteString(line + "\n")
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "...and %d more items not listed here.\n", omitted)
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	m.mu.Lock()
+	m.text, m.etag, m.stale = b.String(), `"`+hex.EncodeToString(sum[:8])+`"`, false
+	m.mu.Unlock()
+	return nil
+}
+
+// snapshot returns the menu text and its ETag, rebuilding it first if it
+// is stale. A failed rebuild falls back to the previous snapshot.
+func (m *Menu) snapshot(ctx context.Context) (string, string, error) {
+	m.mu.RLock()
+	text, etag, stale := m.text, m.etag, m.stale
+	m.mu.RUnlock()
+	if !stale {
+		return text, etag, nil
+	}
+	if err := m.Refresh(ctx); err != nil {
+		if text != "" {
+			m.logger.Warn("menu refresh failed, using previous snapshot", zap.Error(err))
+			return text, etag, nil
+		}
+		return "", "", err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.text, m.etag, nil
+}
+
+// Answer answers message from the menu, or returns "" when it is not a
+// question about the catalog.
+func (m *Menu) Answer(ctx context.Context, persona Persona, message string) (string, error) {
+	text, _, err := m.snapshot(ctx)
+	if err != nil {
+		return "", fmt.Errorf("build menu: %w", err)
+	}
+	return m.answerer.AnswerFromMenu(ctx, persona, text, message)
+}
+
+// Run builds the snapshot at once, so the first question after boot does
+// not wait on it, then rebuilds it every interval (5 minutes when zero) and
+// marks it stale whenever the catalog changes, until ctx is done.
+func (m *Menu) Run(ctx context.Context, bus events.Bus, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultMenuInterval
+	}
+	// Every instance keeps its own snapshot, so each needs every event
+	unsubscribe, err := bus.Subscribe(catalog.TopicChanged, "", func(events.Event) { m.Invalidate() })
+	if err != nil {
+		m.logger.Error("menu invalidation subscription failed", zap.Error(err))
+	} else {
+		defer unsubscribe()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Refresh(ctx); err != nil {
+			m.logger.Error("menu refresh failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MakeMenuHandler serves GET /chat/menu: the same snapshot the chat answers
+// from, as plain text, with an ETag so clients can revalidate cheaply.
+func MakeMenuHandler(m *Menu) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		text, etag, err := m.snapshot(r.Context())
+		if err != nil {
+			m.logger.Error("menu snapshot failed", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", menuMaxAge))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(text))
+	}
+}
@@ -0,0 +1,187 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Verdict is a moderator's decision on one message.
+type Verdict struct {
+	Flagged bool
+	Reason  string // e.g. "blocklist:<word>" or the provider's category
+}
+
+// Moderator screens chat input before it reaches the LLM.
+type Moderator interface {
+	Check(ctx context.Context, message string) (Verdict, error)
+}
+
+// defaultBlocklist covers common English abuse; extend it with CHAT_BLOCKLIST.
+var defaultBlocklist = []string{
+	"fuck", "fucking", "shit", "bitch", "bastard", "asshole", "cunt",
+	"nigger", "faggot", "whore", "slut", "motherfucker", "kill you",
+}
+
+// BlocklistModerator flags messages containing a blocked word or phrase,
+// matched on whole words after lower-casing and collapsing punctuation.
+type BlocklistModerator struct {
+	words []string
+}
+
+// NewBlocklistModerator returns a moderator using the default list plus extra.
+func NewBlocklistModerator(extra ...string) *BlocklistModerator {
+	m := &BlocklistModerator{}
+	for _, w := range append(append([]string{}, defaultBlocklist...), extra...) {
+		if w = normalizeForModeration(w); w != "" {
+			m.words = append(m.words, w)
+		}
+	}
+	return m
+}
+
+// Check implements Moderator.
+func (m *BlocklistModerator) Check(_ context.Context, message string) (Verdict, error) {
+	padded := " " + normalizeForModeration(message) + " "
+	for _, w := range m.words {
+		if strings.Contains(padded, " "+w+" ") {
+			return Verdict{Flagged: true, Reason: "blocklist:" + w}, nil
+		}
+	}
+	return Verdict{}, nil
+}
+
+// normalizeForModeration lower-cases s and turns runs of non-letters into
+// single spaces, so "F*U*C*K" does not slip past but "Scunthorpe" is fine.
+func normalizeForModeration(s string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r):
+			b.WriteRune(r)
+			space = false
+		case r == '*' || r == '.' || r == '-' || r == '_':
+			// common in-word masking; drop without splitting the word
+		default:
+			if !space {
+				b.WriteByte(' ')
+				space = true
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// GroqGuardModerator asks a Llama Guard model on Groq whether a message is
+// unsafe.
+type GroqGuardModerator struct {
+	APIKey  string
+	Model   string
+	Latency *prometheus.HistogramVec // optional; observed under operation "moderate"
+}
+
+// NewGroqGuardModerator returns a Groq safety moderator, defaulting the model
+// to meta-llama/llama-guard-4-12b.
+func NewGroqGuardModerator(apiKey, model string) *GroqGuardModerator {
+	if model == "" {
+		model = "meta-llama/llama-guard-4-12b"
+	}
+	return &GroqGuardModerator{APIKey: apiKey, Model: model}
+}
+
+// Check implements Moderator. Llama Guard answers "safe" or "unsafe\n<S-codes>".
+func (g *GroqGuardModerator) Check(ctx context.Context, message string) (Verdict, error) {
+	start := time.Now()
+	raw, err := callGroq(ctx, g.APIKey, g.Model, "", message)
+	observeLatency(g.Latency, start, err, "moderate")
+	if err != nil {
+		return Verdict{}, err
+	}
+	status, categories, _ := strings.Cut(strings.TrimSpace(raw), "\n")
+	if strings.EqualFold(strings.TrimSpace(status), "unsafe") {
+		return Verdict{Flagged: true, Reason: "provider:" + strings.TrimSpace(categories)}, nil
+	}
+	return Verdict{}, nil
+}
+
+// ChainModerator runs moderators in order and returns the first flag. A
+// failing moderator is skipped so an outage of the safety API does not take
+// chat down; the blocklist still applies.
+type ChainModerator struct {
+	Moderators []Moderator
+	Logger     *zap.Logger
+}
+
+// Check implements Moderator.
+func (c ChainModerator) Check(ctx context.Context, message string) (Verdict, error) {
+	for _, m := range c.Moderators {
+		v, err := m.Check(ctx, message)
+		if err != nil {
+			if c.Logger != nil {
+				c.Logger.Warn("moderator failed, skipping", zap.Error(err))
+			}
+			continue
+		}
+		if v.Flagged {
+			return v, nil
+		}
+	}
+	return Verdict{}, nil
+}
+
+// Abuse thresholds: this many violations within abuseWindow suspends chat for
+// suspensionPeriod.
+const (
+	abuseThreshold   = 3
+	abuseWindow      = 24 * time.Hour
+	suspensionPeriod = time.Hour
+)
+
+// chatSuspendedUntil returns when the user's chat suspension ends, or the
+// zero time if they are not suspended.
+func chatSuspendedUntil(ctx context.Context, db *sql.DB, userID int) (time.Time, error) {
+	var until time.Time
+	err := db.QueryRowContext(ctx,
+		`SELECT until FROM chat_suspensions WHERE user_id=$1 AND until > NOW()`, userID,
+	).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return until, err
+}
+
+// recordViolation logs a flagged message and suspends the user once they
+// reach abuseThreshold violations within abuseWindow. It reports whether the
+// user is now suspended.
+func recordViolation(ctx context.Context, db *sql.DB, userID int, message, reason string) (bool, error) {
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO chat_violations (user_id, message, reason) VALUES ($1, $2, $3)`,
+		userID, message, reason,
+	); err != nil {
+		return false, err
+	}
+
+	var recent int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM chat_violations WHERE user_id=$1 AND created_at > $2`,
+		userID, time.Now().Add(-abuseWindow),
+	).Scan(&recent); err != nil {
+		return false, err
+	}
+	if recent < abuseThreshold {
+		return false, nil
+	}
+
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO chat_suspensions (user_id, until, reason) VALUES ($1, $2, $3)
+		 ON CONFLICT (user_id) DO UPDATE SET until = EXCLUDED.until, reason = EXCLUDED.reason, created_at = NOW()`,
+		userID, time.Now().Add(suspensionPeriod), "repeated abusive messages",
+	)
+	return err == nil, err
+}
@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"server/internal/orders"
+)
+
+// noteMarker starts a note for the packers in a message: "note: ripe
+// bananas please", or after an order, "2 bananas, note: ripe ones please".
+var noteMarker = regexp.MustCompile(`(?i)(?:^|[\s,.;])note\s*:`)
+
+// splitNote separates a note from the rest of the message. ok is false when
+// the message has no note.
+func splitNote(text string) (rest, note string, ok bool) {
+	loc := noteMarker.FindStringIndex(text)
+	if loc == nil {
+		return text, "", false
+	}
+	rest = strings.TrimRight(strings.TrimSpace(text[:loc[0]]), ",.;")
+	return rest, strings.TrimSpace(text[loc[1]:]), true
+}
+
+// HandleNote leaves note on the student's pending draft or, without one, on
+// their latest confirmed order that is not packed yet. An empty note
+// removes the one there.
+func (s *Service) HandleNote(ctx context.Context, userID int, note string) (Reply, error) {
+	var orderID int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id
+		   FROM orders
+		  WHERE user_id = $1 AND status IN ('PENDING', 'CONFIRMED')
+		  ORDER BY status = 'PENDING' DESC, created_at DESC
+		  LIMIT 1`,
+		userID,
+	).Scan(&orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Reply{IntentNote, 0, "You don't have an order in progress to add a note to. " +
+			"Send it with your order, e.g. \"2 bananas, note: ripe ones please\"."}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("look up order for note: %w", err)
+	}
+
+	note, err = orders.SetNote(ctx, s.db, userID, orderID, note)
+	if errors.Is(err, orders.ErrNoteLocked) {
+		return Reply{IntentNote, orderID, "Your order is already packed, so the note can't reach the team anymore."}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("set order note: %w", err)
+	}
+	s.meter.WithLabelValues("order_note").Inc()
+	if note == "" {
+		return Reply{IntentNote, orderID, fmt.Sprintf("Okay, I removed the note from order #%d.", orderID)}, nil
+	}
+	return Reply{IntentNote, orderID, fmt.Sprintf("Got it, order #%d now has the note: \"%s\"", orderID, note)}, nil
+}
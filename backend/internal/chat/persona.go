@@ -0,0 +1,215 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Tones the assistant can take, set by the chat.tone setting.
+const (
+	ToneFormal  = "formal"
+	ToneCasual  = "casual"
+	ToneLuglish = "luglish" // English mixed with everyday Luganda
+)
+
+// personaTTL is how long a Service reuses the persona settings before
+// reading them again, so admin edits show within a minute.
+const personaTTL = time.Minute
+
+// Canned replies the persona's tone changes. Templates see replyData.
+const (
+	replyGreeting    = "greeting"
+	replyOffTopic    = "off_topic"
+	replyUnavailable = "unavailable"
+	replyConfirmed   = "confirmed"
+	replyCancelled   = "cancelled"
+)
+
+// toneReplies holds each tone's canned replies, and toneStyles the
+// instruction given to the LLM for it.
+var (
+	toneReplies = map[string]map[string]*template.Template{
+		ToneFormal: parseReplies(map[string]string{
+			replyGreeting:    `Good day. I am {{.Name}}, the JAJ ordering assistant. Please tell me which items you would like and how many.`,
+			replyOffTopic:    `I am sorry, but I can only assist with orders and deliveries.`,
+			replyUnavailable: `I am sorry, "{{.Product}}" is currently unavailable.`,
+			replyConfirmed:   `Thank you. Your order is confirmed and will be ready for collection at {{.PickupTime}} at {{.PickupStation}}.`,
+			replyCancelled:   `Your order has been cancelled. Please let me know if there is anything else I can assist you with.`,
+		}),
+		ToneCasual: parseReplies(map[string]string{
+			replyGreeting:    `Hi, I'm {{.Name}}! Tell me what you need, like "2 bread and 1 sugar", and I'll put the order together.`,
+			replyOffTopic:    `Sorry, we cannot help you with that, our goal is to take orders and deliveries.`,
+			replyUnavailable: `That product "{{.Product}}" is not available at the moment.`,
+			replyConfirmed:   `Your order has been confirmed! We'll see you at {{.PickupTime}} at {{.PickupStation}}.`,
+			replyCancelled:   `Your order has been cancelled. If you need anything else, just let me know.`,
+		}),
+		ToneLuglish: parseReplies(map[string]string{
+			replyGreeting:    `Oli otya! I'm {{.Name}}. Tell me what you need, like "2 bread ne sugar", and I'll sort you out.`,
+			replyOffTopic:    `Sorry, that one I can't help with. I'm here for orders and deliveries only.`,
+			replyUnavailable: `Eh, "{{.Product}}" is not there at the moment. Sorry!`,
+			replyConfirmed:   `Kale! Your order is confirmed. See you at {{.PickupTime}} at {{.PickupStation}}, webale!`,
+			replyCancelled:   `Okay, your order is cancelled. Anything else, just tell me.`,
+		}),
+	}
+	toneStyles = map[string]string{
+		ToneFormal:  "Write in polite, formal English.",
+		ToneCasual:  "Write in friendly, casual English.",
+		ToneLuglish: "Write in friendly English mixed with common Luganda words and greetings, the way Kampala students chat.",
+	}
+)
+
+func parseReplies(texts map[string]string) map[string]*template.Template {
+	replies := make(map[string]*template.Template, len(texts))
+	for key, text := range texts {
+		replies[key] = template.Must(template.New(key).Parse(text))
+	}
+	return replies
+}
+
+// Persona is how the assistant presents itself: its name, the greeting the
+// frontend opens the chat with, and the tone of its replies. Admins set it
+// with the chat.assistant_name, chat.greeting, and chat.tone settings.
+type Persona struct {
+	Name     string `json:"name"`
+	Greeting string `json:"greeting"` // rendered, with the name filled in
+	Tone     string `json:"tone"`
+
+	greeting string // the chat.greeting template; empty for the tone's own
+}
+
+// defaultPersona is used for settings that are unset or unusable.
+var defaultPersona = Persona{Name: "JAJ", Tone: ToneCasual}
+
+// replyData is what canned reply and greeting templates can use.
+type replyData struct {
+	Name          string
+	Product       string
+	PickupTime    string
+	PickupStation string
+}
+
+// LoadPersona reads the persona settings, falling back to the defaults for
+// any that are unset or invalid.
+func LoadPersona(ctx context.Context, db *sql.DB) (Persona, error) {
+	p := defaultPersona
+	rows, err := db.QueryContext(ctx,
+		`SELECT key, value_json FROM config WHERE key = ANY($1)`,
+		pq.Array([]string{"chat.assistant_name", "chat.greeting", "chat.tone"}))
+	if err != nil {
+		return p, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var value json.RawMessage
+		if err := rows.Scan(&key, &value); err != nil {
+			return p, err
+		}
+		var s string
+		if json.Unmarshal(value, &s) != nil || s == "" {
+			continue
+		}
+		switch key {
+		case "chat.assistant_name":
+			p.Name = s
+		case "chat.greeting":
+			p.greeting = s
+		case "chat.tone":
+			if _, ok := toneReplies[s]; ok {
+				p.Tone = s
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return p, err
+	}
+	p.Greeting = p.say(replyGreeting, replyData{})
+	return p, nil
+}
+
+// say renders the canned reply key in p's tone. A custom greeting that does
+// not render falls back to the tone's own.
+func (p Persona) say(key string, data replyData) string {
+	data.Name = p.Name
+	var b bytes.Buffer
+	if key == replyGreeting && p.greeting != "" {
+		if t, err := template.New(key).Parse(p.greeting); err == nil && t.Execute(&b, data) == nil {
+			return b.String()
+		}
+		b.Reset()
+	}
+	replies, ok := toneReplies[p.Tone]
+	if !ok {
+		replies = toneReplies[ToneCasual]
+	}
+	if err := replies[key].Execute(&b, data); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+// Prompt is the instruction that makes the LLM speak as p.
+func (p Persona) Prompt() string {
+	style, ok := toneStyles[p.Tone]
+	if !ok {
+		style = toneStyles[ToneCasual]
+	}
+	return "You are " + p.Name + ", the JAJ campus shop's ordering assistant. " + style
+}
+
+// personaCache keeps a Service's persona for personaTTL.
+type personaCache struct {
+	mu      sync.Mutex
+	persona Persona
+	loaded  time.Time
+}
+
+// persona returns the current persona, reading the settings at most once a
+// personaTTL. Read failures are logged and keep the last persona.
+func (s *Service) persona(ctx context.Context) Persona {
+	c := &s.personas
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded.IsZero() && time.Since(c.loaded) < personaTTL {
+		return c.persona
+	}
+	p, err := LoadPersona(ctx, s.db)
+	if err != nil {
+		s.logger.Warn("failed to load chat persona", zap.Error(err))
+		if c.loaded.IsZero() {
+			return p
+		}
+		return c.persona
+	}
+	c.persona, c.loaded = p, time.Now()
+	return p
+}
+
+// MakePersonaHandler serves GET /chat/persona: the assistant's name, tone,
+// and greeting, for the frontend to open the chat with.
+func MakePersonaHandler(db *sql.DB, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p, err := LoadPersona(r.Context(), db)
+		if err != nil {
+			logger.Error("failed to load chat persona", zap.Error(err))
+			http.Error(w, "database query error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		json.NewEncoder(w).Encode(p)
+	}
+}
@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"server/internal/catalog"
+	"server/internal/catalogpb"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PostgresCatalog is the CatalogSearcher that runs the catalog service's
+// matcher in-process against the shared database. It returns what
+// GRPCCatalog would, without the service, which is what ShadowCatalog
+// needs to compare it with MCP before CATALOG_GRPC_ADDR is switched on.
+type PostgresCatalog struct {
+	Server  *catalog.Server
+	Latency *prometheus.HistogramVec // optional; labelled by result
+}
+
+// NewPostgresCatalog returns a catalog searcher over the items in db.
+func NewPostgresCatalog(db *sql.DB) *PostgresCatalog {
+	return &PostgresCatalog{Server: catalog.NewServer(db)}
+}
+
+// SearchItem returns the single closest item to name.
+func (p *PostgresCatalog) SearchItem(ctx context.Context, name string) (*CatalogItem, error) {
+	items, err := p.SearchItems(ctx, name, 1)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// SearchItems returns the limit closest items to query.
+func (p *PostgresCatalog) SearchItems(ctx context.Context, query string, limit int) (items []CatalogItem, err error) {
+	start := time.Now()
+	defer func() { observeLatency(p.Latency, start, err) }()
+
+	resp, err := p.Server.SearchItems(ctx, &catalogpb.SearchItemsRequest{Query: query, MaxResults: int32(limit)})
+	if err != nil {
+		return nil, fmt.Errorf("catalog search: %w", err)
+	}
+	return catalogItems(resp), nil
+}
@@ -0,0 +1,122 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Recommendation tuning: pairs must have been ordered together in at least
+// minTogether orders over the last lookback to be suggested, and a
+// suggestion counts as accepted if its item is in an order the student
+// confirms within acceptWindow of seeing it.
+const (
+	maxSuggestions = 2
+	minTogether    = 3
+	lookback       = 90 * 24 * time.Hour
+	acceptWindow   = time.Hour
+)
+
+// Suggestion is an item often bought together with one in the draft.
+type Suggestion struct {
+	ItemID int
+	Name   string
+	With   string // the draft item it is bought with
+}
+
+// Recommender suggests add-ons for chat drafts from which items students
+// have ordered together, and counts how often they are taken up in
+// jaj_chat_suggestions_total{event="shown"|"accepted"}.
+type Recommender struct {
+	db      *sql.DB
+	logger  *zap.Logger
+	counter *prometheus.CounterVec
+}
+
+// NewRecommender wires a Recommender to its dependencies.
+func NewRecommender(db *sql.DB, logger *zap.Logger, counter *prometheus.CounterVec) *Recommender {
+	return &Recommender{db: db, logger: logger, counter: counter}
+}
+
+// Suggest returns up to maxSuggestions available items that are not in the
+// draft but are most often ordered together with something that is, and
+// records them as shown to the student.
+func (r *Recommender) Suggest(ctx context.Context, userID, orderID int) ([]Suggestion, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`WITH basket AS (SELECT DISTINCT item_id FROM order_items WHERE order_id = $1),
+		      pairs AS (
+		        SELECT a.item_id AS source, b.item_id AS target, COUNT(DISTINCT a.order_id) AS together
+		          FROM order_items a
+		          JOIN order_items b ON b.order_id = a.order_id AND b.item_id <> a.item_id
+		          JOIN orders o ON o.id = a.order_id
+		         WHERE a.item_id IN (SELECT item_id FROM basket)
+		           AND b.item_id NOT IN (SELECT item_id FROM basket)
+		           AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		           AND o.created_at >= $2
+		         GROUP BY a.item_id, b.item_id
+		        HAVING COUNT(DISTINCT a.order_id) >= $3)
+		 SELECT target, target_name, source_name FROM (
+		   SELECT DISTINCT ON (p.target) p.target, t.name AS target_name, s.name AS source_name, p.together
+		     FROM pairs p
+		     JOIN items t ON t.id = p.target AND t.available = TRUE
+		     JOIN items s ON s.id = p.source
+		    ORDER BY p.target, p.together DESC, s.name
+		 ) best
+		 ORDER BY together DESC, target_name
+		 LIMIT $4`,
+		orderID, time.Now().Add(-lookback), minTogether, maxSuggestions,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suggestions []Suggestion
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(&s.ItemID, &s.Name, &s.With); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range suggestions {
+		if _, err := r.db.ExecContext(ctx,
+			`INSERT INTO chat_suggestions (user_id, order_id, item_id) VALUES ($1, $2, $3)`,
+			userID, orderID, s.ItemID,
+		); err != nil {
+			return nil, fmt.Errorf("record suggestion: %w", err)
+		}
+		r.counter.WithLabelValues("shown").Inc()
+	}
+	return suggestions, nil
+}
+
+// Accepted marks the suggestions the student saw within acceptWindow whose
+// items are in orderID, which they have just confirmed. Failures are logged;
+// the order is already placed.
+func (r *Recommender) Accepted(ctx context.Context, userID, orderID int) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE chat_suggestions
+		    SET accepted_order_id = $2
+		  WHERE user_id = $1
+		    AND accepted_order_id IS NULL
+		    AND shown_at >= $3
+		    AND item_id IN (SELECT item_id FROM order_items WHERE order_id = $2)`,
+		userID, orderID, time.Now().Add(-acceptWindow),
+	)
+	if err != nil {
+		r.logger.Error("failed to record accepted suggestions", zap.Int("order_id", orderID), zap.Error(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		r.counter.WithLabelValues("accepted").Add(float64(n))
+	}
+}
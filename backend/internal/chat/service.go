@@ -0,0 +1,687 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"server/internal/budget"
+	"server/internal/catalog"
+	"server/internal/events"
+	"server/internal/inventory"
+	"server/internal/ledger"
+	"server/internal/locale"
+	"server/internal/orders"
+	"server/internal/pricing"
+	"server/internal/tax"
+	"server/internal/waitlist"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// ErrNothingToOrder is returned by CreateDraft when the message names no
+// products.
+var ErrNothingToOrder = errors.New("message names no products")
+
+// UnavailableError is returned by CreateDraft when a product is not in the
+// catalogue or not available.
+type UnavailableError struct {
+	Name string // as the student wrote it
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%q is not available", e.Name)
+}
+
+// Reply is the answer to one chat message.
+type Reply struct {
+	Intent  string
+	OrderID int // 0 when the message touched no order
+	Text    string
+}
+
+// Draft is a PENDING order built from chat, waiting for the student to
+// confirm or cancel it.
+type Draft struct {
+	OrderID  int
+	Version  int
+	Items    []DraftItem // filled in by CreateDraft only
+	Subtotal int
+	TaxTotal int // VAT included in Subtotal
+	// SmallOrder is the campus minimum basket; filled in by CreateDraft only
+	SmallOrder pricing.SmallOrderRule
+	// Questions are the products that matched several sizes, which the
+	// draft waits on; filled in by CreateDraft only
+	Questions []Clarification
+	// Note is the student's note for the packers, when the message that
+	// drafted the order had one
+	Note string
+}
+
+// DraftItem is one line of a Draft.
+type DraftItem struct {
+	Name      string
+	Quantity  int
+	UnitPrice int
+}
+
+// Service runs the chat ordering conversation independent of the transport,
+// so the web chat and messaging channels share one flow: moderation, then
+// confirming, cancelling, or waitlisting the pending draft, or drafting a new
+// order from the message.
+type Service struct {
+	db        *sql.DB
+	logger    *zap.Logger
+	meter     *prometheus.CounterVec
+	extractor ProductExtractor
+	catalog   CatalogSearcher
+	moderator Moderator
+	bus       events.Bus
+	// recommender adds suggestions to draft summaries; nil turns them off
+	recommender *Recommender
+	// menu answers questions about what the shop sells; nil turns them off
+	menu *Menu
+	// health trips chat into basic mode while the LLM is down and fails
+	// fast while the catalog is; nil assumes both are up
+	health *Health
+	// fallback drafts orders while the extractor is out of quota, until
+	// degradedUntil (Unix nanoseconds)
+	fallback      ProductExtractor
+	degradedUntil atomic.Int64
+	// personas caches the assistant's name and tone from the settings
+	personas personaCache
+}
+
+// NewService wires a Service to its dependencies.
+func NewService(
+	db *sql.DB,
+	logger *zap.Logger,
+	meter *prometheus.CounterVec,
+	extractor ProductExtractor,
+	catalog CatalogSearcher,
+	moderator Moderator,
+	bus events.Bus,
+	recommender *Recommender,
+	menu *Menu,
+	health *Health,
+) *Service {
+	return &Service{
+		db:          db,
+		logger:      logger,
+		meter:       meter,
+		extractor:   extractor,
+		catalog:     catalog,
+		moderator:   moderator,
+		bus:         bus,
+		recommender: recommender,
+		menu:        menu,
+		health:      health,
+		fallback:    KeywordExtractor{DB: db},
+	}
+}
+
+// answerFromMenu answers a question about the catalog from the menu
+// snapshot, or returns "" when message is not one or there is no menu.
+func (s *Service) answerFromMenu(ctx context.Context, userID int, message string) string {
+	if s.menu == nil || s.Degraded() {
+		return ""
+	}
+	answer, err := s.menu.Answer(ctx, s.persona(ctx), message)
+	if err != nil {
+		s.logger.Warn("chat menu answer failed", zap.Int("user_id", userID), zap.Error(err))
+		return ""
+	}
+	return answer
+}
+
+// Handle answers one message from the student and records the turn for the
+// transcript. The student's turns run one at a time: a message sent while
+// the previous one is still being processed gets a "still processing" reply
+// instead. An error means the message could not be processed at all; the
+// caller should apologise generically.
+func (s *Service) Handle(ctx context.Context, userID int, message string) (Reply, error) {
+	release, ok, err := s.lockTurn(ctx, userID)
+	if err != nil {
+		return Reply{}, fmt.Errorf("lock chat turn: %w", err)
+	}
+	if !ok {
+		s.meter.WithLabelValues("chat_busy").Inc()
+		reply := Reply{IntentBusy, 0, "One moment, I'm still working on your last message."}
+		recordTurn(context.WithoutCancel(ctx), s.db, s.logger, userID, 0, reply.Intent, message, reply.Text)
+		return reply, nil
+	}
+	// Released even if handling panics, so the student is not locked out
+	// until the lock expires
+	defer release()
+	reply, err := s.handle(ctx, userID, message)
+	if err != nil {
+		return Reply{}, err
+	}
+	recordTurn(context.WithoutCancel(ctx), s.db, s.logger, userID, reply.OrderID, reply.Intent, message, reply.Text)
+	return reply, nil
+}
+
+func (s *Service) handle(ctx context.Context, userID int, message string) (Reply, error) {
+	text := strings.TrimSpace(message)
+
+	// Suspended users and abusive messages never reach the LLM
+	if reply, blocked, err := s.moderate(ctx, userID, text, message); err != nil || blocked {
+		return reply, err
+	}
+
+	// A note for the packers is split off; the rest of the message is
+	// handled as if sent alone, and the note goes on the order it touches
+	text, note, hasNote := splitNote(text)
+	if hasNote {
+		var err error
+		if note, err = orders.CleanNote(note); errors.Is(err, orders.ErrNoteTooLong) {
+			return Reply{IntentNote, 0, fmt.Sprintf(
+				"That note is too long. Please keep it under %d characters.", orders.MaxNoteLength)}, nil
+		}
+		if text == "" {
+			return s.HandleNote(ctx, userID, note)
+		}
+		message = text
+	}
+	lowerText := strings.ToLower(text)
+
+	draft, hasPending, err := s.PendingDraft(ctx, userID)
+	if err != nil {
+		return Reply{}, fmt.Errorf("look up pending order: %w", err)
+	}
+	if hasPending && hasNote {
+		if _, err := orders.SetNote(ctx, s.db, userID, draft.OrderID, note); err != nil {
+			return Reply{}, fmt.Errorf("set order note: %w", err)
+		}
+	}
+	// "Where is my order?" is answered without touching the draft, unless
+	// the message also confirms, cancels, or waitlists it
+	if orderID, ok := statusQuestion(lowerText); ok && !(hasPending && draftCommand(lowerText)) {
+		return s.HandleOrderStatus(ctx, userID, orderID)
+	}
+	// So are "how much is milk?" and "what snacks do you have?"
+	if query, ok := catalogQuestion(lowerText); ok && !hasNote && !(hasPending && draftCommand(lowerText)) {
+		return s.HandleAskCatalog(ctx, userID, message, query)
+	}
+	if hasPending {
+		// A draft waiting on a question takes the message as the answer first
+		if c, ok, err := s.openClarification(ctx, draft.OrderID); err != nil {
+			return Reply{}, fmt.Errorf("load clarification: %w", err)
+		} else if ok {
+			if reply, handled, err := s.HandleClarification(ctx, userID, draft, c, text); err != nil || handled {
+				return reply, err
+			}
+		}
+		switch {
+		case strings.Contains(lowerText, "waitlist"):
+			return s.HandleWaitlist(ctx, userID, draft)
+		case strings.Contains(lowerText, "confirm"):
+			return s.HandleConfirm(ctx, userID, draft, ConfirmOverrides{
+				Duplicate:  strings.Contains(lowerText, "again"),
+				OverBudget: strings.Contains(lowerText, "anyway"),
+			})
+		case strings.Contains(lowerText, "cancel"):
+			return s.HandleCancel(ctx, userID, draft)
+		}
+		// Anything else starts over with a fresh request
+		s.supersede(ctx, userID, draft)
+	}
+
+	draft, err = s.CreateDraft(ctx, userID, message)
+	var unavailable *UnavailableError
+	switch {
+	case errors.Is(err, ErrNothingToOrder):
+		if answer := s.answerFromMenu(ctx, userID, message); answer != "" {
+			s.meter.WithLabelValues("catalog_question").Inc()
+			return Reply{IntentCatalogQuestion, 0, answer}, nil
+		}
+		s.meter.WithLabelValues("off_topic").Inc()
+		if s.Degraded() {
+			return Reply{IntentOffTopic, 0, "Sorry, I couldn't find any of our products in that. I'm running in basic mode right now, " +
+				"so please name items as the shop lists them, with quantities, e.g. \"2 bread and 1 sugar\"."}, nil
+		}
+		return Reply{IntentOffTopic, 0, s.persona(ctx).say(replyOffTopic, replyData{})}, nil
+	case errors.Is(err, ErrCatalogDown):
+		s.meter.WithLabelValues("catalog_down").Inc()
+		return Reply{IntentCatalogDown, 0, "Sorry, I can't look up our products right now. Please try again in a few minutes."}, nil
+	case errors.As(err, &unavailable):
+		s.meter.WithLabelValues("not_available").Inc()
+		return Reply{IntentUnavailable, 0, s.persona(ctx).say(replyUnavailable, replyData{Product: unavailable.Name})}, nil
+	case err != nil:
+		return Reply{}, err
+	}
+	if hasNote {
+		if draft.Note, err = orders.SetNote(ctx, s.db, userID, draft.OrderID, note); err != nil {
+			return Reply{}, fmt.Errorf("set order note: %w", err)
+		}
+	}
+	if len(draft.Questions) > 0 {
+		s.meter.WithLabelValues("clarify").Inc()
+		return Reply{IntentClarify, draft.OrderID, draft.Questions[0].question(s.campusLocale(ctx, userID))}, nil
+	}
+	var suggestions []Suggestion
+	if s.recommender != nil {
+		if suggestions, err = s.recommender.Suggest(ctx, userID, draft.OrderID); err != nil {
+			s.logger.Warn("chat suggestions failed", zap.Int("order_id", draft.OrderID), zap.Error(err))
+		}
+	}
+	return Reply{IntentNewOrder, draft.OrderID, SummarizeDraft(draft, suggestions, s.campusLocale(ctx, userID))}, nil
+}
+
+// campusLocale returns how the student's campus shows amounts and times, or
+// the default if that cannot be read.
+func (s *Service) campusLocale(ctx context.Context, userID int) locale.Locale {
+	l, err := locale.ForUser(ctx, s.db, userID)
+	if err != nil {
+		s.logger.Warn("failed to load campus locale", zap.Int("user_id", userID), zap.Error(err))
+	}
+	return l
+}
+
+// moderate reports whether the message must be refused, with the reply to
+// send instead.
+func (s *Service) moderate(ctx context.Context, userID int, text, message string) (Reply, bool, error) {
+	if until, err := chatSuspendedUntil(ctx, s.db, userID); err != nil {
+		return Reply{}, false, fmt.Errorf("check chat suspension: %w", err)
+	} else if !until.IsZero() {
+		s.meter.WithLabelValues("chat_suspended").Inc()
+		return Reply{IntentSuspended, 0, fmt.Sprintf(
+			"Chat is paused for your account until %s because of repeated abusive messages.",
+			s.campusLocale(ctx, userID).Clock(until))}, true, nil
+	}
+
+	verdict, err := s.moderator.Check(ctx, text)
+	if err != nil {
+		s.logger.Warn("moderation check failed", zap.Error(err))
+	}
+	if !verdict.Flagged {
+		return Reply{}, false, nil
+	}
+	s.meter.WithLabelValues("chat_blocked").Inc()
+	suspended, err := recordViolation(ctx, s.db, userID, message, verdict.Reason)
+	if err != nil {
+		s.logger.Error("failed to record chat violation", zap.Error(err))
+	}
+	s.logger.Warn("chat message blocked by moderation",
+		zap.Int("user_id", userID), zap.String("reason", verdict.Reason), zap.Bool("suspended", suspended))
+	msg := "Let's keep it respectful. I can help you order groceries and daily necessities."
+	if suspended {
+		msg = "Chat has been paused for your account for an hour because of repeated abusive messages."
+	}
+	return Reply{IntentBlocked, 0, msg}, true, nil
+}
+
+// PendingDraft returns the student's latest PENDING order, without its
+// items. ok is false when there is none.
+func (s *Service) PendingDraft(ctx context.Context, userID int) (d Draft, ok bool, err error) {
+	err = s.db.QueryRowContext(ctx,
+		`SELECT id, version
+		   FROM orders
+		  WHERE user_id = $1 AND status = 'PENDING'
+		  ORDER BY created_at DESC
+		  LIMIT 1`,
+		userID,
+	).Scan(&d.OrderID, &d.Version)
+	if err == sql.ErrNoRows {
+		return d, false, nil
+	}
+	return d, err == nil, err
+}
+
+// ConfirmOverrides are the warnings the student has already said to ignore:
+// "confirm again" for a repeat of a recent order and "confirm anyway" for
+// going over a weekly budget in warn mode.
+type ConfirmOverrides struct {
+	Duplicate  bool
+	OverBudget bool
+}
+
+// phrase is what the student should say to confirm past one more warning on
+// top of those already overridden.
+func (o ConfirmOverrides) phrase() string {
+	p := "confirm"
+	if o.Duplicate {
+		p += " again"
+	}
+	if o.OverBudget {
+		p += " anyway"
+	}
+	return p
+}
+
+// HandleConfirm places the draft. Status, fee tier, and total are settled in
+// one transaction under the per-user daily lock so concurrent confirmations
+// price correctly. A full campus, a campus network the student is not on, a
+// sold-out item, a repeat of a recent order, or a weekly budget the order
+// would exceed leaves the draft pending.
+func (s *Service) HandleConfirm(ctx context.Context, userID int, d Draft, overrides ConfirmOverrides) (Reply, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Reply{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	confirmedToday, err := orders.ConfirmedToday(ctx, tx, userID)
+	if err != nil {
+		return Reply{}, fmt.Errorf("count confirmed orders: %w", err)
+	}
+
+	if err := orders.UpdateStatus(ctx, tx, d.OrderID, d.Version, "CONFIRMED"); errors.Is(err, orders.ErrConflict) {
+		return Reply{IntentConflict, d.OrderID, conflictReply}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("confirm order: %w", err)
+	}
+	if err := orders.RecordStatusChange(ctx, tx, d.OrderID, "CONFIRMED"); err != nil {
+		return Reply{}, fmt.Errorf("record order status: %w", err)
+	}
+	var full *orders.CapacityError
+	if err := orders.ReserveCapacity(ctx, tx, d.OrderID); errors.As(err, &full) {
+		// The draft stays pending so "confirm" works once ordering reopens
+		s.meter.WithLabelValues("capacity_full").Inc()
+		return Reply{IntentFull, d.OrderID, full.Error() + waitlistHint}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("check order capacity: %w", err)
+	}
+	var off *orders.OffNetworkError
+	if err := orders.CheckNetwork(ctx, tx, d.OrderID); errors.As(err, &off) {
+		s.meter.WithLabelValues("off_network").Inc()
+		return Reply{IntentOffNetwork, d.OrderID, off.Error() + " Then say \"confirm\" again."}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("check order network: %w", err)
+	}
+
+	var dup *orders.DuplicateError
+	if err := orders.CheckDuplicate(ctx, tx, userID, d.OrderID, overrides.Duplicate); errors.As(err, &dup) {
+		s.meter.WithLabelValues("duplicate_order").Inc()
+		again := overrides
+		again.Duplicate = true
+		return Reply{IntentDuplicate, d.OrderID, fmt.Sprintf(
+			"%s Say \"%s\" to place it again, or \"cancel\".", dup.Error(), again.phrase())}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("check duplicate order: %w", err)
+	}
+
+	quote, err := orders.PriceOrder(ctx, tx, d.OrderID, confirmedToday)
+	var small *pricing.BelowMinimumError
+	if errors.As(err, &small) {
+		s.meter.WithLabelValues("below_minimum").Inc()
+		return Reply{IntentBelowMinimum, d.OrderID,
+			small.Error() + " Send your whole order again with more items, or say \"cancel\"."}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("price order: %w", err)
+	}
+	var over *budget.ExceededError
+	if err := budget.Check(ctx, tx, userID, d.OrderID, quote.Total, overrides.OverBudget); errors.As(err, &over) {
+		s.meter.WithLabelValues("over_budget").Inc()
+		anyway := overrides
+		anyway.OverBudget = true
+		hint := fmt.Sprintf(" Say \"%s\" to place it, or \"cancel\".", anyway.phrase())
+		if !over.CanOverride() {
+			hint = " Your budget is a hard limit, so try a smaller order or say \"cancel\"."
+		}
+		return Reply{IntentOverBudget, d.OrderID, over.Error() + hint}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("check weekly budget: %w", err)
+	}
+	var short *inventory.OutOfStockError
+	if err := inventory.Reserve(ctx, tx, d.OrderID); errors.As(err, &short) {
+		s.meter.WithLabelValues("not_available").Inc()
+		return Reply{IntentUnavailable, d.OrderID, fmt.Sprintf(
+			"Sorry, %s just sold out. Tell me what you'd like instead, or say \"cancel\"."+waitlistHint, short.Name)}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("reserve stock: %w", err)
+	}
+	if _, err := ledger.RecordConfirmation(ctx, tx, d.OrderID); err != nil {
+		return Reply{}, fmt.Errorf("record ledger entries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Reply{}, fmt.Errorf("commit confirmation: %w", err)
+	}
+	orders.PublishStatus(ctx, s.bus, s.logger, orders.StatusEvent{
+		UserID: userID, OrderID: d.OrderID, Status: "CONFIRMED",
+	})
+	if s.recommender != nil {
+		s.recommender.Accepted(ctx, userID, d.OrderID)
+	}
+
+	return Reply{IntentConfirm, d.OrderID, s.persona(ctx).say(replyConfirmed, replyData{
+		PickupTime: s.campusLocale(ctx, userID).DateTime(orders.PickupAt(time.Now())), PickupStation: orders.PickupStation,
+	})}, nil
+}
+
+// HandleCancel cancels the draft at the student's request.
+func (s *Service) HandleCancel(ctx context.Context, userID int, d Draft) (Reply, error) {
+	if err := orders.UpdateStatus(ctx, s.db, d.OrderID, d.Version, "CANCELLED"); errors.Is(err, orders.ErrConflict) {
+		return Reply{IntentConflict, d.OrderID, conflictReply}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("cancel order: %w", err)
+	}
+	if err := orders.RecordStatusChange(ctx, s.db, d.OrderID, "CANCELLED"); err != nil {
+		s.logger.Error("failed to record order status", zap.Error(err))
+	}
+	orders.PublishStatus(ctx, s.bus, s.logger, orders.StatusEvent{
+		UserID: userID, OrderID: d.OrderID, Status: "CANCELLED",
+	})
+
+	return Reply{IntentCancel, d.OrderID, s.persona(ctx).say(replyCancelled, replyData{})}, nil
+}
+
+// HandleWaitlist queues the draft's items until there is room. The draft
+// stays pending; "confirm" places it once the claim arrives.
+func (s *Service) HandleWaitlist(ctx context.Context, userID int, d Draft) (Reply, error) {
+	items, err := draftItems(ctx, s.db, d.OrderID)
+	if err != nil {
+		return Reply{}, fmt.Errorf("load pending order items: %w", err)
+	}
+	if _, err := waitlist.Join(ctx, s.db, userID, items); errors.Is(err, waitlist.ErrAlreadyWaiting) {
+		return Reply{IntentWaitlist, d.OrderID, "You're already on the waitlist. We'll email you as soon as there's room."}, nil
+	} else if err != nil {
+		return Reply{}, fmt.Errorf("join waitlist: %w", err)
+	}
+	return Reply{IntentWaitlist, d.OrderID, fmt.Sprintf(
+		"You're on the waitlist. When there's room we'll email you a link, and your order is held for %.0f hours.",
+		waitlist.ClaimWindow.Hours())}, nil
+}
+
+// supersede silently cancels a draft the student moved on from. A conflict
+// means another message already settled it.
+func (s *Service) supersede(ctx context.Context, userID int, d Draft) {
+	if err := orders.UpdateStatus(ctx, s.db, d.OrderID, d.Version, "CANCELLED"); err == nil {
+		_ = orders.RecordStatusChange(ctx, s.db, d.OrderID, "CANCELLED")
+		orders.PublishStatus(ctx, s.bus, s.logger, orders.StatusEvent{
+			UserID: userID, OrderID: d.OrderID, Status: "CANCELLED", Silent: true,
+		})
+	}
+}
+
+// CreateDraft asks the LLM which products the message names, looks each up
+// in the catalogue, and stores them as a PENDING order. A product matching
+// several sizes of an item becomes one of the draft's Questions instead of
+// a line. It fails with
+// ErrNothingToOrder or *UnavailableError when there is nothing it can draft.
+func (s *Service) CreateDraft(ctx context.Context, userID int, message string) (Draft, error) {
+	if !s.health.Available(DependencyCatalog) {
+		return Draft{}, ErrCatalogDown
+	}
+
+	// Phase 1: extract product names and quantities
+	ctx1, cancel1 := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel1()
+
+	parsedList, err := s.extractProducts(ctx1, message)
+	if err != nil {
+		return Draft{}, fmt.Errorf("extract products: %w", err)
+	}
+	s.logger.Info("Phase1 parsed products", zap.Any("parsed", parsedList))
+	if len(parsedList) == 0 {
+		return Draft{}, ErrNothingToOrder
+	}
+
+	// Phase 2: create the PENDING order and insert items under it
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Draft{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var d Draft
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO orders (user_id, status, transport_fee, total_cost, created_at)
+		 VALUES ($1, 'PENDING', 0, 0, NOW())
+		 RETURNING id, version`,
+		userID,
+	).Scan(&d.OrderID, &d.Version); err != nil {
+		return Draft{}, fmt.Errorf("create pending order: %w", err)
+	}
+	if err := orders.RecordStatusChange(ctx, tx, d.OrderID, "PENDING"); err != nil {
+		return Draft{}, fmt.Errorf("record order status: %w", err)
+	}
+
+	group, err := pricing.GroupFor(ctx, tx, userID)
+	if err != nil {
+		return Draft{}, fmt.Errorf("fetch pricing group: %w", err)
+	}
+	order := pricing.Order{Group: group}
+	for _, p := range parsedList {
+		hit, err := s.catalog.SearchItem(ctx, p.Name)
+		if err != nil {
+			return Draft{}, fmt.Errorf("catalog lookup: %w", err)
+		}
+		if hit == nil {
+			// Kept for admins to map to an item; see catalog.MapMiss
+			if err := catalog.RecordMiss(ctx, s.db, userID, p.Name, message); err != nil {
+				s.logger.Warn("failed to record catalog miss", zap.String("phrase", p.Name), zap.Error(err))
+			}
+		}
+		if hit == nil || !hit.Available {
+			return Draft{}, &UnavailableError{Name: p.Name}
+		}
+		// "milk" with several sizes in stock is asked about, not guessed
+		hit, options, err := variants(ctx, tx, hit, p.Name)
+		if err != nil {
+			return Draft{}, fmt.Errorf("look up sizes: %w", err)
+		}
+		if options != nil {
+			d.Questions = append(d.Questions, Clarification{Phrase: p.Name, Quantity: p.Quantity, Options: options})
+			continue
+		}
+
+		taxRate, err := tax.RateForItem(ctx, tx, hit.ID)
+		if err != nil {
+			return Draft{}, fmt.Errorf("fetch tax rate: %w", err)
+		}
+		// The catalog may not know about scheduled prices
+		price, err := pricing.CurrentPrice(ctx, tx, hit.ID)
+		if err != nil {
+			return Draft{}, fmt.Errorf("fetch price: %w", err)
+		}
+		order.Lines = append(order.Lines, pricing.Line{
+			ItemID: hit.ID, Quantity: p.Quantity, UnitPrice: price, TaxRateBps: taxRate,
+		})
+		d.Items = append(d.Items, DraftItem{Name: p.Name, Quantity: p.Quantity, UnitPrice: group.Price(price)})
+	}
+
+	// The fee depends on when the draft is confirmed, so only the lines count yet
+	quote := pricing.Quote(order)
+	for _, l := range quote.Lines {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO order_items (order_id, item_id, quantity, unit_price, tax_rate_bps, tax_amount)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			d.OrderID, l.ItemID, l.Quantity, l.UnitPrice, l.TaxRateBps, l.Tax,
+		); err != nil {
+			return Draft{}, fmt.Errorf("insert order item: %w", err)
+		}
+	}
+	if err := saveClarifications(ctx, tx, d.OrderID, d.Questions); err != nil {
+		return Draft{}, fmt.Errorf("save clarifications: %w", err)
+	}
+	d.Subtotal, d.TaxTotal = quote.Subtotal, quote.TaxTotal
+	if d.SmallOrder, err = orders.SmallOrderRuleFor(ctx, tx, d.OrderID); err != nil {
+		return Draft{}, fmt.Errorf("fetch minimum order: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE orders SET tax_total = $1 WHERE id = $2`, d.TaxTotal, d.OrderID,
+	); err != nil {
+		return Draft{}, fmt.Errorf("update tax total: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Draft{}, fmt.Errorf("commit draft: %w", err)
+	}
+	orders.PublishStatus(ctx, s.bus, s.logger, orders.StatusEvent{
+		UserID: userID, OrderID: d.OrderID, Status: "PENDING",
+	})
+	return d, nil
+}
+
+// SummarizeDraft lists a new draft's items, with any suggestions of what
+// else to add, and asks the student to confirm. Amounts are written in l.
+func SummarizeDraft(d Draft, suggestions []Suggestion, l locale.Locale) string {
+	var lines []string
+	for _, it := range d.Items {
+		lines = append(lines, fmt.Sprintf("- %s × %d @ %s = %s",
+			it.Name, it.Quantity, l.Money(it.UnitPrice), l.Money(it.Quantity*it.UnitPrice),
+		))
+	}
+
+	breakdown := "Okay, here's a summary of your order:\n\n"
+	breakdown += "Items:\n" + strings.Join(lines, "\n") + "\n\n"
+	breakdown += fmt.Sprintf("Subtotal: %s\n", l.Money(d.Subtotal))
+	if d.TaxTotal > 0 {
+		breakdown += fmt.Sprintf("(includes VAT of %s)\n", l.Money(d.TaxTotal))
+	}
+	breakdown += "\n"
+	if r := d.SmallOrder; d.Subtotal < r.Minimum {
+		if r.Refuse {
+			breakdown += fmt.Sprintf("Orders must come to at least %s, so this one needs %s more before you can confirm it.\n\n",
+				l.Money(r.Minimum), l.Money(r.Minimum-d.Subtotal))
+		} else if r.Fee > 0 {
+			breakdown += fmt.Sprintf("Orders under %s carry a small-order fee of %s.\n\n", l.Money(r.Minimum), l.Money(r.Fee))
+		}
+	}
+	if d.Note != "" {
+		breakdown += fmt.Sprintf("Note for our team: \"%s\"\n\n", d.Note)
+	}
+	breakdown += "Once you confirm, we'll add a transport fee and give you the grand total.\n\n"
+	for _, sg := range suggestions {
+		breakdown += fmt.Sprintf("People who buy %s often add %s.\n", sg.With, sg.Name)
+	}
+	if len(suggestions) > 0 {
+		breakdown += "\n"
+	}
+	breakdown += "Do you confirm the contents of this order?"
+	return breakdown
+}
+
+// waitlistHint follows replies that leave a draft pending because the order
+// cannot go through yet.
+const waitlistHint = " Say \"waitlist\" and we'll email you when there's room."
+
+// conflictReply answers a message that lost the race to update a pending
+// order, e.g. a double-tapped "confirm".
+const conflictReply = "That order was just updated by another message. Check your orders page for its current status."
+
+// draftItems returns the lines of a pending order, to queue on the waitlist.
+func draftItems(ctx context.Context, db *sql.DB, orderID int) ([]waitlist.Item, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT item_id, SUM(quantity) FROM order_items WHERE order_id = $1 GROUP BY item_id ORDER BY item_id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []waitlist.Item
+	for rows.Next() {
+		var it waitlist.Item
+		if err := rows.Scan(&it.ItemID, &it.Quantity); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
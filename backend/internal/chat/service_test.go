@@ -0,0 +1,259 @@
+package chat_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"server/internal/chat"
+	"server/internal/chat/chatfake"
+	"server/internal/events"
+	"server/internal/testutil"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const userID = 7
+
+// fixture is a Service over the fakes and a mocked database, whose
+// statements are expected by a distinctive fragment of their SQL.
+type fixture struct {
+	svc       *chat.Service
+	db        sqlmock.Sqlmock
+	extractor *chatfake.Extractor
+	catalog   *chatfake.Catalog
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	db, mock := testutil.NewMock(t)
+	f := &fixture{
+		db:        mock,
+		extractor: &chatfake.Extractor{Replies: map[string][]chat.ParsedProduct{}},
+		catalog: &chatfake.Catalog{Items: []chat.CatalogItem{
+			{ID: 1, Name: "Bread", PriceUGX: 4000, Available: true},
+			{ID: 2, Name: "Sugar", PriceUGX: 6000, Available: false},
+		}},
+	}
+	meter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_requests_total"}, []string{"endpoint"})
+	f.svc = chat.NewService(db, zap.NewNop(), meter, f.extractor, f.catalog, &chatfake.Moderator{},
+		events.NewMemoryBus(), nil, nil, nil)
+	return f
+}
+
+// startTurn expects the turn lock, the suspension check, and the lookup of
+// the pending draft, which is orderID at version 1 unless orderID is 0.
+func (f *fixture) startTurn(orderID int) {
+	f.db.ExpectExec("INSERT INTO chat_turn_locks").WillReturnResult(sqlmock.NewResult(0, 1))
+	f.db.ExpectQuery("FROM chat_suspensions").WillReturnRows(sqlmock.NewRows([]string{"until"}))
+	pending := sqlmock.NewRows([]string{"id", "version"})
+	if orderID != 0 {
+		pending.AddRow(orderID, 1)
+	}
+	f.db.ExpectQuery("status = 'PENDING'").WillReturnRows(pending)
+}
+
+// endTurn expects the turn's transcript entry and the lock's release.
+func (f *fixture) endTurn(intent string) {
+	f.db.ExpectExec("INSERT INTO chat_turns").
+		WithArgs(userID, sqlmock.AnyArg(), intent, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	f.db.ExpectExec("DELETE FROM chat_turn_locks").WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectPersona expects the assistant's settings, none of them set.
+func (f *fixture) expectPersona() {
+	f.db.ExpectQuery("FROM config WHERE key = ANY").WillReturnRows(sqlmock.NewRows([]string{"key", "value_json"}))
+}
+
+// expectLocale expects the student's campus locale.
+func (f *fixture) expectLocale() {
+	f.db.ExpectQuery("SELECT c.currency, c.time_zone FROM users u").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "time_zone"}).AddRow("UGX", "Africa/Kampala"))
+}
+
+func (f *fixture) handle(t *testing.T, message string) chat.Reply {
+	t.Helper()
+	reply, err := f.svc.Handle(context.Background(), userID, message)
+	if err != nil {
+		t.Fatalf("Handle(%q): %v", message, err)
+	}
+	return reply
+}
+
+func TestHandleOffTopic(t *testing.T) {
+	f := newFixture(t)
+	f.startTurn(0)
+	f.expectPersona()
+	f.endTurn(chat.IntentOffTopic)
+
+	reply := f.handle(t, "tell me a joke")
+	if reply.Intent != chat.IntentOffTopic || reply.OrderID != 0 {
+		t.Errorf("reply = %+v, want %s with no order", reply, chat.IntentOffTopic)
+	}
+	if len(f.extractor.Calls) != 1 {
+		t.Errorf("extractor called %d times, want 1", len(f.extractor.Calls))
+	}
+}
+
+func TestHandleUnavailable(t *testing.T) {
+	tests := []struct {
+		name    string
+		product string
+		miss    bool // not in the catalog at all, so recorded for admins
+	}{
+		{"sold out", "sugar", false},
+		{"not in the catalog", "caviar", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			message := "2 " + tt.product
+			f.extractor.Replies[message] = []chat.ParsedProduct{{Name: tt.product, Quantity: 2}}
+			f.startTurn(0)
+			f.db.ExpectBegin()
+			f.db.ExpectQuery("INSERT INTO orders").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(40, 1))
+			f.db.ExpectExec("INSERT INTO order_status_history").
+				WithArgs(40, "PENDING").WillReturnResult(sqlmock.NewResult(1, 1))
+			f.db.ExpectQuery("JOIN user_groups").WillReturnRows(sqlmock.NewRows([]string{"x"}))
+			if tt.miss {
+				f.db.ExpectExec("catalog_misses").WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			f.db.ExpectRollback()
+			f.expectPersona()
+			f.endTurn(chat.IntentUnavailable)
+
+			reply := f.handle(t, message)
+			if reply.Intent != chat.IntentUnavailable {
+				t.Errorf("intent = %s, want %s", reply.Intent, chat.IntentUnavailable)
+			}
+			if !strings.Contains(reply.Text, tt.product) {
+				t.Errorf("reply %q does not name %q", reply.Text, tt.product)
+			}
+		})
+	}
+}
+
+func TestHandleCancel(t *testing.T) {
+	f := newFixture(t)
+	f.startTurn(40)
+	f.db.ExpectQuery("FROM order_clarifications").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "phrase", "quantity", "item_ids"}))
+	f.db.ExpectExec("UPDATE orders SET status=$1").
+		WithArgs("CANCELLED", 40, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	f.db.ExpectExec("INSERT INTO order_status_history").
+		WithArgs(40, "CANCELLED").WillReturnResult(sqlmock.NewResult(1, 1))
+	f.expectPersona()
+	f.endTurn(chat.IntentCancel)
+
+	reply := f.handle(t, "cancel please")
+	if reply.Intent != chat.IntentCancel || reply.OrderID != 40 {
+		t.Errorf("reply = %+v, want %s of order 40", reply, chat.IntentCancel)
+	}
+	if len(f.extractor.Calls) != 0 {
+		t.Errorf("extractor called with %q; cancelling needs no LLM", f.extractor.Calls)
+	}
+}
+
+func TestHandleCancelConflict(t *testing.T) {
+	f := newFixture(t)
+	f.startTurn(40)
+	f.db.ExpectQuery("FROM order_clarifications").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "phrase", "quantity", "item_ids"}))
+	// Another message settled the draft first
+	f.db.ExpectExec("UPDATE orders SET status=$1").
+		WithArgs("CANCELLED", 40, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+	f.endTurn(chat.IntentConflict)
+
+	if reply := f.handle(t, "cancel"); reply.Intent != chat.IntentConflict {
+		t.Errorf("intent = %s, want %s", reply.Intent, chat.IntentConflict)
+	}
+}
+
+// expectConfirmation expects confirming draft 40, two loaves at UGX 4,000,
+// as the student's first order of the day on a campus with no limits.
+func (f *fixture) expectConfirmation() {
+	f.db.ExpectQuery("FROM order_clarifications").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "phrase", "quantity", "item_ids"}))
+	f.db.ExpectBegin()
+	f.db.ExpectExec("SELECT pg_advisory_xact_lock($1, $2)").WillReturnResult(sqlmock.NewResult(0, 0))
+	f.db.ExpectQuery("SELECT COUNT(*) FROM orders o").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	f.db.ExpectExec("UPDATE orders SET status=$1").
+		WithArgs("CONFIRMED", 40, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	f.db.ExpectExec("INSERT INTO order_status_history").
+		WithArgs(40, "CONFIRMED").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Campus capacity, unlimited
+	f.db.ExpectQuery("UPDATE orders o SET campus").WillReturnRows(sqlmock.NewRows([]string{"campus"}).AddRow("Main"))
+	f.db.ExpectExec("campus-capacity").WillReturnResult(sqlmock.NewResult(0, 0))
+	f.db.ExpectQuery("SELECT daily_capacity").WillReturnRows(sqlmock.NewRows([]string{"daily_capacity"}).AddRow(nil))
+	f.db.ExpectExec("UPDATE waitlist SET status = 'CLAIMED'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// Not a duplicate
+	f.db.ExpectQuery("JOIN LATERAL").WillReturnRows(sqlmock.NewRows([]string{"id", "at"}))
+
+	// Pricing: 2 × 4,000 plus the first tier's transport fee
+	f.db.ExpectQuery("SELECT c.min_order_ugx").
+		WillReturnRows(sqlmock.NewRows([]string{"min_order_ugx", "small_order_fee_ugx"}).AddRow(nil, nil))
+	f.db.ExpectQuery("SELECT user_id FROM orders").WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
+	f.db.ExpectQuery("JOIN user_groups").WillReturnRows(sqlmock.NewRows([]string{"x"}))
+	f.db.ExpectQuery("FROM order_items WHERE order_id = $1 ORDER BY id").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "item_id", "quantity", "price", "tax_rate_bps"}).AddRow(100, 1, 2, 4000, 0))
+	f.db.ExpectExec("UPDATE order_items SET unit_price").
+		WithArgs(4000, 0, 100).WillReturnResult(sqlmock.NewResult(0, 1))
+	f.db.ExpectExec("UPDATE orders SET transport_fee").
+		WithArgs(1000, 0, 9000, 0, false, 40).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// No weekly budget, no tracked stock
+	f.db.ExpectQuery("SELECT weekly_budget").WillReturnRows(
+		sqlmock.NewRows([]string{"weekly_budget", "budget_mode", "budget_locked", "spent"}).AddRow(nil, "warn", false, 0))
+	f.db.ExpectQuery("UPDATE items i SET stock").WillReturnRows(sqlmock.NewRows([]string{"id", "name", "stock"}))
+	f.db.ExpectExec("stock_reserved = TRUE").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Receipt and ledger entries for the items and the fee
+	f.db.ExpectQuery("nextval('receipt_number_seq')").WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(1))
+	f.db.ExpectQuery("UPDATE orders SET receipt_number").WithArgs("R00000001", 40).WillReturnRows(
+		sqlmock.NewRows([]string{"transport_fee", "small_order_fee", "total_cost"}).AddRow(1000, 0, 9000))
+	f.db.ExpectExec("SELECT pg_advisory_xact_lock($1)").WillReturnResult(sqlmock.NewResult(0, 0))
+	f.db.ExpectQuery("SELECT hash FROM ledger_entries").WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+	f.db.ExpectExec("INSERT INTO ledger_entries").
+		WithArgs(40, "R00000001", sqlmock.AnyArg(), 8000, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	f.db.ExpectExec("INSERT INTO ledger_entries").
+		WithArgs(40, "R00000001", sqlmock.AnyArg(), 1000, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	f.db.ExpectCommit()
+}
+
+func TestHandleConfirm(t *testing.T) {
+	f := newFixture(t)
+	f.startTurn(40)
+	f.expectConfirmation()
+	f.expectPersona()
+	f.expectLocale()
+	f.endTurn(chat.IntentConfirm)
+
+	reply := f.handle(t, "confirm")
+	if reply.Intent != chat.IntentConfirm || reply.OrderID != 40 {
+		t.Errorf("reply = %+v, want %s of order 40", reply, chat.IntentConfirm)
+	}
+	if len(f.extractor.Calls) != 0 {
+		t.Errorf("extractor called with %q; confirming needs no LLM", f.extractor.Calls)
+	}
+}
+
+func TestHandleBusy(t *testing.T) {
+	f := newFixture(t)
+	// Another instance is still working on the student's last message
+	f.db.ExpectExec("INSERT INTO chat_turn_locks").WillReturnResult(sqlmock.NewResult(0, 0))
+	f.db.ExpectExec("INSERT INTO chat_turns").
+		WithArgs(userID, 0, chat.IntentBusy, "confirm", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if reply := f.handle(t, "confirm"); reply.Intent != chat.IntentBusy {
+		t.Errorf("intent = %s, want %s", reply.Intent, chat.IntentBusy)
+	}
+}
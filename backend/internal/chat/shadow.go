@@ -0,0 +1,140 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"server/internal/background"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Shadow comparison limits: a shadow search gets shadowTimeout of its own,
+// and at most maxShadowSearches run at once; searches past that are skipped
+// rather than queued, so a slow shadow can never back up the chat.
+const (
+	shadowTimeout     = 5 * time.Second
+	maxShadowSearches = 16
+)
+
+// ShadowCatalog answers from Primary and, alongside, asks Shadow the same
+// question, counting and logging where the two disagree. Only Primary's
+// answer is used; the shadow never adds latency or errors to the chat.
+type ShadowCatalog struct {
+	Primary CatalogSearcher
+	Shadow  CatalogSearcher
+	Logger  *zap.Logger
+	// Compared counts searches by outcome: match, mismatch (different
+	// items), detail_mismatch (same item, different price or
+	// availability), primary_only, shadow_only, primary_error,
+	// shadow_error, or skipped. Optional.
+	Compared *prometheus.CounterVec
+
+	slots chan struct{}
+}
+
+// NewShadowCatalog returns a catalog answering from primary and comparing
+// shadow with it.
+func NewShadowCatalog(primary, shadow CatalogSearcher, logger *zap.Logger) *ShadowCatalog {
+	return &ShadowCatalog{
+		Primary: primary,
+		Shadow:  shadow,
+		Logger:  logger,
+		slots:   make(chan struct{}, maxShadowSearches),
+	}
+}
+
+type shadowResult struct {
+	item *CatalogItem
+	err  error
+}
+
+// SearchItem returns Primary's match for name, starting Shadow's search
+// at the same time and comparing the two once both are in.
+func (s *ShadowCatalog) SearchItem(ctx context.Context, name string) (*CatalogItem, error) {
+	var shadow chan shadowResult
+	select {
+	case s.slots <- struct{}{}:
+		shadow = make(chan shadowResult, 1)
+		sctx, done := background.TaskTimeout(ctx, shadowTimeout)
+		go func() {
+			defer func() { <-s.slots }()
+			defer done()
+			item, err := s.Shadow.SearchItem(sctx, name)
+			shadow <- shadowResult{item, err}
+		}()
+	default:
+		s.count("skipped")
+	}
+
+	item, err := s.Primary.SearchItem(ctx, name)
+	if shadow != nil {
+		go func() {
+			r := <-shadow
+			s.compare(name, item, err, r.item, r.err)
+		}()
+	}
+	return item, err
+}
+
+// SearchItems returns Primary's matches for query. Browsing is not
+// compared; the shadow is judged on the single matches orders are built
+// from.
+func (s *ShadowCatalog) SearchItems(ctx context.Context, query string, limit int) ([]CatalogItem, error) {
+	return s.Primary.SearchItems(ctx, query, limit)
+}
+
+// compare counts one pair of answers and logs any disagreement.
+func (s *ShadowCatalog) compare(query string, primary *CatalogItem, primaryErr error, shadow *CatalogItem, shadowErr error) {
+	var outcome string
+	switch {
+	case primaryErr != nil:
+		outcome = "primary_error"
+	case shadowErr != nil:
+		outcome = "shadow_error"
+	case primary == nil && shadow == nil:
+		outcome = "match"
+	case shadow == nil:
+		outcome = "primary_only"
+	case primary == nil:
+		outcome = "shadow_only"
+	case primary.ID != shadow.ID:
+		outcome = "mismatch"
+	case primary.PriceUGX != shadow.PriceUGX || primary.Available != shadow.Available:
+		outcome = "detail_mismatch"
+	default:
+		outcome = "match"
+	}
+	s.count(outcome)
+	if outcome == "match" {
+		return
+	}
+
+	fields := []zap.Field{zap.String("outcome", outcome), zap.String("query", query)}
+	fields = append(fields, catalogFields("primary", primary, primaryErr)...)
+	fields = append(fields, catalogFields("shadow", shadow, shadowErr)...)
+	s.Logger.Info("catalog shadow disagreement", fields...)
+}
+
+func (s *ShadowCatalog) count(outcome string) {
+	if s.Compared != nil {
+		s.Compared.WithLabelValues(outcome).Inc()
+	}
+}
+
+// catalogFields describes one side of a comparison for the log.
+func catalogFields(side string, item *CatalogItem, err error) []zap.Field {
+	switch {
+	case err != nil:
+		return []zap.Field{zap.NamedError(side+"_error", err)}
+	case item == nil:
+		return []zap.Field{zap.Bool(side+"_found", false)}
+	}
+	return []zap.Field{
+		zap.Int(side+"_id", item.ID),
+		zap.String(side+"_name", item.Name),
+		zap.Int(side+"_price_ugx", item.PriceUGX),
+		zap.Bool(side+"_available", item.Available),
+	}
+}
@@ -0,0 +1,157 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/locale"
+	"server/internal/orders"
+)
+
+// maxStatusOrders is how many recent orders a status question is answered
+// about when it names none.
+const maxStatusOrders = 3
+
+// orderNumber finds an order referred to by number: "#42", "order no. 42",
+// or "order 42" ending a clause; "order 2 bread" is a request, not a number.
+var orderNumber = regexp.MustCompile(`#\s*(\d+)|\border\s+(?:no\.?|number)\s*#?\s*(\d+)|\border\s+(\d+)\s*(?:[?.!,]|$)`)
+
+// statusWords mark a message as asking after an order rather than placing
+// one.
+var statusWords = []string{
+	"where", "status", "when", "ready", "track", "arrive", "coming",
+	"collect", "pick up", "pickup", "happened", "packed",
+}
+
+// statusQuestion reports whether lowerText asks after the student's orders,
+// e.g. "where is my order?" or "is #42 ready?", and which order it names, if
+// any.
+func statusQuestion(lowerText string) (orderID int, ok bool) {
+	if m := orderNumber.FindStringSubmatch(lowerText); m != nil {
+		for _, g := range m[1:] {
+			if g != "" {
+				orderID, _ = strconv.Atoi(g)
+				break
+			}
+		}
+	}
+	asks := false
+	for _, w := range statusWords {
+		if strings.Contains(lowerText, w) {
+			asks = true
+			break
+		}
+	}
+	mine := strings.Contains(lowerText, "my order") || strings.Contains(lowerText, "order status")
+	return orderID, asks && (mine || orderID > 0)
+}
+
+// draftCommand reports whether lowerText acts on the pending draft, which
+// takes precedence over a status question in the same message.
+func draftCommand(lowerText string) bool {
+	return strings.Contains(lowerText, "confirm") || strings.Contains(lowerText, "cancel") ||
+		strings.Contains(lowerText, "waitlist")
+}
+
+// statusOrder is one order a status reply describes.
+type statusOrder struct {
+	id        int
+	status    string
+	total     int
+	createdAt time.Time
+}
+
+// HandleOrderStatus answers a question about the student's orders: orderID's
+// status, or with 0 that of their most recent few, with when and where each
+// waiting order will be ready. Drafts are only described when asked for by
+// number. Archived orders are included.
+func (s *Service) HandleOrderStatus(ctx context.Context, userID, orderID int) (Reply, error) {
+	var list []statusOrder
+	if orderID > 0 {
+		var o statusOrder
+		err := s.db.QueryRowContext(ctx,
+			`SELECT id, status, total_cost, created_at FROM all_orders WHERE id = $1 AND user_id = $2`,
+			orderID, userID,
+		).Scan(&o.id, &o.status, &o.total, &o.createdAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return Reply{IntentOrderStatus, 0, fmt.Sprintf(
+				"I couldn't find order #%d on your account. Check the number on your orders page.", orderID)}, nil
+		} else if err != nil {
+			return Reply{}, fmt.Errorf("look up order: %w", err)
+		}
+		list = append(list, o)
+	} else {
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT id, status, total_cost, created_at FROM all_orders
+			  WHERE user_id = $1 AND status <> 'PENDING'
+			  ORDER BY created_at DESC, id DESC LIMIT $2`, userID, maxStatusOrders)
+		if err != nil {
+			return Reply{}, fmt.Errorf("look up orders: %w", err)
+		}
+		for rows.Next() {
+			var o statusOrder
+			if err := rows.Scan(&o.id, &o.status, &o.total, &o.createdAt); err != nil {
+				rows.Close()
+				return Reply{}, fmt.Errorf("look up orders: %w", err)
+			}
+			list = append(list, o)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return Reply{}, fmt.Errorf("look up orders: %w", err)
+		}
+	}
+	if len(list) == 0 {
+		return Reply{IntentOrderStatus, 0,
+			"You haven't placed any orders yet. Tell me what you need, e.g. \"2 bread and 1 sugar\", and I'll draft one."}, nil
+	}
+
+	station := orders.PickupStationFor(ctx, s.db, userID)
+	l := s.campusLocale(ctx, userID)
+	lines := make([]string, 0, len(list))
+	for _, o := range list {
+		line, err := s.describeOrder(ctx, o, station, l)
+		if err != nil {
+			return Reply{}, err
+		}
+		lines = append(lines, line)
+	}
+	s.meter.WithLabelValues("order_status").Inc()
+	return Reply{IntentOrderStatus, list[0].id, strings.Join(lines, "\n\n")}, nil
+}
+
+// describeOrder is one order's line of a status reply, written in l.
+func (s *Service) describeOrder(ctx context.Context, o statusOrder, station string, l locale.Locale) (string, error) {
+	head := fmt.Sprintf("Order #%d (%s, placed %s)", o.id, l.Money(o.total), l.Date(o.createdAt))
+	switch o.status {
+	case "PENDING":
+		return head + " is a draft you haven't confirmed yet. Say \"confirm\" to place it.", nil
+	case "CANCELLED":
+		return head + " was cancelled.", nil
+	case "FULFILLED":
+		return head + " has been collected. Thank you!", nil
+	}
+
+	// Confirmed or packed: where it stands in today's pickup queue
+	eta, err := orders.OrderETA(ctx, s.db, o.id)
+	if err != nil {
+		return "", fmt.Errorf("estimate order ETA: %w", err)
+	}
+	where := fmt.Sprintf(" Pick it up at %s.", station)
+	if eta != nil {
+		return head + ": " + eta.Message + where, nil
+	}
+	at, err := orders.ConfirmedAt(ctx, s.db, o.id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return head + fmt.Sprintf(" is confirmed for pickup at %s.", orders.PickupTime) + where, nil
+	} else if err != nil {
+		return "", fmt.Errorf("look up confirmation: %w", err)
+	}
+	return head + fmt.Sprintf(" was ready for pickup from %s.", l.DateTime(orders.PickupAt(at))) + where, nil
+}
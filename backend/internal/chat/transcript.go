@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+
+	"go.uber.org/zap"
+)
+
+// Intents recorded with each chat turn.
+const (
+	IntentNewOrder        = "NEW_ORDER"
+	IntentConfirm         = "CONFIRM"
+	IntentCancel          = "CANCEL"
+	IntentConflict        = "CONFLICT"
+	IntentOffTopic        = "OFF_TOPIC"
+	IntentUnavailable     = "UNAVAILABLE"
+	IntentBlocked         = "BLOCKED"
+	IntentSuspended       = "SUSPENDED"
+	IntentFull            = "FULL" // the campus reached its daily order capacity
+	IntentWaitlist        = "WAITLIST"
+	IntentOverBudget      = "OVER_BUDGET"      // the order would exceed the student's weekly budget
+	IntentDuplicate       = "DUPLICATE"        // the same items were ordered within the hour
+	IntentBelowMinimum    = "BELOW_MINIMUM"    // the order is under the campus minimum basket
+	IntentCatalogQuestion = "CATALOG_QUESTION" // answered from the menu snapshot
+	IntentBusy            = "BUSY"             // sent while the previous message was still being processed
+	IntentOffNetwork      = "OFF_NETWORK"      // the campus only takes orders from its own network
+	IntentClarify         = "CLARIFY"          // a product matched several sizes; the student was asked which
+	IntentOrderStatus     = "ORDER_STATUS"     // answered from the student's orders
+	IntentCatalogDown     = "CATALOG_DOWN"     // the catalog backend's health probes are failing
+	IntentNote            = "NOTE"             // a note for the packers was left on an order
+	IntentAskCatalog      = "ASK_CATALOG"      // a price or availability question answered from a catalog search
+)
+
+// recordTurn stores a message and its reply so admins can reconstruct the
+// conversation behind an order. orderID 0 means the turn touched no order.
+// Failures are logged; the student has already been answered.
+func recordTurn(ctx context.Context, db *sql.DB, logger *zap.Logger, userID, orderID int, intent, message, reply string) {
+	if _, err := db.ExecContext(ctx,
+		`INSERT INTO chat_turns (user_id, order_id, intent, message, reply) VALUES ($1, NULLIF($2, 0), $3, $4, $5)`,
+		userID, orderID, intent, message, reply,
+	); err != nil {
+		logger.Error("failed to record chat turn", zap.Int("user_id", userID), zap.Error(err))
+	}
+}
@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+// turnLockTTL is how long a student's chat turn lock holds if it is never
+// released, e.g. because the instance processing the turn died. It outlasts
+// the slowest LLM and catalog calls.
+const turnLockTTL = "1 minute"
+
+// lockTurn claims the student's chat for one turn, so turns never run
+// concurrently over the same draft, however many instances serve chat. ok
+// is false while another turn holds it; otherwise release must be called
+// once the turn is done.
+func (s *Service) lockTurn(ctx context.Context, userID int) (release func(), ok bool, err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, false, err
+	}
+	token := hex.EncodeToString(b)
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO chat_turn_locks (user_id, token, expires_at) VALUES ($1, $2, NOW() + $3::interval)
+		 ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, expires_at = EXCLUDED.expires_at
+		  WHERE chat_turn_locks.expires_at < NOW()`,
+		userID, token, turnLockTTL)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, false, nil
+	}
+	return func() {
+		if _, err := s.db.ExecContext(context.WithoutCancel(ctx),
+			`DELETE FROM chat_turn_locks WHERE user_id = $1 AND token = $2`, userID, token,
+		); err != nil {
+			s.logger.Warn("failed to release chat turn lock", zap.Int("user_id", userID), zap.Error(err))
+		}
+	}, true, nil
+}
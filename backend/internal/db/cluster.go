@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// DefaultStickyWindow is how long a client's reads stay on the primary after
+// it sends a write, so it never reads a replica that has not caught up yet.
+const DefaultStickyWindow = 5 * time.Second
+
+const stickyCookie = "jaj_primary"
+
+type primaryKey struct{}
+
+// Cluster routes queries between a primary and an optional read replica.
+// Writes, and reads that must see them, go to Primary; everything else may
+// use Reader. Without a replica both resolve to the same pool.
+type Cluster struct {
+	Primary      *sql.DB
+	Replica      *sql.DB
+	StickyWindow time.Duration
+}
+
+// ConnectCluster opens the primary and, when replicaURL is set, the replica.
+func ConnectCluster(primaryURL, replicaURL string) (*Cluster, error) {
+	primary, err := Connect(primaryURL)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cluster{Primary: primary, Replica: primary, StickyWindow: DefaultStickyWindow}
+	if replicaURL == "" {
+		return c, nil
+	}
+	replica, err := Connect(replicaURL)
+	if err != nil {
+		primary.Close()
+		return nil, err
+	}
+	c.Replica = replica
+	return c, nil
+}
+
+// HasReplica reports whether reads can be offloaded to a separate pool.
+func (c *Cluster) HasReplica() bool {
+	return c.Replica != c.Primary
+}
+
+// Reader returns the pool to use for a read in ctx: the replica, unless the
+// request is inside its post-write stickiness window.
+func (c *Cluster) Reader(ctx context.Context) *sql.DB {
+	if sticky, _ := ctx.Value(primaryKey{}).(bool); sticky {
+		return c.Primary
+	}
+	return c.Replica
+}
+
+// Close closes both pools.
+func (c *Cluster) Close() error {
+	if c.HasReplica() {
+		c.Replica.Close()
+	}
+	return c.Primary.Close()
+}
+
+// Sticky is middleware that pins a client's reads to the primary for
+// StickyWindow after any non-safe request. The window travels in a short-lived
+// cookie so it holds across server instances.
+func (c *Cluster) Sticky(next http.Handler) http.Handler {
+	if !c.HasReplica() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sticky := false
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			_, err := r.Cookie(stickyCookie)
+			sticky = err == nil
+		default:
+			sticky = true
+			http.SetCookie(w, &http.Cookie{
+				Name:     stickyCookie,
+				Value:    strconv.FormatInt(time.Now().Unix(), 10),
+				Path:     "/",
+				MaxAge:   int(c.StickyWindow / time.Second),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		if sticky {
+			r = r.WithContext(context.WithValue(r.Context(), primaryKey{}, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MonitorLag samples the replica's replay lag every interval and records it
+// in gauge, in seconds, until ctx is done. It does nothing without a replica.
+func (c *Cluster) MonitorLag(ctx context.Context, gauge prometheus.Gauge, logger *zap.Logger, interval time.Duration) {
+	if !c.HasReplica() {
+		return
+	}
+	// An idle primary writes no WAL, so a replica that has replayed
+	// everything it received is treated as caught up.
+	const q = `
+		SELECT CASE
+		         WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		         ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		       END`
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var lag float64
+		if err := c.Replica.QueryRowContext(ctx, q).Scan(&lag); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("replica lag query failed", zap.Error(err))
+		} else {
+			gauge.Set(lag)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
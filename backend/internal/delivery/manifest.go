@@ -0,0 +1,189 @@
+package delivery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/fieldcrypt"
+	"server/internal/locale"
+
+	"go.uber.org/zap"
+)
+
+// Manifest is a runner's list of stops for one day, in visiting order.
+type Manifest struct {
+	Date   string `json:"date"`
+	Stops  []Stop `json:"stops"`
+	Orders int    `json:"orders"`
+	Items  int    `json:"items"`
+	Total  int    `json:"totalCost"`
+	// Collect is the cash the runner should come back with.
+	Collect int `json:"collect"`
+}
+
+// Build plans the deliveries of orders confirmed on day (a Kampala date)
+// and still awaiting handover.
+func Build(ctx context.Context, db *sql.DB, day time.Time, depot *Point) (Manifest, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT o.delivery_hall, COALESCE(o.delivery_block, ''), COALESCE(o.delivery_room, ''),
+		        o.id, u.username, COALESCE(u.phone, ''),
+		        (SELECT COALESCE(SUM(oi.quantity), 0) FROM order_items oi WHERE oi.order_id = o.id),
+		        o.total_cost, o.payment_status, o.note
+		   FROM orders o
+		   JOIN users u ON u.id = o.user_id
+		   JOIN LATERAL (SELECT MAX(h.changed_at) AS at FROM order_status_history h
+		                  WHERE h.order_id = o.id AND h.status = 'CONFIRMED') c ON TRUE
+		  WHERE o.delivery_hall IS NOT NULL
+		    AND o.status IN ('CONFIRMED', 'PACKED')
+		    AND c.at >= $1 AND c.at < $2
+		  ORDER BY o.delivery_hall, o.delivery_block, o.delivery_room, o.id`,
+		day, day.AddDate(0, 0, 1),
+	)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer rows.Close()
+
+	var deliveries []Delivery
+	for rows.Next() {
+		var d Delivery
+		var payment string
+		if err := rows.Scan(&d.Hall, &d.Block, &d.Room, &d.OrderID, &d.Username, fieldcrypt.Opened(&d.Phone),
+			&d.Items, &d.Total, &payment, &d.Note); err != nil {
+			return Manifest{}, err
+		}
+		if payment != "PAID" {
+			d.Collect = d.Total
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return Manifest{}, err
+	}
+
+	halls, err := hallLocations(ctx, db)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	m := Manifest{Date: day.Format("2006-01-02"), Stops: Plan(Group(deliveries), halls, depot)}
+	for _, s := range m.Stops {
+		m.Orders += len(s.Orders)
+		m.Items += s.Items
+		m.Total += s.Total
+		m.Collect += s.Collect
+	}
+	return m, nil
+}
+
+func hallLocations(ctx context.Context, db *sql.DB) (map[string]Point, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name, latitude, longitude FROM delivery_halls`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	halls := map[string]Point{}
+	for rows.Next() {
+		var name string
+		var p Point
+		if err := rows.Scan(&name, &p.Lat, &p.Lng); err != nil {
+			return nil, err
+		}
+		halls[name] = p
+	}
+	return halls, rows.Err()
+}
+
+// DepotFromEnv reads the runners' starting point from DELIVERY_DEPOT as
+// "lat,lng". It returns nil when unset.
+func DepotFromEnv() (*Point, error) {
+	v := os.Getenv("DELIVERY_DEPOT")
+	if v == "" {
+		return nil, nil
+	}
+	lat, lng, ok := strings.Cut(v, ",")
+	if !ok {
+		return nil, fmt.Errorf("DELIVERY_DEPOT must be lat,lng")
+	}
+	var p Point
+	var err error
+	if p.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+		return nil, fmt.Errorf("DELIVERY_DEPOT latitude: %w", err)
+	}
+	if p.Lng, err = strconv.ParseFloat(strings.TrimSpace(lng), 64); err != nil {
+		return nil, fmt.Errorf("DELIVERY_DEPOT longitude: %w", err)
+	}
+	return &p, nil
+}
+
+// csvText keeps a student's free text from being run as a formula when the
+// sheet is opened in a spreadsheet.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// MakeManifestHandler serves GET /staff/delivery/manifest: the day's
+// delivery stops (?date=YYYY-MM-DD, default today in Kampala) as JSON or,
+// with format=csv, a printable sheet with a total row after each stop.
+func MakeManifestHandler(db *sql.DB, logger *zap.Logger, depot *Point) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /staff/delivery/manifest", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		local := time.Now().In(locale.EAT)
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, locale.EAT)
+		if s := q.Get("date"); s != "" {
+			d, err := time.ParseInLocation("2006-01-02", s, locale.EAT)
+			if err != nil {
+				http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			day = d
+		}
+
+		m, err := Build(r.Context(), db, day, depot)
+		if err != nil {
+			logger.Error("delivery manifest query failed", zap.Error(err))
+			http.Error(w, "database query error", http.StatusInternalServerError)
+			return
+		}
+		if m.Stops == nil {
+			m.Stops = []Stop{}
+		}
+
+		if q.Get("format") != "csv" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(m)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="delivery-%s.csv"`, day.Format("20060102")))
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"stop", "hall", "block", "room", "order_id", "customer", "phone", "items", "total_ugx", "collect_ugx", "note"})
+		for _, s := range m.Stops {
+			stop := strconv.Itoa(s.Sequence)
+			for _, o := range s.Orders {
+				cw.Write([]string{stop, s.Hall, s.Block, o.Room, strconv.Itoa(o.OrderID), o.Username, o.Phone,
+					strconv.Itoa(o.Items), strconv.Itoa(o.Total), strconv.Itoa(o.Collect), csvText(o.Note)})
+			}
+			cw.Write([]string{stop, s.Hall, s.Block, "TOTAL", "", strconv.Itoa(len(s.Orders)) + " orders", "",
+				strconv.Itoa(s.Items), strconv.Itoa(s.Total), strconv.Itoa(s.Collect), ""})
+		}
+		cw.Write([]string{"", "", "", "GRAND TOTAL", "", strconv.Itoa(m.Orders) + " orders", "",
+			strconv.Itoa(m.Items), strconv.Itoa(m.Total), strconv.Itoa(m.Collect), ""})
+		cw.Flush()
+	})
+	return mux
+}
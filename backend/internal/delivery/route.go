@@ -0,0 +1,162 @@
+// Package delivery plans the day's deliveries to halls of residence: orders
+// are grouped into one stop per hall and block, and stops are put in a
+// walking order for the runner's manifest.
+package delivery
+
+import (
+	"math"
+	"sort"
+)
+
+// Order is one delivery on a runner's manifest.
+type Order struct {
+	OrderID  int    `json:"orderId"`
+	Username string `json:"username"`
+	Phone    string `json:"phone"`
+	Room     string `json:"room"`
+	Items    int    `json:"items"`
+	Total    int    `json:"totalCost"`
+	Collect  int    `json:"collect"` // cash to collect; 0 when already paid
+	Note     string `json:"note,omitempty"`
+}
+
+// Stop is every delivery to one block of one hall.
+type Stop struct {
+	Sequence int     `json:"sequence"`
+	Hall     string  `json:"hall"`
+	Block    string  `json:"block"`
+	Orders   []Order `json:"orders"`
+	Items    int     `json:"items"`
+	Total    int     `json:"totalCost"`
+	Collect  int     `json:"collect"`
+	// LegMeters is the straight-line distance from the previous stop, or from
+	// the depot for the first; nil when either end has no known location.
+	LegMeters *int `json:"legMeters,omitempty"`
+}
+
+// Point is a location in decimal degrees.
+type Point struct {
+	Lat, Lng float64
+}
+
+// Delivery is an order with the address it goes to.
+type Delivery struct {
+	Hall  string
+	Block string
+	Order
+}
+
+// Group puts deliveries into stops by (hall, block). Orders keep their given
+// order within a stop.
+func Group(orders []Delivery) []Stop {
+	index := map[[2]string]int{}
+	var stops []Stop
+	for _, o := range orders {
+		key := [2]string{o.Hall, o.Block}
+		i, ok := index[key]
+		if !ok {
+			i = len(stops)
+			index[key] = i
+			stops = append(stops, Stop{Hall: o.Hall, Block: o.Block})
+		}
+		s := &stops[i]
+		s.Orders = append(s.Orders, o.Order)
+		s.Items += o.Items
+		s.Total += o.Total
+		s.Collect += o.Collect
+	}
+	return stops
+}
+
+// Plan orders stops for walking: hall by hall, nearest unvisited hall next,
+// starting from depot (or, without one, from the hall with the most orders),
+// and within a hall by block. Halls with no known location follow in name
+// order. Sequence and LegMeters are filled in.
+func Plan(stops []Stop, halls map[string]Point, depot *Point) []Stop {
+	byHall := map[string][]Stop{}
+	var located, unlocated []string
+	for _, s := range stops {
+		if _, seen := byHall[s.Hall]; !seen {
+			if _, ok := halls[s.Hall]; ok {
+				located = append(located, s.Hall)
+			} else {
+				unlocated = append(unlocated, s.Hall)
+			}
+		}
+		byHall[s.Hall] = append(byHall[s.Hall], s)
+	}
+	sort.Strings(located)
+	sort.Strings(unlocated)
+
+	// Nearest neighbour over halls; with a dozen halls on a campus this is
+	// close enough to optimal and easy for a runner to sanity-check.
+	var route []string
+	here := depot
+	for len(located) > 0 {
+		next := 0
+		if here != nil {
+			best := math.Inf(1)
+			for i, h := range located {
+				if d := distance(*here, halls[h]); d < best {
+					best, next = d, i
+				}
+			}
+		} else {
+			for i, h := range located {
+				if orderCount(byHall[h]) > orderCount(byHall[located[next]]) {
+					next = i
+				}
+			}
+		}
+		h := located[next]
+		route = append(route, h)
+		located = append(located[:next], located[next+1:]...)
+		p := halls[h]
+		here = &p
+	}
+	route = append(route, unlocated...)
+
+	planned := make([]Stop, 0, len(stops))
+	prev := depot
+	for _, h := range route {
+		blocks := byHall[h]
+		sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].Block < blocks[j].Block })
+		p, ok := halls[h]
+		for i, s := range blocks {
+			s.Sequence = len(planned) + 1
+			if i == 0 && ok && prev != nil {
+				m := int(math.Round(distance(*prev, p)))
+				s.LegMeters = &m
+			} else if i > 0 && ok {
+				zero := 0 // blocks of a hall share its location
+				s.LegMeters = &zero
+			}
+			planned = append(planned, s)
+		}
+		if ok {
+			prev = &p
+		} else {
+			prev = nil
+		}
+	}
+	return planned
+}
+
+func orderCount(stops []Stop) int {
+	n := 0
+	for _, s := range stops {
+		n += len(s.Orders)
+	}
+	return n
+}
+
+// distance is the great-circle distance between a and b in meters.
+func distance(a, b Point) float64 {
+	const earthRadius = 6371000
+	rad := math.Pi / 180
+	dLat := (b.Lat - a.Lat) * rad
+	dLng := (b.Lng - a.Lng) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Lat*rad)*math.Cos(b.Lat*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,74 @@
+// Package domain holds the kinds of error the store and service layers
+// return for outcomes a client can act on, so that handlers answer them the
+// same way everywhere through httpx.WriteError instead of each picking its
+// own status. Errors of no kind are genuine failures: 500s.
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// Error kinds. Match them with errors.Is.
+var (
+	// ErrNotFound means the thing asked for does not exist, or not for
+	// this user.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the request clashes with the current state, e.g.
+	// an order another request changed first.
+	ErrConflict = errors.New("conflict")
+	// ErrValidation means the request itself is invalid.
+	ErrValidation = errors.New("validation failed")
+	// ErrUnavailable means what was asked for cannot be had right now,
+	// e.g. an item that sold out.
+	ErrUnavailable = errors.New("unavailable")
+	// ErrQuotaExceeded means a limit was reached, e.g. a campus's orders
+	// for the day; it may lift after RetryAfter.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrForbidden means this user may not do this from here, e.g. order
+	// from off a campus that only takes orders on its network.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Error is an error of one kind with the message clients are shown.
+type Error struct {
+	Kind    error
+	Field   string // the request field at fault, for ErrValidation; optional
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Field != "" {
+		return e.Field + ": " + e.Message
+	}
+	return e.Message
+}
+
+// Is reports whether target is e's kind.
+func (e *Error) Is(target error) bool { return target == e.Kind }
+
+// NotFound returns an ErrNotFound error with message.
+func NotFound(message string) error { return &Error{Kind: ErrNotFound, Message: message} }
+
+// Conflict returns an ErrConflict error with message.
+func Conflict(message string) error { return &Error{Kind: ErrConflict, Message: message} }
+
+// Invalid returns an ErrValidation error for field, which may be "".
+func Invalid(field, message string) error {
+	return &Error{Kind: ErrValidation, Field: field, Message: message}
+}
+
+// Unavailable returns an ErrUnavailable error with message.
+func Unavailable(message string) error { return &Error{Kind: ErrUnavailable, Message: message} }
+
+// QuotaExceeded returns an ErrQuotaExceeded error with message.
+func QuotaExceeded(message string) error { return &Error{Kind: ErrQuotaExceeded, Message: message} }
+
+// Forbidden returns an ErrForbidden error with message.
+func Forbidden(message string) error { return &Error{Kind: ErrForbidden, Message: message} }
+
+// Retryable is implemented by errors that know when the request may
+// succeed, such as a full campus that reopens tomorrow.
+type Retryable interface {
+	RetryAfter() time.Duration
+}
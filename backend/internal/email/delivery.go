@@ -0,0 +1,186 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// ErrSuppressed is returned for sends to an address that has bounced or
+// complained.
+var ErrSuppressed = errors.New("recipient is suppressed after a bounce or complaint")
+
+// Delivery statuses stored in email_log.
+const (
+	StatusSent       = "SENT"
+	StatusFailed     = "FAILED"
+	StatusSuppressed = "SUPPRESSED"
+	StatusDelivered  = "DELIVERED"
+	StatusBounced    = "BOUNCED"
+	StatusComplained = "COMPLAINED"
+)
+
+// Delivery is one send attempt.
+type Delivery struct {
+	MessageID string
+	Kind      string // e.g. "order_confirmation"
+	Recipient string
+	Status    string
+	Error     string
+}
+
+// DeliveryLog records send attempts and knows which addresses to skip.
+type DeliveryLog interface {
+	Record(ctx context.Context, d Delivery) error
+	Suppressed(ctx context.Context, addr string) (bool, error)
+}
+
+// SQLDeliveryLog keeps the log in the email_log and email_suppressions tables.
+type SQLDeliveryLog struct {
+	DB *sql.DB
+}
+
+// Record implements DeliveryLog.
+func (l SQLDeliveryLog) Record(ctx context.Context, d Delivery) error {
+	_, err := l.DB.ExecContext(ctx,
+		`INSERT INTO email_log (message_id, kind, recipient, status, error) VALUES ($1, $2, $3, $4, $5)`,
+		d.MessageID, d.Kind, d.Recipient, d.Status, d.Error)
+	return err
+}
+
+// Suppressed implements DeliveryLog.
+func (l SQLDeliveryLog) Suppressed(ctx context.Context, addr string) (bool, error) {
+	var exists bool
+	err := l.DB.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM email_suppressions WHERE email = $1)`,
+		strings.ToLower(strings.TrimSpace(addr)),
+	).Scan(&exists)
+	return exists, err
+}
+
+// newMessageID returns a globally unique Message-ID in domain, which bounce
+// notifications quote back to us.
+func newMessageID(domain string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(b), time.Now().Unix(), domain)
+}
+
+// messageIDDomain is the DKIM signing domain, else the sender's. A sender
+// that is an SMTP username rather than an address falls back to jaj.local.
+func (c *Client) messageIDDomain() string {
+	if c.DKIM != nil {
+		return c.DKIM.Domain
+	}
+	if _, d, ok := strings.Cut(c.sender(), "@"); ok && d != "" {
+		return d
+	}
+	return "jaj.local"
+}
+
+// NewMessageID returns a Message-ID for a send whose delivery events the
+// caller wants to match up later; see Message.MessageID.
+func (c *Client) NewMessageID() string {
+	return newMessageID(c.messageIDDomain())
+}
+
+// checkSuppressed fails fast for suppressed recipients. Lookup errors are
+// ignored so a database outage does not stop mail.
+func (c *Client) checkSuppressed(to string) error {
+	if c.Log == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if suppressed, err := c.Log.Suppressed(ctx, to); err == nil && suppressed {
+		return ErrSuppressed
+	}
+	return nil
+}
+
+// DeliveryEvent is a delivery notification posted to the webhook, in the
+// provider-neutral shape our mail relay is configured to send.
+type DeliveryEvent struct {
+	Type      string `json:"type" validate:"required,oneof=delivered bounce complaint"`
+	Email     string `json:"email" validate:"required,max=254"`
+	MessageID string `json:"messageId" validate:"max=255"`
+	Permanent bool   `json:"permanent"` // hard bounce; soft bounces are only logged
+	Reason    string `json:"reason" validate:"max=1000"`
+}
+
+// ApplyDeliveryEvent updates the log entry for the event's message and
+// suppresses the address on a hard bounce or complaint.
+func ApplyDeliveryEvent(ctx context.Context, db *sql.DB, ev DeliveryEvent) error {
+	status, suppress := StatusDelivered, ""
+	switch ev.Type {
+	case "bounce":
+		status = StatusBounced
+		if ev.Permanent {
+			suppress = "BOUNCE"
+		}
+	case "complaint":
+		status, suppress = StatusComplained, "COMPLAINT"
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if ev.MessageID != "" {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE email_log SET status = $1, error = $2, updated_at = NOW() WHERE message_id = $3`,
+			status, ev.Reason, ev.MessageID); err != nil {
+			return err
+		}
+	}
+	if suppress != "" {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO email_suppressions (email, reason, detail) VALUES ($1, $2, $3)
+			 ON CONFLICT (email) DO NOTHING`,
+			strings.ToLower(strings.TrimSpace(ev.Email)), suppress, ev.Reason); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MakeWebhookHandler accepts delivery, bounce, and complaint notifications
+// from the mail relay. The relay authenticates with a shared secret in the
+// X-Webhook-Secret header.
+func MakeWebhookHandler(db *sql.DB, secret string, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Webhook-Secret")), []byte(secret)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var ev DeliveryEvent
+		if !httpx.DecodeJSON(w, r, &ev) {
+			return
+		}
+
+		if err := ApplyDeliveryEvent(r.Context(), db, ev); err != nil {
+			logger.Error("failed to apply email delivery event", zap.String("type", ev.Type), zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
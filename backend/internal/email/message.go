@@ -0,0 +1,131 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is one email to send. Text and HTML are both optional; when both
+// are set they go out as multipart/alternative so clients pick the best one.
+type Message struct {
+	To          string
+	Cc          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+	Headers     map[string]string // extra headers, e.g. "Reply-To"
+	MessageID   string            // optional; a fresh one is generated when empty
+}
+
+// Attachment is a file sent along with an email, e.g. a calendar invite.
+type Attachment struct {
+	Filename    string
+	ContentType string // e.g. "text/calendar; method=PUBLISH; charset=UTF-8"
+	Data        []byte
+}
+
+// recipients is every envelope recipient of the message.
+func (m *Message) recipients() []string {
+	return append([]string{m.To}, m.Cc...)
+}
+
+// bytes renders the message as RFC 5322 text. With attachments, the bodies
+// nest inside a multipart/mixed envelope.
+func (m *Message) bytes(from, msgID string) []byte {
+	var b bytes.Buffer
+
+	b.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	b.WriteString(fmt.Sprintf("To: %s\r\n", m.To))
+	if len(m.Cc) > 0 {
+		b.WriteString(fmt.Sprintf("Cc: %s\r\n", strings.Join(m.Cc, ", ")))
+	}
+	b.WriteString(fmt.Sprintf("Message-ID: %s\r\n", msgID))
+	b.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	b.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", m.Subject)))
+	// Sorted so the output is stable
+	keys := make([]string, 0, len(m.Headers))
+	for k := range m.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(fmt.Sprintf("%s: %s\r\n", k, m.Headers[k]))
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(m.Attachments) == 0 {
+		m.writeBody(&b)
+		return b.Bytes()
+	}
+
+	mixed := newBoundary()
+	b.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", mixed))
+	b.WriteString("\r\n")
+	b.WriteString(fmt.Sprintf("--%s\r\n", mixed))
+	m.writeBody(&b)
+	for _, a := range m.Attachments {
+		b.WriteString(fmt.Sprintf("--%s\r\n", mixed))
+		writeAttachment(&b, a)
+	}
+	b.WriteString(fmt.Sprintf("--%s--\r\n", mixed))
+	return b.Bytes()
+}
+
+// writeBody writes the Content-Type header and the text and/or HTML body.
+func (m *Message) writeBody(b *bytes.Buffer) {
+	if m.Text == "" || m.HTML == "" {
+		contentType, body := "text/plain", m.Text
+		if m.HTML != "" {
+			contentType, body = "text/html", m.HTML
+		}
+		writeTextPart(b, contentType, body)
+		return
+	}
+
+	boundary := newBoundary()
+	b.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
+	b.WriteString("\r\n")
+	b.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	writeTextPart(b, "text/plain", m.Text)
+	b.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+	writeTextPart(b, "text/html", m.HTML)
+	b.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+}
+
+func writeTextPart(b *bytes.Buffer, contentType, body string) {
+	b.WriteString(fmt.Sprintf("Content-Type: %s; charset=\"UTF-8\"\r\n", contentType))
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	b.WriteString("\r\n")
+}
+
+// writeAttachment writes a as a base64 MIME part, wrapped at 76 columns.
+func writeAttachment(b *bytes.Buffer, a Attachment) {
+	b.WriteString(fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", a.ContentType, a.Filename))
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", a.Filename))
+	b.WriteString("\r\n")
+
+	enc := base64.StdEncoding.EncodeToString(a.Data)
+	for len(enc) > 76 {
+		b.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	b.WriteString(enc + "\r\n")
+}
+
+// newBoundary returns a random MIME boundary; nested parts need distinct ones.
+func newBoundary() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "===" + hex.EncodeToString(b) + "==="
+}
@@ -0,0 +1,206 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+// Authenticated connections are kept for reuse so busy evenings don't pay a
+// TLS handshake and AUTH per message, and so we stay under Gmail's limit on
+// concurrent connections.
+const (
+	defaultPoolSize = 2
+	maxIdleTime     = 30 * time.Second
+	// Temporary (4xx) failures such as "421 too many connections" or
+	// "450 rate limited" are retried with doubling backoff.
+	sendAttempts = 3
+	retryBackoff = time.Second
+)
+
+type idleConn struct {
+	client *smtp.Client
+	since  time.Time
+}
+
+// session is the connection a send or batch currently holds, if any.
+type session struct {
+	client *smtp.Client
+}
+
+func (c *Client) slotsChan() chan struct{} {
+	c.slotsOnce.Do(func() {
+		n := c.PoolSize
+		if n <= 0 {
+			n = defaultPoolSize
+		}
+		c.slots = make(chan struct{}, n)
+	})
+	return c.slots
+}
+
+// conn waits for a free slot and returns a live connection, reusing an idle
+// one when the server still answers RSET.
+func (c *Client) conn() (*smtp.Client, error) {
+	slots := c.slotsChan()
+	slots <- struct{}{}
+	for {
+		c.poolMu.Lock()
+		if len(c.idle) == 0 {
+			c.poolMu.Unlock()
+			client, err := c.dial()
+			if err != nil {
+				<-slots
+				return nil, err
+			}
+			return client, nil
+		}
+		ic := c.idle[len(c.idle)-1]
+		c.idle = c.idle[:len(c.idle)-1]
+		c.poolMu.Unlock()
+
+		if time.Since(ic.since) < maxIdleTime && ic.client.Reset() == nil {
+			return ic.client, nil
+		}
+		ic.client.Close()
+	}
+}
+
+// release returns a connection to the pool, or closes it when the pool is
+// full or the connection may be in a bad state, and frees its slot.
+func (c *Client) release(client *smtp.Client, healthy bool) {
+	slots := c.slotsChan()
+	defer func() { <-slots }()
+	if healthy {
+		c.poolMu.Lock()
+		if len(c.idle) < cap(slots) {
+			c.idle = append(c.idle, idleConn{client: client, since: time.Now()})
+			c.poolMu.Unlock()
+			return
+		}
+		c.poolMu.Unlock()
+	}
+	quit(client)
+}
+
+// endSession returns the session's connection to the pool.
+func (c *Client) endSession(s *session) {
+	if s.client != nil {
+		c.release(s.client, true)
+		s.client = nil
+	}
+}
+
+// Close quits every idle connection. The client stays usable.
+func (c *Client) Close() {
+	c.poolMu.Lock()
+	idle := c.idle
+	c.idle = nil
+	c.poolMu.Unlock()
+	for _, ic := range idle {
+		quit(ic.client)
+	}
+}
+
+// quit ends the session politely; Gmail answers QUIT with 250 rather than
+// 221, which net/smtp reports as an error, so failures are ignored.
+func quit(client *smtp.Client) {
+	if err := client.Quit(); err != nil {
+		client.Close()
+	}
+}
+
+// transient reports whether the server asked us to try again later.
+func transient(err error) bool {
+	var te *textproto.Error
+	return errors.As(err, &te) && te.Code >= 400 && te.Code < 500
+}
+
+// send delivers msg on a pooled connection, recording the attempt under kind.
+func (c *Client) send(kind string, msg Message) error {
+	var s session
+	defer c.endSession(&s)
+	return c.sendOn(&s, kind, msg)
+}
+
+// SendBatch sends msgs one after another over the same connection. Each
+// message is recorded on its own; the returned error joins the failures.
+func (c *Client) SendBatch(kind string, msgs []Message) error {
+	var s session
+	defer c.endSession(&s)
+	var errs []error
+	for _, msg := range msgs {
+		if err := c.sendOn(&s, kind, msg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", msg.To, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sendOn delivers msg over the session's connection, dialing one if needed.
+// Suppressed recipients are refused before any connection is made.
+func (c *Client) sendOn(s *session, kind string, msg Message) (err error) {
+	from := c.sender()
+	msgID := msg.MessageID
+	if msgID == "" {
+		msgID = newMessageID(c.messageIDDomain())
+	}
+	defer c.record(kind, msg.To, msgID, time.Now(), &err)
+	if err := c.checkSuppressed(msg.To); err != nil {
+		return err
+	}
+	body := msg.bytes(from, msgID)
+	if c.DKIM != nil {
+		if body, err = c.DKIM.Sign(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		if s.client == nil {
+			if s.client, err = c.conn(); err != nil {
+				return err
+			}
+		}
+		err = transmit(s.client, from, msg.recipients(), body)
+		if err == nil {
+			return nil
+		}
+		// The connection may be mid-transaction or already dropped
+		c.release(s.client, false)
+		s.client = nil
+		if !transient(err) || attempt == sendAttempts {
+			return err
+		}
+		if c.Retries != nil {
+			c.Retries.WithLabelValues(kind).Inc()
+		}
+		time.Sleep(retryBackoff << (attempt - 1))
+	}
+}
+
+// transmit runs one MAIL/RCPT/DATA transaction.
+func transmit(client *smtp.Client, from string, to []string, body []byte) error {
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("mail from error: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("rcpt to error: %w", err)
+		}
+	}
+	wc, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data error: %w", err)
+	}
+	if _, err := wc.Write(body); err != nil {
+		wc.Close()
+		return fmt.Errorf("write error: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("data error: %w", err)
+	}
+	return nil
+}
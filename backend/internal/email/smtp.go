@@ -2,14 +2,21 @@ package email
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/smtp"
-	"net/textproto"
-	"strings"
+	"sync"
 	"text/template"
 	"time"
+
+	"server/internal/locale"
+	"server/templates"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
 )
 
 // Data structures for email templates
@@ -23,8 +30,100 @@ type ResetPasswordData struct {
 	ResetURL string
 }
 
-// New struct for order confirmation data:
+type ChangeEmailData struct {
+	Username   string
+	ConfirmURL string
+}
+
+type AccountExistsData struct {
+	Username string
+	ResetURL string
+}
+
+// LowStockAlertData lists items below their alert threshold for an admin.
+type LowStockAlertData struct {
+	Username string
+	Items    []LowStockItem
+}
+
+type LowStockItem struct {
+	Name        string
+	Stock       int
+	Unavailable bool // sold out and hidden from customers
+}
+
+// AlertData tells an admin an operational alert has fired or cleared.
+type AlertData struct {
+	Username  string
+	Summary   string // what the rule watches, e.g. "HTTP 5xx error rate"
+	Instance  string // the server that raised it
+	Value     string // e.g. "12.5%"
+	Threshold string
+	Since     string // when it fired, Kampala time
+	Resolved  bool
+}
+
+// WaitlistClaimData offers a waitlisted student a held order slot.
+type WaitlistClaimData struct {
+	Username  string
+	ClaimURL  string
+	ExpiresAt string // e.g. "14:30"
+	Items     []WaitlistItem
+}
+
+type WaitlistItem struct {
+	Name     string
+	Quantity int
+}
+
+// CutoffReminderData nudges a student with an unconfirmed chat draft before
+// the day's order cutoff.
+type CutoffReminderData struct {
+	Username   string
+	CutoffTime string // e.g. "17:00"
+	ChatURL    string // opens the draft in chat
+	Items      []WaitlistItem
+}
+
+// StatementData summarises a student's month with JAJ. Amounts are in
+// Locale's currency, and shown the way Locale writes them.
+type StatementData struct {
+	Locale        locale.Locale
+	Username      string
+	Month         string // e.g. "September 2026"
+	Orders        int
+	TotalSpent    int // including transport fees
+	TransportFees int
+	PromoSavings  int
+	WalletBalance int
+	// UnsubscribeURL turns statements off in one click (see
+	// Client.UnsubscribeURL); empty points to the profile instead.
+	UnsubscribeURL string
+}
+
+// SupportReplyData carries a staff reply on a support ticket to the student.
+type SupportReplyData struct {
+	Username string
+	TicketID int
+	Subject  string
+	Reply    string
+}
+
+// CampaignData is one recipient's copy of an announcement, already
+// personalised.
+type CampaignData struct {
+	Subject string
+	Body    string
+	OpenURL string // tracking pixel; empty leaves it out
+	// UnsubscribeURL turns announcements off in one click (see
+	// Client.UnsubscribeURL).
+	UnsubscribeURL string
+}
+
+// New struct for order confirmation data. Amounts and times are shown the
+// way the campus's Locale writes them.
 type OrderConfirmationData struct {
+	Locale   locale.Locale
 	Username string
 	OrderID  int
 	Items    []struct {
@@ -34,9 +133,20 @@ type OrderConfirmationData struct {
 		Subtotal  int
 	}
 	TransportFee  int
+	SmallOrderFee int // 0 unless below the campus minimum basket
 	TotalCost     int
-	PickupTime    string
+	TaxTotal      int    // VAT included in TotalCost
+	PickupTime    string // e.g. "Tue 24 Jun, 18:00 EAT"
 	PickupStation string
+	ETA           string // queue position and ready time, when known
+	// Unfulfilled are lines dropped after confirmation because the shop did
+	// not have them; when there are any the email is an amended receipt
+	Unfulfilled []struct {
+		Name     string
+		Quantity int
+		Subtotal int
+	}
+	Refund int // owed back on a paid order for the Unfulfilled lines
 }
 
 // New struct for cancellation:
@@ -45,476 +155,529 @@ type OrderCancellationData struct {
 	OrderID  int
 }
 
-// Load templates from files
+// Templates, parsed from the embedded templates directory
 var (
-	textTmpl             *template.Template
-	htmlTmpl             *template.Template
-	resetTextTmpl        *template.Template
-	resetHTMLTmpl        *template.Template
-	orderConfirmHTMLTmpl *template.Template
-	orderConfirmTextTmpl *template.Template
-	orderCancelHTMLTmpl  *template.Template
-	orderCancelTextTmpl  *template.Template
+	textTmpl              *template.Template
+	htmlTmpl              *template.Template
+	resetTextTmpl         *template.Template
+	resetHTMLTmpl         *template.Template
+	orderConfirmHTMLTmpl  *template.Template
+	orderConfirmTextTmpl  *template.Template
+	orderCancelHTMLTmpl   *template.Template
+	orderCancelTextTmpl   *template.Template
+	changeEmailTextTmpl   *template.Template
+	changeEmailHTMLTmpl   *template.Template
+	accountExistsTextTmpl *template.Template
+	accountExistsHTMLTmpl *template.Template
+	lowStockTextTmpl      *template.Template
+	alertTextTmpl         *template.Template
+	waitlistTextTmpl      *template.Template
+	waitlistHTMLTmpl      *template.Template
+	cutoffTextTmpl        *template.Template
+	cutoffHTMLTmpl        *template.Template
+	statementTextTmpl     *template.Template
+	statementHTMLTmpl     *template.Template
+	supportReplyTextTmpl  *template.Template
+	supportReplyHTMLTmpl  *template.Template
+	campaignTextTmpl      *template.Template
+	campaignHTMLTmpl      *template.Template
 )
 
 func init() {
 	var err error
 
 	// Load verification email templates
-	textTmpl, err = template.ParseFiles("templates/verify_email.txt")
+	textTmpl, err = template.ParseFS(templates.FS, "verify_email.txt")
 	if err != nil {
 		panic("Failed to load verify_email.txt template: " + err.Error())
 	}
 
-	htmlTmpl, err = template.ParseFiles("templates/verify_email.html")
+	htmlTmpl, err = template.ParseFS(templates.FS, "verify_email.html")
 	if err != nil {
 		panic("Failed to load verify_email.html template: " + err.Error())
 	}
 
 	// Load password reset templates
-	resetTextTmpl, err = template.ParseFiles("templates/reset_password.txt")
+	resetTextTmpl, err = template.ParseFS(templates.FS, "reset_password.txt")
 	if err != nil {
 		panic("Failed to load reset_password.txt template: " + err.Error())
 	}
 
-	resetHTMLTmpl, err = template.ParseFiles("templates/reset_password.html")
+	resetHTMLTmpl, err = template.ParseFS(templates.FS, "reset_password.html")
 	if err != nil {
 		panic("Failed to load reset_password.html template: " + err.Error())
 	}
 
-	orderConfirmTextTmpl, err = template.ParseFiles("templates/order_confirmation.txt")
+	orderConfirmTextTmpl, err = template.ParseFS(templates.FS, "order_confirmation.txt")
 	if err != nil {
 		panic("Failed to load order confirmation txt template: " + err.Error())
 	}
 
-	orderConfirmHTMLTmpl, err = template.ParseFiles("templates/order_confirmation.html")
+	orderConfirmHTMLTmpl, err = template.ParseFS(templates.FS, "order_confirmation.html")
 	if err != nil {
 		panic("Failed to load order confirmation html template: " + err.Error())
 	}
 
-	orderCancelTextTmpl, err = template.ParseFiles("templates/order_cancellation.txt")
+	orderCancelTextTmpl, err = template.ParseFS(templates.FS, "order_cancellation.txt")
 	if err != nil {
 		panic("Failed to load order cancellation txt template: " + err.Error())
 	}
 
-	orderCancelHTMLTmpl, err = template.ParseFiles("templates/order_cancellation.html")
+	orderCancelHTMLTmpl, err = template.ParseFS(templates.FS, "order_cancellation.html")
 	if err != nil {
 		panic("Failed to load order cancellation html template: " + err.Error())
 	}
-}
-
-// Client holds SMTP server details.
-type Client struct {
-	Host     string // e.g. "smtp.gmail.com:465"
-	Username string
-	Password string
-}
-
-func NewClient(host, user, pass string) *Client {
-	return &Client{Host: host, Username: user, Password: pass}
-}
-
-// SendVerificationEmail renders the templates and sends a multipart email.
-func (c *Client) SendVerificationEmail(toEmail, username, token string) error {
-	// 1. Build the verify link
-	baseURL := "http://localhost:8080" // your actual domain or read from env
-	verifyLink := fmt.Sprintf("%s/verify?token=%s", baseURL, token)
-
-	data := VerifyEmailData{
-		Username:  username,
-		VerifyURL: verifyLink,
-	}
 
-	// 2. Render the text and HTML bodies
-	var textBuf bytes.Buffer
-	if err := textTmpl.Execute(&textBuf, data); err != nil {
-		return fmt.Errorf("render text template: %w", err)
-	}
-	var htmlBuf bytes.Buffer
-	if err := htmlTmpl.Execute(&htmlBuf, data); err != nil {
-		return fmt.Errorf("render html template: %w", err)
-	}
-
-	// 3. Build the multipart/alternative MIME envelope
-	boundary := fmt.Sprintf("===%d===", time.Now().UnixNano())
-	var msg bytes.Buffer
-
-	// Basic headers
-	msg.WriteString(fmt.Sprintf("From: %s\r\n", c.Username))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", toEmail))
-	msg.WriteString("Subject: Verify Your JAJ Email\r\n")
-	msg.WriteString("MIME-Version: 1.0\r\n")
-	msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
-	msg.WriteString("\r\n") // end of headers
-
-	// -- Start plain‐text part
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-	msg.WriteString("Content-Transfer-Encoding: 7bit\r\n")
-	msg.WriteString("\r\n")
-	msg.Write(textBuf.Bytes())
-	msg.WriteString("\r\n")
-
-	// -- Start HTML part
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-	msg.WriteString("Content-Transfer-Encoding: 7bit\r\n")
-	msg.WriteString("\r\n")
-	msg.Write(htmlBuf.Bytes())
-	msg.WriteString("\r\n")
-
-	// -- Closing boundary
-	msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-
-	// 4. Send via SMTP (implicit TLS on port 465). Reuse your existing logic:
-	host, _, err := net.SplitHostPort(c.Host)
+	changeEmailTextTmpl, err = template.ParseFS(templates.FS, "change_email.txt")
 	if err != nil {
-		return fmt.Errorf("invalid SMTP host:port: %w", err)
+		panic("Failed to load change_email.txt template: " + err.Error())
 	}
 
-	tlsConfig := &tls.Config{ServerName: host}
-	conn, err := tls.Dial("tcp", c.Host, tlsConfig)
+	changeEmailHTMLTmpl, err = template.ParseFS(templates.FS, "change_email.html")
 	if err != nil {
-		return fmt.Errorf("tls.Dial: %w", err)
+		panic("Failed to load change_email.html template: " + err.Error())
 	}
-	defer conn.Close()
 
-	client, err := smtp.NewClient(conn, host)
+	accountExistsTextTmpl, err = template.ParseFS(templates.FS, "account_exists.txt")
 	if err != nil {
-		return fmt.Errorf("smtp.NewClient: %w", err)
+		panic("Failed to load account_exists.txt template: " + err.Error())
 	}
-	defer client.Close()
 
-	auth := smtp.PlainAuth("", c.Username, c.Password, host)
-	if err := client.Auth(auth); err != nil {
-		return fmt.Errorf("smtp.Auth: %w", err)
+	accountExistsHTMLTmpl, err = template.ParseFS(templates.FS, "account_exists.html")
+	if err != nil {
+		panic("Failed to load account_exists.html template: " + err.Error())
 	}
 
-	if err := client.Mail(c.Username); err != nil {
-		return fmt.Errorf("mail from error: %w", err)
+	lowStockTextTmpl, err = template.ParseFS(templates.FS, "low_stock_alert.txt")
+	if err != nil {
+		panic("Failed to load low_stock_alert.txt template: " + err.Error())
 	}
-	if err := client.Rcpt(toEmail); err != nil {
-		return fmt.Errorf("rcpt to error: %w", err)
+	alertTextTmpl, err = template.ParseFS(templates.FS, "alert.txt")
+	if err != nil {
+		panic("Failed to load alert.txt template: " + err.Error())
 	}
 
-	wc, err := client.Data()
+	waitlistTextTmpl, err = template.ParseFS(templates.FS, "waitlist_claim.txt")
 	if err != nil {
-		return fmt.Errorf("data error: %w", err)
-	}
-	if _, err := wc.Write(msg.Bytes()); err != nil {
-		wc.Close()
-		return fmt.Errorf("write error: %w", err)
+		panic("Failed to load waitlist_claim.txt template: " + err.Error())
 	}
-	wc.Close()
 
-	// Tolerate Gmail's 250 on QUIT
-	if err := client.Quit(); err != nil {
-		if textErr, ok := err.(*textproto.Error); ok && strings.HasPrefix(textErr.Error(), "250 ") {
-			return nil
-		}
-		return fmt.Errorf("quit error: %w", err)
+	waitlistHTMLTmpl, err = template.ParseFS(templates.FS, "waitlist_claim.html")
+	if err != nil {
+		panic("Failed to load waitlist_claim.html template: " + err.Error())
 	}
 
-	return nil
-}
-
-// SendResetPasswordEmail sends a multipart HTML+text reset email.
-func (c *Client) SendResetPasswordEmail(toEmail, username, token string) error {
-	// 1. Build the reset link (use your front-end domain)
-	baseURL := "http://localhost:8080"
-	resetLink := fmt.Sprintf("%s/password-reset?token=%s", baseURL, token)
-
-	data := ResetPasswordData{
-		Username: username,
-		ResetURL: resetLink,
-	}
-
-	// 2. Render the plain‐text and HTML bodies
-	var textBuf bytes.Buffer
-	if err := resetTextTmpl.Execute(&textBuf, data); err != nil {
-		return fmt.Errorf("render reset text template: %w", err)
-	}
-	var htmlBuf bytes.Buffer
-	if err := resetHTMLTmpl.Execute(&htmlBuf, data); err != nil {
-		return fmt.Errorf("render reset html template: %w", err)
-	}
-
-	// 3. Build MIME multipart/alternative message
-	boundary := fmt.Sprintf("===%d===", time.Now().UnixNano())
-	var msg bytes.Buffer
-
-	msg.WriteString(fmt.Sprintf("From: %s\r\n", c.Username))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", toEmail))
-	msg.WriteString("Subject: Reset Your JAJ Password\r\n")
-	msg.WriteString("MIME-Version: 1.0\r\n")
-	msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
-	msg.WriteString("\r\n")
-
-	// Plain‐text part
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-	msg.WriteString("Content-Transfer-Encoding: 7bit\r\n")
-	msg.WriteString("\r\n")
-	msg.Write(textBuf.Bytes())
-	msg.WriteString("\r\n")
-
-	// HTML part
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-	msg.WriteString("Content-Transfer-Encoding: 7bit\r\n")
-	msg.WriteString("\r\n")
-	msg.Write(htmlBuf.Bytes())
-	msg.WriteString("\r\n")
-
-	// Closing boundary
-	msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-
-	// 4. Send via SMTPS (port 465)
-	host, _, err := net.SplitHostPort(c.Host)
+	cutoffTextTmpl, err = template.ParseFS(templates.FS, "cutoff_reminder.txt")
 	if err != nil {
-		return fmt.Errorf("invalid SMTP host:port: %w", err)
+		panic("Failed to load cutoff_reminder.txt template: " + err.Error())
 	}
 
-	tlsConfig := &tls.Config{ServerName: host}
-	conn, err := tls.Dial("tcp", c.Host, tlsConfig)
+	cutoffHTMLTmpl, err = template.ParseFS(templates.FS, "cutoff_reminder.html")
 	if err != nil {
-		return fmt.Errorf("tls.Dial: %w", err)
+		panic("Failed to load cutoff_reminder.html template: " + err.Error())
 	}
-	defer conn.Close()
 
-	client, err := smtp.NewClient(conn, host)
+	statementTextTmpl, err = template.ParseFS(templates.FS, "monthly_statement.txt")
 	if err != nil {
-		return fmt.Errorf("smtp.NewClient: %w", err)
+		panic("Failed to load monthly_statement.txt template: " + err.Error())
 	}
-	defer client.Close()
 
-	auth := smtp.PlainAuth("", c.Username, c.Password, host)
-	if err := client.Auth(auth); err != nil {
-		return fmt.Errorf("smtp.Auth: %w", err)
+	statementHTMLTmpl, err = template.ParseFS(templates.FS, "monthly_statement.html")
+	if err != nil {
+		panic("Failed to load monthly_statement.html template: " + err.Error())
 	}
 
-	if err := client.Mail(c.Username); err != nil {
-		return fmt.Errorf("mail from error: %w", err)
+	supportReplyTextTmpl, err = template.ParseFS(templates.FS, "support_reply.txt")
+	if err != nil {
+		panic("Failed to load support_reply.txt template: " + err.Error())
 	}
-	if err := client.Rcpt(toEmail); err != nil {
-		return fmt.Errorf("rcpt to error: %w", err)
+
+	supportReplyHTMLTmpl, err = template.ParseFS(templates.FS, "support_reply.html")
+	if err != nil {
+		panic("Failed to load support_reply.html template: " + err.Error())
 	}
 
-	wc, err := client.Data()
+	campaignTextTmpl, err = template.ParseFS(templates.FS, "campaign.txt")
 	if err != nil {
-		return fmt.Errorf("data error: %w", err)
+		panic("Failed to load campaign.txt template: " + err.Error())
 	}
-	if _, err := wc.Write(msg.Bytes()); err != nil {
-		wc.Close()
-		return fmt.Errorf("qrite error: %w", err)
+
+	campaignHTMLTmpl, err = template.ParseFS(templates.FS, "campaign.html")
+	if err != nil {
+		panic("Failed to load campaign.html template: " + err.Error())
 	}
-	wc.Close()
+}
+
+// Client holds SMTP server details.
+type Client struct {
+	Host string // e.g. "smtp.gmail.com:465"
+	// Plaintext disables implicit TLS and authentication. Only meant for
+	// local capture servers such as MailHog.
+	Plaintext bool
+	// PoolSize caps concurrent SMTP connections; as many are kept idle for
+	// reuse. Defaults to 2.
+	PoolSize int
+
+	// Metrics, when set, counts sends by kind and result (sent, failed, or
+	// suppressed).
+	Metrics *prometheus.CounterVec
+	// Latency, when set, times each send, retries included, by kind and
+	// result; Retries counts transient failures tried again, by kind.
+	Latency *prometheus.HistogramVec
+	Retries *prometheus.CounterVec
+	// Log, when set, records every attempt and blocks suppressed recipients.
+	Log    DeliveryLog
+	Logger *zap.Logger
+	// Unsubscribe, when set, signs the unsubscribe links and List-Unsubscribe
+	// headers in statements and announcements.
+	Unsubscribe *Unsubscriber
+	// DKIM, when set, signs every message; Message-IDs then use its domain.
+	DKIM *DKIMSigner
+	// BaseURL is where the server is reached, for verification and password
+	// reset links; FrontendURL is the web app. Both default to
+	// http://localhost:8080.
+	BaseURL     string
+	FrontendURL string
+
+	mu       sync.RWMutex
+	username string
+	password string
+
+	poolMu    sync.Mutex
+	idle      []idleConn
+	slotsOnce sync.Once
+	slots     chan struct{}
+}
 
-	if err := client.Quit(); err != nil {
-		if smtpErr, ok := err.(*textproto.Error); ok && strings.HasPrefix(smtpErr.Error(), "250 ") {
-			return nil
+func NewClient(host, user, pass string) *Client {
+	return &Client{Host: host, username: user, password: pass}
+}
+
+// SetCredentials swaps in rotated SMTP credentials; sends already in
+// progress finish with the old ones. Idle connections authenticated with the
+// old credentials are dropped.
+func (c *Client) SetCredentials(user, pass string) {
+	c.mu.Lock()
+	c.username, c.password = user, pass
+	c.mu.Unlock()
+	c.Close()
+}
+
+func (c *Client) credentials() (string, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.username, c.password
+}
+
+// sender is the envelope and From address, which is the SMTP username.
+func (c *Client) sender() string {
+	user, _ := c.credentials()
+	return user
+}
+
+// record counts a send attempt begun at start and writes it to the delivery
+// log.
+func (c *Client) record(kind, to, msgID string, start time.Time, err *error) {
+	status, result := StatusSent, "sent"
+	errText := ""
+	switch {
+	case errors.Is(*err, ErrSuppressed):
+		status, result = StatusSuppressed, "suppressed"
+	case *err != nil:
+		status, result = StatusFailed, "failed"
+		errText = (*err).Error()
+	}
+	if c.Metrics != nil {
+		c.Metrics.WithLabelValues(kind, result).Inc()
+	}
+	if c.Latency != nil {
+		c.Latency.WithLabelValues(kind, result).Observe(time.Since(start).Seconds())
+	}
+	if c.Log != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		d := Delivery{MessageID: msgID, Kind: kind, Recipient: to, Status: status, Error: errText}
+		if logErr := c.Log.Record(ctx, d); logErr != nil && c.Logger != nil {
+			c.Logger.Warn("failed to record email delivery", zap.String("kind", kind), zap.Error(logErr))
 		}
-		return fmt.Errorf("quit error: %w", err)
 	}
-
-	return nil
 }
 
-// SendOrderConfirmationEmail sends a multipart HTML+text confirmation email.
-func (c *Client) SendOrderConfirmationEmail(
-	toEmail string,
-	data OrderConfirmationData,
-) error {
-	// 1. Render the text body
-	var textBuf bytes.Buffer
-	if err := orderConfirmTextTmpl.Execute(&textBuf, data); err != nil {
-		return fmt.Errorf("render order‐confirm text template: %w", err)
-	}
-	// 2. Render the HTML body
-	var htmlBuf bytes.Buffer
-	if err := orderConfirmHTMLTmpl.Execute(&htmlBuf, data); err != nil {
-		return fmt.Errorf("render order‐confirm HTML template: %w", err)
-	}
-
-	// 3. Build the multipart MIME message
-	boundary := fmt.Sprintf("===%d===", time.Now().UnixNano())
-	var msg bytes.Buffer
-
-	// Headers
-	msg.WriteString(fmt.Sprintf("From: %s\r\n", c.Username))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", toEmail))
-	msg.WriteString(fmt.Sprintf("Subject: JAJ Order Confirmation #%d\r\n", data.OrderID))
-	msg.WriteString("MIME-Version: 1.0\r\n")
-	msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
-	msg.WriteString("\r\n") // end of headers
-
-	// Plain‐text part
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-	msg.WriteString("Content-Transfer-Encoding: 7bit\r\n")
-	msg.WriteString("\r\n")
-	msg.Write(textBuf.Bytes())
-	msg.WriteString("\r\n")
-
-	// HTML part
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-	msg.WriteString("Content-Transfer-Encoding: 7bit\r\n")
-	msg.WriteString("\r\n")
-	msg.Write(htmlBuf.Bytes())
-	msg.WriteString("\r\n")
-
-	// Closing boundary
-	msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-
-	// 4. Send via SMTPS (port 465)
+// dial connects and authenticates to the SMTP server (implicit TLS on 465).
+func (c *Client) dial() (*smtp.Client, error) {
 	host, _, err := net.SplitHostPort(c.Host)
 	if err != nil {
-		return fmt.Errorf("invalid SMTP host:port: %w", err)
+		return nil, fmt.Errorf("invalid SMTP host:port: %w", err)
 	}
+
+	if c.Plaintext {
+		client, err := smtp.Dial(c.Host)
+		if err != nil {
+			return nil, fmt.Errorf("smtp.Dial: %w", err)
+		}
+		return client, nil
+	}
+
 	tlsConfig := &tls.Config{ServerName: host}
 	conn, err := tls.Dial("tcp", c.Host, tlsConfig)
 	if err != nil {
-		return fmt.Errorf("tls.Dial: %w", err)
+		return nil, fmt.Errorf("tls.Dial: %w", err)
 	}
-	defer conn.Close()
 
 	client, err := smtp.NewClient(conn, host)
 	if err != nil {
-		return fmt.Errorf("smtp.NewClient: %w", err)
+		conn.Close()
+		return nil, fmt.Errorf("smtp.NewClient: %w", err)
 	}
-	defer client.Close()
 
-	// Authenticate
-	auth := smtp.PlainAuth("", c.Username, c.Password, host)
+	user, pass := c.credentials()
+	auth := smtp.PlainAuth("", user, pass, host)
 	if err := client.Auth(auth); err != nil {
-		return fmt.Errorf("smtp.Auth: %w", err)
+		client.Close()
+		return nil, fmt.Errorf("smtp.Auth: %w", err)
 	}
+	return client, nil
+}
 
-	// MAIL FROM
-	if err := client.Mail(c.Username); err != nil {
-		return fmt.Errorf("mail from error: %w", err)
+// render executes a text and an HTML template with the same data.
+func render(textT, htmlT *template.Template, data interface{}) (string, string, error) {
+	var text, html bytes.Buffer
+	if err := textT.Execute(&text, data); err != nil {
+		return "", "", fmt.Errorf("render text template: %w", err)
 	}
-	// RCPT TO
-	if err := client.Rcpt(toEmail); err != nil {
-		return fmt.Errorf("rcpt to error: %w", err)
+	if err := htmlT.Execute(&html, data); err != nil {
+		return "", "", fmt.Errorf("render html template: %w", err)
 	}
+	return text.String(), html.String(), nil
+}
 
-	// DATA
-	wc, err := client.Data()
-	if err != nil {
-		return fmt.Errorf("data error: %w", err)
-	}
-	if _, err := wc.Write(msg.Bytes()); err != nil {
-		wc.Close()
-		return fmt.Errorf("write error: %w", err)
+// orLocalhost returns url, or the local development server if it is unset.
+func orLocalhost(url string) string {
+	if url == "" {
+		return "http://localhost:8080"
 	}
-	wc.Close()
+	return url
+}
 
-	// QUIT (ignore 250 from Gmail on QUIT)
-	if err := client.Quit(); err != nil {
-		if smtpErr, ok := err.(*textproto.Error); ok && strings.HasPrefix(smtpErr.Error(), "250 ") {
-			return nil
-		}
-		return fmt.Errorf("quit error: %w", err)
+// SendVerificationEmail renders the templates and sends a multipart email.
+func (c *Client) SendVerificationEmail(toEmail, username, token string) error {
+	data := VerifyEmailData{
+		Username:  username,
+		VerifyURL: fmt.Sprintf("%s/verify?token=%s", orLocalhost(c.BaseURL), token),
 	}
 
-	return nil
+	text, html, err := render(textTmpl, htmlTmpl, data)
+	if err != nil {
+		return err
+	}
+	return c.send("verification", Message{
+		To:      toEmail,
+		Subject: "Verify Your JAJ Email",
+		Text:    text,
+		HTML:    html,
+	})
 }
 
-// SendOrderCancellationEmail sends a multipart HTML+text cancellation email.
-func (c *Client) SendOrderCancellationEmail(
-	toEmail string,
-	data OrderCancellationData,
-) error {
-	// 1. Render plain-text
-	var textBuf bytes.Buffer
-	if err := orderCancelTextTmpl.Execute(&textBuf, data); err != nil {
-		return fmt.Errorf("render cancellation text template: %w", err)
-	}
-	// 2. Render HTML
-	var htmlBuf bytes.Buffer
-	if err := orderCancelHTMLTmpl.Execute(&htmlBuf, data); err != nil {
-		return fmt.Errorf("render cancellation HTML template: %w", err)
-	}
-
-	// 3. Build MIME multipart/alternative message
-	boundary := fmt.Sprintf("===%d===", time.Now().UnixNano())
-	var msg bytes.Buffer
-
-	// Headers
-	msg.WriteString(fmt.Sprintf("From: %s\r\n", c.Username))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", toEmail))
-	msg.WriteString(fmt.Sprintf("Subject: JAJ Order #%d Cancelled\r\n", data.OrderID))
-	msg.WriteString("MIME-Version: 1.0\r\n")
-	msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
-	msg.WriteString("\r\n") // end headers
-
-	// Plain-text part
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-	msg.WriteString("Content-Transfer-Encoding: 7bit\r\n")
-	msg.WriteString("\r\n")
-	msg.Write(textBuf.Bytes())
-	msg.WriteString("\r\n")
-
-	// HTML part
-	msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-	msg.WriteString("Content-Transfer-Encoding: 7bit\r\n")
-	msg.WriteString("\r\n")
-	msg.Write(htmlBuf.Bytes())
-	msg.WriteString("\r\n")
-
-	// Closing boundary
-	msg.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-
-	// 4. Send via SMTPS (port 465)
-	host, _, err := net.SplitHostPort(c.Host)
-	if err != nil {
-		return fmt.Errorf("invalid SMTP host:port: %w", err)
+// SendResetPasswordEmail sends a multipart HTML+text reset email.
+func (c *Client) SendResetPasswordEmail(toEmail, username, token string) error {
+	data := ResetPasswordData{
+		Username: username,
+		ResetURL: fmt.Sprintf("%s/password-reset?token=%s", orLocalhost(c.BaseURL), token),
 	}
-	tlsConfig := &tls.Config{ServerName: host}
-	conn, err := tls.Dial("tcp", c.Host, tlsConfig)
+
+	text, html, err := render(resetTextTmpl, resetHTMLTmpl, data)
 	if err != nil {
-		return fmt.Errorf("tls.Dial: %w", err)
+		return err
+	}
+	return c.send("password_reset", Message{
+		To:      toEmail,
+		Subject: "Reset Your JAJ Password",
+		Text:    text,
+		HTML:    html,
+	})
+}
+
+// SendAccountExistsEmail tells an existing user that someone tried to sign
+// up with their address, in place of an error that would reveal the account.
+func (c *Client) SendAccountExistsEmail(toEmail, username string) error {
+	data := AccountExistsData{
+		Username: username,
+		ResetURL: orLocalhost(c.FrontendURL) + "/password-reset-submit-email",
 	}
-	defer conn.Close()
 
-	client, err := smtp.NewClient(conn, host)
+	text, html, err := render(accountExistsTextTmpl, accountExistsHTMLTmpl, data)
 	if err != nil {
-		return fmt.Errorf("smtp.NewClient: %w", err)
-	}
-	defer client.Close()
+		return err
+	}
+	return c.send("account_exists", Message{
+		To:      toEmail,
+		Subject: "You Already Have a JAJ Account",
+		Text:    text,
+		HTML:    html,
+	})
+}
 
-	auth := smtp.PlainAuth("", c.Username, c.Password, host)
-	if err := client.Auth(auth); err != nil {
-		return fmt.Errorf("smtp.Auth: %w", err)
+// SendChangeEmailEmail asks the owner of a new address to confirm it before
+// the account switches over.
+func (c *Client) SendChangeEmailEmail(toEmail string, data ChangeEmailData) error {
+	text, html, err := render(changeEmailTextTmpl, changeEmailHTMLTmpl, data)
+	if err != nil {
+		return err
+	}
+	return c.send("email_change", Message{
+		To:      toEmail,
+		Subject: "Confirm Your New JAJ Email",
+		Text:    text,
+		HTML:    html,
+	})
+}
+
+// SendLowStockAlertEmail warns an admin about items that need restocking.
+// It is plain text since it only goes to staff.
+func (c *Client) SendLowStockAlertEmail(toEmail string, data LowStockAlertData) error {
+	var text bytes.Buffer
+	if err := lowStockTextTmpl.Execute(&text, data); err != nil {
+		return fmt.Errorf("render text template: %w", err)
 	}
+	return c.send("low_stock_alert", Message{
+		To:      toEmail,
+		Subject: fmt.Sprintf("JAJ Low Stock: %d item(s) need restocking", len(data.Items)),
+		Text:    text.String(),
+	})
+}
 
-	if err := client.Mail(c.Username); err != nil {
-		return fmt.Errorf("mail from error: %w", err)
+// SendAlertEmail tells an admin an alert has fired, or with data.Resolved,
+// cleared. Like the low stock alert it is plain text.
+func (c *Client) SendAlertEmail(toEmail string, data AlertData) error {
+	var text bytes.Buffer
+	if err := alertTextTmpl.Execute(&text, data); err != nil {
+		return fmt.Errorf("render text template: %w", err)
 	}
-	if err := client.Rcpt(toEmail); err != nil {
-		return fmt.Errorf("rcpt to error: %w", err)
+	subject := fmt.Sprintf("JAJ Alert: %s at %s", data.Summary, data.Value)
+	if data.Resolved {
+		subject = fmt.Sprintf("JAJ Resolved: %s", data.Summary)
 	}
+	return c.send("alert", Message{
+		To:      toEmail,
+		Subject: subject,
+		Text:    text.String(),
+	})
+}
 
-	wc, err := client.Data()
+// SendWaitlistClaimEmail tells a waitlisted student their order can go
+// through now and links to the prefilled order.
+func (c *Client) SendWaitlistClaimEmail(toEmail string, data WaitlistClaimData) error {
+	text, html, err := render(waitlistTextTmpl, waitlistHTMLTmpl, data)
 	if err != nil {
-		return fmt.Errorf("data error: %w", err)
-	}
-	if _, err := wc.Write(msg.Bytes()); err != nil {
-		wc.Close()
-		return fmt.Errorf("write error: %w", err)
-	}
-	wc.Close()
+		return err
+	}
+	return c.send("waitlist_claim", Message{
+		To:      toEmail,
+		Subject: "Your JAJ Order Can Go Through Now",
+		Text:    text,
+		HTML:    html,
+	})
+}
 
-	// QUIT (ignore Gmail’s 250 OK on QUIT)
-	if err := client.Quit(); err != nil {
-		if smtpErr, ok := err.(*textproto.Error); ok && strings.HasPrefix(smtpErr.Error(), "250 ") {
-			return nil
-		}
-		return fmt.Errorf("quit error: %w", err)
-	}
-	return nil
+// SendCutoffReminderEmail reminds a student to confirm their chat draft
+// before the order cutoff.
+func (c *Client) SendCutoffReminderEmail(toEmail string, data CutoffReminderData) error {
+	text, html, err := render(cutoffTextTmpl, cutoffHTMLTmpl, data)
+	if err != nil {
+		return err
+	}
+	return c.send("cutoff_reminder", Message{
+		To:      toEmail,
+		Subject: "Your JAJ Order Isn't Placed Yet",
+		Text:    text,
+		HTML:    html,
+	})
+}
+
+// SendStatementEmail sends a student their monthly statement.
+func (c *Client) SendStatementEmail(toEmail string, data StatementData) error {
+	text, html, err := render(statementTextTmpl, statementHTMLTmpl, data)
+	if err != nil {
+		return err
+	}
+	return c.send("monthly_statement", Message{
+		To:      toEmail,
+		Subject: "Your JAJ Statement for " + data.Month,
+		Text:    text,
+		HTML:    html,
+		Headers: unsubscribeHeaders(data.UnsubscribeURL),
+	})
+}
+
+// SendSupportReplyEmail tells a student staff have answered their support
+// ticket, quoting the reply.
+func (c *Client) SendSupportReplyEmail(toEmail string, data SupportReplyData) error {
+	text, html, err := render(supportReplyTextTmpl, supportReplyHTMLTmpl, data)
+	if err != nil {
+		return err
+	}
+	return c.send("support_reply", Message{
+		To:      toEmail,
+		Subject: fmt.Sprintf("Re: %s [JAJ ticket #%d]", data.Subject, data.TicketID),
+		Text:    text,
+		HTML:    html,
+	})
+}
+
+// SendCampaignEmail sends one recipient's copy of an announcement under
+// msgID (from NewMessageID), so bounces can be traced back to it.
+func (c *Client) SendCampaignEmail(toEmail, msgID string, data CampaignData) error {
+	text, html, err := render(campaignTextTmpl, campaignHTMLTmpl, data)
+	if err != nil {
+		return err
+	}
+	return c.send("campaign", Message{
+		To:        toEmail,
+		Subject:   data.Subject,
+		Text:      text,
+		HTML:      html,
+		Headers:   unsubscribeHeaders(data.UnsubscribeURL),
+		MessageID: msgID,
+	})
+}
+
+// SendOrderConfirmationEmail sends a multipart HTML+text confirmation email.
+// Attachments, if any, are added alongside the alternative bodies.
+func (c *Client) SendOrderConfirmationEmail(
+	toEmail string,
+	data OrderConfirmationData,
+	attachments ...Attachment,
+) error {
+	text, html, err := render(orderConfirmTextTmpl, orderConfirmHTMLTmpl, data)
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("JAJ Order Confirmation #%d", data.OrderID)
+	if len(data.Unfulfilled) > 0 {
+		subject = fmt.Sprintf("JAJ Order #%d Updated", data.OrderID)
+	}
+	return c.send("order_confirmation", Message{
+		To:          toEmail,
+		Subject:     subject,
+		Text:        text,
+		HTML:        html,
+		Attachments: attachments,
+	})
+}
+
+// SendOrderCancellationEmail sends a multipart HTML+text cancellation email.
+func (c *Client) SendOrderCancellationEmail(
+	toEmail string,
+	data OrderCancellationData,
+) error {
+	text, html, err := render(orderCancelTextTmpl, orderCancelHTMLTmpl, data)
+	if err != nil {
+		return err
+	}
+	return c.send("order_cancellation", Message{
+		To:      toEmail,
+		Subject: fmt.Sprintf("JAJ Order #%d Cancelled", data.OrderID),
+		Text:    text,
+		HTML:    html,
+	})
 }
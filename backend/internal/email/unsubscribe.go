@@ -0,0 +1,153 @@
+package email
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Lists a student can unsubscribe from. Transactional mail (verification,
+// receipts, password resets) is on no list and always goes out.
+const (
+	ListStatements    = "statements"
+	ListAnnouncements = "announcements"
+)
+
+// listColumns maps each list to its opt-in column on users.
+var listColumns = map[string]string{
+	ListStatements:    "monthly_statement",
+	ListAnnouncements: "announcements",
+}
+
+// listNames is how the confirmation page names each list.
+var listNames = map[string]string{
+	ListStatements:    "monthly statements",
+	ListAnnouncements: "announcements",
+}
+
+// ErrBadUnsubscribeToken means an unsubscribe token was malformed, forged,
+// or names an unknown list.
+var ErrBadUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// Unsubscriber signs and checks the per-user unsubscribe links put in
+// non-transactional emails. Tokens do not expire, since a link in an old
+// email must keep working; rotating Key invalidates them all.
+type Unsubscriber struct {
+	Key     []byte
+	BaseURL string // where GET /email/unsubscribe is served
+}
+
+func (u *Unsubscriber) sign(payload string) string {
+	mac := hmac.New(sha256.New, u.Key)
+	mac.Write([]byte("unsubscribe:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Token returns the token that unsubscribes userID from list.
+func (u *Unsubscriber) Token(userID int, list string) string {
+	payload := fmt.Sprintf("%d.%s", userID, list)
+	return payload + "." + u.sign(payload)
+}
+
+// URL returns the unsubscribe link for userID and list.
+func (u *Unsubscriber) URL(userID int, list string) string {
+	return strings.TrimRight(u.BaseURL, "/") + "/email/unsubscribe?token=" + url.QueryEscape(u.Token(userID, list))
+}
+
+// Verify returns the user and list a token unsubscribes.
+func (u *Unsubscriber) Verify(token string) (int, string, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return 0, "", ErrBadUnsubscribeToken
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(u.sign(payload))) {
+		return 0, "", ErrBadUnsubscribeToken
+	}
+	idText, list, ok := strings.Cut(payload, ".")
+	userID, err := strconv.Atoi(idText)
+	if !ok || err != nil || listColumns[list] == "" {
+		return 0, "", ErrBadUnsubscribeToken
+	}
+	return userID, list, nil
+}
+
+// UnsubscribeURL returns the link that takes userID off list, or "" when
+// the client has no Unsubscriber.
+func (c *Client) UnsubscribeURL(userID int, list string) string {
+	if c.Unsubscribe == nil {
+		return ""
+	}
+	return c.Unsubscribe.URL(userID, list)
+}
+
+// unsubscribeHeaders returns the List-Unsubscribe headers for link, which
+// let mail clients show their own unsubscribe button and, per RFC 8058,
+// unsubscribe with a single POST.
+func unsubscribeHeaders(link string) map[string]string {
+	if link == "" {
+		return nil
+	}
+	return map[string]string{
+		"List-Unsubscribe":      "<" + link + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// Unsubscribe turns off userID's opt-in for list. Unknown users are not an
+// error: the result, no more mail, is the same.
+func Unsubscribe(ctx context.Context, db *sql.DB, userID int, list string) error {
+	column, ok := listColumns[list]
+	if !ok {
+		return ErrBadUnsubscribeToken
+	}
+	_, err := db.ExecContext(ctx, `UPDATE users SET `+column+` = FALSE WHERE id = $1`, userID)
+	return err
+}
+
+// MakeUnsubscribeHandler serves /email/unsubscribe?token=..., the link in
+// the footer of statements and announcements. GET answers with a short
+// confirmation page; POST is the one-click unsubscribe mail clients send
+// and answers with no body. Either way it needs no login.
+func MakeUnsubscribeHandler(db *sql.DB, u *Unsubscriber, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		userID, list, err := u.Verify(r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "invalid or broken unsubscribe link", http.StatusBadRequest)
+			return
+		}
+		if err := Unsubscribe(r.Context(), db, userID, list); err != nil {
+			logger.Error("failed to unsubscribe", zap.Int("user_id", userID), zap.String("list", list), zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		logger.Info("user unsubscribed", zap.Int("user_id", userID), zap.String("list", list))
+
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en"><head><meta charset="UTF-8"><title>Unsubscribed - JAJ</title></head>
+<body style="font-family: system-ui, sans-serif; max-width: 480px; margin: 80px auto; padding: 0 20px; color: #0a0a0a;">
+<h1 style="font-size: 1.5rem;">You're unsubscribed</h1>
+<p>You will no longer get %s from JAJ. You can turn them back on any time in your profile.</p>
+</body></html>
+`, listNames[list])
+	}
+}
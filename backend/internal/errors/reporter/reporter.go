@@ -0,0 +1,142 @@
+// Package reporter sends unexpected errors and recovered panics to an external
+// error tracker (Sentry or Rollbar) and provides the HTTP recovery middleware.
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"server/internal/background"
+	"server/internal/httpx"
+	"server/internal/monitoring"
+
+	"go.uber.org/zap"
+)
+
+// Event is one error occurrence.
+type Event struct {
+	Message   string
+	Stack     string
+	RequestID string
+	UserID    int    // 0 when unauthenticated
+	ClientIP  string // "" when unknown
+	Method    string
+	Path      string
+	Tags      map[string]string
+	Time      time.Time
+}
+
+// Reporter delivers events to an error tracker.
+type Reporter interface {
+	Report(ctx context.Context, ev Event) error
+}
+
+// Nop discards events; it is used when no tracker is configured.
+type Nop struct{}
+
+// Report implements Reporter.
+func (Nop) Report(context.Context, Event) error { return nil }
+
+// FromEnv selects a reporter from ERROR_REPORTER ("sentry", "rollbar", or
+// unset for none), reading SENTRY_DSN or ROLLBAR_ACCESS_TOKEN respectively.
+func FromEnv(environment string) (Reporter, error) {
+	switch name := os.Getenv("ERROR_REPORTER"); name {
+	case "", "none":
+		return Nop{}, nil
+	case "sentry":
+		return NewSentry(os.Getenv("SENTRY_DSN"), environment)
+	case "rollbar":
+		token := os.Getenv("ROLLBAR_ACCESS_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("ROLLBAR_ACCESS_TOKEN is required when ERROR_REPORTER=rollbar")
+		}
+		return &Rollbar{Token: token, Environment: environment}, nil
+	default:
+		return nil, fmt.Errorf("unknown error reporter %q", name)
+	}
+}
+
+// scope carries per-request tags that inner middleware fills in after the
+// recovery middleware has already wrapped the request.
+type scope struct {
+	mu     sync.Mutex
+	userID int
+}
+
+type scopeKey struct{}
+
+// SetUser records the authenticated user on the request's reporting scope so
+// a later panic is tagged with it. It is a no-op outside Recover.
+func SetUser(ctx context.Context, userID int) {
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		s.mu.Lock()
+		s.userID = userID
+		s.mu.Unlock()
+	}
+}
+
+func userFrom(ctx context.Context) int {
+	s, ok := ctx.Value(scopeKey{}).(*scope)
+	if !ok {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userID
+}
+
+// Recover returns middleware that turns a handler panic into a 500 response,
+// logs it with its stack, and reports it in the background. It should sit
+// inside httpx.RequestID and httpx.RealIP so events carry the request ID and
+// client address.
+func Recover(rep Reporter, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), scopeKey{}, &scope{})
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p) // deliberate abort; let net/http handle it quietly
+				}
+
+				ev := Event{
+					Message:   monitoring.Redact(fmt.Sprint(p)),
+					Stack:     string(debug.Stack()),
+					RequestID: httpx.RequestIDFrom(ctx),
+					UserID:    userFrom(ctx),
+					ClientIP:  httpx.ClientIP(ctx),
+					Method:    r.Method,
+					Path:      r.URL.Path,
+					Time:      time.Now(),
+				}
+				logger.Error("panic serving request",
+					zap.String("panic", ev.Message),
+					zap.String("request_id", ev.RequestID),
+					zap.Int("user_id", ev.UserID),
+					zap.String("client_ip", ev.ClientIP),
+					zap.String("method", ev.Method),
+					zap.String("path", ev.Path),
+					zap.String("stack", ev.Stack),
+				)
+				rctx, done := background.TaskTimeout(ctx, 10*time.Second)
+				go func() {
+					defer done()
+					if err := rep.Report(rctx, ev); err != nil {
+						logger.Warn("error report failed", zap.Error(err))
+					}
+				}()
+
+				http.Error(w, "internal error", http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
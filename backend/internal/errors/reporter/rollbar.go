@@ -0,0 +1,66 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const rollbarEndpoint = "https://api.rollbar.com/api/1/item/"
+
+// Rollbar reports events through Rollbar's item API.
+type Rollbar struct {
+	Token       string
+	Environment string
+	Client      *http.Client // defaults to a client with a 10s timeout
+}
+
+// Report implements Reporter.
+func (rb *Rollbar) Report(ctx context.Context, ev Event) error {
+	custom := map[string]string{"request_id": ev.RequestID, "stack": ev.Stack}
+	for k, v := range ev.Tags {
+		custom[k] = v
+	}
+	data := map[string]interface{}{
+		"environment": rb.Environment,
+		"level":       "error",
+		"timestamp":   ev.Time.Unix(),
+		"platform":    "go",
+		"language":    "go",
+		"body":        map[string]interface{}{"message": map[string]string{"body": ev.Message}},
+		"request":     map[string]string{"method": ev.Method, "url": ev.Path, "user_ip": ev.ClientIP},
+		"custom":      custom,
+	}
+	if ev.UserID != 0 {
+		data["person"] = map[string]string{"id": strconv.Itoa(ev.UserID)}
+	}
+	body, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rollbarEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Rollbar-Access-Token", rb.Token)
+
+	client := rb.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("rollbar responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentry reports events through Sentry's store endpoint.
+type Sentry struct {
+	Endpoint    string // https://host/api/<project>/store/
+	PublicKey   string
+	Environment string
+	Client      *http.Client
+}
+
+// NewSentry parses a DSN of the form https://<key>@<host>/<project>.
+func NewSentry(dsn, environment string) (*Sentry, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("SENTRY_DSN is required when ERROR_REPORTER=sentry")
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN")
+	}
+	project := strings.Trim(u.Path, "/")
+	if _, err := strconv.Atoi(project); err != nil {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: missing project id")
+	}
+	return &Sentry{
+		Endpoint:    fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project),
+		PublicKey:   u.User.Username(),
+		Environment: environment,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Report implements Reporter.
+func (s *Sentry) Report(ctx context.Context, ev Event) error {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	tags := map[string]string{"request_id": ev.RequestID}
+	for k, v := range ev.Tags {
+		tags[k] = v
+	}
+	payload := map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   ev.Time.UTC().Format(time.RFC3339),
+		"level":       "error",
+		"platform":    "go",
+		"logger":      "jaj-server",
+		"environment": s.Environment,
+		"message":     ev.Message,
+		"tags":        tags,
+		"request":     map[string]string{"method": ev.Method, "url": ev.Path},
+		"extra":       map[string]string{"stack": ev.Stack},
+	}
+	user := map[string]string{}
+	if ev.UserID != 0 {
+		user["id"] = strconv.Itoa(ev.UserID)
+	}
+	if ev.ClientIP != "" {
+		user["ip_address"] = ev.ClientIP
+	}
+	if len(user) > 0 {
+		payload["user"] = user
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+		"Sentry sentry_version=7, sentry_client=jaj-server/1.0, sentry_timestamp=%d, sentry_key=%s",
+		time.Now().Unix(), s.PublicKey))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sentry responded %s", resp.Status)
+	}
+	return nil
+}
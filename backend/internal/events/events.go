@@ -0,0 +1,65 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is a message published on a topic.
+type Event struct {
+	Topic       string          `json:"topic"`
+	Data        json.RawMessage `json:"data"`
+	PublishedAt time.Time       `json:"publishedAt"`
+}
+
+// Decode unmarshals the event payload into v.
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Handler processes one delivered event.
+type Handler func(Event)
+
+// Bus publishes events and fans them out to subscribers.
+//
+// Subscribing with an empty group delivers every event to the handler on every
+// server instance (use this for per-instance state such as WebSocket hubs).
+// Subscribers sharing a non-empty group split the events between them so each
+// event is handled once across the deployment (use this for side effects such
+// as sending email).
+type Bus interface {
+	Publish(ctx context.Context, topic string, data interface{}) error
+	Subscribe(topic, group string, h Handler) (unsubscribe func(), err error)
+	Close() error
+}
+
+// QueueDepther is implemented by buses that buffer events in process and can
+// report how many are waiting.
+type QueueDepther interface {
+	QueueDepths() map[string]int
+}
+
+// New returns the Bus for the configured backend: "memory" (the default),
+// "nats", or "redis". url is the broker address for the latter two.
+func New(backend, url string) (Bus, error) {
+	switch backend {
+	case "", "memory":
+		return NewMemoryBus(), nil
+	case "nats":
+		return NewNATSBus(url)
+	case "redis":
+		return NewRedisBus(url)
+	default:
+		return nil, fmt.Errorf("unknown event bus backend %q", backend)
+	}
+}
+
+func newEvent(topic string, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("marshal %s event: %w", topic, err)
+	}
+	return Event{Topic: topic, Data: raw, PublishedAt: time.Now()}, nil
+}
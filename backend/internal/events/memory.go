@@ -0,0 +1,164 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrDropped is returned by MemoryBus.Publish when a subscriber's buffer
+// stayed full and the event was not delivered to it.
+var ErrDropped = errors.New("event dropped")
+
+// maxPublishWait bounds how long Publish waits for room in a full buffer when
+// the context has no earlier deadline.
+const maxPublishWait = 2 * time.Second
+
+// MemoryBus is an in-process Bus. Each subscription gets its own goroutine
+// and buffer, so a slow handler only holds up publishers once its buffer is
+// full; Publish then waits for room until its context is done or
+// maxPublishWait passes, and drops the event for that subscriber.
+type MemoryBus struct {
+	// Dropped, when set, counts events dropped for full buffers by topic.
+	Dropped *prometheus.CounterVec
+
+	mu     sync.Mutex
+	topics map[string]map[string][]*memorySub // topic -> group -> subscribers
+	next   map[string]int                     // round-robin cursor per topic/group
+}
+
+type memorySub struct {
+	ch   chan Event
+	done chan struct{}
+}
+
+// NewMemoryBus creates an empty in-process bus.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		topics: make(map[string]map[string][]*memorySub),
+		next:   make(map[string]int),
+	}
+}
+
+// Publish delivers the event to every ungrouped subscriber and to one
+// subscriber of each group. It returns an error wrapping ErrDropped if any of
+// them missed the event.
+func (b *MemoryBus) Publish(ctx context.Context, topic string, data interface{}) error {
+	ev, err := newEvent(topic, data)
+	if err != nil {
+		return err
+	}
+
+	var targets []*memorySub
+	b.mu.Lock()
+	for group, subs := range b.topics[topic] {
+		if len(subs) == 0 {
+			continue
+		}
+		if group == "" {
+			targets = append(targets, subs...)
+			continue
+		}
+		key := topic + "/" + group
+		targets = append(targets, subs[b.next[key]%len(subs)])
+		b.next[key]++
+	}
+	b.mu.Unlock()
+
+	// Wait outside the lock, so a handler draining its buffer can publish.
+	var cancel context.CancelFunc
+	dropped := 0
+	for _, s := range targets {
+		select {
+		case s.ch <- ev:
+			continue
+		default:
+		}
+		if cancel == nil {
+			ctx, cancel = context.WithTimeout(ctx, maxPublishWait)
+			defer cancel()
+		}
+		select {
+		case s.ch <- ev:
+		case <-s.done: // unsubscribed meanwhile
+		case <-ctx.Done():
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		return nil
+	}
+	if b.Dropped != nil {
+		b.Dropped.WithLabelValues(topic).Add(float64(dropped))
+	}
+	return fmt.Errorf("%w: %d of %d subscribers of %s have full buffers", ErrDropped, dropped, len(targets), topic)
+}
+
+// Subscribe registers h for topic.
+func (b *MemoryBus) Subscribe(topic, group string, h Handler) (func(), error) {
+	s := &memorySub{ch: make(chan Event, 256), done: make(chan struct{})}
+
+	b.mu.Lock()
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[string][]*memorySub)
+	}
+	b.topics[topic][group] = append(b.topics[topic][group], s)
+	b.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case ev := <-s.ch:
+				h(ev)
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			subs := b.topics[topic][group]
+			for i, other := range subs {
+				if other == s {
+					b.topics[topic][group] = append(subs[:i:i], subs[i+1:]...)
+					break
+				}
+			}
+			b.mu.Unlock()
+			close(s.done)
+		})
+	}, nil
+}
+
+// Close is a no-op; subscriptions end when they are unsubscribed.
+func (b *MemoryBus) Close() error {
+	return nil
+}
+
+// QueueDepths reports the events waiting in each subscription buffer, keyed
+// by topic and, for grouped subscribers, "topic/group".
+func (b *MemoryBus) QueueDepths() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	depths := make(map[string]int)
+	for topic, groups := range b.topics {
+		for group, subs := range groups {
+			key := topic
+			if group != "" {
+				key = topic + "/" + group
+			}
+			for _, s := range subs {
+				depths[key] += len(s.ch)
+			}
+		}
+	}
+	return depths
+}
@@ -0,0 +1,45 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMemoryBusFullBuffer(t *testing.T) {
+	b := NewMemoryBus()
+	b.Dropped = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dropped"}, []string{"topic"})
+
+	release := make(chan struct{})
+	unsubscribe, _ := b.Subscribe("t", "", func(Event) { <-release })
+	defer unsubscribe()
+	defer close(release)
+
+	// The handler holds the first event, so the buffer fills after 256 more.
+	for i := 0; i <= 256; i++ {
+		if err := b.Publish(context.Background(), "t", i); err != nil {
+			t.Fatalf("publish %d: %v", i, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Publish(ctx, "t", "late"); !errors.Is(err, ErrDropped) {
+		t.Errorf("Publish to a full buffer = %v, want ErrDropped", err)
+	}
+	if n := testutil.ToFloat64(b.Dropped.WithLabelValues("t")); n != 1 {
+		t.Errorf("dropped counter = %v, want 1", n)
+	}
+
+	// Once the handler catches up, a waiting publish gets through.
+	done := make(chan error)
+	go func() { done <- b.Publish(context.Background(), "t", "waited") }()
+	release <- struct{}{}
+	if err := <-done; err != nil {
+		t.Errorf("Publish while the buffer drains = %v, want nil", err)
+	}
+}
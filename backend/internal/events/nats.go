@@ -0,0 +1,69 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+const natsSubjectPrefix = "jaj."
+
+// NATSBus is a Bus backed by NATS core pub/sub. Groups map onto NATS queue
+// groups.
+type NATSBus struct {
+	conn *nats.Conn
+}
+
+// NewNATSBus connects to the NATS server at url.
+func NewNATSBus(url string) (*NATSBus, error) {
+	conn, err := nats.Connect(url, nats.Name("jaj-server"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("nats connect: %w", err)
+	}
+	return &NATSBus{conn: conn}, nil
+}
+
+// Publish sends the event to the topic's subject.
+func (b *NATSBus) Publish(_ context.Context, topic string, data interface{}) error {
+	ev, err := newEvent(topic, data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+	return b.conn.Publish(natsSubjectPrefix+topic, payload)
+}
+
+// Subscribe registers h for topic, joining the queue group when group is set.
+func (b *NATSBus) Subscribe(topic, group string, h Handler) (func(), error) {
+	cb := func(msg *nats.Msg) {
+		var ev Event
+		if err := json.Unmarshal(msg.Data, &ev); err != nil {
+			return
+		}
+		h(ev)
+	}
+
+	var (
+		sub *nats.Subscription
+		err error
+	)
+	if group == "" {
+		sub, err = b.conn.Subscribe(natsSubjectPrefix+topic, cb)
+	} else {
+		sub, err = b.conn.QueueSubscribe(natsSubjectPrefix+topic, group, cb)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("nats subscribe %s: %w", topic, err)
+	}
+	return func() { sub.Unsubscribe() }, nil
+}
+
+// Close drains in-flight messages and closes the connection.
+func (b *NATSBus) Close() error {
+	return b.conn.Drain()
+}
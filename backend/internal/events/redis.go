@@ -0,0 +1,145 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisStreamPrefix = "jaj:events:"
+	redisStreamMaxLen = 10000
+	redisBlock        = 5 * time.Second
+)
+
+// RedisBus is a Bus backed by Redis Streams, one stream per topic. Ungrouped
+// subscribers tail the stream with XREAD; grouped subscribers share a
+// consumer group and acknowledge what they handle.
+type RedisBus struct {
+	client   *redis.Client
+	consumer string
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewRedisBus connects to the Redis server at url (redis://host:port/db).
+func NewRedisBus(url string) (*RedisBus, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis ping: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RedisBus{
+		client:   client,
+		consumer: fmt.Sprintf("%s-%d", host, os.Getpid()),
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// Publish appends the event to the topic's stream, trimming old entries.
+func (b *RedisBus) Publish(ctx context.Context, topic string, data interface{}) error {
+	ev, err := newEvent(topic, data)
+	if err != nil {
+		return err
+	}
+	return b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: redisStreamPrefix + topic,
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"data":        string(ev.Data),
+			"publishedAt": ev.PublishedAt.Format(time.RFC3339Nano),
+		},
+	}).Err()
+}
+
+// Subscribe starts a reader goroutine for topic. Ungrouped readers start at
+// the end of the stream; grouped readers create the group if it is missing.
+func (b *RedisBus) Subscribe(topic, group string, h Handler) (func(), error) {
+	stream := redisStreamPrefix + topic
+	ctx, cancel := context.WithCancel(b.ctx)
+
+	if group != "" {
+		err := b.client.XGroupCreateMkStream(ctx, stream, group, "$").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			cancel()
+			return nil, fmt.Errorf("redis create group %s: %w", group, err)
+		}
+	}
+
+	go func() {
+		lastID := "$"
+		for ctx.Err() == nil {
+			var (
+				res []redis.XStream
+				err error
+			)
+			if group == "" {
+				res, err = b.client.XRead(ctx, &redis.XReadArgs{
+					Streams: []string{stream, lastID},
+					Block:   redisBlock,
+				}).Result()
+			} else {
+				res, err = b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+					Group:    group,
+					Consumer: b.consumer,
+					Streams:  []string{stream, ">"},
+					Block:    redisBlock,
+				}).Result()
+			}
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				// Back off on connection errors; the client reconnects itself.
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+				}
+				continue
+			}
+
+			for _, s := range res {
+				for _, msg := range s.Messages {
+					lastID = msg.ID
+					h(redisEvent(topic, msg))
+					if group != "" {
+						b.client.XAck(ctx, stream, group, msg.ID)
+					}
+				}
+			}
+		}
+	}()
+
+	return cancel, nil
+}
+
+// Close stops all readers and closes the client.
+func (b *RedisBus) Close() error {
+	b.cancel()
+	return b.client.Close()
+}
+
+func redisEvent(topic string, msg redis.XMessage) Event {
+	ev := Event{Topic: topic}
+	if data, ok := msg.Values["data"].(string); ok {
+		ev.Data = []byte(data)
+	}
+	if at, ok := msg.Values["publishedAt"].(string); ok {
+		ev.PublishedAt, _ = time.Parse(time.RFC3339Nano, at)
+	}
+	return ev
+}
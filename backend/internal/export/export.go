@@ -0,0 +1,231 @@
+// Package export streams tables to the analytics warehouse as NDJSON or CSV.
+// Rows are read in (updated_at, id) order so a Cursor taken from the last
+// row exported resumes exactly where the previous page or run stopped.
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settle keeps rows updated in the last minute out of an export: a
+// transaction that started earlier can still commit with an older
+// updated_at, and would otherwise land behind the cursor and be skipped.
+const settle = time.Minute
+
+// Table is an exportable table. Its first two columns are always "id" and
+// "updatedAt", which make up the cursor.
+type Table struct {
+	Name    string
+	columns string // select list over alias t
+	from    string
+}
+
+// Tables are the tables open to export, by name. Users are anonymized: no
+// names, emails, phone numbers, or credentials leave the database.
+var Tables = map[string]Table{
+	"orders": {
+		Name: "orders",
+		columns: `t.id, t.updated_at AS "updatedAt", t.user_id AS "userId", t.status,
+		          t.payment_status AS "paymentStatus", t.campus, t.transport_fee AS "transportFee",
+		          t.total_cost AS "totalCost", t.tax_total AS "taxTotal",
+		          t.receipt_number AS "receiptNumber", t.created_at AS "createdAt"`,
+		from: "orders t",
+	},
+	"order_items": {
+		Name: "order_items",
+		columns: `t.id, t.updated_at AS "updatedAt", t.order_id AS "orderId", t.item_id AS "itemId",
+		          t.quantity, t.unit_price AS "unitPrice", t.tax_rate_bps AS "taxRateBps",
+		          t.tax_amount AS "taxAmount"`,
+		from: "order_items t",
+	},
+	"items": {
+		Name: "items",
+		columns: `t.id, t.updated_at AS "updatedAt", t.name, t.category, t.price_ugx AS "priceUGX",
+		          t.available, t.stock, t.created_at AS "createdAt"`,
+		from: "items t",
+	},
+	"users": {
+		Name: "users",
+		columns: `t.id, t.updated_at AS "updatedAt", t.campus, t.language, t.verified,
+		          t.is_admin AS "isAdmin", t.created_at AS "createdAt"`,
+		from: "users t",
+	},
+}
+
+// Cursor is the position after a row: its updated_at and id. The zero
+// Cursor is before every row.
+type Cursor struct {
+	UpdatedAt time.Time
+	ID        int
+}
+
+// String renders the cursor as "<RFC 3339 time>,<id>".
+func (c Cursor) String() string {
+	return c.UpdatedAt.UTC().Format(time.RFC3339Nano) + "," + strconv.Itoa(c.ID)
+}
+
+// ParseCursor parses a Cursor's String form.
+func ParseCursor(s string) (Cursor, error) {
+	ts, id, ok := strings.Cut(s, ",")
+	if !ok {
+		return Cursor{}, errors.New("cursor must be <time>,<id>")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("cursor time: %w", err)
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("cursor id: %w", err)
+	}
+	return Cursor{UpdatedAt: t, ID: n}, nil
+}
+
+// RowWriter encodes exported rows.
+type RowWriter interface {
+	Columns(names []string) error
+	Row(values []interface{}) error
+	Flush() error
+}
+
+// Queryer is satisfied by *sql.DB and *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Stream writes up to limit rows of t changed after c to w and returns the
+// cursor after the last row written and how many rows there were.
+func Stream(ctx context.Context, db Queryer, t Table, c Cursor, limit int, w RowWriter) (Cursor, int, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+t.columns+` FROM `+t.from+`
+		  WHERE (t.updated_at, t.id) > ($1, $2) AND t.updated_at < NOW() - $3::interval
+		  ORDER BY t.updated_at, t.id
+		  LIMIT $4`,
+		c.UpdatedAt, c.ID, fmt.Sprintf("%d seconds", int(settle.Seconds())), limit,
+	)
+	if err != nil {
+		return c, 0, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return c, 0, err
+	}
+	if err := w.Columns(names); err != nil {
+		return c, 0, err
+	}
+
+	values := make([]interface{}, len(names))
+	ptrs := make([]interface{}, len(names))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return c, n, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		id, _ := values[0].(int64)
+		updated, _ := values[1].(time.Time)
+		if err := w.Row(values); err != nil {
+			return c, n, err
+		}
+		c = Cursor{UpdatedAt: updated, ID: int(id)}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return c, n, err
+	}
+	return c, n, w.Flush()
+}
+
+// NDJSON writes one JSON object per line, keys in column order.
+type NDJSON struct {
+	w     io.Writer
+	names [][]byte
+	buf   []byte
+}
+
+// NewNDJSON returns an NDJSON RowWriter on w.
+func NewNDJSON(w io.Writer) *NDJSON { return &NDJSON{w: w} }
+
+// Columns implements RowWriter.
+func (j *NDJSON) Columns(names []string) error {
+	j.names = make([][]byte, len(names))
+	for i, n := range names {
+		j.names[i], _ = json.Marshal(n)
+	}
+	return nil
+}
+
+// Row implements RowWriter.
+func (j *NDJSON) Row(values []interface{}) error {
+	j.buf = append(j.buf[:0], '{')
+	for i, v := range values {
+		if i > 0 {
+			j.buf = append(j.buf, ',')
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		j.buf = append(append(append(j.buf, j.names[i]...), ':'), b...)
+	}
+	j.buf = append(j.buf, '}', '\n')
+	_, err := j.w.Write(j.buf)
+	return err
+}
+
+// Flush implements RowWriter.
+func (j *NDJSON) Flush() error { return nil }
+
+// CSV writes a header row and then one record per row.
+type CSV struct {
+	w      *csv.Writer
+	record []string
+}
+
+// NewCSV returns a CSV RowWriter on w.
+func NewCSV(w io.Writer) *CSV { return &CSV{w: csv.NewWriter(w)} }
+
+// Columns implements RowWriter.
+func (c *CSV) Columns(names []string) error {
+	c.record = make([]string, len(names))
+	return c.w.Write(names)
+}
+
+// Row implements RowWriter.
+func (c *CSV) Row(values []interface{}) error {
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			c.record[i] = ""
+		case time.Time:
+			c.record[i] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			c.record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(c.record)
+}
+
+// Flush implements RowWriter.
+func (c *CSV) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
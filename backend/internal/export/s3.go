@@ -0,0 +1,144 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3 uploads export files to a bucket with SigV4-signed PUTs, using the
+// standard AWS_* credential environment variables.
+type S3 struct {
+	Bucket       string
+	Prefix       string // key prefix, e.g. "jaj/"
+	Region       string
+	Endpoint     string // optional, for S3-compatible stores such as MinIO; path-style
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	client *http.Client
+}
+
+// NewS3FromEnv configures uploads from EXPORT_S3_BUCKET, EXPORT_S3_PREFIX,
+// EXPORT_S3_ENDPOINT, AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// and the optional AWS_SESSION_TOKEN. It returns nil when no bucket is set.
+func NewS3FromEnv() (*S3, error) {
+	s := &S3{
+		Bucket:       os.Getenv("EXPORT_S3_BUCKET"),
+		Prefix:       os.Getenv("EXPORT_S3_PREFIX"),
+		Region:       os.Getenv("AWS_REGION"),
+		Endpoint:     strings.TrimSuffix(os.Getenv("EXPORT_S3_ENDPOINT"), "/"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 5 * time.Minute},
+	}
+	if s.Bucket == "" {
+		return nil, nil
+	}
+	if s.Region == "" || s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("AWS_REGION, AWS_ACCESS_KEY_ID, and AWS_SECRET_ACCESS_KEY are required when EXPORT_S3_BUCKET is set")
+	}
+	return s, nil
+}
+
+// Put stores body under Prefix+key.
+func (s *S3) Put(ctx context.Context, key, contentType string, body []byte) error {
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", s.Bucket, s.Region)
+	path := "/" + escapeKey(s.Prefix+key)
+	base := "https://" + host
+	if s.Endpoint != "" {
+		u, err := url.Parse(s.Endpoint)
+		if err != nil {
+			return fmt.Errorf("s3 endpoint: %w", err)
+		}
+		host, base = u.Host, s.Endpoint
+		path = "/" + s.Bucket + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, host, path, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("s3: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("s3: status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// escapeKey URI-encodes an object key as SigV4 expects, keeping slashes and
+// unreserved characters.
+func escapeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// sign adds an AWS Signature Version 4 Authorization header.
+func (s *S3) sign(req *http.Request, host, path string, payload []byte, now time.Time) {
+	const service = "s3"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(payload)
+	contentHash := hex.EncodeToString(payloadHash[:])
+
+	req.Header.Set("Host", host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", contentHash)
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n",
+		req.Header.Get("Content-Type"), host, contentHash, amzDate)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + s.SessionToken + "\n"
+	}
+
+	canonicalRequest := fmt.Sprintf("PUT\n%s\n\n%s\n%s\n%s", path, canonicalHeaders, signedHeaders, contentHash)
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, s.Region, service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", amzDate, scope, hex.EncodeToString(requestHash[:]))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,223 @@
+// Package fieldcrypt encrypts designated columns, such as users.phone, at
+// rest with AES-256-GCM. Writes pass the plaintext wrapped in Sealed, reads
+// scan through Opened, and the column holds "enc:<key id>:<base64>". Values
+// written before encryption was enabled are returned as they are until
+// Reseal rewrites them.
+//
+// Keys come from the secrets provider as FIELD_ENCRYPTION_KEYS, a comma-
+// separated list of id:base64 32-byte keys. The first encrypts; all of them
+// decrypt, so a key is rotated by putting a new one first, running
+// `jaj-server reseal`, then dropping the old one. Encrypted values cannot be
+// compared in SQL, so a column that must stay unique also stores Index, an
+// HMAC under FIELD_INDEX_KEY, which is never rotated.
+//
+// The keyring is process-wide, like the schema it protects: main sets it
+// with Use before serving.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// prefix marks an encrypted value; phone numbers and addresses never start
+// with it.
+const prefix = "enc:"
+
+// ErrUnknownKey is returned when a value was encrypted under a key the
+// keyring no longer has.
+var ErrUnknownKey = errors.New("fieldcrypt: value encrypted under an unknown key")
+
+// Keyring holds the encryption keys by id and the index key.
+type Keyring struct {
+	current  string
+	aeads    map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// NewKeyring parses keys ("id:base64,id:base64", current first) and the
+// base64 index key.
+func NewKeyring(keys, indexKey string) (*Keyring, error) {
+	k := &Keyring{aeads: map[string]cipher.AEAD{}}
+	for _, part := range strings.Split(keys, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(part, ":")
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("fieldcrypt: key %q is not id:base64", part)
+		}
+		if _, dup := k.aeads[id]; dup {
+			return nil, fmt.Errorf("fieldcrypt: key id %q appears twice", id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("fieldcrypt: key %q must be 32 bytes of base64", id)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+		if k.current == "" {
+			k.current = id
+		}
+	}
+	if k.current == "" {
+		return nil, errors.New("fieldcrypt: no keys")
+	}
+	raw, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil || len(raw) < 32 {
+		return nil, errors.New("fieldcrypt: index key must be at least 32 bytes of base64")
+	}
+	k.indexKey = raw
+	return k, nil
+}
+
+// GenerateKey returns a random key in the form FIELD_ENCRYPTION_KEYS and
+// FIELD_INDEX_KEY take.
+func GenerateKey() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// Encrypt seals plaintext under the current key.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + k.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value from Encrypt. Anything without the encrypted prefix
+// predates encryption and is returned unchanged.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	id, encoded, ok := cutEncrypted(value)
+	if !ok {
+		return value, nil
+	}
+	if k == nil {
+		return "", ErrUnknownKey
+	}
+	aead, found := k.aeads[id]
+	if !found {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("fieldcrypt: malformed value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("fieldcrypt: decrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Current reports whether value is encrypted under the current key, i.e.
+// needs no resealing.
+func (k *Keyring) Current(value string) bool {
+	id, _, ok := cutEncrypted(value)
+	return ok && id == k.current
+}
+
+// Index is a keyed hash of plaintext for equality lookups and unique
+// constraints on an encrypted column.
+func (k *Keyring) Index(plaintext string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(plaintext))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func cutEncrypted(value string) (id, encoded string, ok bool) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
+
+var keyring atomic.Pointer[Keyring]
+
+// Use makes k the keyring for Sealed, Opened, and Index. Until it is called,
+// or with nil, values are written in plain text and indexed unkeyed.
+func Use(k *Keyring) { keyring.Store(k) }
+
+// Sealed is a designated column's value on its way into the database: it
+// is encrypted by the driver, and empty is stored as NULL.
+type Sealed string
+
+// Value implements driver.Valuer.
+func (s Sealed) Value() (driver.Value, error) {
+	if s == "" {
+		return nil, nil
+	}
+	k := keyring.Load()
+	if k == nil {
+		return string(s), nil
+	}
+	return k.Encrypt(string(s))
+}
+
+// Index returns plaintext's lookup hash for an index column, or NULL for
+// empty.
+func Index(plaintext string) sql.NullString {
+	if plaintext == "" {
+		return sql.NullString{}
+	}
+	k := keyring.Load()
+	if k == nil {
+		sum := sha256.Sum256([]byte(plaintext))
+		return sql.NullString{String: hex.EncodeToString(sum[:]), Valid: true}
+	}
+	return sql.NullString{String: k.Index(plaintext), Valid: true}
+}
+
+// Opened scans a designated column into dst, decrypting it; NULL scans as
+// empty.
+func Opened(dst *string) sql.Scanner { return opener{dst} }
+
+type opener struct{ dst *string }
+
+func (o opener) Scan(src any) error {
+	var value string
+	switch v := src.(type) {
+	case nil:
+		*o.dst = ""
+		return nil
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("fieldcrypt: cannot scan %T", src)
+	}
+	plaintext, err := keyring.Load().Decrypt(value)
+	if err != nil {
+		return err
+	}
+	*o.dst = plaintext
+	return nil
+}
@@ -0,0 +1,99 @@
+package fieldcrypt
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Column is an encrypted column, keyed by its table's integer id, with the
+// column holding its Index if it has one.
+type Column struct {
+	Table  string
+	Column string
+	Index  string // optional
+}
+
+// Designated lists every encrypted column.
+var Designated = []Column{
+	{Table: "users", Column: "phone", Index: "phone_hash"},
+}
+
+// resealBatch is how many rows Reseal reads at a time.
+const resealBatch = 500
+
+// Reseal rewrites every value in col not yet encrypted under the current key,
+// and any stale index, and returns how many rows it changed. Rows changed
+// concurrently are left for the next run rather than overwritten.
+func Reseal(ctx context.Context, db *sql.DB, col Column) (int, error) {
+	k := keyring.Load()
+	if k == nil {
+		return 0, errors.New("fieldcrypt: no keyring")
+	}
+	indexExpr := "NULL"
+	update := fmt.Sprintf(`UPDATE %s SET %s = $1 WHERE id = $2 AND %s = $3`, col.Table, col.Column, col.Column)
+	if col.Index != "" {
+		indexExpr = col.Index
+		update = fmt.Sprintf(`UPDATE %s SET %s = $1, %s = $4 WHERE id = $2 AND %s = $3`,
+			col.Table, col.Column, col.Index, col.Column)
+	}
+	query := fmt.Sprintf(`SELECT id, %s, %s FROM %s WHERE %s IS NOT NULL AND id > $1 ORDER BY id LIMIT $2`,
+		col.Column, indexExpr, col.Table, col.Column)
+
+	changed, last := 0, 0
+	for {
+		type row struct {
+			id    int
+			value string
+			index sql.NullString
+		}
+		rows, err := db.QueryContext(ctx, query, last, resealBatch)
+		if err != nil {
+			return changed, err
+		}
+		var batch []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.value, &r.index); err != nil {
+				rows.Close()
+				return changed, err
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return changed, err
+		}
+		if len(batch) == 0 {
+			return changed, nil
+		}
+
+		for _, r := range batch {
+			last = r.id
+			plain, err := k.Decrypt(r.value)
+			if err != nil {
+				return changed, fmt.Errorf("%s.%s id %d: %w", col.Table, col.Column, r.id, err)
+			}
+			index := k.Index(plain)
+			if k.Current(r.value) && (col.Index == "" || r.index.String == index) {
+				continue
+			}
+			sealed, err := k.Encrypt(plain)
+			if err != nil {
+				return changed, err
+			}
+			args := []any{sealed, r.id, r.value}
+			if col.Index != "" {
+				args = append(args, index)
+			}
+			res, err := db.ExecContext(ctx, update, args...)
+			if err != nil {
+				return changed, fmt.Errorf("%s.%s id %d: %w", col.Table, col.Column, r.id, err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				changed++
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Package forecast predicts item demand from order history with a moving
+// average scaled by a day-of-week profile, which is enough to tell the
+// shopper what to buy ahead without any external modelling tools.
+package forecast
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Window sizes, in days. The level uses recent sales so trends show up
+// quickly; the weekday profile uses a longer span so one odd week does not
+// dominate it.
+const (
+	LevelDays   = 28
+	ProfileDays = 56
+)
+
+// Sale is the quantity of one item sold on one day.
+type Sale struct {
+	ItemID   int
+	Name     string
+	Date     time.Time // the local calendar day, as midnight UTC
+	Quantity int
+}
+
+// Day is the expected quantity of an item on one day.
+type Day struct {
+	Date     string  `json:"date"` // YYYY-MM-DD
+	Expected float64 `json:"expected"`
+}
+
+// Item is the forecast for one item over the whole horizon.
+type Item struct {
+	ItemID        int     `json:"itemId"`
+	Name          string  `json:"name"`
+	DailyAverage  float64 `json:"dailyAverage"` // over the last LevelDays
+	ExpectedTotal float64 `json:"expectedTotal"`
+	// SuggestedQuantity is ExpectedTotal rounded up: what to buy ahead.
+	SuggestedQuantity int   `json:"suggestedQuantity"`
+	Daily             []Day `json:"daily"`
+}
+
+// WeekdayProfile returns, per weekday, how busy that day is relative to an
+// average day across all items: 1.5 means half again as many units sell.
+// Sales must cover the ProfileDays days before today; with no sales every
+// factor is 1.
+func WeekdayProfile(sales []Sale, today time.Time) [7]float64 {
+	var perWeekday [7]float64
+	var daysPerWeekday [7]int
+	start := today.AddDate(0, 0, -ProfileDays)
+	for d := start; d.Before(today); d = d.AddDate(0, 0, 1) {
+		daysPerWeekday[d.Weekday()]++
+	}
+
+	total := 0.0
+	for _, s := range sales {
+		if s.Date.Before(start) || !s.Date.Before(today) {
+			continue
+		}
+		perWeekday[s.Date.Weekday()] += float64(s.Quantity)
+		total += float64(s.Quantity)
+	}
+
+	var profile [7]float64
+	for w := range profile {
+		profile[w] = 1
+		if total == 0 || daysPerWeekday[w] == 0 {
+			continue
+		}
+		profile[w] = (perWeekday[w] / float64(daysPerWeekday[w])) / (total / ProfileDays)
+	}
+	return profile
+}
+
+// Forecast predicts each item's demand for days days starting today, which
+// like Sale.Date is a calendar day at midnight UTC. Items with no sales in
+// the last LevelDays are left out, and the result is sorted by expected
+// total, highest first.
+func Forecast(sales []Sale, today time.Time, days int) []Item {
+	profile := WeekdayProfile(sales, today)
+
+	levelStart := today.AddDate(0, 0, -LevelDays)
+	sold := map[int]int{}
+	names := map[int]string{}
+	for _, s := range sales {
+		if s.Date.Before(levelStart) || !s.Date.Before(today) {
+			continue
+		}
+		sold[s.ItemID] += s.Quantity
+		names[s.ItemID] = s.Name
+	}
+
+	items := make([]Item, 0, len(sold))
+	for id, qty := range sold {
+		level := float64(qty) / LevelDays
+		it := Item{ItemID: id, Name: names[id], DailyAverage: round1(level)}
+		total := 0.0
+		for i := 0; i < days; i++ {
+			d := today.AddDate(0, 0, i)
+			expected := level * profile[d.Weekday()]
+			total += expected
+			it.Daily = append(it.Daily, Day{Date: d.Format("2006-01-02"), Expected: round1(expected)})
+		}
+		it.ExpectedTotal = round1(total)
+		it.SuggestedQuantity = int(math.Ceil(total))
+		items = append(items, it)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ExpectedTotal != items[j].ExpectedTotal {
+			return items[i].ExpectedTotal > items[j].ExpectedTotal
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+func round1(f float64) float64 {
+	return math.Round(f*10) / 10
+}
@@ -0,0 +1,109 @@
+package httpx
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIPFrom returns the client address found by RealIP, if any.
+func ClientIPFrom(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := ctx.Value(clientIPKey{}).(netip.Addr)
+	return addr, ok
+}
+
+// ClientIP returns the client address found by RealIP, e.g. "41.210.1.7",
+// or "" outside a request.
+func ClientIP(ctx context.Context) string {
+	if addr, ok := ClientIPFrom(ctx); ok {
+		return addr.String()
+	}
+	return ""
+}
+
+// RealIP returns middleware that finds the address each request came from,
+// for ClientIP. Behind a reverse proxy the peer is the proxy, so
+// X-Forwarded-For is believed only as far back as it was appended by proxies
+// in trusted, and X-Real-IP only when a trusted proxy sent it without
+// X-Forwarded-For; clients cannot claim any address they like.
+func RealIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, ok := clientIP(r, trusted)
+			if ok {
+				r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, addr))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP walks from the peer back through X-Forwarded-For until it finds
+// an address that is not a trusted proxy. A trusted peer that sent only
+// X-Real-IP (NGINX's proxy_set_header X-Real-IP $remote_addr) is taken at
+// its word.
+func clientIP(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		if isTrusted(addr, trusted) {
+			if real, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+				addr = real.Unmap()
+			}
+		}
+		return addr, true
+	}
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0 && isTrusted(addr, trusted); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+	}
+	return addr, true
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePrefixes parses CIDR ranges such as "10.0.0.0/8"; a bare address is
+// a range of one.
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
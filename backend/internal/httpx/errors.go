@@ -0,0 +1,76 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"server/internal/domain"
+)
+
+// errorKinds maps each domain error kind to its status and the code in the
+// response body.
+var errorKinds = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{domain.ErrNotFound, http.StatusNotFound, "not_found"},
+	{domain.ErrConflict, http.StatusConflict, "conflict"},
+	{domain.ErrUnavailable, http.StatusConflict, "unavailable"},
+	{domain.ErrQuotaExceeded, http.StatusTooManyRequests, "quota_exceeded"},
+	{domain.ErrForbidden, http.StatusForbidden, "forbidden"},
+}
+
+// ErrorResponse is the body WriteError answers with.
+type ErrorResponse struct {
+	Error   string `json:"error"`   // not_found, conflict, unavailable, quota_exceeded, forbidden, or internal_error
+	Message string `json:"message"` // for people
+}
+
+// WriteError answers err by its domain kind: 403 for ErrForbidden, 404 for
+// ErrNotFound, 409 for ErrConflict and ErrUnavailable, 422 for
+// ErrValidation (with the WriteValidationErrors body), and 429 for
+// ErrQuotaExceeded, with a Retry-After when err is domain.Retryable.
+// Anything else is a 500 whose text is not shown. It returns the status,
+// so callers log the 500s:
+//
+//	if httpx.WriteError(w, err) == http.StatusInternalServerError {
+//		logger.Error("...", zap.Error(err))
+//	}
+func WriteError(w http.ResponseWriter, err error) int {
+	if errors.Is(err, domain.ErrValidation) {
+		var fields ValidationErrors
+		var de *domain.Error
+		switch {
+		case errors.As(err, &fields):
+		case errors.As(err, &de):
+			fields = ValidationErrors{{Field: de.Field, Message: de.Message}}
+		default:
+			fields = ValidationErrors{{Message: err.Error()}}
+		}
+		WriteValidationErrors(w, fields)
+		return http.StatusUnprocessableEntity
+	}
+
+	status, body := http.StatusInternalServerError, ErrorResponse{"internal_error", "internal error"}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.kind) {
+			status, body = k.status, ErrorResponse{k.code, err.Error()}
+			var de *domain.Error
+			if errors.As(err, &de) {
+				body.Message = de.Message // without the context wrapped on the way up
+			}
+			break
+		}
+	}
+	var retry domain.Retryable
+	if status == http.StatusTooManyRequests && errors.As(err, &retry) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retry.RetryAfter().Seconds())+1))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+	return status
+}
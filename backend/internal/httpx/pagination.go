@@ -0,0 +1,74 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// Page holds the pagination parameters parsed from a request.
+type Page struct {
+	Page  int
+	Limit int
+}
+
+// Offset returns the SQL OFFSET for this page.
+func (p Page) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
+// ParsePage reads ?page= and ?limit= from the query string, falling back
+// to page 1 and 20 items when they are missing or out of range.
+func ParsePage(r *http.Request) Page {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+	return Page{Page: page, Limit: limit}
+}
+
+// Paginated is the response envelope shared by all list endpoints.
+type Paginated[T any] struct {
+	Data       []T `json:"data"`
+	Page       int `json:"page"`
+	Limit      int `json:"limit"`
+	TotalItems int `json:"totalItems"`
+	TotalPages int `json:"totalPages"`
+}
+
+// WriteTotalCount sets the X-Total-Count header. List handlers answer HEAD
+// requests with just this header so clients can size a list cheaply.
+func WriteTotalCount(w http.ResponseWriter, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+}
+
+// WritePage writes data wrapped in the Paginated envelope. A nil slice is
+// sent as an empty array rather than null.
+func WritePage[T any](w http.ResponseWriter, p Page, total int, data []T) {
+	if data == nil {
+		data = []T{}
+	}
+	totalPages := 0
+	if p.Limit > 0 {
+		totalPages = (total + p.Limit - 1) / p.Limit
+	}
+
+	WriteTotalCount(w, total)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Paginated[T]{
+		Data:       data,
+		Page:       p.Page,
+		Limit:      p.Limit,
+		TotalItems: total,
+		TotalPages: totalPages,
+	})
+}
@@ -0,0 +1,238 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"server/internal/domain"
+)
+
+// MaxBodyBytes caps request bodies read through LimitBody and DecodeJSON.
+const MaxBodyBytes = 1 << 20
+
+// FieldError describes one invalid field in a request payload.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is returned by Validate when any field fails its rules.
+type ValidationErrors []FieldError
+
+func (ve ValidationErrors) Error() string {
+	parts := make([]string, len(ve))
+	for i, fe := range ve {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Is makes ValidationErrors a domain.ErrValidation.
+func (ve ValidationErrors) Is(target error) bool { return target == domain.ErrValidation }
+
+// LimitBody returns middleware that caps every request body at maxBytes.
+// Reads past the limit fail and the connection is closed after the response.
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DecodeJSON reads a JSON body into dst and validates it. On failure it
+// writes the response itself (413 for oversized bodies, 400 for malformed
+// JSON, 422 with the field errors for invalid values) and returns false.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	defer r.Body.Close()
+	body := http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	if err := json.NewDecoder(body).Decode(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &tooLarge):
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			WriteValidationErrors(w, ValidationErrors{{Field: typeErr.Field, Message: "must be a " + typeErr.Type.String()}})
+		default:
+			http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+		}
+		return false
+	}
+	if err := Validate(dst); err != nil {
+		WriteValidationErrors(w, err)
+		return false
+	}
+	return true
+}
+
+// WriteValidationErrors answers 422 with the list of invalid fields.
+func WriteValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}{"validation failed", errs})
+}
+
+// Validate checks v against its `validate` struct tags and returns nil when
+// every field passes. Rules are comma-separated:
+//
+//	required      non-zero value (non-empty string, slice, or map)
+//	min=N, max=N  length for strings and slices, value for numbers
+//	email         a single RFC 5322 address
+//	oneof=A B C   one of the space-separated values
+//
+// Nested structs and slices of structs are checked too, with field paths
+// such as "items[2].quantity". Empty optional strings and slices skip the
+// other rules; numbers are always range-checked. Pointer fields, as used by
+// partial updates, skip the rules when nil and get all of them when set,
+// even to an empty value.
+func Validate(v interface{}) ValidationErrors {
+	var errs ValidationErrors
+	validateValue(reflect.ValueOf(v), "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateValue(v reflect.Value, path string, errs *ValidationErrors) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := jsonName(f)
+			if name == "-" {
+				continue
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			fv := v.Field(i)
+			if tag := f.Tag.Get("validate"); tag != "" {
+				if msg := checkRules(fv, tag); msg != "" {
+					*errs = append(*errs, FieldError{Field: name, Message: msg})
+					continue
+				}
+			}
+			validateValue(fv, name, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// checkRules returns the message for the first rule fv breaks, or "".
+func checkRules(fv reflect.Value, tag string) string {
+	rules := strings.Split(tag, ",")
+	set := false
+	if fv.Kind() == reflect.Pointer && !fv.IsNil() {
+		fv, set = fv.Elem(), true
+	}
+	if fv.IsZero() && !set {
+		for _, rule := range rules {
+			if rule == "required" {
+				return "is required"
+			}
+		}
+		if !fv.CanInt() {
+			return ""
+		}
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				panic("httpx: bad validate tag " + strconv.Quote(tag))
+			}
+			if msg := checkBound(fv, name, n); msg != "" {
+				return msg
+			}
+		case "email":
+			addr, err := mail.ParseAddress(fv.String())
+			if err != nil || addr.Address != fv.String() {
+				return "must be a valid email address"
+			}
+		case "oneof":
+			options := strings.Fields(arg)
+			if !contains(options, fmt.Sprint(fv.Interface())) {
+				return "must be one of " + strings.Join(options, ", ")
+			}
+		default:
+			panic("httpx: unknown validate rule " + strconv.Quote(name))
+		}
+	}
+	return ""
+}
+
+func checkBound(fv reflect.Value, rule string, n int) string {
+	var size int64
+	unit := ""
+	switch fv.Kind() {
+	case reflect.String:
+		size, unit = int64(len([]rune(fv.String()))), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, unit = int64(fv.Len()), " entries"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = fv.Int()
+	default:
+		return ""
+	}
+	switch {
+	case rule == "min" && size < int64(n):
+		if unit == "" {
+			return fmt.Sprintf("must be at least %d", n)
+		}
+		return fmt.Sprintf("must have at least %d%s", n, unit)
+	case rule == "max" && size > int64(n):
+		if unit == "" {
+			return fmt.Sprintf("must be at most %d", n)
+		}
+		return fmt.Sprintf("must have at most %d%s", n, unit)
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/internal/domain"
+)
+
+type versionKey struct{}
+
+// APIVersion returns the API version negotiated for the request, or 0 if the
+// request did not pass through a VersionRouter.
+func APIVersion(ctx context.Context) int {
+	v, _ := ctx.Value(versionKey{}).(int)
+	return v
+}
+
+// VersionRouter dispatches requests to a handler per API version.
+//
+// Prefixed paths (/v1/orders) go to that version with the prefix stripped.
+// Unprefixed legacy paths (/orders) go to the version requested through the
+// Accept-Version header or an "application/vnd.jaj.vN+json" Accept type,
+// falling back to the default version. Legacy responses carry a Deprecation
+// header so clients know to move to the prefixed routes.
+type VersionRouter struct {
+	versions   map[int]http.Handler
+	defaultVer int
+}
+
+// NewVersionRouter creates a router whose unprefixed paths resolve to defaultVer.
+func NewVersionRouter(defaultVer int) *VersionRouter {
+	return &VersionRouter{versions: make(map[int]http.Handler), defaultVer: defaultVer}
+}
+
+// Handle registers the handler that serves the given API version.
+func (vr *VersionRouter) Handle(version int, h http.Handler) {
+	vr.versions[version] = h
+}
+
+func (vr *VersionRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	version, rest, prefixed := splitVersionPrefix(r.URL.Path)
+	if !prefixed {
+		version = negotiateVersion(r, vr.defaultVer)
+		rest = r.URL.Path
+		w.Header().Set("Deprecation", "true")
+	}
+
+	h, ok := vr.versions[version]
+	if !ok {
+		WriteError(w, domain.NotFound("unsupported API version"))
+		return
+	}
+
+	w.Header().Set("API-Version", strconv.Itoa(version))
+	r2 := r.WithContext(context.WithValue(r.Context(), versionKey{}, version))
+	if prefixed {
+		u := *r.URL
+		u.Path = rest
+		u.RawPath = ""
+		r2.URL = &u
+	}
+	h.ServeHTTP(w, r2)
+}
+
+// splitVersionPrefix turns "/v1/orders" into (1, "/orders", true).
+func splitVersionPrefix(path string) (int, string, bool) {
+	if !strings.HasPrefix(path, "/v") {
+		return 0, path, false
+	}
+	seg, rest, _ := strings.Cut(path[2:], "/")
+	n, err := strconv.Atoi(seg)
+	if err != nil || n < 1 {
+		return 0, path, false
+	}
+	return n, "/" + rest, true
+}
+
+// negotiateVersion reads the requested version from headers.
+func negotiateVersion(r *http.Request, fallback int) int {
+	if v, err := strconv.Atoi(strings.TrimPrefix(r.Header.Get("Accept-Version"), "v")); err == nil && v > 0 {
+		return v
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if v, ok := strings.CutPrefix(mediaType, "application/vnd.jaj.v"); ok {
+			if n, err := strconv.Atoi(strings.TrimSuffix(v, "+json")); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return fallback
+}
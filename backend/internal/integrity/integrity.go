@@ -0,0 +1,227 @@
+// Package integrity audits referential integrity between orders,
+// order_items, items, users, and sessions. Databases created before a
+// foreign key existed, or restored from partial dumps, can hold rows that
+// point at nothing; Check reports them and Cleanup removes the ones that can
+// go without losing order history.
+package integrity
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sampleSize caps how many orphan ids a finding lists.
+const sampleSize = 20
+
+// check is one kind of orphan.
+type check struct {
+	name        string
+	description string
+	orphans     string // SELECT of the orphans' ids as text
+	// cleanup deletes the orphans, RETURNING their ids as text. Empty when
+	// the rows record money or history and must be repaired by hand.
+	cleanup string
+}
+
+var checks = []check{
+	{
+		name:        "order_items_without_order",
+		description: "order lines whose order no longer exists",
+		orphans:     `SELECT oi.id::text FROM order_items oi WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.id = oi.order_id) ORDER BY oi.id`,
+		cleanup:     `DELETE FROM order_items oi WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.id = oi.order_id) RETURNING oi.id::text`,
+	},
+	{
+		name:        "order_items_without_item",
+		description: "order lines whose catalog item was deleted; restore the item to repair",
+		orphans:     `SELECT oi.id::text FROM order_items oi WHERE NOT EXISTS (SELECT 1 FROM items i WHERE i.id = oi.item_id) ORDER BY oi.id`,
+	},
+	{
+		name:        "orders_without_user",
+		description: "orders with no owner or whose owner no longer exists",
+		orphans:     `SELECT o.id::text FROM orders o WHERE o.user_id IS NULL OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = o.user_id) ORDER BY o.id`,
+	},
+	{
+		name:        "order_status_history_without_order",
+		description: "status history of orders that no longer exist",
+		orphans:     `SELECT h.id::text FROM order_status_history h WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.id = h.order_id) ORDER BY h.id`,
+		cleanup:     `DELETE FROM order_status_history h WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.id = h.order_id) RETURNING h.id::text`,
+	},
+	{
+		name:        "sessions_without_user",
+		description: "sessions of users that no longer exist",
+		orphans:     `SELECT s.id::text FROM sessions s WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = s.user_id) ORDER BY s.created_at`,
+		cleanup:     `DELETE FROM sessions s WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = s.user_id) RETURNING s.id::text`,
+	},
+}
+
+// Delete rules as stored in pg_constraint.confdeltype. NO ACTION and RESTRICT
+// both refuse the delete, so they are reported alike.
+const (
+	Restrict = "RESTRICT"
+	Cascade  = "CASCADE"
+	SetNull  = "SET NULL"
+)
+
+// expectedKeys are the foreign keys the schema relies on to stop hard
+// deletes from leaving orphans.
+var expectedKeys = []ForeignKey{
+	{Table: "orders", Column: "user_id", References: "users", OnDelete: Restrict},
+	{Table: "order_items", Column: "order_id", References: "orders", OnDelete: Cascade},
+	{Table: "order_items", Column: "item_id", References: "items", OnDelete: Restrict},
+	{Table: "order_status_history", Column: "order_id", References: "orders", OnDelete: Cascade},
+	{Table: "sessions", Column: "user_id", References: "users", OnDelete: Cascade},
+	{Table: "orders_archive", Column: "user_id", References: "users", OnDelete: Restrict},
+	{Table: "order_items_archive", Column: "item_id", References: "items", OnDelete: Restrict},
+}
+
+// ForeignKey is an expected foreign key and what the database actually has.
+type ForeignKey struct {
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	References string `json:"references"`
+	OnDelete   string `json:"onDelete"`
+	Actual     string `json:"actual"` // delete rule found; empty when the key is missing
+	OK         bool   `json:"ok"`
+}
+
+// Finding is the orphans one check found.
+type Finding struct {
+	Check       string   `json:"check"`
+	Description string   `json:"description"`
+	Count       int      `json:"count"`
+	Sample      []string `json:"sample"` // first ids, at most 20
+	Cleanable   bool     `json:"cleanable"`
+}
+
+// Report is the result of Check.
+type Report struct {
+	CheckedAt   time.Time    `json:"checkedAt"`
+	ForeignKeys []ForeignKey `json:"foreignKeys"`
+	Findings    []Finding    `json:"findings"`
+	Healthy     bool         `json:"healthy"` // every key present and no orphans
+}
+
+// Check inspects the foreign keys and counts orphans.
+func Check(ctx context.Context, db *sql.DB) (Report, error) {
+	rep := Report{CheckedAt: time.Now(), Healthy: true}
+
+	for _, fk := range expectedKeys {
+		var rule sql.NullString
+		err := db.QueryRowContext(ctx,
+			`SELECT CASE c.confdeltype WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT' ELSE 'RESTRICT' END
+			   FROM pg_constraint c
+			   JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = ANY (c.conkey)
+			  WHERE c.contype = 'f'
+			    AND c.conrelid = $1::regclass AND c.confrelid = $2::regclass AND a.attname = $3
+			  LIMIT 1`,
+			fk.Table, fk.References, fk.Column,
+		).Scan(&rule)
+		if err != nil && err != sql.ErrNoRows {
+			return Report{}, err
+		}
+		fk.Actual = rule.String
+		fk.OK = fk.Actual == fk.OnDelete
+		rep.Healthy = rep.Healthy && fk.OK
+		rep.ForeignKeys = append(rep.ForeignKeys, fk)
+	}
+
+	for _, c := range checks {
+		f := Finding{Check: c.name, Description: c.description, Sample: []string{}, Cleanable: c.cleanup != ""}
+		rows, err := db.QueryContext(ctx, c.orphans)
+		if err != nil {
+			return Report{}, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return Report{}, err
+			}
+			if f.Count < sampleSize {
+				f.Sample = append(f.Sample, id)
+			}
+			f.Count++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return Report{}, err
+		}
+		rep.Healthy = rep.Healthy && f.Count == 0
+		rep.Findings = append(rep.Findings, f)
+	}
+	return rep, nil
+}
+
+// Removal is what Cleanup deleted, or would delete, for one check.
+type Removal struct {
+	Check string   `json:"check"`
+	IDs   []string `json:"ids"`
+}
+
+// Cleanup deletes the orphans that can go safely, in one transaction. With
+// dryRun it runs the same deletes and rolls back, so the ids returned are
+// exactly what a real run would remove. Orphans that carry order history are
+// never deleted.
+func Cleanup(ctx context.Context, db *sql.DB, dryRun bool) ([]Removal, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	removals := []Removal{}
+	for _, c := range checks {
+		if c.cleanup == "" {
+			continue
+		}
+		rows, err := tx.QueryContext(ctx, c.cleanup)
+		if err != nil {
+			return nil, err
+		}
+		rm := Removal{Check: c.name, IDs: []string{}}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			rm.IDs = append(rm.IDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		removals = append(removals, rm)
+	}
+
+	if dryRun {
+		return removals, nil
+	}
+	return removals, tx.Commit()
+}
+
+// LogReport runs Check and logs anything wrong, for startup. It never fails
+// the caller: a broken audit must not keep the server down.
+func LogReport(ctx context.Context, db *sql.DB, logger *zap.Logger) {
+	rep, err := Check(ctx, db)
+	if err != nil {
+		logger.Error("integrity check failed", zap.Error(err))
+		return
+	}
+	for _, fk := range rep.ForeignKeys {
+		if !fk.OK {
+			logger.Warn("foreign key missing or has an unexpected delete rule",
+				zap.String("table", fk.Table), zap.String("column", fk.Column),
+				zap.String("references", fk.References), zap.String("want", fk.OnDelete), zap.String("have", fk.Actual))
+		}
+	}
+	for _, f := range rep.Findings {
+		if f.Count > 0 {
+			logger.Warn("orphaned rows found", zap.String("check", f.Check), zap.Int("count", f.Count),
+				zap.Strings("sample", f.Sample), zap.Bool("cleanable", f.Cleanable))
+		}
+	}
+}
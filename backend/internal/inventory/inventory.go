@@ -0,0 +1,101 @@
+// Package inventory tracks item stock. Orders take stock when they are
+// confirmed and give it back when cancelled; items whose stock is NULL are
+// not tracked.
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"server/internal/domain"
+)
+
+// VelocityWindow is how many days of sales the days-of-stock estimate
+// averages over.
+const VelocityWindow = 14
+
+// OutOfStockError is returned by Reserve when an order wants more of an item
+// than is left.
+type OutOfStockError struct {
+	ItemID int
+	Name   string
+}
+
+func (e *OutOfStockError) Error() string {
+	return fmt.Sprintf("%s is out of stock", e.Name)
+}
+
+// Is makes a sold-out item a domain.ErrUnavailable.
+func (e *OutOfStockError) Is(target error) bool { return target == domain.ErrUnavailable }
+
+// Reserve takes the order's quantities out of stock inside tx. It fails with
+// *OutOfStockError, leaving the caller to roll back, if any tracked item
+// would go negative. Row locks on the items serialise concurrent orders.
+func Reserve(ctx context.Context, tx *sql.Tx, orderID int) error {
+	rows, err := tx.QueryContext(ctx,
+		`UPDATE items i SET stock = i.stock - q.qty
+		   FROM (SELECT item_id, SUM(quantity) AS qty FROM order_items WHERE order_id = $1 GROUP BY item_id) q
+		  WHERE i.id = q.item_id AND i.stock IS NOT NULL
+		 RETURNING i.id, i.name, i.stock`,
+		orderID,
+	)
+	if err != nil {
+		return err
+	}
+	var short *OutOfStockError
+	for rows.Next() {
+		var id, stock int
+		var name string
+		if err := rows.Scan(&id, &name, &stock); err != nil {
+			rows.Close()
+			return err
+		}
+		if stock < 0 && short == nil {
+			short = &OutOfStockError{ItemID: id, Name: name}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if short != nil {
+		return short
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE orders SET stock_reserved = TRUE WHERE id = $1`, orderID)
+	return err
+}
+
+// Release puts a cancelled order's quantities back into stock. Orders that
+// never reserved stock are left alone, so it is safe to call on any
+// cancellation.
+func Release(ctx context.Context, tx *sql.Tx, orderID int) error {
+	res, err := tx.ExecContext(ctx,
+		`UPDATE orders SET stock_reserved = FALSE WHERE id = $1 AND stock_reserved`, orderID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE items i SET stock = i.stock + q.qty
+		   FROM (SELECT item_id, SUM(quantity) AS qty FROM order_items WHERE order_id = $1 GROUP BY item_id) q
+		  WHERE i.id = q.item_id AND i.stock IS NOT NULL`,
+		orderID,
+	)
+	return err
+}
+
+// DaysOfStock estimates how long stock lasts at the rate of sold units over
+// the last VelocityWindow days. ok is false when nothing sold recently.
+func DaysOfStock(stock, sold int) (days float64, ok bool) {
+	if sold <= 0 {
+		return 0, false
+	}
+	if stock <= 0 {
+		return 0, true
+	}
+	return float64(stock) / (float64(sold) / VelocityWindow), true
+}
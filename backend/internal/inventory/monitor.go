@@ -0,0 +1,122 @@
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"server/internal/email"
+
+	"go.uber.org/zap"
+)
+
+// CheckStock marks sold-out tracked items unavailable, brings back the ones
+// it hid once they are restocked, and returns items that fell below their
+// threshold (defaultThreshold unless the item sets its own) since the last
+// alert. Returned items are marked alerted; the mark clears on restock.
+func CheckStock(ctx context.Context, db *sql.DB, defaultThreshold int) ([]email.LowStockItem, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Admins who switch an item off by hand keep it off: only items this
+	// check hid come back automatically.
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE items SET available = FALSE, auto_unavailable = TRUE
+		  WHERE stock IS NOT NULL AND stock <= 0 AND available`); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE items SET available = TRUE, auto_unavailable = FALSE
+		  WHERE auto_unavailable AND stock > 0`); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE items SET low_stock_alerted_at = NULL
+		  WHERE low_stock_alerted_at IS NOT NULL
+		    AND (stock IS NULL OR stock >= COALESCE(low_stock_threshold, $1))`,
+		defaultThreshold); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`UPDATE items SET low_stock_alerted_at = NOW()
+		  WHERE stock IS NOT NULL AND stock < COALESCE(low_stock_threshold, $1)
+		    AND low_stock_alerted_at IS NULL
+		 RETURNING name, stock, NOT available`,
+		defaultThreshold)
+	if err != nil {
+		return nil, err
+	}
+	var low []email.LowStockItem
+	for rows.Next() {
+		var it email.LowStockItem
+		if err := rows.Scan(&it.Name, &it.Stock, &it.Unavailable); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		low = append(low, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return low, tx.Commit()
+}
+
+// alertAdmins emails every admin the list of low items.
+func alertAdmins(ctx context.Context, db *sql.DB, mailer *email.Client, items []email.LowStockItem) error {
+	rows, err := db.QueryContext(ctx, `SELECT email, username FROM users WHERE is_admin`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type admin struct{ email, username string }
+	var admins []admin
+	for rows.Next() {
+		var a admin
+		if err := rows.Scan(&a.email, &a.username); err != nil {
+			return err
+		}
+		admins = append(admins, a)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, a := range admins {
+		if err := mailer.SendLowStockAlertEmail(a.email, email.LowStockAlertData{Username: a.username, Items: items}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunStockMonitor runs CheckStock every interval until ctx is done and
+// emails admins about newly low items.
+func RunStockMonitor(ctx context.Context, db *sql.DB, mailer *email.Client, logger *zap.Logger, threshold int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		low, err := CheckStock(ctx, db, threshold)
+		if err != nil {
+			logger.Error("stock check failed", zap.Error(err))
+			continue
+		}
+		if len(low) == 0 {
+			continue
+		}
+		logger.Warn("items running low on stock", zap.Int("items", len(low)))
+		if err := alertAdmins(ctx, db, mailer, low); err != nil {
+			logger.Error("failed to send low stock alert", zap.Error(err))
+		}
+	}
+}
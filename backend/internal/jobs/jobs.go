@@ -0,0 +1,401 @@
+// Package jobs runs slow work, such as building a demand forecast, off the
+// request path. Jobs are rows in Postgres, so they survive restarts and any
+// instance may run them; the instance that enqueues a job also wakes one of
+// its own idle workers straight away rather than leaving it to the next
+// poll.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"server/internal/monitoring"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Job statuses. A failed attempt goes back to QUEUED with a later run_at
+// until the job runs out of attempts.
+const (
+	StatusQueued    = "QUEUED"
+	StatusRunning   = "RUNNING"
+	StatusSucceeded = "SUCCEEDED"
+	StatusFailed    = "FAILED"
+)
+
+// Defaults for Kind fields left zero, how often idle workers look for work
+// queued by other instances, and how long finished jobs are kept.
+const (
+	defaultConcurrency = 1
+	defaultAttempts    = 3
+	defaultTimeout     = 5 * time.Minute
+	leaseSlack         = time.Minute
+	pollInterval       = 2 * time.Second
+	retention          = 7 * 24 * time.Hour
+)
+
+// ErrUnknownType means no Kind is registered for the job type.
+var ErrUnknownType = errors.New("unknown job type")
+
+// Func does one job. Its result is stored as JSON for whoever polls the job.
+type Func func(ctx context.Context, payload json.RawMessage) (interface{}, error)
+
+// Kind is a type of job and how to run it.
+type Kind struct {
+	Run Func
+	// Concurrency caps how many jobs of this type run at once across every
+	// instance, and is how many workers each instance starts for it.
+	Concurrency int
+	MaxAttempts int
+	// Timeout bounds each attempt. A worker that dies mid-job holds it for
+	// Timeout plus a minute before another may claim it.
+	Timeout time.Duration
+}
+
+// Job is a queued, running, or finished job.
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Status      string          `json:"status"`
+	Payload     json.RawMessage `json:"payload"`
+	Result      json.RawMessage `json:"result,omitempty"` // once SUCCEEDED
+	Error       string          `json:"error,omitempty"`  // the last failed attempt's
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	StartedAt   *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// Queue enqueues jobs and runs the registered kinds.
+type Queue struct {
+	db     *sql.DB
+	logger *zap.Logger
+
+	// Duration, when set, times each attempt by type and result (ok or
+	// error); Retries counts failed attempts put back for another try, and
+	// DeadLetters jobs that failed for good, both by type.
+	Duration    *prometheus.HistogramVec
+	Retries     *prometheus.CounterVec
+	DeadLetters *prometheus.CounterVec
+
+	mu    sync.Mutex
+	kinds map[string]Kind
+	wake  map[string]chan struct{}
+}
+
+// NewQueue returns a Queue with no kinds registered.
+func NewQueue(db *sql.DB, logger *zap.Logger) *Queue {
+	return &Queue{db: db, logger: logger, kinds: map[string]Kind{}, wake: map[string]chan struct{}{}}
+}
+
+// Register makes jobType runnable. Register every kind before Run.
+func (q *Queue) Register(jobType string, k Kind) {
+	if k.Concurrency <= 0 {
+		k.Concurrency = defaultConcurrency
+	}
+	if k.MaxAttempts <= 0 {
+		k.MaxAttempts = defaultAttempts
+	}
+	if k.Timeout <= 0 {
+		k.Timeout = defaultTimeout
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.kinds[jobType] = k
+	q.wake[jobType] = make(chan struct{}, 1)
+}
+
+func (q *Queue) kind(jobType string) (Kind, chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	k, ok := q.kinds[jobType]
+	return k, q.wake[jobType], ok
+}
+
+// Enqueue queues a job of jobType with payload encoded as JSON, on behalf of
+// createdBy (0 for the system), and returns its id.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}, createdBy int) (int64, error) {
+	k, wake, ok := q.kind(jobType)
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownType, jobType)
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encode payload: %w", err)
+	}
+
+	var id int64
+	if err := q.db.QueryRowContext(ctx,
+		`INSERT INTO jobs (type, payload, max_attempts, created_by) VALUES ($1, $2, $3, NULLIF($4, 0)) RETURNING id`,
+		jobType, raw, k.MaxAttempts, createdBy,
+	).Scan(&id); err != nil {
+		return 0, err
+	}
+	select {
+	case wake <- struct{}{}:
+	default: // a wake-up is already pending
+	}
+	return id, nil
+}
+
+// Run starts every registered kind's workers and prunes old finished jobs,
+// until ctx is done.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	q.mu.Lock()
+	for jobType, k := range q.kinds {
+		for i := 0; i < k.Concurrency; i++ {
+			wg.Add(1)
+			go func(jobType string, k Kind, wake chan struct{}) {
+				defer wg.Done()
+				q.work(ctx, jobType, k, wake)
+			}(jobType, k, q.wake[jobType])
+		}
+	}
+	q.mu.Unlock()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+		if _, err := q.db.ExecContext(ctx,
+			`DELETE FROM jobs WHERE finished_at < $1`, time.Now().Add(-retention),
+		); err != nil {
+			q.logger.Error("failed to prune finished jobs", zap.Error(err))
+		}
+	}
+}
+
+// work runs jobs of one type until there are none ready, then waits for a
+// local wake-up or the next poll.
+func (q *Queue) work(ctx context.Context, jobType string, k Kind, wake chan struct{}) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			ran, err := q.runOne(ctx, jobType, k)
+			if err != nil {
+				q.logger.Error("job worker failed", zap.String("type", jobType), zap.Error(err))
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOne claims and runs one job, reporting whether there was one.
+func (q *Queue) runOne(ctx context.Context, jobType string, k Kind) (bool, error) {
+	job, err := q.claim(ctx, jobType, k)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("claim job: %w", err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, k.Timeout)
+	start := time.Now()
+	result, runErr := call(runCtx, k.Run, job.Payload)
+	cancel()
+	if q.Duration != nil {
+		q.Duration.WithLabelValues(jobType, monitoring.Result(runErr)).Observe(time.Since(start).Seconds())
+	}
+	if runErr != nil {
+		q.logger.Warn("job attempt failed", zap.Int64("job_id", job.ID), zap.String("type", jobType),
+			zap.Int("attempt", job.Attempts), zap.Error(runErr))
+	}
+
+	// Record the outcome even when shutting down. A job cut short by
+	// shutdown goes back to the queue without using up an attempt.
+	stopping := ctx.Err() != nil
+	ctx = context.WithoutCancel(ctx)
+	if runErr != nil && stopping {
+		_, err := q.db.ExecContext(ctx,
+			`UPDATE jobs SET status = 'QUEUED', attempts = attempts - 1, lease_expires = NULL WHERE id = $1`, job.ID)
+		return true, err
+	}
+	return true, q.finish(ctx, job, result, runErr)
+}
+
+// call runs f, turning a panic into an error so one bad job cannot take
+// the worker down.
+func call(ctx context.Context, f Func, payload json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return f(ctx, payload)
+}
+
+// claim takes the next ready job of jobType, unless Concurrency of them are
+// already running. It returns sql.ErrNoRows when there is nothing to do.
+func (q *Queue) claim(ctx context.Context, jobType string, k Kind) (Job, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Job{}, err
+	}
+	defer tx.Rollback()
+
+	// Claims of one type take turns so the running count below holds
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('jobs:' || $1))`, jobType); err != nil {
+		return Job{}, err
+	}
+	// A dead worker's job with no attempts left has failed for good
+	res, err := tx.ExecContext(ctx,
+		`UPDATE jobs SET status = 'FAILED', error = 'worker stopped before the job finished',
+		        lease_expires = NULL, finished_at = NOW()
+		  WHERE type = $1 AND status = 'RUNNING' AND lease_expires <= NOW() AND attempts >= max_attempts`,
+		jobType,
+	)
+	if err != nil {
+		return Job{}, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		q.count(q.DeadLetters, jobType, n)
+	}
+	var running int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM jobs WHERE type = $1 AND status = 'RUNNING' AND lease_expires > NOW()`, jobType,
+	).Scan(&running); err != nil {
+		return Job{}, err
+	}
+	if running >= k.Concurrency {
+		return Job{}, errors.Join(sql.ErrNoRows, tx.Commit())
+	}
+
+	j := Job{Type: jobType, Status: StatusRunning}
+	var payload []byte
+	if err := tx.QueryRowContext(ctx,
+		`UPDATE jobs
+		    SET status = 'RUNNING', attempts = attempts + 1, started_at = NOW(),
+		        lease_expires = NOW() + make_interval(secs => $2)
+		  WHERE id = (SELECT id FROM jobs
+		               WHERE type = $1
+		                 AND (status = 'QUEUED' AND run_at <= NOW() OR status = 'RUNNING' AND lease_expires <= NOW())
+		               ORDER BY run_at, id
+		               LIMIT 1
+		               FOR UPDATE SKIP LOCKED)
+		  RETURNING id, payload, attempts, max_attempts`,
+		jobType, (k.Timeout+leaseSlack).Seconds(),
+	).Scan(&j.ID, &payload, &j.Attempts, &j.MaxAttempts); errors.Is(err, sql.ErrNoRows) {
+		return Job{}, errors.Join(err, tx.Commit())
+	} else if err != nil {
+		return Job{}, err
+	}
+	j.Payload = payload
+	return j, tx.Commit()
+}
+
+// finish stores a job's result, or schedules a retry with quadratic backoff
+// (30s, 2m, 4m30s, ...) until it runs out of attempts.
+func (q *Queue) finish(ctx context.Context, j Job, result interface{}, runErr error) error {
+	if runErr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			runErr = fmt.Errorf("encode result: %w", err)
+		} else {
+			_, err := q.db.ExecContext(ctx,
+				`UPDATE jobs SET status = 'SUCCEEDED', result = $2, error = '', lease_expires = NULL, finished_at = NOW()
+				  WHERE id = $1`,
+				j.ID, raw)
+			return err
+		}
+	}
+
+	if j.Attempts < j.MaxAttempts {
+		backoff := time.Duration(j.Attempts*j.Attempts) * 30 * time.Second
+		_, err := q.db.ExecContext(ctx,
+			`UPDATE jobs SET status = 'QUEUED', error = $2, run_at = $3, lease_expires = NULL WHERE id = $1`,
+			j.ID, runErr.Error(), time.Now().Add(backoff))
+		if err == nil {
+			q.count(q.Retries, j.Type, 1)
+		}
+		return err
+	}
+	_, err := q.db.ExecContext(ctx,
+		`UPDATE jobs SET status = 'FAILED', error = $2, lease_expires = NULL, finished_at = NOW() WHERE id = $1`,
+		j.ID, runErr.Error())
+	if err == nil {
+		q.count(q.DeadLetters, j.Type, 1)
+	}
+	return err
+}
+
+// count adds n to counter's jobType series, if counter is set.
+func (q *Queue) count(counter *prometheus.CounterVec, jobType string, n int64) {
+	if counter != nil {
+		counter.WithLabelValues(jobType).Add(float64(n))
+	}
+}
+
+const jobColumns = `id, type, status, payload, result, error, attempts, max_attempts, run_at, created_at, started_at, finished_at`
+
+func scanJob(row interface{ Scan(...interface{}) error }, j *Job) error {
+	var payload, result []byte
+	if err := row.Scan(&j.ID, &j.Type, &j.Status, &payload, &result, &j.Error, &j.Attempts, &j.MaxAttempts,
+		&j.RunAt, &j.CreatedAt, &j.StartedAt, &j.FinishedAt); err != nil {
+		return err
+	}
+	j.Payload = payload
+	if result != nil {
+		j.Result = result
+	}
+	return nil
+}
+
+// Get loads a job, or returns sql.ErrNoRows.
+func Get(ctx context.Context, db *sql.DB, id int64) (Job, error) {
+	var j Job
+	err := scanJob(db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id), &j)
+	return j, err
+}
+
+// List returns jobs of jobType in status (either empty for all), newest
+// first, with the total for paging.
+func List(ctx context.Context, db *sql.DB, jobType, status string, limit, offset int) ([]Job, int, error) {
+	const where = `WHERE ($1 = '' OR type = $1) AND ($2 = '' OR status = $2)`
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM jobs `+where, jobType, status).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+jobColumns+` FROM jobs `+where+` ORDER BY created_at DESC, id DESC LIMIT $3 OFFSET $4`,
+		jobType, status, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var list []Job
+	for rows.Next() {
+		var j Job
+		if err := scanJob(rows, &j); err != nil {
+			return nil, 0, err
+		}
+		list = append(list, j)
+	}
+	return list, total, rows.Err()
+}
@@ -0,0 +1,154 @@
+// Package ledger keeps the append-only financial record of orders and hands
+// out receipt numbers.
+package ledger
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Entry types.
+const (
+	TypeItems           = "ITEMS"
+	TypeTransportFee    = "TRANSPORT_FEE"
+	TypeSmallOrderFee   = "SMALL_ORDER_FEE"
+	TypeFeeAdjustment   = "FEE_ADJUSTMENT"
+	TypeTotalCorrection = "TOTAL_CORRECTION" // a confirmed total repaired to match its items and fees
+	TypeDiscount        = "DISCOUNT"
+	TypeShortfall       = "SHORTFALL" // a confirmed line staff could not supply
+	TypeCancellation    = "CANCELLATION"
+	TypeRefund          = "REFUND"
+)
+
+// ledgerLockKey serialises appends so each entry chains onto the last one.
+const ledgerLockKey = 0x6a616a4c // "jajL"
+
+// Entry is one row of the ledger.
+type Entry struct {
+	ID            int64     `json:"id"`
+	OrderID       int       `json:"orderId"`
+	ReceiptNumber string    `json:"receiptNumber,omitempty"`
+	Type          string    `json:"type"`
+	Amount        int       `json:"amount"`
+	CreatedAt     time.Time `json:"createdAt"`
+	PrevHash      string    `json:"prevHash"`
+	Hash          string    `json:"hash"`
+}
+
+func (e *Entry) computeHash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s|%d|%s",
+		e.PrevHash, e.OrderID, e.ReceiptNumber, e.Type, e.Amount, e.CreatedAt.UTC().Format(time.RFC3339Nano))))
+	return hex.EncodeToString(sum[:])
+}
+
+// Append writes entries to the ledger inside tx, chaining each onto the
+// previous entry's hash. Zero amounts are skipped.
+func Append(ctx context.Context, tx *sql.Tx, entries ...Entry) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, ledgerLockKey); err != nil {
+		return err
+	}
+
+	var prev string
+	err := tx.QueryRowContext(ctx, `SELECT hash FROM ledger_entries ORDER BY id DESC LIMIT 1`).Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond) // Postgres precision
+	for _, e := range entries {
+		if e.Amount == 0 {
+			continue
+		}
+		e.CreatedAt = now
+		e.PrevHash = prev
+		e.Hash = e.computeHash()
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO ledger_entries (order_id, receipt_number, entry_type, amount, created_at, prev_hash, hash)
+			 VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)`,
+			e.OrderID, e.ReceiptNumber, e.Type, e.Amount, e.CreatedAt, e.PrevHash, e.Hash,
+		); err != nil {
+			return err
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// RecordConfirmation gives a newly confirmed order its receipt number and
+// books its item, transport fee, and small-order fee charges. Call it in the confirming tx
+// after the order's totals are final.
+func RecordConfirmation(ctx context.Context, tx *sql.Tx, orderID int) (string, error) {
+	var seq int64
+	if err := tx.QueryRowContext(ctx, `SELECT nextval('receipt_number_seq')`).Scan(&seq); err != nil {
+		return "", err
+	}
+	receipt := fmt.Sprintf("R%08d", seq)
+
+	var fee, smallFee, total int
+	if err := tx.QueryRowContext(ctx,
+		`UPDATE orders SET receipt_number=$1 WHERE id=$2 RETURNING transport_fee, small_order_fee, total_cost`,
+		receipt, orderID,
+	).Scan(&fee, &smallFee, &total); err != nil {
+		return "", err
+	}
+
+	return receipt, Append(ctx, tx,
+		Entry{OrderID: orderID, ReceiptNumber: receipt, Type: TypeItems, Amount: total - fee - smallFee},
+		Entry{OrderID: orderID, ReceiptNumber: receipt, Type: TypeTransportFee, Amount: fee},
+		Entry{OrderID: orderID, ReceiptNumber: receipt, Type: TypeSmallOrderFee, Amount: smallFee},
+	)
+}
+
+// RecordCancellation reverses the charges of a cancelled order that had
+// already been confirmed. Orders without a receipt were never charged.
+func RecordCancellation(ctx context.Context, tx *sql.Tx, orderID int) error {
+	var (
+		receipt sql.NullString
+		total   int
+	)
+	if err := tx.QueryRowContext(ctx,
+		`SELECT receipt_number, total_cost FROM orders WHERE id=$1`, orderID,
+	).Scan(&receipt, &total); err != nil {
+		return err
+	}
+	if !receipt.Valid {
+		return nil
+	}
+	return Append(ctx, tx, Entry{OrderID: orderID, ReceiptNumber: receipt.String, Type: TypeCancellation, Amount: -total})
+}
+
+// ReceiptNumber returns the order's receipt number, or "" if it has none.
+func ReceiptNumber(ctx context.Context, tx *sql.Tx, orderID int) (string, error) {
+	var receipt sql.NullString
+	err := tx.QueryRowContext(ctx, `SELECT receipt_number FROM orders WHERE id=$1`, orderID).Scan(&receipt)
+	return receipt.String, err
+}
+
+// Verify walks the whole chain and returns the ID of the first entry whose
+// hash does not match, or 0 if the ledger is intact.
+func Verify(ctx context.Context, db *sql.DB) (int64, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, order_id, COALESCE(receipt_number, ''), entry_type, amount, created_at, prev_hash, hash
+		   FROM ledger_entries ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	prev := ""
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.OrderID, &e.ReceiptNumber, &e.Type, &e.Amount, &e.CreatedAt, &e.PrevHash, &e.Hash); err != nil {
+			return 0, err
+		}
+		if e.PrevHash != prev || e.computeHash() != e.Hash {
+			return e.ID, nil
+		}
+		prev = e.Hash
+	}
+	return 0, rows.Err()
+}
@@ -0,0 +1,176 @@
+// Package locale formats amounts and times the way a campus reads them,
+// "UGX 12,500" and "Tue 24 Jun, 18:00 EAT", for chat replies, emails, and
+// the display fields of API responses. Each campus sets its currency and
+// time zone; business days and pickup times are still reckoned in Kampala
+// time, so only how they are shown changes.
+package locale
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	// The server image has no zoneinfo of its own
+	_ "time/tzdata"
+)
+
+// Campus defaults, matching the columns' defaults.
+const (
+	DefaultCurrency = "UGX"
+	DefaultTimeZone = "Africa/Kampala"
+)
+
+// EAT is Kampala time, UTC+3 without daylight saving since 1960. It decides
+// what day an order, a delivery, or a budget week belongs to, and stands in
+// for Africa/Kampala should that fail to load.
+var EAT = time.FixedZone("EAT", 3*60*60)
+
+// Default is the locale of a campus with no settings of its own.
+var Default = Locale{Currency: DefaultCurrency, Location: EAT}
+
+func init() {
+	if loc, err := time.LoadLocation(DefaultTimeZone); err == nil {
+		Default.Location = loc
+	}
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Locale is how a campus shows amounts and times. The zero Locale is
+// Default.
+type Locale struct {
+	Currency string         // ISO 4217 code, e.g. "UGX"; amounts are whole units of it
+	Location *time.Location // e.g. Africa/Kampala
+}
+
+// Load returns the locale for a currency code and an IANA time zone name,
+// failing if either is not one.
+func Load(currency, timeZone string) (Locale, error) {
+	if !ValidCurrency(currency) {
+		return Locale{}, fmt.Errorf("currency %q is not a three-letter ISO 4217 code", currency)
+	}
+	if loc, ok := zones.Load(timeZone); ok {
+		return Locale{Currency: currency, Location: loc.(*time.Location)}, nil
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil || timeZone == "" || timeZone == "Local" {
+		return Locale{}, fmt.Errorf("time zone %q is not an IANA time zone name", timeZone)
+	}
+	zones.Store(timeZone, loc)
+	return Locale{Currency: currency, Location: loc}, nil
+}
+
+// ValidCurrency reports whether code is written as an ISO 4217 currency
+// code: three capital letters.
+func ValidCurrency(code string) bool {
+	return currencyCode.MatchString(code)
+}
+
+// zones caches loaded time zones by name; loading one parses its zoneinfo.
+var zones sync.Map
+
+func (l Locale) currency() string {
+	if l.Currency == "" {
+		return Default.Currency
+	}
+	return l.Currency
+}
+
+func (l Locale) location() *time.Location {
+	if l.Location == nil {
+		return Default.Location
+	}
+	return l.Location
+}
+
+// Money formats a whole amount with its currency and thousands separators:
+// "UGX 12,500", or "-UGX 500" for money going back.
+func (l Locale) Money(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return sign + l.currency() + " " + group(amount)
+}
+
+// group writes n with a comma between each group of three digits.
+func group(n int) string {
+	s := strconv.Itoa(n)
+	b := make([]byte, 0, len(s)+len(s)/3)
+	for i := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b = append(b, ',')
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+// In returns t in the locale's time zone.
+func (l Locale) In(t time.Time) time.Time {
+	return t.In(l.location())
+}
+
+// DateTime formats a moment with its weekday and zone: "Tue 24 Jun, 18:00 EAT".
+func (l Locale) DateTime(t time.Time) string {
+	return l.In(t).Format("Mon 2 Jan, 15:04 MST")
+}
+
+// Date formats the day of a moment: "Tue 24 Jun".
+func (l Locale) Date(t time.Time) string {
+	return l.In(t).Format("Mon 2 Jan")
+}
+
+// Clock formats the time of day of a moment: "18:00".
+func (l Locale) Clock(t time.Time) string {
+	return l.In(t).Format("15:04")
+}
+
+// querier is a *sql.DB or *sql.Tx.
+type querier interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// ForCampus returns the locale campus is set to, or Default if there is no
+// such campus. On an error it returns Default with it, so a caller can log
+// the error and carry on.
+func ForCampus(ctx context.Context, db querier, campus string) (Locale, error) {
+	return scan(db.QueryRowContext(ctx, `SELECT currency, time_zone FROM campuses WHERE name = $1`, campus))
+}
+
+// ForUser returns the locale of the student's campus, like ForCampus.
+func ForUser(ctx context.Context, db querier, userID int) (Locale, error) {
+	return scan(db.QueryRowContext(ctx,
+		`SELECT c.currency, c.time_zone FROM users u JOIN campuses c ON c.name = u.campus WHERE u.id = $1`, userID))
+}
+
+// ForOrder returns the locale of the campus an order was confirmed at, or
+// of its student's campus if it has not been confirmed, like ForCampus.
+func ForOrder(ctx context.Context, db querier, orderID int) (Locale, error) {
+	return scan(db.QueryRowContext(ctx,
+		`SELECT c.currency, c.time_zone
+		   FROM all_orders o
+		   JOIN users u ON u.id = o.user_id
+		   JOIN campuses c ON c.name = COALESCE(o.campus, u.campus)
+		  WHERE o.id = $1`,
+		orderID))
+}
+
+func scan(row *sql.Row) (Locale, error) {
+	var currency, timeZone string
+	if err := row.Scan(&currency, &timeZone); errors.Is(err, sql.ErrNoRows) {
+		return Default, nil
+	} else if err != nil {
+		return Default, err
+	}
+	l, err := Load(currency, timeZone)
+	if err != nil {
+		return Default, err
+	}
+	return l, nil
+}
@@ -0,0 +1,80 @@
+package monitoring
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.uber.org/zap"
+)
+
+// RegisterDatabase adds connection pool stats for the primary (and replica,
+// when distinct), and the business KPI and job and email queue gauges, which
+// are read from reader at scrape time.
+func (m *Metrics) RegisterDatabase(primary, reader *sql.DB, logger *zap.Logger) {
+	m.Registry.MustRegister(collectors.NewDBStatsCollector(primary, "primary"))
+	if reader != primary {
+		m.Registry.MustRegister(collectors.NewDBStatsCollector(reader, "replica"))
+	}
+	m.Registry.MustRegister(&businessCollector{db: reader, logger: logger})
+	m.Registry.MustRegister(&queueCollector{db: reader, logger: logger})
+}
+
+var (
+	ordersDesc = prometheus.NewDesc("jaj_orders",
+		"Orders currently in each status", []string{"status"}, nil)
+	revenueDesc = prometheus.NewDesc("jaj_revenue_ugx",
+		"Net revenue in UGX recorded in the financial ledger, after cancellations and refunds", nil, nil)
+	sessionsDesc = prometheus.NewDesc("jaj_active_sessions",
+		"Login sessions that have not expired", nil, nil)
+)
+
+// businessCollector queries KPIs on each scrape so the numbers are correct
+// across restarts and replicas rather than counted in process.
+type businessCollector struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ordersDesc
+	ch <- revenueDesc
+	ch <- sessionsDesc
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM orders GROUP BY status`)
+	if err != nil {
+		c.logger.Warn("orders metric query failed", zap.Error(err))
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var status string
+			var n float64
+			if err := rows.Scan(&status, &n); err != nil {
+				c.logger.Warn("orders metric scan failed", zap.Error(err))
+				break
+			}
+			ch <- prometheus.MustNewConstMetric(ordersDesc, prometheus.GaugeValue, n, status)
+		}
+	}
+
+	var revenue float64
+	if err := c.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(amount), 0) FROM ledger_entries`).Scan(&revenue); err != nil {
+		c.logger.Warn("revenue metric query failed", zap.Error(err))
+	} else {
+		ch <- prometheus.MustNewConstMetric(revenueDesc, prometheus.GaugeValue, revenue)
+	}
+
+	var sessions float64
+	if err := c.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions WHERE expires_at > NOW()`).Scan(&sessions); err != nil {
+		c.logger.Warn("sessions metric query failed", zap.Error(err))
+	} else {
+		ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.GaugeValue, sessions)
+	}
+}
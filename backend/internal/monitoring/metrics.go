@@ -4,33 +4,162 @@ import (
 	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
-// NewLogger returns a configured Zap logger.
-func NewLogger() *zap.Logger {
-	logger, _ := zap.NewProduction()
+// NewLogger returns a configured Zap logger. Output is passed through the
+// PII redaction layer unless verbose is set, which also enables debug logs;
+// callers must only set it in development.
+func NewLogger(verbose bool) *zap.Logger {
+	if verbose {
+		cfg := zap.NewDevelopmentConfig()
+		logger, _ := cfg.Build()
+		return logger
+	}
+	logger, _ := zap.NewProduction(zap.WrapCore(NewRedactingCore))
 	return logger
 }
 
-// NewRegistry sets up Prometheus metrics registry and registers core metrics.
-func NewRegistry() *prometheus.CounterVec {
-	// Define a CounterVec for request counts by endpoint
-	counter := prometheus.NewCounterVec(
-		prometheus.CounterOpts{
+// Metrics is the application's Prometheus registry and the collectors that
+// packages record into. A dedicated registry keeps library-registered
+// globals out of /metrics.
+type Metrics struct {
+	Registry            *prometheus.Registry
+	Requests            *prometheus.CounterVec   // jaj_requests_total{endpoint}
+	Emails              *prometheus.CounterVec   // jaj_emails_total{kind,result}
+	LLMLatency          *prometheus.HistogramVec // jaj_llm_request_duration_seconds{operation,result}
+	CatalogLatency      *prometheus.HistogramVec // jaj_catalog_search_duration_seconds{result}
+	ShadowLatency       *prometheus.HistogramVec // jaj_catalog_shadow_duration_seconds{result}
+	ShadowComparisons   *prometheus.CounterVec   // jaj_catalog_shadow_comparisons_total{outcome}
+	Suggestions         *prometheus.CounterVec   // jaj_chat_suggestions_total{event}
+	Verifications       *prometheus.CounterVec   // jaj_email_verifications_total{event}
+	ReconciliationFixes *prometheus.CounterVec   // jaj_reconciliation_fixes_total{kind}
+	RetentionPurged     *prometheus.CounterVec   // jaj_retention_purged_rows_total{table}
+	EmailLatency        *prometheus.HistogramVec // jaj_email_send_duration_seconds{kind,result}
+	EmailRetries        *prometheus.CounterVec   // jaj_email_retries_total{kind}
+	JobDuration         *prometheus.HistogramVec // jaj_job_duration_seconds{type,result}
+	JobRetries          *prometheus.CounterVec   // jaj_job_retries_total{type}
+	JobDeadLetters      *prometheus.CounterVec   // jaj_job_dead_letters_total{type}
+	EventsDropped       *prometheus.CounterVec   // jaj_events_dropped_total{topic}
+	Responses           *prometheus.CounterVec   // jaj_http_responses_total{class}
+	DependencyUp        *prometheus.GaugeVec     // jaj_dependency_up{dependency}
+}
+
+// NewMetrics creates the registry with Go runtime and process collectors
+// plus the application's counters and histograms.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "jaj_requests_total",
 			Help: "Total number of requests handled by endpoint",
-		},
-		[]string{"endpoint"},
+		}, []string{"endpoint"}),
+		Emails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_emails_total",
+			Help: "Emails attempted, by kind and result (sent or failed)",
+		}, []string{"kind", "result"}),
+		LLMLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jaj_llm_request_duration_seconds",
+			Help:    "Latency of LLM API calls, by operation and result",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 15},
+		}, []string{"operation", "result"}),
+		CatalogLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jaj_catalog_search_duration_seconds",
+			Help:    "Latency of MCP catalog searches, by result",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"result"}),
+		ShadowLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jaj_catalog_shadow_duration_seconds",
+			Help:    "Latency of shadow catalog searches, by result",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"result"}),
+		ShadowComparisons: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_catalog_shadow_comparisons_total",
+			Help: "Catalog searches compared with the shadow matcher, by outcome (match, mismatch, detail_mismatch, primary_only, shadow_only, primary_error, shadow_error, or skipped)",
+		}, []string{"outcome"}),
+		Suggestions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_chat_suggestions_total",
+			Help: "Chat add-on suggestions, by event (shown or accepted)",
+		}, []string{"event"}),
+		Verifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_email_verifications_total",
+			Help: "Email verification link steps, by event (viewed, completed, repeated, or invalid)",
+		}, []string{"event"}),
+		ReconciliationFixes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_reconciliation_fixes_total",
+			Help: "Inconsistent orders repaired in the background, by kind (total or orphaned_draft)",
+		}, []string{"kind"}),
+		RetentionPurged: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_retention_purged_rows_total",
+			Help: "Rows deleted for being past their retention period, by table",
+		}, []string{"table"}),
+		EmailLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jaj_email_send_duration_seconds",
+			Help:    "Time to send an email over SMTP, retries included, by kind and result (sent, failed, or suppressed)",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+		}, []string{"kind", "result"}),
+		EmailRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_email_retries_total",
+			Help: "Emails tried again after a temporary SMTP failure, by kind",
+		}, []string{"kind"}),
+		JobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jaj_job_duration_seconds",
+			Help:    "Time each background job attempt took, by type and result",
+			Buckets: []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300},
+		}, []string{"type", "result"}),
+		JobRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_job_retries_total",
+			Help: "Failed job attempts queued to run again, by type",
+		}, []string{"type"}),
+		JobDeadLetters: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_job_dead_letters_total",
+			Help: "Jobs that failed for good after their last attempt, by type",
+		}, []string{"type"}),
+		EventsDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_events_dropped_total",
+			Help: "Events the in-memory bus could not deliver to a subscriber with a full buffer, by topic",
+		}, []string{"topic"}),
+		Responses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jaj_http_responses_total",
+			Help: "HTTP responses served, by status class (2xx, 3xx, 4xx, or 5xx)",
+		}, []string{"class"}),
+		DependencyUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "jaj_dependency_up",
+			Help: "Whether chat's health probes find each dependency (llm or catalog) up",
+		}, []string{"dependency"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.Requests, m.Emails, m.LLMLatency, m.CatalogLatency, m.Suggestions, m.Verifications,
+		m.ReconciliationFixes, m.ShadowLatency, m.ShadowComparisons, m.RetentionPurged,
+		m.EmailLatency, m.EmailRetries, m.JobDuration, m.JobRetries, m.JobDeadLetters,
+		m.EventsDropped, m.Responses, m.DependencyUp,
 	)
-	prometheus.MustRegister(counter)
-
-	return counter
+	return m
 }
 
 // MakeMetricsHandler returns an HTTP handler for Prometheus scraping.
-func MakeMetricsHandler(counter *prometheus.CounterVec) http.Handler {
-	// You can also register other metrics here
-	return promhttp.Handler()
+func MakeMetricsHandler(m *Metrics) http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// NewReplicaLagGauge registers the gauge that tracks read replica lag.
+func (m *Metrics) NewReplicaLagGauge() prometheus.Gauge {
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "jaj_db_replica_lag_seconds",
+		Help: "Seconds the read replica is behind the primary",
+	})
+	m.Registry.MustRegister(gauge)
+	return gauge
+}
+
+// Result is the result label for an operation that returned err.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
 }
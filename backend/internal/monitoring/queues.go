@@ -0,0 +1,80 @@
+package monitoring
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	jobDepthDesc = prometheus.NewDesc("jaj_job_queue_depth",
+		"Background jobs waiting or running, by type and state (ready, scheduled for a retry, or running)",
+		[]string{"type", "state"}, nil)
+	jobOldestDesc = prometheus.NewDesc("jaj_job_oldest_ready_seconds",
+		"How long the oldest ready job of each type has been waiting for a worker", []string{"type"}, nil)
+	jobFailedDesc = prometheus.NewDesc("jaj_jobs_failed",
+		"Jobs that ran out of attempts, by type, while kept (7 days)", []string{"type"}, nil)
+	emailQueueDesc = prometheus.NewDesc("jaj_email_queue_depth",
+		"Announcement emails still to send for campaigns that are sending", nil, nil)
+)
+
+// queueCollector reads the job and email backlogs on each scrape, so every
+// instance reports the shared queues rather than its own share of them.
+type queueCollector struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jobDepthDesc
+	ch <- jobOldestDesc
+	ch <- jobFailedDesc
+	ch <- emailQueueDesc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx,
+		`SELECT type,
+		        COUNT(*) FILTER (WHERE status = 'QUEUED' AND run_at <= NOW()),
+		        COUNT(*) FILTER (WHERE status = 'QUEUED' AND run_at > NOW()),
+		        COUNT(*) FILTER (WHERE status = 'RUNNING'),
+		        COUNT(*) FILTER (WHERE status = 'FAILED'),
+		        COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(run_at) FILTER (WHERE status = 'QUEUED' AND run_at <= NOW())), 0)
+		   FROM jobs
+		  GROUP BY type`)
+	if err != nil {
+		c.logger.Warn("job queue metric query failed", zap.Error(err))
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var jobType string
+			var ready, scheduled, running, failed, oldest float64
+			if err := rows.Scan(&jobType, &ready, &scheduled, &running, &failed, &oldest); err != nil {
+				c.logger.Warn("job queue metric scan failed", zap.Error(err))
+				break
+			}
+			ch <- prometheus.MustNewConstMetric(jobDepthDesc, prometheus.GaugeValue, ready, jobType, "ready")
+			ch <- prometheus.MustNewConstMetric(jobDepthDesc, prometheus.GaugeValue, scheduled, jobType, "scheduled")
+			ch <- prometheus.MustNewConstMetric(jobDepthDesc, prometheus.GaugeValue, running, jobType, "running")
+			ch <- prometheus.MustNewConstMetric(jobOldestDesc, prometheus.GaugeValue, oldest, jobType)
+			ch <- prometheus.MustNewConstMetric(jobFailedDesc, prometheus.GaugeValue, failed, jobType)
+		}
+	}
+
+	var pending float64
+	if err := c.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM email_campaign_recipients r
+		   JOIN email_campaigns c ON c.id = r.campaign_id
+		  WHERE c.status = 'SENDING' AND r.status = 'PENDING'`,
+	).Scan(&pending); err != nil {
+		c.logger.Warn("email queue metric query failed", zap.Error(err))
+	} else {
+		ch <- prometheus.MustNewConstMetric(emailQueueDesc, prometheus.GaugeValue, pending)
+	}
+}
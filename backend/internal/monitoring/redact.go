@@ -0,0 +1,102 @@
+package monitoring
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var redactions = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// Tokens first, so "token=abc@x.io"-style values are not half-masked as emails.
+	{regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*`), "Bearer [REDACTED]"},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), "[REDACTED_JWT]"},
+	{regexp.MustCompile(`\bgsk_[A-Za-z0-9]{16,}`), "[REDACTED_KEY]"},
+	{regexp.MustCompile(`(?i)\b(token|session|password|passwd|pass|secret|api[_-]?key)(["']?\s*[:=]\s*["']?)[^\s"'&,;]+`), "${1}${2}[REDACTED]"},
+	{regexp.MustCompile(`\b[a-fA-F0-9]{32,}\b`), "[REDACTED_TOKEN]"},
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[REDACTED_EMAIL]"},
+	{regexp.MustCompile(`(?:\+?256|\b0)[\s-]?7\d{2}[\s-]?\d{3}[\s-]?\d{3}\b`), "[REDACTED_PHONE]"},
+	{regexp.MustCompile(`\+\d{10,14}\b`), "[REDACTED_PHONE]"},
+}
+
+// Redact masks email addresses, phone numbers, and credentials in s.
+func Redact(s string) string {
+	for _, r := range redactions {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	return s
+}
+
+// MaskEmail keeps enough of an address to tell accounts apart in logs:
+// "jane.doe@example.com" becomes "j***@example.com".
+func MaskEmail(addr string) string {
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok || local == "" {
+		return "[REDACTED_EMAIL]"
+	}
+	return local[:1] + "***@" + domain
+}
+
+// Email is a zap field for an email address that is masked before logging.
+func Email(key, addr string) zap.Field {
+	return zap.String(key, MaskEmail(addr))
+}
+
+// redactingCore runs every message and field value through Redact before
+// handing the entry to the wrapped core.
+type redactingCore struct {
+	zapcore.Core
+}
+
+// NewRedactingCore wraps core so nothing it writes contains raw PII.
+func NewRedactingCore(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core}
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c *redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = Redact(ent.Message)
+	return c.Core.Write(ent, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = Redact(f.String)
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				f = zap.String(f.Key, Redact(err.Error()))
+			}
+		case zapcore.StringerType:
+			if s, ok := f.Interface.(fmt.Stringer); ok {
+				f = zap.String(f.Key, Redact(s.String()))
+			}
+		case zapcore.ByteStringType:
+			// %+v would print the bytes as numbers, which Redact cannot match
+			if b, ok := f.Interface.([]byte); ok {
+				f = zap.String(f.Key, Redact(string(b)))
+			}
+		case zapcore.ReflectType:
+			f = zap.String(f.Key, Redact(fmt.Sprintf("%+v", f.Interface)))
+		}
+		out[i] = f
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package monitoring
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// CountResponses returns middleware that counts every response by status
+// class in Responses. It belongs outside the panic recovery middleware, so
+// the 500s that writes are counted. Upgraded connections have no status
+// worth counting and are passed straight through.
+func (m *Metrics) CountResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		m.Responses.WithLabelValues(strconv.Itoa(sw.status/100) + "xx").Inc()
+	})
+}
+
+// statusWriter remembers the status of the response written through it,
+// which is 200 unless the handler sets another before writing.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !sw.wroteHeader && status >= 200 {
+		sw.status = status
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the underlying writer, for streamed responses.
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
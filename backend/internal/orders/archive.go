@@ -0,0 +1,111 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// archiveBatch is how many orders ArchiveOrders moves per transaction. Small
+// batches keep row locks short and let autovacuum keep up between them.
+const archiveBatch = 500
+
+// ArchiveOrders moves orders created before cutoff that are done with
+// (fulfilled or cancelled, with no refund still in progress) to the archive
+// tables, with their items and status history, and returns how many moved.
+// Customers still see them through the all_orders views.
+func ArchiveOrders(ctx context.Context, db *sql.DB, cutoff time.Time) (int, error) {
+	moved := 0
+	for {
+		n, err := archiveBatchBefore(ctx, db, cutoff)
+		moved += n
+		if err != nil || n < archiveBatch {
+			return moved, err
+		}
+	}
+}
+
+// archiveBatchBefore moves one batch. SKIP LOCKED lets every instance run
+// the archiver without two of them claiming the same orders, and leaves
+// alone any order a request is changing right now.
+func archiveBatchBefore(ctx context.Context, db *sql.DB, cutoff time.Time) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT o.id FROM orders o
+		  WHERE o.created_at < $1
+		    AND o.status IN ('FULFILLED', 'CANCELLED')
+		    AND NOT EXISTS (SELECT 1 FROM refunds r WHERE r.order_id = o.id AND r.status <> 'ISSUED')
+		  ORDER BY o.created_at
+		  LIMIT $2
+		  FOR UPDATE SKIP LOCKED`,
+		cutoff, archiveBatch,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	// Children first: deleting the orders would cascade to them
+	for _, q := range []string{
+		`WITH moved AS (DELETE FROM order_items WHERE order_id = ANY($1) RETURNING *)
+		 INSERT INTO order_items_archive SELECT * FROM moved`,
+		`WITH moved AS (DELETE FROM order_status_history WHERE order_id = ANY($1) RETURNING *)
+		 INSERT INTO order_status_history_archive SELECT * FROM moved`,
+		`WITH moved AS (DELETE FROM orders WHERE id = ANY($1) RETURNING *)
+		 INSERT INTO orders_archive SELECT * FROM moved`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, pq.Array(ids)); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// RunArchiver archives orders older than months every interval until ctx is
+// done. After a run that moved orders it vacuums the live tables, so the
+// space the deleted rows held is reused at once rather than when autovacuum
+// next gets to them, and refreshes their planner statistics.
+func RunArchiver(ctx context.Context, db *sql.DB, logger *zap.Logger, months int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		moved, err := ArchiveOrders(ctx, db, time.Now().AddDate(0, -months, 0))
+		if err != nil {
+			logger.Error("order archival failed", zap.Int("archived", moved), zap.Error(err))
+		}
+		if moved == 0 {
+			continue
+		}
+		logger.Info("archived old orders", zap.Int("orders", moved))
+		// VACUUM cannot run in a transaction, so it gets its own statement
+		if _, err := db.ExecContext(ctx, `VACUUM (ANALYZE) orders, order_items, order_status_history`); err != nil {
+			logger.Warn("vacuum after archival failed", zap.Error(err))
+		}
+	}
+}
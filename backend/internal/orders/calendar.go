@@ -0,0 +1,157 @@
+package orders
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/httpx"
+	"server/internal/locale"
+
+	"go.uber.org/zap"
+)
+
+// Pickup schedule shared by every order. Uganda has no daylight saving, so a
+// fixed UTC+3 zone is exact. The day's orders close, and can no longer be
+// cancelled, at CutoffTime.
+const (
+	PickupTime    = "18:00"
+	PickupStation = "F2 17"
+	CutoffTime    = "17:00"
+	pickupHour    = 18
+	cutoffHour    = 17
+	pickupWindow  = 30 * time.Minute
+)
+
+// PickupAt returns when an order confirmed at confirmedAt is ready: 18:00 the
+// same day, or the next day for orders confirmed after the cut-off.
+func PickupAt(confirmedAt time.Time) time.Time {
+	local := confirmedAt.In(locale.EAT)
+	pickup := time.Date(local.Year(), local.Month(), local.Day(), pickupHour, 0, 0, 0, locale.EAT)
+	if !local.Before(pickup) {
+		pickup = pickup.AddDate(0, 0, 1)
+	}
+	return pickup
+}
+
+// PickupConfirmations returns the span of confirmation times whose orders are
+// picked up on the Kampala day starting at day: from the previous day's
+// cut-off up to this day's.
+func PickupConfirmations(day time.Time) (from, to time.Time) {
+	local := day.In(locale.EAT)
+	to = time.Date(local.Year(), local.Month(), local.Day(), pickupHour, 0, 0, 0, locale.EAT)
+	return to.AddDate(0, 0, -1), to
+}
+
+// PickupCalendar renders an iCalendar file with one event for collecting the
+// order at station, plus a reminder half an hour before.
+func PickupCalendar(orderID int, pickup time.Time, station string) []byte {
+	const stamp = "20060102T150405Z"
+	var b bytes.Buffer
+	line := func(s string) { b.WriteString(s + "\r\n") }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//JAJ//Order Pickup//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("BEGIN:VEVENT")
+	line(fmt.Sprintf("UID:order-%d-pickup@jaj", orderID))
+	line("DTSTAMP:" + time.Now().UTC().Format(stamp))
+	line("DTSTART:" + pickup.UTC().Format(stamp))
+	line("DTEND:" + pickup.Add(pickupWindow).UTC().Format(stamp))
+	line(fmt.Sprintf("SUMMARY:Pick up JAJ order #%d", orderID))
+	line("LOCATION:" + icsEscape(station))
+	line("DESCRIPTION:" + icsEscape(fmt.Sprintf(
+		"Your JAJ order #%d is ready for pickup at %s. Payment is cash on pickup.", orderID, station)))
+	line("BEGIN:VALARM")
+	line("TRIGGER:-PT30M")
+	line("ACTION:DISPLAY")
+	line(fmt.Sprintf("DESCRIPTION:JAJ order #%d pickup in 30 minutes", orderID))
+	line("END:VALARM")
+	line("END:VEVENT")
+	line("END:VCALENDAR")
+	return b.Bytes()
+}
+
+// icsEscape escapes TEXT values per RFC 5545 section 3.3.11.
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// PickupStationFor returns the station the user prefers, falling back to the
+// default when none is set or the lookup fails.
+func PickupStationFor(ctx context.Context, db *sql.DB, userID int) string {
+	var station string
+	err := db.QueryRowContext(ctx,
+		`SELECT COALESCE(pickup_station, '') FROM users WHERE id = $1`, userID,
+	).Scan(&station)
+	if err != nil || station == "" {
+		return PickupStation
+	}
+	return station
+}
+
+// ConfirmedAt returns when the order was last confirmed, or sql.ErrNoRows if
+// it never was.
+func ConfirmedAt(ctx context.Context, db *sql.DB, orderID int) (time.Time, error) {
+	var t time.Time
+	err := db.QueryRowContext(ctx,
+		`SELECT changed_at FROM order_status_history
+		  WHERE order_id = $1 AND status = 'CONFIRMED'
+		  ORDER BY changed_at DESC LIMIT 1`,
+		orderID,
+	).Scan(&t)
+	return t, err
+}
+
+// handleOrderCalendar serves the pickup event of a confirmed order as an
+// .ics file for the student's calendar app.
+func handleOrderCalendar(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	var ownerID int
+	var status string
+	err = db.QueryRowContext(ctx, `SELECT user_id, status FROM orders WHERE id=$1`, orderID).Scan(&ownerID, &status)
+	if err == sql.ErrNoRows {
+		httpx.WriteError(w, domain.NotFound("order not found"))
+		return
+	} else if err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if ownerID != userID {
+		http.Error(w, "not authorized", http.StatusForbidden)
+		return
+	}
+	if status != "CONFIRMED" && status != "PACKED" {
+		http.Error(w, "only confirmed orders have a pickup", http.StatusConflict)
+		return
+	}
+
+	at, err := ConfirmedAt(ctx, db, orderID)
+	if err != nil {
+		logger.Error("failed to load confirmation time", zap.Int("order_id", orderID), zap.Error(err))
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="jaj-order-%d.ics"`, orderID))
+	w.Write(PickupCalendar(orderID, PickupAt(at), PickupStationFor(ctx, db, userID)))
+}
@@ -0,0 +1,124 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"server/internal/domain"
+	"server/internal/locale"
+)
+
+// Daily order capacity. Each campus's day starts at OrdersOpenAt, Kampala
+// time; campuses with no capacity set take unlimited orders.
+const (
+	DefaultCampus = "main"
+	OrdersOpenAt  = "08:00"
+	opensHour     = 8
+)
+
+// CapacityError is returned by ReserveCapacity when the campus has taken
+// all the orders it can fulfil today.
+type CapacityError struct {
+	Campus    string
+	ReopensAt time.Time
+	at        time.Time
+}
+
+func (e *CapacityError) Error() string {
+	day := "tomorrow"
+	if e.ReopensAt.In(locale.EAT).Format("2006-01-02") == e.at.In(locale.EAT).Format("2006-01-02") {
+		day = "today"
+	}
+	return fmt.Sprintf("We're full for today, ordering opens again %s at %s.", day, OrdersOpenAt)
+}
+
+// Is makes a full campus a domain.ErrQuotaExceeded.
+func (e *CapacityError) Is(target error) bool { return target == domain.ErrQuotaExceeded }
+
+// RetryAfter is how long until the campus takes orders again.
+func (e *CapacityError) RetryAfter() time.Duration { return e.ReopensAt.Sub(e.at) }
+
+// CapacityDay returns the ordering day now falls in: it starts at
+// OrdersOpenAt and runs until the same time the next day.
+func CapacityDay(now time.Time) (start, end time.Time) {
+	local := now.In(locale.EAT)
+	start = time.Date(local.Year(), local.Month(), local.Day(), opensHour, 0, 0, 0, locale.EAT)
+	if local.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start, start.AddDate(0, 0, 1)
+}
+
+// ReserveCapacity stamps the order with its user's campus and fails with
+// *CapacityError, leaving the caller to roll back, if the campus has already
+// confirmed its daily capacity of other orders or held the rest for other
+// students' waitlist claims. Call it inside the transaction that confirms
+// the order; an advisory lock per campus keeps concurrent confirmations from
+// overshooting. A successful reservation uses up the student's waitlist
+// claim, if any.
+func ReserveCapacity(ctx context.Context, tx *sql.Tx, orderID int) error {
+	var campus string
+	if err := tx.QueryRowContext(ctx,
+		`UPDATE orders o SET campus = u.campus FROM users u
+		  WHERE o.id = $1 AND u.id = o.user_id
+		 RETURNING o.campus`,
+		orderID,
+	).Scan(&campus); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`SELECT pg_advisory_xact_lock(hashtext('campus-capacity:' || $1::text))`, campus); err != nil {
+		return err
+	}
+
+	var capacity sql.NullInt64
+	if err := tx.QueryRowContext(ctx,
+		`SELECT daily_capacity FROM campuses WHERE name = $1`, campus,
+	).Scan(&capacity); err != nil {
+		return err
+	}
+	if capacity.Valid {
+		now := time.Now()
+		start, end := CapacityDay(now)
+		taken, err := slotsTaken(ctx, tx, campus, start, orderID)
+		if err != nil {
+			return err
+		}
+		if int64(taken) >= capacity.Int64 {
+			return &CapacityError{Campus: campus, ReopensAt: end, at: now}
+		}
+	}
+
+	// Whatever they order, a student with a waitlist claim has now used it
+	_, err := tx.ExecContext(ctx,
+		`UPDATE waitlist SET status = 'CLAIMED', order_id = $1
+		  WHERE user_id = (SELECT user_id FROM orders WHERE id = $1) AND status = 'NOTIFIED'`,
+		orderID,
+	)
+	return err
+}
+
+// slotsTaken counts the campus's live orders confirmed at or after since,
+// leaving out orderID, plus the slots held for other students by unexpired
+// waitlist claims.
+func slotsTaken(ctx context.Context, tx *sql.Tx, campus string, since time.Time, orderID int) (int, error) {
+	var n int
+	err := tx.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(DISTINCT o.id)
+		           FROM orders o
+		           JOIN order_status_history h ON h.order_id = o.id AND h.status = 'CONFIRMED'
+		          WHERE o.campus = $1
+		            AND o.id <> $2
+		            AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		            AND h.changed_at >= $3)
+		      + (SELECT COUNT(*)
+		           FROM waitlist
+		          WHERE campus = $1
+		            AND status = 'NOTIFIED' AND claim_expires > NOW()
+		            AND user_id <> (SELECT user_id FROM orders WHERE id = $2))`,
+		campus, orderID, since,
+	).Scan(&n)
+	return n, err
+}
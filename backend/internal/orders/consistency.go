@@ -0,0 +1,204 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"server/internal/events"
+	"server/internal/ledger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// staleDraftAge is how long a chat draft may sit PENDING, with its student
+// off the waitlist, before the consistency check cancels it.
+const staleDraftAge = 7 * 24 * time.Hour
+
+// ReconcileTotals recomputes the totals of orders confirmed since since
+// from their order_items, and corrects any whose total_cost or tax_total
+// disagrees, such as CONFIRMED orders left at 0 when the fee update after
+// confirming failed. Each correction is logged, booked in the ledger, and
+// published as a reprice. It returns how many orders were corrected.
+func ReconcileTotals(ctx context.Context, db *sql.DB, bus events.Bus, logger *zap.Logger, since time.Time) (int, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT o.id
+		   FROM orders o
+		   JOIN LATERAL (SELECT COALESCE(SUM(quantity * unit_price), 0) AS subtotal,
+		                        COALESCE(SUM(tax_amount), 0) AS tax
+		                   FROM order_items WHERE order_id = o.id) i ON TRUE
+		  WHERE o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED') AND o.created_at >= $1
+		    AND (o.total_cost <> i.subtotal + o.transport_fee + o.small_order_fee OR o.tax_total <> i.tax)`,
+		since,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	fixed := 0
+	for _, id := range ids {
+		c, ok, err := correctTotal(ctx, db, id)
+		if err != nil {
+			return fixed, err
+		}
+		if !ok {
+			continue
+		}
+		logger.Warn("corrected order total",
+			zap.Int("order_id", id), zap.Int("old_total", c.oldTotal), zap.Int("total", c.TotalCost))
+		PublishRepriced(ctx, bus, logger, []RepricedEvent{c.RepricedEvent})
+		fixed++
+	}
+	return fixed, nil
+}
+
+// totalCorrection is one order's repaired total.
+type totalCorrection struct {
+	RepricedEvent
+	oldTotal int
+}
+
+// correctTotal recomputes one order's totals under its row lock. ok is false
+// when they turn out to be right, e.g. because the order changed since it
+// was picked out.
+func correctTotal(ctx context.Context, db *sql.DB, orderID int) (c totalCorrection, ok bool, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return c, false, err
+	}
+	defer tx.Rollback()
+
+	var (
+		receipt         sql.NullString
+		smallFee, taxes int
+	)
+	if err := tx.QueryRowContext(ctx,
+		`SELECT user_id, receipt_number, transport_fee, small_order_fee, total_cost, tax_total
+		   FROM orders WHERE id = $1 AND status IN ('CONFIRMED', 'PACKED', 'FULFILLED') FOR UPDATE`,
+		orderID,
+	).Scan(&c.UserID, &receipt, &c.TransportFee, &smallFee, &c.oldTotal, &taxes); err == sql.ErrNoRows {
+		return c, false, nil
+	} else if err != nil {
+		return c, false, err
+	}
+	var subtotal, tax int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(quantity * unit_price), 0), COALESCE(SUM(tax_amount), 0)
+		   FROM order_items WHERE order_id = $1`,
+		orderID,
+	).Scan(&subtotal, &tax); err != nil {
+		return c, false, err
+	}
+	c.OrderID, c.OldFee = orderID, c.TransportFee
+	c.TotalCost = subtotal + c.TransportFee + smallFee
+	if c.TotalCost == c.oldTotal && tax == taxes {
+		return c, false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE orders SET total_cost = $1, tax_total = $2, version = version + 1 WHERE id = $3`,
+		c.TotalCost, tax, orderID,
+	); err != nil {
+		return c, false, err
+	}
+	if receipt.Valid {
+		if err := ledger.Append(ctx, tx, ledger.Entry{
+			OrderID: orderID, ReceiptNumber: receipt.String, Type: ledger.TypeTotalCorrection, Amount: c.TotalCost - c.oldTotal,
+		}); err != nil {
+			return c, false, err
+		}
+	}
+	return c, true, tx.Commit()
+}
+
+// CancelOrphanedDrafts cancels PENDING orders nobody will act on: drafts a
+// newer order of the same student should have superseded, and drafts
+// untouched for staleDraftAge whose student is not on the waitlist. The
+// cancellations are silent. It returns how many it cancelled.
+func CancelOrphanedDrafts(ctx context.Context, db *sql.DB, bus events.Bus, logger *zap.Logger, now time.Time) (int, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT o.id, o.user_id, o.version
+		   FROM orders o
+		  WHERE o.status = 'PENDING'
+		    AND (EXISTS (SELECT 1 FROM orders n
+		                  WHERE n.user_id = o.user_id AND (n.created_at, n.id) > (o.created_at, o.id))
+		         OR (o.created_at < $1
+		             AND NOT EXISTS (SELECT 1 FROM waitlist w
+		                              WHERE w.user_id = o.user_id AND w.status IN ('WAITING', 'NOTIFIED'))))`,
+		now.Add(-staleDraftAge),
+	)
+	if err != nil {
+		return 0, err
+	}
+	type draft struct{ id, userID, version int }
+	var orphans []draft
+	for rows.Next() {
+		var d draft
+		if err := rows.Scan(&d.id, &d.userID, &d.version); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orphans = append(orphans, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	for _, d := range orphans {
+		if err := UpdateStatus(ctx, db, d.id, d.version, "CANCELLED"); err == ErrConflict {
+			continue // settled since it was picked out
+		} else if err != nil {
+			return cancelled, err
+		}
+		if err := RecordStatusChange(ctx, db, d.id, "CANCELLED"); err != nil {
+			logger.Error("failed to record order status", zap.Int("order_id", d.id), zap.Error(err))
+		}
+		logger.Warn("cancelled orphaned draft", zap.Int("order_id", d.id), zap.Int("user_id", d.userID))
+		PublishStatus(ctx, bus, logger, StatusEvent{UserID: d.userID, OrderID: d.id, Status: "CANCELLED", Silent: true})
+		cancelled++
+	}
+	return cancelled, nil
+}
+
+// RunConsistencyChecker runs ReconcileTotals over the last week and
+// CancelOrphanedDrafts every interval until ctx is done, counting fixes on
+// fixes by kind ("total" or "orphaned_draft").
+func RunConsistencyChecker(ctx context.Context, db *sql.DB, bus events.Bus, logger *zap.Logger, fixes *prometheus.CounterVec, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if n, err := ReconcileTotals(ctx, db, bus, logger, now.AddDate(0, 0, -7)); err != nil {
+			logger.Error("order total reconciliation failed", zap.Error(err))
+		} else if n > 0 {
+			fixes.WithLabelValues("total").Add(float64(n))
+		}
+		if n, err := CancelOrphanedDrafts(ctx, db, bus, logger, now); err != nil {
+			logger.Error("orphaned draft cleanup failed", zap.Error(err))
+		} else if n > 0 {
+			fixes.WithLabelValues("orphaned_draft").Add(float64(n))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"server/internal/locale"
+)
+
+// DuplicateWindow is how recent an order with the same items has to be for
+// a new one to be treated as a likely accident.
+const DuplicateWindow = time.Hour
+
+// DuplicateError is returned by CheckDuplicate when the student already
+// placed an order with the same items within DuplicateWindow.
+type DuplicateError struct {
+	PreviousOrderID int
+	PlacedAt        time.Time
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("You already ordered this at %s (order #%d).", e.PlacedAt.In(locale.EAT).Format("15:04"), e.PreviousOrderID)
+}
+
+// CheckDuplicate returns *DuplicateError if another of userID's orders
+// confirmed within DuplicateWindow has exactly the same items as orderID,
+// whatever the quantities, unless override is set. Call it in the confirming
+// transaction once the order's items are stored.
+func CheckDuplicate(ctx context.Context, tx *sql.Tx, userID, orderID int, override bool) error {
+	if override {
+		return nil
+	}
+	var e DuplicateError
+	err := tx.QueryRowContext(ctx,
+		`SELECT o.id, c.at
+		   FROM orders o
+		   JOIN LATERAL (SELECT MAX(h.changed_at) AS at FROM order_status_history h
+		                  WHERE h.order_id = o.id AND h.status = 'CONFIRMED') c ON TRUE
+		  WHERE o.user_id = $1 AND o.id <> $2
+		    AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		    AND c.at >= $3
+		    AND ARRAY(SELECT DISTINCT item_id FROM order_items WHERE order_id = o.id ORDER BY 1)
+		      = ARRAY(SELECT DISTINCT item_id FROM order_items WHERE order_id = $2 ORDER BY 1)
+		  ORDER BY c.at DESC
+		  LIMIT 1`,
+		userID, orderID, time.Now().Add(-DuplicateWindow),
+	).Scan(&e.PreviousOrderID, &e.PlacedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return &e
+}
@@ -0,0 +1,250 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"server/internal/events"
+	"server/internal/locale"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// TopicOrderETA is published, once per order still waiting, whenever the
+// pickup queue it is in changes.
+const TopicOrderETA = "order.eta"
+
+// Packing rates used when /admin/config does not set them.
+const (
+	defaultPrepStart  = "17:00"
+	defaultPrepMins   = 5
+	defaultWindowMins = 20
+)
+
+// PrepRates is how fast a campus packs its pickup queue: it starts at Start
+// (HH:MM) on the pickup day and takes PerOrder per order, in confirmation
+// order. Estimates are shown as a Window-wide range.
+type PrepRates struct {
+	Start    string
+	PerOrder time.Duration
+	Window   time.Duration
+}
+
+// LoadPrepRates reads the orders.prep_start, orders.prep_minutes and
+// orders.eta_window_minutes settings, falling back to the defaults for any
+// that are unset.
+func LoadPrepRates(ctx context.Context, db *sql.DB) (PrepRates, error) {
+	rates := PrepRates{
+		Start:    defaultPrepStart,
+		PerOrder: defaultPrepMins * time.Minute,
+		Window:   defaultWindowMins * time.Minute,
+	}
+	values, err := loadSettings(ctx, db, "orders.prep_start", "orders.prep_minutes", "orders.eta_window_minutes")
+	if err != nil {
+		return rates, err
+	}
+	var mins int
+	if v, ok := values["orders.prep_start"]; ok {
+		json.Unmarshal(v, &rates.Start)
+	}
+	if v, ok := values["orders.prep_minutes"]; ok && json.Unmarshal(v, &mins) == nil && mins > 0 {
+		rates.PerOrder = time.Duration(mins) * time.Minute
+	}
+	if v, ok := values["orders.eta_window_minutes"]; ok && json.Unmarshal(v, &mins) == nil && mins > 0 {
+		rates.Window = time.Duration(mins) * time.Minute
+	}
+	return rates, nil
+}
+
+// loadSettings returns the /admin/config values set for keys; unset keys
+// are missing from the map.
+func loadSettings(ctx context.Context, db *sql.DB, keys ...string) (map[string]json.RawMessage, error) {
+	rows, err := db.QueryContext(ctx, `SELECT key, value_json FROM config WHERE key = ANY($1)`, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := make(map[string]json.RawMessage, len(keys))
+	for rows.Next() {
+		var key string
+		var value json.RawMessage
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+// ETA is where a confirmed order stands in its campus's pickup queue for
+// the day, and when it is expected to be ready.
+type ETA struct {
+	OrderID     int       `json:"orderId"`
+	Position    int       `json:"position"`    // 1 is the first order confirmed for the pickup
+	QueueLength int       `json:"queueLength"` // orders for the same pickup, packed and collected ones included
+	ReadyFrom   time.Time `json:"readyFrom"`
+	ReadyBy     time.Time `json:"readyBy"`
+	Message     string    `json:"message"` // e.g. "Your order is #12 of 30 today, expected ready by 18:00–18:20."
+
+	userID int
+	status string
+}
+
+// ETAEvent is the payload of a TopicOrderETA event.
+type ETAEvent struct {
+	UserID int `json:"userId"`
+	ETA
+}
+
+// estimate fills in e's ready window and message from its place in the
+// queue for the pickup at pickup. Orders are never ready before pickup,
+// and a packed one is ready from then.
+func (e *ETA) estimate(pickup time.Time, rates PrepRates, now time.Time) {
+	local := pickup.In(locale.EAT)
+	start := pickup
+	if t, err := time.ParseInLocation("15:04", rates.Start, locale.EAT); err == nil {
+		start = time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, locale.EAT)
+	}
+
+	day := "today"
+	if local.Format("2006-01-02") != now.In(locale.EAT).Format("2006-01-02") {
+		day = "tomorrow"
+	}
+	if e.status == "PACKED" {
+		e.ReadyFrom, e.ReadyBy = pickup, pickup
+		e.Message = fmt.Sprintf("Your order is packed and ready for pickup %s from %s.", day, local.Format("15:04"))
+		return
+	}
+
+	e.ReadyFrom = start.Add(time.Duration(e.Position) * rates.PerOrder)
+	if e.ReadyFrom.Before(pickup) {
+		e.ReadyFrom = pickup
+	}
+	e.ReadyBy = e.ReadyFrom.Add(rates.Window)
+	e.Message = fmt.Sprintf("Your order is #%d of %d %s, expected ready by %s–%s.",
+		e.Position, e.QueueLength, day, e.ReadyFrom.In(locale.EAT).Format("15:04"), e.ReadyBy.In(locale.EAT).Format("15:04"))
+}
+
+// queueETAs returns the ETA of every order still waiting (CONFIRMED or
+// PACKED) in campus's queue for the pickup at pickup.
+func queueETAs(ctx context.Context, db *sql.DB, campus string, pickup time.Time, rates PrepRates) ([]ETA, error) {
+	from, to := PickupConfirmations(pickup)
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, user_id, status, position, total
+		   FROM (SELECT o.id, o.user_id, o.status,
+		                ROW_NUMBER() OVER (ORDER BY h.confirmed_at, o.id) AS position,
+		                COUNT(*) OVER () AS total
+		           FROM orders o
+		           JOIN LATERAL (SELECT MAX(changed_at) AS confirmed_at FROM order_status_history
+		                          WHERE order_id = o.id AND status = 'CONFIRMED') h ON TRUE
+		          WHERE COALESCE(o.campus, $1) = $1
+		            AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		            AND h.confirmed_at >= $2 AND h.confirmed_at < $3) q
+		  WHERE status IN ('CONFIRMED', 'PACKED')
+		  ORDER BY position`,
+		campus, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var etas []ETA
+	for rows.Next() {
+		var e ETA
+		if err := rows.Scan(&e.OrderID, &e.userID, &e.status, &e.Position, &e.QueueLength); err != nil {
+			return nil, err
+		}
+		e.estimate(pickup, rates, now)
+		etas = append(etas, e)
+	}
+	return etas, rows.Err()
+}
+
+// orderQueue returns the campus and pickup time of the queue orderID was
+// confirmed into, or sql.ErrNoRows if it never was.
+func orderQueue(ctx context.Context, db *sql.DB, orderID int) (string, time.Time, error) {
+	var campus string
+	if err := db.QueryRowContext(ctx,
+		`SELECT COALESCE(campus, $2) FROM orders WHERE id = $1`, orderID, DefaultCampus,
+	).Scan(&campus); err != nil {
+		return "", time.Time{}, err
+	}
+	at, err := ConfirmedAt(ctx, db, orderID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return campus, PickupAt(at), nil
+}
+
+// OrderETA returns the ETA of orderID, or nil if it is not waiting for
+// pickup.
+func OrderETA(ctx context.Context, db *sql.DB, orderID int) (*ETA, error) {
+	campus, pickup, err := orderQueue(ctx, db, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rates, err := LoadPrepRates(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	etas, err := queueETAs(ctx, db, campus, pickup, rates)
+	if err != nil {
+		return nil, err
+	}
+	for i := range etas {
+		if etas[i].OrderID == orderID {
+			return &etas[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// SubscribeETAUpdates republishes the ETA of every order in a pickup queue
+// as TopicOrderETA whenever an order joins it, is packed, or drops out, so
+// students watching over the WebSocket see their place move. It joins the
+// "eta" group so each change is recomputed once per deployment.
+func SubscribeETAUpdates(bus events.Bus, db *sql.DB, logger *zap.Logger) (func(), error) {
+	return bus.Subscribe(TopicOrderStatus, "eta", func(ev events.Event) {
+		var se StatusEvent
+		if err := ev.Decode(&se); err != nil {
+			logger.Error("invalid order status event", zap.Error(err))
+			return
+		}
+		if se.Status != "CONFIRMED" && se.Status != "PACKED" && se.Status != "CANCELLED" {
+			return
+		}
+
+		ctx := context.Background()
+		campus, pickup, err := orderQueue(ctx, db, se.OrderID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return // never confirmed, e.g. a cancelled chat draft
+		} else if err != nil {
+			logger.Error("failed to load order queue", zap.Int("order_id", se.OrderID), zap.Error(err))
+			return
+		}
+		rates, err := LoadPrepRates(ctx, db)
+		if err != nil {
+			logger.Error("failed to load prep rates", zap.Error(err))
+			return
+		}
+		etas, err := queueETAs(ctx, db, campus, pickup, rates)
+		if err != nil {
+			logger.Error("failed to compute order ETAs", zap.String("campus", campus), zap.Error(err))
+			return
+		}
+		for _, e := range etas {
+			if err := bus.Publish(ctx, TopicOrderETA, ETAEvent{UserID: e.userID, ETA: e}); err != nil {
+				logger.Error("failed to publish order ETA", zap.Int("order_id", e.OrderID), zap.Error(err))
+			}
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+
+	"server/internal/domain"
+	"server/internal/httpx"
+)
+
+// Off-network policies a campus may set.
+const (
+	OffNetworkTag   = "TAG"   // take the order, flagged off_network
+	OffNetworkBlock = "BLOCK" // refuse it with *OffNetworkError
+)
+
+// OffNetworkError is returned by CheckNetwork when the campus refuses
+// orders from outside its networks.
+type OffNetworkError struct {
+	Campus string
+}
+
+func (e *OffNetworkError) Error() string {
+	return "Orders for " + e.Campus + " can only be placed from the campus network. Connect to campus Wi-Fi, or ask support to verify your delivery address."
+}
+
+// Is makes an off-network order a domain.ErrForbidden.
+func (e *OffNetworkError) Is(target error) bool { return target == domain.ErrForbidden }
+
+// CheckNetwork compares the address the request came from, as found by
+// httpx.RealIP, with the networks of the order's campus. Call it inside the
+// confirming transaction after ReserveCapacity has stamped the campus. An
+// order from elsewhere is flagged off_network, or fails with
+// *OffNetworkError when the campus's policy is OffNetworkBlock. Campuses with
+// no networks, students with a verified delivery address, and requests whose
+// address is unknown are not checked.
+func CheckNetwork(ctx context.Context, tx *sql.Tx, orderID int) error {
+	addr, ok := httpx.ClientIPFrom(ctx)
+	if !ok {
+		return nil
+	}
+
+	var campus, policy string
+	var off bool
+	err := tx.QueryRowContext(ctx,
+		`SELECT c.name, c.off_network_policy, NOT ($2::inet <<= ANY(c.networks))
+		   FROM orders o
+		   JOIN campuses c ON c.name = o.campus
+		   JOIN users u ON u.id = o.user_id
+		  WHERE o.id = $1 AND cardinality(c.networks) > 0 AND u.address_verified_at IS NULL`,
+		orderID, addr.String(),
+	).Scan(&campus, &policy, &off)
+	if err == sql.ErrNoRows || err == nil && !off {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if policy == OffNetworkBlock {
+		return &OffNetworkError{Campus: campus}
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE orders SET off_network = TRUE WHERE id = $1`, orderID)
+	return err
+}
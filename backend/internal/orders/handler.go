@@ -1,8 +1,10 @@
 package orders
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -12,7 +14,17 @@ import (
 	"time"
 
 	"server/internal/auth"
-	"server/internal/email"
+	"server/internal/budget"
+	"server/internal/db"
+	"server/internal/domain"
+	"server/internal/events"
+	"server/internal/httpx"
+	"server/internal/inventory"
+	"server/internal/jobs"
+	"server/internal/ledger"
+	"server/internal/locale"
+	"server/internal/pricing"
+	"server/internal/tax"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
@@ -21,9 +33,39 @@ import (
 // CreateOrderRequest represents the payload to create a new order.
 type CreateOrderRequest struct {
 	Items []struct {
-		ItemID   int `json:"itemId"`
-		Quantity int `json:"quantity"`
-	} `json:"items"`
+		ItemID   int `json:"itemId" validate:"required,min=1"`
+		Quantity int `json:"quantity" validate:"min=1,max=100"`
+	} `json:"items" validate:"required,min=1,max=50"`
+	// ConfirmOverBudget places the order even though it exceeds the
+	// student's weekly budget; it has no effect on a budget in block mode.
+	ConfirmOverBudget bool `json:"confirmOverBudget"`
+	// ConfirmDuplicate places the order even though the student ordered
+	// the same items within the last DuplicateWindow.
+	ConfirmDuplicate bool `json:"confirmDuplicate"`
+	// Note is for the packers and runners, e.g. "ripe bananas please"; at
+	// most MaxNoteLength characters.
+	Note string `json:"note" validate:"max=280"`
+}
+
+// OverBudgetResponse is the 409 body when an order would exceed the
+// student's weekly budget. With OverrideAllowed, resending the order with
+// confirmOverBudget places it.
+type OverBudgetResponse struct {
+	Error           string       `json:"error"` // always "over_budget"
+	Message         string       `json:"message"`
+	OrderTotal      int          `json:"orderTotal"`
+	Budget          budget.Usage `json:"budget"`
+	OverrideAllowed bool         `json:"overrideAllowed"`
+}
+
+// DuplicateOrderResponse is the 409 body when the student ordered the same
+// items within the last DuplicateWindow. Resending the order with
+// confirmDuplicate places it.
+type DuplicateOrderResponse struct {
+	Error           string    `json:"error"` // always "duplicate_order"
+	Message         string    `json:"message"`
+	PreviousOrderID int       `json:"previousOrderId"`
+	PlacedAt        time.Time `json:"placedAt"`
 }
 
 // OrderItemResponse represents an item in the order response.
@@ -33,6 +75,7 @@ type OrderItemResponse struct {
 	Quantity  int    `json:"quantity"`
 	UnitPrice int    `json:"unitPrice"`
 	Subtotal  int    `json:"subtotal"`
+	Tax       int    `json:"tax"` // VAT included in Subtotal
 }
 
 // New struct for order confirmation data:
@@ -54,13 +97,77 @@ type OrderConfirmationData struct {
 // OrderResponse represents the order details sent back to the client.
 type OrderResponse struct {
 	OrderID       int                 `json:"orderId"`
+	ReceiptNumber string              `json:"receiptNumber,omitempty"`
 	Status        string              `json:"status"`
 	Items         []OrderItemResponse `json:"items"`
 	TransportFee  int                 `json:"transportFee"`
+	SmallOrderFee int                 `json:"smallOrderFee"` // below the campus minimum basket
 	TotalCost     int                 `json:"totalCost"`
+	TaxTotal      int                 `json:"taxTotal"` // VAT included in TotalCost
 	CreatedAt     time.Time           `json:"createdAt"`
 	PickupTime    string              `json:"pickupTime"`
 	PickupStation string              `json:"pickupStation"`
+	Note          string              `json:"note,omitempty"`
+	Archived      bool                `json:"archived,omitempty"` // moved to the archive; read-only
+	ETA           *ETA                `json:"eta,omitempty"`      // while waiting for pickup; live updates come as order.eta
+	Display       OrderDisplay        `json:"display"`
+}
+
+// OrderDisplay is an order's amounts and times written the way its campus
+// shows them, for clients to display as they are.
+type OrderDisplay struct {
+	TransportFee  string `json:"transportFee"` // e.g. "UGX 1,000"
+	SmallOrderFee string `json:"smallOrderFee,omitempty"`
+	TotalCost     string `json:"totalCost"`
+	TaxTotal      string `json:"taxTotal,omitempty"`
+	CreatedAt     string `json:"createdAt"` // e.g. "Tue 24 Jun, 14:05 EAT"
+}
+
+// format fills in o's Display in l.
+func (o *OrderResponse) format(l locale.Locale) {
+	o.Display = OrderDisplay{
+		TransportFee: l.Money(o.TransportFee),
+		TotalCost:    l.Money(o.TotalCost),
+		CreatedAt:    l.DateTime(o.CreatedAt),
+	}
+	if o.SmallOrderFee != 0 {
+		o.Display.SmallOrderFee = l.Money(o.SmallOrderFee)
+	}
+	if o.TaxTotal != 0 {
+		o.Display.TaxTotal = l.Money(o.TaxTotal)
+	}
+}
+
+// StatusChange is one entry in an order's status history.
+type StatusChange struct {
+	Status    string    `json:"status"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// PaymentInfo describes the payment state of an order.
+type PaymentInfo struct {
+	Status string      `json:"status"`
+	Method string      `json:"method"`
+	PaidAt *time.Time  `json:"paidAt,omitempty"`
+	Refund *RefundInfo `json:"refund,omitempty"`
+}
+
+// RefundInfo is the customer's view of a refund on a cancelled order.
+type RefundInfo struct {
+	Status   string     `json:"status"`
+	Amount   int        `json:"amount"`
+	Method   string     `json:"method"`
+	IssuedAt *time.Time `json:"issuedAt,omitempty"`
+}
+
+// OrderDetailResponse is the full view of a single order.
+type OrderDetailResponse struct {
+	OrderResponse
+	StatusHistory []StatusChange `json:"statusHistory"`
+	Payment       PaymentInfo    `json:"payment"`
+	// Unfulfilled are lines dropped after confirmation because the shop did
+	// not have them; they are not in Items or the totals
+	Unfulfilled []UnfulfilledItem `json:"unfulfilled,omitempty"`
 }
 
 // Global template variables:
@@ -73,25 +180,124 @@ var (
 	orderConfirmTextTmpl *texttemplate.Template
 )
 
-// MakeOrdersHandler now accepts mailer but will not pass orders package types into email.
+// MakeOrdersHandler routes /orders, /orders/{id}, the pickup calendar at
+// /orders/{id}/calendar.ics, confirmation resends, and order notes by method
+// and path.
+// Listing and lookups read from the replica; changes go to the primary.
 func MakeOrdersHandler(
-	db *sql.DB,
+	cluster *db.Cluster,
 	logger *zap.Logger,
 	meter *prometheus.CounterVec,
-	mailer *email.Client, // use only SendMail on plain strings
-) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodPost:
-			handleCreateOrder(w, r, db, logger, meter, mailer)
-		case http.MethodGet:
-			handleListOrders(w, r, db, logger)
-		case http.MethodDelete:
-			handleCancelOrder(w, r, db, logger, mailer)
-		default:
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	bus events.Bus,
+	queue *jobs.Queue,
+) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /orders", func(w http.ResponseWriter, r *http.Request) {
+		handleCreateOrder(w, r, cluster.Primary, logger, meter, bus)
+	})
+	mux.HandleFunc("GET /orders", func(w http.ResponseWriter, r *http.Request) {
+		handleListOrders(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("GET /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleGetOrder(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("GET /orders/{id}/calendar.ics", func(w http.ResponseWriter, r *http.Request) {
+		handleOrderCalendar(w, r, cluster.Reader(r.Context()), logger)
+	})
+	mux.HandleFunc("DELETE /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handleCancelOrder(w, r, cluster.Primary, logger, bus)
+	})
+	mux.HandleFunc("POST /orders/{id}/resend-confirmation", func(w http.ResponseWriter, r *http.Request) {
+		handleResendConfirmation(w, r, cluster.Primary, logger, queue)
+	})
+	mux.HandleFunc("PUT /orders/{id}/note", func(w http.ResponseWriter, r *http.Request) {
+		handleSetNote(w, r, cluster.Primary, logger)
+	})
+
+	return mux
+}
+
+// TopicOrderStatus is published after every committed order status change.
+const TopicOrderStatus = "order.status"
+
+// StatusEvent is the payload of a TopicOrderStatus event.
+type StatusEvent struct {
+	UserID    int       `json:"userId"`
+	OrderID   int       `json:"orderId"`
+	Status    string    `json:"status"`
+	Silent    bool      `json:"silent,omitempty"` // skip customer email, e.g. a superseded chat draft
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// transitions lists the statuses an order may move to from each status.
+var transitions = map[string][]string{
+	"PENDING":   {"CONFIRMED", "CANCELLED"},
+	"CONFIRMED": {"PACKED", "FULFILLED", "CANCELLED"},
+	"PACKED":    {"FULFILLED", "CANCELLED"},
+}
+
+// CanTransition reports whether an order in status from may move to status to.
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
 		}
 	}
+	return false
+}
+
+// publishTimeout bounds announcing a committed status change.
+const publishTimeout = 5 * time.Second
+
+// PublishStatus announces a status change on the bus. Call it only after the
+// change has been committed. Failures are logged, not returned: the change
+// itself has already happened. It does not stop when ctx is cancelled, so a
+// student closing the page right after ordering still gets the email.
+func PublishStatus(ctx context.Context, bus events.Bus, logger *zap.Logger, ev StatusEvent) {
+	if ev.ChangedAt.IsZero() {
+		ev.ChangedAt = time.Now()
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTimeout)
+	defer cancel()
+	if err := bus.Publish(ctx, TopicOrderStatus, ev); err != nil {
+		logger.Error("failed to publish order status", zap.Int("order_id", ev.OrderID), zap.Error(err))
+	}
+}
+
+// ErrConflict means the order changed between being read and being updated.
+var ErrConflict = domain.Conflict("order was changed by another request, please retry")
+
+// UpdateStatus moves an order to status if it is still at the version the
+// caller read, and bumps the version. It returns ErrConflict when another
+// request changed the order first.
+func UpdateStatus(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, orderID, version int, status string) error {
+	res, err := db.ExecContext(ctx,
+		`UPDATE orders SET status=$1, version=version+1 WHERE id=$2 AND version=$3`,
+		status, orderID, version,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// RecordStatusChange appends a status transition to the order's history.
+// It accepts either a *sql.DB or a *sql.Tx so callers can keep it inside
+// the same transaction as the status update.
+func RecordStatusChange(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, orderID int, status string) error {
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO order_status_history (order_id, status) VALUES ($1, $2)`,
+		orderID, status,
+	)
+	return err
 }
 
 // handleCreateOrder processes a new order from a student.
@@ -101,71 +307,104 @@ func handleCreateOrder(
 	db *sql.DB,
 	logger *zap.Logger,
 	meter *prometheus.CounterVec,
-	mailer *email.Client,
+	bus events.Bus,
 ) {
 	ctx := r.Context()
 	uidVal := ctx.Value(auth.ContextUserIDKey)
 	userID, _ := uidVal.(int)
 
 	var req CreateOrderRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON payload", http.StatusBadRequest)
+	if !httpx.DecodeJSON(w, r, &req) {
 		return
 	}
-	defer r.Body.Close()
-
-	if len(req.Items) == 0 {
-		http.Error(w, "order must contain at least one item", http.StatusBadRequest)
+	note, err := CleanNote(req.Note)
+	if err != nil {
+		httpx.WriteError(w, err)
 		return
 	}
 
-	// 1. Compute transportFee by counting today's confirmed orders
-	today := time.Now().Truncate(24 * time.Hour)
-	var count int
-	if err := db.QueryRowContext(ctx,
-		`SELECT COUNT(*) FROM orders WHERE user_id=$1 AND created_at >= $2`, userID, today,
-	).Scan(&count); err != nil {
-		logger.Error("failed to count orders", zap.Error(err))
+	// 1. Begin transaction
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("failed to begin transaction", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	transportFee := calculateTransportFee(count + 1)
+	defer tx.Rollback()
 
-	// 2. Begin transaction
-	tx, err := db.BeginTx(ctx, nil)
+	// 2. Count today's confirmed orders for the fee tier, under the
+	// per-user daily lock so concurrent orders get consecutive tiers
+	confirmedToday, err := ConfirmedToday(ctx, tx, userID)
 	if err != nil {
-		logger.Error("failed to begin transaction", zap.Error(err))
+		logger.Error("failed to count orders", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	defer tx.Rollback()
 
-	// 3. Insert into orders table
+	// 3. Insert into orders table; totals are filled in once priced
 	status := "CONFIRMED"
-	totalCost := transportFee
 	var orderID int
 	if err := tx.QueryRowContext(ctx,
-		`INSERT INTO orders (user_id, status, transport_fee, total_cost)
-         VALUES ($1, $2, $3, $4) RETURNING id`,
-		userID, status, transportFee, totalCost,
+		`INSERT INTO orders (user_id, status, transport_fee, total_cost, note)
+         VALUES ($1, $2, 0, 0, $3) RETURNING id`,
+		userID, status, note,
 	).Scan(&orderID); err != nil {
 		logger.Error("failed to insert order", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	if err := RecordStatusChange(ctx, tx, orderID, status); err != nil {
+		logger.Error("failed to record order status", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 
-	// 4. For each requested item, fetch price, insert order_items, accumulate subtotal
-	var itemsResponse []OrderItemResponse
+	// The campus may already have taken all the orders it can fulfil today
+	if err := ReserveCapacity(ctx, tx, orderID); err != nil {
+		switch httpx.WriteError(w, err) {
+		case http.StatusTooManyRequests:
+			meter.WithLabelValues("capacity_full").Inc()
+		case http.StatusInternalServerError:
+			logger.Error("failed to check order capacity", zap.Error(err))
+		}
+		return
+	}
+
+	// Some campuses only take orders from their own network
+	if err := CheckNetwork(ctx, tx, orderID); err != nil {
+		switch httpx.WriteError(w, err) {
+		case http.StatusForbidden:
+			meter.WithLabelValues("off_network").Inc()
+		case http.StatusInternalServerError:
+			logger.Error("failed to check order network", zap.Error(err))
+		}
+		return
+	}
+
+	// 4. Fetch each requested item's price and tax rate, price the order,
+	// and insert the priced lines
+	smallOrder, err := SmallOrderRuleFor(ctx, tx, orderID)
+	if err != nil {
+		logger.Error("failed to fetch minimum order", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	group, err := pricing.GroupFor(ctx, tx, userID)
+	if err != nil {
+		logger.Error("failed to fetch pricing group", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	order := pricing.Order{ConfirmedToday: confirmedToday, SmallOrder: smallOrder, Group: group}
+	names := make([]string, 0, len(req.Items))
 	for _, it := range req.Items {
-		var (
-			name      string
-			unitPrice int
-		)
-		// Only available items
+		line := pricing.Line{ItemID: it.ItemID, Quantity: it.Quantity}
+		var name string
+		// Only available items, at any scheduled price in force
 		err := tx.QueryRowContext(ctx,
-			`SELECT name, price_ugx FROM items WHERE id=$1 AND available = TRUE`,
+			`SELECT name, item_price(id, NOW()) FROM items WHERE id=$1 AND available = TRUE`,
 			it.ItemID,
-		).Scan(&name, &unitPrice)
+		).Scan(&name, &line.UnitPrice)
 		if err == sql.ErrNoRows {
 			http.Error(w, fmt.Sprintf("item %d not available", it.ItemID), http.StatusBadRequest)
 			return
@@ -174,14 +413,48 @@ func handleCreateOrder(
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
-		subtotal := unitPrice * it.Quantity
-		totalCost += subtotal
+		if line.TaxRateBps, err = tax.RateForItem(ctx, tx, it.ItemID); err != nil {
+			logger.Error("failed to fetch tax rate", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		order.Lines = append(order.Lines, line)
+		names = append(names, name)
+	}
+	quote := pricing.Quote(order)
+
+	var small *pricing.BelowMinimumError
+	if err := smallOrder.Check(quote); errors.As(err, &small) {
+		meter.WithLabelValues("below_minimum").Inc()
+		http.Error(w, small.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	var over *budget.ExceededError
+	if err := budget.Check(ctx, tx, userID, orderID, quote.Total, req.ConfirmOverBudget); errors.As(err, &over) {
+		meter.WithLabelValues("over_budget").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(OverBudgetResponse{
+			Error:           "over_budget",
+			Message:         over.Error(),
+			OrderTotal:      over.OrderTotal,
+			Budget:          over.Usage,
+			OverrideAllowed: over.CanOverride(),
+		})
+		return
+	} else if err != nil {
+		logger.Error("failed to check weekly budget", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
 
-		// Insert into order_items
+	var itemsResponse []OrderItemResponse
+	for i, l := range quote.Lines {
 		if _, err := tx.ExecContext(ctx,
-			`INSERT INTO order_items (order_id, item_id, quantity, unit_price)
-             VALUES ($1, $2, $3, $4)`,
-			orderID, it.ItemID, it.Quantity, unitPrice,
+			`INSERT INTO order_items (order_id, item_id, quantity, unit_price, tax_rate_bps, tax_amount)
+             VALUES ($1, $2, $3, $4, $5, $6)`,
+			orderID, l.ItemID, l.Quantity, l.UnitPrice, l.TaxRateBps, l.Tax,
 		); err != nil {
 			logger.Error("failed to insert order_item", zap.Error(err))
 			http.Error(w, "internal error", http.StatusInternalServerError)
@@ -189,89 +462,90 @@ func handleCreateOrder(
 		}
 
 		itemsResponse = append(itemsResponse, OrderItemResponse{
-			ItemID:    it.ItemID,
-			Name:      name,
-			Quantity:  it.Quantity,
-			UnitPrice: unitPrice,
-			Subtotal:  subtotal,
+			ItemID:    l.ItemID,
+			Name:      names[i],
+			Quantity:  l.Quantity,
+			UnitPrice: l.UnitPrice,
+			Subtotal:  l.Subtotal,
+			Tax:       l.Tax,
 		})
 	}
 
-	// 5. Update the total_cost in orders row
+	// The same items again within the hour is usually a double submit
+	var dup *DuplicateError
+	if err := CheckDuplicate(ctx, tx, userID, orderID, req.ConfirmDuplicate); errors.As(err, &dup) {
+		meter.WithLabelValues("duplicate_order").Inc()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(DuplicateOrderResponse{
+			Error:           "duplicate_order",
+			Message:         dup.Error() + " Place it again?",
+			PreviousOrderID: dup.PreviousOrderID,
+			PlacedAt:        dup.PlacedAt,
+		})
+		return
+	} else if err != nil {
+		logger.Error("failed to check for duplicate order", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Take the items out of stock; a sell-out mid-order rolls everything back
+	if err := inventory.Reserve(ctx, tx, orderID); err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to reserve stock", zap.Error(err))
+		}
+		return
+	}
+
+	// 5. Store the fee and totals in the orders row
 	if _, err := tx.ExecContext(ctx,
-		`UPDATE orders SET total_cost=$1 WHERE id=$2`, totalCost, orderID,
+		`UPDATE orders SET transport_fee=$1, small_order_fee=$2, total_cost=$3, tax_total=$4, transport_fee_waived=$5 WHERE id=$6`,
+		quote.TransportFee, quote.SmallOrderFee, quote.Total, quote.TaxTotal, group.WaiveTransportFee, orderID,
 	); err != nil {
 		logger.Error("failed to update total cost", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	// 6. Commit transaction
+	// 6. Assign a receipt number and book the charges
+	receipt, err := ledger.RecordConfirmation(ctx, tx, orderID)
+	if err != nil {
+		logger.Error("failed to record ledger entries", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// 7. Commit transaction
 	if err := tx.Commit(); err != nil {
 		logger.Error("transaction commit failed", zap.Error(err))
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-
-	// 7. Send confirmation email asynchronously using the template helper
-	// (a) Lookup user's email and username
-	go func() {
-		var userEmail, username string
-		const qUser = `SELECT email, username FROM users WHERE id=$1`
-		if err := db.QueryRowContext(ctx, qUser, userID).Scan(&userEmail, &username); err != nil {
-			logger.Error("failed to lookup user email/username", zap.Error(err))
-			return
-		}
-
-		// (b) Build the data for the template - Fix the struct field assignment
-		tmplItems := make([]struct {
-			Name      string
-			Quantity  int
-			UnitPrice int
-			Subtotal  int
-		}, len(itemsResponse))
-
-		for i, it := range itemsResponse {
-			tmplItems[i] = struct {
-				Name      string
-				Quantity  int
-				UnitPrice int
-				Subtotal  int
-			}{
-				Name:      it.Name,
-				Quantity:  it.Quantity,
-				UnitPrice: it.UnitPrice,
-				Subtotal:  it.Subtotal,
-			}
-		}
-
-		data := email.OrderConfirmationData{
-			Username:      username,
-			OrderID:       orderID,
-			Items:         tmplItems,
-			TransportFee:  transportFee,
-			TotalCost:     totalCost,
-			PickupTime:    "18:00",
-			PickupStation: "F2 17",
-		}
-
-		// (c) Send the templated email
-		if err := mailer.SendOrderConfirmationEmail(userEmail, data); err != nil {
-			logger.Error("failed to send order confirmation email", zap.Error(err))
-		}
-	}()
+	PublishStatus(ctx, bus, logger, StatusEvent{UserID: userID, OrderID: orderID, Status: status})
 
 	// 8. Build HTTP response
 	resp := OrderResponse{
 		OrderID:       orderID,
+		ReceiptNumber: receipt,
 		Status:        status,
 		Items:         itemsResponse,
-		TransportFee:  transportFee,
-		TotalCost:     totalCost,
+		TransportFee:  quote.TransportFee,
+		SmallOrderFee: quote.SmallOrderFee,
+		TotalCost:     quote.Total,
+		TaxTotal:      quote.TaxTotal,
 		CreatedAt:     time.Now(),
-		PickupTime:    "18:00",
-		PickupStation: "F2 17",
+		PickupTime:    PickupTime,
+		PickupStation: PickupStationFor(ctx, db, userID),
+	}
+	if resp.ETA, err = OrderETA(ctx, db, orderID); err != nil {
+		logger.Warn("failed to estimate order ETA", zap.Int("order_id", orderID), zap.Error(err))
 	}
+	loc, err := locale.ForOrder(ctx, db, orderID)
+	if err != nil {
+		logger.Warn("failed to load campus locale", zap.Int("order_id", orderID), zap.Error(err))
+	}
+	resp.format(loc)
 
 	meter.WithLabelValues("orders_created").Inc()
 	w.Header().Set("Content-Type", "application/json")
@@ -279,19 +553,100 @@ func handleCreateOrder(
 	json.NewEncoder(w).Encode(resp)
 }
 
-// calculateTransportFee applies the tier logic.
-func calculateTransportFee(orderCountToday int) int {
-	switch {
-	case orderCountToday <= 3:
-		return 1000
-	case orderCountToday <= 6:
-		return 2000
-	default:
-		return 3000 // you can extend tiers as needed
+// ConfirmedToday counts the user's orders confirmed so far today, which sets
+// the transport fee tier of their next one. It takes a transaction-scoped
+// advisory lock on (user, day) first, so callers must confirm the order in
+// the same tx to keep the count accurate for whoever is waiting on the lock.
+func ConfirmedToday(ctx context.Context, tx *sql.Tx, userID int) (int, error) {
+	today := time.Now().Truncate(24 * time.Hour)
+	if err := lockUserDay(ctx, tx, userID, today); err != nil {
+		return 0, err
 	}
+
+	var count int
+	err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*)
+		   FROM orders o
+		   JOIN order_status_history h ON h.order_id = o.id AND h.status = 'CONFIRMED'
+		  WHERE o.user_id = $1
+		    AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		    AND h.changed_at >= $2`,
+		userID, today,
+	).Scan(&count)
+	return count, err
+}
+
+// lockUserDay takes the transaction-scoped advisory lock that serialises fee
+// tiers for the user on the UTC day starting at day.
+func lockUserDay(ctx context.Context, tx *sql.Tx, userID int, day time.Time) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, $2)`, int32(userID), int32(day.Unix()/86400))
+	return err
+}
+
+// PriceOrder quotes a stored order's lines as the user's next confirmation
+// after confirmedToday others and writes the fees and totals back to it.
+// Lines are repriced at the current price for the user's group, so a draft
+// made during a sale that has since ended pays the regular price, and the
+// other way round.
+// An order below a minimum its campus refuses fails with
+// *pricing.BelowMinimumError.
+func PriceOrder(ctx context.Context, tx *sql.Tx, orderID, confirmedToday int) (pricing.Breakdown, error) {
+	smallOrder, err := SmallOrderRuleFor(ctx, tx, orderID)
+	if err != nil {
+		return pricing.Breakdown{}, err
+	}
+	var userID int
+	if err := tx.QueryRowContext(ctx, `SELECT user_id FROM orders WHERE id = $1`, orderID).Scan(&userID); err != nil {
+		return pricing.Breakdown{}, err
+	}
+	group, err := pricing.GroupFor(ctx, tx, userID)
+	if err != nil {
+		return pricing.Breakdown{}, err
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, item_id, quantity, item_price(item_id, NOW()), tax_rate_bps
+		   FROM order_items WHERE order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return pricing.Breakdown{}, err
+	}
+	order := pricing.Order{ConfirmedToday: confirmedToday, SmallOrder: smallOrder, Group: group}
+	var lineIDs []int
+	for rows.Next() {
+		var id int
+		var l pricing.Line
+		if err := rows.Scan(&id, &l.ItemID, &l.Quantity, &l.UnitPrice, &l.TaxRateBps); err != nil {
+			rows.Close()
+			return pricing.Breakdown{}, err
+		}
+		order.Lines = append(order.Lines, l)
+		lineIDs = append(lineIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return pricing.Breakdown{}, err
+	}
+
+	quote := pricing.Quote(order)
+	if err := smallOrder.Check(quote); err != nil {
+		return quote, err
+	}
+	for i, l := range quote.Lines {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE order_items SET unit_price = $1, tax_amount = $2 WHERE id = $3`,
+			l.UnitPrice, l.Tax, lineIDs[i],
+		); err != nil {
+			return pricing.Breakdown{}, err
+		}
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE orders SET transport_fee = $1, small_order_fee = $2, total_cost = $3, tax_total = $4, transport_fee_waived = $5
+		  WHERE id = $6`,
+		quote.TransportFee, quote.SmallOrderFee, quote.Total, quote.TaxTotal, group.WaiveTransportFee, orderID)
+	return quote, err
 }
 
 // handleListOrders returns orders for the authenticated user, with filtering.
+// It reads all_orders, so the history includes archived orders.
 func handleListOrders(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
 	ctx := r.Context()
 	uidVal := ctx.Value(auth.ContextUserIDKey)
@@ -300,8 +655,7 @@ func handleListOrders(w http.ResponseWriter, r *http.Request, db *sql.DB, logger
 	// Query params: status (optional), date (optional: YYYY-MM-DD), page, limit
 	q := r.URL.Query().Get("status")
 	dateStr := r.URL.Query().Get("date")
-	pageStr := r.URL.Query().Get("page")
-	limitStr := r.URL.Query().Get("limit")
+	page := httpx.ParsePage(r)
 
 	// Defaults
 	var filters []string
@@ -327,23 +681,26 @@ func handleListOrders(w http.ResponseWriter, r *http.Request, db *sql.DB, logger
 			argIdx += 2
 		}
 	}
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
-	}
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit < 1 || limit > 100 {
-		limit = 20
-	}
-	offset := (page - 1) * limit
 
 	// Build query
 	whereClause := "WHERE " + strings.Join(filters, " AND ")
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM all_orders "+whereClause, args...).Scan(&total); err != nil {
+		logger.Error("database count error", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodHead {
+		httpx.WriteTotalCount(w, total)
+		return
+	}
+
 	query := fmt.Sprintf(
-		`SELECT id, status, transport_fee, total_cost, created_at FROM orders %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d`,
+		`SELECT id, status, transport_fee, small_order_fee, total_cost, tax_total, created_at, note, archived FROM all_orders %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d`,
 		whereClause, argIdx, argIdx+1,
 	)
-	args = append(args, limit, offset)
+	args = append(args, page.Limit, page.Offset())
 
 	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -353,44 +710,33 @@ func handleListOrders(w http.ResponseWriter, r *http.Request, db *sql.DB, logger
 	}
 	defer rows.Close()
 
+	station := PickupStationFor(ctx, db, userID)
+	loc, err := locale.ForUser(ctx, db, userID)
+	if err != nil {
+		logger.Warn("failed to load campus locale", zap.Int("user_id", userID), zap.Error(err))
+	}
 	var results []OrderResponse
 	for rows.Next() {
 		var o OrderResponse
 		var createdAt time.Time
-		if err := rows.Scan(&o.OrderID, &o.Status, &o.TransportFee, &o.TotalCost, &createdAt); err != nil {
+		if err := rows.Scan(&o.OrderID, &o.Status, &o.TransportFee, &o.SmallOrderFee, &o.TotalCost, &o.TaxTotal, &createdAt, &o.Note, &o.Archived); err != nil {
 			logger.Error("row scan error", zap.Error(err))
 			http.Error(w, "row scan error", http.StatusInternalServerError)
 			return
 		}
 		o.CreatedAt = createdAt
-		o.PickupTime = "18:00"
-		o.PickupStation = "F2 17"
+		o.PickupTime = PickupTime
+		o.PickupStation = station
 
 		// Fetch items for this order
-		itemRows, err := db.QueryContext(ctx,
-			`SELECT oi.item_id, i.name, oi.quantity, oi.unit_price FROM order_items oi JOIN items i ON oi.item_id=i.id WHERE oi.order_id=$1`, o.OrderID)
+		items, err := loadOrderItems(ctx, db, o.OrderID)
 		if err != nil {
 			logger.Error("failed to fetch order items", zap.Error(err))
 			http.Error(w, "failed to fetch order items", http.StatusInternalServerError)
 			return
 		}
-		defer itemRows.Close()
-
-		var items []OrderItemResponse
-		for itemRows.Next() {
-			var it OrderItemResponse
-			var quantity, unitPrice int
-			if err := itemRows.Scan(&it.ItemID, &it.Name, &quantity, &unitPrice); err != nil {
-				logger.Error("order_item scan error", zap.Error(err))
-				http.Error(w, "order_item scan error", http.StatusInternalServerError)
-				return
-			}
-			it.Quantity = quantity
-			it.UnitPrice = unitPrice
-			it.Subtotal = quantity * unitPrice
-			items = append(items, it)
-		}
 		o.Items = items
+		o.format(loc)
 		results = append(results, o)
 	}
 	if err := rows.Err(); err != nil {
@@ -399,22 +745,146 @@ func handleListOrders(w http.ResponseWriter, r *http.Request, db *sql.DB, logger
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	httpx.WritePage(w, page, total, results)
 }
 
-// handleCancelOrder cancels an existing order if within allowed time.
-func handleCancelOrder(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, mailer *email.Client) {
+// handleGetOrder returns a single order owned by the authenticated user,
+// including its items, status history, payment state, and pickup info.
+func handleGetOrder(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
 	ctx := r.Context()
 	uidVal := ctx.Value(auth.ContextUserIDKey)
 	userID, _ := uidVal.(int)
 
-	idStr := r.URL.Query().Get("id")
-	if idStr == "" {
-		http.Error(w, "order id is required", http.StatusBadRequest)
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		o       OrderDetailResponse
+		ownerID int
+		paidAt  sql.NullTime
+	)
+	if err := db.QueryRowContext(ctx,
+		`SELECT user_id, id, COALESCE(receipt_number, ''), status, transport_fee, small_order_fee, total_cost, tax_total, created_at, payment_status, paid_at, note, archived
+		   FROM all_orders WHERE id=$1`,
+		orderID,
+	).Scan(&ownerID, &o.OrderID, &o.ReceiptNumber, &o.Status, &o.TransportFee, &o.SmallOrderFee, &o.TotalCost, &o.TaxTotal, &o.CreatedAt,
+		&o.Payment.Status, &paidAt, &o.Note, &o.Archived); err == sql.ErrNoRows {
+		httpx.WriteError(w, domain.NotFound("order not found"))
+		return
+	} else if err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if ownerID != userID {
+		httpx.WriteError(w, domain.Forbidden("not authorized"))
+		return
+	}
+	o.PickupTime = PickupTime
+	o.PickupStation = PickupStationFor(ctx, db, userID)
+	loc, err := locale.ForOrder(ctx, db, orderID)
+	if err != nil {
+		logger.Warn("failed to load campus locale", zap.Int("order_id", orderID), zap.Error(err))
+	}
+	o.format(loc)
+	o.Payment.Method = "CASH_ON_PICKUP"
+	if paidAt.Valid {
+		o.Payment.PaidAt = &paidAt.Time
+	}
+
+	if o.Items, err = loadOrderItems(ctx, db, orderID); err != nil {
+		logger.Error("failed to fetch order items", zap.Error(err))
+		http.Error(w, "failed to fetch order items", http.StatusInternalServerError)
+		return
+	}
+
+	if o.Unfulfilled, err = loadUnfulfilled(ctx, db, orderID); err != nil {
+		logger.Error("failed to fetch unfulfilled items", zap.Error(err))
+		http.Error(w, "failed to fetch order items", http.StatusInternalServerError)
+		return
+	}
+
+	if !o.Archived {
+		if o.ETA, err = OrderETA(ctx, db, orderID); err != nil {
+			logger.Error("failed to estimate order ETA", zap.Error(err))
+			http.Error(w, "failed to estimate order ETA", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var refund RefundInfo
+	if err := db.QueryRowContext(ctx,
+		`SELECT status, amount, method, issued_at FROM refunds WHERE order_id=$1 AND NOT partial`, orderID,
+	).Scan(&refund.Status, &refund.Amount, &refund.Method, &refund.IssuedAt); err == nil {
+		o.Payment.Refund = &refund
+	} else if err != sql.ErrNoRows {
+		logger.Error("failed to fetch refund", zap.Error(err))
+		http.Error(w, "failed to fetch refund", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT status, changed_at FROM all_order_status_history WHERE order_id=$1 ORDER BY changed_at, id`,
+		orderID,
+	)
+	if err != nil {
+		logger.Error("failed to fetch status history", zap.Error(err))
+		http.Error(w, "failed to fetch status history", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	o.StatusHistory = []StatusChange{}
+	for rows.Next() {
+		var sc StatusChange
+		if err := rows.Scan(&sc.Status, &sc.ChangedAt); err != nil {
+			logger.Error("status history scan error", zap.Error(err))
+			http.Error(w, "status history scan error", http.StatusInternalServerError)
+			return
+		}
+		o.StatusHistory = append(o.StatusHistory, sc)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("status history iteration error", zap.Error(err))
+		http.Error(w, "status history iteration error", http.StatusInternalServerError)
 		return
 	}
-	orderID, err := strconv.Atoi(idStr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o)
+}
+
+// loadOrderItems fetches the line items of a single order, live or archived.
+func loadOrderItems(ctx context.Context, db *sql.DB, orderID int) ([]OrderItemResponse, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT oi.item_id, i.name, oi.quantity, oi.unit_price, oi.tax_amount FROM all_order_items oi JOIN items i ON oi.item_id=i.id WHERE oi.order_id=$1`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []OrderItemResponse
+	for rows.Next() {
+		var it OrderItemResponse
+		if err := rows.Scan(&it.ItemID, &it.Name, &it.Quantity, &it.UnitPrice, &it.Tax); err != nil {
+			return nil, err
+		}
+		it.Subtotal = it.Quantity * it.UnitPrice
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// handleCancelOrder cancels an existing order if within allowed time.
+func handleCancelOrder(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
+	ctx := r.Context()
+	uidVal := ctx.Value(auth.ContextUserIDKey)
+	userID, _ := uidVal.(int)
+
+	orderID, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "invalid order id", http.StatusBadRequest)
 		return
@@ -424,13 +894,14 @@ func handleCancelOrder(w http.ResponseWriter, r *http.Request, db *sql.DB, logge
 	var (
 		ownerID   int
 		status    string
+		version   int
 		createdAt time.Time
 	)
 	if err := db.QueryRowContext(ctx,
-		`SELECT user_id, status, created_at FROM orders WHERE id=$1`,
+		`SELECT user_id, status, version, created_at FROM orders WHERE id=$1`,
 		orderID,
-	).Scan(&ownerID, &status, &createdAt); err == sql.ErrNoRows {
-		http.Error(w, "order not found", http.StatusNotFound)
+	).Scan(&ownerID, &status, &version, &createdAt); err == sql.ErrNoRows {
+		httpx.WriteError(w, domain.NotFound("order not found"))
 		return
 	} else if err != nil {
 		logger.Error("database error", zap.Error(err))
@@ -438,49 +909,64 @@ func handleCancelOrder(w http.ResponseWriter, r *http.Request, db *sql.DB, logge
 		return
 	}
 	if ownerID != userID {
-		http.Error(w, "not authorized", http.StatusForbidden)
+		httpx.WriteError(w, domain.Forbidden("not authorized"))
 		return
 	}
-	if status != "PENDING" && status != "CONFIRMED" {
+	if !CanTransition(status, "CANCELLED") {
 		http.Error(w, "order cannot be cancelled", http.StatusBadRequest)
 		return
 	}
 	now := time.Now()
-	cutoff := time.Date(now.Year(), now.Month(), now.Day(), 17, 0, 0, 0, now.Location())
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), cutoffHour, 0, 0, 0, now.Location())
 	if now.After(cutoff) {
-		http.Error(w, "cancellation window closed", http.StatusForbidden)
+		httpx.WriteError(w, domain.Forbidden("cancellation window closed"))
 		return
 	}
 
-	// Update status to CANCELLED
-	if _, err := db.ExecContext(ctx,
-		`UPDATE orders SET status='CANCELLED' WHERE id=$1`, orderID,
-	); err != nil {
-		logger.Error("failed to cancel order", zap.Error(err))
+	// Update status to CANCELLED and reverse any booked charges
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("failed to begin transaction", zap.Error(err))
 		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	go func() {
-		// (a) Lookup user’s email and username
-		var userEmail, username string
-		const qUser = `SELECT email, username FROM users WHERE id=$1`
-		if err := db.QueryRowContext(ctx, qUser, userID).Scan(&userEmail, &username); err != nil {
-			logger.Error("failed to lookup user email/username", zap.Error(err))
-			return
-		}
-
-		// (b) Build the data for the template
-		data := email.OrderCancellationData{
-			Username: username,
-			OrderID:  orderID,
-		}
-
-		// (c) Send the templated cancellation email
-		if err := mailer.SendOrderCancellationEmail(userEmail, data); err != nil {
-			logger.Error("failed to send cancellation email", zap.Error(err))
+	if err := UpdateStatus(ctx, tx, orderID, version, "CANCELLED"); err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to cancel order", zap.Error(err))
 		}
-	}()
+		return
+	}
+	if err := RecordStatusChange(ctx, tx, orderID, "CANCELLED"); err != nil {
+		logger.Error("failed to record order status", zap.Error(err))
+		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
+		return
+	}
+	if err := ledger.RecordCancellation(ctx, tx, orderID); err != nil {
+		logger.Error("failed to record ledger entries", zap.Error(err))
+		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
+		return
+	}
+	if err := inventory.Release(ctx, tx, orderID); err != nil {
+		logger.Error("failed to release stock", zap.Error(err))
+		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
+		return
+	}
+	// Later orders that day move down a fee tier
+	repriced, err := RetierAfterCancel(ctx, tx, userID, orderID)
+	if err != nil {
+		logger.Error("failed to re-tier transport fees", zap.Error(err))
+		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("transaction commit failed", zap.Error(err))
+		http.Error(w, "failed to cancel order", http.StatusInternalServerError)
+		return
+	}
+	PublishStatus(ctx, bus, logger, StatusEvent{UserID: userID, OrderID: orderID, Status: "CANCELLED"})
+	PublishRepriced(ctx, bus, logger, repriced)
 
 	w.WriteHeader(http.StatusNoContent)
 }
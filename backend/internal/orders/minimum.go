@@ -0,0 +1,29 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+
+	"server/internal/pricing"
+)
+
+// SmallOrderRuleFor returns the minimum basket of the campus the order is
+// for: the one stamped on it at confirmation, or its student's while it is
+// still a draft.
+func SmallOrderRuleFor(ctx context.Context, db interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, orderID int) (pricing.SmallOrderRule, error) {
+	var minimum, fee sql.NullInt64
+	err := db.QueryRowContext(ctx,
+		`SELECT c.min_order_ugx, c.small_order_fee_ugx
+		   FROM orders o
+		   JOIN users u ON u.id = o.user_id
+		   JOIN campuses c ON c.name = COALESCE(o.campus, u.campus)
+		  WHERE o.id = $1`,
+		orderID,
+	).Scan(&minimum, &fee)
+	if err != nil || !minimum.Valid {
+		return pricing.SmallOrderRule{}, err
+	}
+	return pricing.SmallOrderRule{Minimum: int(minimum.Int64), Fee: int(fee.Int64), Refuse: !fee.Valid}, nil
+}
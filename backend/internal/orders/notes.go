@@ -0,0 +1,123 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// MaxNoteLength caps an order note, in characters. The orders table checks
+// it too.
+const MaxNoteLength = 280
+
+// ErrNoteTooLong is returned for a note over MaxNoteLength once cleaned.
+var ErrNoteTooLong = domain.Invalid("note", fmt.Sprintf("must have at most %d characters", MaxNoteLength))
+
+// ErrNoteLocked is returned when the order has gone to packing, after which
+// its note no longer reaches anyone.
+var ErrNoteLocked = domain.Conflict("this order is already packed, so its note can no longer change")
+
+// NoteRequest is the body of PUT /orders/{id}/note. An empty note removes
+// it.
+type NoteRequest struct {
+	Note string `json:"note" validate:"max=280"`
+}
+
+// NoteResponse is the order's note as stored.
+type NoteResponse struct {
+	OrderID int    `json:"orderId"`
+	Note    string `json:"note"`
+}
+
+// CleanNote makes a student's note fit to store and show to staff: control
+// and invisible formatting characters are dropped, runs of whitespace
+// (newlines included) become one space, and it must then be at most
+// MaxNoteLength characters.
+func CleanNote(note string) (string, error) {
+	var b strings.Builder
+	space := false
+	for _, r := range note {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r), r == unicode.ReplacementChar:
+		default:
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+		}
+	}
+	cleaned := b.String()
+	if len([]rune(cleaned)) > MaxNoteLength {
+		return "", ErrNoteTooLong
+	}
+	return cleaned, nil
+}
+
+// SetNote cleans note and stores it on the student's order, returning it as
+// stored. Only a pending or confirmed order's note can change; once the
+// order is packed it fails with ErrNoteLocked.
+func SetNote(ctx context.Context, db interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, userID, orderID int, note string) (string, error) {
+	note, err := CleanNote(note)
+	if err != nil {
+		return "", err
+	}
+	var status string
+	err = db.QueryRowContext(ctx,
+		`WITH o AS (SELECT id, status FROM orders WHERE id = $1 AND user_id = $2),
+		      u AS (UPDATE orders SET note = $3
+		             WHERE id = (SELECT id FROM o WHERE status IN ('PENDING', 'CONFIRMED')))
+		 SELECT status FROM o`,
+		orderID, userID, note,
+	).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", domain.NotFound("order not found")
+	} else if err != nil {
+		return "", err
+	}
+	if status != "PENDING" && status != "CONFIRMED" {
+		return "", ErrNoteLocked
+	}
+	return note, nil
+}
+
+// handleSetNote sets or clears the note on one of the student's orders.
+func handleSetNote(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+	var req NoteRequest
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	note, err := SetNote(ctx, db, userID, orderID, req.Note)
+	if err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to set order note", zap.Int("order_id", orderID), zap.Error(err))
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NoteResponse{OrderID: orderID, Note: note})
+}
@@ -0,0 +1,204 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/email"
+	"server/internal/events"
+	"server/internal/locale"
+	"server/internal/webpush"
+
+	"go.uber.org/zap"
+)
+
+// SubscribeEmailNotifications sends the customer a confirmation or
+// cancellation email whenever an order moves to CONFIRMED or CANCELLED. It
+// joins the "email" group so each event is mailed once per deployment.
+func SubscribeEmailNotifications(bus events.Bus, db *sql.DB, logger *zap.Logger, mailer *email.Client) (func(), error) {
+	return bus.Subscribe(TopicOrderStatus, "email", func(ev events.Event) {
+		var se StatusEvent
+		if err := ev.Decode(&se); err != nil {
+			logger.Error("invalid order status event", zap.Error(err))
+			return
+		}
+		if se.Silent {
+			return
+		}
+
+		ctx := context.Background()
+		var err error
+		switch se.Status {
+		case "CONFIRMED":
+			err = SendConfirmationEmail(ctx, db, mailer, se.UserID, se.OrderID, "")
+		case "CANCELLED":
+			err = sendCancellationEmail(ctx, db, mailer, se.UserID, se.OrderID)
+		default:
+			return
+		}
+		if err != nil {
+			logger.Error("failed to send order email",
+				zap.Int("order_id", se.OrderID), zap.String("status", se.Status), zap.Error(err))
+		}
+	})
+}
+
+// SendConfirmationEmail renders the confirmation email, with the pickup
+// calendar attached, from the order as it stands now and sends it to to, or
+// to the account's address when to is "". An order with lines the shop
+// could not supply gets the amended receipt, listing them.
+func SendConfirmationEmail(ctx context.Context, db *sql.DB, mailer *email.Client, userID, orderID int, to string) error {
+	user, err := auth.LoadUser(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	station := user.PickupStation
+	if station == "" {
+		station = PickupStation
+	}
+
+	loc, err := locale.ForOrder(ctx, db, orderID)
+	if err != nil {
+		return err
+	}
+	data := email.OrderConfirmationData{
+		Locale:        loc,
+		Username:      user.Username,
+		OrderID:       orderID,
+		PickupTime:    PickupTime,
+		PickupStation: station,
+	}
+	if err := db.QueryRowContext(ctx,
+		`SELECT transport_fee, small_order_fee, total_cost, tax_total FROM orders WHERE id=$1`, orderID,
+	).Scan(&data.TransportFee, &data.SmallOrderFee, &data.TotalCost, &data.TaxTotal); err != nil {
+		return err
+	}
+
+	items, err := loadOrderItems(ctx, db, orderID)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		data.Items = append(data.Items, struct {
+			Name      string
+			Quantity  int
+			UnitPrice int
+			Subtotal  int
+		}{
+			Name:      it.Name,
+			Quantity:  it.Quantity,
+			UnitPrice: it.UnitPrice,
+			Subtotal:  it.Subtotal,
+		})
+	}
+
+	unfulfilled, err := loadUnfulfilled(ctx, db, orderID)
+	if err != nil {
+		return err
+	}
+	for _, u := range unfulfilled {
+		data.Unfulfilled = append(data.Unfulfilled, struct {
+			Name     string
+			Quantity int
+			Subtotal int
+		}{u.Name, u.Quantity, u.Amount})
+		if u.Refund != nil {
+			data.Refund += u.Refund.Amount
+		}
+	}
+
+	if eta, err := OrderETA(ctx, db, orderID); err != nil {
+		return err
+	} else if eta != nil {
+		data.ETA = eta.Message
+	}
+
+	var attachments []email.Attachment
+	if at, err := ConfirmedAt(ctx, db, orderID); err == nil {
+		data.PickupTime = loc.DateTime(PickupAt(at))
+		attachments = append(attachments, email.Attachment{
+			Filename:    fmt.Sprintf("jaj-order-%d.ics", orderID),
+			ContentType: "text/calendar; method=PUBLISH; charset=UTF-8",
+			Data:        PickupCalendar(orderID, PickupAt(at), station),
+		})
+	}
+
+	if to == "" {
+		to = user.Email
+	}
+	return mailer.SendOrderConfirmationEmail(to, data, attachments...)
+}
+
+func sendCancellationEmail(ctx context.Context, db *sql.DB, mailer *email.Client, userID, orderID int) error {
+	user, err := auth.LoadUser(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	return mailer.SendOrderCancellationEmail(user.Email, email.OrderCancellationData{
+		Username: user.Username,
+		OrderID:  orderID,
+	})
+}
+
+// pushPayload is the JSON the admin dashboard's service worker shows as a
+// notification.
+type pushPayload struct {
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	URL     string `json:"url"`
+	OrderID int    `json:"orderId"`
+	Status  string `json:"status"`
+}
+
+// SubscribeAdminPush pushes a notification to every admin's subscribed
+// browsers when an order is confirmed or cancelled. It joins the "webpush"
+// group so each event is pushed once per deployment.
+func SubscribeAdminPush(bus events.Bus, db *sql.DB, logger *zap.Logger, pusher *webpush.Sender) (func(), error) {
+	return bus.Subscribe(TopicOrderStatus, "webpush", func(ev events.Event) {
+		var se StatusEvent
+		if err := ev.Decode(&se); err != nil {
+			logger.Error("invalid order status event", zap.Error(err))
+			return
+		}
+		if se.Silent || (se.Status != "CONFIRMED" && se.Status != "CANCELLED") {
+			return
+		}
+
+		ctx := context.Background()
+		var username string
+		var total int
+		if err := db.QueryRowContext(ctx,
+			`SELECT u.username, o.total_cost FROM orders o JOIN users u ON u.id = o.user_id WHERE o.id = $1`, se.OrderID,
+		).Scan(&username, &total); err != nil {
+			logger.Error("failed to load order for push", zap.Int("order_id", se.OrderID), zap.Error(err))
+			return
+		}
+
+		loc, _ := locale.ForOrder(ctx, db, se.OrderID) // Default if it cannot be read; the push still goes
+		p := pushPayload{
+			Title:   fmt.Sprintf("New order #%d", se.OrderID),
+			Body:    fmt.Sprintf("%s · %s", username, loc.Money(total)),
+			URL:     fmt.Sprintf("/admin/orders?id=%d", se.OrderID),
+			OrderID: se.OrderID,
+			Status:  se.Status,
+		}
+		if se.Status == "CANCELLED" {
+			p.Title = fmt.Sprintf("Order #%d cancelled", se.OrderID)
+		}
+		payload, _ := json.Marshal(p)
+
+		if _, err := webpush.NotifyAdmins(ctx, db, pusher, logger, webpush.Message{
+			Payload: payload,
+			TTL:     time.Hour,
+			Topic:   fmt.Sprintf("order-%d", se.OrderID),
+			Urgent:  se.Status == "CONFIRMED",
+		}); err != nil {
+			logger.Error("failed to push order notification",
+				zap.Int("order_id", se.OrderID), zap.String("status", se.Status), zap.Error(err))
+		}
+	})
+}
@@ -0,0 +1,273 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/db"
+	"server/internal/domain"
+	"server/internal/events"
+	"server/internal/httpx"
+	"server/internal/jobs"
+	"server/internal/locale"
+
+	"go.uber.org/zap"
+)
+
+// PackingLine is one line of an order's packing checklist.
+type PackingLine struct {
+	ItemID   int        `json:"itemId"`
+	Name     string     `json:"name"`
+	Quantity int        `json:"quantity"`
+	Packed   bool       `json:"packed"`
+	PackedAt *time.Time `json:"packedAt,omitempty"`
+}
+
+// PackingOrder is an order as fulfillment staff pack it.
+type PackingOrder struct {
+	OrderID     int           `json:"orderId"`
+	Username    string        `json:"username"`
+	Status      string        `json:"status"` // CONFIRMED, or PACKED once every line is ticked
+	ConfirmedAt time.Time     `json:"confirmedAt"`
+	Note        string        `json:"note,omitempty"` // the student's, e.g. "ripe bananas please"
+	Items       []PackingLine `json:"items"`
+}
+
+// PackingStation is the day's orders for one pickup station.
+type PackingStation struct {
+	Station string         `json:"station"`
+	Orders  []PackingOrder `json:"orders"`
+	Packed  int            `json:"packed"` // orders fully packed
+}
+
+type packedRequest struct {
+	Packed bool `json:"packed"`
+}
+
+// MakePackingRouter returns the fulfillment staff routes under /staff/.
+// Callers must restrict it to staff with auth.RequireStaff.
+func MakePackingRouter(cluster *db.Cluster, logger *zap.Logger, bus events.Bus, queue *jobs.Queue) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /staff/packing", func(w http.ResponseWriter, r *http.Request) {
+		handlePackingList(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("GET /staff/orders/{id}/items", func(w http.ResponseWriter, r *http.Request) {
+		handlePackingChecklist(w, r, cluster.Primary, logger)
+	})
+	mux.HandleFunc("PATCH /staff/orders/{id}/items/{itemID}/packed", func(w http.ResponseWriter, r *http.Request) {
+		handleSetPacked(w, r, cluster.Primary, logger, bus)
+	})
+	mux.HandleFunc("POST /staff/orders/{id}/items/{itemID}/unfulfillable", func(w http.ResponseWriter, r *http.Request) {
+		handleMarkUnfulfillable(w, r, cluster.Primary, logger, bus, queue)
+	})
+	return mux
+}
+
+// packingOrders loads confirmed and packed orders with their checklists,
+// oldest confirmation first. Pass orderID 0 for every order confirmed on the
+// Kampala day starting at day.
+func packingOrders(ctx context.Context, db *sql.DB, day time.Time, orderID int) (map[string][]PackingOrder, []string, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT o.id, u.username, COALESCE(NULLIF(u.pickup_station, ''), $3), o.status, c.at, o.note,
+		        oi.item_id, i.name, oi.quantity, oi.packed_at
+		   FROM orders o
+		   JOIN users u ON u.id = o.user_id
+		   JOIN LATERAL (SELECT MAX(h.changed_at) AS at FROM order_status_history h
+		                  WHERE h.order_id = o.id AND h.status = 'CONFIRMED') c ON TRUE
+		   JOIN order_items oi ON oi.order_id = o.id
+		   JOIN items i ON i.id = oi.item_id
+		  WHERE o.status IN ('CONFIRMED', 'PACKED')
+		    AND ($4 = 0 AND c.at >= $1 AND c.at < $2 OR o.id = $4)
+		  ORDER BY 3, c.at, o.id, i.name, oi.id`,
+		day, day.AddDate(0, 0, 1), PickupStation, orderID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	byStation := map[string][]PackingOrder{}
+	var stations []string
+	for rows.Next() {
+		var (
+			o       PackingOrder
+			station string
+			line    PackingLine
+		)
+		if err := rows.Scan(&o.OrderID, &o.Username, &station, &o.Status, &o.ConfirmedAt, &o.Note,
+			&line.ItemID, &line.Name, &line.Quantity, &line.PackedAt); err != nil {
+			return nil, nil, err
+		}
+		line.Packed = line.PackedAt != nil
+
+		list, seen := byStation[station]
+		if !seen {
+			stations = append(stations, station)
+		}
+		if n := len(list); n == 0 || list[n-1].OrderID != o.OrderID {
+			list = append(list, o)
+		}
+		last := &list[len(list)-1]
+		last.Items = append(last.Items, line)
+		byStation[station] = list
+	}
+	return byStation, stations, rows.Err()
+}
+
+// handlePackingList returns today's confirmed orders grouped by pickup
+// station, each with its checklist.
+func handlePackingList(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	local := time.Now().In(locale.EAT)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, locale.EAT)
+
+	byStation, stations, err := packingOrders(r.Context(), db, day, 0)
+	if err != nil {
+		logger.Error("packing list query failed", zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]PackingStation, 0, len(stations))
+	for _, name := range stations {
+		st := PackingStation{Station: name, Orders: byStation[name]}
+		for _, o := range st.Orders {
+			if o.Status == "PACKED" {
+				st.Packed++
+			}
+		}
+		result = append(result, st)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handlePackingChecklist returns one order's checklist.
+func handlePackingChecklist(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+	byStation, stations, err := packingOrders(r.Context(), db, time.Time{}, orderID)
+	if err != nil {
+		logger.Error("packing checklist query failed", zap.Int("order_id", orderID), zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	if len(stations) == 0 {
+		httpx.WriteError(w, domain.NotFound("no confirmed order with that id"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(byStation[stations[0]][0])
+}
+
+// handleSetPacked ticks or unticks one item on an order's checklist. Ticking
+// the last item moves the order to PACKED; a packed order is final and its
+// items can no longer be unticked.
+func handleSetPacked(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus) {
+	ctx := r.Context()
+	staffID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	req := packedRequest{Packed: true}
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("failed to begin transaction", zap.Error(err))
+		http.Error(w, "failed to update checklist", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var userID, version int
+	var status string
+	err = tx.QueryRowContext(ctx,
+		`SELECT user_id, status, version FROM orders WHERE id = $1 FOR UPDATE`, orderID,
+	).Scan(&userID, &status, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("order not found"))
+		return
+	} else if err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "failed to update checklist", http.StatusInternalServerError)
+		return
+	}
+	if status != "CONFIRMED" {
+		http.Error(w, "order is "+strings.ToLower(status)+", not awaiting packing", http.StatusConflict)
+		return
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE order_items
+		    SET packed_at = CASE WHEN $3 THEN COALESCE(packed_at, NOW()) END,
+		        packed_by = CASE WHEN $3 THEN COALESCE(packed_by, NULLIF($4, 0)) END
+		  WHERE order_id = $1 AND item_id = $2`,
+		orderID, itemID, req.Packed, staffID)
+	if err != nil {
+		logger.Error("failed to update checklist", zap.Int("order_id", orderID), zap.Error(err))
+		http.Error(w, "failed to update checklist", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		httpx.WriteError(w, domain.NotFound("item is not on this order"))
+		return
+	}
+
+	var remaining int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM order_items WHERE order_id = $1 AND packed_at IS NULL`, orderID,
+	).Scan(&remaining); err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "failed to update checklist", http.StatusInternalServerError)
+		return
+	}
+	if remaining == 0 {
+		if err := UpdateStatus(ctx, tx, orderID, version, "PACKED"); err != nil {
+			logger.Error("failed to mark order packed", zap.Int("order_id", orderID), zap.Error(err))
+			http.Error(w, "failed to update checklist", http.StatusInternalServerError)
+			return
+		}
+		if err := RecordStatusChange(ctx, tx, orderID, "PACKED"); err != nil {
+			logger.Error("failed to record order status", zap.Error(err))
+			http.Error(w, "failed to update checklist", http.StatusInternalServerError)
+			return
+		}
+		status = "PACKED"
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("transaction commit failed", zap.Error(err))
+		http.Error(w, "failed to update checklist", http.StatusInternalServerError)
+		return
+	}
+	if status == "PACKED" {
+		PublishStatus(ctx, bus, logger, StatusEvent{UserID: userID, OrderID: orderID, Status: "PACKED"})
+	}
+
+	byStation, stations, err := packingOrders(ctx, db, time.Time{}, orderID)
+	if err != nil || len(stations) == 0 {
+		logger.Error("packing checklist query failed", zap.Int("order_id", orderID), zap.Error(err))
+		http.Error(w, "database query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(byStation[stations[0]][0])
+}
@@ -0,0 +1,226 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"server/internal/events"
+	"server/internal/ledger"
+	"server/internal/pricing"
+
+	"go.uber.org/zap"
+)
+
+// ReconcileTransportFees re-prices confirmed orders from since onwards whose
+// transport fee does not match their position among the user's confirmed
+// orders that day, and returns how many were corrected. It repairs orders
+// priced before fee tiers were counted under ConfirmedToday's lock.
+func ReconcileTransportFees(ctx context.Context, db *sql.DB, since time.Time) (int, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, transport_fee, transport_fee_waived, n
+		   FROM (SELECT o.id, o.transport_fee, o.transport_fee_waived,
+		                ROW_NUMBER() OVER (
+		                  PARTITION BY o.user_id, date_trunc('day', h.changed_at AT TIME ZONE 'UTC')
+		                  ORDER BY h.changed_at, o.id
+		                ) AS n
+		           FROM orders o
+		           JOIN order_status_history h ON h.order_id = o.id AND h.status = 'CONFIRMED'
+		          WHERE o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		            AND h.changed_at >= $1) ranked`,
+		since.Truncate(24*time.Hour),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	type fix struct{ id, oldFee, newFee int }
+	var fixes []fix
+	for rows.Next() {
+		var id, fee, n int
+		var waived bool
+		if err := rows.Scan(&id, &fee, &waived, &n); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if want := wantTransportFee(n, waived); want != fee {
+			fixes = append(fixes, fix{id, fee, want})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	fixed := 0
+	for _, f := range fixes {
+		ok, err := repriceTransportFee(ctx, db, f.id, f.oldFee, f.newFee)
+		if err != nil {
+			return fixed, err
+		}
+		if ok {
+			fixed++
+		}
+	}
+	return fixed, nil
+}
+
+// repriceTransportFee corrects one order's fee and books the difference.
+func repriceTransportFee(ctx context.Context, db *sql.DB, orderID, oldFee, newFee int) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := adjustTransportFee(ctx, tx, orderID, oldFee, newFee); err == sql.ErrNoRows {
+		return false, nil // changed since it was ranked; the next run will see it
+	} else if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// adjustTransportFee moves an order's fee from oldFee to newFee, keeping
+// total_cost in step, and books the difference in the ledger. It returns the
+// new total, or sql.ErrNoRows if the fee is no longer oldFee.
+func adjustTransportFee(ctx context.Context, tx *sql.Tx, orderID, oldFee, newFee int) (int, error) {
+	var (
+		receipt   sql.NullString
+		totalCost int
+	)
+	err := tx.QueryRowContext(ctx,
+		`UPDATE orders
+		    SET transport_fee = $1, total_cost = total_cost - transport_fee + $1, version = version + 1
+		  WHERE id = $2 AND transport_fee = $3
+		 RETURNING receipt_number, total_cost`,
+		newFee, orderID, oldFee,
+	).Scan(&receipt, &totalCost)
+	if err != nil {
+		return 0, err
+	}
+	return totalCost, ledger.Append(ctx, tx, ledger.Entry{
+		OrderID: orderID, ReceiptNumber: receipt.String, Type: ledger.TypeFeeAdjustment, Amount: newFee - oldFee,
+	})
+}
+
+// TopicOrderRepriced is published after a committed change to an order's
+// transport fee or total outside of placing it, such as a line staff could
+// not supply.
+const TopicOrderRepriced = "order.repriced"
+
+// RepricedEvent is the payload of a TopicOrderRepriced event.
+type RepricedEvent struct {
+	UserID       int `json:"userId"`
+	OrderID      int `json:"orderId"`
+	OldFee       int `json:"oldTransportFee"`
+	TransportFee int `json:"transportFee"`
+	TotalCost    int `json:"totalCost"`
+}
+
+// RetierAfterCancel re-prices the user's other orders confirmed on the same
+// day as the cancelled order, so orders placed after it drop back to the tier
+// they now hold. Call it in the cancelling tx, after the status change; it
+// returns the adjustments to publish once that tx commits. Orders that were
+// never confirmed leave the tiers alone.
+func RetierAfterCancel(ctx context.Context, tx *sql.Tx, userID, cancelledID int) ([]RepricedEvent, error) {
+	var confirmed time.Time
+	err := tx.QueryRowContext(ctx,
+		`SELECT changed_at FROM order_status_history
+		  WHERE order_id = $1 AND status = 'CONFIRMED'
+		  ORDER BY changed_at DESC LIMIT 1`,
+		cancelledID,
+	).Scan(&confirmed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	day := confirmed.UTC().Truncate(24 * time.Hour)
+	if err := lockUserDay(ctx, tx, userID, day); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT o.id, o.transport_fee, o.transport_fee_waived,
+		        ROW_NUMBER() OVER (ORDER BY h.changed_at, o.id) AS n
+		   FROM orders o
+		   JOIN order_status_history h ON h.order_id = o.id AND h.status = 'CONFIRMED'
+		  WHERE o.user_id = $1
+		    AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		    AND h.changed_at >= $2 AND h.changed_at < $3`,
+		userID, day, day.Add(24*time.Hour),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var changes []RepricedEvent
+	for rows.Next() {
+		var id, fee, n int
+		var waived bool
+		if err := rows.Scan(&id, &fee, &waived, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if want := wantTransportFee(n, waived); want != fee {
+			changes = append(changes, RepricedEvent{UserID: userID, OrderID: id, OldFee: fee, TransportFee: want})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range changes {
+		c := &changes[i]
+		if c.TotalCost, err = adjustTransportFee(ctx, tx, c.OrderID, c.OldFee, c.TransportFee); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// PublishRepriced announces committed fee adjustments so the student's open
+// clients refresh the affected totals. Failures are logged, as in
+// PublishStatus.
+func PublishRepriced(ctx context.Context, bus events.Bus, logger *zap.Logger, changes []RepricedEvent) {
+	for _, c := range changes {
+		if err := bus.Publish(ctx, TopicOrderRepriced, c); err != nil {
+			logger.Error("failed to publish order reprice", zap.Int("order_id", c.OrderID), zap.Error(err))
+		}
+	}
+}
+
+// RunFeeReconciler runs ReconcileTransportFees over today and yesterday every
+// interval until ctx is done.
+func RunFeeReconciler(ctx context.Context, db *sql.DB, logger *zap.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fixed, err := ReconcileTransportFees(ctx, db, time.Now().Add(-24*time.Hour))
+		if err != nil {
+			logger.Error("transport fee reconciliation failed", zap.Error(err))
+			continue
+		}
+		if fixed > 0 {
+			logger.Warn("corrected mispriced transport fees", zap.Int("orders", fixed))
+		}
+	}
+}
+
+// wantTransportFee is the fee the user's nth confirmed order of the day
+// should carry: none if it was priced with the fee waived, and otherwise
+// pricing.TransportFee's, since waived orders still count as trips.
+func wantTransportFee(nth int, waived bool) int {
+	if waived {
+		return 0
+	}
+	return pricing.TransportFee(nth)
+}
@@ -0,0 +1,178 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"server/internal/email"
+	"server/internal/locale"
+	"server/internal/webpush"
+
+	"go.uber.org/zap"
+)
+
+// defaultReminderLead is how long before CutoffTime students are reminded
+// of unconfirmed drafts when /admin/config does not say.
+const defaultReminderLead = 30 * time.Minute
+
+// draftReminder is a student to remind about their latest chat draft.
+type draftReminder struct {
+	userID, orderID int
+	email, username string
+}
+
+// reminderSettings reads orders.cutoff_reminders and
+// orders.cutoff_reminder_minutes.
+func reminderSettings(ctx context.Context, db *sql.DB) (bool, time.Duration, error) {
+	enabled, lead := true, defaultReminderLead
+	values, err := loadSettings(ctx, db, "orders.cutoff_reminders", "orders.cutoff_reminder_minutes")
+	if err != nil {
+		return false, 0, err
+	}
+	if v, ok := values["orders.cutoff_reminders"]; ok {
+		json.Unmarshal(v, &enabled)
+	}
+	var mins int
+	if v, ok := values["orders.cutoff_reminder_minutes"]; ok && json.Unmarshal(v, &mins) == nil && mins > 0 {
+		lead = time.Duration(mins) * time.Minute
+	}
+	return enabled, lead, nil
+}
+
+// SendCutoffReminders emails and pushes every student who started a chat
+// draft today but has not confirmed it, once the reminder lead time before
+// CutoffTime has begun, with a link back to the draft in chat. It returns
+// how many students were reminded. Each reminder is claimed in
+// cutoff_reminders first, so students are nudged at most once a day however
+// many instances run; one that reached the student by neither channel
+// releases its claim for the next run. pusher may be nil.
+func SendCutoffReminders(ctx context.Context, db *sql.DB, mailer *email.Client, pusher *webpush.Sender, logger *zap.Logger, baseURL string, now time.Time) (int, error) {
+	enabled, lead, err := reminderSettings(ctx, db)
+	if err != nil || !enabled {
+		return 0, err
+	}
+	local := now.In(locale.EAT)
+	cutoff := time.Date(local.Year(), local.Month(), local.Day(), cutoffHour, 0, 0, 0, locale.EAT)
+	if now.Before(cutoff.Add(-lead)) || !now.Before(cutoff) {
+		return 0, nil
+	}
+	opened, _ := CapacityDay(now)
+	day := local.Format("2006-01-02")
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT DISTINCT ON (o.user_id) o.id, o.user_id, u.email, u.username
+		   FROM orders o JOIN users u ON u.id = o.user_id
+		  WHERE o.status = 'PENDING' AND o.created_at >= $1
+		    AND NOT EXISTS (SELECT 1 FROM cutoff_reminders r WHERE r.user_id = o.user_id AND r.day = $2)
+		  ORDER BY o.user_id, o.created_at DESC`,
+		opened, day,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var due []draftReminder
+	for rows.Next() {
+		var d draftReminder
+		if err := rows.Scan(&d.orderID, &d.userID, &d.email, &d.username); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, d := range due {
+		res, err := db.ExecContext(ctx,
+			`INSERT INTO cutoff_reminders (user_id, day, order_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+			d.userID, day, d.orderID)
+		if err != nil {
+			return sent, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // another instance has it
+		}
+
+		chatURL := fmt.Sprintf("%s/chat?draft=%d", strings.TrimRight(baseURL, "/"), d.orderID)
+		delivered, retry := false, false
+
+		data := email.CutoffReminderData{Username: d.username, CutoffTime: CutoffTime, ChatURL: chatURL}
+		items, err := loadOrderItems(ctx, db, d.orderID)
+		if err != nil {
+			return sent, err
+		}
+		for _, it := range items {
+			data.Items = append(data.Items, email.WaitlistItem{Name: it.Name, Quantity: it.Quantity})
+		}
+		err = mailer.SendCutoffReminderEmail(d.email, data)
+		switch {
+		case err == nil:
+			delivered = true
+		case !errors.Is(err, email.ErrSuppressed):
+			logger.Error("failed to send cutoff reminder", zap.Int("user_id", d.userID), zap.Error(err))
+			retry = true
+		}
+
+		if pusher != nil {
+			payload, _ := json.Marshal(pushPayload{
+				Title:   "Your order isn't placed yet",
+				Body:    fmt.Sprintf("Confirm it in chat before %s to collect it tonight.", CutoffTime),
+				URL:     chatURL,
+				OrderID: d.orderID,
+				Status:  "PENDING",
+			})
+			n, err := webpush.NotifyUser(ctx, db, pusher, logger, d.userID, webpush.Message{
+				Payload: payload,
+				TTL:     cutoff.Sub(now),
+				Topic:   "cutoff-reminder",
+			})
+			if err != nil {
+				logger.Error("failed to push cutoff reminder", zap.Int("user_id", d.userID), zap.Error(err))
+			}
+			delivered = delivered || n > 0
+		}
+
+		if !delivered && retry {
+			if _, err := db.ExecContext(ctx,
+				`DELETE FROM cutoff_reminders WHERE user_id = $1 AND day = $2`, d.userID, day); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if delivered {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// RunCutoffReminders runs SendCutoffReminders every interval until ctx is
+// done.
+func RunCutoffReminders(ctx context.Context, db *sql.DB, mailer *email.Client, pusher *webpush.Sender, logger *zap.Logger, baseURL string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sent, err := SendCutoffReminders(ctx, db, mailer, pusher, logger, baseURL, time.Now())
+		if err != nil {
+			logger.Error("cutoff reminders failed", zap.Error(err))
+			continue
+		}
+		if sent > 0 {
+			logger.Info("sent cutoff reminders", zap.Int("students", sent))
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/email"
+	"server/internal/httpx"
+	"server/internal/jobs"
+
+	"go.uber.org/zap"
+)
+
+// Receipt resend throttling: one per order every resendGap, and at most
+// maxResendsPerDay per order in any 24 hours.
+const (
+	resendGap        = 5 * time.Minute
+	maxResendsPerDay = 3
+)
+
+// jobReceiptEmail is the job type that sends a resent confirmation.
+const jobReceiptEmail = "receipt_email"
+
+// ResendConfirmationRequest is the optional body of
+// POST /orders/{id}/resend-confirmation. Left empty, the confirmation goes
+// to the account's address; an alternate one must be typed twice.
+type ResendConfirmationRequest struct {
+	Email        string `json:"email" validate:"email,max=254"`
+	ConfirmEmail string `json:"confirmEmail" validate:"max=254"`
+}
+
+// ResendConfirmationResponse says where the confirmation is on its way.
+type ResendConfirmationResponse struct {
+	OrderID   int    `json:"orderId"`
+	Recipient string `json:"recipient"`
+	JobID     int64  `json:"jobId"`
+}
+
+// receiptJob is the payload of a jobReceiptEmail job.
+type receiptJob struct {
+	UserID  int    `json:"userId"`
+	OrderID int    `json:"orderId"`
+	To      string `json:"to"`
+}
+
+// ResendThrottledError is returned when an order's confirmation was resent
+// too recently or too often.
+type ResendThrottledError struct {
+	Until time.Time
+	at    time.Time
+}
+
+func (e *ResendThrottledError) Error() string {
+	return "This order's confirmation was sent again recently. Check your spam folder, or try again later."
+}
+
+// Is makes a throttled resend a domain.ErrQuotaExceeded.
+func (e *ResendThrottledError) Is(target error) bool { return target == domain.ErrQuotaExceeded }
+
+// RetryAfter is how long until the order's confirmation may be resent.
+func (e *ResendThrottledError) RetryAfter() time.Duration { return e.Until.Sub(e.at) }
+
+// RegisterJobs adds the orders package's background job types to queue.
+func RegisterJobs(queue *jobs.Queue, db *sql.DB, mailer *email.Client) {
+	queue.Register(jobReceiptEmail, jobs.Kind{
+		Concurrency: 2,
+		Timeout:     time.Minute,
+		Run: func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			var p receiptJob
+			if err := json.Unmarshal(payload, &p); err != nil {
+				return nil, err
+			}
+			// A suppressed address will not take mail however often it is
+			// retried
+			if err := SendConfirmationEmail(ctx, db, mailer, p.UserID, p.OrderID, p.To); errors.Is(err, email.ErrSuppressed) {
+				return map[string]string{"outcome": "suppressed"}, nil
+			} else if err != nil {
+				return nil, err
+			}
+			return map[string]string{"outcome": "sent"}, nil
+		},
+	})
+}
+
+// handleResendConfirmation queues the confirmation of the student's order to
+// be sent again, to their own address or one they typed twice, throttled
+// per order and recorded in receipt_resends.
+func handleResendConfirmation(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, queue *jobs.Queue) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+	var req ResendConfirmationRequest
+	if r.ContentLength != 0 && !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email != "" && !strings.EqualFold(req.Email, strings.TrimSpace(req.ConfirmEmail)) {
+		httpx.WriteValidationErrors(w, httpx.ValidationErrors{{Field: "confirmEmail", Message: "does not match email"}})
+		return
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("failed to begin transaction", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// The order row is locked so concurrent requests are throttled in turn
+	var status string
+	if err := tx.QueryRowContext(ctx,
+		`SELECT status FROM orders WHERE id = $1 AND user_id = $2 FOR UPDATE`, orderID, userID,
+	).Scan(&status); errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("order not found"))
+		return
+	} else if err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if status != "CONFIRMED" && status != "PACKED" && status != "FULFILLED" {
+		httpx.WriteError(w, domain.Conflict("order is "+strings.ToLower(status)+", not confirmed"))
+		return
+	}
+	if err := checkResendThrottle(ctx, tx, orderID, time.Now()); err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to check resend throttle", zap.Error(err))
+		}
+		return
+	}
+
+	recipient := req.Email
+	if recipient == "" {
+		user, err := auth.LoadUser(ctx, db, userID)
+		if err != nil {
+			logger.Error("failed to load user", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		recipient = user.Email
+	}
+	jobID, err := queue.Enqueue(ctx, jobReceiptEmail, receiptJob{UserID: userID, OrderID: orderID, To: req.Email}, userID)
+	if err != nil {
+		logger.Error("failed to enqueue job", zap.String("type", jobReceiptEmail), zap.Error(err))
+		http.Error(w, "failed to queue email", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO receipt_resends (order_id, user_id, recipient, alternate, job_id, ip) VALUES ($1, $2, $3, $4, $5, $6)`,
+		orderID, userID, recipient, req.Email != "", jobID, httpx.ClientIP(ctx),
+	); err != nil {
+		logger.Error("failed to record receipt resend", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("transaction commit failed", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("order confirmation resend queued", zap.Int("order_id", orderID), zap.Int("user_id", userID),
+		zap.Bool("alternate", req.Email != ""), zap.Int64("job_id", jobID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ResendConfirmationResponse{OrderID: orderID, Recipient: recipient, JobID: jobID})
+}
+
+// checkResendThrottle returns a ResendThrottledError if orderID's
+// confirmation may not be resent at now.
+func checkResendThrottle(ctx context.Context, tx *sql.Tx, orderID int, now time.Time) error {
+	var sent []time.Time
+	rows, err := tx.QueryContext(ctx,
+		`SELECT created_at FROM receipt_resends WHERE order_id = $1 AND created_at > $2 ORDER BY created_at`,
+		orderID, now.Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var at time.Time
+		if err := rows.Scan(&at); err != nil {
+			return err
+		}
+		sent = append(sent, at)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load receipt resends: %w", err)
+	}
+
+	var until time.Time
+	if n := len(sent); n > 0 && sent[n-1].Add(resendGap).After(now) {
+		until = sent[n-1].Add(resendGap)
+	}
+	if n := len(sent); n >= maxResendsPerDay {
+		// Another goes once the oldest of the last maxResendsPerDay is a day old
+		if next := sent[n-maxResendsPerDay].Add(24 * time.Hour); next.After(until) {
+			until = next
+		}
+	}
+	if until.IsZero() {
+		return nil
+	}
+	return &ResendThrottledError{Until: until, at: now}
+}
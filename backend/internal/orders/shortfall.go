@@ -0,0 +1,271 @@
+package orders
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/events"
+	"server/internal/httpx"
+	"server/internal/jobs"
+	"server/internal/ledger"
+	"server/internal/payments"
+
+	"go.uber.org/zap"
+)
+
+// UnfulfillableRequest is the optional body of
+// POST /staff/orders/{id}/items/{itemID}/unfulfillable.
+type UnfulfillableRequest struct {
+	Reason string `json:"reason" validate:"max=200"`
+	// RefundMethod is where a paid order's refund goes; WALLET by default.
+	RefundMethod string `json:"refundMethod" validate:"oneof=WALLET MOBILE_MONEY"`
+}
+
+// ShortfallResponse is an order after a line was dropped from it.
+type ShortfallResponse struct {
+	OrderID   int    `json:"orderId"`
+	Status    string `json:"status"` // PACKED when every remaining line was already ticked
+	ItemID    int    `json:"itemId"`
+	Quantity  int    `json:"quantity"`
+	Amount    int    `json:"amount"` // what the dropped line cost
+	TotalCost int    `json:"totalCost"`
+	TaxTotal  int    `json:"taxTotal"`
+	// Refund is the difference owed back on a paid order, awaiting approval
+	// like a cancellation's
+	Refund *RefundInfo `json:"refund,omitempty"`
+	// ReceiptJobID is the job emailing the student the amended receipt; 0
+	// if it could not be queued
+	ReceiptJobID int64 `json:"receiptJobId,omitempty"`
+}
+
+// handleMarkUnfulfillable drops a line the shop turns out not to have from a
+// confirmed order. The order's total and VAT shrink by the line's value; the
+// fees stay as charged, so a shortfall never costs the student more. A paid
+// order gets a partial refund of the difference, the ledger books it, and
+// the student is emailed the amended receipt. Dropping the last unpacked
+// line moves the order to PACKED; the only line cannot be dropped, since
+// that is a cancellation.
+func handleMarkUnfulfillable(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger, bus events.Bus, queue *jobs.Queue) {
+	ctx := r.Context()
+	staffID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	orderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "invalid item id", http.StatusBadRequest)
+		return
+	}
+	req := UnfulfillableRequest{RefundMethod: payments.MethodWallet}
+	if r.ContentLength != 0 && !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("failed to begin transaction", zap.Error(err))
+		http.Error(w, "failed to amend order", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		userID, version int
+		status, payment string
+		receipt         sql.NullString
+	)
+	err = tx.QueryRowContext(ctx,
+		`SELECT user_id, status, version, payment_status, receipt_number FROM orders WHERE id = $1 FOR UPDATE`, orderID,
+	).Scan(&userID, &status, &version, &payment, &receipt)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpx.WriteError(w, domain.NotFound("order not found"))
+		return
+	} else if err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "failed to amend order", http.StatusInternalServerError)
+		return
+	}
+	if status != "CONFIRMED" {
+		httpx.WriteError(w, domain.Conflict("order is "+strings.ToLower(status)+", not awaiting packing"))
+		return
+	}
+
+	res := ShortfallResponse{OrderID: orderID, ItemID: itemID, Status: status}
+	var unitPrice, tax, remaining, fee int
+	var name string
+	if err := tx.QueryRowContext(ctx,
+		`WITH d AS (DELETE FROM order_items WHERE order_id = $1 AND item_id = $2
+		            RETURNING quantity, unit_price, tax_amount)
+		 SELECT COALESCE(SUM(quantity), 0), COALESCE(SUM(quantity * unit_price), 0), COALESCE(MAX(unit_price), 0),
+		        COALESCE(SUM(tax_amount), 0),
+		        (SELECT COUNT(*) FROM order_items WHERE order_id = $1 AND item_id <> $2),
+		        COALESCE((SELECT name FROM items WHERE id = $2), '')
+		   FROM d`,
+		orderID, itemID,
+	).Scan(&res.Quantity, &res.Amount, &unitPrice, &tax, &remaining, &name); err != nil {
+		logger.Error("failed to drop order line", zap.Int("order_id", orderID), zap.Error(err))
+		http.Error(w, "failed to amend order", http.StatusInternalServerError)
+		return
+	}
+	if res.Quantity == 0 {
+		httpx.WriteError(w, domain.NotFound("item is not on this order"))
+		return
+	}
+	if remaining == 0 {
+		httpx.WriteError(w, domain.Conflict("this is the order's only item; cancel the order instead"))
+		return
+	}
+
+	if err := tx.QueryRowContext(ctx,
+		`UPDATE orders SET total_cost = total_cost - $1, tax_total = tax_total - $2, version = version + 1
+		  WHERE id = $3 RETURNING total_cost, tax_total, transport_fee`,
+		res.Amount, tax, orderID,
+	).Scan(&res.TotalCost, &res.TaxTotal, &fee); err != nil {
+		logger.Error("failed to amend order totals", zap.Int("order_id", orderID), zap.Error(err))
+		http.Error(w, "failed to amend order", http.StatusInternalServerError)
+		return
+	}
+	version++
+	if receipt.Valid {
+		if err := ledger.Append(ctx, tx, ledger.Entry{
+			OrderID: orderID, ReceiptNumber: receipt.String, Type: ledger.TypeShortfall, Amount: -res.Amount,
+		}); err != nil {
+			logger.Error("failed to record ledger entries", zap.Int("order_id", orderID), zap.Error(err))
+			http.Error(w, "failed to amend order", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var refundID sql.NullInt64
+	if payment == "PAID" {
+		reason := "Not supplied: " + name
+		if req.Reason != "" {
+			reason += " (" + req.Reason + ")"
+		}
+		res.Refund = &RefundInfo{Amount: res.Amount, Method: req.RefundMethod}
+		if err := tx.QueryRowContext(ctx,
+			`INSERT INTO refunds (order_id, amount, method, reason, partial) VALUES ($1, $2, $3, $4, TRUE)
+			 RETURNING id, status`,
+			orderID, res.Amount, req.RefundMethod, reason,
+		).Scan(&refundID, &res.Refund.Status); err != nil {
+			logger.Error("failed to create refund", zap.Int("order_id", orderID), zap.Error(err))
+			http.Error(w, "failed to create refund", http.StatusInternalServerError)
+			return
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO order_item_shortfalls (order_id, item_id, quantity, unit_price, tax_amount, reason, staff_id, refund_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), $8)`,
+		orderID, itemID, res.Quantity, unitPrice, tax, req.Reason, staffID, refundID,
+	); err != nil {
+		logger.Error("failed to record shortfall", zap.Int("order_id", orderID), zap.Error(err))
+		http.Error(w, "failed to amend order", http.StatusInternalServerError)
+		return
+	}
+
+	// The dropped line may have been all that was left to pack
+	var unpacked int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM order_items WHERE order_id = $1 AND packed_at IS NULL`, orderID,
+	).Scan(&unpacked); err != nil {
+		logger.Error("database error", zap.Error(err))
+		http.Error(w, "failed to amend order", http.StatusInternalServerError)
+		return
+	}
+	if unpacked == 0 {
+		if err := UpdateStatus(ctx, tx, orderID, version, "PACKED"); err != nil {
+			logger.Error("failed to mark order packed", zap.Int("order_id", orderID), zap.Error(err))
+			http.Error(w, "failed to amend order", http.StatusInternalServerError)
+			return
+		}
+		if err := RecordStatusChange(ctx, tx, orderID, "PACKED"); err != nil {
+			logger.Error("failed to record order status", zap.Error(err))
+			http.Error(w, "failed to amend order", http.StatusInternalServerError)
+			return
+		}
+		res.Status = "PACKED"
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("transaction commit failed", zap.Error(err))
+		http.Error(w, "failed to amend order", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("order line not supplied", zap.Int("order_id", orderID), zap.Int("item_id", itemID),
+		zap.Int("amount", res.Amount), zap.Bool("refund", refundID.Valid), zap.Int("staff_id", staffID))
+
+	PublishRepriced(ctx, bus, logger, []RepricedEvent{{
+		UserID: userID, OrderID: orderID, OldFee: fee, TransportFee: fee, TotalCost: res.TotalCost,
+	}})
+	if res.Status == "PACKED" {
+		PublishStatus(ctx, bus, logger, StatusEvent{UserID: userID, OrderID: orderID, Status: "PACKED"})
+	}
+	// The receipt as it now stands lists the dropped line and any refund
+	if res.ReceiptJobID, err = queue.Enqueue(ctx, jobReceiptEmail, receiptJob{UserID: userID, OrderID: orderID}, staffID); err != nil {
+		logger.Error("failed to enqueue job", zap.String("type", jobReceiptEmail), zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// UnfulfilledItem is a line dropped from an order because the shop did not
+// have it.
+type UnfulfilledItem struct {
+	ItemID   int         `json:"itemId"`
+	Name     string      `json:"name"`
+	Quantity int         `json:"quantity"`
+	Amount   int         `json:"amount"` // taken off the order's total
+	Reason   string      `json:"reason,omitempty"`
+	Refund   *RefundInfo `json:"refund,omitempty"` // on a paid order
+}
+
+// loadUnfulfilled returns the lines dropped from an order, live or archived,
+// in the order they were dropped.
+func loadUnfulfilled(ctx context.Context, db *sql.DB, orderID int) ([]UnfulfilledItem, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT s.item_id, i.name, s.quantity, s.quantity * s.unit_price, s.reason,
+		        r.status, r.amount, r.method, r.issued_at
+		   FROM order_item_shortfalls s
+		   JOIN items i ON i.id = s.item_id
+		   LEFT JOIN refunds r ON r.id = s.refund_id
+		  WHERE s.order_id = $1
+		  ORDER BY s.id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []UnfulfilledItem
+	for rows.Next() {
+		var (
+			u      UnfulfilledItem
+			status sql.NullString
+			amount sql.NullInt64
+			method sql.NullString
+			issued sql.NullTime
+		)
+		if err := rows.Scan(&u.ItemID, &u.Name, &u.Quantity, &u.Amount, &u.Reason,
+			&status, &amount, &method, &issued); err != nil {
+			return nil, err
+		}
+		if status.Valid {
+			u.Refund = &RefundInfo{Status: status.String, Amount: int(amount.Int64), Method: method.String}
+			if issued.Valid {
+				u.Refund.IssuedAt = &issued.Time
+			}
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,57 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+)
+
+// Refund destinations.
+const (
+	MethodWallet      = "WALLET"
+	MethodMobileMoney = "MOBILE_MONEY"
+)
+
+// ValidMethod reports whether m is a supported refund destination.
+func ValidMethod(m string) bool {
+	return m == MethodWallet || m == MethodMobileMoney
+}
+
+// RefundRequest is a refund to pay out to a customer.
+type RefundRequest struct {
+	RefundID int
+	OrderID  int
+	UserID   int
+	Amount   int // UGX
+	Method   string
+}
+
+// Provider pays out refunds and returns the provider's reference for the
+// transfer.
+//
+// Refund must be idempotent on req.RefundID: a second call for a refund
+// already paid out must not pay again and returns the first transfer's
+// reference. Callers rely on this to retry a payout whose outcome they did
+// not record.
+type Provider interface {
+	Refund(ctx context.Context, req RefundRequest) (string, error)
+}
+
+// ManualProvider is used until a payments integration exists: staff settle
+// the refund by hand and the system only records a local reference. The
+// reference is derived from the refund ID, so it is idempotent.
+type ManualProvider struct{}
+
+// Refund implements Provider.
+func (ManualProvider) Refund(_ context.Context, req RefundRequest) (string, error) {
+	return fmt.Sprintf("manual-%d", req.RefundID), nil
+}
+
+// New returns the provider with the given name; "" selects "manual".
+func New(name string) (Provider, error) {
+	switch name {
+	case "", "manual":
+		return ManualProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown payments provider %q", name)
+	}
+}
@@ -0,0 +1,18 @@
+package pricing
+
+import (
+	"context"
+	"database/sql"
+)
+
+type queryer interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// CurrentPrice returns what the item sells at now: its scheduled price if
+// one is in force, otherwise its catalog price.
+func CurrentPrice(ctx context.Context, q queryer, itemID int) (int, error) {
+	var price int
+	err := q.QueryRowContext(ctx, `SELECT item_price($1, NOW())`, itemID).Scan(&price)
+	return price, err
+}
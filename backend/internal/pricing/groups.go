@@ -0,0 +1,43 @@
+package pricing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Group is how a user group's prices differ from the regular ones, e.g.
+// campus staff paying 10% less and no transport fee. The zero Group
+// changes nothing.
+type Group struct {
+	// PriceAdjustBps is added to every item price, in basis points of it:
+	// -1000 is 10% off, 500 a 5% markup.
+	PriceAdjustBps     int
+	WaiveTransportFee  bool
+	WaiveSmallOrderFee bool
+}
+
+// Price is what an item regularly sold at unit costs the group, rounded to
+// the nearest shilling.
+func (g Group) Price(unit int) int {
+	if g.PriceAdjustBps == 0 {
+		return unit
+	}
+	adjusted := unit * (10000 + g.PriceAdjustBps)
+	return (adjusted + 5000) / 10000
+}
+
+// GroupFor returns the pricing of userID's group, or the zero Group for a
+// user in none.
+func GroupFor(ctx context.Context, q queryer, userID int) (Group, error) {
+	var g Group
+	err := q.QueryRowContext(ctx,
+		`SELECT g.price_adjust_bps, g.waive_transport_fee, g.waive_small_order_fee
+		   FROM users u JOIN user_groups g ON g.id = u.group_id
+		  WHERE u.id = $1`, userID,
+	).Scan(&g.PriceAdjustBps, &g.WaiveTransportFee, &g.WaiveSmallOrderFee)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Group{}, nil
+	}
+	return g, err
+}
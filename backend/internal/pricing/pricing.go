@@ -0,0 +1,112 @@
+// Package pricing works out what an order costs: line subtotals, the VAT
+// they contain, the transport fee, and any small-order fee. Chat and REST orders both price
+// through Quote so the two paths cannot drift apart.
+package pricing
+
+import (
+	"fmt"
+
+	"server/internal/tax"
+)
+
+// Line is one item of an order at the price it is sold at.
+type Line struct {
+	ItemID     int
+	Quantity   int
+	UnitPrice  int // UGX, VAT-inclusive
+	TaxRateBps int
+}
+
+// Order is what Quote prices.
+type Order struct {
+	Lines []Line
+	// ConfirmedToday is how many orders the student has already confirmed
+	// today; the transport fee tier depends on it.
+	ConfirmedToday int
+	SmallOrder     SmallOrderRule
+	// Group is the student's user group's pricing, applied to each line's
+	// UnitPrice and the fees.
+	Group Group
+}
+
+// SmallOrderRule is a campus's minimum basket. Orders whose items come to
+// less than Minimum are charged Fee on top, or refused when Refuse is set.
+type SmallOrderRule struct {
+	Minimum int // UGX; 0 means no minimum
+	Fee     int
+	Refuse  bool
+}
+
+// BelowMinimumError is returned by SmallOrderRule.Check for an order the
+// campus refuses to take because it is too small.
+type BelowMinimumError struct {
+	Minimum  int
+	Subtotal int
+}
+
+func (e *BelowMinimumError) Error() string {
+	return fmt.Sprintf("Orders must come to at least UGX %d before fees; add UGX %d more to place this one.",
+		e.Minimum, e.Minimum-e.Subtotal)
+}
+
+// Check returns *BelowMinimumError if the rule refuses an order priced at b.
+func (r SmallOrderRule) Check(b Breakdown) error {
+	if r.Refuse && b.Subtotal < r.Minimum {
+		return &BelowMinimumError{Minimum: r.Minimum, Subtotal: b.Subtotal}
+	}
+	return nil
+}
+
+// LineQuote is a priced line.
+type LineQuote struct {
+	Line
+	Subtotal int
+	Tax      int // VAT included in Subtotal
+}
+
+// Breakdown is the price of an order.
+type Breakdown struct {
+	Lines        []LineQuote
+	Subtotal     int
+	TaxTotal     int // VAT included in Subtotal
+	TransportFee int
+	// SmallOrderFee is charged when Subtotal is under the campus minimum.
+	SmallOrderFee int
+	Total         int
+}
+
+// Quote prices an order. Item prices already include VAT, so tax is
+// reported but never added on top. Lines are quoted at the group's price
+// for them, so LineQuote.UnitPrice may differ from the Line's.
+func Quote(o Order) Breakdown {
+	var b Breakdown
+	if !o.Group.WaiveTransportFee {
+		b.TransportFee = TransportFee(o.ConfirmedToday + 1)
+	}
+	for _, l := range o.Lines {
+		l.UnitPrice = o.Group.Price(l.UnitPrice)
+		q := LineQuote{Line: l, Subtotal: l.UnitPrice * l.Quantity}
+		q.Tax = tax.Included(q.Subtotal, l.TaxRateBps)
+		b.Lines = append(b.Lines, q)
+		b.Subtotal += q.Subtotal
+		b.TaxTotal += q.Tax
+	}
+	if r := o.SmallOrder; !r.Refuse && !o.Group.WaiveSmallOrderFee && b.Subtotal < r.Minimum {
+		b.SmallOrderFee = r.Fee
+	}
+	b.Total = b.Subtotal + b.TransportFee + b.SmallOrderFee
+	return b
+}
+
+// TransportFee is the fee for the student's nth confirmed order of the day:
+// it rises as they split their shopping into more trips.
+func TransportFee(nth int) int {
+	switch {
+	case nth <= 3:
+		return 1000
+	case nth <= 6:
+		return 2000
+	default:
+		return 3000
+	}
+}
@@ -0,0 +1,158 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+)
+
+// basket is two loaves at UGX 4,000 and a litre of juice at UGX 11,800 with
+// 18% VAT: UGX 19,800, of which UGX 1,800 VAT.
+var basket = []Line{
+	{ItemID: 1, Quantity: 2, UnitPrice: 4000},
+	{ItemID: 2, Quantity: 1, UnitPrice: 11800, TaxRateBps: 1800},
+}
+
+func TestQuote(t *testing.T) {
+	minimum := SmallOrderRule{Minimum: 25000, Fee: 1500}
+	tests := []struct {
+		name  string
+		order Order
+		want  Breakdown // only the totals are compared
+	}{
+		{
+			name:  "first order of the day",
+			order: Order{Lines: basket},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, TransportFee: 1000, Total: 20800},
+		},
+		{
+			name:  "3rd order, last of the first tier",
+			order: Order{Lines: basket, ConfirmedToday: 2},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, TransportFee: 1000, Total: 20800},
+		},
+		{
+			name:  "4th order, first of the second tier",
+			order: Order{Lines: basket, ConfirmedToday: 3},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, TransportFee: 2000, Total: 21800},
+		},
+		{
+			name:  "6th order, last of the second tier",
+			order: Order{Lines: basket, ConfirmedToday: 5},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, TransportFee: 2000, Total: 21800},
+		},
+		{
+			name:  "7th order, first of the third tier",
+			order: Order{Lines: basket, ConfirmedToday: 6},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, TransportFee: 3000, Total: 22800},
+		},
+		{
+			name:  "below the campus minimum",
+			order: Order{Lines: basket, SmallOrder: minimum},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, TransportFee: 1000, SmallOrderFee: 1500, Total: 22300},
+		},
+		{
+			name:  "exactly the campus minimum",
+			order: Order{Lines: basket, SmallOrder: SmallOrderRule{Minimum: 19800, Fee: 1500}},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, TransportFee: 1000, Total: 20800},
+		},
+		{
+			name:  "refused small orders are not charged a fee",
+			order: Order{Lines: basket, SmallOrder: SmallOrderRule{Minimum: 25000, Refuse: true}},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, TransportFee: 1000, Total: 20800},
+		},
+		{
+			name:  "group waives the transport fee",
+			order: Order{Lines: basket, ConfirmedToday: 6, Group: Group{WaiveTransportFee: true}},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, Total: 19800},
+		},
+		{
+			name:  "group waives the small-order fee",
+			order: Order{Lines: basket, SmallOrder: minimum, Group: Group{WaiveSmallOrderFee: true}},
+			want:  Breakdown{Subtotal: 19800, TaxTotal: 1800, TransportFee: 1000, Total: 20800},
+		},
+		{
+			name:  "group discount applies to lines, not fees",
+			order: Order{Lines: basket, ConfirmedToday: 3, Group: Group{PriceAdjustBps: -1000}},
+			// 2 × 3,600 + 10,620, with 1,620 VAT in the juice
+			want: Breakdown{Subtotal: 17820, TaxTotal: 1620, TransportFee: 2000, Total: 19820},
+		},
+		{
+			name:  "discount can take an order under the minimum",
+			order: Order{Lines: basket, SmallOrder: SmallOrderRule{Minimum: 19000, Fee: 1500}, Group: Group{PriceAdjustBps: -1000}},
+			want:  Breakdown{Subtotal: 17820, TaxTotal: 1620, TransportFee: 1000, SmallOrderFee: 1500, Total: 20320},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Quote(tt.order)
+			if totals(got) != totals(tt.want) {
+				t.Errorf("Quote() = %+v, want %+v", totals(got), totals(tt.want))
+			}
+		})
+	}
+}
+
+// breakdownTotals is a Breakdown without its lines, so it can be compared with ==.
+type breakdownTotals struct {
+	Subtotal, TaxTotal, TransportFee, SmallOrderFee, Total int
+}
+
+func totals(b Breakdown) breakdownTotals {
+	return breakdownTotals{b.Subtotal, b.TaxTotal, b.TransportFee, b.SmallOrderFee, b.Total}
+}
+
+func TestQuoteLines(t *testing.T) {
+	b := Quote(Order{Lines: basket, Group: Group{PriceAdjustBps: 500}})
+	want := []LineQuote{
+		{Line: Line{ItemID: 1, Quantity: 2, UnitPrice: 4200}, Subtotal: 8400},
+		{Line: Line{ItemID: 2, Quantity: 1, UnitPrice: 12390, TaxRateBps: 1800}, Subtotal: 12390, Tax: 1890},
+	}
+	if len(b.Lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(b.Lines), len(want))
+	}
+	for i := range want {
+		if b.Lines[i] != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i, b.Lines[i], want[i])
+		}
+	}
+}
+
+func TestTransportFee(t *testing.T) {
+	for nth, want := range map[int]int{1: 1000, 3: 1000, 4: 2000, 6: 2000, 7: 3000, 12: 3000} {
+		if got := TransportFee(nth); got != want {
+			t.Errorf("TransportFee(%d) = %d, want %d", nth, got, want)
+		}
+	}
+}
+
+func TestSmallOrderRuleCheck(t *testing.T) {
+	rule := SmallOrderRule{Minimum: 25000, Refuse: true}
+	var below *BelowMinimumError
+	if err := rule.Check(Quote(Order{Lines: basket, SmallOrder: rule})); !errors.As(err, &below) {
+		t.Fatalf("Check() = %v, want *BelowMinimumError", err)
+	} else if below.Minimum != 25000 || below.Subtotal != 19800 {
+		t.Errorf("error = %+v, want minimum 25000 and subtotal 19800", below)
+	}
+	if err := rule.Check(Breakdown{Subtotal: 25000}); err != nil {
+		t.Errorf("Check() at the minimum = %v, want nil", err)
+	}
+	if err := (SmallOrderRule{Minimum: 25000, Fee: 1500}).Check(Breakdown{Subtotal: 100}); err != nil {
+		t.Errorf("Check() with a fee instead = %v, want nil", err)
+	}
+}
+
+func TestGroupPrice(t *testing.T) {
+	tests := []struct {
+		bps, unit, want int
+	}{
+		{0, 4000, 4000},
+		{-1000, 4000, 3600},
+		{500, 4000, 4200},
+		{-1000, 1005, 905}, // 904.5 rounds up
+		{-10000, 4000, 0},
+	}
+	for _, tt := range tests {
+		if got := (Group{PriceAdjustBps: tt.bps}).Price(tt.unit); got != tt.want {
+			t.Errorf("Group{%d}.Price(%d) = %d, want %d", tt.bps, tt.unit, got, tt.want)
+		}
+	}
+}
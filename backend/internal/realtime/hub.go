@@ -0,0 +1,136 @@
+package realtime
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"server/internal/events"
+)
+
+// historySize bounds how many recent events are kept for reconnect-resume.
+const historySize = 512
+
+// Event is a message pushed to a user's WebSocket connections.
+type Event struct {
+	ID     int64           `json:"id"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data"`
+	SentAt time.Time       `json:"sentAt"`
+
+	userID int
+}
+
+// Hub fans events out to the connections of each user and remembers the most
+// recent events so reconnecting clients can resume from their last event ID.
+type Hub struct {
+	mu      sync.Mutex
+	nextID  int64
+	history []Event
+	subs    map[int]map[chan Event]struct{}
+}
+
+// NewHub creates an empty hub.
+func NewHub() *Hub {
+	return &Hub{subs: make(map[int]map[chan Event]struct{})}
+}
+
+// Stats returns the number of users with an open connection and the total
+// number of connections.
+func (h *Hub) Stats() (users, connections int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, conns := range h.subs {
+		if len(conns) > 0 {
+			users++
+			connections += len(conns)
+		}
+	}
+	return users, connections
+}
+
+// Publish delivers an event of the given type to every connection of userID.
+// Slow connections whose buffers are full miss the event and must resume.
+func (h *Hub) Publish(userID int, eventType string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	ev := Event{ID: h.nextID, Type: eventType, Data: raw, SentAt: time.Now(), userID: userID}
+	h.history = append(h.history, ev)
+	if len(h.history) > historySize {
+		h.history = h.history[len(h.history)-historySize:]
+	}
+
+	for ch := range h.subs[userID] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe registers a new connection for userID. It returns the events the
+// user missed after lastEventID, whether that replay is complete (false when
+// the history no longer reaches back that far), the live channel, and a
+// function that must be called to unsubscribe.
+func (h *Hub) Subscribe(userID int, lastEventID int64) ([]Event, bool, <-chan Event, func()) {
+	ch := make(chan Event, 32)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var missed []Event
+	complete := true
+	if lastEventID > 0 {
+		if len(h.history) > 0 && h.history[0].ID > lastEventID+1 {
+			complete = false
+		}
+		for _, ev := range h.history {
+			if ev.ID > lastEventID && ev.userID == userID {
+				missed = append(missed, ev)
+			}
+		}
+	}
+
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan Event]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[userID], ch)
+		if len(h.subs[userID]) == 0 {
+			delete(h.subs, userID)
+		}
+	}
+	return missed, complete, ch, unsubscribe
+}
+
+// Forward subscribes the hub to bus topics whose payloads carry a "userId"
+// field and relays each event to that user's connections. Every server
+// instance forwards every event, since each holds its own connections.
+func (h *Hub) Forward(bus events.Bus, topics ...string) error {
+	for _, topic := range topics {
+		_, err := bus.Subscribe(topic, "", func(ev events.Event) {
+			var target struct {
+				UserID int `json:"userId"`
+			}
+			if err := ev.Decode(&target); err != nil || target.UserID == 0 {
+				return
+			}
+			h.Publish(target.UserID, ev.Topic, ev.Data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
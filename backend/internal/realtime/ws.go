@@ -0,0 +1,118 @@
+package realtime
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/internal/auth"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+)
+
+// MakeWSHandler upgrades an authenticated request to a WebSocket and streams
+// the user's events. Clients resume after a reconnect by passing the last
+// event ID they saw as ?lastEventId= or a Last-Event-ID header.
+func MakeWSHandler(hub *Hub, logger *zap.Logger, allowedOrigins []string) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			for _, o := range allowedOrigins {
+				if o == origin {
+					return true
+				}
+			}
+			return false
+		},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(auth.ContextUserIDKey).(int)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		lastIDStr := r.URL.Query().Get("lastEventId")
+		if lastIDStr == "" {
+			lastIDStr = r.Header.Get("Last-Event-ID")
+		}
+		lastID, _ := strconv.ParseInt(lastIDStr, 10, 64)
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logger.Warn("websocket upgrade failed", zap.Error(err))
+			return
+		}
+		defer conn.Close()
+
+		missed, complete, live, unsubscribe := hub.Subscribe(userID, lastID)
+		defer unsubscribe()
+
+		// Reader: handles pongs and notices when the client goes away.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			conn.SetReadLimit(512)
+			conn.SetReadDeadline(time.Now().Add(pongWait))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(pongWait))
+			})
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		send := func(v interface{}) error {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			return conn.WriteJSON(v)
+		}
+
+		if !complete {
+			// History no longer covers the gap; tell the client to refetch.
+			if err := send(Event{Type: "resync", SentAt: time.Now()}); err != nil {
+				return
+			}
+		}
+		for _, ev := range missed {
+			if err := send(ev); err != nil {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(pingPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case ev := <-live:
+				if err := send(ev); err != nil {
+					return
+				}
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			case <-done:
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
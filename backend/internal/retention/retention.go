@@ -0,0 +1,176 @@
+// Package retention deletes old chat transcripts, LLM call logs, sessions,
+// audit entries, and email logs once they pass their retention period. Each
+// period is an admin setting in days, so it can change without a deploy;
+// Preview shows what a purge would delete before it does.
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// purgeBatch is how many rows one DELETE removes, so a large first purge
+// neither holds locks for long nor bloats one transaction.
+const purgeBatch = 5000
+
+// Policy is how long one table's rows are kept.
+type Policy struct {
+	Table       string
+	Column      string // the timestamp a row's age counts from
+	Setting     string // config key holding the days kept; 0 keeps rows forever
+	DefaultDays int
+}
+
+// Policies lists every table purged.
+var Policies = []Policy{
+	{Table: "chat_turns", Column: "created_at", Setting: "retention.chat_turns_days", DefaultDays: 180},
+	{Table: "llm_log", Column: "created_at", Setting: "chat.llm_log_days", DefaultDays: 7},
+	{Table: "sessions", Column: "expires_at", Setting: "retention.sessions_days", DefaultDays: 30},
+	{Table: "admin_audit_log", Column: "created_at", Setting: "retention.audit_log_days", DefaultDays: 730},
+	{Table: "email_log", Column: "created_at", Setting: "retention.email_log_days", DefaultDays: 365},
+}
+
+// Plan is what a purge of one table would delete.
+type Plan struct {
+	Table   string     `json:"table"`
+	Setting string     `json:"setting"`
+	Days    int        `json:"days"`   // 0 when kept forever
+	Cutoff  *time.Time `json:"cutoff"` // rows older than this go; nil when kept forever
+	Rows    int        `json:"rows"`
+	Oldest  *time.Time `json:"oldest"` // of the rows that would go
+}
+
+// Result is what a purge of one table deleted.
+type Result struct {
+	Table   string `json:"table"`
+	Deleted int64  `json:"deleted"`
+}
+
+// days reads each policy's setting, falling back to its default when unset
+// or not a whole number of days.
+func days(ctx context.Context, db *sql.DB) (map[string]int, error) {
+	keys := make([]string, len(Policies))
+	out := make(map[string]int, len(Policies))
+	for i, p := range Policies {
+		keys[i] = p.Setting
+		out[p.Setting] = p.DefaultDays
+	}
+	rows, err := db.QueryContext(ctx, `SELECT key, value_json FROM config WHERE key = ANY($1)`, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var value json.RawMessage
+		var n int
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		if json.Unmarshal(value, &n) == nil && n >= 0 {
+			out[key] = n
+		}
+	}
+	return out, rows.Err()
+}
+
+// cutoff is the time before which p's rows go, or false if kept forever.
+func cutoff(now time.Time, n int) (time.Time, bool) {
+	if n <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -n), true
+}
+
+// Preview counts, without deleting anything, the rows each policy would
+// purge now.
+func Preview(ctx context.Context, db *sql.DB) ([]Plan, error) {
+	settings, err := days(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	plans := make([]Plan, 0, len(Policies))
+	for _, p := range Policies {
+		plan := Plan{Table: p.Table, Setting: p.Setting, Days: settings[p.Setting]}
+		if before, ok := cutoff(now, plan.Days); ok {
+			plan.Cutoff = &before
+			var oldest sql.NullTime
+			if err := db.QueryRowContext(ctx,
+				fmt.Sprintf(`SELECT COUNT(*), MIN(%[2]s) FROM %[1]s WHERE %[2]s < $1`, p.Table, p.Column), before,
+			).Scan(&plan.Rows, &oldest); err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Table, err)
+			}
+			if oldest.Valid {
+				plan.Oldest = &oldest.Time
+			}
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// Purge deletes every row past its table's retention period, in batches,
+// counting deletions in purged by table if it is not nil.
+func Purge(ctx context.Context, db *sql.DB, purged *prometheus.CounterVec) ([]Result, error) {
+	settings, err := days(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	results := make([]Result, 0, len(Policies))
+	for _, p := range Policies {
+		r := Result{Table: p.Table}
+		before, ok := cutoff(now, settings[p.Setting])
+		for ok {
+			res, err := db.ExecContext(ctx,
+				fmt.Sprintf(`DELETE FROM %[1]s WHERE ctid IN (SELECT ctid FROM %[1]s WHERE %[2]s < $1 LIMIT $2)`, p.Table, p.Column),
+				before, purgeBatch)
+			if err != nil {
+				return results, fmt.Errorf("%s: %w", p.Table, err)
+			}
+			n, _ := res.RowsAffected()
+			r.Deleted += n
+			if purged != nil {
+				purged.WithLabelValues(p.Table).Add(float64(n))
+			}
+			ok = n == purgeBatch
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// Run purges every interval until ctx is done.
+func Run(ctx context.Context, db *sql.DB, logger *zap.Logger, purged *prometheus.CounterVec, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		results, err := Purge(ctx, db, purged)
+		if err != nil {
+			logger.Error("retention purge failed", zap.Error(err))
+		}
+		var fields []zap.Field
+		for _, r := range results {
+			if r.Deleted > 0 {
+				fields = append(fields, zap.Int64(r.Table, r.Deleted))
+			}
+		}
+		if len(fields) > 0 {
+			logger.Info("purged expired rows", fields...)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// AWS reads secrets from one AWS Secrets Manager secret whose SecretString
+// is a JSON object keyed by secret name. Requests are signed with SigV4 using
+// the standard AWS_* credential environment variables.
+type AWS struct {
+	Region       string
+	SecretID     string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	client *http.Client
+}
+
+// NewAWSFromEnv configures Secrets Manager from AWS_REGION,
+// AWS_SECRET_ID, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and the optional
+// AWS_SESSION_TOKEN.
+func NewAWSFromEnv() (*AWS, error) {
+	a := &AWS{
+		Region:       os.Getenv("AWS_REGION"),
+		SecretID:     os.Getenv("AWS_SECRET_ID"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	if a.Region == "" || a.SecretID == "" || a.AccessKey == "" || a.SecretKey == "" {
+		return nil, fmt.Errorf("AWS_REGION, AWS_SECRET_ID, AWS_ACCESS_KEY_ID, and AWS_SECRET_ACCESS_KEY are required")
+	}
+	return a, nil
+}
+
+// Get implements Provider.
+func (a *AWS) Get(ctx context.Context, name string) (string, error) {
+	payload, _ := json.Marshal(map[string]string{"SecretId": a.SecretID})
+	host := fmt.Sprintf("secretsmanager.%s.amazonaws.com", a.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, host, payload, time.Now().UTC())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secretsmanager: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secretsmanager: status %d: %s", resp.StatusCode, body)
+	}
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("secretsmanager: %w", err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal([]byte(out.SecretString), &values); err != nil {
+		return "", fmt.Errorf("secretsmanager: secret is not a JSON object: %w", err)
+	}
+	val, ok := values[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return val, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header.
+func (a *AWS) sign(req *http.Request, host string, payload []byte, now time.Time) {
+	const service = "secretsmanager"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("Host", host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	signedHeaders := "content-type;host;x-amz-date;x-amz-target"
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-date:%s\nx-amz-target:%s\n",
+		req.Header.Get("Content-Type"), host, amzDate, req.Header.Get("X-Amz-Target"))
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+		signedHeaders = "content-type;host;x-amz-date;x-amz-security-token;x-amz-target"
+		canonicalHeaders = fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-date:%s\nx-amz-security-token:%s\nx-amz-target:%s\n",
+			req.Header.Get("Content-Type"), host, amzDate, a.SessionToken, req.Header.Get("X-Amz-Target"))
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := fmt.Sprintf("POST\n/\n\n%s\n%s\n%s",
+		canonicalHeaders, signedHeaders, hex.EncodeToString(payloadHash[:]))
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, a.Region, service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", amzDate, scope, hex.EncodeToString(requestHash[:]))
+
+	key := hmacSHA256([]byte("AWS4"+a.SecretKey), date)
+	key = hmacSHA256(key, a.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,139 @@
+// Package secrets resolves credentials such as SMTP passwords and API keys
+// from the environment, mounted files, HashiCorp Vault, or AWS Secrets
+// Manager, and can watch them for rotation.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a provider has no value for a secret.
+var ErrNotFound = errors.New("secret not found")
+
+// Provider looks up a secret by its environment-style name, e.g. "SMTP_PASS".
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Env reads secrets from environment variables.
+type Env struct{}
+
+// Get implements Provider.
+func (Env) Get(_ context.Context, name string) (string, error) {
+	if v, ok := os.LookupEnv(name); ok && v != "" {
+		return v, nil
+	}
+	return "", ErrNotFound
+}
+
+// Files reads secrets from files in Dir, one per secret, as written by
+// Kubernetes or Docker secret mounts. The file may be named exactly like the
+// secret or in lower case ("SMTP_PASS" or "smtp_pass").
+type Files struct {
+	Dir string
+}
+
+// Get implements Provider.
+func (f Files) Get(_ context.Context, name string) (string, error) {
+	for _, file := range []string{name, strings.ToLower(name)} {
+		b, err := os.ReadFile(filepath.Join(f.Dir, file))
+		if err == nil {
+			return strings.TrimSpace(string(b)), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Chain asks each provider in turn and returns the first value found.
+type Chain []Provider
+
+// Get implements Provider.
+func (c Chain) Get(ctx context.Context, name string) (string, error) {
+	for _, p := range c {
+		v, err := p.Get(ctx, name)
+		if err == nil {
+			return v, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return "", ErrNotFound
+}
+
+// FromEnv builds the provider selected by SECRETS_PROVIDER ("env" by
+// default, "file", "vault", or "aws"). Non-env providers fall back to the
+// environment so unmanaged settings keep working.
+func FromEnv() (Provider, error) {
+	switch p := os.Getenv("SECRETS_PROVIDER"); p {
+	case "", "env":
+		return Env{}, nil
+	case "file":
+		dir := os.Getenv("SECRETS_DIR")
+		if dir == "" {
+			dir = "/run/secrets"
+		}
+		return Chain{Files{Dir: dir}, Env{}}, nil
+	case "vault":
+		v, err := NewVaultFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return Chain{v, Env{}}, nil
+	case "aws":
+		a, err := NewAWSFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return Chain{a, Env{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q", p)
+	}
+}
+
+// Watch polls names every interval and calls onChange with the full set of
+// current values whenever any of them changes, until ctx is done. Lookup
+// errors are passed to onError and the previous values are kept.
+func Watch(ctx context.Context, p Provider, names []string, interval time.Duration,
+	onChange func(map[string]string), onError func(error)) {
+	last := map[string]string{}
+	for _, n := range names {
+		last[n], _ = p.Get(ctx, n)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := make(map[string]string, len(names))
+		changed, failed := false, false
+		for _, n := range names {
+			v, err := p.Get(ctx, n)
+			if err != nil {
+				onError(fmt.Errorf("%s: %w", n, err))
+				failed = true
+				break
+			}
+			current[n] = v
+			changed = changed || v != last[n]
+		}
+		if !failed && changed {
+			last = current
+			onChange(current)
+		}
+	}
+}
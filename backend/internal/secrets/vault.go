@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Vault reads secrets from one KV v2 secret in HashiCorp Vault; each secret
+// name is a key in that secret's data.
+type Vault struct {
+	Addr  string // e.g. "https://vault.internal:8200"
+	Token string
+	Mount string // KV v2 mount, e.g. "secret"
+	Path  string // e.g. "jaj/server"
+
+	client *http.Client
+}
+
+// NewVaultFromEnv configures Vault from VAULT_ADDR, VAULT_TOKEN,
+// VAULT_KV_MOUNT (default "secret"), and VAULT_SECRET_PATH.
+func NewVaultFromEnv() (*Vault, error) {
+	v := &Vault{
+		Addr:   strings.TrimRight(os.Getenv("VAULT_ADDR"), "/"),
+		Token:  os.Getenv("VAULT_TOKEN"),
+		Mount:  os.Getenv("VAULT_KV_MOUNT"),
+		Path:   os.Getenv("VAULT_SECRET_PATH"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if v.Mount == "" {
+		v.Mount = "secret"
+	}
+	if v.Addr == "" || v.Token == "" || v.Path == "" {
+		return nil, fmt.Errorf("VAULT_ADDR, VAULT_TOKEN, and VAULT_SECRET_PATH are required")
+	}
+	return v, nil
+}
+
+// Get implements Provider. The secret is re-read on every call so rotated
+// values are picked up by Watch.
+func (v *Vault) Get(ctx context.Context, name string) (string, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", v.Addr, v.Mount, v.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	val, ok := body.Data.Data[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return val, nil
+}
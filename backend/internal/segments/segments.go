@@ -0,0 +1,165 @@
+// Package segments sorts students into segments, such as new students or
+// those at risk of churning, for admin analytics and campaign audiences.
+// Segments are computed nightly into the user_segments table rather than on
+// every read, so filtering by them is an index lookup.
+package segments
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+
+	"server/internal/locale"
+)
+
+// Segments a student can be in.
+const (
+	New          = "NEW"           // signed up in the last 7 days
+	WeeklyActive = "WEEKLY_ACTIVE" // signed in or ordered in the last 7 days
+	ChurnRisk    = "CHURN_RISK"    // has ordered, but not in the last 14 days
+	HighSpender  = "HIGH_SPENDER"  // top tenth by spending over the last 30 days
+)
+
+// All lists every segment.
+var All = []string{New, WeeklyActive, ChurnRisk, HighSpender}
+
+// refreshHour is the Kampala hour after which each day's refresh runs.
+const refreshHour = 2
+
+// members selects each segment's user IDs.
+var members = map[string]string{
+	New: `SELECT id FROM users WHERE created_at >= NOW() - INTERVAL '7 days'`,
+	WeeklyActive: `SELECT id FROM users u
+	                WHERE EXISTS (SELECT 1 FROM sessions s WHERE s.user_id = u.id AND s.created_at >= NOW() - INTERVAL '7 days')
+	                   OR EXISTS (SELECT 1 FROM orders o WHERE o.user_id = u.id AND o.created_at >= NOW() - INTERVAL '7 days')`,
+	ChurnRisk: `SELECT user_id FROM all_orders
+	             WHERE status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+	             GROUP BY user_id
+	            HAVING MAX(created_at) < NOW() - INTERVAL '14 days'`,
+	HighSpender: `SELECT user_id FROM (
+	                SELECT user_id, PERCENT_RANK() OVER (ORDER BY SUM(total_cost)) AS rank
+	                  FROM orders
+	                 WHERE status IN ('CONFIRMED', 'PACKED', 'FULFILLED') AND created_at >= NOW() - INTERVAL '30 days'
+	                 GROUP BY user_id) spend
+	               WHERE rank >= 0.9`,
+}
+
+// Count is one segment's size as of its last refresh.
+type Count struct {
+	Segment    string     `json:"segment"`
+	Users      int        `json:"users"`
+	ComputedAt *time.Time `json:"computedAt"` // nil until first computed
+}
+
+// Refresh recomputes every segment in one transaction, so readers see
+// either the old segments or the new ones, and returns their sizes.
+func Refresh(ctx context.Context, db *sql.DB) ([]Count, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// One refresh at a time across instances
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('user-segments'))`); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_segments`); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	counts := make([]Count, 0, len(All))
+	for _, segment := range All {
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO user_segments (user_id, segment, computed_at)
+			 SELECT m.id, $1, $2 FROM (`+members[segment]+`) AS m(id)`,
+			segment, now)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := res.RowsAffected()
+		counts = append(counts, Count{Segment: segment, Users: int(n), ComputedAt: &now})
+	}
+	return counts, tx.Commit()
+}
+
+// Counts returns each segment's size and when it was last computed.
+func Counts(ctx context.Context, db *sql.DB) ([]Count, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT segment, COUNT(*), MAX(computed_at) FROM user_segments GROUP BY segment`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bySegment := make(map[string]Count, len(All))
+	for rows.Next() {
+		var c Count
+		var at time.Time
+		if err := rows.Scan(&c.Segment, &c.Users, &at); err != nil {
+			return nil, err
+		}
+		c.ComputedAt = &at
+		bySegment[c.Segment] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	counts := make([]Count, 0, len(All))
+	for _, segment := range All {
+		c, ok := bySegment[segment]
+		if !ok {
+			c = Count{Segment: segment}
+		}
+		counts = append(counts, c)
+	}
+	return counts, nil
+}
+
+// due reports whether the segments were last computed before today's
+// refresh time, in Kampala.
+func due(ctx context.Context, db *sql.DB, now time.Time) (bool, error) {
+	local := now.In(locale.EAT)
+	since := time.Date(local.Year(), local.Month(), local.Day(), refreshHour, 0, 0, 0, locale.EAT)
+	if local.Before(since) {
+		since = since.AddDate(0, 0, -1)
+	}
+	var last sql.NullTime
+	if err := db.QueryRowContext(ctx, `SELECT MAX(computed_at) FROM user_segments`).Scan(&last); err != nil {
+		return false, err
+	}
+	return !last.Valid || last.Time.Before(since), nil
+}
+
+// RunNightly checks every interval until ctx is done whether the day's
+// refresh is due, and refreshes the segments when it is.
+func RunNightly(ctx context.Context, db *sql.DB, logger *zap.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if ok, err := due(ctx, db, time.Now()); err != nil {
+			logger.Error("user segment check failed", zap.Error(err))
+			continue
+		} else if !ok {
+			continue
+		}
+		counts, err := Refresh(ctx, db)
+		if err != nil {
+			logger.Error("user segment refresh failed", zap.Error(err))
+			continue
+		}
+		fields := make([]zap.Field, 0, len(counts))
+		for _, c := range counts {
+			fields = append(fields, zap.Int(c.Segment, c.Users))
+		}
+		logger.Info("refreshed user segments", fields...)
+	}
+}
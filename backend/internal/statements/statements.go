@@ -0,0 +1,143 @@
+// Package statements emails each active student a summary of their month:
+// orders placed, money spent, transport fees, promo savings, and wallet
+// balance.
+package statements
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"server/internal/email"
+	"server/internal/locale"
+
+	"go.uber.org/zap"
+)
+
+// Statement is one student's month.
+type Statement struct {
+	UserID int
+	Email  string
+	email.StatementData
+}
+
+// LastMonth returns the first day of the month before now, in Kampala.
+func LastMonth(now time.Time) time.Time {
+	local := now.In(locale.EAT)
+	return time.Date(local.Year(), local.Month()-1, 1, 0, 0, 0, 0, locale.EAT)
+}
+
+// Due returns the statements for month (its first day) still to be sent:
+// one per opted-in student with a confirmed or fulfilled order placed that
+// month. Promo savings are the month's DISCOUNT ledger entries; the wallet
+// balance is what issued wallet refunds credited, as of now, including
+// refunds on archived orders.
+func Due(ctx context.Context, db *sql.DB, month time.Time) ([]Statement, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT u.id, u.email, u.username,
+		        COUNT(o.id), SUM(o.total_cost), SUM(o.transport_fee),
+		        COALESCE((SELECT -SUM(l.amount)
+		                    FROM ledger_entries l JOIN orders lo ON lo.id = l.order_id
+		                   WHERE lo.user_id = u.id AND l.entry_type = 'DISCOUNT'
+		                     AND lo.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		                     AND lo.created_at >= $1 AND lo.created_at < $2), 0),
+		        COALESCE((SELECT SUM(r.amount)
+		                    FROM refunds r JOIN all_orders ro ON ro.id = r.order_id
+		                   WHERE ro.user_id = u.id AND r.method = 'WALLET' AND r.status = 'ISSUED'), 0),
+		        c.currency, c.time_zone
+		   FROM users u
+		   JOIN campuses c ON c.name = u.campus
+		   JOIN orders o ON o.user_id = u.id
+		  WHERE u.monthly_statement
+		    AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		    AND o.created_at >= $1 AND o.created_at < $2
+		    AND NOT EXISTS (SELECT 1 FROM statement_sends s WHERE s.user_id = u.id AND s.month = $3)
+		  GROUP BY u.id, c.name
+		  ORDER BY u.id`,
+		month, month.AddDate(0, 1, 0), month.Format("2006-01-02"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []Statement
+	for rows.Next() {
+		s := Statement{StatementData: email.StatementData{Month: month.Format("January 2006")}}
+		var currency, timeZone string
+		if err := rows.Scan(&s.UserID, &s.Email, &s.Username,
+			&s.Orders, &s.TotalSpent, &s.TransportFees, &s.PromoSavings, &s.WalletBalance, &currency, &timeZone); err != nil {
+			return nil, err
+		}
+		// An unusable setting leaves the zero Locale, which is the default
+		s.Locale, _ = locale.Load(currency, timeZone)
+		due = append(due, s)
+	}
+	return due, rows.Err()
+}
+
+// Send mails the statements due for month and returns how many went out.
+// Each send is claimed in statement_sends first, so concurrent runs never
+// double-send; a failed send releases its claim for the next run, unless the
+// address is suppressed.
+func Send(ctx context.Context, db *sql.DB, mailer *email.Client, logger *zap.Logger, month time.Time) (int, error) {
+	due, err := Due(ctx, db, month)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, s := range due {
+		res, err := db.ExecContext(ctx,
+			`INSERT INTO statement_sends (user_id, month) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			s.UserID, month.Format("2006-01-02"))
+		if err != nil {
+			return sent, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // another instance has it
+		}
+		s.UnsubscribeURL = mailer.UnsubscribeURL(s.UserID, email.ListStatements)
+		err = mailer.SendStatementEmail(s.Email, s.StatementData)
+		if errors.Is(err, email.ErrSuppressed) {
+			continue // retrying will not help; keep the claim
+		}
+		if err != nil {
+			logger.Error("failed to send monthly statement", zap.Int("user_id", s.UserID), zap.Error(err))
+			if _, err := db.ExecContext(ctx,
+				`DELETE FROM statement_sends WHERE user_id = $1 AND month = $2`,
+				s.UserID, month.Format("2006-01-02")); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// RunMonthly sends last month's statements every interval until ctx is done.
+// Sends are recorded, so each run only picks up students not yet mailed and
+// the first run after midnight on the 1st does the bulk of the work.
+func RunMonthly(ctx context.Context, db *sql.DB, mailer *email.Client, logger *zap.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		month := LastMonth(time.Now())
+		sent, err := Send(ctx, db, mailer, logger, month)
+		if err != nil {
+			logger.Error("monthly statements failed", zap.String("month", month.Format("2006-01")), zap.Error(err))
+			continue
+		}
+		if sent > 0 {
+			logger.Info("sent monthly statements", zap.String("month", month.Format("2006-01")), zap.Int("statements", sent))
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package support
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"go.uber.org/zap"
+)
+
+// MakeHandler routes the student's support endpoints under /support/tickets:
+// open and list tickets, read one, reply, and mark it resolved. All of them
+// need a session, and students only ever see their own tickets.
+func MakeHandler(db *sql.DB, logger *zap.Logger) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /support/tickets", func(w http.ResponseWriter, r *http.Request) {
+		handleOpen(w, r, db, logger)
+	})
+	mux.HandleFunc("GET /support/tickets", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(auth.ContextUserIDKey).(int)
+		tickets, err := ForUser(r.Context(), db, userID)
+		if err != nil {
+			logger.Error("failed to list support tickets", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tickets)
+	})
+	mux.HandleFunc("GET /support/tickets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		t, ok := ownTicket(w, r, db, logger)
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	})
+	mux.HandleFunc("POST /support/tickets/{id}/messages", func(w http.ResponseWriter, r *http.Request) {
+		handleReply(w, r, db, logger)
+	})
+	mux.HandleFunc("POST /support/tickets/{id}/resolve", func(w http.ResponseWriter, r *http.Request) {
+		t, ok := ownTicket(w, r, db, logger)
+		if !ok {
+			return
+		}
+		if err := SetStatus(r.Context(), db, t.ID, StatusResolved); err != nil {
+			logger.Error("failed to resolve support ticket", zap.Int("ticket_id", t.ID), zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+// ownTicket loads the ticket named in the path, answering 404 for tickets
+// that do not exist or belong to someone else.
+func ownTicket(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) (Ticket, bool) {
+	userID, _ := r.Context().Value(auth.ContextUserIDKey).(int)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid ticket id", http.StatusBadRequest)
+		return Ticket{}, false
+	}
+	t, err := Get(r.Context(), db, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && t.UserID != userID) {
+		httpx.WriteError(w, domain.NotFound("ticket not found"))
+		return Ticket{}, false
+	} else if err != nil {
+		logger.Error("failed to load support ticket", zap.Int("ticket_id", id), zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return Ticket{}, false
+	}
+	t.forCustomer()
+	return t, true
+}
+
+// handleOpen files a new ticket, optionally about one of the student's
+// orders.
+func handleOpen(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+
+	var req NewTicket
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+	id, err := Open(ctx, db, userID, req)
+	if err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to open support ticket", zap.Error(err))
+		}
+		return
+	}
+
+	t, err := Get(ctx, db, id)
+	if err != nil {
+		logger.Error("failed to load support ticket", zap.Int("ticket_id", id), zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// handleReply adds the student's message to their ticket, reopening it if
+// it was resolved.
+func handleReply(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	t, ok := ownTicket(w, r, db, logger)
+	if !ok {
+		return
+	}
+	var req Reply
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+	if err := AddMessage(ctx, db, t.ID, t.UserID, false, req.Body); err != nil {
+		logger.Error("failed to add support message", zap.Int("ticket_id", t.ID), zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	id := t.ID
+	t, err := Get(ctx, db, id)
+	if err != nil {
+		logger.Error("failed to load support ticket", zap.Int("ticket_id", id), zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	t.forCustomer()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
@@ -0,0 +1,273 @@
+// Package support holds customer support tickets about orders: a student
+// opens one, then they and staff exchange messages on it until it is
+// resolved.
+package support
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/email"
+)
+
+// Ticket statuses. OPEN tickets wait on staff and ANSWERED ones on the
+// customer; a RESOLVED ticket reopens when the customer writes again.
+const (
+	StatusOpen     = "OPEN"
+	StatusAnswered = "ANSWERED"
+	StatusResolved = "RESOLVED"
+)
+
+// ErrUnknownOrder means the ticket names an order the customer did not place.
+var ErrUnknownOrder = domain.Invalid("orderId", "no such order on your account")
+
+// Ticket is a support ticket, with its messages oldest first when loaded
+// with Get.
+type Ticket struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	Username  string    `json:"username"`
+	OrderID   *int      `json:"orderId"`
+	Category  string    `json:"category"`
+	Subject   string    `json:"subject"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Messages  []Message `json:"messages,omitempty"`
+}
+
+// Message is one message on a ticket.
+type Message struct {
+	ID        int       `json:"id"`
+	Author    string    `json:"author"`
+	FromStaff bool      `json:"fromStaff"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// NewTicket is the body of POST /support/tickets.
+type NewTicket struct {
+	OrderID  *int   `json:"orderId" validate:"min=1"`
+	Category string `json:"category" validate:"required,oneof=WRONG_ITEM MISSING_ITEM DAMAGED_ITEM OTHER"`
+	Subject  string `json:"subject" validate:"required,max=120"`
+	Message  string `json:"message" validate:"required,max=4000"`
+}
+
+// Reply is the body of a new message on a ticket.
+type Reply struct {
+	Body string `json:"body" validate:"required,max=4000"`
+}
+
+const ticketColumns = `t.id, t.user_id, u.username, t.order_id, t.category, t.subject, t.status, t.created_at, t.updated_at`
+
+func scanTicket(row interface{ Scan(...interface{}) error }, t *Ticket) error {
+	var orderID sql.NullInt64
+	if err := row.Scan(&t.ID, &t.UserID, &t.Username, &orderID, &t.Category, &t.Subject,
+		&t.Status, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return err
+	}
+	if orderID.Valid {
+		id := int(orderID.Int64)
+		t.OrderID = &id
+	}
+	return nil
+}
+
+// Open files a ticket for userID with its first message and returns its id.
+func Open(ctx context.Context, db *sql.DB, userID int, req NewTicket) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The subject goes into email subject lines, so keep it to one line
+	req.Subject = strings.Join(strings.Fields(req.Subject), " ")
+	if req.OrderID != nil {
+		var owner int
+		err := tx.QueryRowContext(ctx, `SELECT user_id FROM orders WHERE id = $1`, *req.OrderID).Scan(&owner)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && owner != userID) {
+			return 0, ErrUnknownOrder
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	var id int
+	if err := tx.QueryRowContext(ctx,
+		`INSERT INTO support_tickets (user_id, order_id, category, subject) VALUES ($1, $2, $3, $4) RETURNING id`,
+		userID, req.OrderID, req.Category, req.Subject,
+	).Scan(&id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO support_messages (ticket_id, author_id, body) VALUES ($1, $2, $3)`,
+		id, userID, req.Message,
+	); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// Get loads a ticket and its messages, or sql.ErrNoRows.
+func Get(ctx context.Context, db *sql.DB, ticketID int) (Ticket, error) {
+	var t Ticket
+	if err := scanTicket(db.QueryRowContext(ctx,
+		`SELECT `+ticketColumns+` FROM support_tickets t JOIN users u ON u.id = t.user_id WHERE t.id = $1`,
+		ticketID,
+	), &t); err != nil {
+		return Ticket{}, err
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT m.id, COALESCE(u.username, ''), m.from_staff, m.body, m.created_at
+		   FROM support_messages m
+		   LEFT JOIN users u ON u.id = m.author_id
+		  WHERE m.ticket_id = $1
+		  ORDER BY m.created_at, m.id`,
+		ticketID,
+	)
+	if err != nil {
+		return Ticket{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.Author, &m.FromStaff, &m.Body, &m.CreatedAt); err != nil {
+			return Ticket{}, err
+		}
+		t.Messages = append(t.Messages, m)
+	}
+	return t, rows.Err()
+}
+
+// forCustomer hides which admin wrote each staff message; customers hear
+// from the team.
+func (t *Ticket) forCustomer() {
+	for i := range t.Messages {
+		if t.Messages[i].FromStaff {
+			t.Messages[i].Author = "JAJ Support"
+		}
+	}
+}
+
+// ForUser returns userID's tickets, most recently active first.
+func ForUser(ctx context.Context, db *sql.DB, userID int) ([]Ticket, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+ticketColumns+` FROM support_tickets t JOIN users u ON u.id = t.user_id
+		  WHERE t.user_id = $1
+		  ORDER BY t.updated_at DESC, t.id DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []Ticket{}
+	for rows.Next() {
+		var t Ticket
+		if err := scanTicket(rows, &t); err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, t)
+	}
+	return tickets, rows.Err()
+}
+
+// Queue returns tickets in status (all when empty) for staff, the longest
+// waiting first, with the total for paging.
+func Queue(ctx context.Context, db *sql.DB, status string, limit, offset int) ([]Ticket, int, error) {
+	var total int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM support_tickets WHERE $1 = '' OR status = $1`, status,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT `+ticketColumns+` FROM support_tickets t JOIN users u ON u.id = t.user_id
+		  WHERE $1 = '' OR t.status = $1
+		  ORDER BY t.status = 'OPEN' DESC, t.updated_at, t.id
+		  LIMIT $2 OFFSET $3`,
+		status, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var tickets []Ticket
+	for rows.Next() {
+		var t Ticket
+		if err := scanTicket(rows, &t); err != nil {
+			return nil, 0, err
+		}
+		tickets = append(tickets, t)
+	}
+	return tickets, total, rows.Err()
+}
+
+// AddMessage appends a message to a ticket and hands it to the other side:
+// a customer message (re)opens the ticket, a staff one marks it ANSWERED.
+// It returns sql.ErrNoRows when there is no such ticket.
+func AddMessage(ctx context.Context, db *sql.DB, ticketID, authorID int, fromStaff bool, body string) error {
+	status := StatusOpen
+	if fromStaff {
+		status = StatusAnswered
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE support_tickets SET status = $2, updated_at = NOW() WHERE id = $1`, ticketID, status)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO support_messages (ticket_id, author_id, from_staff, body) VALUES ($1, NULLIF($2, 0), $3, $4)`,
+		ticketID, authorID, fromStaff, body,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetStatus moves a ticket to status, or returns sql.ErrNoRows.
+func SetStatus(ctx context.Context, db *sql.DB, ticketID int, status string) error {
+	res, err := db.ExecContext(ctx,
+		`UPDATE support_tickets SET status = $2, updated_at = NOW() WHERE id = $1`, ticketID, status)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// NotifyReply emails the ticket's customer a staff reply.
+func NotifyReply(ctx context.Context, db *sql.DB, mailer *email.Client, t Ticket, body string) error {
+	user, err := auth.LoadUser(ctx, db, t.UserID)
+	if err != nil {
+		return err
+	}
+	return mailer.SendSupportReplyEmail(user.Email, email.SupportReplyData{
+		Username: user.Username,
+		TicketID: t.ID,
+		Subject:  t.Subject,
+		Reply:    body,
+	})
+}
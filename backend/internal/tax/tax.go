@@ -0,0 +1,47 @@
+// Package tax works out the VAT contained in item prices. Catalog prices are
+// VAT-inclusive, so tax lines never change what the customer pays.
+package tax
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Class is a named tax rate.
+type Class struct {
+	Code    string `json:"code" validate:"required,max=20"`
+	Name    string `json:"name" validate:"required,max=100"`
+	RateBps int    `json:"rateBps" validate:"min=0,max=10000"` // basis points, 1800 = 18%
+}
+
+type queryer interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// RateForItem returns the tax rate, in basis points, of the item's category.
+// Categories without a tax class are untaxed.
+func RateForItem(ctx context.Context, q queryer, itemID int) (int, error) {
+	var rate int
+	err := q.QueryRowContext(ctx,
+		`SELECT COALESCE(tc.rate_bps, 0)
+		   FROM items i
+		   LEFT JOIN category_tax_classes ct ON ct.category = i.category
+		   LEFT JOIN tax_classes tc ON tc.code = ct.tax_class
+		  WHERE i.id = $1`,
+		itemID,
+	).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return rate, err
+}
+
+// Included returns the tax contained in a tax-inclusive amount, rounded to
+// the nearest shilling.
+func Included(amount, rateBps int) int {
+	if rateBps <= 0 {
+		return 0
+	}
+	d := 10000 + rateBps
+	return (amount*rateBps + d/2) / d
+}
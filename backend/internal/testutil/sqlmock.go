@@ -0,0 +1,39 @@
+// Package testutil holds helpers shared by the packages' tests.
+package testutil
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+// NewMock returns a mocked database whose statements are expected by a
+// distinctive fragment of their SQL, matched after runs of whitespace are
+// collapsed to one space. The database is closed, and any expectation not
+// met is reported, when the test ends.
+func NewMock(t testing.TB) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(
+		func(fragment, actual string) error {
+			if !strings.Contains(spaces.ReplaceAllString(actual, " "), fragment) {
+				return fmt.Errorf("statement does not contain %q", fragment)
+			}
+			return nil
+		})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return db, mock
+}
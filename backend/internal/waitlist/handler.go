@@ -0,0 +1,185 @@
+package waitlist
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"server/internal/auth"
+	"server/internal/domain"
+	"server/internal/httpx"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// JoinRequest is the body of POST /waitlist: the order the student could not
+// place.
+type JoinRequest struct {
+	Items []Item `json:"items" validate:"required,min=1,max=50"`
+}
+
+// ClaimItem is a prefilled order line, priced as of now.
+type ClaimItem struct {
+	ItemID    int    `json:"itemId"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice int    `json:"unitPrice"`
+}
+
+// MakeHandler routes the student's waitlist endpoints: join, check, and leave
+// at /waitlist, and the prefilled order behind a claim link at
+// /waitlist/claim?token=. All of them need a session.
+func MakeHandler(db *sql.DB, logger *zap.Logger) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /waitlist", func(w http.ResponseWriter, r *http.Request) {
+		handleJoin(w, r, db, logger)
+	})
+	mux.HandleFunc("GET /waitlist", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(auth.ContextUserIDKey).(int)
+		e, err := Current(r.Context(), db, userID)
+		if err == sql.ErrNoRows {
+			httpx.WriteError(w, domain.NotFound("not on the waitlist"))
+			return
+		} else if err != nil {
+			logger.Error("failed to load waitlist entry", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e)
+	})
+	mux.HandleFunc("DELETE /waitlist", func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(auth.ContextUserIDKey).(int)
+		left, err := Leave(r.Context(), db, userID)
+		if err != nil {
+			logger.Error("failed to leave waitlist", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !left {
+			httpx.WriteError(w, domain.NotFound("not on the waitlist"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /waitlist/claim", func(w http.ResponseWriter, r *http.Request) {
+		handleClaim(w, r, db, logger)
+	})
+
+	return mux
+}
+
+// handleJoin adds the student to the waitlist for the items they wanted.
+func handleJoin(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+
+	var req JoinRequest
+	if !httpx.DecodeJSON(w, r, &req) {
+		return
+	}
+
+	ids := make([]int64, len(req.Items))
+	for i, it := range req.Items {
+		ids[i] = int64(it.ItemID)
+	}
+	var known int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM items WHERE id = ANY($1)`, pq.Array(ids),
+	).Scan(&known); err != nil {
+		logger.Error("failed to check waitlist items", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if known != len(distinct(ids)) {
+		http.Error(w, "unknown item", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := Join(ctx, db, userID, req.Items); err != nil {
+		if httpx.WriteError(w, err) == http.StatusInternalServerError {
+			logger.Error("failed to join waitlist", zap.Error(err))
+		}
+		return
+	}
+
+	e, err := Current(ctx, db, userID)
+	if err != nil {
+		logger.Error("failed to load waitlist entry", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(e)
+}
+
+// handleClaim returns the order held for the student, for the client to
+// prefill before they POST /orders. Confirming any order uses up the claim.
+func handleClaim(w http.ResponseWriter, r *http.Request, db *sql.DB, logger *zap.Logger) {
+	ctx := r.Context()
+	userID, _ := ctx.Value(auth.ContextUserIDKey).(int)
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	var ownerID int
+	var status string
+	var expires time.Time
+	var raw []byte
+	err := db.QueryRowContext(ctx,
+		`SELECT user_id, status, claim_expires, items FROM waitlist WHERE claim_token = $1`, token,
+	).Scan(&ownerID, &status, &expires, &raw)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID) {
+		httpx.WriteError(w, domain.NotFound("claim not found"))
+		return
+	} else if err != nil {
+		logger.Error("failed to load waitlist claim", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if status != StatusNotified || !expires.After(time.Now()) {
+		http.Error(w, "this claim has expired or was already used", http.StatusGone)
+		return
+	}
+
+	var items []Item
+	if err := json.Unmarshal(raw, &items); err != nil {
+		logger.Error("corrupt waitlist items", zap.String("token", token), zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	claim := make([]ClaimItem, 0, len(items))
+	for _, it := range items {
+		c := ClaimItem{ItemID: it.ItemID, Quantity: it.Quantity}
+		if err := db.QueryRowContext(ctx,
+			`SELECT name, item_price(id, NOW()) FROM items WHERE id = $1`, it.ItemID,
+		).Scan(&c.Name, &c.UnitPrice); err == sql.ErrNoRows {
+			continue // removed from the catalogue since
+		} else if err != nil {
+			logger.Error("failed to price waitlist item", zap.Int("item_id", it.ItemID), zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		claim = append(claim, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Items     []ClaimItem `json:"items"`
+		ExpiresAt time.Time   `json:"expiresAt"`
+	}{claim, expires})
+}
+
+func distinct(ids []int64) map[int64]bool {
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+	return seen
+}
@@ -0,0 +1,256 @@
+package waitlist
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"server/internal/email"
+	"server/internal/locale"
+	"server/internal/orders"
+
+	"go.uber.org/zap"
+)
+
+// offer is a claim handed to a waiting student, to be emailed once the
+// offers are committed.
+type offer struct {
+	to      string
+	data    email.WaitlistClaimData
+	entryID int64
+}
+
+// Notify expires lapsed claims and offers new ones to waiting entries in
+// FIFO order, skipping entries that still cannot be filled: their campus
+// has no free slot or an item is unavailable or short. Stock is not held;
+// a claimant can still find an item sold out by the time they order.
+func Notify(ctx context.Context, db *sql.DB, mailer *email.Client, logger *zap.Logger, baseURL string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// One notifier at a time, so two instances never hand out the same slot
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('waitlist-notifier'))`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE waitlist SET status = 'EXPIRED' WHERE status = 'NOTIFIED' AND claim_expires <= NOW()`); err != nil {
+		return err
+	}
+
+	free, err := freeSlots(ctx, tx)
+	if err != nil {
+		return err
+	}
+	stock, names, err := freeStock(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT w.id, w.campus, w.items, u.email, u.username
+		   FROM waitlist w JOIN users u ON u.id = w.user_id
+		  WHERE w.status = 'WAITING'
+		  ORDER BY w.created_at, w.id`)
+	if err != nil {
+		return err
+	}
+	type waiting struct {
+		id              int64
+		campus          string
+		items           []Item
+		email, username string
+	}
+	var queue []waiting
+	for rows.Next() {
+		var w waiting
+		var items []byte
+		if err := rows.Scan(&w.id, &w.campus, &items, &w.email, &w.username); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := json.Unmarshal(items, &w.items); err != nil {
+			rows.Close()
+			return err
+		}
+		queue = append(queue, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(ClaimWindow)
+	var offers []offer
+	for _, w := range queue {
+		if n, limited := free[w.campus]; limited && n <= 0 {
+			continue
+		}
+		if !fits(w.items, stock) {
+			continue
+		}
+
+		token, err := newToken()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE waitlist SET status = 'NOTIFIED', claim_token = $1, claim_expires = $2, notified_at = NOW()
+			  WHERE id = $3`,
+			token, expires, w.id); err != nil {
+			return err
+		}
+
+		if _, limited := free[w.campus]; limited {
+			free[w.campus]--
+		}
+		data := email.WaitlistClaimData{
+			Username:  w.username,
+			ClaimURL:  strings.TrimRight(baseURL, "/") + "/waitlist/claim?token=" + token,
+			ExpiresAt: expires.In(locale.EAT).Format("15:04"),
+		}
+		for _, it := range w.items {
+			if left, tracked := stock[it.ItemID]; tracked && left != nil {
+				*left -= it.Quantity
+			}
+			data.Items = append(data.Items, email.WaitlistItem{Name: names[it.ItemID], Quantity: it.Quantity})
+		}
+		offers = append(offers, offer{to: w.email, data: data, entryID: w.id})
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, o := range offers {
+		if err := mailer.SendWaitlistClaimEmail(o.to, o.data); err != nil {
+			logger.Error("failed to send waitlist claim email", zap.Int64("entry_id", o.entryID), zap.Error(err))
+		}
+	}
+	if len(offers) > 0 {
+		logger.Info("waitlist claims offered", zap.Int("count", len(offers)))
+	}
+	return nil
+}
+
+// freeSlots returns, per campus with a capacity, how many orders it can
+// still take today after confirmed orders and outstanding claims. Campuses
+// without a limit are absent.
+func freeSlots(ctx context.Context, tx *sql.Tx) (map[string]int, error) {
+	// Take the same per-campus locks as orders.ReserveCapacity, so no
+	// confirmation lands between counting and handing out a slot
+	if _, err := tx.ExecContext(ctx,
+		`SELECT pg_advisory_xact_lock(hashtext('campus-capacity:' || name))
+		   FROM (SELECT name FROM campuses WHERE daily_capacity IS NOT NULL ORDER BY name) c`); err != nil {
+		return nil, err
+	}
+
+	start, _ := orders.CapacityDay(time.Now())
+	rows, err := tx.QueryContext(ctx,
+		`SELECT c.name,
+		        c.daily_capacity
+		        - (SELECT COUNT(DISTINCT o.id)
+		             FROM orders o
+		             JOIN order_status_history h ON h.order_id = o.id AND h.status = 'CONFIRMED'
+		            WHERE o.campus = c.name
+		              AND o.status IN ('CONFIRMED', 'PACKED', 'FULFILLED')
+		              AND h.changed_at >= $1)
+		        - (SELECT COUNT(*) FROM waitlist w
+		            WHERE w.campus = c.name AND w.status = 'NOTIFIED' AND w.claim_expires > NOW())
+		   FROM campuses c
+		  WHERE c.daily_capacity IS NOT NULL`,
+		start,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	free := map[string]int{}
+	for rows.Next() {
+		var name string
+		var n int
+		if err := rows.Scan(&name, &n); err != nil {
+			return nil, err
+		}
+		free[name] = n
+	}
+	return free, rows.Err()
+}
+
+// freeStock returns every available item with what is left of its stock
+// after outstanding claims (nil when untracked), and every item's name.
+func freeStock(ctx context.Context, tx *sql.Tx) (map[int]*int, map[int]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT i.id, i.name, i.available,
+		        i.stock - COALESCE((SELECT SUM((e->>'quantity')::int)
+		                              FROM waitlist w, jsonb_array_elements(w.items) e
+		                             WHERE w.status = 'NOTIFIED' AND w.claim_expires > NOW()
+		                               AND (e->>'itemId')::int = i.id), 0)
+		   FROM items i`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	stock := map[int]*int{}
+	names := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		var available bool
+		var left sql.NullInt64
+		if err := rows.Scan(&id, &name, &available, &left); err != nil {
+			return nil, nil, err
+		}
+		names[id] = name
+		if !available {
+			continue
+		}
+		if left.Valid {
+			n := int(left.Int64)
+			stock[id] = &n
+		} else {
+			stock[id] = nil
+		}
+	}
+	return stock, names, rows.Err()
+}
+
+// fits reports whether every item is available in the quantity wanted.
+func fits(items []Item, stock map[int]*int) bool {
+	for _, it := range items {
+		left, available := stock[it.ItemID]
+		if !available || (left != nil && *left < it.Quantity) {
+			return false
+		}
+	}
+	return true
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RunNotifier runs Notify every interval until ctx is done.
+func RunNotifier(ctx context.Context, db *sql.DB, mailer *email.Client, logger *zap.Logger, baseURL string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := Notify(ctx, db, mailer, logger, baseURL); err != nil {
+			logger.Error("waitlist notifier failed", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package waitlist queues students who could not order because their campus
+// was full for the day or an item sold out. A background job offers entries
+// a time-limited claim, first come first served, once there is room again;
+// the claim holds a campus slot until the student confirms an order or it
+// expires.
+package waitlist
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"server/internal/domain"
+
+	"github.com/lib/pq"
+)
+
+// ClaimWindow is how long a notified student has to place their order.
+const ClaimWindow = 2 * time.Hour
+
+// Entry statuses stored in waitlist.status.
+const (
+	StatusWaiting  = "WAITING"
+	StatusNotified = "NOTIFIED"
+	StatusClaimed  = "CLAIMED"
+	StatusExpired  = "EXPIRED"
+	StatusLeft     = "LEFT"
+)
+
+// ErrAlreadyWaiting is returned by Join when the student already has a live
+// entry.
+var ErrAlreadyWaiting = domain.Conflict("already on the waitlist")
+
+// Item is one line of the order the student is waiting to place.
+type Item struct {
+	ItemID   int `json:"itemId" validate:"required,min=1"`
+	Quantity int `json:"quantity" validate:"min=1,max=100"`
+}
+
+// Entry is a student's place on the waitlist.
+type Entry struct {
+	ID           int64      `json:"id"`
+	Status       string     `json:"status"`
+	Campus       string     `json:"campus"`
+	Items        []Item     `json:"items"`
+	Position     int        `json:"position,omitempty"` // among waiting entries for the campus, from 1
+	ClaimExpires *time.Time `json:"claimExpires,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// Join puts the student at the back of their campus's queue, waiting for
+// items.
+func Join(ctx context.Context, db *sql.DB, userID int, items []Item) (int64, error) {
+	payload, err := json.Marshal(items)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = db.QueryRowContext(ctx,
+		`INSERT INTO waitlist (user_id, campus, items)
+		 SELECT id, campus, $2 FROM users WHERE id = $1
+		 RETURNING id`,
+		userID, payload,
+	).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return 0, ErrAlreadyWaiting
+	}
+	return id, err
+}
+
+// Current returns the student's live entry, or sql.ErrNoRows if they are not
+// waiting.
+func Current(ctx context.Context, db *sql.DB, userID int) (Entry, error) {
+	var e Entry
+	var items []byte
+	var expires sql.NullTime
+	err := db.QueryRowContext(ctx,
+		`SELECT w.id, w.status, w.campus, w.items, w.claim_expires, w.created_at,
+		        (SELECT COUNT(*) FROM waitlist a
+		          WHERE a.campus = w.campus AND a.status = 'WAITING'
+		            AND (a.created_at, a.id) <= (w.created_at, w.id))
+		   FROM waitlist w
+		  WHERE w.user_id = $1 AND w.status IN ('WAITING', 'NOTIFIED')`,
+		userID,
+	).Scan(&e.ID, &e.Status, &e.Campus, &items, &expires, &e.CreatedAt, &e.Position)
+	if err != nil {
+		return e, err
+	}
+	if expires.Valid {
+		e.ClaimExpires = &expires.Time
+	}
+	if e.Status != StatusWaiting {
+		e.Position = 0
+	}
+	return e, json.Unmarshal(items, &e.Items)
+}
+
+// Leave takes the student off the waitlist, giving up any claim. It reports
+// whether they had a live entry.
+func Leave(ctx context.Context, db *sql.DB, userID int) (bool, error) {
+	res, err := db.ExecContext(ctx,
+		`UPDATE waitlist SET status = 'LEFT' WHERE user_id = $1 AND status IN ('WAITING', 'NOTIFIED')`, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,148 @@
+package webpush
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxFailures is how many sends in a row may fail before a subscription is
+// dropped; push services that have forgotten it usually say so with 404 or
+// 410, but some just keep erroring.
+const maxFailures = 5
+
+// Subscription is a browser's PushSubscription, stored per user.
+type Subscription struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId"`
+	Endpoint  string     `json:"endpoint"`
+	P256dh    string     `json:"-"`
+	Auth      string     `json:"-"`
+	UserAgent string     `json:"userAgent"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// Save stores sub for its user. A browser re-subscribing with an endpoint
+// already on file, possibly signed in as someone else, takes that row over
+// and starts with a clean failure count.
+func Save(ctx context.Context, db *sql.DB, sub *Subscription) error {
+	return db.QueryRowContext(ctx,
+		`INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (endpoint) DO UPDATE
+		    SET user_id = EXCLUDED.user_id, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth,
+		        user_agent = EXCLUDED.user_agent, expires_at = EXCLUDED.expires_at, failures = 0
+		 RETURNING id, created_at`,
+		sub.UserID, sub.Endpoint, sub.P256dh, sub.Auth, sub.UserAgent, sub.ExpiresAt,
+	).Scan(&sub.ID, &sub.CreatedAt)
+}
+
+// List returns userID's subscriptions, newest first.
+func List(ctx context.Context, db *sql.DB, userID int) ([]Subscription, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, user_id, endpoint, user_agent, expires_at, created_at
+		   FROM push_subscriptions WHERE user_id = $1
+		  ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []Subscription{}
+	for rows.Next() {
+		var s Subscription
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Endpoint, &s.UserAgent, &s.ExpiresAt, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// Delete removes one of userID's subscriptions and reports whether it
+// existed.
+func Delete(ctx context.Context, db *sql.DB, userID, id int) (bool, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// NotifyAdmins sends msg to every subscription of every admin and returns
+// how many were delivered. Expired subscriptions, ones the push service
+// reports gone, and ones that keep failing are deleted on the way.
+func NotifyAdmins(ctx context.Context, db *sql.DB, s *Sender, logger *zap.Logger, msg Message) (int, error) {
+	return notify(ctx, db, s, logger, msg,
+		`SELECT p.id, p.user_id, p.endpoint, p.p256dh, p.auth
+		   FROM push_subscriptions p JOIN users u ON u.id = p.user_id
+		  WHERE u.is_admin`)
+}
+
+// NotifyUser sends msg to every subscription of userID, as NotifyAdmins
+// does for admins.
+func NotifyUser(ctx context.Context, db *sql.DB, s *Sender, logger *zap.Logger, userID int, msg Message) (int, error) {
+	return notify(ctx, db, s, logger, msg,
+		`SELECT id, user_id, endpoint, p256dh, auth FROM push_subscriptions WHERE user_id = $1`, userID)
+}
+
+// notify sends msg to the subscriptions query selects (id, user_id,
+// endpoint, p256dh, auth), after dropping expired ones, and prunes those
+// that fail.
+func notify(ctx context.Context, db *sql.DB, s *Sender, logger *zap.Logger, msg Message, query string, args ...interface{}) (int, error) {
+	if _, err := db.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE expires_at < NOW()`); err != nil {
+		return 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	var subs []Subscription
+	for rows.Next() {
+		var sub Subscription
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.P256dh, &sub.Auth); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		subs = append(subs, sub)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, sub := range subs {
+		err := s.Send(ctx, sub, msg)
+		switch {
+		case err == nil:
+			sent++
+			_, err = db.ExecContext(ctx,
+				`UPDATE push_subscriptions SET failures = 0, last_sent_at = NOW() WHERE id = $1`, sub.ID)
+		case errors.Is(err, ErrGone):
+			logger.Info("dropping expired push subscription", zap.Int("subscription_id", sub.ID), zap.Int("user_id", sub.UserID))
+			_, err = db.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE id = $1`, sub.ID)
+		default:
+			logger.Warn("push failed", zap.Int("subscription_id", sub.ID), zap.Int("user_id", sub.UserID), zap.Error(err))
+			var failures int
+			err = db.QueryRowContext(ctx,
+				`UPDATE push_subscriptions SET failures = failures + 1 WHERE id = $1 RETURNING failures`, sub.ID,
+			).Scan(&failures)
+			if errors.Is(err, sql.ErrNoRows) {
+				err = nil // unsubscribed meanwhile
+			} else if err == nil && failures >= maxFailures {
+				_, err = db.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE id = $1`, sub.ID)
+			}
+		}
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
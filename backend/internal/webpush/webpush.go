@@ -0,0 +1,250 @@
+// Package webpush sends Web Push notifications (RFC 8030) to browsers,
+// encrypting payloads with aes128gcm (RFC 8291) and identifying the server
+// with VAPID (RFC 8292).
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrGone means the push service no longer knows the subscription: the user
+// unsubscribed or the browser expired it. Delete it.
+var ErrGone = errors.New("push subscription expired or unsubscribed")
+
+// b64 is the unpadded base64url encoding browsers use for push keys.
+var b64 = base64.RawURLEncoding
+
+// recordSize is the aes128gcm record size; payloads fit in one record.
+const recordSize = 4096
+
+// Sender signs and delivers push messages with one VAPID key pair.
+type Sender struct {
+	PublicKey string // uncompressed P-256 point, base64url; browsers pass it as applicationServerKey
+	Subject   string // mailto: or https: contact for push services
+
+	key    *ecdsa.PrivateKey
+	client *http.Client
+}
+
+// NewSender returns a Sender for a base64url VAPID key pair as printed by
+// GenerateKeys.
+func NewSender(publicKey, privateKey, subject string) (*Sender, error) {
+	pub, err := b64.DecodeString(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("vapid public key: %w", err)
+	}
+	d, err := b64.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("vapid private key: %w", err)
+	}
+	priv, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("vapid private key: %w", err)
+	}
+	if !bytes.Equal(priv.PublicKey().Bytes(), pub) {
+		return nil, errors.New("vapid public key does not match the private key")
+	}
+	return &Sender{
+		PublicKey: publicKey,
+		Subject:   subject,
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(pub[1:33]),
+				Y:     new(big.Int).SetBytes(pub[33:]),
+			},
+			D: new(big.Int).SetBytes(d),
+		},
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// NewSenderFromEnv configures a Sender from VAPID_PUBLIC_KEY,
+// VAPID_PRIVATE_KEY, and VAPID_SUBJECT. It returns nil when no key is set.
+func NewSenderFromEnv() (*Sender, error) {
+	pub, priv := os.Getenv("VAPID_PUBLIC_KEY"), os.Getenv("VAPID_PRIVATE_KEY")
+	if pub == "" && priv == "" {
+		return nil, nil
+	}
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		return nil, errors.New("VAPID_SUBJECT is required when VAPID keys are set, e.g. mailto:ops@example.com")
+	}
+	return NewSender(pub, priv, subject)
+}
+
+// GenerateKeys returns a new base64url VAPID key pair.
+func GenerateKeys() (publicKey, privateKey string, err error) {
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return b64.EncodeToString(priv.PublicKey().Bytes()), b64.EncodeToString(priv.Bytes()), nil
+}
+
+// Message is one push to one subscription.
+type Message struct {
+	Payload []byte
+	TTL     time.Duration // how long the push service may hold it for an offline browser
+	Topic   string        // optional; a newer message with the same topic replaces an undelivered one
+	Urgent  bool
+}
+
+// Send encrypts msg for sub and hands it to the subscription's push service.
+// It returns ErrGone when the subscription should be deleted.
+func (s *Sender) Send(ctx context.Context, sub Subscription, msg Message) error {
+	body, err := encrypt(sub, msg.Payload)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return fmt.Errorf("push endpoint: %w", err)
+	}
+	token, err := s.vapidToken(u.Scheme+"://"+u.Host, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(msg.TTL.Seconds())))
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.PublicKey)
+	if msg.Topic != "" {
+		req.Header.Set("Topic", msg.Topic)
+	}
+	if msg.Urgent {
+		req.Header.Set("Urgency", "high")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("push: status %d: %s", resp.StatusCode, detail)
+	}
+	return nil
+}
+
+// vapidToken signs the ES256 JWT that identifies this server to the push
+// service at audience. Push services accept tokens valid for up to 24 hours.
+func (s *Sender) vapidToken(audience string, now time.Time) (string, error) {
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": audience,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": s.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + b64.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, sv, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	sv.FillBytes(sig[32:])
+	return unsigned + "." + b64.EncodeToString(sig), nil
+}
+
+// encrypt seals payload for sub as a single aes128gcm record.
+func encrypt(sub Subscription, payload []byte) ([]byte, error) {
+	uaPub, err := b64.DecodeString(sub.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("subscription p256dh: %w", err)
+	}
+	authSecret, err := b64.DecodeString(sub.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("subscription auth: %w", err)
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(uaPub)
+	if err != nil {
+		return nil, fmt.Errorf("subscription p256dh: %w", err)
+	}
+
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	asPub := asKey.PublicKey().Bytes()
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPub...), asPub...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, authSecret, keyInfo), ikm); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (only) record.
+	if len(payload)+1+gcm.Overhead() > recordSize {
+		return nil, errors.New("push payload too large")
+	}
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	header := make([]byte, 0, 16+4+1+len(asPub))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPub)))
+	header = append(header, asPub...)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS refunds (
+  id SERIAL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  amount INT NOT NULL CHECK (amount > 0),
+  method TEXT NOT NULL,                       -- WALLET, MOBILE_MONEY
+  status TEXT NOT NULL DEFAULT 'REQUESTED',   -- REQUESTED, APPROVED, ISSUED
+  reason TEXT NOT NULL DEFAULT '',
+  provider_ref TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  approved_at TIMESTAMPTZ,
+  issued_at TIMESTAMPTZ
+);
+
+-- An order is refunded at most once.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refunds_order_id ON refunds(order_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_status ON refunds(status);
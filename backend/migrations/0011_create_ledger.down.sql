@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS ledger_entries;
+DROP FUNCTION IF EXISTS ledger_entries_append_only();
+ALTER TABLE orders DROP COLUMN IF EXISTS receipt_number;
+DROP SEQUENCE IF EXISTS receipt_number_seq;
@@ -0,0 +1,29 @@
+CREATE SEQUENCE IF NOT EXISTS receipt_number_seq;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS receipt_number TEXT UNIQUE;
+
+-- Append-only record of every charge, fee, discount, and refund. Each row
+-- carries the SHA-256 of its predecessor, so an edited or removed row breaks
+-- the chain from that point on.
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  id BIGSERIAL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES orders(id),
+  receipt_number TEXT,
+  entry_type TEXT NOT NULL,   -- ITEMS, TRANSPORT_FEE, FEE_ADJUSTMENT, DISCOUNT, CANCELLATION, REFUND
+  amount INT NOT NULL,        -- UGX; negative for money owed back to the customer
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  prev_hash TEXT NOT NULL,
+  hash TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_created_at ON ledger_entries(created_at);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_order_id ON ledger_entries(order_id);
+
+CREATE OR REPLACE FUNCTION ledger_entries_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'ledger_entries is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_entries_no_update_delete
+  BEFORE UPDATE OR DELETE ON ledger_entries
+  FOR EACH ROW EXECUTE FUNCTION ledger_entries_append_only();
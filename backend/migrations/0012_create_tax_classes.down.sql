@@ -0,0 +1,5 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_total;
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax_amount;
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax_rate_bps;
+DROP TABLE IF EXISTS category_tax_classes;
+DROP TABLE IF EXISTS tax_classes;
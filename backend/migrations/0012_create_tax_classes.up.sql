@@ -0,0 +1,21 @@
+-- Prices are VAT-inclusive; tax lines record the VAT contained in them.
+CREATE TABLE IF NOT EXISTS tax_classes (
+  code TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  rate_bps INT NOT NULL CHECK (rate_bps >= 0) -- basis points, 1800 = 18%
+);
+
+INSERT INTO tax_classes (code, name, rate_bps) VALUES
+  ('STANDARD', 'VAT 18%', 1800),
+  ('EXEMPT', 'VAT exempt', 0)
+ON CONFLICT (code) DO NOTHING;
+
+-- Categories without a row here are untaxed.
+CREATE TABLE IF NOT EXISTS category_tax_classes (
+  category TEXT PRIMARY KEY,
+  tax_class TEXT NOT NULL REFERENCES tax_classes(code)
+);
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS tax_rate_bps INT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS tax_amount INT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_total INT NOT NULL DEFAULT 0;
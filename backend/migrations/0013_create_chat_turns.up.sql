@@ -0,0 +1,13 @@
+-- Every chat message and the reply it got, linked to the order it touched.
+CREATE TABLE IF NOT EXISTS chat_turns (
+  id BIGSERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id),
+  order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+  intent TEXT NOT NULL,      -- NEW_ORDER, CONFIRM, CANCEL, CONFLICT, OFF_TOPIC, UNAVAILABLE
+  message TEXT NOT NULL,
+  reply TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_turns_order_id ON chat_turns(order_id);
+CREATE INDEX IF NOT EXISTS idx_chat_turns_user_id ON chat_turns(user_id, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS chat_suspensions;
+DROP TABLE IF EXISTS chat_violations;
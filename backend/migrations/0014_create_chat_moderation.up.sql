@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS chat_violations (
+  id BIGSERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  message TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_violations_user_id ON chat_violations(user_id, created_at);
+
+-- At most one active suspension per user; lifting it deletes the row.
+CREATE TABLE IF NOT EXISTS chat_suspensions (
+  user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  until TIMESTAMPTZ NOT NULL,
+  reason TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
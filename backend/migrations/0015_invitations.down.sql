@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_invitation_id;
+ALTER TABLE users DROP COLUMN IF EXISTS invitation_id;
+DROP TABLE IF EXISTS invitations;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS invitations (
+  id SERIAL PRIMARY KEY,
+  code TEXT NOT NULL UNIQUE,
+  max_uses INT NOT NULL DEFAULT 1 CHECK (max_uses > 0),
+  uses INT NOT NULL DEFAULT 0 CHECK (uses <= max_uses),
+  expires_at TIMESTAMPTZ,
+  note TEXT NOT NULL DEFAULT '',
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Which invitation a user signed up with, for conversion analytics.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS invitation_id INT REFERENCES invitations(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_users_invitation_id ON users(invitation_id);
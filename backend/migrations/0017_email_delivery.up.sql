@@ -0,0 +1,22 @@
+-- One row per email the server tried to send, updated by delivery webhooks.
+CREATE TABLE IF NOT EXISTS email_log (
+  id BIGSERIAL PRIMARY KEY,
+  message_id TEXT NOT NULL UNIQUE,
+  kind TEXT NOT NULL,
+  recipient TEXT NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('SENT', 'FAILED', 'SUPPRESSED', 'DELIVERED', 'BOUNCED', 'COMPLAINED')),
+  error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_log_created_at ON email_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_email_log_recipient ON email_log(lower(recipient));
+
+-- Addresses we no longer send to after a hard bounce or spam complaint.
+CREATE TABLE IF NOT EXISTS email_suppressions (
+  email TEXT PRIMARY KEY, -- stored lower-cased
+  reason TEXT NOT NULL CHECK (reason IN ('BOUNCE', 'COMPLAINT')),
+  detail TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_phone;
+ALTER TABLE users DROP COLUMN IF EXISTS language;
+ALTER TABLE users DROP COLUMN IF EXISTS pickup_station;
+ALTER TABLE users DROP COLUMN IF EXISTS phone;
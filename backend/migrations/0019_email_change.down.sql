@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_email_change_token;
+ALTER TABLE users DROP COLUMN IF EXISTS email_change_expires;
+ALTER TABLE users DROP COLUMN IF EXISTS email_change_token;
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
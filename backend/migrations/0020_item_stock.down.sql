@@ -0,0 +1,5 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS stock_reserved;
+ALTER TABLE items DROP COLUMN IF EXISTS low_stock_alerted_at;
+ALTER TABLE items DROP COLUMN IF EXISTS auto_unavailable;
+ALTER TABLE items DROP COLUMN IF EXISTS low_stock_threshold;
+ALTER TABLE items DROP COLUMN IF EXISTS stock;
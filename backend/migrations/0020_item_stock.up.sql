@@ -0,0 +1,7 @@
+-- NULL stock means the item is not tracked and never runs out
+ALTER TABLE items ADD COLUMN IF NOT EXISTS stock INT;
+ALTER TABLE items ADD COLUMN IF NOT EXISTS low_stock_threshold INT;
+-- Set when the stock monitor, not an admin, marked the item unavailable
+ALTER TABLE items ADD COLUMN IF NOT EXISTS auto_unavailable BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE items ADD COLUMN IF NOT EXISTS low_stock_alerted_at TIMESTAMPTZ;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS stock_reserved BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_orders_campus;
+ALTER TABLE orders DROP COLUMN IF EXISTS campus;
+ALTER TABLE users DROP COLUMN IF EXISTS campus;
+DROP TABLE IF EXISTS campuses;
@@ -0,0 +1,12 @@
+-- Each campus can fulfil only so many orders a day; NULL capacity means no limit
+CREATE TABLE IF NOT EXISTS campuses (
+  name TEXT PRIMARY KEY,
+  daily_capacity INT CHECK (daily_capacity >= 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+INSERT INTO campuses (name) VALUES ('main') ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS campus TEXT NOT NULL DEFAULT 'main' REFERENCES campuses (name) ON UPDATE CASCADE;
+-- Stamped when the order is confirmed, so moving campus later does not move old orders
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS campus TEXT REFERENCES campuses (name) ON UPDATE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_orders_campus ON orders (campus, created_at);
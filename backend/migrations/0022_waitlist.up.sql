@@ -0,0 +1,20 @@
+-- Students waiting for a full campus or a sold-out item. The notifier offers
+-- entries a claim in FIFO order; a NOTIFIED entry holds a slot until it
+-- expires or its owner confirms an order.
+CREATE TABLE IF NOT EXISTS waitlist (
+  id BIGSERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  campus TEXT NOT NULL REFERENCES campuses (name) ON UPDATE CASCADE,
+  items JSONB NOT NULL,  -- [{"itemId": 1, "quantity": 2}], prefilled on claim
+  status TEXT NOT NULL DEFAULT 'WAITING'
+    CHECK (status IN ('WAITING', 'NOTIFIED', 'CLAIMED', 'EXPIRED', 'LEFT')),
+  claim_token TEXT UNIQUE,
+  claim_expires TIMESTAMPTZ,
+  order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  notified_at TIMESTAMPTZ
+);
+
+-- One live entry per student
+CREATE UNIQUE INDEX IF NOT EXISTS idx_waitlist_active_user ON waitlist (user_id) WHERE status IN ('WAITING', 'NOTIFIED');
+CREATE INDEX IF NOT EXISTS idx_waitlist_status ON waitlist (status, created_at);
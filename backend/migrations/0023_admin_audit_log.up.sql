@@ -0,0 +1,11 @@
+-- Support actions admins take on someone else's behalf, e.g. resending email
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  admin_id INT REFERENCES users(id) ON DELETE SET NULL,
+  action TEXT NOT NULL,            -- e.g. email.resend
+  target TEXT NOT NULL,            -- what it acted on: an email address, an order id
+  detail JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_audit_log_created_at ON admin_audit_log(created_at);
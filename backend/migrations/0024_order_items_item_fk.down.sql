@@ -0,0 +1,2 @@
+-- The key may predate 0024, so it is left in place.
+SELECT 1;
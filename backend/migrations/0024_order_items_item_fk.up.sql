@@ -0,0 +1,14 @@
+-- Databases created before 0003 had its foreign keys can lack the one that
+-- stops deleting items still on orders. Add it without validating old rows,
+-- which may already be orphaned; see GET /admin/integrity.
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM pg_constraint
+     WHERE contype = 'f' AND conrelid = 'order_items'::regclass AND confrelid = 'items'::regclass
+  ) THEN
+    ALTER TABLE order_items
+      ADD CONSTRAINT order_items_item_id_fkey FOREIGN KEY (item_id) REFERENCES items(id) NOT VALID;
+  END IF;
+END
+$$;
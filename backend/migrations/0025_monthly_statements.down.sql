@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS statement_sends;
+ALTER TABLE users DROP COLUMN IF EXISTS monthly_statement;
@@ -0,0 +1,11 @@
+-- Students get a statement email each month unless they opt out
+ALTER TABLE users ADD COLUMN IF NOT EXISTS monthly_statement BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- One row per statement sent, so a restart or a second instance never mails
+-- the same month twice
+CREATE TABLE IF NOT EXISTS statement_sends (
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  month DATE NOT NULL,             -- first day of the month covered
+  sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, month)
+);
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS export_watermarks;
+
+DROP TRIGGER IF EXISTS orders_touch_updated_at ON orders;
+DROP TRIGGER IF EXISTS order_items_touch_updated_at ON order_items;
+DROP TRIGGER IF EXISTS items_touch_updated_at ON items;
+DROP TRIGGER IF EXISTS users_touch_updated_at ON users;
+DROP FUNCTION IF EXISTS touch_updated_at();
+
+ALTER TABLE orders DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE order_items DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE items DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE users DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,38 @@
+-- updated_at drives incremental exports to the analytics warehouse
+CREATE OR REPLACE FUNCTION touch_updated_at() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at = NOW();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE items ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE orders SET updated_at = created_at;
+UPDATE items SET updated_at = created_at;
+UPDATE users SET updated_at = created_at;
+
+CREATE TRIGGER orders_touch_updated_at BEFORE UPDATE ON orders
+  FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+CREATE TRIGGER order_items_touch_updated_at BEFORE UPDATE ON order_items
+  FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+CREATE TRIGGER items_touch_updated_at BEFORE UPDATE ON items
+  FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+CREATE TRIGGER users_touch_updated_at BEFORE UPDATE ON users
+  FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+
+CREATE INDEX IF NOT EXISTS idx_orders_updated_at ON orders(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_order_items_updated_at ON order_items(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_items_updated_at ON items(updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_users_updated_at ON users(updated_at, id);
+
+-- How far the scheduled S3 export has got in each table
+CREATE TABLE IF NOT EXISTS export_watermarks (
+  table_name TEXT PRIMARY KEY,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT '1970-01-01T00:00:00Z',
+  last_id INT NOT NULL DEFAULT 0,
+  exported_at TIMESTAMPTZ
+);
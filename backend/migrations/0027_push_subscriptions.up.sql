@@ -0,0 +1,15 @@
+-- Browser Web Push subscriptions, one row per admin device
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  endpoint TEXT NOT NULL UNIQUE,
+  p256dh TEXT NOT NULL,            -- browser public key, base64url
+  auth TEXT NOT NULL,              -- browser auth secret, base64url
+  user_agent TEXT NOT NULL DEFAULT '',
+  expires_at TIMESTAMPTZ,          -- PushSubscription.expirationTime, when the browser sets one
+  failures INT NOT NULL DEFAULT 0, -- consecutive failed sends
+  last_sent_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS push_subscriptions_user_idx ON push_subscriptions (user_id);
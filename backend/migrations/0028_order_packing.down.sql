@@ -0,0 +1,3 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS packed_by;
+ALTER TABLE order_items DROP COLUMN IF EXISTS packed_at;
+ALTER TABLE users DROP COLUMN IF EXISTS is_staff;
@@ -0,0 +1,7 @@
+-- Fulfillment staff pack orders without full admin rights.
+-- Grant with: UPDATE users SET is_staff = TRUE WHERE email = '...';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_staff BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Packing checklist; an order moves to PACKED once every line is ticked
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS packed_at TIMESTAMPTZ;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS packed_by INT REFERENCES users(id) ON DELETE SET NULL;
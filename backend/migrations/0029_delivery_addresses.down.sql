@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS delivery_halls;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS delivery_room;
+ALTER TABLE orders DROP COLUMN IF EXISTS delivery_block;
+ALTER TABLE orders DROP COLUMN IF EXISTS delivery_hall;
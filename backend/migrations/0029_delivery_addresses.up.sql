@@ -0,0 +1,13 @@
+-- Delivery to halls of residence. An order with a delivery_hall is delivered
+-- there instead of being collected from a pickup station.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_hall TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_block TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_room TEXT;
+
+-- Where each hall is, for ordering a runner's stops; halls without a
+-- location go last
+CREATE TABLE IF NOT EXISTS delivery_halls (
+  name TEXT PRIMARY KEY,
+  latitude DOUBLE PRECISION NOT NULL,
+  longitude DOUBLE PRECISION NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS budget_locked;
+ALTER TABLE users DROP COLUMN IF EXISTS budget_mode;
+ALTER TABLE users DROP COLUMN IF EXISTS weekly_budget;
@@ -0,0 +1,6 @@
+-- Weekly spending caps. In warn mode the student can confirm past the cap;
+-- in block mode they cannot. A locked budget was set by support, e.g. at a
+-- parent's request, and can only be changed by an admin.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS weekly_budget INT CHECK (weekly_budget > 0);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS budget_mode TEXT NOT NULL DEFAULT 'warn' CHECK (budget_mode IN ('warn', 'block'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS budget_locked BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,12 @@
+-- Items suggested in chat order summaries, and whether the student went on
+-- to order them, for the acceptance rate.
+CREATE TABLE IF NOT EXISTS chat_suggestions (
+  id BIGSERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE, -- the draft it was shown with
+  item_id INT NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+  shown_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  accepted_order_id INT REFERENCES orders(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_suggestions_user_id ON chat_suggestions(user_id, shown_at);
@@ -0,0 +1,6 @@
+-- Product details shown in the catalog: brand, pack size, nutrition per
+-- 100 g or ml, and tags such as "halal" or "sugar-free" that filter and
+-- search on.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_items_attribute_tags ON items USING GIN ((attributes->'tags'));
@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS item_price(INT, TIMESTAMPTZ);
+DROP TABLE IF EXISTS item_price_schedules;
@@ -0,0 +1,25 @@
+-- Scheduled prices, e.g. a flash sale: the item sells at price_ugx from
+-- starts_at until ends_at, then reverts to items.price_ugx on its own.
+CREATE TABLE IF NOT EXISTS item_price_schedules (
+  id SERIAL PRIMARY KEY,
+  item_id INT NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+  price_ugx INT NOT NULL CHECK (price_ugx > 0),
+  starts_at TIMESTAMPTZ NOT NULL,
+  ends_at TIMESTAMPTZ NOT NULL,
+  note TEXT NOT NULL DEFAULT '',
+  created_by INT REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_item_price_schedules_item ON item_price_schedules(item_id, starts_at);
+
+-- The price an item sells at, at a given time. Everything that prices an
+-- order or shows a price goes through this.
+CREATE OR REPLACE FUNCTION item_price(p_item_id INT, p_at TIMESTAMPTZ) RETURNS INT AS $$
+  SELECT COALESCE(
+    (SELECT s.price_ugx FROM item_price_schedules s
+      WHERE s.item_id = p_item_id AND s.starts_at <= p_at AND s.ends_at > p_at
+      ORDER BY s.starts_at DESC LIMIT 1),
+    (SELECT i.price_ugx FROM items i WHERE i.id = p_item_id))
+$$ LANGUAGE sql STABLE;
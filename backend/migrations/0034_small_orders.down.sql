@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS small_order_fee;
+ALTER TABLE campuses DROP COLUMN IF EXISTS small_order_fee_ugx;
+ALTER TABLE campuses DROP COLUMN IF EXISTS min_order_ugx;
@@ -0,0 +1,7 @@
+-- Minimum basket per campus: orders whose items come to less than
+-- min_order_ugx are refused, or, when small_order_fee_ugx is set, charged
+-- that fee on top. NULL min_order_ugx means no minimum.
+ALTER TABLE campuses ADD COLUMN IF NOT EXISTS min_order_ugx INT CHECK (min_order_ugx > 0);
+ALTER TABLE campuses ADD COLUMN IF NOT EXISTS small_order_fee_ugx INT CHECK (small_order_fee_ugx >= 0);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS small_order_fee INT NOT NULL DEFAULT 0;
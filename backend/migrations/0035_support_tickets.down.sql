@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS support_messages;
+DROP TABLE IF EXISTS support_tickets;
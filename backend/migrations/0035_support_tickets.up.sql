@@ -0,0 +1,27 @@
+-- Support tickets about orders, and the conversation on each. OPEN tickets
+-- wait on staff, ANSWERED ones on the customer; RESOLVED tickets reopen when
+-- the customer writes again.
+CREATE TABLE IF NOT EXISTS support_tickets (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+  category TEXT NOT NULL CHECK (category IN ('WRONG_ITEM', 'MISSING_ITEM', 'DAMAGED_ITEM', 'OTHER')),
+  subject TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'OPEN' CHECK (status IN ('OPEN', 'ANSWERED', 'RESOLVED')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_support_tickets_user_id ON support_tickets(user_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_support_tickets_status ON support_tickets(status, updated_at);
+
+CREATE TABLE IF NOT EXISTS support_messages (
+  id BIGSERIAL PRIMARY KEY,
+  ticket_id INT NOT NULL REFERENCES support_tickets(id) ON DELETE CASCADE,
+  author_id INT REFERENCES users(id) ON DELETE SET NULL,
+  from_staff BOOLEAN NOT NULL DEFAULT FALSE,
+  body TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_support_messages_ticket_id ON support_messages(ticket_id, created_at);
@@ -0,0 +1,22 @@
+-- Background jobs. Workers claim QUEUED jobs whose run_at has come with
+-- FOR UPDATE SKIP LOCKED; a RUNNING job whose lease has expired belonged to
+-- a worker that died and is claimed again.
+CREATE TABLE IF NOT EXISTS jobs (
+  id BIGSERIAL PRIMARY KEY,
+  type TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'QUEUED' CHECK (status IN ('QUEUED', 'RUNNING', 'SUCCEEDED', 'FAILED')),
+  payload JSONB NOT NULL DEFAULT '{}',
+  result JSONB,
+  error TEXT NOT NULL DEFAULT '',
+  attempts INT NOT NULL DEFAULT 0,
+  max_attempts INT NOT NULL DEFAULT 3 CHECK (max_attempts > 0),
+  run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  lease_expires TIMESTAMPTZ,
+  created_by INT REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  started_at TIMESTAMPTZ,
+  finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_claim ON jobs(type, run_at) WHERE status IN ('QUEUED', 'RUNNING');
+CREATE INDEX IF NOT EXISTS idx_jobs_finished_at ON jobs(finished_at) WHERE finished_at IS NOT NULL;
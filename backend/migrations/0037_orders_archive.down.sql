@@ -0,0 +1,26 @@
+-- Put archived orders back before dropping the archive
+INSERT INTO orders SELECT * FROM orders_archive;
+INSERT INTO order_items SELECT * FROM order_items_archive;
+INSERT INTO order_status_history SELECT * FROM order_status_history_archive;
+
+DROP VIEW IF EXISTS all_order_status_history;
+DROP VIEW IF EXISTS all_order_items;
+DROP VIEW IF EXISTS all_orders;
+DROP TABLE IF EXISTS order_status_history_archive;
+DROP TABLE IF EXISTS order_items_archive;
+DROP TABLE IF EXISTS orders_archive;
+
+DROP INDEX IF EXISTS idx_orders_user_id;
+DROP INDEX IF EXISTS idx_orders_created_at;
+DROP INDEX IF EXISTS idx_order_items_order_id;
+
+ALTER TABLE orders RESET (autovacuum_vacuum_scale_factor, autovacuum_analyze_scale_factor);
+ALTER TABLE order_items RESET (autovacuum_vacuum_scale_factor, autovacuum_analyze_scale_factor);
+ALTER TABLE order_status_history RESET (autovacuum_vacuum_scale_factor, autovacuum_analyze_scale_factor);
+
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_order_id_fkey
+  FOREIGN KEY (order_id) REFERENCES orders(id);
+ALTER TABLE refunds ADD CONSTRAINT refunds_order_id_fkey
+  FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE;
+ALTER TABLE support_tickets ADD CONSTRAINT support_tickets_order_id_fkey
+  FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE SET NULL;
@@ -0,0 +1,63 @@
+-- Orders that finished long ago move to *_archive tables (see
+-- orders.ArchiveOrders), keeping the live tables small enough that listing,
+-- capacity, and fee queries stay fast. Archive tables mirror their live
+-- table column for column so rows move with INSERT ... SELECT *: a migration
+-- that adds a column to orders, order_items, or order_status_history must
+-- add it to the archive table too, in the same order.
+CREATE TABLE IF NOT EXISTS orders_archive (LIKE orders);
+ALTER TABLE orders_archive ADD PRIMARY KEY (id);
+ALTER TABLE orders_archive ADD FOREIGN KEY (user_id) REFERENCES users(id);
+CREATE INDEX IF NOT EXISTS idx_orders_archive_user_id ON orders_archive(user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS order_items_archive (LIKE order_items);
+ALTER TABLE order_items_archive ADD PRIMARY KEY (id);
+-- Items on archived orders still cannot be deleted, only marked unavailable
+ALTER TABLE order_items_archive ADD FOREIGN KEY (item_id) REFERENCES items(id);
+CREATE INDEX IF NOT EXISTS idx_order_items_archive_order_id ON order_items_archive(order_id);
+
+CREATE TABLE IF NOT EXISTS order_status_history_archive (LIKE order_status_history);
+ALTER TABLE order_status_history_archive ADD PRIMARY KEY (id);
+CREATE INDEX IF NOT EXISTS idx_order_status_history_archive_order_id ON order_status_history_archive(order_id);
+
+-- History listings filter on user and sort by date; the archiver scans by
+-- date. Both branches of all_orders carry the (user_id, created_at) index so
+-- a page of history is a merge of two index scans.
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders(created_at);
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items(order_id);
+
+-- Everything a customer has ever ordered, live or archived. Views expand *
+-- when created, so recreate these after adding columns to orders.
+CREATE OR REPLACE VIEW all_orders AS
+  SELECT o.*, FALSE AS archived FROM orders o
+  UNION ALL
+  SELECT a.*, TRUE AS archived FROM orders_archive a;
+
+CREATE OR REPLACE VIEW all_order_items AS
+  SELECT * FROM order_items
+  UNION ALL
+  SELECT * FROM order_items_archive;
+
+CREATE OR REPLACE VIEW all_order_status_history AS
+  SELECT * FROM order_status_history
+  UNION ALL
+  SELECT * FROM order_status_history_archive;
+
+-- Money records outlive the live order row: they keep its id, which stays
+-- unique across live and archived orders since both come from one sequence.
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_order_id_fkey;
+ALTER TABLE refunds DROP CONSTRAINT IF EXISTS refunds_order_id_fkey;
+ALTER TABLE support_tickets DROP CONSTRAINT IF EXISTS support_tickets_order_id_fkey;
+
+-- Each archiver run deletes a batch of old rows from the live tables. Vacuum
+-- them sooner than the 20% default so the space is reused by new orders
+-- instead of growing the heap; the archiver also runs VACUUM (ANALYZE) after
+-- a run that moved anything. Archive tables are insert-only, so pack their
+-- pages full and let insert-triggered autovacuum keep the visibility map
+-- current for index-only scans.
+ALTER TABLE orders SET (autovacuum_vacuum_scale_factor = 0.02, autovacuum_analyze_scale_factor = 0.02);
+ALTER TABLE order_items SET (autovacuum_vacuum_scale_factor = 0.02, autovacuum_analyze_scale_factor = 0.02);
+ALTER TABLE order_status_history SET (autovacuum_vacuum_scale_factor = 0.02, autovacuum_analyze_scale_factor = 0.02);
+ALTER TABLE orders_archive SET (fillfactor = 100, autovacuum_vacuum_insert_scale_factor = 0.05);
+ALTER TABLE order_items_archive SET (fillfactor = 100, autovacuum_vacuum_insert_scale_factor = 0.05);
+ALTER TABLE order_status_history_archive SET (fillfactor = 100, autovacuum_vacuum_insert_scale_factor = 0.05);
@@ -0,0 +1,33 @@
+-- Announcement emails composed by admins and sent to an audience of
+-- students. Sending snapshots the audience into email_campaign_recipients,
+-- which the send job works through at a throttled rate.
+CREATE TABLE IF NOT EXISTS email_campaigns (
+  id SERIAL PRIMARY KEY,
+  subject TEXT NOT NULL,
+  body TEXT NOT NULL, -- text/template over the recipient, e.g. {{.Username}}
+  audience TEXT NOT NULL CHECK (audience IN ('VERIFIED', 'ACTIVE_30D')),
+  status TEXT NOT NULL DEFAULT 'DRAFT' CHECK (status IN ('DRAFT', 'SENDING', 'SENT', 'CANCELLED')),
+  created_by INT REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  started_at TIMESTAMPTZ,
+  finished_at TIMESTAMPTZ
+);
+
+-- One row per student a campaign goes to. message_id matches email_log, so
+-- bounces reported by the delivery webhook count against the campaign;
+-- open_token is the tracking pixel's path.
+CREATE TABLE IF NOT EXISTS email_campaign_recipients (
+  campaign_id INT NOT NULL REFERENCES email_campaigns(id) ON DELETE CASCADE,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'SENT', 'FAILED', 'SUPPRESSED')),
+  message_id TEXT,
+  open_token TEXT NOT NULL UNIQUE DEFAULT replace(gen_random_uuid()::text, '-', ''),
+  sent_at TIMESTAMPTZ,
+  opened_at TIMESTAMPTZ,
+  PRIMARY KEY (campaign_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_campaign_recipients_pending
+  ON email_campaign_recipients(campaign_id, user_id) WHERE status = 'PENDING';
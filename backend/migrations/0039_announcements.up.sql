@@ -0,0 +1,15 @@
+-- Operational notices (e.g. a changed pickup station) shown as banners by
+-- the frontend and in the chat greeting while now is in [starts_at, ends_at).
+-- ends_at NULL keeps one up until it is ended or deleted.
+CREATE TABLE IF NOT EXISTS announcements (
+  id SERIAL PRIMARY KEY,
+  message TEXT NOT NULL,
+  severity TEXT NOT NULL DEFAULT 'INFO' CHECK (severity IN ('INFO', 'WARNING', 'CRITICAL')),
+  starts_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  ends_at TIMESTAMPTZ CHECK (ends_at > starts_at),
+  created_by INT REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_announcements_window ON announcements(starts_at, ends_at);
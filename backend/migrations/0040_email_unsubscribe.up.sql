@@ -0,0 +1,3 @@
+-- Students get announcement emails unless they unsubscribe, from the link
+-- in each one or in their profile
+ALTER TABLE users ADD COLUMN IF NOT EXISTS announcements BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,6 @@
+-- Verification links work until they expire rather than once, so a mail
+-- scanner opening one first does not spend it. Links already sent get the
+-- usual 48 hours from now.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS verification_expires TIMESTAMPTZ;
+UPDATE users SET verification_expires = NOW() + INTERVAL '48 hours'
+ WHERE verification_token IS NOT NULL AND NOT verified;
@@ -0,0 +1,6 @@
+-- Settings edited through /admin/config, one JSON value per key in the
+-- schema served at GET /admin/config/schema
+CREATE TABLE IF NOT EXISTS config (
+  key        TEXT PRIMARY KEY,
+  value_json JSONB NOT NULL
+);
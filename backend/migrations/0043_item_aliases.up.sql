@@ -0,0 +1,14 @@
+-- Other names students use for items, such as "mkate" for bread or
+-- "sukari" for sugar. Catalog search matches them like item names.
+CREATE TABLE IF NOT EXISTS item_aliases (
+  id         SERIAL PRIMARY KEY,
+  item_id    INTEGER NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+  alias      TEXT NOT NULL CHECK (alias <> ''),
+  language   TEXT NOT NULL DEFAULT 'en' CHECK (language IN ('en', 'lg', 'sw')),
+  created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- An alias names one item only, so it always finds the same one
+CREATE UNIQUE INDEX IF NOT EXISTS idx_item_aliases_alias ON item_aliases (LOWER(alias));
+CREATE INDEX IF NOT EXISTS idx_item_aliases_item_id ON item_aliases (item_id);
@@ -0,0 +1,15 @@
+-- Product phrases from chat that matched no item, lowercased, with the
+-- message they came from. Admins map frequent ones to items, which adds an alias, or dismiss
+-- them.
+CREATE TABLE IF NOT EXISTS catalog_misses (
+  id          BIGSERIAL PRIMARY KEY,
+  phrase      TEXT NOT NULL,
+  user_id     INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  message     TEXT NOT NULL,
+  status      TEXT NOT NULL DEFAULT 'OPEN' CHECK (status IN ('OPEN', 'MAPPED', 'DISMISSED')),
+  alias_id    INTEGER REFERENCES item_aliases(id) ON DELETE SET NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  reviewed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_catalog_misses_open ON catalog_misses (phrase) WHERE status = 'OPEN';
@@ -0,0 +1,9 @@
+-- One row per student reminded of an unconfirmed chat draft before the
+-- day's order cutoff, so nobody is nudged twice in a day
+CREATE TABLE IF NOT EXISTS cutoff_reminders (
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  day DATE NOT NULL,               -- Kampala ordering day
+  order_id INT NOT NULL,           -- the draft reminded about
+  sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, day)
+);
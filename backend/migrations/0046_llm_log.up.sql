@@ -0,0 +1,16 @@
+-- A sample of LLM calls, prompt and reply, for debugging extraction quality.
+-- chat.llm_log_percent sets the share logged and chat.llm_log_days how long
+-- rows are kept.
+CREATE TABLE IF NOT EXISTS llm_log (
+  id            BIGSERIAL PRIMARY KEY,
+  operation     TEXT NOT NULL,        -- "extract" or "menu"
+  model         TEXT NOT NULL,
+  system_prompt TEXT NOT NULL,
+  user_prompt   TEXT NOT NULL,
+  response      TEXT NOT NULL DEFAULT '',
+  error         TEXT NOT NULL DEFAULT '',
+  latency_ms    INT NOT NULL,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_log_created ON llm_log (created_at DESC);
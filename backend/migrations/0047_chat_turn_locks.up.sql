@@ -0,0 +1,8 @@
+-- The chat turn being processed for each student, so a second message sent
+-- meanwhile is turned away rather than racing the first over the same
+-- draft. expires_at frees the lock if the instance holding it dies.
+CREATE TABLE IF NOT EXISTS chat_turn_locks (
+  user_id    INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  token      TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,11 @@
+DROP VIEW IF EXISTS all_orders;
+ALTER TABLE orders_archive DROP COLUMN IF EXISTS off_network;
+ALTER TABLE orders DROP COLUMN IF EXISTS off_network;
+CREATE VIEW all_orders AS
+  SELECT o.*, FALSE AS archived FROM orders o
+  UNION ALL
+  SELECT a.*, TRUE AS archived FROM orders_archive a;
+
+ALTER TABLE users DROP COLUMN IF EXISTS address_verified_at;
+ALTER TABLE campuses DROP COLUMN IF EXISTS off_network_policy;
+ALTER TABLE campuses DROP COLUMN IF EXISTS networks;
@@ -0,0 +1,19 @@
+-- Campus networks: orders placed from outside a campus's address ranges are
+-- flagged off_network, or refused when the campus's policy is BLOCK. A
+-- campus with no networks accepts orders from anywhere, and students whose
+-- delivery address support has verified are never checked.
+ALTER TABLE campuses ADD COLUMN IF NOT EXISTS networks CIDR[] NOT NULL DEFAULT '{}';
+ALTER TABLE campuses ADD COLUMN IF NOT EXISTS off_network_policy TEXT NOT NULL DEFAULT 'TAG'
+  CHECK (off_network_policy IN ('TAG', 'BLOCK'));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS address_verified_at TIMESTAMPTZ;
+
+-- The archive mirrors orders column for column, and all_orders expands *
+-- when created, so both follow the new column
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS off_network BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE orders_archive ADD COLUMN IF NOT EXISTS off_network BOOLEAN NOT NULL DEFAULT FALSE;
+DROP VIEW IF EXISTS all_orders;
+CREATE VIEW all_orders AS
+  SELECT o.*, FALSE AS archived FROM orders o
+  UNION ALL
+  SELECT a.*, TRUE AS archived FROM orders_archive a;
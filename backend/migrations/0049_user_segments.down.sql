@@ -0,0 +1,8 @@
+-- Campaigns drafted for a segment fall back to every verified student
+UPDATE email_campaigns SET audience = 'VERIFIED'
+ WHERE audience IN ('NEW', 'WEEKLY_ACTIVE', 'CHURN_RISK', 'HIGH_SPENDER');
+ALTER TABLE email_campaigns DROP CONSTRAINT IF EXISTS email_campaigns_audience_check;
+ALTER TABLE email_campaigns ADD CONSTRAINT email_campaigns_audience_check
+  CHECK (audience IN ('VERIFIED', 'ACTIVE_30D'));
+
+DROP TABLE IF EXISTS user_segments;
@@ -0,0 +1,15 @@
+-- Computed student segments, rebuilt nightly by segments.RunNightly, for
+-- filtering the admin user list and as campaign audiences. A student may be
+-- in several segments or none.
+CREATE TABLE IF NOT EXISTS user_segments (
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  segment TEXT NOT NULL CHECK (segment IN ('NEW', 'WEEKLY_ACTIVE', 'CHURN_RISK', 'HIGH_SPENDER')),
+  computed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, segment)
+);
+CREATE INDEX IF NOT EXISTS idx_user_segments_segment ON user_segments(segment);
+
+-- Each segment is also a campaign audience
+ALTER TABLE email_campaigns DROP CONSTRAINT IF EXISTS email_campaigns_audience_check;
+ALTER TABLE email_campaigns ADD CONSTRAINT email_campaigns_audience_check
+  CHECK (audience IN ('VERIFIED', 'ACTIVE_30D', 'NEW', 'WEEKLY_ACTIVE', 'CHURN_RISK', 'HIGH_SPENDER'));
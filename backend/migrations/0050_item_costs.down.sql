@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS item_cost(INT, TIMESTAMPTZ);
+DROP TABLE IF EXISTS item_costs;
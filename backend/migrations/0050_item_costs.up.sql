@@ -0,0 +1,21 @@
+-- Supplier cost prices. Each row is what an item costs from effective_from
+-- until the next row for it, so margins on past sales use the cost in force
+-- when they were sold rather than today's.
+CREATE TABLE IF NOT EXISTS item_costs (
+  id SERIAL PRIMARY KEY,
+  item_id INT NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+  cost_ugx INT NOT NULL CHECK (cost_ugx >= 0), -- per unit, net of VAT
+  effective_from TIMESTAMPTZ NOT NULL,
+  supplier TEXT NOT NULL DEFAULT '',
+  created_by INT REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_item_costs_item ON item_costs(item_id, effective_from);
+
+-- What an item cost at a given time, or NULL before its first cost price.
+CREATE OR REPLACE FUNCTION item_cost(p_item_id INT, p_at TIMESTAMPTZ) RETURNS INT AS $$
+  SELECT c.cost_ugx FROM item_costs c
+   WHERE c.item_id = p_item_id AND c.effective_from <= p_at
+   ORDER BY c.effective_from DESC, c.id DESC LIMIT 1
+$$ LANGUAGE sql STABLE;
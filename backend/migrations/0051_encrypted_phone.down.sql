@@ -0,0 +1,4 @@
+-- Numbers still encrypted stay so; run this only after decrypting them
+DROP INDEX IF EXISTS idx_users_phone_hash;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_hash;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone ON users(phone) WHERE phone IS NOT NULL;
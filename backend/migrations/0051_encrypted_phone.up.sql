@@ -0,0 +1,7 @@
+-- Phone numbers are encrypted by the application (package fieldcrypt), so
+-- equal numbers no longer look equal in SQL; uniqueness moves to a keyed
+-- hash of the number. Rows written before this get their hash when
+-- `jaj-server reseal` encrypts them.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_hash TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone_hash ON users(phone_hash) WHERE phone_hash IS NOT NULL;
+DROP INDEX IF EXISTS idx_users_phone;
@@ -0,0 +1,16 @@
+-- Operational alerts raised by package alerts. A rule fires at most once per
+-- server at a time: the open row is updated while it stays over threshold
+-- and closed, with resolved_at, when it clears.
+CREATE TABLE IF NOT EXISTS alerts (
+  id BIGSERIAL PRIMARY KEY,
+  rule TEXT NOT NULL,
+  instance TEXT NOT NULL,
+  value DOUBLE PRECISION NOT NULL,
+  threshold DOUBLE PRECISION NOT NULL,
+  started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  resolved_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_alerts_open ON alerts(rule, instance) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_alerts_resolved ON alerts(resolved_at) WHERE resolved_at IS NOT NULL;
@@ -0,0 +1,13 @@
+-- Products a chat message named that match several variants of one item,
+-- e.g. "milk" with Jesa Milk (500ml) and (2L) in stock. The draft waits on
+-- them, oldest first, until the student picks one from item_ids.
+CREATE TABLE IF NOT EXISTS order_clarifications (
+  id SERIAL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  phrase TEXT NOT NULL,   -- as the student wrote it
+  quantity INT NOT NULL CHECK (quantity > 0),
+  item_ids INT[] NOT NULL, -- the options, in the order offered
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_clarifications_order ON order_clarifications(order_id, id);
@@ -0,0 +1,6 @@
+-- Hashes cannot be turned back into tokens, so every session ends
+DELETE FROM sessions;
+DROP INDEX IF EXISTS idx_sessions_previous_hash;
+ALTER TABLE sessions DROP COLUMN IF EXISTS previous_hash;
+ALTER TABLE sessions DROP COLUMN IF EXISTS rotated_at;
+ALTER TABLE sessions RENAME COLUMN token_hash TO token;
@@ -0,0 +1,12 @@
+-- Sessions keep only the SHA-256 of their token, hex-encoded, so a copy of
+-- the table cannot be replayed as cookies. Existing tokens are hashed in
+-- place and keep working.
+ALTER TABLE sessions RENAME COLUMN token TO token_hash;
+UPDATE sessions SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+-- Tokens are replaced on use once a day old. The one replaced still works
+-- briefly, for requests already in flight with the old cookie.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS previous_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_hash ON sessions(previous_hash) WHERE previous_hash IS NOT NULL;
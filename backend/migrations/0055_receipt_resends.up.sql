@@ -0,0 +1,14 @@
+-- Order confirmations students asked to have sent again, and where to. It
+-- is the audit trail of those requests and what throttles them.
+CREATE TABLE IF NOT EXISTS receipt_resends (
+  id BIGSERIAL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  recipient TEXT NOT NULL,
+  alternate BOOLEAN NOT NULL DEFAULT FALSE, -- not the account's own address
+  job_id BIGINT,                            -- the email job sending it
+  ip TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_receipt_resends_order ON receipt_resends(order_id, created_at);
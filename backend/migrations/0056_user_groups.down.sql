@@ -0,0 +1,11 @@
+DROP VIEW IF EXISTS all_orders;
+ALTER TABLE orders_archive DROP COLUMN IF EXISTS transport_fee_waived;
+ALTER TABLE orders DROP COLUMN IF EXISTS transport_fee_waived;
+CREATE VIEW all_orders AS
+  SELECT o.*, FALSE AS archived FROM orders o
+  UNION ALL
+  SELECT a.*, TRUE AS archived FROM orders_archive a;
+
+DROP INDEX IF EXISTS idx_users_group;
+ALTER TABLE users DROP COLUMN IF EXISTS group_id;
+DROP TABLE IF EXISTS user_groups;
@@ -0,0 +1,28 @@
+-- Groups of users priced differently, e.g. campus staff. A user is in at
+-- most one; users in none pay the regular prices and fees.
+CREATE TABLE IF NOT EXISTS user_groups (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  description TEXT NOT NULL DEFAULT '',
+  -- Added to every item price, in basis points: -1000 is 10% off, 500 a 5%
+  -- markup
+  price_adjust_bps INT NOT NULL DEFAULT 0 CHECK (price_adjust_bps BETWEEN -10000 AND 10000),
+  waive_transport_fee BOOLEAN NOT NULL DEFAULT FALSE,
+  waive_small_order_fee BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS group_id INT REFERENCES user_groups(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_users_group ON users(group_id) WHERE group_id IS NOT NULL;
+
+-- Set when the order was priced without a transport fee, so fee
+-- reconciliation leaves it at zero. The archive and all_orders follow, as
+-- for off_network.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS transport_fee_waived BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE orders_archive ADD COLUMN IF NOT EXISTS transport_fee_waived BOOLEAN NOT NULL DEFAULT FALSE;
+DROP VIEW IF EXISTS all_orders;
+CREATE VIEW all_orders AS
+  SELECT o.*, FALSE AS archived FROM orders o
+  UNION ALL
+  SELECT a.*, TRUE AS archived FROM orders_archive a;
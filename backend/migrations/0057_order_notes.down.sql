@@ -0,0 +1,7 @@
+DROP VIEW IF EXISTS all_orders;
+ALTER TABLE orders_archive DROP COLUMN IF EXISTS note;
+ALTER TABLE orders DROP COLUMN IF EXISTS note;
+CREATE VIEW all_orders AS
+  SELECT o.*, FALSE AS archived FROM orders o
+  UNION ALL
+  SELECT a.*, TRUE AS archived FROM orders_archive a;
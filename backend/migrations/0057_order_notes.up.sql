@@ -0,0 +1,10 @@
+-- A note the student leaves on their order for the packers and runners,
+-- e.g. "ripe bananas please". The archive and all_orders follow, as for
+-- off_network.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS note TEXT NOT NULL DEFAULT '' CHECK (char_length(note) <= 280);
+ALTER TABLE orders_archive ADD COLUMN IF NOT EXISTS note TEXT NOT NULL DEFAULT '';
+DROP VIEW IF EXISTS all_orders;
+CREATE VIEW all_orders AS
+  SELECT o.*, FALSE AS archived FROM orders o
+  UNION ALL
+  SELECT a.*, TRUE AS archived FROM orders_archive a;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS order_item_shortfalls;
+
+DELETE FROM refunds WHERE partial;
+ALTER TABLE refunds DROP COLUMN IF EXISTS partial;
+DROP INDEX IF EXISTS idx_refunds_order_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refunds_order_id ON refunds(order_id);
@@ -0,0 +1,24 @@
+-- Order lines staff could not supply after the order was confirmed (see
+-- orders.handleMarkUnfulfillable). The line leaves order_items, so totals,
+-- packing, and reconciliation only see what is supplied; this keeps what
+-- was dropped and what it was worth for the amended receipt. Like refunds,
+-- rows keep the order id after the order is archived.
+CREATE TABLE IF NOT EXISTS order_item_shortfalls (
+  id SERIAL PRIMARY KEY,
+  order_id INT NOT NULL,
+  item_id INT NOT NULL REFERENCES items(id),
+  quantity INT NOT NULL CHECK (quantity > 0),
+  unit_price INT NOT NULL,
+  tax_amount INT NOT NULL DEFAULT 0,
+  reason TEXT NOT NULL DEFAULT '',
+  staff_id INT REFERENCES users(id) ON DELETE SET NULL,
+  refund_id INT REFERENCES refunds(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_order_item_shortfalls_order ON order_item_shortfalls(order_id);
+
+-- A paid order is now refunded in part for each shortfall, as well as in
+-- full if it is then cancelled. Partial refunds leave the order PAID.
+DROP INDEX IF EXISTS idx_refunds_order_id;
+CREATE INDEX IF NOT EXISTS idx_refunds_order_id ON refunds(order_id);
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS partial BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+ALTER TABLE campuses DROP COLUMN IF EXISTS time_zone;
+ALTER TABLE campuses DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,7 @@
+-- How a campus shows amounts and times to its students: the currency code
+-- prices are in, and the IANA time zone dates are written in. Both are
+-- checked by the server when set; pickup times are still reckoned in
+-- Kampala time.
+ALTER TABLE campuses ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'UGX'
+  CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE campuses ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'Africa/Kampala';
@@ -0,0 +1,3 @@
+-- The address each support action came from, as found behind trusted
+-- proxies; empty for entries recorded before it was kept.
+ALTER TABLE admin_audit_log ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
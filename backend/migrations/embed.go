@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL schema migrations so the server binary
+// does not depend on its working directory.
+package migrations
+
+import "embed"
+
+// FS holds every NNNN_name.{up,down}.sql file in this directory.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,10 @@
+// Package templates embeds the email templates so the server binary does
+// not depend on its working directory.
+package templates
+
+import "embed"
+
+// FS holds every .txt and .html email template in this directory.
+//
+//go:embed *.txt *.html
+var FS embed.FS
@@ -5,6 +5,7 @@ export interface SignupData {
   username: string;
   email: string;
   password: string;
+  inviteCode?: string;
 }
 
 export interface SignupResponse {
@@ -36,6 +37,10 @@ const signupUser = async (userData: SignupData): Promise<SignupResponse> => {
 
   if (!response.ok) {
     const errorData = await response.json().catch(() => ({}));
+    if (Array.isArray(errorData.fields) && errorData.fields.length > 0) {
+      const { field, message } = errorData.fields[0];
+      throw new Error(field === 'inviteCode' ? `Invitation code ${message}` : `${field} ${message}`);
+    }
     throw new Error(errorData.message || `HTTP error! status: ${response.status}`);
   }
 
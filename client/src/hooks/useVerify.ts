@@ -15,7 +15,15 @@ interface UseVerifyTokenOptions {
 }
 
 const verifyToken = async (token: string): Promise<VerifyResponse> => {
-  const response = await fetch(`${import.meta.env.VITE_API_URL}/verify?token=${encodeURIComponent(token)}`);
+  // GET only checks the token; POST is what verifies the account
+  const response = await fetch(`${import.meta.env.VITE_API_URL}/verify`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      Accept: "application/json",
+    },
+    body: JSON.stringify({ token }),
+  });
   
   if (!response.ok) {
     const errorData = await response.json().catch(() => ({}));
@@ -37,7 +45,7 @@ export const useVerifyToken = (
     redirectDelay = 1500,
   } = options;
 
-  // Use TanStack Query v4 to call GET /verify?token=<token>
+  // Use TanStack Query to POST the token to /verify once
   const { data, isLoading, isError, error } = useQuery({
     queryKey: ["verify", token],
     queryFn: () => verifyToken(token!),
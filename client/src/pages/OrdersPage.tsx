@@ -30,9 +30,17 @@ interface FetchOrdersParams {
   limit?: number;
 }
 
+interface PaginatedResponse<T> {
+  data: T[];
+  page: number;
+  limit: number;
+  totalItems: number;
+  totalPages: number;
+}
+
 const fetchOrders = async (params: FetchOrdersParams): Promise<Order[]> => {
-  const response = await axios.get<Order[]>("/orders", { params });
-  return response.data;
+  const response = await axios.get<PaginatedResponse<Order>>("/orders", { params });
+  return response.data.data;
 };
 
 const OrdersPage: React.FC = () => {
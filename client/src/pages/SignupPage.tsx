@@ -1,16 +1,18 @@
 import React, { useState, useEffect } from "react";
-import { Eye, EyeOff, User, Mail, Lock, ArrowRight, CheckCircle, AlertCircle, X } from "lucide-react";
-import { useNavigate } from "react-router-dom";
+import { Eye, EyeOff, User, Mail, Lock, Ticket, ArrowRight, CheckCircle, AlertCircle, X } from "lucide-react";
+import { useNavigate, useSearchParams } from "react-router-dom";
 import { useSignup } from "../hooks/useSignup"; 
 
 const SignupPage: React.FC = () => {
   const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
   const [showPassword, setShowPassword] = useState(false);
   const [mounted, setMounted] = useState(false);
   const [formData, setFormData] = useState({
     username: '',
     email: '',
-    password: ''
+    password: '',
+    inviteCode: searchParams.get('invite') ?? ''
   });
   const [errors, setErrors] = useState<{[key: string]: string}>({});
   const [notification, setNotification] = useState<{
@@ -82,7 +84,7 @@ const SignupPage: React.FC = () => {
       onSuccess: (_data) => {
         showNotification('success', 'Account created successfully! Redirecting to login...');
         // Reset form on success
-        setFormData({ username: '', email: '', password: '' });
+        setFormData({ username: '', email: '', password: '', inviteCode: '' });
         setErrors({});
         
         // Redirect to login page after a short delay to show the success message
@@ -332,6 +334,26 @@ const SignupPage: React.FC = () => {
                 </div>
               </div>
 
+              {/* Invitation Code Field */}
+              <div className="group">
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  Invitation Code
+                </label>
+                <div className="relative">
+                  <div className="absolute inset-y-0 left-0 pl-4 flex items-center pointer-events-none">
+                    <Ticket className="h-5 w-5 transition-colors text-gray-400 group-focus-within:text-[#FA5D0F]" />
+                  </div>
+                  <input
+                    type="text"
+                    value={formData.inviteCode}
+                    onChange={(e) => handleInputChange('inviteCode', e.target.value.toUpperCase())}
+                    disabled={signupMutation.isPending}
+                    className="w-full pl-12 pr-4 py-3.5 border-2 rounded-xl backdrop-blur-sm bg-white/50 focus:bg-white/80 transition-all duration-200 focus:outline-none focus:ring-4 disabled:opacity-50 disabled:cursor-not-allowed border-white/30 focus:border-[#FA5D0F] focus:ring-[#FA5D0F]/20"
+                    placeholder="XXXX-XXXX (if you have one)"
+                  />
+                </div>
+              </div>
+
               {/* Submit Button */}
               <button
                 onClick={handleSubmit}